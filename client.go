@@ -2,6 +2,7 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -20,19 +21,37 @@ import (
 type client struct {
 	mutex sync.Mutex
 
-	conn     connection
+	conn connection
+	// muxConn is the socket shared with other clients and servers.
+	// It is nil in the tests.
+	muxConn  *muxConn
 	hostname string
 
 	versionNegotiated                bool // has the server accepted our version
 	receivedVersionNegotiationPacket bool
 	negotiatedVersions               []protocol.VersionNumber // the list of versions from the version negotiation packet
 
+	receivedRetry bool
+	token         []byte // the token received in a Retry packet (for IETF QUIC)
+
+	// pskCache is nil if no ClientSessionCache is configured (for IETF QUIC)
+	pskCache *clientPSKCache
+	// early is set if the session is returned before the handshake completes, in order to send 0-RTT data
+	early bool
+
 	tlsConf *tls.Config
 	config  *Config
 	tls     handshake.MintTLS // only used when using TLS
 
 	srcConnID  protocol.ConnectionID
 	destConnID protocol.ConnectionID
+	// connIDs are the additional connection IDs that the session issued to the server.
+	// They are protected by the connIDMutex, since they are added from the session's run loop.
+	connIDs []protocol.ConnectionID
+	// resetTokens are the stateless reset tokens received from the server.
+	// They are protected by the connIDMutex as well.
+	resetTokens [][16]byte
+	connIDMutex sync.RWMutex
 
 	initialVersion protocol.VersionNumber
 	version        protocol.VersionNumber
@@ -41,6 +60,12 @@ type client struct {
 
 	session packetHandler
 
+	// paths are the paths added by the session for a connection migration, see Session.MigrateTo.
+	// The value is set when quic-go should stop reading from the path.
+	// They are protected by the pathMutex, since they are added from the session's run loop.
+	paths     map[connection]bool
+	pathMutex sync.Mutex
+
 	logger utils.Logger
 }
 
@@ -53,6 +78,25 @@ var (
 // DialAddr establishes a new QUIC connection to a server.
 // The hostname for SNI is taken from the given address.
 func DialAddr(addr string, tlsConf *tls.Config, config *Config) (Session, error) {
+	return DialAddrContext(context.Background(), addr, tlsConf, config)
+}
+
+// DialAddrContext establishes a new QUIC connection to a server using the provided context.
+// If the context expires before the handshake completes, the session is closed and the error of the context is returned.
+// The hostname for SNI is taken from the given address.
+func DialAddrContext(ctx context.Context, addr string, tlsConf *tls.Config, config *Config) (Session, error) {
+	return dialAddrContext(ctx, addr, tlsConf, config, false)
+}
+
+// DialAddrEarly establishes a new QUIC connection to a server.
+// If a session is resumed, it returns before the handshake completes, and data is sent as 0-RTT data.
+// Otherwise, it behaves like DialAddr.
+// The hostname for SNI is taken from the given address.
+func DialAddrEarly(addr string, tlsConf *tls.Config, config *Config) (EarlySession, error) {
+	return dialAddrContext(context.Background(), addr, tlsConf, config, true)
+}
+
+func dialAddrContext(ctx context.Context, addr string, tlsConf *tls.Config, config *Config, early bool) (packetHandler, error) {
 	udpAddr, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return nil, err
@@ -61,10 +105,19 @@ func DialAddr(addr string, tlsConf *tls.Config, config *Config) (Session, error)
 	if err != nil {
 		return nil, err
 	}
-	return Dial(udpConn, udpAddr, addr, tlsConf, config)
+	sess, err := dialContext(ctx, udpConn, udpAddr, addr, tlsConf, config, early)
+	if err != nil {
+		// we created the UDP socket, so we're responsible for releasing it
+		udpConn.Close()
+		return nil, err
+	}
+	return sess, nil
 }
 
 // Dial establishes a new QUIC connection to a server using a net.PacketConn.
+// The same net.PacketConn can be used to Dial multiple connections, and to Listen for incoming connections.
+// Packets are routed to the right session by their connection ID.
+// This requires a connection ID length greater than zero, and the connection ID must not be omitted.
 // The host parameter is used for SNI.
 func Dial(
 	pconn net.PacketConn,
@@ -73,19 +126,59 @@ func Dial(
 	tlsConf *tls.Config,
 	config *Config,
 ) (Session, error) {
+	return DialContext(context.Background(), pconn, remoteAddr, host, tlsConf, config)
+}
+
+// DialContext establishes a new QUIC connection to a server using a net.PacketConn using the provided context.
+// If the context expires before the handshake completes, the session is closed and the error of the context is returned.
+// The net.PacketConn is not closed.
+// The host parameter is used for SNI.
+func DialContext(
+	ctx context.Context,
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+) (Session, error) {
+	return dialContext(ctx, pconn, remoteAddr, host, tlsConf, config, false)
+}
+
+// DialEarly establishes a new QUIC connection to a server using a net.PacketConn.
+// If a session is resumed using the quic.Config.ClientSessionCache, it returns before the handshake completes,
+// and all data sent before the handshake completes is sent as 0-RTT data.
+// If the server rejects 0-RTT, this data is retransmitted after the handshake.
+// If the server sends a Retry packet, the session is closed, and the application has to dial again.
+// If no session is resumed, it behaves like Dial.
+// The host parameter is used for SNI.
+func DialEarly(
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+) (EarlySession, error) {
+	return dialContext(context.Background(), pconn, remoteAddr, host, tlsConf, config, true)
+}
+
+func dialContext(
+	ctx context.Context,
+	pconn net.PacketConn,
+	remoteAddr net.Addr,
+	host string,
+	tlsConf *tls.Config,
+	config *Config,
+	early bool,
+) (packetHandler, error) {
 	clientConfig := populateClientConfig(config)
+	if l := clientConfig.ConnectionIDLength; l != 0 && (l < 4 || l > 18) {
+		return nil, fmt.Errorf("invalid connection ID length: %d bytes", l)
+	}
 	version := clientConfig.Versions[0]
-	srcConnID, err := generateConnectionID()
+	srcConnID, destConnID, err := generateConnectionIDs(version, clientConfig.ConnectionIDGenerator)
 	if err != nil {
 		return nil, err
 	}
-	destConnID := srcConnID
-	if version.UsesTLS() {
-		destConnID, err = generateConnectionID()
-		if err != nil {
-			return nil, err
-		}
-	}
 
 	var hostname string
 	if tlsConf != nil {
@@ -107,25 +200,47 @@ func Dial(
 		}
 	}
 	c := &client{
-		conn:          &conn{pconn: pconn, currentAddr: remoteAddr},
 		srcConnID:     srcConnID,
 		destConnID:    destConnID,
 		hostname:      hostname,
 		tlsConf:       tlsConf,
 		config:        clientConfig,
 		version:       version,
+		early:         early,
 		handshakeChan: make(chan struct{}),
 		logger:        utils.DefaultLogger.WithPrefix("client"),
 	}
+	c.muxConn = multiplexer.AddClient(pconn)
+	c.conn = &conn{pconn: c.muxConn, currentAddr: remoteAddr}
 
 	c.logger.Infof("Starting new connection to %s (%s -> %s), source connection ID %s, destination connection ID %s, version %s", hostname, c.conn.LocalAddr(), c.conn.RemoteAddr(), c.srcConnID, c.destConnID, c.version)
 
-	if err := c.dial(); err != nil {
+	if err := c.dial(ctx); err != nil {
+		c.muxConn.Close()
 		return nil, err
 	}
 	return c.session, nil
 }
 
+// generateConnectionIDs generates the source and the destination connection ID for a new connection.
+// The destination connection ID is always chosen randomly.
+// In gQUIC, there's only one connection ID, which is always 8 bytes long.
+func generateConnectionIDs(version protocol.VersionNumber, g ConnectionIDGenerator) (protocol.ConnectionID, protocol.ConnectionID, error) {
+	if !version.UsesTLS() {
+		connID, err := generateConnectionID(protocol.ConnectionIDLenGQUIC)
+		return connID, connID, err
+	}
+	srcConnID, err := generateConnID(g)
+	if err != nil {
+		return nil, nil, err
+	}
+	destConnID, err := generateConnectionID(protocol.MinConnectionIDLenInitial)
+	if err != nil {
+		return nil, nil, err
+	}
+	return srcConnID, destConnID, nil
+}
+
 // populateClientConfig populates fields in the quic.Config with their default values, if none are set
 // it may be called with nil
 func populateClientConfig(config *Config) *Config {
@@ -166,6 +281,17 @@ func populateClientConfig(config *Config) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	connIDGenerator := config.ConnectionIDGenerator
+	if connIDGenerator == nil {
+		connIDLen := config.ConnectionIDLength
+		if connIDLen == 0 {
+			connIDLen = protocol.DefaultConnectionIDLength
+		} else if connIDLen < 0 {
+			connIDLen = 0
+		}
+		connIDGenerator = &randomConnIDGenerator{length: connIDLen}
+	}
+	qlogDir := getQlogDir(config)
 
 	return &Config{
 		Versions:                              versions,
@@ -177,31 +303,41 @@ func populateClientConfig(config *Config) *Config {
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
 		KeepAlive:                             config.KeepAlive,
+		EnableDatagrams:                       config.EnableDatagrams,
+		DisablePathMTUDiscovery:               config.DisablePathMTUDiscovery,
+		ConnectionIDLength:                    connIDGenerator.ConnectionIDLen(),
+		ConnectionIDGenerator:                 connIDGenerator,
+		StatelessResetKey:                     config.StatelessResetKey,
+		Tracer:                                addQlogTracer(config.Tracer, qlogDir),
+		QlogDir:                               qlogDir,
+		ClientSessionCache:                    config.ClientSessionCache,
+		ClientConfigCache:                     config.ClientConfigCache,
+		CongestionControl:                     config.CongestionControl,
 	}
 }
 
-func (c *client) dial() error {
+func (c *client) dial(ctx context.Context) error {
 	var err error
 	if c.version.UsesTLS() {
-		err = c.dialTLS()
+		err = c.dialTLS(ctx)
 	} else {
-		err = c.dialGQUIC()
+		err = c.dialGQUIC(ctx)
 	}
 	if err == errCloseSessionForNewVersion {
-		return c.dial()
+		return c.dial(ctx)
 	}
 	return err
 }
 
-func (c *client) dialGQUIC() error {
+func (c *client) dialGQUIC(ctx context.Context) error {
 	if err := c.createNewGQUICSession(); err != nil {
 		return err
 	}
-	go c.listen()
-	return c.establishSecureConnection()
+	go c.listen(c.conn)
+	return c.establishSecureConnection(ctx)
 }
 
-func (c *client) dialTLS() error {
+func (c *client) dialTLS(ctx context.Context) error {
 	params := &handshake.TransportParameters{
 		StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
 		ConnectionFlowControlWindow: protocol.ReceiveConnectionFlowControlWindow,
@@ -210,50 +346,86 @@ func (c *client) dialTLS() error {
 		MaxBidiStreams:              uint16(c.config.MaxIncomingStreams),
 		MaxUniStreams:               uint16(c.config.MaxIncomingUniStreams),
 	}
-	csc := handshake.NewCryptoStreamConn(nil)
-	extHandler := handshake.NewExtensionHandlerClient(params, c.initialVersion, c.config.Versions, c.version, c.logger)
-	mintConf, err := tlsToMintConfig(c.tlsConf, protocol.PerspectiveClient)
+	if c.config.EnableDatagrams {
+		params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
+	}
+	// The session state is loaded only once, such that it is still available when the session is recreated.
+	if c.config.ClientSessionCache != nil && c.pskCache == nil {
+		c.pskCache = newClientPSKCache(c.config.ClientSessionCache, c.hostname, c.version, c.early)
+		if c.token == nil {
+			c.token = c.pskCache.Token()
+		}
+	}
+	paramsChan, err := c.createMintController(params)
 	if err != nil {
 		return err
 	}
-	mintConf.ExtensionHandler = extHandler
-	mintConf.ServerName = c.hostname
-	c.tls = newMintController(csc, mintConf, protocol.PerspectiveClient)
-
-	if err := c.createNewTLSSession(extHandler.GetPeerParams(), c.version); err != nil {
+	if err := c.createNewTLSSession(paramsChan, c.version); err != nil {
 		return err
 	}
-	go c.listen()
-	if err := c.establishSecureConnection(); err != nil {
+	go c.listen(c.conn)
+	if c.pskCache != nil && c.pskCache.ZeroRTTParams() != nil {
+		// The session is used to send 0-RTT data. The handshake is completed in the background.
+		go c.runSession(c.session, false)
+		return nil
+	}
+	if err := c.establishSecureConnection(ctx); err != nil {
 		if err != handshake.ErrCloseSessionForRetry {
 			return err
 		}
 		c.logger.Infof("Received a Retry packet. Recreating session.")
-		if err := c.createNewTLSSession(extHandler.GetPeerParams(), c.version); err != nil {
+		// The ClientHello has to be sent again, so the handshake starts from scratch.
+		paramsChan, err := c.createMintController(params)
+		if err != nil {
+			return err
+		}
+		if err := c.createNewTLSSession(paramsChan, c.version); err != nil {
 			return err
 		}
-		if err := c.establishSecureConnection(); err != nil {
+		if err := c.establishSecureConnection(ctx); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (c *client) createMintController(params *handshake.TransportParameters) (<-chan handshake.TransportParameters, error) {
+	csc := handshake.NewCryptoStreamConn(nil)
+	extHandler := handshake.NewExtensionHandlerClient(params, c.initialVersion, c.config.Versions, c.version, c.logger)
+	mintConf, err := tlsToMintConfig(c.tlsConf, protocol.PerspectiveClient)
+	if err != nil {
+		return nil, err
+	}
+	mintConf.ExtensionHandler = extHandler
+	mintConf.ServerName = c.hostname
+	if c.pskCache != nil {
+		mintConf.PSKs = c.pskCache
+	}
+	mintConf.ExternalEarlyData = c.early
+	c.tls = newMintController(csc, mintConf, protocol.PerspectiveClient)
+	return extHandler.GetPeerParams(), nil
+}
+
 // establishSecureConnection runs the session, and tries to establish a secure connection
 // It returns:
 // - errCloseSessionForNewVersion when the server sends a version negotiation packet
 // - handshake.ErrCloseSessionForRetry when the server performs a stateless retry (for IETF QUIC)
+// - the error of the context, when the context is done before the handshake completes
 // - any other error that might occur
 // - when the connection is secure (for gQUIC), or forward-secure (for IETF QUIC)
-func (c *client) establishSecureConnection() error {
+func (c *client) establishSecureConnection(ctx context.Context) error {
 	errorChan := make(chan error, 1)
 
 	go func() {
-		err := c.session.run() // returns as soon as the session is closed
+		err := c.runSession(c.session, true) // returns as soon as the session is closed
 		errorChan <- err
 	}()
 
 	select {
+	case <-ctx.Done():
+		// The session will send a PeerGoingAway error to the server.
+		c.session.Close(nil)
+		return ctx.Err()
 	case err := <-errorChan:
 		return err
 	case <-c.handshakeChan:
@@ -262,40 +434,119 @@ func (c *client) establishSecureConnection() error {
 	}
 }
 
-// Listen listens on the underlying connection and passes packets on for handling.
-// It returns when the connection is closed.
-func (c *client) listen() {
-	var err error
+// runSession runs the session.
+// When it is closed, the client stops receiving packets, unless the session is going to be recreated.
+func (c *client) runSession(sess packetHandler, mayRecreate bool) error {
+	err := sess.run()
+	if !mayRecreate || (err != errCloseSessionForNewVersion && err != handshake.ErrCloseSessionForRetry) {
+		if c.muxConn != nil {
+			c.muxConn.Close()
+		}
+		c.removePaths()
+	}
+	return err
+}
 
+// Listen listens on a connection and passes packets on for handling.
+// It returns when the connection is closed.
+func (c *client) listen(conn connection) {
+	packets := make([]rawPacket, readBatchSize)
 	for {
-		var n int
-		var addr net.Addr
-		data := *getPacketBuffer()
-		data = data[:protocol.MaxReceivePacketSize]
-		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
-		// If it does, we only read a truncated packet, which will then end up undecryptable
-		n, addr, err = c.conn.Read(data)
-		if err != nil {
-			if !strings.HasSuffix(err.Error(), "use of closed network connection") {
-				c.mutex.Lock()
-				if c.session != nil {
-					c.session.Close(err)
-				}
-				c.mutex.Unlock()
+		for i := range packets {
+			// The buffers of packets that were handled in the last iteration have to be replaced.
+			if packets[i].data == nil {
+				// The packet size should not exceed protocol.MaxReceivePacketSize bytes
+				// If it does, we only read a truncated packet, which will then end up undecryptable
+				packets[i].data = (*getPacketBuffer())[:protocol.MaxReceivePacketSize]
 			}
+		}
+		n, err := conn.ReadBatch(packets)
+		if err != nil {
+			c.handleReadError(conn, err)
 			break
 		}
-		if err := c.handlePacket(addr, data[:n]); err != nil {
-			c.logger.Errorf("error handling packet: %s", err.Error())
+		for i := 0; i < n; i++ {
+			p := &packets[i]
+			if err := c.handlePacket(conn, p.addr, p.ecn, p.data); err != nil {
+				c.logger.Errorf("error handling packet: %s", err.Error())
+			}
+			*p = rawPacket{}
 		}
 	}
 }
 
-func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) error {
+// handleReadError handles an error reading from conn.
+// An error on a path added for a connection migration doesn't close the session,
+// unless the session already migrated to that path.
+func (c *client) handleReadError(conn connection, err error) {
+	c.pathMutex.Lock()
+	removed, isPath := c.paths[conn]
+	delete(c.paths, conn)
+	if removed {
+		// reset the read deadline set by removePath, since the socket is owned by the application
+		conn.SetReadDeadline(time.Time{})
+	}
+	c.pathMutex.Unlock()
+	if removed || strings.HasSuffix(err.Error(), "use of closed network connection") {
+		return
+	}
+	c.mutex.Lock()
+	sess := c.session
+	c.mutex.Unlock()
+	if sess == nil {
+		return
+	}
+	if isPath {
+		sess.closePath(conn, err)
+	} else {
+		sess.Close(err)
+	}
+}
+
+// addPath starts reading from a path added by the session.
+func (c *client) addPath(conn connection) {
+	c.pathMutex.Lock()
+	if c.paths == nil {
+		c.paths = make(map[connection]bool)
+	}
+	c.paths[conn] = false
+	c.pathMutex.Unlock()
+	go c.listen(conn)
+}
+
+// removePath stops reading from a path added by the session.
+// The path is not closed, since the socket is owned by the application.
+func (c *client) removePath(conn connection) {
+	c.pathMutex.Lock()
+	defer c.pathMutex.Unlock()
+	if _, ok := c.paths[conn]; !ok {
+		// the go routine reading from the path already returned
+		return
+	}
+	c.paths[conn] = true
+	// unblock the go routine reading from the path
+	conn.SetReadDeadline(time.Now())
+}
+
+// removePaths stops reading from all paths added by the session.
+func (c *client) removePaths() {
+	c.pathMutex.Lock()
+	paths := make([]connection, 0, len(c.paths))
+	for conn := range c.paths {
+		paths = append(paths, conn)
+	}
+	c.pathMutex.Unlock()
+	for _, conn := range paths {
+		c.removePath(conn)
+	}
+}
+
+// handlePacket handles a packet that was received on conn.
+func (c *client) handlePacket(conn connection, remoteAddr net.Addr, ecn protocol.ECN, packet []byte) error {
 	rcvTime := time.Now()
 
 	r := bytes.NewReader(packet)
-	hdr, err := wire.ParseHeaderSentByServer(r)
+	hdr, err := wire.ParseHeaderSentByServer(r, c.srcConnID.Len())
 	// drop the packet if we can't parse the header
 	if err != nil {
 		return fmt.Errorf("error parsing packet from %s: %s", remoteAddr.String(), err.Error())
@@ -325,18 +576,29 @@ func (c *client) handlePacket(remoteAddr net.Addr, packet []byte) error {
 	}
 
 	if hdr.IsPublicHeader {
-		return c.handleGQUICPacket(hdr, r, packetData, remoteAddr, rcvTime)
+		return c.handleGQUICPacket(hdr, r, packetData, remoteAddr, ecn, rcvTime)
 	}
-	return c.handleIETFQUICPacket(hdr, packetData, remoteAddr, rcvTime)
+	return c.handleIETFQUICPacket(conn, hdr, packetData, remoteAddr, ecn, rcvTime)
 }
 
-func (c *client) handleIETFQUICPacket(hdr *wire.Header, packetData []byte, remoteAddr net.Addr, rcvTime time.Time) error {
+func (c *client) handleIETFQUICPacket(conn connection, hdr *wire.Header, packetData []byte, remoteAddr net.Addr, ecn protocol.ECN, rcvTime time.Time) error {
+	// A server that lost the state for this connection doesn't know our connection ID.
+	// Therefore, we have to check for stateless resets before checking the connection ID.
+	if !hdr.IsLongHeader && c.isStatelessReset(packetData) {
+		c.logger.Infof("Received a stateless reset.")
+		c.session.closeRemote(errStatelessReset)
+		return nil
+	}
 	// reject packets with the wrong connection ID
-	if !hdr.DestConnectionID.Equal(c.srcConnID) {
+	if !c.isOwnConnectionID(hdr.DestConnectionID) {
+		c.traceDroppedPacket(remoteAddr, hdr, packetData)
 		return fmt.Errorf("received a packet with an unexpected connection ID (%s, expected %s)", hdr.DestConnectionID, c.srcConnID)
 	}
+	if hdr.IsLongHeader && hdr.Type == protocol.PacketTypeRetry {
+		return c.handleRetryPacket(hdr)
+	}
 	if hdr.IsLongHeader {
-		if hdr.Type != protocol.PacketTypeRetry && hdr.Type != protocol.PacketTypeHandshake {
+		if hdr.Type != protocol.PacketTypeHandshake {
 			return fmt.Errorf("Received unsupported packet type: %s", hdr.Type)
 		}
 		c.logger.Debugf("len(packet data): %d, payloadLen: %d", len(packetData), hdr.PayloadLen)
@@ -357,14 +619,39 @@ func (c *client) handleIETFQUICPacket(hdr *wire.Header, packetData []byte, remot
 		remoteAddr: remoteAddr,
 		header:     hdr,
 		data:       packetData,
+		ecn:        ecn,
 		rcvTime:    rcvTime,
+		rcvPath:    conn,
 	})
 	return nil
 }
 
-func (c *client) handleGQUICPacket(hdr *wire.Header, r *bytes.Reader, packetData []byte, remoteAddr net.Addr, rcvTime time.Time) error {
+func (c *client) handleRetryPacket(hdr *wire.Header) error {
+	// A server sends at most one Retry, and only before it accepted the connection.
+	if c.receivedRetry || c.versionNegotiated {
+		return errors.New("received an unexpected Retry packet")
+	}
+	// The Retry must be sent from the connection ID that we chose for the server.
+	if !hdr.SrcConnectionID.Equal(c.destConnID) {
+		return fmt.Errorf("received a Retry packet with an unexpected source connection ID (%s, expected %s)", hdr.SrcConnectionID, c.destConnID)
+	}
+	if len(hdr.Token) == 0 {
+		return errors.New("received a Retry packet without a token")
+	}
+	c.logger.Debugf("Received a Retry packet containing a %d byte token.", len(hdr.Token))
+	c.receivedRetry = true
+	c.token = hdr.Token
+	if c.pskCache != nil {
+		c.pskCache.SetToken(hdr.Token)
+	}
+	c.session.Close(handshake.ErrCloseSessionForRetry)
+	return nil
+}
+
+func (c *client) handleGQUICPacket(hdr *wire.Header, r *bytes.Reader, packetData []byte, remoteAddr net.Addr, ecn protocol.ECN, rcvTime time.Time) error {
 	// reject packets with the wrong connection ID
 	if !hdr.OmitConnectionID && !hdr.DestConnectionID.Equal(c.srcConnID) {
+		c.traceDroppedPacket(remoteAddr, hdr, packetData)
 		return fmt.Errorf("received a packet with an unexpected connection ID (%s, expected %s)", hdr.DestConnectionID, c.srcConnID)
 	}
 
@@ -394,11 +681,63 @@ func (c *client) handleGQUICPacket(hdr *wire.Header, r *bytes.Reader, packetData
 		remoteAddr: remoteAddr,
 		header:     hdr,
 		data:       packetData,
+		ecn:        ecn,
 		rcvTime:    rcvTime,
 	})
 	return nil
 }
 
+// isOwnConnectionID says if a connection ID was issued by the session
+func (c *client) isOwnConnectionID(connID protocol.ConnectionID) bool {
+	if connID.Equal(c.srcConnID) {
+		return true
+	}
+	c.connIDMutex.RLock()
+	defer c.connIDMutex.RUnlock()
+	for _, id := range c.connIDs {
+		if id.Equal(connID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *client) addConnectionID(connID protocol.ConnectionID, _ packetHandler) {
+	c.connIDMutex.Lock()
+	c.connIDs = append(c.connIDs, connID)
+	c.connIDMutex.Unlock()
+	c.registerConnectionID(connID)
+}
+
+// registerConnectionID makes sure that packets for a connection ID are passed to this client.
+func (c *client) registerConnectionID(connID protocol.ConnectionID) {
+	if c.muxConn != nil {
+		c.muxConn.AddConnectionID(connID)
+	}
+}
+
+func (c *client) addResetToken(token [16]byte) {
+	c.connIDMutex.Lock()
+	c.resetTokens = append(c.resetTokens, token)
+	c.connIDMutex.Unlock()
+	if c.muxConn != nil {
+		c.muxConn.AddResetToken(token)
+	}
+}
+
+// isStatelessReset says if a packet is a stateless reset sent by the server
+func (c *client) isStatelessReset(packetData []byte) bool {
+	c.connIDMutex.RLock()
+	defer c.connIDMutex.RUnlock()
+	return isStatelessReset(packetData, c.resetTokens)
+}
+
+func (c *client) traceDroppedPacket(remoteAddr net.Addr, hdr *wire.Header, packetData []byte) {
+	if c.config.Tracer != nil {
+		c.config.Tracer.DroppedPacket(remoteAddr, PacketDropUnknownConnectionID, protocol.ByteCount(len(hdr.Raw)+len(packetData)))
+	}
+}
+
 func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
 	for _, v := range hdr.SupportedVersions {
 		if v == c.version {
@@ -422,14 +761,10 @@ func (c *client) handleVersionNegotiationPacket(hdr *wire.Header) error {
 	c.initialVersion = c.version
 	c.version = newVersion
 	var err error
-	c.destConnID, err = generateConnectionID()
+	c.srcConnID, c.destConnID, err = generateConnectionIDs(c.version, c.config.ConnectionIDGenerator)
 	if err != nil {
 		return err
 	}
-	// in gQUIC, there's only one connection ID
-	if !c.version.UsesTLS() {
-		c.srcConnID = c.destConnID
-	}
 	c.logger.Infof("Switching to QUIC version %s. New connection ID: %s", newVersion, c.destConnID)
 	c.session.Close(errCloseSessionForNewVersion)
 	return nil
@@ -441,7 +776,14 @@ func (c *client) createNewGQUICSession() (err error) {
 	runner := &runner{
 		onHandshakeCompleteImpl: func(_ packetHandler) { close(c.handshakeChan) },
 		removeConnectionIDImpl:  func(protocol.ConnectionID) {},
-	}
+		addConnectionIDImpl:     func(protocol.ConnectionID, packetHandler) {},
+		addPathImpl:             c.addPath,
+		removePathImpl:          c.removePath,
+		// stateless resets are not used in gQUIC
+		getStatelessResetTokenImpl: func(protocol.ConnectionID) [16]byte { return [16]byte{} },
+		addResetTokenImpl:          func([16]byte) {},
+	}
+	c.registerConnectionID(c.srcConnID)
 	c.session, err = newClientSession(
 		c.conn,
 		runner,
@@ -463,10 +805,20 @@ func (c *client) createNewTLSSession(
 ) (err error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	runner := &runner{
-		onHandshakeCompleteImpl: func(_ packetHandler) { close(c.handshakeChan) },
-		removeConnectionIDImpl:  func(protocol.ConnectionID) {},
+	resetter, err := newStatelessResetter(c.config.StatelessResetKey)
+	if err != nil {
+		return err
 	}
+	runner := &runner{
+		onHandshakeCompleteImpl:    func(_ packetHandler) { close(c.handshakeChan) },
+		removeConnectionIDImpl:     func(protocol.ConnectionID) {},
+		addConnectionIDImpl:        c.addConnectionID,
+		addPathImpl:                c.addPath,
+		removePathImpl:             c.removePath,
+		getStatelessResetTokenImpl: resetter.GetStatelessResetToken,
+		addResetTokenImpl:          c.addResetToken,
+	}
+	c.registerConnectionID(c.srcConnID)
 	c.session, err = newTLSClientSession(
 		c.conn,
 		runner,
@@ -474,6 +826,8 @@ func (c *client) createNewTLSSession(
 		c.version,
 		c.destConnID,
 		c.srcConnID,
+		c.token,
+		c.pskCache,
 		c.config,
 		c.tls,
 		paramsChan,
@@ -0,0 +1,90 @@
+package quic
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/wangjiezhe/quic-go/internal/utils"
+)
+
+// fileClientConfigCache stores every server config in a separate file.
+// Files are replaced atomically, so it can be used by multiple processes at the same time.
+type fileClientConfigCache struct {
+	dir    string
+	logger utils.Logger
+}
+
+var _ ClientConfigCache = &fileClientConfigCache{}
+
+// NewFileClientConfigCache returns a ClientConfigCache that stores the server configs in the given directory.
+// The directory is created if it doesn't exist yet.
+func NewFileClientConfigCache(dir string) (ClientConfigCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileClientConfigCache{
+		dir:    dir,
+		logger: utils.DefaultLogger.WithPrefix("client config cache"),
+	}, nil
+}
+
+// filename returns the name of the file used for a host.
+// The hostname is hashed, since it might contain characters that are not allowed in filenames.
+func (c *fileClientConfigCache) filename(hostname string) string {
+	h := sha256.Sum256([]byte(hostname))
+	return filepath.Join(c.dir, hex.EncodeToString(h[:]))
+}
+
+func (c *fileClientConfigCache) Get(hostname string) (*CachedServerConfig, bool) {
+	data, err := ioutil.ReadFile(c.filename(hostname))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.logger.Debugf("Reading server config for %s failed: %s", hostname, err)
+		}
+		return nil, false
+	}
+	config := &CachedServerConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		c.logger.Debugf("Decoding server config for %s failed: %s", hostname, err)
+		return nil, false
+	}
+	return config, true
+}
+
+func (c *fileClientConfigCache) Put(hostname string, config *CachedServerConfig) {
+	filename := c.filename(hostname)
+	if config == nil {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			c.logger.Debugf("Deleting server config for %s failed: %s", hostname, err)
+		}
+		return
+	}
+	if err := c.write(filename, config); err != nil {
+		c.logger.Debugf("Writing server config for %s failed: %s", hostname, err)
+	}
+}
+
+func (c *fileClientConfigCache) write(filename string, config *CachedServerConfig) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(c.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
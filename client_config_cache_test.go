@@ -0,0 +1,101 @@
+package quic
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("File Client Config Cache", func() {
+	var (
+		dir   string
+		cache ClientConfigCache
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "quic-go-config-cache")
+		Expect(err).ToNot(HaveOccurred())
+		cache, err = NewFileClientConfigCache(filepath.Join(dir, "cache"))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	getConfig := func() *CachedServerConfig {
+		return &CachedServerConfig{
+			ServerConfig:       []byte("scfg"),
+			SourceAddressToken: []byte("stk"),
+			CertChain:          []byte("cert"),
+			Proof:              []byte("proof"),
+			ProofCHLO:          []byte("chlo"),
+		}
+	}
+
+	It("creates the directory", func() {
+		fi, err := os.Stat(filepath.Join(dir, "cache"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fi.IsDir()).To(BeTrue())
+	})
+
+	It("stores and retrieves server configs", func() {
+		cache.Put("quic.clemente.io", getConfig())
+		config, ok := cache.Get("quic.clemente.io")
+		Expect(ok).To(BeTrue())
+		Expect(config).To(Equal(getConfig()))
+		_, ok = cache.Get("example.com")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("persists server configs", func() {
+		cache.Put("quic.clemente.io", getConfig())
+		cache2, err := NewFileClientConfigCache(filepath.Join(dir, "cache"))
+		Expect(err).ToNot(HaveOccurred())
+		config, ok := cache2.Get("quic.clemente.io")
+		Expect(ok).To(BeTrue())
+		Expect(config).To(Equal(getConfig()))
+	})
+
+	It("replaces server configs", func() {
+		cache.Put("quic.clemente.io", getConfig())
+		config := getConfig()
+		config.SourceAddressToken = []byte("new stk")
+		cache.Put("quic.clemente.io", config)
+		c, ok := cache.Get("quic.clemente.io")
+		Expect(ok).To(BeTrue())
+		Expect(c.SourceAddressToken).To(Equal([]byte("new stk")))
+		files, err := ioutil.ReadDir(filepath.Join(dir, "cache"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+	})
+
+	It("deletes server configs", func() {
+		cache.Put("quic.clemente.io", getConfig())
+		cache.Put("quic.clemente.io", nil)
+		_, ok := cache.Get("quic.clemente.io")
+		Expect(ok).To(BeFalse())
+		// deleting a non-existent server config is a no-op
+		cache.Put("quic.clemente.io", nil)
+	})
+
+	It("handles hostnames that are not valid filenames", func() {
+		cache.Put("[::1]:443/..", getConfig())
+		_, ok := cache.Get("[::1]:443/..")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("ignores corrupted files", func() {
+		cache.Put("quic.clemente.io", getConfig())
+		files, err := ioutil.ReadDir(filepath.Join(dir, "cache"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(1))
+		Expect(ioutil.WriteFile(filepath.Join(dir, "cache", files[0].Name()), []byte("foobar"), 0600)).To(Succeed())
+		_, ok := cache.Get("quic.clemente.io")
+		Expect(ok).To(BeFalse())
+	})
+})
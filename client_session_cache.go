@@ -0,0 +1,93 @@
+package quic
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/wangjiezhe/quic-go/internal/handshake"
+	"github.com/wangjiezhe/quic-go/internal/mint"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+)
+
+// ClientSessionState contains the state needed by a client to resume a session.
+// Its contents are not exported.
+type ClientSessionState struct {
+	version protocol.VersionNumber
+	psk     mint.PreSharedKey
+	// params are the transport parameters sent by the server.
+	// They apply to the 0-RTT data sent when resuming the session.
+	params handshake.TransportParameters
+	// token is the token received in a Retry packet, if any
+	token []byte
+}
+
+type lruSessionCacheEntry struct {
+	sessionKey string
+	state      *ClientSessionState
+}
+
+type lruSessionCache struct {
+	mutex sync.Mutex
+
+	m        map[string]*list.Element
+	q        *list.List
+	capacity int
+}
+
+var _ ClientSessionCache = &lruSessionCache{}
+
+// NewLRUClientSessionCache returns a ClientSessionCache with the given capacity that uses an LRU strategy.
+// If capacity is < 1, a default capacity is used instead.
+func NewLRUClientSessionCache(capacity int) ClientSessionCache {
+	const defaultCapacity = 64
+	if capacity < 1 {
+		capacity = defaultCapacity
+	}
+	return &lruSessionCache{
+		m:        make(map[string]*list.Element),
+		q:        list.New(),
+		capacity: capacity,
+	}
+}
+
+func (c *lruSessionCache) Put(sessionKey string, state *ClientSessionState) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.m[sessionKey]; ok {
+		if state == nil {
+			c.q.Remove(el)
+			delete(c.m, sessionKey)
+			return
+		}
+		el.Value.(*lruSessionCacheEntry).state = state
+		c.q.MoveToFront(el)
+		return
+	}
+	if state == nil {
+		return
+	}
+	if c.q.Len() < c.capacity {
+		c.m[sessionKey] = c.q.PushFront(&lruSessionCacheEntry{sessionKey: sessionKey, state: state})
+		return
+	}
+	// evict the least recently used entry, and reuse it for the new one
+	el := c.q.Back()
+	entry := el.Value.(*lruSessionCacheEntry)
+	delete(c.m, entry.sessionKey)
+	entry.sessionKey = sessionKey
+	entry.state = state
+	c.q.MoveToFront(el)
+	c.m[sessionKey] = el
+}
+
+func (c *lruSessionCache) Get(sessionKey string) (*ClientSessionState, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.m[sessionKey]; ok {
+		c.q.MoveToFront(el)
+		return el.Value.(*lruSessionCacheEntry).state, true
+	}
+	return nil, false
+}
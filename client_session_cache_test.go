@@ -0,0 +1,57 @@
+package quic
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LRU Client Session Cache", func() {
+	var cache ClientSessionCache
+
+	BeforeEach(func() {
+		cache = NewLRUClientSessionCache(2)
+	})
+
+	It("stores and retrieves states", func() {
+		state := &ClientSessionState{token: []byte("foobar")}
+		cache.Put("foo", state)
+		s, ok := cache.Get("foo")
+		Expect(ok).To(BeTrue())
+		Expect(s).To(Equal(state))
+		_, ok = cache.Get("bar")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("replaces states", func() {
+		cache.Put("foo", &ClientSessionState{token: []byte("foo")})
+		cache.Put("foo", &ClientSessionState{token: []byte("bar")})
+		s, ok := cache.Get("foo")
+		Expect(ok).To(BeTrue())
+		Expect(s.token).To(Equal([]byte("bar")))
+	})
+
+	It("deletes states", func() {
+		cache.Put("foo", &ClientSessionState{})
+		cache.Put("foo", nil)
+		_, ok := cache.Get("foo")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("evicts the least recently used state", func() {
+		cache.Put("foo", &ClientSessionState{})
+		cache.Put("bar", &ClientSessionState{})
+		_, ok := cache.Get("foo") // foo is now the most recently used
+		Expect(ok).To(BeTrue())
+		cache.Put("baz", &ClientSessionState{})
+		_, ok = cache.Get("bar")
+		Expect(ok).To(BeFalse())
+		_, ok = cache.Get("foo")
+		Expect(ok).To(BeTrue())
+		_, ok = cache.Get("baz")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("uses a default capacity", func() {
+		Expect(NewLRUClientSessionCache(0).(*lruSessionCache).capacity).To(BeNumerically(">", 0))
+	})
+})
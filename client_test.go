@@ -2,11 +2,13 @@ package quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"os"
+	"reflect"
 	"time"
 
 	"github.com/golang/mock/gomock"
@@ -57,7 +59,8 @@ var _ = Describe("Client", func() {
 			srcConnID:  connID,
 			destConnID: connID,
 			version:    protocol.SupportedVersions[0],
-			conn:       &conn{pconn: packetConn, currentAddr: addr},
+			conn:       &conn{pconn: wrapConn(packetConn), currentAddr: addr},
+			config:     &Config{},
 			logger:     utils.DefaultLogger,
 		}
 	})
@@ -74,11 +77,11 @@ var _ = Describe("Client", func() {
 	})
 
 	Context("Dialing", func() {
-		var origGenerateConnectionID func() (protocol.ConnectionID, error)
+		var origGenerateConnectionID func(int) (protocol.ConnectionID, error)
 
 		BeforeEach(func() {
 			origGenerateConnectionID = generateConnectionID
-			generateConnectionID = func() (protocol.ConnectionID, error) {
+			generateConnectionID = func(int) (protocol.ConnectionID, error) {
 				return connID, nil
 			}
 		})
@@ -160,8 +163,13 @@ var _ = Describe("Client", func() {
 				_ utils.Logger,
 			) (packetHandler, error) {
 				sess := NewMockPacketHandler(mockCtrl)
-				sess.EXPECT().run().Do(func() { close(run) })
-				sess.EXPECT().handlePacket(gomock.Any())
+				handledPacket := make(chan struct{})
+				// the client stops receiving packets when run returns
+				sess.EXPECT().run().Do(func() {
+					<-handledPacket
+					close(run)
+				})
+				sess.EXPECT().handlePacket(gomock.Any()).Do(func(*receivedPacket) { close(handledPacket) })
 				runner.onHandshakeComplete(sess)
 				return sess, nil
 			}
@@ -189,7 +197,8 @@ var _ = Describe("Client", func() {
 			) (packetHandler, error) {
 				sess := NewMockPacketHandler(mockCtrl)
 				sess.EXPECT().handlePacket(gomock.Any()).Do(func(_ *receivedPacket) { close(handledPacket) })
-				sess.EXPECT().run().Return(testErr)
+				// the client stops receiving packets when run returns
+				sess.EXPECT().run().Do(func() { <-handledPacket }).Return(testErr)
 				return sess, nil
 			}
 			packetConn.dataToRead <- acceptClientVersionPacket(cl.srcConnID)
@@ -198,6 +207,69 @@ var _ = Describe("Client", func() {
 			Eventually(handledPacket).Should(BeClosed())
 		})
 
+		It("closes the session when the context is canceled", func() {
+			sessionRunning := make(chan struct{})
+			defer close(sessionRunning)
+			sess := NewMockPacketHandler(mockCtrl)
+			sess.EXPECT().run().Do(func() {
+				<-sessionRunning
+			})
+			newClientSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ string,
+				_ protocol.VersionNumber,
+				_ protocol.ConnectionID,
+				_ *tls.Config,
+				_ *Config,
+				_ protocol.VersionNumber,
+				_ []protocol.VersionNumber,
+				_ utils.Logger,
+			) (packetHandler, error) {
+				return sess, nil
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			dialed := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				_, err := DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", nil, nil)
+				Expect(err).To(MatchError(context.Canceled))
+				close(dialed)
+			}()
+			Consistently(dialed).ShouldNot(BeClosed())
+			sess.EXPECT().Close(nil)
+			cancel()
+			Eventually(dialed).Should(BeClosed())
+		})
+
+		It("returns immediately if the context is already done", func() {
+			sessionRunning := make(chan struct{})
+			defer close(sessionRunning)
+			sess := NewMockPacketHandler(mockCtrl)
+			sess.EXPECT().run().Do(func() {
+				<-sessionRunning
+			}).AnyTimes() // the context might be checked before the session is run
+			sess.EXPECT().Close(nil)
+			newClientSession = func(
+				_ connection,
+				_ sessionRunner,
+				_ string,
+				_ protocol.VersionNumber,
+				_ protocol.ConnectionID,
+				_ *tls.Config,
+				_ *Config,
+				_ protocol.VersionNumber,
+				_ []protocol.VersionNumber,
+				_ utils.Logger,
+			) (packetHandler, error) {
+				return sess, nil
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 0)
+			defer cancel()
+			_, err := DialContext(ctx, packetConn, addr, "quic.clemente.io:1337", nil, nil)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
 		Context("quic.Config", func() {
 			It("setups with the right values", func() {
 				config := &Config{
@@ -206,6 +278,12 @@ var _ = Describe("Client", func() {
 					RequestConnectionIDOmission: true,
 					MaxIncomingStreams:          1234,
 					MaxIncomingUniStreams:       4321,
+					ConnectionIDLength:          13,
+					StatelessResetKey:           []byte("foobar"),
+					ClientSessionCache:          NewLRUClientSessionCache(1),
+					ClientConfigCache:           &fileClientConfigCache{dir: "foobar"},
+					CongestionControl:           NewRenoCongestionControl,
+					DisablePathMTUDiscovery:     true,
 				}
 				c := populateClientConfig(config)
 				Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
@@ -213,6 +291,31 @@ var _ = Describe("Client", func() {
 				Expect(c.RequestConnectionIDOmission).To(BeTrue())
 				Expect(c.MaxIncomingStreams).To(Equal(1234))
 				Expect(c.MaxIncomingUniStreams).To(Equal(4321))
+				Expect(c.ConnectionIDLength).To(Equal(13))
+				Expect(c.StatelessResetKey).To(Equal([]byte("foobar")))
+				Expect(c.ClientSessionCache).To(Equal(config.ClientSessionCache))
+				Expect(c.ClientConfigCache).To(Equal(config.ClientConfigCache))
+				Expect(reflect.ValueOf(c.CongestionControl)).To(Equal(reflect.ValueOf(NewRenoCongestionControl)))
+				Expect(c.DisablePathMTUDiscovery).To(BeTrue())
+			})
+
+			It("uses the ConnectionIDGenerator", func() {
+				g := &fixedConnIDGenerator{length: 5}
+				c := populateClientConfig(&Config{ConnectionIDGenerator: g, ConnectionIDLength: 10})
+				Expect(c.ConnectionIDGenerator).To(Equal(g))
+				Expect(c.ConnectionIDLength).To(Equal(5))
+			})
+
+			It("uses zero-length connection IDs", func() {
+				c := populateClientConfig(&Config{ConnectionIDLength: -1})
+				Expect(c.ConnectionIDLength).To(BeZero())
+			})
+
+			It("errors when the Config contains an invalid connection ID length", func() {
+				_, err := Dial(nil, nil, "localhost:1234", &tls.Config{}, &Config{ConnectionIDLength: 3})
+				Expect(err).To(MatchError("invalid connection ID length: 3 bytes"))
+				_, err = Dial(nil, nil, "localhost:1234", &tls.Config{}, &Config{ConnectionIDLength: 19})
+				Expect(err).To(MatchError("invalid connection ID length: 19 bytes"))
 			})
 
 			It("errors when the Config contains an invalid version", func() {
@@ -247,6 +350,43 @@ var _ = Describe("Client", func() {
 				Expect(c.HandshakeTimeout).To(Equal(protocol.DefaultHandshakeTimeout))
 				Expect(c.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
 				Expect(c.RequestConnectionIDOmission).To(BeFalse())
+				Expect(c.ConnectionIDLength).To(Equal(protocol.DefaultConnectionIDLength))
+			})
+		})
+
+		Context("generating connection IDs", func() {
+			BeforeEach(func() {
+				generateConnectionID = origGenerateConnectionID
+			})
+
+			It("uses the configured length for the source connection ID, for IETF QUIC", func() {
+				src, dest, err := generateConnectionIDs(versionIETFFrames, &randomConnIDGenerator{length: 5})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(src.Len()).To(Equal(5))
+				Expect(dest.Len()).To(Equal(protocol.MinConnectionIDLenInitial))
+			})
+
+			It("uses zero-length source connection IDs, for IETF QUIC", func() {
+				src, dest, err := generateConnectionIDs(versionIETFFrames, &randomConnIDGenerator{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(src.Len()).To(BeZero())
+				Expect(dest.Len()).To(Equal(protocol.MinConnectionIDLenInitial))
+			})
+
+			It("uses the ConnectionIDGenerator for the source connection ID, for IETF QUIC", func() {
+				g := &fixedConnIDGenerator{connID: protocol.ConnectionID{1, 2, 3, 4, 5}, length: 5}
+				src, dest, err := generateConnectionIDs(versionIETFFrames, g)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(src).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5}))
+				Expect(dest).ToNot(Equal(src))
+				Expect(dest.Len()).To(Equal(protocol.MinConnectionIDLenInitial))
+			})
+
+			It("uses a single 8 byte connection ID, for gQUIC", func() {
+				src, dest, err := generateConnectionIDs(versionGQUICFrames, &randomConnIDGenerator{length: 5})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(src.Len()).To(Equal(protocol.ConnectionIDLenGQUIC))
+				Expect(dest).To(Equal(src))
 			})
 		})
 
@@ -287,6 +427,8 @@ var _ = Describe("Client", func() {
 					versionP protocol.VersionNumber,
 					_ protocol.ConnectionID,
 					_ protocol.ConnectionID,
+					_ []byte,
+					_ *clientPSKCache,
 					configP *Config,
 					tls handshake.MintTLS,
 					paramsChan <-chan handshake.TransportParameters,
@@ -306,11 +448,62 @@ var _ = Describe("Client", func() {
 				_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, config)
 				Expect(err).ToNot(HaveOccurred())
 				Eventually(c).Should(BeClosed())
-				Expect(cconn.(*conn).pconn).To(Equal(packetConn))
+				Expect(cconn.(*conn).pconn.(*muxConn).rawConn).To(Equal(&basicConn{PacketConn: packetConn}))
 				Expect(hostname).To(Equal("quic.clemente.io"))
 				Expect(version).To(Equal(config.Versions[0]))
 				Expect(conf.Versions).To(Equal(config.Versions))
 			})
+
+			It("stops reading from a path without closing it", func() {
+				cl.session = NewMockPacketHandler(mockCtrl)
+				newPacketConn := newMockPacketConn()
+				path := &conn{pconn: wrapConn(newPacketConn), currentAddr: addr}
+				cl.addPath(path)
+				cl.removePath(path)
+				Eventually(func() int {
+					cl.pathMutex.Lock()
+					defer cl.pathMutex.Unlock()
+					return len(cl.paths)
+				}).Should(BeZero())
+				Expect(newPacketConn.closed).To(BeFalse())
+				// the read deadline was reset
+				Expect(newPacketConn.deadlinePassed).To(BeEmpty())
+			})
+
+			It("only fails the path validation if reading from a new path fails", func() {
+				config := &Config{Versions: []protocol.VersionNumber{protocol.VersionTLS}}
+				var runner sessionRunner
+				sess := NewMockPacketHandler(mockCtrl)
+				newTLSClientSession = func(
+					_ connection,
+					runnerP sessionRunner,
+					_ string,
+					_ protocol.VersionNumber,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ []byte,
+					_ *clientPSKCache,
+					_ *Config,
+					_ handshake.MintTLS,
+					_ <-chan handshake.TransportParameters,
+					_ protocol.PacketNumber,
+					_ utils.Logger,
+				) (packetHandler, error) {
+					runner = runnerP
+					sess.EXPECT().run()
+					return sess, nil
+				}
+				_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, config)
+				Expect(err).ToNot(HaveOccurred())
+				testErr := errors.New("test error")
+				newPacketConn := newMockPacketConn()
+				newPacketConn.readErr = testErr
+				path := &conn{pconn: wrapConn(newPacketConn), currentAddr: addr}
+				closed := make(chan struct{})
+				sess.EXPECT().closePath(path, testErr).Do(func(connection, error) { close(closed) })
+				runner.addPath(path)
+				Eventually(closed).Should(BeClosed())
+			})
 		})
 
 		Context("version negotiation", func() {
@@ -339,7 +532,7 @@ var _ = Describe("Client", func() {
 					_ []protocol.VersionNumber,
 					_ utils.Logger,
 				) (packetHandler, error) {
-					Expect(conn.Write([]byte("0 fake CHLO"))).To(Succeed())
+					Expect(conn.Write([]byte("0 fake CHLO"), protocol.ECNNon)).To(Succeed())
 					sess := NewMockPacketHandler(mockCtrl)
 					sess.EXPECT().run().Return(testErr)
 					return sess, nil
@@ -361,7 +554,7 @@ var _ = Describe("Client", func() {
 				b := &bytes.Buffer{}
 				err := ph.Write(b, protocol.PerspectiveServer, protocol.VersionWhatever)
 				Expect(err).ToNot(HaveOccurred())
-				err = cl.handlePacket(nil, b.Bytes())
+				err = cl.handlePacket(nil, nil, protocol.ECNNon, b.Bytes())
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.versionNegotiated).To(BeTrue())
 			})
@@ -398,12 +591,12 @@ var _ = Describe("Client", func() {
 				dialed := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					err := cl.dial()
+					err := cl.dial(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					close(dialed)
 				}()
 				Eventually(sessionChan).Should(HaveLen(1))
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version2}))
+				err := cl.handlePacket(nil, nil, protocol.ECNNon, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version2}))
 				Expect(err).ToNot(HaveOccurred())
 				Eventually(sessionChan).Should(BeEmpty())
 			})
@@ -442,15 +635,15 @@ var _ = Describe("Client", func() {
 				dialed := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
-					err := cl.dial()
+					err := cl.dial(context.Background())
 					Expect(err).ToNot(HaveOccurred())
 					close(dialed)
 				}()
 				Eventually(sessionChan).Should(HaveLen(1))
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version2}))
+				err := cl.handlePacket(nil, nil, protocol.ECNNon, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version2}))
 				Expect(err).ToNot(HaveOccurred())
 				Eventually(sessionChan).Should(BeEmpty())
-				err = cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version3}))
+				err = cl.handlePacket(nil, nil, protocol.ECNNon, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{version3}))
 				Expect(err).To(MatchError("received a delayed Version Negotiation Packet"))
 				Eventually(dialed).Should(BeClosed())
 			})
@@ -460,7 +653,7 @@ var _ = Describe("Client", func() {
 				sess.EXPECT().Close(gomock.Any())
 				cl.session = sess
 				cl.config = &Config{Versions: protocol.SupportedVersions}
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{1}))
+				err := cl.handlePacket(nil, nil, protocol.ECNNon, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{1}))
 				Expect(err).ToNot(HaveOccurred())
 			})
 
@@ -471,7 +664,7 @@ var _ = Describe("Client", func() {
 				v := protocol.VersionNumber(1234)
 				Expect(v).ToNot(Equal(cl.version))
 				cl.config = &Config{Versions: protocol.SupportedVersions}
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{v}))
+				err := cl.handlePacket(nil, nil, protocol.ECNNon, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{v}))
 				Expect(err).ToNot(HaveOccurred())
 			})
 
@@ -481,14 +674,14 @@ var _ = Describe("Client", func() {
 				cl.session = sess
 				config := &Config{Versions: []protocol.VersionNumber{1234, 4321}}
 				cl.config = config
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{4321, 1234}))
+				err := cl.handlePacket(nil, nil, protocol.ECNNon, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{4321, 1234}))
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.version).To(Equal(protocol.VersionNumber(1234)))
 			})
 
 			It("drops version negotiation packets that contain the offered version", func() {
 				ver := cl.version
-				err := cl.handlePacket(nil, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{ver}))
+				err := cl.handlePacket(nil, nil, protocol.ECNNon, wire.ComposeGQUICVersionNegotiation(connID, []protocol.VersionNumber{ver}))
 				Expect(err).ToNot(HaveOccurred())
 				Expect(cl.version).To(Equal(ver))
 			})
@@ -497,7 +690,7 @@ var _ = Describe("Client", func() {
 
 	It("ignores packets with an invalid public header", func() {
 		cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any handlePacket calls
-		err := cl.handlePacket(addr, []byte("invalid packet"))
+		err := cl.handlePacket(nil, addr, protocol.ECNNon, []byte("invalid packet"))
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("error parsing packet from"))
 	})
@@ -514,7 +707,7 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}
 		Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-		cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...))
+		cl.handlePacket(nil, addr, protocol.ECNNon, append(b.Bytes(), make([]byte, 456)...))
 	})
 
 	It("cuts packets at the payload length", func() {
@@ -533,7 +726,7 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}
 		Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-		err := cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...))
+		err := cl.handlePacket(nil, addr, protocol.ECNNon, append(b.Bytes(), make([]byte, 456)...))
 		Expect(err).ToNot(HaveOccurred())
 	})
 
@@ -548,7 +741,7 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}
 		Expect(hdr.Write(b, protocol.PerspectiveServer, versionIETFFrames)).To(Succeed())
-		err := cl.handlePacket(addr, append(b.Bytes(), make([]byte, 456)...))
+		err := cl.handlePacket(nil, addr, protocol.ECNNon, append(b.Bytes(), make([]byte, 456)...))
 		Expect(err).To(MatchError("Received unsupported packet type: Initial"))
 	})
 
@@ -564,7 +757,7 @@ var _ = Describe("Client", func() {
 			PacketNumberLen:  1,
 		}).Write(buf, protocol.PerspectiveServer, versionGQUICFrames)
 		Expect(err).ToNot(HaveOccurred())
-		err = cl.handlePacket(addr, buf.Bytes())
+		err = cl.handlePacket(nil, addr, protocol.ECNNon, buf.Bytes())
 		Expect(err).To(MatchError("received packet with truncated connection ID, but didn't request truncation"))
 	})
 
@@ -583,10 +776,93 @@ var _ = Describe("Client", func() {
 			Version:          versionIETFFrames,
 		}).Write(buf, protocol.PerspectiveServer, versionIETFFrames)
 		Expect(err).ToNot(HaveOccurred())
-		err = cl.handlePacket(addr, buf.Bytes())
+		err = cl.handlePacket(nil, addr, protocol.ECNNon, buf.Bytes())
 		Expect(err).To(MatchError(fmt.Sprintf("received a packet with an unexpected connection ID (0x0807060504030201, expected %s)", connID)))
 	})
 
+	It("accepts packets for connection IDs issued by the session", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		cl.session = sess
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		connID2 := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
+		cl.addConnectionID(connID2, sess)
+		buf := &bytes.Buffer{}
+		err := (&wire.Header{
+			DestConnectionID: connID2,
+			PacketNumber:     1,
+			PacketNumberLen:  1,
+		}).Write(buf, protocol.PerspectiveServer, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		sess.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+			Expect(p.header.DestConnectionID).To(Equal(connID2))
+		})
+		Expect(cl.handlePacket(nil, addr, protocol.ECNNon, buf.Bytes())).To(Succeed())
+	})
+
+	It("passes the path that an IETF QUIC packet was received on to the session", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		cl.session = sess
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		buf := &bytes.Buffer{}
+		err := (&wire.Header{
+			DestConnectionID: connID,
+			PacketNumber:     1,
+			PacketNumberLen:  1,
+		}).Write(buf, protocol.PerspectiveServer, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		path := newMockConnection()
+		sess.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+			Expect(p.rcvPath).To(Equal(path))
+		})
+		Expect(cl.handlePacket(path, addr, protocol.ECNNon, buf.Bytes())).To(Succeed())
+	})
+
+	It("closes the session when receiving a stateless reset", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		cl.session = sess
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		token := [16]byte{0xde, 0xad, 0xbe, 0xef}
+		cl.addResetToken(token)
+		data, err := composeStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		sess.EXPECT().closeRemote(errStatelessReset)
+		Expect(cl.handlePacket(nil, addr, protocol.ECNNon, data)).To(Succeed())
+	})
+
+	It("doesn't close the session for packets with an unknown stateless reset token", func() {
+		cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any calls
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		cl.addResetToken([16]byte{0xde, 0xad, 0xbe, 0xef})
+		data, err := composeStatelessReset([16]byte{0xde, 0xca, 0xfb, 0xad})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cl.handlePacket(nil, addr, protocol.ECNNon, data)).ToNot(Succeed())
+	})
+
+	It("handles packets with a zero-length connection ID", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		cl.session = sess
+		cl.version = versionIETFFrames
+		cl.config = &Config{}
+		cl.srcConnID = protocol.ConnectionID{}
+		buf := &bytes.Buffer{}
+		err := (&wire.Header{
+			PacketNumber:    0x42,
+			PacketNumberLen: protocol.PacketNumberLen2,
+		}).Write(buf, protocol.PerspectiveServer, versionIETFFrames)
+		Expect(err).ToNot(HaveOccurred())
+		buf.Write([]byte("foobar"))
+		sess.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+			Expect(p.header.DestConnectionID).To(BeEmpty())
+			Expect(p.header.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
+			Expect(p.data).To(Equal([]byte("foobar")))
+		})
+		Expect(cl.handlePacket(nil, addr, protocol.ECNNon, buf.Bytes())).To(Succeed())
+	})
+
 	It("creates new gQUIC sessions with the right parameters", func() {
 		config := &Config{Versions: protocol.SupportedVersions}
 		c := make(chan struct{})
@@ -618,7 +894,7 @@ var _ = Describe("Client", func() {
 		_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, config)
 		Expect(err).ToNot(HaveOccurred())
 		Eventually(c).Should(BeClosed())
-		Expect(cconn.(*conn).pconn).To(Equal(packetConn))
+		Expect(cconn.(*conn).pconn.(*muxConn).rawConn).To(Equal(&basicConn{PacketConn: packetConn}))
 		Expect(hostname).To(Equal("quic.clemente.io"))
 		Expect(version).To(Equal(config.Versions[0]))
 		Expect(conf.Versions).To(Equal(config.Versions))
@@ -626,25 +902,46 @@ var _ = Describe("Client", func() {
 
 	It("creates a new session when the server performs a retry", func() {
 		config := &Config{Versions: []protocol.VersionNumber{protocol.VersionTLS}}
-		cl.config = config
+		closed := make(chan struct{})
 		sess1 := NewMockPacketHandler(mockCtrl)
-		sess1.EXPECT().run().Return(handshake.ErrCloseSessionForRetry)
+		sess1.EXPECT().run().Do(func() { <-closed }).Return(handshake.ErrCloseSessionForRetry)
+		sess1.EXPECT().Close(handshake.ErrCloseSessionForRetry).Do(func(error) { close(closed) })
 		sess2 := NewMockPacketHandler(mockCtrl)
 		sess2.EXPECT().run()
 		sessions := []*MockPacketHandler{sess1, sess2}
+		var tokens [][]byte
+		var mintControllers []handshake.MintTLS
 		newTLSClientSession = func(
 			connP connection,
 			_ sessionRunner,
 			hostnameP string,
 			versionP protocol.VersionNumber,
-			_ protocol.ConnectionID,
-			_ protocol.ConnectionID,
+			destConnID protocol.ConnectionID,
+			srcConnID protocol.ConnectionID,
+			token []byte,
+			_ *clientPSKCache,
 			configP *Config,
 			tls handshake.MintTLS,
 			paramsChan <-chan handshake.TransportParameters,
 			_ protocol.PacketNumber,
 			_ utils.Logger,
 		) (packetHandler, error) {
+			tokens = append(tokens, token)
+			mintControllers = append(mintControllers, tls)
+			if len(tokens) == 1 {
+				// the server answers the first Initial with a Retry
+				b := &bytes.Buffer{}
+				Expect((&wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeRetry,
+					DestConnectionID: srcConnID,
+					SrcConnectionID:  destConnID,
+					Token:            []byte("foobar"),
+					PacketNumberLen:  protocol.PacketNumberLen4,
+					Version:          protocol.VersionTLS,
+				}).Write(b, protocol.PerspectiveServer, protocol.VersionTLS)).To(Succeed())
+				packetConn.dataToRead <- b.Bytes()
+			}
 			sess := sessions[0]
 			sessions = sessions[1:]
 			return sess, nil
@@ -652,6 +949,64 @@ var _ = Describe("Client", func() {
 		_, err := Dial(packetConn, addr, "quic.clemente.io:1337", nil, config)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(sessions).To(BeEmpty())
+		Expect(tokens).To(Equal([][]byte{nil, []byte("foobar")}))
+		// the handshake is restarted with a new ClientHello
+		Expect(mintControllers[1]).ToNot(BeIdenticalTo(mintControllers[0]))
+	})
+
+	Context("handling Retry packets", func() {
+		composeRetry := func(srcConnID protocol.ConnectionID, token []byte) []byte {
+			b := &bytes.Buffer{}
+			Expect((&wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeRetry,
+				DestConnectionID: connID,
+				SrcConnectionID:  srcConnID,
+				Token:            token,
+				PacketNumberLen:  protocol.PacketNumberLen4,
+				Version:          versionIETFFrames,
+			}).Write(b, protocol.PerspectiveServer, versionIETFFrames)).To(Succeed())
+			return b.Bytes()
+		}
+
+		BeforeEach(func() {
+			cl.version = versionIETFFrames
+		})
+
+		It("closes the session and saves the token", func() {
+			sess := NewMockPacketHandler(mockCtrl)
+			cl.session = sess
+			sess.EXPECT().Close(handshake.ErrCloseSessionForRetry)
+			Expect(cl.handlePacket(nil, addr, protocol.ECNNon, composeRetry(connID, []byte("foobar")))).To(Succeed())
+			Expect(cl.token).To(Equal([]byte("foobar")))
+		})
+
+		It("only accepts one Retry", func() {
+			sess := NewMockPacketHandler(mockCtrl)
+			cl.session = sess
+			sess.EXPECT().Close(handshake.ErrCloseSessionForRetry)
+			Expect(cl.handlePacket(nil, addr, protocol.ECNNon, composeRetry(connID, []byte("foo")))).To(Succeed())
+			Expect(cl.handlePacket(nil, addr, protocol.ECNNon, composeRetry(connID, []byte("bar")))).To(MatchError("received an unexpected Retry packet"))
+			Expect(cl.token).To(Equal([]byte("foo")))
+		})
+
+		It("ignores Retries after the server accepted the connection", func() {
+			cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any calls
+			cl.versionNegotiated = true
+			Expect(cl.handlePacket(nil, addr, protocol.ECNNon, composeRetry(connID, []byte("foobar")))).To(MatchError("received an unexpected Retry packet"))
+		})
+
+		It("ignores Retries with the wrong source connection ID", func() {
+			cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any calls
+			err := cl.handlePacket(nil, addr, protocol.ECNNon, composeRetry(protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}, []byte("foobar")))
+			Expect(err).To(MatchError(fmt.Sprintf("received a Retry packet with an unexpected source connection ID (0x0807060504030201, expected %s)", connID)))
+			Expect(cl.token).To(BeNil())
+		})
+
+		It("ignores Retries without a token", func() {
+			cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any calls
+			Expect(cl.handlePacket(nil, addr, protocol.ECNNon, composeRetry(connID, nil))).To(MatchError("received a Retry packet without a token"))
+		})
 	})
 
 	Context("handling packets", func() {
@@ -673,7 +1028,7 @@ var _ = Describe("Client", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				cl.listen()
+				cl.listen(cl.conn)
 				// it should continue listening when receiving valid packets
 				close(done)
 			}()
@@ -685,13 +1040,31 @@ var _ = Describe("Client", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("traces packets with an unknown connection ID", func() {
+			tracer := NewMockTracer(mockCtrl)
+			cl.config = &Config{Tracer: tracer}
+			cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any handlePacket calls
+			ph := wire.Header{
+				PacketNumber:     1,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+				DestConnectionID: protocol.ConnectionID{1, 3, 3, 7, 1, 3, 3, 7},
+				SrcConnectionID:  protocol.ConnectionID{1, 3, 3, 7, 1, 3, 3, 7},
+			}
+			b := &bytes.Buffer{}
+			Expect(ph.Write(b, protocol.PerspectiveServer, cl.version)).To(Succeed())
+			b.Write([]byte("foobar"))
+			tracer.EXPECT().DroppedPacket(addr, PacketDropUnknownConnectionID, protocol.ByteCount(b.Len()))
+			err := cl.handlePacket(nil, addr, protocol.ECNNon, b.Bytes())
+			Expect(err).To(MatchError(ContainSubstring("received a packet with an unexpected connection ID")))
+		})
+
 		It("closes the session when encountering an error while reading from the connection", func() {
 			testErr := errors.New("test error")
 			sess := NewMockPacketHandler(mockCtrl)
 			sess.EXPECT().Close(testErr)
 			cl.session = sess
 			packetConn.readErr = testErr
-			cl.listen()
+			cl.listen(cl.conn)
 		})
 	})
 
@@ -702,21 +1075,21 @@ var _ = Describe("Client", func() {
 				Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.PublicReset))
 			})
 			cl.session = sess
-			err := cl.handlePacket(addr, wire.WritePublicReset(cl.destConnID, 1, 0))
+			err := cl.handlePacket(nil, addr, protocol.ECNNon, wire.WritePublicReset(cl.destConnID, 1, 0))
 			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("ignores Public Resets from the wrong remote address", func() {
 			cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any calls
 			spoofedAddr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 5678}
-			err := cl.handlePacket(spoofedAddr, wire.WritePublicReset(cl.destConnID, 1, 0))
+			err := cl.handlePacket(nil, spoofedAddr, protocol.ECNNon, wire.WritePublicReset(cl.destConnID, 1, 0))
 			Expect(err).To(MatchError("Received a spoofed Public Reset"))
 		})
 
 		It("ignores unparseable Public Resets", func() {
 			cl.session = NewMockPacketHandler(mockCtrl) // don't EXPECT any calls
 			pr := wire.WritePublicReset(cl.destConnID, 1, 0)
-			err := cl.handlePacket(addr, pr[:len(pr)-5])
+			err := cl.handlePacket(nil, addr, protocol.ECNNon, pr[:len(pr)-5])
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("Received a Public Reset. An error occurred parsing the packet"))
 		})
@@ -0,0 +1,81 @@
+package quic
+
+import (
+	"github.com/wangjiezhe/quic-go/internal/congestion"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+)
+
+// NewCubicCongestionControl creates a congestion controller that uses Cubic.
+// This is the default congestion controller.
+func NewCubicCongestionControl(rttStats RTTStats) CongestionController {
+	return newCubicSender(rttStats, false)
+}
+
+// NewRenoCongestionControl creates a congestion controller that uses (New)Reno.
+func NewRenoCongestionControl(rttStats RTTStats) CongestionController {
+	return newCubicSender(rttStats, true)
+}
+
+// NewBBRCongestionControl creates a congestion controller that uses BBR.
+// BBR doesn't interpret packet loss as a signal of congestion. Instead, it estimates the bandwidth
+// and the RTT of the path, and paces packets at the estimated bandwidth.
+func NewBBRCongestionControl(rttStats RTTStats) CongestionController {
+	return congestion.NewBBRSender(rttStats, protocol.InitialCongestionWindow, protocol.DefaultMaxCongestionWindow)
+}
+
+// NewLEDBATCongestionControl creates a scavenger congestion controller that uses LEDBAT.
+// It backs off as soon as the RTT rises above the minimum RTT of the last 10 minutes, i.e. when other flows cause a queue to build up.
+// It should be used for background transfers that should yield to interactive traffic.
+func NewLEDBATCongestionControl(rttStats RTTStats) CongestionController {
+	return congestion.NewLEDBATSender(congestion.DefaultClock{}, rttStats, protocol.InitialCongestionWindow, protocol.DefaultMaxCongestionWindow)
+}
+
+func newCubicSender(rttStats RTTStats, reno bool) CongestionController {
+	return congestion.NewCubicSender(
+		congestion.DefaultClock{},
+		rttStats,
+		reno,
+		protocol.InitialCongestionWindow,
+		protocol.DefaultMaxCongestionWindow,
+	)
+}
+
+// newSendAlgorithm creates the congestion controller used by the sent packet handler.
+// The congestion controllers implemented by quic-go are used directly,
+// all other controllers are wrapped by a congestionControllerAdapter.
+func newSendAlgorithm(newController func(RTTStats) CongestionController, rttStats *congestion.RTTStats) congestion.SendAlgorithm {
+	c := newController(rttStats)
+	if sendAlgorithm, ok := c.(congestion.SendAlgorithm); ok {
+		return sendAlgorithm
+	}
+	return &congestionControllerAdapter{
+		CongestionController: c,
+		newController:        newController,
+		rttStats:             rttStats,
+	}
+}
+
+// The congestionControllerAdapter adapts a CongestionController to the congestion.SendAlgorithm.
+type congestionControllerAdapter struct {
+	CongestionController
+
+	newController func(RTTStats) CongestionController
+	rttStats      *congestion.RTTStats
+}
+
+var _ congestion.SendAlgorithm = &congestionControllerAdapter{}
+
+// OnRTTUpdated is a no-op. The CongestionController reads the RTTStats when it needs them.
+func (a *congestionControllerAdapter) OnRTTUpdated() {}
+
+// MaybeExitSlowStart is a no-op. The CongestionController decides when to leave slow start in OnPacketAcked.
+func (a *congestionControllerAdapter) MaybeExitSlowStart() {}
+
+// OnECNCongestionEvent is never called, since ECN is not used with a CongestionController.
+func (a *congestionControllerAdapter) OnECNCongestionEvent(protocol.PacketNumber, protocol.ByteCount) {
+}
+
+// OnConnectionMigration replaces the CongestionController by a new one for the new path.
+func (a *congestionControllerAdapter) OnConnectionMigration() {
+	a.CongestionController = a.newController(a.rttStats)
+}
@@ -0,0 +1,128 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/congestion"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A wrappedCongestionController only implements the methods of the CongestionController.
+type wrappedCongestionController struct {
+	CongestionController
+}
+
+var _ = Describe("Congestion Control", func() {
+	for _, f := range []struct {
+		name string
+		new  func(RTTStats) CongestionController
+	}{
+		{"Cubic", NewCubicCongestionControl},
+		{"Reno", NewRenoCongestionControl},
+	} {
+		newController := f.new
+
+		Context(f.name, func() {
+			It("starts in slow start, with the initial congestion window", func() {
+				c := newController(&congestion.RTTStats{})
+				Expect(c.InSlowStart()).To(BeTrue())
+				Expect(c.InRecovery()).To(BeFalse())
+				Expect(c.GetCongestionWindow()).To(Equal(protocol.InitialCongestionWindow))
+			})
+
+			It("reduces the congestion window when a packet is lost", func() {
+				c := newController(&congestion.RTTStats{})
+				c.OnPacketSent(time.Now(), 0, 1, protocol.DefaultTCPMSS, true)
+				c.OnPacketLost(1, protocol.DefaultTCPMSS, protocol.DefaultTCPMSS)
+				Expect(c.InSlowStart()).To(BeFalse())
+				Expect(c.GetCongestionWindow()).To(BeNumerically("<", protocol.InitialCongestionWindow))
+			})
+		})
+	}
+
+	Context("LEDBAT", func() {
+		It("starts in slow start, with the initial congestion window", func() {
+			c := NewLEDBATCongestionControl(&congestion.RTTStats{})
+			Expect(c.InSlowStart()).To(BeTrue())
+			Expect(c.GetCongestionWindow()).To(Equal(protocol.InitialCongestionWindow))
+		})
+
+		It("reduces the congestion window when the RTT increases", func() {
+			rttStats := &congestion.RTTStats{}
+			c := NewLEDBATCongestionControl(rttStats).(congestion.SendAlgorithm)
+			now := time.Now()
+			c.OnPacketSent(now, protocol.DefaultTCPMSS, 1, protocol.DefaultTCPMSS, true)
+			rttStats.UpdateRTT(10*time.Millisecond, 0, now)
+			c.OnRTTUpdated()
+			c.MaybeExitSlowStart()
+			for pn := protocol.PacketNumber(2); pn < 10; pn++ {
+				c.OnPacketSent(now, protocol.DefaultTCPMSS, pn, protocol.DefaultTCPMSS, true)
+				rttStats.UpdateRTT(time.Second, 0, now)
+				c.OnRTTUpdated()
+				c.MaybeExitSlowStart()
+			}
+			Expect(c.InSlowStart()).To(BeFalse())
+			c.OnPacketAcked(9, protocol.DefaultTCPMSS, protocol.InitialCongestionWindow, now)
+			Expect(c.GetCongestionWindow()).To(BeNumerically("<", protocol.InitialCongestionWindow))
+		})
+	})
+
+	Context("BBR", func() {
+		It("starts in slow start, with the initial congestion window", func() {
+			c := NewBBRCongestionControl(&congestion.RTTStats{})
+			Expect(c.InSlowStart()).To(BeTrue())
+			Expect(c.GetCongestionWindow()).To(Equal(protocol.InitialCongestionWindow))
+		})
+
+		It("doesn't leave startup when a packet is lost", func() {
+			c := NewBBRCongestionControl(&congestion.RTTStats{})
+			c.OnPacketSent(time.Now(), protocol.DefaultTCPMSS, 1, protocol.DefaultTCPMSS, true)
+			c.OnPacketLost(1, protocol.DefaultTCPMSS, protocol.DefaultTCPMSS)
+			Expect(c.InSlowStart()).To(BeTrue())
+			Expect(c.InRecovery()).To(BeTrue())
+		})
+	})
+
+	Context("using CongestionControllers", func() {
+		It("uses the congestion controllers implemented by quic-go directly", func() {
+			rttStats := &congestion.RTTStats{}
+			Expect(newSendAlgorithm(NewCubicCongestionControl, rttStats)).ToNot(BeAssignableToTypeOf(&congestionControllerAdapter{}))
+		})
+
+		It("adapts other congestion controllers", func() {
+			var controllers []CongestionController
+			newController := func(r RTTStats) CongestionController {
+				c := &wrappedCongestionController{CongestionController: NewCubicCongestionControl(r)}
+				controllers = append(controllers, c)
+				return c
+			}
+			c := newSendAlgorithm(newController, &congestion.RTTStats{})
+			Expect(c).To(BeAssignableToTypeOf(&congestionControllerAdapter{}))
+			Expect(controllers).To(HaveLen(1))
+			c.OnPacketSent(time.Now(), 0, 1, protocol.DefaultTCPMSS, true)
+			c.OnPacketLost(1, protocol.DefaultTCPMSS, protocol.DefaultTCPMSS)
+			Expect(controllers[0].GetCongestionWindow()).To(BeNumerically("<", protocol.InitialCongestionWindow))
+			Expect(c.GetCongestionWindow()).To(Equal(controllers[0].GetCongestionWindow()))
+		})
+
+		It("creates a new congestion controller when the connection migrates", func() {
+			var controllers []CongestionController
+			newController := func(r RTTStats) CongestionController {
+				c := &wrappedCongestionController{CongestionController: NewCubicCongestionControl(r)}
+				controllers = append(controllers, c)
+				return c
+			}
+			c := newSendAlgorithm(newController, &congestion.RTTStats{})
+			c.OnPacketSent(time.Now(), 0, 1, protocol.DefaultTCPMSS, true)
+			c.OnPacketLost(1, protocol.DefaultTCPMSS, protocol.DefaultTCPMSS)
+			Expect(c.InSlowStart()).To(BeFalse())
+			c.OnConnectionMigration()
+			Expect(controllers).To(HaveLen(2))
+			Expect(c.InSlowStart()).To(BeTrue())
+			Expect(c.GetCongestionWindow()).To(Equal(protocol.InitialCongestionWindow))
+		})
+	})
+})
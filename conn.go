@@ -1,35 +1,202 @@
 package quic
 
 import (
+	"errors"
 	"net"
 	"sync"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
 )
 
 type connection interface {
-	Write([]byte) error
-	Read([]byte) (int, net.Addr, error)
+	// Write writes a packet to the current remote address, using the ECN codepoint in the IP header.
+	Write([]byte, protocol.ECN) error
+	// WriteTo writes a packet to an address other than the current remote address.
+	WriteTo([]byte, net.Addr) error
+	// WriteBatch writes multiple packets to the current remote address, using as few syscalls as possible.
+	// The addresses of the packets are ignored.
+	WriteBatch([]rawPacket) error
+	Read([]byte) (int, net.Addr, protocol.ECN, error)
+	// ReadBatch reads at least one, and at most len(ps) packets.
+	ReadBatch([]rawPacket) (int, error)
+	// SupportsECN says if ECN marks can be sent and received on this connection.
+	SupportsECN() bool
+	// SetDF sets the Don't Fragment bit on all packets sent on this connection.
+	// It also applies to sockets set later using SetPacketConn.
+	SetDF() error
+	// SetReadDeadline sets the read deadline of the socket that packets are read from.
+	SetReadDeadline(time.Time) error
 	Close() error
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
 	SetCurrentRemoteAddr(net.Addr)
+	// SetPacketConn sets the socket that packets are sent on.
+	// It is used by servers that read from multiple sockets.
+	SetPacketConn(rawConn)
+}
+
+// The maximum number of packets read with a single syscall.
+const readBatchSize = 8
+
+// A rawPacket is a packet read from or written to a rawConn.
+type rawPacket struct {
+	data []byte
+	addr net.Addr
+	ecn  protocol.ECN
+}
+
+// A rawConn is a net.PacketConn that can read and write the ECN field of the IP header,
+// and that can read and write multiple packets at once.
+type rawConn interface {
+	net.PacketConn
+	// ReadPacket reads a packet, and returns the ECN codepoint it was received with.
+	ReadPacket([]byte) (int, net.Addr, protocol.ECN, error)
+	// ReadPackets reads packets into the buffers of ps.
+	// It blocks until at least one packet was received, and returns the number of packets read.
+	// The data of every packet read is resliced to the length of the packet.
+	ReadPackets(ps []rawPacket) (int, error)
+	// WritePacket writes a packet, using the ECN codepoint in the IP header.
+	WritePacket([]byte, net.Addr, protocol.ECN) (int, error)
+	// WritePackets writes all packets, using as few syscalls as possible.
+	// If a packet is too large for the network interface, the other packets are still written,
+	// and the error is returned after all packets were written.
+	WritePackets(ps []rawPacket) error
+	SupportsECN() bool
+	// SetDF sets the Don't Fragment bit on all packets sent on this socket.
+	// This is necessary for path MTU discovery: a probe that is too large for the path must be dropped, not fragmented.
+	SetDF() error
+}
+
+// wrapConn wraps a net.PacketConn.
+// ECN, the Don't Fragment bit and batched I/O are only supported for UDP connections on Linux.
+func wrapConn(pconn net.PacketConn) rawConn {
+	if c, ok := pconn.(rawConn); ok {
+		return c
+	}
+	if c, ok := pconn.(*net.UDPConn); ok {
+		if oc, err := newOOBConn(c); err == nil {
+			return oc
+		}
+	}
+	return &basicConn{PacketConn: pconn}
+}
+
+// A basicConn is a net.PacketConn that doesn't support ECN.
+// It reads and writes one packet at a time.
+type basicConn struct {
+	net.PacketConn
+}
+
+var _ rawConn = &basicConn{}
+
+func (c *basicConn) ReadPacket(p []byte) (int, net.Addr, protocol.ECN, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	return n, addr, protocol.ECNNon, err
+}
+
+func (c *basicConn) ReadPackets(ps []rawPacket) (int, error) {
+	return readPacket(c, ps)
+}
+
+func (c *basicConn) WritePacket(p []byte, addr net.Addr, _ protocol.ECN) (int, error) {
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func (c *basicConn) WritePackets(ps []rawPacket) error {
+	return writePackets(c, ps)
+}
+
+func (c *basicConn) SupportsECN() bool { return false }
+
+func (c *basicConn) SetDF() error {
+	udpConn, ok := c.PacketConn.(*net.UDPConn)
+	if !ok {
+		return errors.New("setting the Don't Fragment bit is only supported for UDP connections")
+	}
+	return setDF(udpConn)
+}
+
+// readPacket reads a single packet into ps[0].
+// It is used by rawConns that can't read multiple packets with a single syscall.
+func readPacket(c rawConn, ps []rawPacket) (int, error) {
+	n, addr, ecn, err := c.ReadPacket(ps[0].data)
+	if err != nil {
+		return 0, err
+	}
+	ps[0].data = ps[0].data[:n]
+	ps[0].addr = addr
+	ps[0].ecn = ecn
+	return 1, nil
+}
+
+// writePackets writes the packets one by one.
+// It is used by rawConns that can't write multiple packets with a single syscall.
+func writePackets(c rawConn, ps []rawPacket) error {
+	var msgSizeErr error
+	for _, p := range ps {
+		if _, err := c.WritePacket(p.data, p.addr, p.ecn); err != nil {
+			if !isMsgSizeErr(err) {
+				return err
+			}
+			if msgSizeErr == nil {
+				msgSizeErr = err
+			}
+		}
+	}
+	return msgSizeErr
 }
 
 type conn struct {
 	mutex sync.RWMutex
 
-	pconn       net.PacketConn
+	pconn       rawConn
 	currentAddr net.Addr
+	// set when SetDF was called
+	df bool
 }
 
 var _ connection = &conn{}
 
-func (c *conn) Write(p []byte) error {
-	_, err := c.pconn.WriteTo(p, c.currentAddr)
+func (c *conn) Write(p []byte, ecn protocol.ECN) error {
+	pconn, addr := c.get()
+	_, err := pconn.WritePacket(p, addr, ecn)
 	return err
 }
 
-func (c *conn) Read(p []byte) (int, net.Addr, error) {
-	return c.pconn.ReadFrom(p)
+func (c *conn) WriteBatch(ps []rawPacket) error {
+	pconn, addr := c.get()
+	for i := range ps {
+		ps[i].addr = addr
+	}
+	return pconn.WritePackets(ps)
+}
+
+func (c *conn) WriteTo(p []byte, addr net.Addr) error {
+	pconn, _ := c.get()
+	_, err := pconn.WriteTo(p, addr)
+	return err
+}
+
+func (c *conn) Read(p []byte) (int, net.Addr, protocol.ECN, error) {
+	pconn, _ := c.get()
+	return pconn.ReadPacket(p)
+}
+
+func (c *conn) ReadBatch(ps []rawPacket) (int, error) {
+	pconn, _ := c.get()
+	return pconn.ReadPackets(ps)
+}
+
+func (c *conn) SupportsECN() bool {
+	pconn, _ := c.get()
+	return pconn.SupportsECN()
+}
+
+func (c *conn) get() (rawConn, net.Addr) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.pconn, c.currentAddr
 }
 
 func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
@@ -38,8 +205,30 @@ func (c *conn) SetCurrentRemoteAddr(addr net.Addr) {
 	c.mutex.Unlock()
 }
 
+func (c *conn) SetDF() error {
+	c.mutex.Lock()
+	c.df = true
+	pconn := c.pconn
+	c.mutex.Unlock()
+	return pconn.SetDF()
+}
+
+func (c *conn) SetPacketConn(pconn rawConn) {
+	c.mutex.Lock()
+	changed := pconn != c.pconn
+	c.pconn = pconn
+	df := c.df
+	c.mutex.Unlock()
+	if changed && df {
+		// If the DF bit can't be set, MTU probes might be fragmented.
+		// Path MTU discovery then finds a size that is too large, but packets still arrive.
+		_ = pconn.SetDF()
+	}
+}
+
 func (c *conn) LocalAddr() net.Addr {
-	return c.pconn.LocalAddr()
+	pconn, _ := c.get()
+	return pconn.LocalAddr()
 }
 
 func (c *conn) RemoteAddr() net.Addr {
@@ -49,6 +238,29 @@ func (c *conn) RemoteAddr() net.Addr {
 	return addr
 }
 
+func (c *conn) SetReadDeadline(t time.Time) error {
+	pconn, _ := c.get()
+	return pconn.SetReadDeadline(t)
+}
+
 func (c *conn) Close() error {
-	return c.pconn.Close()
+	pconn, _ := c.get()
+	return pconn.Close()
+}
+
+func addrsEqual(a, b net.Addr) bool {
+	return a.Network() == b.Network() && a.String() == b.String()
+}
+
+// onlyPortChanged says if two UDP addresses only differ in the port.
+func onlyPortChanged(a, b net.Addr) bool {
+	udpA, ok := a.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	udpB, ok := b.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	return udpA.IP.Equal(udpB.IP) && udpA.Zone == udpB.Zone
 }
@@ -0,0 +1,43 @@
+package quic
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// setDF sets the Don't Fragment bit on all packets sent on this connection.
+// The socket might be shared by multiple sessions, some of which don't perform path MTU discovery.
+// IP_PMTUDISC_PROBE ignores the path MTU the kernel learned from ICMP messages,
+// so that only packets larger than the MTU of the network interface fail to be sent.
+func setDF(c *net.UDPConn) error {
+	sc, err := c.SyscallConn()
+	if err != nil {
+		return err
+	}
+	// Depending on the address family of the socket, only one of these options can be set.
+	var errIPv4, errIPv6 error
+	if err := sc.Control(func(fd uintptr) {
+		errIPv4 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+		errIPv6 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_PROBE)
+	}); err != nil {
+		return err
+	}
+	if errIPv4 != nil && errIPv6 != nil {
+		return errIPv4
+	}
+	return nil
+}
+
+// isMsgSizeErr says if a write failed because the packet was larger than the MTU of the network interface.
+func isMsgSizeErr(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	sysErr, ok := opErr.Err.(*os.SyscallError)
+	if !ok {
+		return false
+	}
+	return sysErr.Err == syscall.EMSGSIZE
+}
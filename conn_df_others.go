@@ -0,0 +1,14 @@
+// +build !linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+)
+
+func setDF(*net.UDPConn) error {
+	return errors.New("setting the Don't Fragment bit is only supported on Linux")
+}
+
+func isMsgSizeErr(error) bool { return false }
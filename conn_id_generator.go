@@ -0,0 +1,36 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+)
+
+// The randomConnIDGenerator is the ConnectionIDGenerator used if none is configured.
+type randomConnIDGenerator struct {
+	length int
+}
+
+var _ ConnectionIDGenerator = &randomConnIDGenerator{}
+
+func (g *randomConnIDGenerator) GenerateConnectionID() (protocol.ConnectionID, error) {
+	return generateConnectionID(g.length)
+}
+
+func (g *randomConnIDGenerator) ConnectionIDLen() int {
+	return g.length
+}
+
+// generateConnID generates a new connection ID.
+// Short Headers don't contain the length of the connection ID,
+// so it checks that the ConnectionIDGenerator returned a connection ID of the announced length.
+func generateConnID(g ConnectionIDGenerator) (protocol.ConnectionID, error) {
+	connID, err := g.GenerateConnectionID()
+	if err != nil {
+		return nil, err
+	}
+	if connID.Len() != g.ConnectionIDLen() {
+		return nil, fmt.Errorf("ConnectionIDGenerator generated a connection ID of length %d, expected %d", connID.Len(), g.ConnectionIDLen())
+	}
+	return connID, nil
+}
@@ -0,0 +1,58 @@
+package quic
+
+import (
+	"errors"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fixedConnIDGenerator struct {
+	connID protocol.ConnectionID
+	length int
+	err    error
+}
+
+func (g *fixedConnIDGenerator) GenerateConnectionID() (protocol.ConnectionID, error) {
+	return g.connID, g.err
+}
+
+func (g *fixedConnIDGenerator) ConnectionIDLen() int { return g.length }
+
+var _ = Describe("Connection ID Generator", func() {
+	It("generates random connection IDs", func() {
+		g := &randomConnIDGenerator{length: 7}
+		Expect(g.ConnectionIDLen()).To(Equal(7))
+		c1, err := generateConnID(g)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1.Len()).To(Equal(7))
+		c2, err := generateConnID(g)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c2).ToNot(Equal(c1))
+	})
+
+	It("generates zero-length connection IDs", func() {
+		connID, err := generateConnID(&randomConnIDGenerator{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connID.Len()).To(BeZero())
+	})
+
+	It("uses a custom ConnectionIDGenerator", func() {
+		connID, err := generateConnID(&fixedConnIDGenerator{connID: protocol.ConnectionID{1, 2, 3, 4, 5}, length: 5})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5}))
+	})
+
+	It("returns errors from the ConnectionIDGenerator", func() {
+		testErr := errors.New("test error")
+		_, err := generateConnID(&fixedConnIDGenerator{err: testErr, length: 5})
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("errors if the ConnectionIDGenerator generates a connection ID of the wrong length", func() {
+		_, err := generateConnID(&fixedConnIDGenerator{connID: protocol.ConnectionID{1, 2, 3, 4, 5}, length: 6})
+		Expect(err).To(MatchError("ConnectionIDGenerator generated a connection ID of length 5, expected 6"))
+	})
+})
@@ -0,0 +1,63 @@
+package quic
+
+import (
+	"fmt"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+	"github.com/wangjiezhe/quic-go/qerr"
+)
+
+// The connIDManager stores the connection IDs issued by the peer in NEW_CONNECTION_ID frames.
+// Every connection ID is only used once, such that an observer can't link two paths of the same connection.
+type connIDManager struct {
+	// queue contains the connection IDs that haven't been used yet
+	queue []*wire.NewConnectionIDFrame
+	// seen contains the connection IDs that were stored, indexed by their sequence number
+	seen map[uint64]protocol.ConnectionID
+
+	// addResetToken is called with the stateless reset token of every connection ID that is stored
+	addResetToken func([16]byte)
+
+	logger utils.Logger
+}
+
+func newConnIDManager(addResetToken func([16]byte), logger utils.Logger) *connIDManager {
+	return &connIDManager{
+		seen:          make(map[uint64]protocol.ConnectionID),
+		addResetToken: addResetToken,
+		logger:        logger,
+	}
+}
+
+// Add adds a connection ID issued by the peer.
+// Retransmissions of a NEW_CONNECTION_ID frame are ignored.
+func (m *connIDManager) Add(f *wire.NewConnectionIDFrame) error {
+	if connID, ok := m.seen[f.SequenceNumber]; ok {
+		if !connID.Equal(f.ConnectionID) {
+			return qerr.Error(qerr.InvalidFrameData, fmt.Sprintf("received conflicting connection IDs for sequence number %d", f.SequenceNumber))
+		}
+		return nil
+	}
+	if len(m.queue) >= protocol.MaxPeerConnectionIDs {
+		m.logger.Debugf("Dropping connection ID %s (sequence number %d). Already storing %d unused connection IDs.", f.ConnectionID, f.SequenceNumber, len(m.queue))
+		return nil
+	}
+	m.seen[f.SequenceNumber] = f.ConnectionID
+	m.queue = append(m.queue, f)
+	m.addResetToken(f.StatelessResetToken)
+	return nil
+}
+
+// Get returns an unused connection ID, and removes it from the manager.
+// The sequence number of the frame is needed to retire the connection ID when it is no longer used.
+// It returns false if there's no unused connection ID left.
+func (m *connIDManager) Get() (*wire.NewConnectionIDFrame, bool) {
+	if len(m.queue) == 0 {
+		return nil, false
+	}
+	f := m.queue[0]
+	m.queue = m.queue[1:]
+	return f, true
+}
@@ -0,0 +1,90 @@
+package quic
+
+import (
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+	"github.com/wangjiezhe/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection ID Manager", func() {
+	var (
+		m           *connIDManager
+		resetTokens [][16]byte
+	)
+
+	BeforeEach(func() {
+		resetTokens = nil
+		m = newConnIDManager(func(token [16]byte) { resetTokens = append(resetTokens, token) }, utils.DefaultLogger)
+	})
+
+	It("returns false if there are no connection IDs", func() {
+		_, ok := m.Get()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("returns connection IDs in the order they were received", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 2, ConnectionID: protocol.ConnectionID{2, 2, 2, 2}})).To(Succeed())
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 1, 1, 1}})).To(Succeed())
+		f, ok := m.Get()
+		Expect(ok).To(BeTrue())
+		Expect(f.ConnectionID).To(Equal(protocol.ConnectionID{2, 2, 2, 2}))
+		Expect(f.SequenceNumber).To(Equal(uint64(2)))
+		f, ok = m.Get()
+		Expect(ok).To(BeTrue())
+		Expect(f.ConnectionID).To(Equal(protocol.ConnectionID{1, 1, 1, 1}))
+		Expect(f.SequenceNumber).To(Equal(uint64(1)))
+		_, ok = m.Get()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("passes on the stateless reset tokens", func() {
+		f := &wire.NewConnectionIDFrame{
+			SequenceNumber:      1,
+			ConnectionID:        protocol.ConnectionID{1, 2, 3, 4},
+			StatelessResetToken: [16]byte{0xde, 0xad, 0xbe, 0xef},
+		}
+		Expect(m.Add(f)).To(Succeed())
+		Expect(resetTokens).To(Equal([][16]byte{{0xde, 0xad, 0xbe, 0xef}}))
+		// retransmissions don't add the token again
+		Expect(m.Add(f)).To(Succeed())
+		Expect(resetTokens).To(HaveLen(1))
+	})
+
+	It("ignores retransmissions of a NEW_CONNECTION_ID frame", func() {
+		f := &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 2, 3, 4}}
+		Expect(m.Add(f)).To(Succeed())
+		Expect(m.Add(f)).To(Succeed())
+		_, ok := m.Get()
+		Expect(ok).To(BeTrue())
+		// a retransmission of a connection ID that was already used doesn't add it again
+		Expect(m.Add(f)).To(Succeed())
+		_, ok = m.Get()
+		Expect(ok).To(BeFalse())
+	})
+
+	It("errors when a sequence number is used for different connection IDs", func() {
+		Expect(m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 2, 3, 4}})).To(Succeed())
+		err := m.Add(&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{4, 3, 2, 1}})
+		Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "received conflicting connection IDs for sequence number 1")))
+	})
+
+	It("drops connection IDs when too many are stored", func() {
+		for i := 0; i < protocol.MaxPeerConnectionIDs+5; i++ {
+			Expect(m.Add(&wire.NewConnectionIDFrame{
+				SequenceNumber: uint64(i),
+				ConnectionID:   protocol.ConnectionID{byte(i), 0, 0, 0},
+			})).To(Succeed())
+		}
+		for i := 0; i < protocol.MaxPeerConnectionIDs; i++ {
+			f, ok := m.Get()
+			Expect(ok).To(BeTrue())
+			Expect(f.ConnectionID).To(Equal(protocol.ConnectionID{byte(i), 0, 0, 0}))
+		}
+		_, ok := m.Get()
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,168 @@
+package quic
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+)
+
+var (
+	errConnectionRefused      = errors.New("connection refused")
+	errTooManyConnections     = errors.New("too many connections")
+	errTooManyHandshakes      = errors.New("too many handshakes from this address")
+	errConnectionRateExceeded = errors.New("connection rate exceeded")
+)
+
+// A connLimiter decides if a server accepts a new connection.
+// It enforces the limits on the number of sessions, on the number of handshakes in progress per IP address,
+// and on the rate of new connections, and it calls Config.AcceptConnection.
+type connLimiter struct {
+	acceptConnection   func(net.Addr, *ClientHelloInfo) bool
+	maxConnections     int
+	maxHandshakesPerIP int
+	// the number of new connections per second, and the number of connections that can be accepted in a burst
+	rate float64
+
+	mutex          sync.Mutex
+	numConnections int
+	// the number of handshakes in progress, per IP address
+	handshakes map[string]int
+	// the number of connections that can be accepted right now
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newConnLimiter(config *Config) *connLimiter {
+	return &connLimiter{
+		acceptConnection:   config.AcceptConnection,
+		maxConnections:     config.MaxIncomingConnections,
+		maxHandshakesPerIP: config.MaxHandshakesPerIP,
+		rate:               float64(config.MaxConnectionRate),
+		tokens:             float64(config.MaxConnectionRate),
+		handshakes:         make(map[string]int),
+	}
+}
+
+// A limitedConn is a connection that was admitted by the connLimiter.
+type limitedConn struct {
+	ip                string
+	handshakeComplete bool
+	removed           bool
+}
+
+// Admit decides if a new connection from remoteAddr is accepted.
+// If it is, the connection counts towards the limits until Remove is called.
+// Every call counts as a new connection, so it must only be called for packets that create a new session.
+func (l *connLimiter) Admit(remoteAddr net.Addr, info *ClientHelloInfo) (*limitedConn, error) {
+	if l.acceptConnection != nil && !l.acceptConnection(remoteAddr, info) {
+		return nil, errConnectionRefused
+	}
+	ip := ipOf(remoteAddr)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxConnections > 0 && l.numConnections >= l.maxConnections {
+		return nil, errTooManyConnections
+	}
+	if l.maxHandshakesPerIP > 0 && l.handshakes[ip] >= l.maxHandshakesPerIP {
+		return nil, errTooManyHandshakes
+	}
+	if l.rate > 0 {
+		now := time.Now()
+		if !l.lastRefill.IsZero() {
+			l.tokens = math.Min(l.rate, l.tokens+now.Sub(l.lastRefill).Seconds()*l.rate)
+		}
+		l.lastRefill = now
+		if l.tokens < 1 {
+			return nil, errConnectionRateExceeded
+		}
+		l.tokens--
+	}
+	l.numConnections++
+	l.handshakes[ip]++
+	return &limitedConn{ip: ip}, nil
+}
+
+// HandshakeComplete is called when the handshake of a connection completed.
+func (l *connLimiter) HandshakeComplete(c *limitedConn) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if c.handshakeComplete || c.removed {
+		return
+	}
+	c.handshakeComplete = true
+	l.removeHandshake(c.ip)
+}
+
+// Remove is called when a connection is closed, or when the session for it couldn't be created.
+func (l *connLimiter) Remove(c *limitedConn) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if c.removed {
+		return
+	}
+	c.removed = true
+	l.numConnections--
+	if !c.handshakeComplete {
+		l.removeHandshake(c.ip)
+	}
+}
+
+func (l *connLimiter) removeHandshake(ip string) {
+	if l.handshakes[ip]--; l.handshakes[ip] <= 0 {
+		delete(l.handshakes, ip)
+	}
+}
+
+// NewSessionRunner wraps the sessionRunner of a session that was admitted.
+// connID is the connection ID the session is identified by.
+func (l *connLimiter) NewSessionRunner(runner sessionRunner, c *limitedConn, connID protocol.ConnectionID) sessionRunner {
+	return &limitedSessionRunner{
+		sessionRunner: runner,
+		limiter:       l,
+		conn:          c,
+		connID:        connID,
+	}
+}
+
+// A limitedSessionRunner tells the connLimiter when a session completed the handshake, and when it was closed.
+type limitedSessionRunner struct {
+	sessionRunner
+
+	limiter *connLimiter
+	conn    *limitedConn
+	// the connection ID the session is identified by
+	// It is removed when the session is closed.
+	connID protocol.ConnectionID
+}
+
+func (r *limitedSessionRunner) onHandshakeComplete(sess packetHandler) {
+	r.limiter.HandshakeComplete(r.conn)
+	r.sessionRunner.onHandshakeComplete(sess)
+}
+
+func (r *limitedSessionRunner) removeConnectionID(connID protocol.ConnectionID) {
+	r.sessionRunner.removeConnectionID(connID)
+	if connID.Equal(r.connID) {
+		r.limiter.Remove(r.conn)
+	}
+}
+
+// ipOf returns the IP address of a UDP address, and the string representation of any other address.
+func ipOf(addr net.Addr) string {
+	switch a := addr.(type) {
+	case nil:
+		return ""
+	case *net.UDPAddr:
+		return a.IP.String()
+	default:
+		return addr.String()
+	}
+}
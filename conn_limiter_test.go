@@ -0,0 +1,215 @@
+package quic
+
+import (
+	"net"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Connection Limiter", func() {
+	var (
+		addr1 = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+		addr2 = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 2), Port: 1234}
+		// info returns a ClientHelloInfo with a new connection ID on every call
+		connIDCounter byte
+		info          = func() *ClientHelloInfo {
+			connIDCounter++
+			return &ClientHelloInfo{Version: protocol.VersionWhatever, ConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, connIDCounter}}
+		}
+		// admit admits a connection, and returns the limitedConn
+		admit = func(l *connLimiter, addr net.Addr, i *ClientHelloInfo) *limitedConn {
+			c, err := l.Admit(addr, i)
+			ExpectWithOffset(1, err).ToNot(HaveOccurred())
+			return c
+		}
+	)
+
+	It("accepts connections if no limits are configured", func() {
+		l := newConnLimiter(&Config{})
+		for i := 0; i < 100; i++ {
+			admit(l, addr1, info())
+		}
+	})
+
+	It("uses AcceptConnection", func() {
+		var calledWith []net.Addr
+		i1 := info()
+		l := newConnLimiter(&Config{
+			AcceptConnection: func(addr net.Addr, i *ClientHelloInfo) bool {
+				if addr == addr1 {
+					Expect(i).To(Equal(i1))
+				}
+				calledWith = append(calledWith, addr)
+				return addr == addr1
+			},
+		})
+		admit(l, addr1, i1)
+		_, err := l.Admit(addr2, info())
+		Expect(err).To(MatchError(errConnectionRefused))
+		Expect(calledWith).To(Equal([]net.Addr{addr1, addr2}))
+		Expect(l.numConnections).To(Equal(1))
+	})
+
+	It("limits the number of connections", func() {
+		l := newConnLimiter(&Config{MaxIncomingConnections: 2})
+		c1 := admit(l, addr1, info())
+		admit(l, addr2, info())
+		_, err := l.Admit(addr2, info())
+		Expect(err).To(MatchError(errTooManyConnections))
+		// completing the handshake doesn't free a slot
+		l.HandshakeComplete(c1)
+		_, err = l.Admit(addr2, info())
+		Expect(err).To(MatchError(errTooManyConnections))
+		l.Remove(c1)
+		admit(l, addr2, info())
+	})
+
+	It("limits the number of handshakes per IP address", func() {
+		l := newConnLimiter(&Config{MaxHandshakesPerIP: 2})
+		c1 := admit(l, addr1, info())
+		c2 := admit(l, addr1, info())
+		_, err := l.Admit(&net.UDPAddr{IP: addr1.IP, Port: 4321}, info())
+		Expect(err).To(MatchError(errTooManyHandshakes))
+		admit(l, addr2, info())
+		l.HandshakeComplete(c1)
+		admit(l, addr1, info())
+		_, err = l.Admit(addr1, info())
+		Expect(err).To(MatchError(errTooManyHandshakes))
+		l.Remove(c2)
+		admit(l, addr1, info())
+	})
+
+	It("counts every connection, even if the client uses the same connection ID", func() {
+		l := newConnLimiter(&Config{MaxIncomingConnections: 2, MaxHandshakesPerIP: 2})
+		i := info()
+		c1 := admit(l, addr1, i)
+		c2 := admit(l, addr1, i)
+		Expect(c1).ToNot(BeIdenticalTo(c2))
+		Expect(l.numConnections).To(Equal(2))
+		Expect(l.handshakes).To(HaveKeyWithValue(addr1.IP.String(), 2))
+		_, err := l.Admit(addr1, i)
+		Expect(err).To(MatchError(errTooManyConnections))
+		l.Remove(c1)
+		Expect(l.numConnections).To(Equal(1))
+		l.Remove(c2)
+		Expect(l.numConnections).To(BeZero())
+		Expect(l.handshakes).To(BeEmpty())
+	})
+
+	It("only counts the completion of a handshake once", func() {
+		l := newConnLimiter(&Config{MaxHandshakesPerIP: 2})
+		c1 := admit(l, addr1, info())
+		admit(l, addr1, info())
+		l.HandshakeComplete(c1)
+		l.HandshakeComplete(c1)
+		Expect(l.handshakes).To(HaveKeyWithValue(addr1.IP.String(), 1))
+	})
+
+	It("only removes a connection once", func() {
+		l := newConnLimiter(&Config{MaxHandshakesPerIP: 2})
+		c1 := admit(l, addr1, info())
+		admit(l, addr1, info())
+		l.Remove(c1)
+		l.Remove(c1)
+		Expect(l.numConnections).To(Equal(1))
+		Expect(l.handshakes).To(HaveKeyWithValue(addr1.IP.String(), 1))
+		// completing the handshake after the connection was removed doesn't change anything
+		l.HandshakeComplete(c1)
+		Expect(l.handshakes).To(HaveKeyWithValue(addr1.IP.String(), 1))
+	})
+
+	It("deletes the entries for IP addresses without handshakes in progress", func() {
+		l := newConnLimiter(&Config{MaxHandshakesPerIP: 2})
+		c1 := admit(l, addr1, info())
+		c2 := admit(l, addr2, info())
+		l.HandshakeComplete(c1)
+		l.Remove(c2)
+		Expect(l.handshakes).To(BeEmpty())
+	})
+
+	It("limits the rate of new connections", func() {
+		l := newConnLimiter(&Config{MaxConnectionRate: 3})
+		for i := 0; i < 3; i++ {
+			admit(l, addr1, info())
+		}
+		_, err := l.Admit(addr2, info())
+		Expect(err).To(MatchError(errConnectionRateExceeded))
+		// pretend that one second has passed
+		l.lastRefill = l.lastRefill.Add(-time.Second)
+		for i := 0; i < 3; i++ {
+			admit(l, addr2, info())
+		}
+		_, err = l.Admit(addr2, info())
+		Expect(err).To(MatchError(errConnectionRateExceeded))
+	})
+
+	It("doesn't accumulate more than one second worth of connections", func() {
+		l := newConnLimiter(&Config{MaxConnectionRate: 2})
+		admit(l, addr1, info())
+		l.lastRefill = l.lastRefill.Add(-time.Hour)
+		admit(l, addr1, info())
+		admit(l, addr1, info())
+		_, err := l.Admit(addr1, info())
+		Expect(err).To(MatchError(errConnectionRateExceeded))
+	})
+
+	It("handles addresses that are not UDP addresses", func() {
+		l := newConnLimiter(&Config{MaxHandshakesPerIP: 1})
+		admit(l, &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1}, info())
+		admit(l, &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 2}, info())
+		admit(l, nil, info())
+		_, err := l.Admit(nil, info())
+		Expect(err).To(MatchError(errTooManyHandshakes))
+	})
+
+	Context("session runner", func() {
+		var (
+			l          *connLimiter
+			runner     *MockSessionRunner
+			connID     = protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad}
+			limitedRun sessionRunner
+		)
+
+		BeforeEach(func() {
+			l = newConnLimiter(&Config{MaxIncomingConnections: 1, MaxHandshakesPerIP: 1})
+			c := admit(l, addr1, info())
+			runner = NewMockSessionRunner(mockCtrl)
+			limitedRun = l.NewSessionRunner(runner, c, connID)
+		})
+
+		It("removes the connection when the session is closed before completing the handshake", func() {
+			runner.EXPECT().removeConnectionID(connID)
+			limitedRun.removeConnectionID(connID)
+			Expect(l.numConnections).To(BeZero())
+			Expect(l.handshakes).To(BeEmpty())
+		})
+
+		It("counts the handshake as completed", func() {
+			sess := NewMockPacketHandler(mockCtrl)
+			runner.EXPECT().onHandshakeComplete(sess)
+			limitedRun.onHandshakeComplete(sess)
+			Expect(l.numConnections).To(Equal(1))
+			Expect(l.handshakes).To(BeEmpty())
+			runner.EXPECT().removeConnectionID(connID)
+			limitedRun.removeConnectionID(connID)
+			Expect(l.numConnections).To(BeZero())
+			Expect(l.handshakes).To(BeEmpty())
+		})
+
+		It("only removes the connection when the session's main connection ID is removed", func() {
+			otherConnID := protocol.ConnectionID{1, 2, 3, 4}
+			runner.EXPECT().removeConnectionID(otherConnID)
+			limitedRun.removeConnectionID(otherConnID)
+			Expect(l.numConnections).To(Equal(1))
+		})
+
+		It("passes other calls to the session runner", func() {
+			runner.EXPECT().getStatelessResetToken(connID).Return([16]byte{42})
+			Expect(limitedRun.getStatelessResetToken(connID)).To(Equal([16]byte{42}))
+		})
+	})
+})
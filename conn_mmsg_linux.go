@@ -0,0 +1,277 @@
+// +build amd64 arm64
+
+package quic
+
+import (
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+)
+
+const (
+	// The maximum number of segments that can be sent in a single GSO packet, see UDP_MAX_SEGMENTS.
+	maxGSOSegments = 64
+	// The size of a GSO packet is limited by the 16 bit length field of the UDP header.
+	maxGSOSize = 65000
+)
+
+// An mmsghdr is a struct mmsghdr, as used by recvmmsg(2) and sendmmsg(2).
+// The syscall package doesn't define it.
+type mmsghdr struct {
+	hdr syscall.Msghdr
+	len uint32
+	_   [4]byte
+}
+
+// mmsgReadBuffers are the buffers passed to recvmmsg.
+// They are allocated on the first call to ReadPackets, and reused for all following calls.
+// Usually, only one go routine reads from a socket. The mutex is only contended when a client
+// starts reading from the socket again after version negotiation.
+type mmsgReadBuffers struct {
+	mutex sync.Mutex
+	hdrs  []mmsghdr
+	iovs  []syscall.Iovec
+	names []syscall.RawSockaddrAny
+	oob   []byte
+}
+
+func (b *mmsgReadBuffers) get(n int) ([]mmsghdr, []syscall.Iovec, []syscall.RawSockaddrAny, []byte) {
+	if len(b.hdrs) < n {
+		b.hdrs = make([]mmsghdr, n)
+		b.iovs = make([]syscall.Iovec, n)
+		b.names = make([]syscall.RawSockaddrAny, n)
+		b.oob = make([]byte, n*ecnControlMessageSize)
+	}
+	return b.hdrs[:n], b.iovs[:n], b.names[:n], b.oob[:n*ecnControlMessageSize]
+}
+
+// ReadPackets reads multiple packets with a single recvmmsg syscall.
+func (c *oobConn) ReadPackets(ps []rawPacket) (int, error) {
+	c.readBuffers.mutex.Lock()
+	defer c.readBuffers.mutex.Unlock()
+	hdrs, iovs, names, oob := c.readBuffers.get(len(ps))
+	for i := range ps {
+		iovs[i].Base = &ps[i].data[0]
+		iovs[i].SetLen(len(ps[i].data))
+		hdrs[i].len = 0
+		h := &hdrs[i].hdr
+		h.Name = (*byte)(unsafe.Pointer(&names[i]))
+		h.Namelen = syscall.SizeofSockaddrAny
+		h.Iov = &iovs[i]
+		h.Iovlen = 1
+		h.Control = &oob[i*ecnControlMessageSize]
+		h.SetControllen(ecnControlMessageSize)
+	}
+	var n int
+	var errno syscall.Errno
+	err := c.rawConn.Read(func(fd uintptr) bool {
+		for {
+			r, _, e := syscall.Syscall6(sysRECVMMSG, fd, uintptr(unsafe.Pointer(&hdrs[0])), uintptr(len(hdrs)), 0, 0, 0)
+			switch e {
+			case syscall.EINTR:
+				continue
+			case syscall.EAGAIN:
+				// wait until the socket becomes readable
+				return false
+			}
+			n, errno = int(r), e
+			return true
+		}
+	})
+	if err == nil && errno != 0 {
+		err = os.NewSyscallError("recvmmsg", errno)
+	}
+	if err != nil {
+		return 0, &net.OpError{Op: "read", Net: c.LocalAddr().Network(), Source: c.LocalAddr(), Err: err}
+	}
+	for i := 0; i < n; i++ {
+		h := &hdrs[i]
+		ps[i].data = ps[i].data[:h.len]
+		ps[i].addr = sockaddrToUDPAddr(&names[i])
+		ps[i].ecn = parseECNControlMessage(oob[i*ecnControlMessageSize : i*ecnControlMessageSize+int(h.hdr.Controllen)])
+	}
+	return n, nil
+}
+
+// WritePackets writes multiple packets with a single sendmmsg syscall.
+// If the kernel supports GSO, consecutive packets of the same size are sent as a single GSO packet.
+// A packet that is too large for the network interface (e.g. an MTU probe) doesn't prevent the following packets from being sent.
+func (c *oobConn) WritePackets(ps []rawPacket) error {
+	if len(ps) == 1 {
+		_, err := c.WritePacket(ps[0].data, ps[0].addr, ps[0].ecn)
+		return err
+	}
+	gso := c.gso.Get()
+	hdrs := make([]mmsghdr, 0, len(ps))
+	// the index of the first packet sent in every message
+	firstPacket := make([]int, 0, len(ps))
+	iovs := make([]syscall.Iovec, len(ps))
+	// Pointers into the control message buffer are stored in the mmsghdrs.
+	// Make sure it's large enough, such that append never reallocates it.
+	oob := make([]byte, 0, len(ps)*(syscall.CmsgSpace(4)+syscall.CmsgSpace(2)))
+	for i := 0; i < len(ps); {
+		p := ps[i]
+		udpAddr, ok := p.addr.(*net.UDPAddr)
+		if !ok {
+			return writePackets(c, ps)
+		}
+		name, nameLen, ok := udpAddrToSockaddr(udpAddr, c.family)
+		if !ok {
+			return writePackets(c, ps)
+		}
+		j := i + 1
+		size := len(p.data)
+		for gso && j < len(ps) && j-i < maxGSOSegments && (j-i+1)*size <= maxGSOSize &&
+			len(ps[j-1].data) == size && len(ps[j].data) <= size &&
+			ps[j].ecn == p.ecn && (ps[j].addr == p.addr || addrsEqual(ps[j].addr, p.addr)) {
+			j++
+		}
+		for k := i; k < j; k++ {
+			iovs[k].Base = &ps[k].data[0]
+			iovs[k].SetLen(len(ps[k].data))
+		}
+		oobStart := len(oob)
+		if p.ecn != protocol.ECNNon {
+			oob = appendECNControlMessage(oob, p.ecn, udpAddr.IP.To4() != nil)
+		}
+		if j-i > 1 {
+			oob = appendGSOControlMessage(oob, uint16(size))
+		}
+		var h mmsghdr
+		h.hdr.Name = name
+		h.hdr.Namelen = nameLen
+		h.hdr.Iov = &iovs[i]
+		h.hdr.Iovlen = uint64(j - i)
+		if len(oob) > oobStart {
+			h.hdr.Control = &oob[oobStart]
+			h.hdr.SetControllen(len(oob) - oobStart)
+		}
+		hdrs = append(hdrs, h)
+		firstPacket = append(firstPacket, i)
+		i = j
+	}
+
+	var sent int
+	var msgSizeErr error
+	for sent < len(hdrs) {
+		n, err := c.sendmmsg(hdrs[sent:])
+		if err == syscall.EIO && gso {
+			// Sending GSO packets fails if the network interface doesn't support checksum offloading.
+			c.gso.Set(false)
+			return c.WritePackets(ps[firstPacket[sent]:])
+		}
+		if err != nil {
+			if errno, ok := err.(syscall.Errno); ok {
+				err = os.NewSyscallError("sendmmsg", errno)
+			}
+			err = &net.OpError{Op: "write", Net: c.LocalAddr().Network(), Source: c.LocalAddr(), Addr: ps[firstPacket[sent]].addr, Err: err}
+			if !isMsgSizeErr(err) {
+				return err
+			}
+			// skip the message that was too large
+			if msgSizeErr == nil {
+				msgSizeErr = err
+			}
+			n = 1
+		}
+		sent += n
+	}
+	return msgSizeErr
+}
+
+func (c *oobConn) sendmmsg(hdrs []mmsghdr) (int, error) {
+	var n int
+	var errno syscall.Errno
+	if err := c.rawConn.Write(func(fd uintptr) bool {
+		for {
+			r, _, e := syscall.Syscall6(sysSENDMMSG, fd, uintptr(unsafe.Pointer(&hdrs[0])), uintptr(len(hdrs)), 0, 0, 0)
+			switch e {
+			case syscall.EINTR:
+				continue
+			case syscall.EAGAIN:
+				// wait until the socket becomes writable
+				return false
+			}
+			n, errno = int(r), e
+			return true
+		}
+	}); err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	return n, nil
+}
+
+func sockaddrToUDPAddr(sa *syscall.RawSockaddrAny) *net.UDPAddr {
+	switch sa.Addr.Family {
+	case syscall.AF_INET:
+		sa4 := (*syscall.RawSockaddrInet4)(unsafe.Pointer(sa))
+		ip := make(net.IP, net.IPv4len)
+		copy(ip, sa4.Addr[:])
+		return &net.UDPAddr{IP: ip, Port: ntohs(sa4.Port)}
+	case syscall.AF_INET6:
+		sa6 := (*syscall.RawSockaddrInet6)(unsafe.Pointer(sa))
+		ip := make(net.IP, net.IPv6len)
+		copy(ip, sa6.Addr[:])
+		var zone string
+		if sa6.Scope_id != 0 {
+			if ifi, err := net.InterfaceByIndex(int(sa6.Scope_id)); err == nil {
+				zone = ifi.Name
+			}
+		}
+		return &net.UDPAddr{IP: ip, Port: ntohs(sa6.Port), Zone: zone}
+	}
+	return nil
+}
+
+// udpAddrToSockaddr converts a UDP address to a socket address of the address family of the socket.
+// On an IPv6 socket, IPv4 addresses are converted to IPv4-mapped IPv6 addresses.
+func udpAddrToSockaddr(addr *net.UDPAddr, family int) (*byte, uint32, bool) {
+	switch family {
+	case syscall.AF_INET:
+		ip := addr.IP.To4()
+		if ip == nil {
+			return nil, 0, false
+		}
+		sa := &syscall.RawSockaddrInet4{Family: syscall.AF_INET, Port: htons(addr.Port)}
+		copy(sa.Addr[:], ip)
+		return (*byte)(unsafe.Pointer(sa)), syscall.SizeofSockaddrInet4, true
+	case syscall.AF_INET6:
+		ip := addr.IP.To16()
+		if ip == nil {
+			return nil, 0, false
+		}
+		sa := &syscall.RawSockaddrInet6{Family: syscall.AF_INET6, Port: htons(addr.Port)}
+		copy(sa.Addr[:], ip)
+		if addr.Zone != "" {
+			ifi, err := net.InterfaceByName(addr.Zone)
+			if err != nil {
+				return nil, 0, false
+			}
+			sa.Scope_id = uint32(ifi.Index)
+		}
+		return (*byte)(unsafe.Pointer(sa)), syscall.SizeofSockaddrInet6, true
+	}
+	return nil, 0, false
+}
+
+// ntohs converts a port in network byte order, as used in a socket address.
+func ntohs(port uint16) int {
+	b := (*[2]byte)(unsafe.Pointer(&port))
+	return int(b[0])<<8 | int(b[1])
+}
+
+// htons converts a port to network byte order, as used in a socket address.
+func htons(port int) uint16 {
+	var n uint16
+	b := (*[2]byte)(unsafe.Pointer(&n))
+	b[0] = byte(port >> 8)
+	b[1] = byte(port)
+	return n
+}
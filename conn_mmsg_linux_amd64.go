@@ -0,0 +1,8 @@
+package quic
+
+import "syscall"
+
+const sysRECVMMSG = syscall.SYS_RECVMMSG
+
+// The syscall package doesn't define SYS_SENDMMSG on amd64.
+const sysSENDMMSG = 307
@@ -0,0 +1,8 @@
+package quic
+
+import "syscall"
+
+const (
+	sysRECVMMSG = syscall.SYS_RECVMMSG
+	sysSENDMMSG = syscall.SYS_SENDMMSG
+)
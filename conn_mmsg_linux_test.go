@@ -0,0 +1,45 @@
+// +build amd64 arm64
+
+package quic
+
+import (
+	"net"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("recvmmsg", func() {
+	It("reuses the buffers when reading batches of packets", func() {
+		listen := func() *oobConn {
+			udpConn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			Expect(err).ToNot(HaveOccurred())
+			c := wrapConn(udpConn)
+			Expect(c).To(BeAssignableToTypeOf(&oobConn{}))
+			return c.(*oobConn)
+		}
+		server := listen()
+		defer server.Close()
+		client := listen()
+		defer client.Close()
+
+		read := func() {
+			_, err := client.WritePacket([]byte("foobar"), server.LocalAddr(), protocol.ECNNon)
+			Expect(err).ToNot(HaveOccurred())
+			ps := make([]rawPacket, 3)
+			for i := range ps {
+				ps[i].data = make([]byte, 100)
+			}
+			n, err := server.ReadPackets(ps)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(1))
+			Expect(ps[0].data).To(Equal([]byte("foobar")))
+		}
+		read()
+		hdrs := &server.readBuffers.hdrs[0]
+		read()
+		Expect(&server.readBuffers.hdrs[0]).To(BeIdenticalTo(hdrs))
+	})
+})
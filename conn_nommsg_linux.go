@@ -0,0 +1,17 @@
+// +build !amd64,!arm64
+
+package quic
+
+// recvmmsg and sendmmsg are only used on amd64 and arm64.
+// On other architectures, packets are read and written one by one.
+
+// mmsgReadBuffers are only needed for recvmmsg.
+type mmsgReadBuffers struct{}
+
+func (c *oobConn) ReadPackets(ps []rawPacket) (int, error) {
+	return readPacket(c, ps)
+}
+
+func (c *oobConn) WritePackets(ps []rawPacket) error {
+	return writePackets(c, ps)
+}
@@ -0,0 +1,164 @@
+package quic
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+)
+
+// The ECN field is the two least significant bits of the TOS / Traffic Class field.
+const ecnMask = 0x3
+
+// The size of the buffer used to receive control messages.
+// It is large enough to fit an IP_TOS and an IPV6_TCLASS control message.
+const ecnControlMessageSize = 64
+
+// UDP_SEGMENT enables UDP generic segmentation offload (GSO), see udp(7).
+// It is not defined in the syscall package.
+const (
+	solUDP     = 17
+	udpSegment = 103
+)
+
+// An oobConn uses control messages (out-of-band data) to read the ECN field of the IP header,
+// and to set it for every packet it sends.
+// On architectures that support it, multiple packets are read and written with a single syscall,
+// see conn_mmsg_linux.go.
+type oobConn struct {
+	*net.UDPConn
+	rawConn syscall.RawConn
+
+	// the address family of the socket: syscall.AF_INET or syscall.AF_INET6
+	family int
+	// set if the kernel supports UDP GSO
+	// It is unset if the network interface doesn't support GSO.
+	gso utils.AtomicBool
+	// set if the Don't Fragment bit was set
+	df utils.AtomicBool
+
+	readBuffers mmsgReadBuffers
+}
+
+var _ rawConn = &oobConn{}
+
+func newOOBConn(c *net.UDPConn) (rawConn, error) {
+	sc, err := c.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	// Depending on the address family of the socket, only one of these options can be set.
+	// A dual-stack IPv6 socket receives IPv4 packets with an IP_TOS control message.
+	var errIPv4, errIPv6, errFamily, errGSO error
+	var family int
+	if err := sc.Control(func(fd uintptr) {
+		errIPv4 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_RECVTOS, 1)
+		errIPv6 = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_RECVTCLASS, 1)
+		family, errFamily = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_DOMAIN)
+		// Reading the UDP_SEGMENT option fails if the kernel doesn't support GSO.
+		_, errGSO = syscall.GetsockoptInt(int(fd), solUDP, udpSegment)
+	}); err != nil {
+		return nil, err
+	}
+	if errIPv4 != nil && errIPv6 != nil {
+		return nil, errIPv4
+	}
+	if errFamily != nil {
+		return nil, errFamily
+	}
+	oc := &oobConn{
+		UDPConn: c,
+		rawConn: sc,
+		family:  family,
+	}
+	oc.gso.Set(errGSO == nil)
+	return oc, nil
+}
+
+func (c *oobConn) ReadPacket(p []byte) (int, net.Addr, protocol.ECN, error) {
+	oob := make([]byte, ecnControlMessageSize)
+	n, oobn, _, addr, err := c.UDPConn.ReadMsgUDP(p, oob)
+	if err != nil {
+		return n, nil, protocol.ECNNon, err
+	}
+	return n, addr, parseECNControlMessage(oob[:oobn]), nil
+}
+
+func (c *oobConn) WritePacket(p []byte, addr net.Addr, ecn protocol.ECN) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if ecn == protocol.ECNNon || !ok {
+		return c.UDPConn.WriteTo(p, addr)
+	}
+	n, _, err := c.UDPConn.WriteMsgUDP(p, ecnControlMessage(ecn, udpAddr.IP.To4() != nil), udpAddr)
+	return n, err
+}
+
+func (c *oobConn) SupportsECN() bool { return true }
+
+// SetDF sets the Don't Fragment bit.
+// The socket option is only set once, even if multiple sessions use this socket.
+func (c *oobConn) SetDF() error {
+	if c.df.Get() {
+		return nil
+	}
+	if err := setDF(c.UDPConn); err != nil {
+		return err
+	}
+	c.df.Set(true)
+	return nil
+}
+
+func parseECNControlMessage(oob []byte) protocol.ECN {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return protocol.ECNNon
+	}
+	for _, msg := range msgs {
+		switch {
+		case msg.Header.Level == syscall.IPPROTO_IP && msg.Header.Type == syscall.IP_TOS && len(msg.Data) >= 1:
+			return protocol.ECN(msg.Data[0] & ecnMask)
+		case msg.Header.Level == syscall.IPPROTO_IPV6 && msg.Header.Type == syscall.IPV6_TCLASS && len(msg.Data) >= 4:
+			// the traffic class is an int in host byte order
+			return protocol.ECN(*(*int32)(unsafe.Pointer(&msg.Data[0])) & ecnMask)
+		}
+	}
+	return protocol.ECNNon
+}
+
+// ecnControlMessage creates the control message that sets the ECN field.
+// IPv4 packets use the TOS field, IPv6 packets the Traffic Class field.
+func ecnControlMessage(ecn protocol.ECN, ipv4 bool) []byte {
+	return appendECNControlMessage(nil, ecn, ipv4)
+}
+
+func appendECNControlMessage(b []byte, ecn protocol.ECN, ipv4 bool) []byte {
+	level, typ := syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS
+	if ipv4 {
+		level, typ = syscall.IPPROTO_IP, syscall.IP_TOS
+	}
+	b, data := appendControlMessage(b, level, typ, 4)
+	*(*int32)(unsafe.Pointer(&data[0])) = int32(ecn)
+	return b
+}
+
+// appendGSOControlMessage appends the control message that sets the GSO segment size.
+func appendGSOControlMessage(b []byte, segmentSize uint16) []byte {
+	b, data := appendControlMessage(b, solUDP, udpSegment, 2)
+	*(*uint16)(unsafe.Pointer(&data[0])) = segmentSize
+	return b
+}
+
+// appendControlMessage appends a control message with dataLen bytes of data.
+// It returns the data of the control message, which has to be filled in by the caller.
+func appendControlMessage(b []byte, level, typ, dataLen int) ([]byte, []byte) {
+	start := len(b)
+	b = append(b, make([]byte, syscall.CmsgSpace(dataLen))...)
+	h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[start]))
+	h.Level = int32(level)
+	h.Type = int32(typ)
+	h.SetLen(syscall.CmsgLen(dataLen))
+	dataStart := start + syscall.CmsgLen(0)
+	return b, b[dataStart : dataStart+dataLen]
+}
@@ -0,0 +1,168 @@
+package quic
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OOB conn", func() {
+	listen := func(network, address string) rawConn {
+		addr, err := net.ResolveUDPAddr(network, address)
+		Expect(err).ToNot(HaveOccurred())
+		udpConn, err := net.ListenUDP(network, addr)
+		Expect(err).ToNot(HaveOccurred())
+		c := wrapConn(udpConn)
+		Expect(c).To(BeAssignableToTypeOf(&oobConn{}))
+		Expect(c.SupportsECN()).To(BeTrue())
+		return c
+	}
+
+	for _, v := range []struct {
+		name, network, address string
+	}{
+		{"IPv4", "udp4", "127.0.0.1:0"},
+		{"IPv6", "udp6", "[::1]:0"},
+	} {
+		network := v.network
+		address := v.address
+
+		Context(v.name, func() {
+			var server, client rawConn
+
+			BeforeEach(func() {
+				if network == "udp6" {
+					if c, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback}); err != nil {
+						Skip("IPv6 not available")
+					} else {
+						c.Close()
+					}
+				}
+				server = listen(network, address)
+				client = listen(network, address)
+			})
+
+			AfterEach(func() {
+				server.Close()
+				client.Close()
+			})
+
+			for _, e := range []protocol.ECN{protocol.ECNNon, protocol.ECT0, protocol.ECT1, protocol.ECNCE} {
+				ecn := e
+
+				It("sends and receives packets marked "+ecn.String(), func() {
+					n, err := client.WritePacket([]byte("foobar"), server.LocalAddr(), ecn)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(6))
+					b := make([]byte, 100)
+					n, addr, receivedECN, err := server.ReadPacket(b)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(b[:n]).To(Equal([]byte("foobar")))
+					Expect(addr.String()).To(Equal(client.LocalAddr().String()))
+					Expect(receivedECN).To(Equal(ecn))
+				})
+			}
+
+			It("only sets the DF bit when SetDF is called", func() {
+				Expect(client.(*oobConn).df.Get()).To(BeFalse())
+				c := &conn{pconn: client}
+				Expect(c.SetDF()).To(Succeed())
+				Expect(client.(*oobConn).df.Get()).To(BeTrue())
+				// the DF bit is also set on sockets used later
+				Expect(server.(*oobConn).df.Get()).To(BeFalse())
+				c.SetPacketConn(server)
+				Expect(server.(*oobConn).df.Get()).To(BeTrue())
+			})
+
+			It("sets the DF bit, but ignores the path MTU learned by the kernel", func() {
+				Expect(client.SetDF()).To(Succeed())
+				sc, err := client.(*oobConn).SyscallConn()
+				Expect(err).ToNot(HaveOccurred())
+				var mode int
+				var errMode error
+				Expect(sc.Control(func(fd uintptr) {
+					if network == "udp4" {
+						mode, errMode = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER)
+					} else {
+						mode, errMode = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER)
+					}
+				})).To(Succeed())
+				Expect(errMode).ToNot(HaveOccurred())
+				if network == "udp4" {
+					Expect(mode).To(Equal(syscall.IP_PMTUDISC_PROBE))
+				} else {
+					Expect(mode).To(Equal(syscall.IPV6_PMTUDISC_PROBE))
+				}
+			})
+
+			for _, g := range []bool{true, false} {
+				gso := g
+
+				It(fmt.Sprintf("sends and receives batches of packets (GSO: %t)", gso), func() {
+					if !gso {
+						client.(*oobConn).gso.Set(false)
+					}
+					var packets []rawPacket
+					// GSO can only be used for consecutive packets of the same size, except for the last one
+					for i, size := range []int{1000, 1000, 1000, 500, 1000, 1000, 1200, 1200} {
+						ecn := protocol.ECT0
+						if i >= 4 {
+							ecn = protocol.ECNNon
+						}
+						packets = append(packets, rawPacket{
+							data: bytes.Repeat([]byte{byte(i)}, size),
+							addr: server.LocalAddr(),
+							ecn:  ecn,
+						})
+					}
+					Expect(client.WritePackets(packets)).To(Succeed())
+					var received []rawPacket
+					for len(received) < len(packets) {
+						ps := make([]rawPacket, 3)
+						for i := range ps {
+							ps[i].data = make([]byte, 2000)
+						}
+						n, err := server.ReadPackets(ps)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(n).To(BeNumerically(">", 0))
+						received = append(received, ps[:n]...)
+					}
+					Expect(received).To(HaveLen(len(packets)))
+					for i, p := range received {
+						Expect(p.data).To(Equal(packets[i].data))
+						Expect(p.ecn).To(Equal(packets[i].ecn))
+						Expect(p.addr.String()).To(Equal(client.LocalAddr().String()))
+					}
+				})
+
+				It(fmt.Sprintf("sends the other packets of a batch if one packet is too large (GSO: %t)", gso), func() {
+					if !gso {
+						client.(*oobConn).gso.Set(false)
+					}
+					packets := []rawPacket{
+						{data: []byte("foo"), addr: server.LocalAddr()},
+						// larger than the maximum size of a UDP datagram
+						{data: make([]byte, 70000), addr: server.LocalAddr()},
+						{data: []byte("bar"), addr: server.LocalAddr()},
+					}
+					err := client.WritePackets(packets)
+					Expect(err).To(HaveOccurred())
+					Expect(isMsgSizeErr(err)).To(BeTrue())
+					b := make([]byte, 100)
+					n, _, _, err := server.ReadPacket(b)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(b[:n]).To(Equal([]byte("foo")))
+					n, _, _, err = server.ReadPacket(b)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(b[:n]).To(Equal([]byte("bar")))
+				})
+			}
+		})
+	}
+})
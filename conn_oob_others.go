@@ -0,0 +1,12 @@
+// +build !linux
+
+package quic
+
+import (
+	"errors"
+	"net"
+)
+
+func newOOBConn(*net.UDPConn) (rawConn, error) {
+	return nil, errors.New("control messages are only supported on Linux")
+}
@@ -0,0 +1,74 @@
+// +build !mips,!mipsle,!mips64,!mips64le
+
+package quic
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// The syscall package doesn't define SO_REUSEPORT on all architectures.
+// Its value is the same on all architectures except MIPS.
+const soReusePort = 0xf
+
+// listenUDPReusePort creates a UDP socket with the SO_REUSEPORT option set.
+// Multiple sockets can be bound to the same address, as long as all of them set SO_REUSEPORT.
+func listenUDPReusePort(addr *net.UDPAddr) (net.PacketConn, error) {
+	family := syscall.AF_INET6
+	if addr.IP.To4() != nil && !addr.IP.Equal(net.IPv4zero) {
+		family = syscall.AF_INET
+	}
+	fd, err := syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.IPPROTO_UDP)
+	if err == syscall.EAFNOSUPPORT && family == syscall.AF_INET6 && (addr.IP == nil || addr.IP.IsUnspecified()) {
+		// IPv6 is not available on this host
+		family = syscall.AF_INET
+		fd, err = syscall.Socket(family, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK, syscall.IPPROTO_UDP)
+	}
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := listenUDPReusePortFD(fd, family, addr); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "udp")
+	// FilePacketConn duplicates the file descriptor
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
+
+func listenUDPReusePortFD(fd, family int, addr *net.UDPAddr) error {
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, soReusePort, 1); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	var sa syscall.Sockaddr
+	if family == syscall.AF_INET {
+		sa4 := &syscall.SockaddrInet4{Port: addr.Port}
+		if ip4 := addr.IP.To4(); ip4 != nil {
+			copy(sa4.Addr[:], ip4)
+		}
+		sa = sa4
+	} else {
+		// Accept both IPv4 and IPv6 packets, if listening on the unspecified address.
+		if err := syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_V6ONLY, 0); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+		sa6 := &syscall.SockaddrInet6{Port: addr.Port}
+		if !addr.IP.IsUnspecified() {
+			copy(sa6.Addr[:], addr.IP.To16())
+		}
+		if addr.Zone != "" {
+			ifi, err := net.InterfaceByName(addr.Zone)
+			if err != nil {
+				return err
+			}
+			sa6.ZoneId = uint32(ifi.Index)
+		}
+		sa = sa6
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		return os.NewSyscallError("bind", err)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+// +build !linux mips mipsle mips64 mips64le
+
+package quic
+
+import (
+	"errors"
+	"net"
+)
+
+func listenUDPReusePort(*net.UDPAddr) (net.PacketConn, error) {
+	return nil, errors.New("SO_REUSEPORT is only supported on Linux")
+}
@@ -6,6 +6,8 @@ import (
 	"net"
 	"time"
 
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -18,11 +20,14 @@ type mockPacketConn struct {
 	dataWritten   bytes.Buffer
 	dataWrittenTo net.Addr
 	closed        bool
+	// a read deadline in the past wakes up a blocked ReadFrom
+	deadlinePassed chan struct{}
 }
 
 func newMockPacketConn() *mockPacketConn {
 	return &mockPacketConn{
-		dataToRead: make(chan []byte, 1000),
+		dataToRead:     make(chan []byte, 1000),
+		deadlinePassed: make(chan struct{}, 1),
 	}
 }
 
@@ -30,12 +35,16 @@ func (c *mockPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
 	if c.readErr != nil {
 		return 0, nil, c.readErr
 	}
-	data, ok := <-c.dataToRead
-	if !ok {
-		return 0, nil, errors.New("connection closed")
+	select {
+	case data, ok := <-c.dataToRead:
+		if !ok {
+			return 0, nil, errors.New("connection closed")
+		}
+		n := copy(b, data)
+		return n, c.dataReadFrom, nil
+	case <-c.deadlinePassed:
+		return 0, nil, errors.New("i/o timeout")
 	}
-	n := copy(b, data)
-	return n, c.dataReadFrom, nil
 }
 func (c *mockPacketConn) WriteTo(b []byte, addr net.Addr) (n int, err error) {
 	c.dataWrittenTo = addr
@@ -50,8 +59,21 @@ func (c *mockPacketConn) Close() error {
 }
 func (c *mockPacketConn) LocalAddr() net.Addr                { return c.addr }
 func (c *mockPacketConn) SetDeadline(t time.Time) error      { panic("not implemented") }
-func (c *mockPacketConn) SetReadDeadline(t time.Time) error  { panic("not implemented") }
 func (c *mockPacketConn) SetWriteDeadline(t time.Time) error { panic("not implemented") }
+func (c *mockPacketConn) SetReadDeadline(t time.Time) error {
+	if t.IsZero() {
+		select {
+		case <-c.deadlinePassed:
+		default:
+		}
+		return nil
+	}
+	select {
+	case c.deadlinePassed <- struct{}{}:
+	default:
+	}
+	return nil
+}
 
 var _ net.PacketConn = &mockPacketConn{}
 
@@ -67,28 +89,57 @@ var _ = Describe("Connection", func() {
 		packetConn = newMockPacketConn()
 		c = &conn{
 			currentAddr: addr,
-			pconn:       packetConn,
+			pconn:       wrapConn(packetConn),
 		}
 	})
 
 	It("writes", func() {
-		err := c.Write([]byte("foobar"))
+		err := c.Write([]byte("foobar"), protocol.ECNNon)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
 		Expect(packetConn.dataWrittenTo.String()).To(Equal("192.168.100.200:1337"))
 	})
 
+	It("writes to other addresses", func() {
+		err := c.WriteTo([]byte("foobar"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		Expect(packetConn.dataWrittenTo.String()).To(Equal("127.0.0.1:1234"))
+		Expect(c.RemoteAddr().String()).To(Equal("192.168.100.200:1337"))
+	})
+
 	It("reads", func() {
 		packetConn.dataToRead <- []byte("foo")
 		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1336}
 		p := make([]byte, 10)
-		n, raddr, err := c.Read(p)
+		n, raddr, ecn, err := c.Read(p)
 		Expect(err).ToNot(HaveOccurred())
+		Expect(ecn).To(Equal(protocol.ECNNon))
 		Expect(raddr.String()).To(Equal("127.0.0.1:1336"))
 		Expect(n).To(Equal(3))
 		Expect(p[0:3]).To(Equal([]byte("foo")))
 	})
 
+	It("writes batches", func() {
+		err := c.WriteBatch([]rawPacket{{data: []byte("foo")}, {data: []byte("bar")}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packetConn.dataWritten.Bytes()).To(Equal([]byte("foobar")))
+		Expect(packetConn.dataWrittenTo.String()).To(Equal("192.168.100.200:1337"))
+	})
+
+	It("reads batches, one packet at a time", func() {
+		packetConn.dataToRead <- []byte("foo")
+		packetConn.dataToRead <- []byte("bar")
+		packetConn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1336}
+		ps := []rawPacket{{data: make([]byte, 10)}, {data: make([]byte, 10)}}
+		n, err := c.ReadBatch(ps)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(ps[0].data).To(Equal([]byte("foo")))
+		Expect(ps[0].addr.String()).To(Equal("127.0.0.1:1336"))
+		Expect(ps[0].ecn).To(Equal(protocol.ECNNon))
+	})
+
 	It("gets the remote address", func() {
 		Expect(c.RemoteAddr().String()).To(Equal("192.168.100.200:1337"))
 	})
@@ -116,4 +167,17 @@ var _ = Describe("Connection", func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packetConn.closed).To(BeTrue())
 	})
+	It("compares addresses", func() {
+		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+		Expect(addrsEqual(addr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234})).To(BeTrue())
+		Expect(addrsEqual(addr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4321})).To(BeFalse())
+		Expect(addrsEqual(addr, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234})).To(BeFalse())
+	})
+
+	It("detects if only the port changed", func() {
+		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+		Expect(onlyPortChanged(addr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4321})).To(BeTrue())
+		Expect(onlyPortChanged(addr, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 1234})).To(BeFalse())
+		Expect(onlyPortChanged(addr, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234})).To(BeFalse())
+	})
 })
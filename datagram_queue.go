@@ -0,0 +1,108 @@
+package quic
+
+import (
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+)
+
+type queuedDatagram struct {
+	frame *wire.DatagramFrame
+	// done is closed as soon as the frame was dequeued by the packer
+	done chan struct{}
+}
+
+// The datagramQueue holds DATAGRAM frames that are waiting to be sent,
+// and DATAGRAM frames that were received, but not yet read by the application.
+type datagramQueue struct {
+	sendQueue chan *queuedDatagram
+	nextFrame *queuedDatagram
+	rcvQueue  chan []byte
+
+	closeErr error
+	closed   chan struct{}
+
+	hasData func()
+
+	logger utils.Logger
+}
+
+func newDatagramQueue(hasData func(), logger utils.Logger) *datagramQueue {
+	return &datagramQueue{
+		sendQueue: make(chan *queuedDatagram, 1),
+		rcvQueue:  make(chan []byte, protocol.DatagramRcvQueueLen),
+		closed:    make(chan struct{}),
+		hasData:   hasData,
+		logger:    logger,
+	}
+}
+
+// AddAndWait queues a new DATAGRAM frame for sending.
+// It blocks until the frame has been dequeued, or the queue is closed.
+func (h *datagramQueue) AddAndWait(f *wire.DatagramFrame) error {
+	d := &queuedDatagram{frame: f, done: make(chan struct{})}
+	select {
+	case h.sendQueue <- d:
+		h.hasData()
+	case <-h.closed:
+		return h.closeErr
+	}
+
+	select {
+	case <-d.done:
+		return nil
+	case <-h.closed:
+		return h.closeErr
+	}
+}
+
+// Peek gets the next DATAGRAM frame for sending.
+// If actually sent out, Pop needs to be called before the next call to Peek.
+func (h *datagramQueue) Peek() *wire.DatagramFrame {
+	if h.nextFrame != nil {
+		return h.nextFrame.frame
+	}
+	select {
+	case h.nextFrame = <-h.sendQueue:
+		return h.nextFrame.frame
+	default:
+		return nil
+	}
+}
+
+// Pop removes the frame returned by Peek from the queue.
+func (h *datagramQueue) Pop() {
+	if h.nextFrame == nil {
+		return
+	}
+	close(h.nextFrame.done)
+	h.nextFrame = nil
+}
+
+// HandleDatagramFrame handles a received DATAGRAM frame.
+// If the receive queue is full, the frame is dropped.
+func (h *datagramQueue) HandleDatagramFrame(f *wire.DatagramFrame) {
+	select {
+	case h.rcvQueue <- f.Data:
+	default:
+		h.logger.Debugf("Discarding DATAGRAM frame (%d bytes payload)", len(f.Data))
+	}
+}
+
+// Receive gets a received DATAGRAM frame.
+// It blocks until a frame is received, or the queue is closed.
+func (h *datagramQueue) Receive() ([]byte, error) {
+	select {
+	case data := <-h.rcvQueue:
+		return data, nil
+	case <-h.closed:
+		return nil, h.closeErr
+	}
+}
+
+// CloseWithError closes the queue.
+// All pending and future calls to AddAndWait and Receive return the error.
+func (h *datagramQueue) CloseWithError(e error) {
+	h.closeErr = e
+	close(h.closed)
+}
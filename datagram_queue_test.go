@@ -0,0 +1,111 @@
+package quic
+
+import (
+	"errors"
+
+	"github.com/wangjiezhe/quic-go/internal/utils"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Datagram Queue", func() {
+	var queue *datagramQueue
+	var queued chan struct{}
+
+	BeforeEach(func() {
+		queued = make(chan struct{}, 100)
+		queue = newDatagramQueue(func() { queued <- struct{}{} }, utils.DefaultLogger)
+	})
+
+	Context("sending", func() {
+		It("returns nil when there's no datagram to send", func() {
+			Expect(queue.Peek()).To(BeNil())
+		})
+
+		It("queues a datagram", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				Expect(queue.AddAndWait(&wire.DatagramFrame{Data: []byte("foobar")})).To(Succeed())
+			}()
+
+			Eventually(queued).Should(HaveLen(1))
+			Consistently(done).ShouldNot(BeClosed())
+			f := queue.Peek()
+			Expect(f).ToNot(BeNil())
+			Expect(f.Data).To(Equal([]byte("foobar")))
+			// peeking again returns the same frame
+			Expect(queue.Peek()).To(Equal(f))
+			Consistently(done).ShouldNot(BeClosed())
+			queue.Pop()
+			Eventually(done).Should(BeClosed())
+			Expect(queue.Peek()).To(BeNil())
+		})
+
+		It("returns an error when the queue is closed", func() {
+			errChan := make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				errChan <- queue.AddAndWait(&wire.DatagramFrame{Data: []byte("foobar")})
+			}()
+
+			Eventually(queued).Should(HaveLen(1))
+			Consistently(errChan).ShouldNot(Receive())
+			queue.CloseWithError(errors.New("test error"))
+			Eventually(errChan).Should(Receive(MatchError("test error")))
+		})
+	})
+
+	Context("receiving", func() {
+		It("receives DATAGRAM frames", func() {
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("foo")})
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("bar")})
+			data, err := queue.Receive()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foo")))
+			data, err = queue.Receive()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("bar")))
+		})
+
+		It("blocks until a frame is received", func() {
+			c := make(chan []byte, 1)
+			go func() {
+				defer GinkgoRecover()
+				data, err := queue.Receive()
+				Expect(err).ToNot(HaveOccurred())
+				c <- data
+			}()
+
+			Consistently(c).ShouldNot(Receive())
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("foobar")})
+			Eventually(c).Should(Receive(Equal([]byte("foobar"))))
+		})
+
+		It("drops frames when the receive queue is full", func() {
+			for i := 0; i < cap(queue.rcvQueue)+10; i++ {
+				queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte{byte(i)}})
+			}
+			Expect(queue.rcvQueue).To(HaveLen(cap(queue.rcvQueue)))
+			data, err := queue.Receive()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte{0}))
+		})
+
+		It("returns an error when the queue is closed", func() {
+			errChan := make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				_, err := queue.Receive()
+				errChan <- err
+			}()
+
+			Consistently(errChan).ShouldNot(Receive())
+			queue.CloseWithError(errors.New("test error"))
+			Eventually(errChan).Should(Receive(MatchError("test error")))
+		})
+	})
+})
@@ -16,6 +16,7 @@ import (
 func main() {
 	verbose := flag.Bool("v", false, "verbose")
 	tls := flag.Bool("tls", false, "activate support for IETF QUIC (work in progress)")
+	configCacheDir := flag.String("config-cache", "", "directory to cache gQUIC server configs in")
 	flag.Parse()
 	urls := flag.Args()
 
@@ -33,8 +34,17 @@ func main() {
 		versions = append([]protocol.VersionNumber{protocol.VersionTLS}, versions...)
 	}
 
+	quicConf := &quic.Config{Versions: versions}
+	if *configCacheDir != "" {
+		configCache, err := quic.NewFileClientConfigCache(*configCacheDir)
+		if err != nil {
+			panic(err)
+		}
+		quicConf.ClientConfigCache = configCache
+	}
+
 	roundTripper := &h2quic.RoundTripper{
-		QuicConfig: &quic.Config{Versions: versions},
+		QuicConfig: quicConf,
 	}
 	defer roundTripper.Close()
 	hclient := &http.Client{
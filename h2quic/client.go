@@ -1,6 +1,7 @@
 package h2quic
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -24,7 +25,11 @@ type roundTripperOpts struct {
 	DisableCompression bool
 }
 
-var dialAddr = quic.DialAddr
+var dialAddr = quic.DialAddrContext
+
+// errGoingAway is returned by RoundTrip if the request couldn't be sent because the server is shutting down.
+// It is safe to retry the request on a new connection.
+var errGoingAway = errors.New("h2quic: server is going away")
 
 // client is a HTTP2 client doing QUIC requests
 type client struct {
@@ -37,7 +42,7 @@ type client struct {
 	hostname     string
 	handshakeErr error
 	dialOnce     sync.Once
-	dialer       func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
+	dialer       func(ctx context.Context, network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
 	session       quic.Session
 	headerStream  quic.Stream
@@ -63,7 +68,7 @@ func newClient(
 	tlsConfig *tls.Config,
 	opts *roundTripperOpts,
 	quicConfig *quic.Config,
-	dialer func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error),
+	dialer func(ctx context.Context, network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error),
 ) *client {
 	config := defaultQuicConfig
 	if quicConfig != nil {
@@ -82,12 +87,12 @@ func newClient(
 }
 
 // dial dials the connection
-func (c *client) dial() error {
+func (c *client) dial(ctx context.Context) error {
 	var err error
 	if c.dialer != nil {
-		c.session, err = c.dialer("udp", c.hostname, c.tlsConf, c.config)
+		c.session, err = c.dialer(ctx, "udp", c.hostname, c.tlsConf, c.config)
 	} else {
-		c.session, err = dialAddr(c.hostname, c.tlsConf, c.config)
+		c.session, err = dialAddr(ctx, c.hostname, c.tlsConf, c.config)
 	}
 	if err != nil {
 		return err
@@ -111,14 +116,37 @@ func (c *client) handleHeaderStream() {
 	for err == nil {
 		err = c.readResponse(h2framer, decoder)
 	}
-	if quicErr, ok := err.(*qerr.QuicError); !ok || quicErr.ErrorCode != qerr.PeerGoingAway {
-		c.logger.Debugf("Error handling header stream: %s", err)
+	if err == io.EOF {
+		// The server closed the headers stream when shutting down gracefully.
+		// Closing it as well allows the server to close the session once all responses have been received.
+		c.headerStream.Close()
+		c.headerErr = qerr.Error(qerr.PeerGoingAway, "server closed the header stream")
+	} else {
+		if quicErr, ok := err.(*qerr.QuicError); !ok || quicErr.ErrorCode != qerr.PeerGoingAway {
+			c.logger.Debugf("Error handling header stream: %s", err)
+		}
+		c.headerErr = qerr.Error(qerr.InvalidHeadersStreamData, err.Error())
 	}
-	c.headerErr = qerr.Error(qerr.InvalidHeadersStreamData, err.Error())
 	// stop all running request
 	close(c.headerErrored)
 }
 
+// dialCanceled says if dialing the connection failed because the context of the request that dialed it was done.
+// Such a client can't be used for any other requests, although the connection might succeed when dialed again.
+func (c *client) dialCanceled() bool {
+	return c.handshakeErr == context.Canceled || c.handshakeErr == context.DeadlineExceeded
+}
+
+// isGoingAway says if the server closed the headers stream when shutting down gracefully.
+func (c *client) isGoingAway() bool {
+	select {
+	case <-c.headerErrored:
+		return c.headerErr.ErrorCode == qerr.PeerGoingAway
+	default:
+		return false
+	}
+}
+
 func (c *client) readResponse(h2framer *http2.Framer, decoder *hpack.Decoder) error {
 	frame, err := h2framer.ReadFrame()
 	if err != nil {
@@ -160,7 +188,7 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 
 	c.dialOnce.Do(func() {
-		c.handshakeErr = c.dial()
+		c.handshakeErr = c.dial(req.Context())
 	})
 
 	if c.handshakeErr != nil {
@@ -169,9 +197,16 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	hasBody := (req.Body != nil)
 
+	if c.isGoingAway() {
+		return nil, errGoingAway
+	}
 	responseChan := make(chan *http.Response)
 	dataStream, err := c.session.OpenStream()
 	if err != nil {
+		if quicErr, ok := err.(*qerr.QuicError); ok && quicErr.ErrorCode == qerr.PeerGoingAway {
+			// The server sent a GOAWAY frame, or it closed the session.
+			return nil, errGoingAway
+		}
 		if err != qerr.TooManyOpenStreams {
 			_ = c.CloseWithError(err)
 		}
@@ -232,7 +267,10 @@ func (c *client) RoundTrip(req *http.Request) (*http.Response, error) {
 			return nil, ctx.Err()
 		case <-c.headerErrored:
 			// an error occurred on the header stream
-			_ = c.CloseWithError(c.headerErr)
+			// If the server is going away, responses to earlier requests might still be received on the session.
+			if c.headerErr.ErrorCode != qerr.PeerGoingAway {
+				_ = c.CloseWithError(c.headerErr)
+			}
 			return nil, c.headerErr
 		}
 	}
@@ -91,7 +91,7 @@ var _ = Describe("Client", func() {
 	It("dials", func() {
 		client = newClient("localhost:1337", nil, &roundTripperOpts{}, nil, nil)
 		session.streamsToOpen = []quic.Stream{newMockStream(3), newMockStream(5)}
-		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+		dialAddr = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
 			return session, nil
 		}
 		close(headerStream.unblockRead)
@@ -112,7 +112,7 @@ var _ = Describe("Client", func() {
 	It("errors when dialing fails", func() {
 		testErr := errors.New("handshake error")
 		client = newClient("localhost:1337", nil, &roundTripperOpts{}, nil, nil)
-		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+		dialAddr = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
 			return nil, testErr
 		}
 		_, err := client.RoundTrip(req)
@@ -123,7 +123,7 @@ var _ = Describe("Client", func() {
 		var tlsCfg *tls.Config
 		var qCfg *quic.Config
 		session.streamsToOpen = []quic.Stream{newMockStream(3), newMockStream(5)}
-		dialer := func(_, _ string, tlsCfgP *tls.Config, cfg *quic.Config) (quic.Session, error) {
+		dialer := func(_ context.Context, _, _ string, tlsCfgP *tls.Config, cfg *quic.Config) (quic.Session, error) {
 			tlsCfg = tlsCfgP
 			qCfg = cfg
 			return session, nil
@@ -144,11 +144,25 @@ var _ = Describe("Client", func() {
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("passes the context of the request to the dialer", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var dialCtx context.Context
+		client = newClient("localhost:1337", nil, &roundTripperOpts{}, nil, nil)
+		dialAddr = func(ctx context.Context, _ string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+			dialCtx = ctx
+			return nil, ctx.Err()
+		}
+		_, err := client.RoundTrip(req.WithContext(ctx))
+		Expect(err).To(MatchError(context.Canceled))
+		Expect(dialCtx).To(Equal(ctx))
+	})
+
 	It("errors if it can't open a stream", func() {
 		testErr := errors.New("you shall not pass")
 		client = newClient("localhost:1337", nil, &roundTripperOpts{}, nil, nil)
 		session.streamOpenErr = testErr
-		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+		dialAddr = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
 			return session, nil
 		}
 		_, err := client.RoundTrip(req)
@@ -157,7 +171,7 @@ var _ = Describe("Client", func() {
 
 	It("returns a request when dial fails", func() {
 		testErr := errors.New("dial error")
-		dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+		dialAddr = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
 			return nil, testErr
 		}
 		request, err := http.NewRequest("https", "https://quic.clemente.io:1337/file1.dat", nil)
@@ -200,7 +214,7 @@ var _ = Describe("Client", func() {
 
 		BeforeEach(func() {
 			var err error
-			dialAddr = func(hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+			dialAddr = func(_ context.Context, hostname string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
 				return session, nil
 			}
 			dataStream = newMockStream(5)
@@ -320,6 +334,23 @@ var _ = Describe("Client", func() {
 			Expect(nextErr).To(MatchError(err))
 		})
 
+		It("doesn't send requests after the server closed the header stream", func() {
+			client.dialOnce.Do(func() {})
+			client.headerErr = qerr.Error(qerr.PeerGoingAway, "server closed the header stream")
+			close(client.headerErrored)
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError(errGoingAway))
+			Expect(session.closed).To(BeFalse())
+		})
+
+		It("doesn't send requests after the server sent a GOAWAY frame", func() {
+			client.dialOnce.Do(func() {})
+			session.streamOpenErr = qerr.Error(qerr.PeerGoingAway, "peer sent a GOAWAY frame")
+			_, err := client.RoundTrip(request)
+			Expect(err).To(MatchError(errGoingAway))
+			Expect(session.closed).To(BeFalse())
+		})
+
 		It("blocks if no stream is available", func() {
 			session.streamsToOpen = []quic.Stream{headerStream, dataStream}
 			session.blockOpenStreamSync = true
@@ -600,6 +631,14 @@ var _ = Describe("Client", func() {
 				Expect(rsp.Header).To(HaveKeyWithValue("Cache-Control", []string{"private"}))
 			})
 
+			It("closes the header stream when the server closes it", func() {
+				close(headerStream.unblockRead)
+				client.handleHeaderStream()
+				Expect(headerStream.closed).To(BeTrue())
+				Expect(client.headerErrored).To(BeClosed())
+				Expect(client.headerErr.ErrorCode).To(Equal(qerr.PeerGoingAway))
+			})
+
 			It("errors if the H2 frame is not a HeadersFrame", func() {
 				h2framer.WritePing(true, [8]byte{0, 0, 0, 0, 0, 0, 0, 0})
 				client.handleHeaderStream()
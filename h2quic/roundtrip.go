@@ -1,6 +1,7 @@
 package h2quic
 
 import (
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -47,8 +48,9 @@ type RoundTripper struct {
 
 	// Dial specifies an optional dial function for creating QUIC
 	// connections for requests.
-	// If Dial is nil, quic.DialAddr will be used.
-	Dial func(network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
+	// The context is the context of the request that triggered the dial.
+	// If Dial is nil, quic.DialAddrContext will be used.
+	Dial func(ctx context.Context, network, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.Session, error)
 
 	clients map[string]roundTripCloser
 }
@@ -110,6 +112,21 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 	}
 
 	resp, err := cl.RoundTrip(req)
+	if err == errGoingAway {
+		// The server is shutting down, and the request wasn't sent.
+		// Retry it on a new connection.
+		r.removeClient(cl)
+		cl, err = r.getClient(hostname, opt.OnlyCachedConn)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = cl.RoundTrip(req)
+	}
+	// The client is dialed using the context of the first request.
+	// If that request was canceled, the next request needs to dial a new connection.
+	if c, ok := cl.(*client); ok && c.dialCanceled() {
+		r.removeClient(cl)
+	}
 
 	if err == nil {
 		return resp, err
@@ -171,6 +188,18 @@ func (r *RoundTripper) getClient(hostname string, onlyCached bool) (http.RoundTr
 	return client, nil
 }
 
+// removeClient removes a client, so that new requests are sent on a new connection.
+// The client is not closed, since responses to earlier requests might still be read.
+func (r *RoundTripper) removeClient(cl http.RoundTripper) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for key, client := range r.clients {
+		if client == cl {
+			delete(r.clients, key)
+		}
+	}
+}
+
 // Close closes the QUIC connections that this RoundTripper has used
 func (r *RoundTripper) Close() error {
 	r.mutex.Lock()
@@ -2,6 +2,7 @@ package h2quic
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"io"
@@ -14,10 +15,14 @@ import (
 )
 
 type mockClient struct {
-	closed bool
+	closed       bool
+	roundTripErr error
 }
 
 func (m *mockClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	if m.roundTripErr != nil {
+		return nil, m.roundTripErr
+	}
 	return &http.Response{Request: req}, nil
 }
 func (m *mockClient) Close() error {
@@ -72,7 +77,7 @@ var _ = Describe("RoundTripper", func() {
 
 		BeforeEach(func() {
 			origDialAddr = dialAddr
-			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+			dialAddr = func(_ context.Context, addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
 				// return an error when trying to open a stream
 				// we don't want to test all the dial logic here, just that dialing happens at all
 				return &mockSession{streamOpenErr: streamOpenErr}, nil
@@ -94,7 +99,7 @@ var _ = Describe("RoundTripper", func() {
 		It("uses the quic.Config, if provided", func() {
 			config := &quic.Config{HandshakeTimeout: time.Millisecond}
 			var receivedConfig *quic.Config
-			dialAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
+			dialAddr = func(_ context.Context, addr string, tlsConf *tls.Config, config *quic.Config) (quic.Session, error) {
 				receivedConfig = config
 				return nil, errors.New("err")
 			}
@@ -105,7 +110,7 @@ var _ = Describe("RoundTripper", func() {
 
 		It("uses the custom dialer, if provided", func() {
 			var dialed bool
-			dialer := func(_, _ string, tlsCfgP *tls.Config, cfg *quic.Config) (quic.Session, error) {
+			dialer := func(_ context.Context, _, _ string, tlsCfgP *tls.Config, cfg *quic.Config) (quic.Session, error) {
 				dialed = true
 				return nil, errors.New("err")
 			}
@@ -127,6 +132,38 @@ var _ = Describe("RoundTripper", func() {
 			Expect(rt.clients).To(HaveLen(1))
 		})
 
+		It("retries the request on a new connection if the server is going away", func() {
+			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			oldClient := &mockClient{roundTripErr: errGoingAway}
+			rt.clients = map[string]roundTripCloser{"quic.clemente.io:443": oldClient}
+			_, err = rt.RoundTrip(req)
+			Expect(err).To(MatchError(streamOpenErr))
+			Expect(rt.clients).To(HaveLen(1))
+			Expect(rt.clients["quic.clemente.io:443"]).ToNot(Equal(oldClient))
+			Expect(oldClient.closed).To(BeFalse())
+		})
+
+		It("dials a new connection if the request that dialed the connection was canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			var numDials int
+			dialAddr = func(ctx context.Context, _ string, _ *tls.Config, _ *quic.Config) (quic.Session, error) {
+				numDials++
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				return &mockSession{streamOpenErr: streamOpenErr}, nil
+			}
+			_, err := rt.RoundTrip(req1.WithContext(ctx))
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(rt.clients).To(BeEmpty())
+			_, err = rt.RoundTrip(req1)
+			Expect(err).To(MatchError(streamOpenErr))
+			Expect(numDials).To(Equal(2))
+			Expect(rt.clients).To(HaveLen(1))
+		})
+
 		It("doesn't create new clients if RoundTripOpt.OnlyCachedConn is set", func() {
 			req, err := http.NewRequest("GET", "https://quic.clemente.io/foobar.html", nil)
 			Expect(err).ToNot(HaveOccurred())
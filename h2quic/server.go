@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"runtime"
@@ -29,6 +30,72 @@ type remoteCloser interface {
 	CloseRemote(protocol.ByteCount)
 }
 
+// A serverSession is a session handled by the Server.
+// It keeps track of the running requests, so that the headers stream can be closed
+// as soon as all requests have completed when the server is closed gracefully.
+type serverSession struct {
+	streamCreator
+
+	headerStream      quic.Stream
+	headerStreamMutex sync.Mutex // Protects concurrent calls to Write()
+
+	mutex              sync.Mutex
+	runningRequests    int
+	goingAway          bool
+	headerStreamClosed bool
+}
+
+func newServerSession(sess streamCreator, headerStream quic.Stream) *serverSession {
+	return &serverSession{
+		streamCreator: sess,
+		headerStream:  headerStream,
+	}
+}
+
+// startRequest must be called before a request is handled.
+// It returns false if the headers stream was already closed, so that no response can be sent.
+func (s *serverSession) startRequest() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.headerStreamClosed {
+		return false
+	}
+	s.runningRequests++
+	return true
+}
+
+func (s *serverSession) finishRequest() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.runningRequests--
+	s.maybeCloseHeaderStream()
+}
+
+// goAway closes the headers stream as soon as all running requests have completed.
+func (s *serverSession) goAway() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.goingAway = true
+	s.maybeCloseHeaderStream()
+}
+
+func (s *serverSession) isHeaderStreamClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.headerStreamClosed
+}
+
+// must be called with the mutex held
+func (s *serverSession) maybeCloseHeaderStream() {
+	if !s.goingAway || s.runningRequests > 0 || s.headerStreamClosed {
+		return
+	}
+	s.headerStreamClosed = true
+	s.headerStreamMutex.Lock()
+	s.headerStream.Close()
+	s.headerStreamMutex.Unlock()
+}
+
 // allows mocking of quic.Listen and quic.ListenAddr
 var (
 	quicListen     = quic.Listen
@@ -51,6 +118,7 @@ type Server struct {
 	listenerMutex sync.Mutex
 	listener      quic.Listener
 	closed        bool
+	sessions      map[*serverSession]struct{}
 
 	supportedVersionsAsString string
 
@@ -134,9 +202,16 @@ func (s *Server) handleHeaderStream(session streamCreator) {
 	hpackDecoder := hpack.NewDecoder(4096, nil)
 	h2framer := http2.NewFramer(nil, stream)
 
-	var headerStreamMutex sync.Mutex // Protects concurrent calls to Write()
+	sess := newServerSession(session, stream)
+	s.addSession(sess)
+	defer s.removeSession(sess)
 	for {
-		if err := s.handleRequest(session, stream, &headerStreamMutex, hpackDecoder, h2framer); err != nil {
+		if err := s.handleRequest(sess, hpackDecoder, h2framer); err != nil {
+			if err == io.EOF {
+				// The client closed the headers stream, after the server closed it when shutting down gracefully.
+				// The session is closed as soon as all streams have completed.
+				return
+			}
 			// QuicErrors must originate from stream.Read() returning an error.
 			// In this case, the session has already logged the error, so we don't
 			// need to log it again.
@@ -149,9 +224,32 @@ func (s *Server) handleHeaderStream(session streamCreator) {
 	}
 }
 
-func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream, headerStreamMutex *sync.Mutex, hpackDecoder *hpack.Decoder, h2framer *http2.Framer) error {
+func (s *Server) addSession(sess *serverSession) {
+	s.listenerMutex.Lock()
+	if s.sessions == nil {
+		s.sessions = make(map[*serverSession]struct{})
+	}
+	s.sessions[sess] = struct{}{}
+	closed := s.closed
+	s.listenerMutex.Unlock()
+
+	if closed {
+		sess.goAway()
+	}
+}
+
+func (s *Server) removeSession(sess *serverSession) {
+	s.listenerMutex.Lock()
+	delete(s.sessions, sess)
+	s.listenerMutex.Unlock()
+}
+
+func (s *Server) handleRequest(session *serverSession, hpackDecoder *hpack.Decoder, h2framer *http2.Framer) error {
 	h2frame, err := h2framer.ReadFrame()
 	if err != nil {
+		if err == io.EOF && session.isHeaderStreamClosed() {
+			return io.EOF
+		}
 		return qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")
 	}
 	var h2headersFrame *http2.HeadersFrame
@@ -194,11 +292,20 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 	if dataStream == nil {
 		return nil
 	}
+	if !session.startRequest() {
+		// The server is shutting down, and the headers stream was already closed.
+		s.logger.Debugf("Refusing request on data stream %d. The server is shutting down.", h2headersFrame.StreamID)
+		dataStream.CancelRead(quic.ErrorCode(http2.ErrCodeRefusedStream))
+		dataStream.CancelWrite(quic.ErrorCode(http2.ErrCodeRefusedStream))
+		return nil
+	}
 
 	// handleRequest should be as non-blocking as possible to minimize
 	// head-of-line blocking. Potentially blocking code is run in a separate
 	// goroutine, enabling handleRequest to return before the code is executed.
 	go func() {
+		defer session.finishRequest()
+
 		streamEnded := h2headersFrame.StreamEnded()
 		if streamEnded {
 			dataStream.(remoteCloser).CloseRemote(0)
@@ -220,7 +327,7 @@ func (s *Server) handleRequest(session streamCreator, headerStream quic.Stream,
 			Version:           0x0304,
 		}
 
-		responseWriter := newResponseWriter(headerStream, headerStreamMutex, dataStream, protocol.StreamID(h2headersFrame.StreamID), s.logger)
+		responseWriter := newResponseWriter(session.headerStream, &session.headerStreamMutex, dataStream, protocol.StreamID(h2headersFrame.StreamID), s.logger)
 
 		handler := s.Handler
 		if handler == nil {
@@ -278,8 +385,25 @@ func (s *Server) Close() error {
 // CloseGracefully shuts down the server gracefully. The server sends a GOAWAY frame first, then waits for either timeout to trigger, or for all running requests to complete.
 // CloseGracefully in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) CloseGracefully(timeout time.Duration) error {
-	// TODO: implement
-	return nil
+	s.listenerMutex.Lock()
+	s.closed = true
+	ln := s.listener
+	s.listener = nil
+	sessions := make([]*serverSession, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.listenerMutex.Unlock()
+
+	// Once all requests on a session have completed, the headers stream is closed.
+	// The QUIC session is then closed as soon as the client closed the headers stream as well.
+	for _, sess := range sessions {
+		sess.goAway()
+	}
+	if ln == nil {
+		return nil
+	}
+	return ln.CloseGracefully(timeout)
 }
 
 // SetQuicHeaders can be used to set the proper headers that announce that this server supports QUIC.
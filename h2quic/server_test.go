@@ -10,7 +10,6 @@ import (
 	"net"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
 	"golang.org/x/net/http2"
@@ -71,7 +70,7 @@ func (s *mockSession) Close(e error) error {
 	return nil
 }
 func (s *mockSession) LocalAddr() net.Addr {
-	panic("not implemented")
+	return &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 1337}
 }
 func (s *mockSession) RemoteAddr() net.Addr {
 	return &net.UDPAddr{IP: []byte{127, 0, 0, 1}, Port: 42}
@@ -79,10 +78,27 @@ func (s *mockSession) RemoteAddr() net.Addr {
 func (s *mockSession) Context() context.Context {
 	return s.ctx
 }
-func (s *mockSession) ConnectionState() quic.ConnectionState        { panic("not implemented") }
+func (s *mockSession) CloseGracefully(time.Duration) error          { panic("not implemented") }
+func (s *mockSession) ConnectionState() quic.ConnectionState        { return quic.ConnectionState{} }
+func (s *mockSession) ConnectionStats() quic.ConnectionStats        { panic("not implemented") }
 func (s *mockSession) AcceptUniStream() (quic.ReceiveStream, error) { panic("not implemented") }
 func (s *mockSession) OpenUniStream() (quic.SendStream, error)      { panic("not implemented") }
 func (s *mockSession) OpenUniStreamSync() (quic.SendStream, error)  { panic("not implemented") }
+func (s *mockSession) SendMessage([]byte) error                     { panic("not implemented") }
+func (s *mockSession) ReceiveMessage() ([]byte, error)              { panic("not implemented") }
+func (s *mockSession) MigrateTo(net.PacketConn) error               { panic("not implemented") }
+
+type mockListener struct {
+	closeGracefullyTimeout time.Duration
+}
+
+func (l *mockListener) Close() error                  { panic("not implemented") }
+func (l *mockListener) Addr() net.Addr                { panic("not implemented") }
+func (l *mockListener) Accept() (quic.Session, error) { panic("not implemented") }
+func (l *mockListener) CloseGracefully(timeout time.Duration) error {
+	l.closeGracefullyTimeout = timeout
+	return nil
+}
 
 var _ = Describe("H2 server", func() {
 	var (
@@ -137,7 +153,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
@@ -151,7 +167,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
@@ -167,13 +183,67 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() []byte {
 				return headerStream.dataWritten.Bytes()
 			}).Should(Equal([]byte{0x0, 0x0, 0x1, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5, 0x8e})) // 0x82 is 500
 		})
 
+		Context("shutting down gracefully", func() {
+			BeforeEach(func() {
+				headerStream = newMockStream(3)
+				h2framer = http2.NewFramer(nil, headerStream)
+				headerStream.dataToRead.Write([]byte{
+					0x0, 0x0, 0x11, 0x1, 0x5, 0x0, 0x0, 0x0, 0x5,
+					// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
+					0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
+				})
+			})
+
+			It("closes the header stream when all requests have completed", func() {
+				unblock := make(chan struct{})
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-unblock })
+				sess := newServerSession(session, headerStream)
+				err := s.handleRequest(sess, hpackDecoder, h2framer)
+				Expect(err).NotTo(HaveOccurred())
+				sess.goAway()
+				Consistently(func() bool { return headerStream.closed }).Should(BeFalse())
+				close(unblock)
+				Eventually(func() bool { return headerStream.closed }).Should(BeTrue())
+				Expect(headerStream.dataWritten.Bytes()).To(Equal([]byte{0x0, 0x0, 0x1, 0x1, 0x4, 0x0, 0x0, 0x0, 0x5, 0x88})) // 0x88 is 200
+			})
+
+			It("closes the header stream immediately if no requests are running", func() {
+				sess := newServerSession(session, headerStream)
+				sess.goAway()
+				Expect(headerStream.closed).To(BeTrue())
+			})
+
+			It("refuses requests after the header stream was closed", func() {
+				var handlerCalled bool
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					handlerCalled = true
+				})
+				sess := newServerSession(session, headerStream)
+				sess.goAway()
+				err := s.handleRequest(sess, hpackDecoder, h2framer)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(dataStream.reset).To(BeTrue())
+				Expect(dataStream.canceledWrite).To(BeTrue())
+				Consistently(func() bool { return handlerCalled }).Should(BeFalse())
+			})
+
+			It("returns io.EOF when the client closes the header stream after the server closed it", func() {
+				str := newMockStream(3)
+				close(str.unblockRead)
+				sess := newServerSession(session, str)
+				sess.goAway()
+				err := s.handleRequest(sess, hpackDecoder, http2.NewFramer(nil, str))
+				Expect(err).To(Equal(io.EOF))
+			})
+		})
+
 		It("resets the dataStream when client sends a body in GET request", func() {
 			var handlerCalled bool
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -185,7 +255,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
@@ -200,7 +270,7 @@ var _ = Describe("H2 server", func() {
 				handlerCalled = true
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
@@ -218,7 +288,7 @@ var _ = Describe("H2 server", func() {
 				// Taken from https://http2.github.io/http2-spec/compression.html#request.examples.with.huffman.coding
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Consistently(func() bool { return handlerCalled }).Should(BeFalse())
 		})
@@ -233,7 +303,7 @@ var _ = Describe("H2 server", func() {
 				handlerCalled = true
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return dataStream.reset }).Should(BeTrue())
 			Consistently(func() bool { return dataStream.remoteClosed }).Should(BeFalse())
@@ -253,7 +323,7 @@ var _ = Describe("H2 server", func() {
 			})
 			headerStream.dataToRead.Write([]byte{0x0, 0x0, 0x20, 0x1, 0x24, 0x0, 0x0, 0x0, 0x5, 0x0, 0x0, 0x0, 0x0, 0xff, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff, 0x83, 0x84, 0x87, 0x5c, 0x1, 0x37, 0x7a, 0x85, 0xed, 0x69, 0x88, 0xb4, 0xc7})
 			dataStream.dataToRead.Write([]byte("foo=bar"))
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.reset).To(BeFalse())
@@ -270,7 +340,7 @@ var _ = Describe("H2 server", func() {
 			Expect(err).ToNot(HaveOccurred())
 			Expect(buf.Bytes()).ToNot(BeEmpty())
 			headerStream.dataToRead.Write(buf.Bytes())
-			err = s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err = s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).ToNot(HaveOccurred())
 			Consistently(handlerCalled).ShouldNot(BeClosed())
 			Expect(dataStream.reset).To(BeFalse())
@@ -282,7 +352,7 @@ var _ = Describe("H2 server", func() {
 				0x0, 0x0, 0x06, 0x0, 0x0, 0x0, 0x0, 0x0, 0x5,
 				'f', 'o', 'o', 'b', 'a', 'r',
 			})
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).To(MatchError("InvalidHeadersStreamData: expected a header frame"))
 		})
 
@@ -301,7 +371,7 @@ var _ = Describe("H2 server", func() {
 				0x82, 0x86, 0x84, 0x41, 0x8c, 0xf1, 0xe3, 0xc2, 0xe5, 0xf2, 0x3a, 0x6b, 0xa0, 0xab, 0x90, 0xf4, 0xff,
 			})
 			dataStream.Close()
-			err := s.handleRequest(session, headerStream, &sync.Mutex{}, hpackDecoder, h2framer)
+			err := s.handleRequest(newServerSession(session, headerStream), hpackDecoder, h2framer)
 			Expect(err).NotTo(HaveOccurred())
 			Eventually(func() bool { return handlerCalled }).Should(BeTrue())
 			Expect(dataStream.remoteClosed).To(BeTrue())
@@ -340,6 +410,27 @@ var _ = Describe("H2 server", func() {
 		Expect(session.closedWithError).To(MatchError(qerr.Error(qerr.HeadersStreamDataDecompressFailure, "cannot read frame")))
 	})
 
+	It("doesn't close the session when the client closes the header stream after a graceful shutdown", func() {
+		headerStream := newMockStream(3)
+		session.streamToAccept = headerStream
+		done := make(chan struct{})
+		go func() {
+			s.handleHeaderStream(session)
+			close(done)
+		}()
+		Eventually(func() int {
+			s.listenerMutex.Lock()
+			defer s.listenerMutex.Unlock()
+			return len(s.sessions)
+		}).Should(Equal(1))
+		Expect(s.CloseGracefully(0)).To(Succeed())
+		Expect(headerStream.closed).To(BeTrue())
+		close(headerStream.unblockRead)
+		Eventually(done).Should(BeClosed())
+		Expect(session.closed).To(BeFalse())
+		Expect(s.sessions).To(BeEmpty())
+	})
+
 	It("supports closing after first request", func() {
 		s.CloseAfterFirstRequest = true
 		s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
@@ -521,6 +612,15 @@ var _ = Describe("H2 server", func() {
 		Expect(err).NotTo(HaveOccurred())
 	})
 
+	It("closes the listener gracefully", func() {
+		ln := &mockListener{}
+		s.listener = ln
+		Expect(s.CloseGracefully(time.Second)).To(Succeed())
+		Expect(ln.closeGracefullyTimeout).To(Equal(time.Second))
+		Expect(s.listener).To(BeNil())
+		Expect(s.closed).To(BeTrue())
+	})
+
 	It("errors when listening fails", func() {
 		testErr := errors.New("listen error")
 		quicListenAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (quic.Listener, error) {
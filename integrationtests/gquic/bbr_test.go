@@ -0,0 +1,136 @@
+package gquic_test
+
+import (
+	"bytes"
+	"fmt"
+	mrand "math/rand"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	_ "github.com/lucas-clemente/quic-clients" // download clients
+	quic "github.com/wangjiezhe/quic-go"
+	"github.com/wangjiezhe/quic-go/integrationtests/tools/proxy"
+	"github.com/wangjiezhe/quic-go/integrationtests/tools/testserver"
+	"github.com/wangjiezhe/quic-go/internal/congestion"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gexec"
+)
+
+// A bbrRecorder records the bandwidth estimate of the BBR sender it wraps, every time a packet is acknowledged.
+type bbrRecorder struct {
+	quic.CongestionController
+
+	mutex             sync.Mutex
+	numAcked          int
+	bandwidthEstimate congestion.Bandwidth
+}
+
+func (r *bbrRecorder) OnPacketAcked(number protocol.PacketNumber, ackedBytes, priorInFlight protocol.ByteCount, eventTime time.Time) {
+	r.CongestionController.OnPacketAcked(number, ackedBytes, priorInFlight, eventTime)
+	r.mutex.Lock()
+	r.numAcked++
+	r.bandwidthEstimate = r.CongestionController.(interface{ BandwidthEstimate() congestion.Bandwidth }).BandwidthEstimate()
+	r.mutex.Unlock()
+}
+
+// The server uses BBR for congestion control.
+var _ = Describe("BBR", func() {
+	var (
+		proxy *quicproxy.QuicProxy
+
+		recordersMutex sync.Mutex
+		recorders      []*bbrRecorder
+	)
+
+	BeforeEach(func() {
+		recorders = nil
+		serverConfig = &quic.Config{
+			CongestionControl: func(rttStats quic.RTTStats) quic.CongestionController {
+				r := &bbrRecorder{CongestionController: quic.NewBBRCongestionControl(rttStats)}
+				recordersMutex.Lock()
+				recorders = append(recorders, r)
+				recordersMutex.Unlock()
+				return r
+			},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(proxy.Close()).To(Succeed())
+	})
+
+	// checkBBRUsed checks that the file was sent by a session that used BBR, and that BBR estimated the bandwidth
+	checkBBRUsed := func() {
+		recordersMutex.Lock()
+		defer recordersMutex.Unlock()
+		Expect(recorders).ToNot(BeEmpty())
+		var numAcked int
+		for _, r := range recorders {
+			r.mutex.Lock()
+			if r.numAcked > 0 {
+				Expect(r.bandwidthEstimate).ToNot(BeZero())
+			}
+			numAcked += r.numAcked
+			r.mutex.Unlock()
+		}
+		Expect(numAcked).ToNot(BeZero())
+	}
+
+	startProxy := func(version protocol.VersionNumber, rtt time.Duration, dropCallback quicproxy.DropCallback) {
+		var err error
+		proxy, err = quicproxy.NewQuicProxy("localhost:0", version, &quicproxy.Opts{
+			RemoteAddr: "localhost:" + testserver.Port(),
+			DelayPacket: func(_ quicproxy.Direction, _ uint64) time.Duration {
+				return rtt / 2
+			},
+			DropPacket: dropCallback,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	downloadFile := func(version protocol.VersionNumber) {
+		command := exec.Command(
+			clientPath,
+			"--quic-version="+version.ToAltSvc(),
+			"--host=127.0.0.1",
+			"--port="+strconv.Itoa(proxy.LocalPort()),
+			"https://quic.clemente.io/prdata",
+		)
+		session, err := Start(command, nil, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+		defer session.Kill()
+		Eventually(session, 20).Should(Exit(0))
+		Expect(bytes.Contains(session.Out.Contents(), testserver.PRData)).To(BeTrue())
+		checkBBRUsed()
+	}
+
+	for _, v := range protocol.SupportedVersions {
+		version := v
+
+		Context(fmt.Sprintf("with QUIC version %s", version), func() {
+			It("downloads a file with 100ms RTT", func() {
+				startProxy(version, 100*time.Millisecond, nil)
+				downloadFile(version)
+			})
+
+			It("downloads a file with 50ms RTT, when every 20th packet sent by the server is dropped", func() {
+				startProxy(version, 50*time.Millisecond, func(d quicproxy.Direction, p uint64) bool {
+					return p >= 10 && d.Is(quicproxy.DirectionOutgoing) && p%20 == 0
+				})
+				downloadFile(version)
+			})
+
+			It("downloads a file with 50ms RTT, when 1/10th of the packets are dropped randomly in both directions", func() {
+				startProxy(version, 50*time.Millisecond, func(d quicproxy.Direction, p uint64) bool {
+					return p >= 10 && mrand.Int63n(10) == 0
+				})
+				downloadFile(version)
+			})
+		})
+	}
+})
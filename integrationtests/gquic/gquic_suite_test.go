@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"runtime"
 
+	quic "github.com/wangjiezhe/quic-go"
 	_ "github.com/wangjiezhe/quic-go/integrationtests/tools/testlog"
 	"github.com/wangjiezhe/quic-go/integrationtests/tools/testserver"
 
@@ -18,6 +19,10 @@ import (
 var (
 	clientPath string
 	serverPath string
+
+	// serverConfig is the quic.Config used by the server.
+	// It can be set in a BeforeEach.
+	serverConfig *quic.Config
 )
 
 func TestIntegration(t *testing.T) {
@@ -30,10 +35,17 @@ var _ = BeforeSuite(func() {
 })
 
 var _ = JustBeforeEach(func() {
+	if serverConfig != nil {
+		testserver.StartQuicServerWithConfig(serverConfig)
+		return
+	}
 	testserver.StartQuicServer(nil)
 })
 
-var _ = AfterEach(testserver.StopQuicServer)
+var _ = AfterEach(func() {
+	testserver.StopQuicServer()
+	serverConfig = nil
+})
 
 func init() {
 	_, thisfile, _, ok := runtime.Caller(0)
@@ -83,13 +83,16 @@ func GeneratePRData(l int) []byte {
 // StartQuicServer starts a h2quic.Server.
 // versions is a slice of supported QUIC versions. It may be nil, then all supported versions are used.
 func StartQuicServer(versions []protocol.VersionNumber) {
+	StartQuicServerWithConfig(&quic.Config{Versions: versions})
+}
+
+// StartQuicServerWithConfig starts a h2quic.Server using the given quic.Config.
+func StartQuicServerWithConfig(config *quic.Config) {
 	server = &h2quic.Server{
 		Server: &http.Server{
 			TLSConfig: testdata.GetTLSConfig(),
 		},
-		QuicConfig: &quic.Config{
-			Versions: versions,
-		},
+		QuicConfig: config,
 	}
 
 	addr, err := net.ResolveUDPAddr("udp", "0.0.0.0:0")
@@ -6,8 +6,10 @@ import (
 	"net"
 	"time"
 
+	"github.com/wangjiezhe/quic-go/internal/ackhandler"
 	"github.com/wangjiezhe/quic-go/internal/handshake"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/wire"
 )
 
 // The StreamID is the ID of a QUIC stream.
@@ -25,9 +27,59 @@ type Cookie = handshake.Cookie
 // ConnectionState records basic details about the QUIC connection.
 type ConnectionState = handshake.ConnectionState
 
+// ClientHelloInfo contains information about a new connection attempt, see Config.AcceptConnection.
+type ClientHelloInfo struct {
+	// Version is the QUIC version used by the client.
+	Version VersionNumber
+	// ConnectionID is the connection ID chosen by the client.
+	ConnectionID ConnectionID
+}
+
+// A ClientConfigCache stores the server configs received by a gQUIC client,
+// allowing it to send a full CHLO in the first round trip when connecting to the server again.
+// The hostname is the server name. It is called concurrently from multiple connections.
+type ClientConfigCache = handshake.ClientConfigCache
+
+// A CachedServerConfig contains the values stored in a ClientConfigCache for a server.
+type CachedServerConfig = handshake.CachedServerConfig
+
 // An ErrorCode is an application-defined error code.
 type ErrorCode = protocol.ApplicationErrorCode
 
+// A ConnectionID is a QUIC connection ID.
+type ConnectionID = protocol.ConnectionID
+
+// A PacketNumber is a QUIC packet number.
+type PacketNumber = protocol.PacketNumber
+
+// A ByteCount is a number of bytes.
+type ByteCount = protocol.ByteCount
+
+// The PacketType is the type of a packet with an IETF QUIC long header.
+type PacketType = protocol.PacketType
+
+// A Frame is a QUIC frame.
+type Frame = wire.Frame
+
+// The Perspective determines if we're acting as a server or a client.
+type Perspective = protocol.Perspective
+
+// the perspectives
+const (
+	PerspectiveServer = protocol.PerspectiveServer
+	PerspectiveClient = protocol.PerspectiveClient
+)
+
+// The EncryptionLevel is the encryption level of a packet.
+type EncryptionLevel = protocol.EncryptionLevel
+
+// the encryption levels
+const (
+	EncryptionUnencrypted   = protocol.EncryptionUnencrypted
+	EncryptionSecure        = protocol.EncryptionSecure
+	EncryptionForwardSecure = protocol.EncryptionForwardSecure
+)
+
 // Stream is the interface implemented by QUIC streams
 type Stream interface {
 	// StreamID returns the stream ID.
@@ -72,6 +124,9 @@ type Stream interface {
 	// some of the data was successfully written.
 	// A zero value for t means Write will not time out.
 	SetWriteDeadline(t time.Time) error
+	// SetPriority sets the priority of the stream.
+	// It determines the order in which data is sent on the streams of a session, see Priority.
+	SetPriority(Priority)
 	// SetDeadline sets the read and write deadlines associated
 	// with the connection. It is equivalent to calling both
 	// SetReadDeadline and SetWriteDeadline.
@@ -108,6 +163,27 @@ type SendStream interface {
 	Context() context.Context
 	// see Stream.SetWriteDeadline
 	SetWriteDeadline(t time.Time) error
+	// see Stream.SetPriority
+	SetPriority(Priority)
+}
+
+// MaxUrgency is the lowest urgency a stream can have.
+const MaxUrgency = 7
+
+// A Priority is the priority of a stream.
+// Data is sent on the streams with the lowest urgency first.
+// Among the streams with the same urgency, non-incremental streams are served first, one after the other, in the order of their stream IDs.
+// Incremental streams share the remaining bandwidth according to their weights.
+// By default, streams have an urgency of 3, are incremental and have a weight of 1, such that all streams share the bandwidth equally.
+type Priority struct {
+	// Urgency is the urgency, between 0 (the highest priority) and MaxUrgency (the lowest priority).
+	Urgency uint8
+	// Incremental is set if the data of this stream is useful to the receiver before the stream is complete.
+	Incremental bool
+	// Weight is the share of the bandwidth of an incremental stream, relative to the other incremental streams of the same urgency.
+	// Incremental streams are served round-robin, and in every round, a stream sends up to Weight STREAM frames.
+	// A weight of 0 is treated like a weight of 1.
+	Weight uint8
 }
 
 // StreamError is returned by Read and Write when the peer cancels the stream.
@@ -145,12 +221,81 @@ type Session interface {
 	RemoteAddr() net.Addr
 	// Close closes the connection. The error will be sent to the remote peer in a CONNECTION_CLOSE frame. An error value of nil is allowed and will cause a normal PeerGoingAway to be sent.
 	Close(error) error
+	// CloseGracefully closes the connection once all streams have completed.
+	// For gQUIC, a GOAWAY frame is sent, after which the peer won't open any new streams.
+	// Streams that the peer opens after receiving the GOAWAY frame are reset.
+	// For IETF QUIC, the stream limits are not raised any more, so the peer can only open streams up to the current limit.
+	// When the timeout elapses before all streams have completed, the connection is closed immediately.
+	// It blocks until the connection is closed.
+	CloseGracefully(timeout time.Duration) error
 	// The context is cancelled when the session is closed.
 	// Warning: This API should not be considered stable and might change soon.
 	Context() context.Context
 	// ConnectionState returns basic details about the QUIC connection.
 	// Warning: This API should not be considered stable and might change soon.
 	ConnectionState() ConnectionState
+	// ConnectionStats returns a snapshot of the transport statistics of the connection.
+	// Warning: This API should not be considered stable and might change soon.
+	ConnectionStats() ConnectionStats
+	// SendMessage sends a message as an unreliable DATAGRAM frame.
+	// DATAGRAM frames are congestion controlled, but they are never retransmitted.
+	// It is only available if both peers enabled DATAGRAM support, see Config.EnableDatagrams.
+	// Warning: This API should not be considered stable and might change soon.
+	SendMessage([]byte) error
+	// ReceiveMessage gets a message received in a DATAGRAM frame.
+	// It blocks until a message is received.
+	// Warning: This API should not be considered stable and might change soon.
+	ReceiveMessage() ([]byte, error)
+	// MigrateTo migrates the connection to a new net.PacketConn, e.g. when switching from Wi-Fi to a cellular network.
+	// The new path is validated using PATH_CHALLENGE frames before it is used.
+	// It blocks until the path validation succeeded or failed. If it fails, the connection continues to use the old path.
+	// The new net.PacketConn is not closed. When the path validation fails, quic-go stops reading from it.
+	// The old net.PacketConn is not closed. It continues to be read from, since packets might still arrive on the old path.
+	// It is only supported by IETF QUIC clients, after the handshake completed.
+	// Warning: This API should not be considered stable and might change soon.
+	MigrateTo(net.PacketConn) error
+}
+
+// An EarlySession is a session that can be used before the handshake completes.
+// When resuming a session, data is sent as 0-RTT data.
+// If the server rejects 0-RTT, this data is retransmitted after the handshake completed.
+// ConnectionState().Used0RTT reports whether 0-RTT was accepted, once the handshake completed.
+type EarlySession interface {
+	Session
+	// HandshakeComplete returns a context that is cancelled when the handshake completes,
+	// or when the session is closed before that.
+	HandshakeComplete() context.Context
+}
+
+// ConnectionStats contains statistics about a QUIC connection.
+type ConnectionStats struct {
+	// MinRTT is the minimum RTT observed during the lifetime of the connection.
+	MinRTT time.Duration
+	// SmoothedRTT is the exponentially weighted moving average of the RTT.
+	SmoothedRTT time.Duration
+	// LatestRTT is the most recent RTT sample.
+	LatestRTT time.Duration
+
+	// CongestionWindow is the current congestion window, in bytes.
+	CongestionWindow uint64
+	// BandwidthEstimate is the bandwidth estimate of the congestion controller, in bits per second.
+	BandwidthEstimate uint64
+	// BytesInFlight is the number of bytes sent, but not yet acknowledged or declared lost.
+	BytesInFlight uint64
+
+	// PacketsSent is the number of packets sent, including retransmissions.
+	PacketsSent uint64
+	// PacketsReceived is the number of packets received that were successfully decrypted.
+	PacketsReceived uint64
+	// PacketsLost is the number of packets that were declared lost.
+	PacketsLost uint64
+	// PacketsRetransmitted is the number of packets sent as retransmissions.
+	PacketsRetransmitted uint64
+
+	// ConnectionFlowControlBlocked is the number of times sending was blocked by connection-level flow control.
+	ConnectionFlowControlBlocked uint64
+	// StreamFlowControlBlocked is the number of times sending was blocked by stream-level flow control.
+	StreamFlowControlBlocked uint64
 }
 
 // Config contains all configuration data needed for a QUIC server or client.
@@ -175,8 +320,31 @@ type Config struct {
 	// AcceptCookie determines if a Cookie is accepted.
 	// It is called with cookie = nil if the client didn't send an Cookie.
 	// If not set, it verifies that the address matches, and that the Cookie was issued within the last 24 hours.
+	// For IETF QUIC, the server sends a Retry packet if the Cookie is not accepted, and only creates a session once the client returned a valid Cookie.
 	// This option is only valid for the server.
 	AcceptCookie func(clientAddr net.Addr, cookie *Cookie) bool
+	// AcceptConnection determines if a new connection is accepted.
+	// It is called before a session is created for the connection, and before the limits on new connections are checked.
+	// For IETF QUIC, it is only called once the client's address was validated using AcceptCookie.
+	// A rejected connection is closed with a CONNECTION_CLOSE.
+	// It is called concurrently, and should return quickly.
+	// If not set, all connections are accepted.
+	// This option is only valid for the server.
+	AcceptConnection func(remoteAddr net.Addr, info *ClientHelloInfo) bool
+	// MaxIncomingConnections is the maximum number of concurrent connections that the server accepts.
+	// If not set, the number of connections is not limited.
+	// This option is only valid for the server.
+	MaxIncomingConnections int
+	// MaxHandshakesPerIP is the maximum number of handshakes that can be in progress at the same time for a single IP address.
+	// If not set, the number of handshakes is not limited.
+	// For gQUIC, the limit is applied before the client's address is validated. An attacker spoofing the address of a client can use up that client's handshakes.
+	// This option is only valid for the server.
+	MaxHandshakesPerIP int
+	// MaxConnectionRate is the maximum number of new connections per second that the server accepts.
+	// Bursts of up to MaxConnectionRate connections are allowed.
+	// If not set, the rate of new connections is not limited.
+	// This option is only valid for the server.
+	MaxConnectionRate int
 	// MaxReceiveStreamFlowControlWindow is the maximum stream-level flow control window for receiving data.
 	// If this value is zero, it will default to 1 MB for the server and 6 MB for the client.
 	MaxReceiveStreamFlowControlWindow uint64
@@ -194,14 +362,233 @@ type Config struct {
 	// If set to a negative value, it doesn't allow any unidirectional streams.
 	// Values larger than 65535 (math.MaxUint16) are invalid.
 	MaxIncomingUniStreams int
+	// ConnectionIDLength is the length of the connection IDs chosen by this endpoint, in bytes.
+	// Valid values are between 4 and 18. If not set, 8 byte connection IDs are used.
+	// If set to a negative value, zero-length connection IDs are used.
+	// Zero-length connection IDs can only be used by clients, and only make sense for clients that don't share their socket with other connections.
+	// A server uses this length for the connection IDs it issues, and to parse the Short Header packets it receives.
+	// Listening fails if the length is not valid for a server.
+	// This value doesn't have any effect in Google QUIC, which always uses 8 byte connection IDs.
+	ConnectionIDLength int
+	// ConnectionIDGenerator generates the connection IDs chosen by this endpoint.
+	// If set, ConnectionIDLength is ignored, and the length returned by the ConnectionIDGenerator is used instead.
+	// If not set, random connection IDs are generated.
+	// This value doesn't have any effect in Google QUIC.
+	ConnectionIDGenerator ConnectionIDGenerator
+	// StatelessResetKey is the key used to derive the stateless reset tokens for the connection IDs chosen by this endpoint.
+	// When a server loses the state for a connection (e.g. after a restart), it uses the token to send a stateless reset,
+	// which allows the client to close the connection immediately, instead of waiting for the idle timeout.
+	// The key must be kept secret, and it must stay the same across restarts.
+	// If not set, a random key is used, and the server doesn't send any stateless resets.
+	// This value doesn't have any effect in Google QUIC.
+	StatelessResetKey []byte
 	// KeepAlive defines whether this peer will periodically send PING frames to keep the connection alive.
 	KeepAlive bool
+	// EnableDatagrams enables support for unreliable DATAGRAM frames, see Session.SendMessage.
+	// DATAGRAM frames can only be used if both peers enable them.
+	// This value doesn't have any effect in Google QUIC.
+	EnableDatagrams bool
+	// DisablePathMTUDiscovery disables Path MTU Discovery (RFC 8899).
+	// If disabled, packets are never larger than 1252 bytes (IPv4) or 1232 bytes (IPv6).
+	// If enabled, the Don't Fragment bit is set on the socket (only supported on Linux).
+	// This value doesn't have any effect in Google QUIC.
+	DisablePathMTUDiscovery bool
+	// Tracer is notified about packet-level events, and about events in loss detection and congestion control.
+	// If not set, no events are traced.
+	Tracer Tracer
+	// QlogDir is the directory that qlog files are written to, one file per connection.
+	// If not set, the directory is read from the QUIC_GO_QLOG_DIR environment variable.
+	// If neither is set, no qlog files are written.
+	QlogDir string
+	// ClientSessionCache stores the session tickets issued by servers, and uses them to resume sessions.
+	// If not set, sessions are never resumed.
+	// This option is only valid for the client, and only has an effect for IETF QUIC.
+	ClientSessionCache ClientSessionCache
+	// ClientConfigCache stores the server configs received from servers, see NewFileClientConfigCache.
+	// If not set, server configs are only used for a single connection.
+	// This option is only valid for the client, and only has an effect for gQUIC.
+	ClientConfigCache ClientConfigCache
+	// CongestionControl creates the congestion controller for a new connection.
+	// It is passed the RTT statistics of that connection, which are updated by quic-go.
+	// See NewCubicCongestionControl and NewRenoCongestionControl for the algorithms implemented by quic-go.
+	// When the connection migrates to a new path, a new congestion controller is created for that path.
+	// ECN is only used with the congestion controllers implemented by quic-go.
+	// If not set, Cubic is used.
+	CongestionControl func(RTTStats) CongestionController
+	// Allow0RTT allows clients resuming a session to send 0-RTT data.
+	// 0-RTT data can be replayed by an attacker, so this option must only be enabled
+	// if the application protocol is able to deal with that.
+	// This option is only valid for the server, and only has an effect for IETF QUIC.
+	Allow0RTT bool
+	// Max0RTTData is the maximum number of bytes of application data that a client may send in 0-RTT packets when resuming a session.
+	// It is announced in the session tickets issued by the server.
+	// 0-RTT packets exceeding this limit are dropped, and their data is retransmitted after the handshake completed.
+	// If not set, a default value of 64 KB is used.
+	// This option is only valid for the server, and only has an effect for IETF QUIC.
+	Max0RTTData ByteCount
+}
+
+// A ClientSessionCache stores the state needed to resume sessions.
+// The session key is the server name.
+// It is called concurrently from multiple connections.
+type ClientSessionCache interface {
+	// Get returns the state associated with the session key.
+	Get(sessionKey string) (*ClientSessionState, bool)
+	// Put stores the state for a session key.
+	// A nil state deletes the entry.
+	Put(sessionKey string, state *ClientSessionState)
+}
+
+// A ConnectionIDGenerator generates the connection IDs chosen by an endpoint.
+// A server can use it to encode information into its connection IDs,
+// e.g. to allow a load balancer to route packets without keeping per-connection state.
+// It is called concurrently from multiple connections.
+type ConnectionIDGenerator interface {
+	// GenerateConnectionID generates a new connection ID.
+	// Connection IDs must be unique, and should not be linkable to each other by an observer.
+	GenerateConnectionID() (ConnectionID, error)
+	// ConnectionIDLen is the length of the connection IDs generated.
+	// It must always return the same value.
+	ConnectionIDLen() int
+}
+
+// A Tracer traces events of QUIC connections.
+type Tracer interface {
+	// TracerForConnection is called for every new connection.
+	// The connection ID is the original destination connection ID, i.e. the connection ID that the client chose for its first packet.
+	// It identifies the connection on both the client and the server side.
+	// It may return nil, if this connection should not be traced.
+	TracerForConnection(p Perspective, odcid ConnectionID) ConnectionTracer
+	// DroppedPacket is called when a packet is dropped before it could be associated with a connection.
+	DroppedPacket(remoteAddr net.Addr, reason PacketDropReason, size ByteCount)
+}
+
+// A ConnectionTracer traces events of a single QUIC connection.
+// The methods are called from the connection's go routine, so they should return quickly.
+type ConnectionTracer interface {
+	// SentPacket is called when a packet is sent.
+	SentPacket(*PacketInfo)
+	// ReceivedPacket is called when a packet was successfully decrypted.
+	ReceivedPacket(*PacketInfo)
+	// DroppedPacket is called when a packet is dropped.
+	DroppedPacket(reason PacketDropReason, size ByteCount)
+	// LostPacket is called when a packet is declared lost.
+	LostPacket(encLevel EncryptionLevel, pn PacketNumber, size ByteCount)
+	// UpdatedMetrics is called every time a new RTT sample is taken.
+	UpdatedMetrics(Metrics)
+	// UpdatedCongestionState is called when the congestion controller changes its state.
+	UpdatedCongestionState(CongestionState)
+	// LossTimerExpired is called when the loss detection alarm fires.
+	LossTimerExpired(TimerType)
+	// Close is called when the connection is closed.
+	Close()
+}
+
+// PacketInfo describes a packet that was sent or received.
+type PacketInfo struct {
+	// The Type is only set for packets with an IETF QUIC long header.
+	Type             PacketType
+	DestConnectionID ConnectionID
+	SrcConnectionID  ConnectionID
+	PacketNumber     PacketNumber
+	EncryptionLevel  EncryptionLevel
+	// Size is the size of the packet, including the header.
+	Size   ByteCount
+	Frames []Frame
+	// PotentiallyDuplicate is set for received packets that might have been received before.
+	// These packets are still processed.
+	PotentiallyDuplicate bool
+}
+
+// Metrics are the RTT estimates and the state of the congestion controller.
+type Metrics = ackhandler.Metrics
+
+// A CongestionController performs congestion control for a single connection.
+// It is informed about every packet sent, acknowledged and lost, and determines
+// how many bytes may be in flight, and when the next packet may be sent.
+// The methods are called from the connection's go routine.
+type CongestionController interface {
+	// TimeUntilSend returns how long to wait before the next packet may be sent.
+	TimeUntilSend(bytesInFlight ByteCount) time.Duration
+	// OnPacketSent is called for every packet sent.
+	// bytesInFlight is the number of bytes in flight before this packet was sent.
+	OnPacketSent(sentTime time.Time, bytesInFlight ByteCount, packetNumber PacketNumber, bytes ByteCount, isRetransmittable bool)
+	// OnPacketAcked is called for every retransmittable packet acknowledged.
+	// The RTTStats are updated before the packets acknowledged by an ACK frame are passed to OnPacketAcked.
+	OnPacketAcked(packetNumber PacketNumber, ackedBytes ByteCount, priorInFlight ByteCount, eventTime time.Time)
+	// OnPacketLost is called for every retransmittable packet declared lost.
+	OnPacketLost(packetNumber PacketNumber, lostBytes ByteCount, priorInFlight ByteCount)
+	// OnRetransmissionTimeout is called when the retransmission timeout fires.
+	OnRetransmissionTimeout(packetsRetransmitted bool)
+	// GetCongestionWindow returns the congestion window.
+	GetCongestionWindow() ByteCount
+	// InSlowStart and InRecovery determine the CongestionState reported to the Tracer.
+	InSlowStart() bool
+	InRecovery() bool
+}
+
+// RTTStats are the RTT estimates of a connection.
+type RTTStats interface {
+	MinRTT() time.Duration
+	LatestRTT() time.Duration
+	SmoothedRTT() time.Duration
+	MeanDeviation() time.Duration
+}
+
+// The CongestionState is the state of the congestion controller.
+type CongestionState = ackhandler.CongestionState
+
+// the congestion states
+const (
+	CongestionStateSlowStart           = ackhandler.CongestionStateSlowStart
+	CongestionStateCongestionAvoidance = ackhandler.CongestionStateCongestionAvoidance
+	CongestionStateRecovery            = ackhandler.CongestionStateRecovery
+)
+
+// The TimerType is the mode the loss detection alarm fired in.
+type TimerType = ackhandler.TimerType
+
+// the timer types
+const (
+	TimerTypeHandshake = ackhandler.TimerTypeHandshake
+	TimerTypeLossTime  = ackhandler.TimerTypeLossTime
+	TimerTypeTLP       = ackhandler.TimerTypeTLP
+	TimerTypeRTO       = ackhandler.TimerTypeRTO
+)
+
+// A PacketDropReason is the reason why a packet was dropped.
+type PacketDropReason uint8
+
+const (
+	// PacketDropUndecryptable is used for packets that couldn't be decrypted
+	PacketDropUndecryptable PacketDropReason = 1 + iota
+	// PacketDropDuplicate is used for packets that were already received, and are discarded
+	PacketDropDuplicate
+	// PacketDropUnknownConnectionID is used for packets with a connection ID that doesn't belong to any connection
+	PacketDropUnknownConnectionID
+)
+
+func (r PacketDropReason) String() string {
+	switch r {
+	case PacketDropUndecryptable:
+		return "undecryptable"
+	case PacketDropDuplicate:
+		return "duplicate"
+	case PacketDropUnknownConnectionID:
+		return "unknown connection ID"
+	default:
+		return "unknown"
+	}
 }
 
 // A Listener for incoming QUIC connections
 type Listener interface {
 	// Close the server, sending CONNECTION_CLOSE frames to each peer.
 	Close() error
+	// CloseGracefully closes the server without interrupting active sessions.
+	// New sessions are not accepted any more, and every session is closed using Session.CloseGracefully.
+	// It blocks until all sessions are closed.
+	CloseGracefully(timeout time.Duration) error
 	// Addr returns the local network addr that the server is listening on.
 	Addr() net.Addr
 	// Accept returns new sessions. It should be called in a loop.
@@ -0,0 +1,139 @@
+package ackhandler
+
+import (
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+)
+
+// The number of packets that are marked ECT(0) before the ECN validation succeeded.
+const numECNTestingPackets = 10
+
+type ecnState uint8
+
+const (
+	// ECN is disabled for this connection
+	ecnStateDisabled ecnState = iota
+	// the first packets are sent with ECT(0)
+	ecnStateTesting
+	// all testing packets were sent, waiting for the validation to complete
+	ecnStateUnknown
+	// the validation succeeded, all packets are sent with ECT(0)
+	ecnStateCapable
+	// the validation failed, no packets are marked anymore
+	ecnStateFailed
+)
+
+// The ecnTracker validates that ECN works on a path.
+// It marks the first packets with ECT(0), and checks that the peer reports the ECN marks in its ACK frames.
+// ECN is disabled when the marks are removed on the path, or when the ECN-marked packets are dropped.
+type ecnTracker struct {
+	state ecnState
+
+	numSentTesting int
+	numLostTesting int
+
+	// the ECN counts reported in the last ACK frame
+	numAckedECT0, numAckedECT1, numAckedECNCE uint64
+
+	logger utils.Logger
+}
+
+func newECNTracker(enabled bool, logger utils.Logger) *ecnTracker {
+	state := ecnStateDisabled
+	if enabled {
+		state = ecnStateTesting
+	}
+	return &ecnTracker{
+		state:  state,
+		logger: logger,
+	}
+}
+
+// Mode returns the ECN codepoint that should be used for the next packet.
+func (e *ecnTracker) Mode() protocol.ECN {
+	switch e.state {
+	case ecnStateTesting, ecnStateCapable:
+		return protocol.ECT0
+	default:
+		return protocol.ECNNon
+	}
+}
+
+// SentPacket is called for every retransmittable packet that is sent.
+func (e *ecnTracker) SentPacket(p *Packet) {
+	if e.state != ecnStateTesting || p.ECN != protocol.ECT0 {
+		return
+	}
+	e.numSentTesting++
+	if e.numSentTesting >= numECNTestingPackets {
+		e.logger.Debugf("Sent %d ECN testing packets. Waiting for the ECN validation to complete.", e.numSentTesting)
+		e.state = ecnStateUnknown
+	}
+}
+
+// LostPacket is called for every retransmittable packet that is declared lost.
+// If all testing packets are lost, ECN is disabled, since the ECN marks might have caused the packets to be dropped.
+func (e *ecnTracker) LostPacket(p *Packet) {
+	if (e.state != ecnStateTesting && e.state != ecnStateUnknown) || p.ECN != protocol.ECT0 {
+		return
+	}
+	e.numLostTesting++
+	if e.state == ecnStateUnknown && e.numLostTesting >= e.numSentTesting {
+		e.failValidation("all ECN testing packets were lost")
+	}
+}
+
+// HandleNewlyAcked is called for every ACK frame.
+// It validates the ECN counts reported by the peer, and says if the peer received packets marked with CE.
+func (e *ecnTracker) HandleNewlyAcked(packets []*Packet, ect0, ect1, ecnce uint64) (congested bool) {
+	if e.state == ecnStateDisabled || e.state == ecnStateFailed {
+		return false
+	}
+	// The ECN counts are cumulative, so they can never decrease.
+	if ect0 < e.numAckedECT0 || ect1 < e.numAckedECT1 || ecnce < e.numAckedECNCE {
+		e.failValidation("ECN counts decreased")
+		return false
+	}
+	// We never send packets marked ECT(1).
+	if ect1 > 0 {
+		e.failValidation("peer reported ECT(1) marks")
+		return false
+	}
+	var newlyAckedECT0 uint64
+	for _, p := range packets {
+		if p.ECN == protocol.ECT0 {
+			newlyAckedECT0++
+		}
+	}
+	newECT0 := ect0 - e.numAckedECT0
+	newECNCE := ecnce - e.numAckedECNCE
+	// Every ECT(0) packet must be reported, either as ECT(0) or as CE.
+	// Otherwise, the marks were removed on the path, or the peer doesn't support ECN.
+	if newECT0+newECNCE < newlyAckedECT0 {
+		e.failValidation("ECN marks were not reported by the peer")
+		return false
+	}
+	e.numAckedECT0 = ect0
+	e.numAckedECNCE = ecnce
+	if newlyAckedECT0 > 0 && (e.state == ecnStateTesting || e.state == ecnStateUnknown) {
+		e.logger.Debugf("ECN validation succeeded.")
+		e.state = ecnStateCapable
+	}
+	return newECNCE > 0
+}
+
+// Reset restarts the ECN validation, e.g. after a connection migration.
+// The ECN counts are not reset, since the peer continues counting on the new path.
+func (e *ecnTracker) Reset() {
+	if e.state == ecnStateDisabled {
+		return
+	}
+	e.state = ecnStateTesting
+	e.numSentTesting = 0
+	e.numLostTesting = 0
+}
+
+func (e *ecnTracker) failValidation(reason string) {
+	e.logger.Infof("Disabling ECN: %s.", reason)
+	e.state = ecnStateFailed
+}
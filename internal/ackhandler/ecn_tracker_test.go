@@ -0,0 +1,125 @@
+package ackhandler
+
+import (
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ECN tracker", func() {
+	var tracker *ecnTracker
+
+	BeforeEach(func() {
+		tracker = newECNTracker(true, utils.DefaultLogger)
+	})
+
+	sendTestingPackets := func() []*Packet {
+		var packets []*Packet
+		for i := 1; i <= numECNTestingPackets; i++ {
+			Expect(tracker.Mode()).To(Equal(protocol.ECT0))
+			p := &Packet{PacketNumber: protocol.PacketNumber(i), ECN: tracker.Mode()}
+			tracker.SentPacket(p)
+			packets = append(packets, p)
+		}
+		return packets
+	}
+
+	It("doesn't mark packets if ECN is disabled", func() {
+		tracker = newECNTracker(false, utils.DefaultLogger)
+		Expect(tracker.Mode()).To(Equal(protocol.ECNNon))
+		tracker.Reset()
+		Expect(tracker.Mode()).To(Equal(protocol.ECNNon))
+	})
+
+	It("stops marking packets after sending the testing packets", func() {
+		sendTestingPackets()
+		Expect(tracker.Mode()).To(Equal(protocol.ECNNon))
+	})
+
+	It("marks all packets after the validation succeeded", func() {
+		packets := sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:3], 3, 0, 0)).To(BeFalse())
+		Expect(tracker.state).To(Equal(ecnStateCapable))
+		Expect(tracker.Mode()).To(Equal(protocol.ECT0))
+	})
+
+	It("validates ECN when packets were marked CE", func() {
+		packets := sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:3], 2, 0, 1)).To(BeTrue())
+		Expect(tracker.state).To(Equal(ecnStateCapable))
+		// no new CE marks
+		Expect(tracker.HandleNewlyAcked(packets[3:5], 4, 0, 1)).To(BeFalse())
+		Expect(tracker.HandleNewlyAcked(packets[5:6], 4, 0, 2)).To(BeTrue())
+	})
+
+	It("doesn't validate ECN if no ECT(0) packets were acknowledged", func() {
+		Expect(tracker.HandleNewlyAcked([]*Packet{{PacketNumber: 1}}, 0, 0, 0)).To(BeFalse())
+		Expect(tracker.state).To(Equal(ecnStateTesting))
+	})
+
+	It("fails the validation if the peer doesn't report the ECN marks", func() {
+		packets := sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:3], 0, 0, 0)).To(BeFalse())
+		Expect(tracker.state).To(Equal(ecnStateFailed))
+		Expect(tracker.Mode()).To(Equal(protocol.ECNNon))
+	})
+
+	It("fails the validation if the peer reports too few ECN marks", func() {
+		packets := sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:3], 2, 0, 0)).To(BeFalse())
+		Expect(tracker.state).To(Equal(ecnStateFailed))
+	})
+
+	It("fails the validation if the ECN counts decrease", func() {
+		packets := sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:3], 3, 0, 1)).To(BeTrue())
+		Expect(tracker.HandleNewlyAcked(packets[3:4], 4, 0, 0)).To(BeFalse())
+		Expect(tracker.state).To(Equal(ecnStateFailed))
+	})
+
+	It("fails the validation if the peer reports ECT(1) marks", func() {
+		packets := sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:3], 2, 1, 0)).To(BeFalse())
+		Expect(tracker.state).To(Equal(ecnStateFailed))
+	})
+
+	It("doesn't report CE marks after the validation failed", func() {
+		packets := sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:3], 0, 0, 0)).To(BeFalse())
+		Expect(tracker.HandleNewlyAcked(packets[3:5], 0, 0, 2)).To(BeFalse())
+	})
+
+	It("fails the validation if all testing packets are lost", func() {
+		packets := sendTestingPackets()
+		for _, p := range packets[:len(packets)-1] {
+			tracker.LostPacket(p)
+		}
+		Expect(tracker.state).To(Equal(ecnStateUnknown))
+		tracker.LostPacket(packets[len(packets)-1])
+		Expect(tracker.state).To(Equal(ecnStateFailed))
+	})
+
+	It("ignores lost packets after the validation succeeded", func() {
+		packets := sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:1], 1, 0, 0)).To(BeFalse())
+		for _, p := range packets[1:] {
+			tracker.LostPacket(p)
+		}
+		Expect(tracker.state).To(Equal(ecnStateCapable))
+	})
+
+	It("restarts the validation when reset, but keeps the ECN counts", func() {
+		packets := sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:3], 3, 0, 0)).To(BeFalse())
+		Expect(tracker.HandleNewlyAcked(packets[3:4], 0, 0, 0)).To(BeFalse())
+		Expect(tracker.state).To(Equal(ecnStateFailed))
+		tracker.Reset()
+		Expect(tracker.state).To(Equal(ecnStateTesting))
+		Expect(tracker.numAckedECT0).To(BeEquivalentTo(3))
+		packets = sendTestingPackets()
+		Expect(tracker.HandleNewlyAcked(packets[:2], 5, 0, 0)).To(BeFalse())
+		Expect(tracker.state).To(Equal(ecnStateCapable))
+	})
+})
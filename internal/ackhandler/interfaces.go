@@ -3,6 +3,7 @@ package ackhandler
 import (
 	"time"
 
+	"github.com/wangjiezhe/quic-go/internal/congestion"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 	"github.com/wangjiezhe/quic-go/internal/wire"
 )
@@ -14,9 +15,18 @@ type SentPacketHandler interface {
 	SentPacketsAsRetransmission(packets []*Packet, retransmissionOf protocol.PacketNumber)
 	ReceivedAck(ackFrame *wire.AckFrame, withPacketNumber protocol.PacketNumber, encLevel protocol.EncryptionLevel, recvTime time.Time) error
 	SetHandshakeComplete()
+	// Finish0RTT is called when the handshake completes, if 0-RTT packets were sent.
+	// Accepted 0-RTT packets are treated like forward-secure packets,
+	// rejected 0-RTT packets are queued for retransmission with forward-secure encryption.
+	Finish0RTT(accepted bool) error
+	// OnConnectionMigration resets the congestion controller and the RTT estimate,
+	// since they don't apply to the new path.
+	OnConnectionMigration()
 
 	// The SendMode determines if and what kind of packets can be sent.
 	SendMode() SendMode
+	// ECNMode is the ECN codepoint that the next packet should be sent with.
+	ECNMode() protocol.ECN
 	// TimeUntilSend is the time when the next packet should be sent.
 	// It is used for pacing packets.
 	TimeUntilSend() time.Time
@@ -34,11 +44,41 @@ type SentPacketHandler interface {
 
 	GetAlarmTimeout() time.Time
 	OnAlarm() error
+
+	// GetStats returns statistics about the packets sent.
+	GetStats() *SentPacketStats
+	// BytesInFlight returns the number of bytes in flight.
+	BytesInFlight() protocol.ByteCount
+}
+
+// An MTUProbeHandler is notified when an MTU probe packet is acknowledged or declared lost.
+// The size is the size of the probe packet.
+// It is also notified about all other packets, such that it can detect when packets of the current size don't arrive any more.
+type MTUProbeHandler interface {
+	MTUProbeAcked(size protocol.ByteCount)
+	MTUProbeLost(size protocol.ByteCount)
+	PacketAcked(size protocol.ByteCount)
+	PacketLost(size protocol.ByteCount)
+}
+
+// SentPacketStats are statistics about the packets sent, and the state of the congestion controller.
+type SentPacketStats struct {
+	PacketsSent          uint64
+	PacketsLost          uint64
+	PacketsRetransmitted uint64
+
+	BytesInFlight     protocol.ByteCount
+	CongestionWindow  protocol.ByteCount
+	BandwidthEstimate congestion.Bandwidth
 }
 
 // ReceivedPacketHandler handles ACKs needed to send for incoming packets
 type ReceivedPacketHandler interface {
-	ReceivedPacket(packetNumber protocol.PacketNumber, rcvTime time.Time, shouldInstigateAck bool) error
+	// ReceivedPacket is called for every packet that is received.
+	// The ECN value is the ECN codepoint of the IP header the packet was received with.
+	ReceivedPacket(packetNumber protocol.PacketNumber, ecn protocol.ECN, rcvTime time.Time, shouldInstigateAck bool) error
+	// IsPotentiallyDuplicate determines if a packet might be a duplicate of a packet that was already received.
+	IsPotentiallyDuplicate(protocol.PacketNumber) bool
 	IgnoreBelow(protocol.PacketNumber)
 
 	GetAlarmTimeout() time.Time
@@ -15,6 +15,9 @@ type Packet struct {
 	Length          protocol.ByteCount
 	EncryptionLevel protocol.EncryptionLevel
 	SendTime        time.Time
+	ECN             protocol.ECN // the ECN codepoint the packet was sent with
+	// MTU probes are never retransmitted, and losing them is not a congestion signal.
+	IsMTUProbe bool
 
 	largestAcked protocol.PacketNumber // if the packet contains an ACK, the LargestAcked value of that ACK
 
@@ -25,6 +25,9 @@ type receivedPacketHandler struct {
 	ackAlarm                                   time.Time
 	lastAck                                    *wire.AckFrame
 
+	// the number of packets received with ECN marks
+	ect0, ect1, ecnce uint64
+
 	logger utils.Logger
 
 	version protocol.VersionNumber
@@ -68,11 +71,20 @@ func NewReceivedPacketHandler(
 	}
 }
 
-func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumber, rcvTime time.Time, shouldInstigateAck bool) error {
+func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumber, ecn protocol.ECN, rcvTime time.Time, shouldInstigateAck bool) error {
 	if packetNumber < h.ignoreBelow {
 		return nil
 	}
 
+	switch ecn {
+	case protocol.ECT0:
+		h.ect0++
+	case protocol.ECT1:
+		h.ect1++
+	case protocol.ECNCE:
+		h.ecnce++
+	}
+
 	isMissing := h.isMissing(packetNumber)
 	if packetNumber > h.largestObserved {
 		h.largestObserved = packetNumber
@@ -83,9 +95,21 @@ func (h *receivedPacketHandler) ReceivedPacket(packetNumber protocol.PacketNumbe
 		return err
 	}
 	h.maybeQueueAck(packetNumber, rcvTime, shouldInstigateAck, isMissing)
+	// Report CE marks immediately, so the peer can react to the congestion quickly.
+	if ecn == protocol.ECNCE && h.version.UsesIETFFrameFormat() && !h.ackQueued {
+		h.logger.Debugf("\tQueueing ACK because packet %#x was marked CE.", packetNumber)
+		h.ackQueued = true
+		h.ackAlarm = time.Time{}
+	}
 	return nil
 }
 
+// IsPotentiallyDuplicate determines if a packet might be a duplicate.
+// Packets below the limit set by IgnoreBelow are not tracked anymore, so they are always considered potential duplicates.
+func (h *receivedPacketHandler) IsPotentiallyDuplicate(packetNumber protocol.PacketNumber) bool {
+	return packetNumber < h.ignoreBelow || h.packetHistory.IsDuplicate(packetNumber)
+}
+
 // IgnoreBelow sets a lower limit for acking packets.
 // Packets with packet numbers smaller than p will not be acked.
 func (h *receivedPacketHandler) IgnoreBelow(p protocol.PacketNumber) {
@@ -203,6 +227,12 @@ func (h *receivedPacketHandler) GetAckFrame() *wire.AckFrame {
 		AckRanges: h.packetHistory.GetAckRanges(),
 		DelayTime: now.Sub(h.largestObservedReceivedTime),
 	}
+	// ECN counts can only be sent in IETF QUIC ACK frames
+	if h.version.UsesIETFFrameFormat() {
+		ack.ECT0 = h.ect0
+		ack.ECT1 = h.ect1
+		ack.ECNCE = h.ecnce
+	}
 
 	h.lastAck = ack
 	h.ackAlarm = time.Time{}
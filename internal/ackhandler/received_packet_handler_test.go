@@ -25,16 +25,16 @@ var _ = Describe("receivedPacketHandler", func() {
 
 	Context("accepting packets", func() {
 		It("handles a packet that arrives late", func() {
-			err := handler.ReceivedPacket(protocol.PacketNumber(1), time.Time{}, true)
+			err := handler.ReceivedPacket(protocol.PacketNumber(1), protocol.ECNNon, time.Time{}, true)
 			Expect(err).ToNot(HaveOccurred())
-			err = handler.ReceivedPacket(protocol.PacketNumber(3), time.Time{}, true)
+			err = handler.ReceivedPacket(protocol.PacketNumber(3), protocol.ECNNon, time.Time{}, true)
 			Expect(err).ToNot(HaveOccurred())
-			err = handler.ReceivedPacket(protocol.PacketNumber(2), time.Time{}, true)
+			err = handler.ReceivedPacket(protocol.PacketNumber(2), protocol.ECNNon, time.Time{}, true)
 			Expect(err).ToNot(HaveOccurred())
 		})
 
 		It("saves the time when each packet arrived", func() {
-			err := handler.ReceivedPacket(protocol.PacketNumber(3), time.Now(), true)
+			err := handler.ReceivedPacket(protocol.PacketNumber(3), protocol.ECNNon, time.Now(), true)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(handler.largestObservedReceivedTime).To(BeTemporally("~", time.Now(), 10*time.Millisecond))
 		})
@@ -43,7 +43,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			now := time.Now()
 			handler.largestObserved = 3
 			handler.largestObservedReceivedTime = now.Add(-1 * time.Second)
-			err := handler.ReceivedPacket(5, now, true)
+			err := handler.ReceivedPacket(5, protocol.ECNNon, now, true)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(handler.largestObserved).To(Equal(protocol.PacketNumber(5)))
 			Expect(handler.largestObservedReceivedTime).To(Equal(now))
@@ -54,16 +54,29 @@ var _ = Describe("receivedPacketHandler", func() {
 			timestamp := now.Add(-1 * time.Second)
 			handler.largestObserved = 5
 			handler.largestObservedReceivedTime = timestamp
-			err := handler.ReceivedPacket(4, now, true)
+			err := handler.ReceivedPacket(4, protocol.ECNNon, now, true)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(handler.largestObserved).To(Equal(protocol.PacketNumber(5)))
 			Expect(handler.largestObservedReceivedTime).To(Equal(timestamp))
 		})
 
+		It("detects duplicates", func() {
+			Expect(handler.IsPotentiallyDuplicate(3)).To(BeFalse())
+			Expect(handler.ReceivedPacket(3, protocol.ECNNon, time.Time{}, true)).To(Succeed())
+			Expect(handler.IsPotentiallyDuplicate(3)).To(BeTrue())
+			Expect(handler.IsPotentiallyDuplicate(4)).To(BeFalse())
+		})
+
+		It("considers packets below the lower limit potential duplicates", func() {
+			handler.IgnoreBelow(10)
+			Expect(handler.IsPotentiallyDuplicate(9)).To(BeTrue())
+			Expect(handler.IsPotentiallyDuplicate(10)).To(BeFalse())
+		})
+
 		It("passes on errors from receivedPacketHistory", func() {
 			var err error
 			for i := protocol.PacketNumber(0); i < 5*protocol.MaxTrackedReceivedAckRanges; i++ {
-				err = handler.ReceivedPacket(2*i+1, time.Time{}, true)
+				err = handler.ReceivedPacket(2*i+1, protocol.ECNNon, time.Time{}, true)
 				// this will eventually return an error
 				// details about when exactly the receivedPacketHistory errors are tested there
 				if err != nil {
@@ -78,7 +91,7 @@ var _ = Describe("receivedPacketHandler", func() {
 		Context("queueing ACKs", func() {
 			receiveAndAck10Packets := func() {
 				for i := 1; i <= 10; i++ {
-					err := handler.ReceivedPacket(protocol.PacketNumber(i), time.Time{}, true)
+					err := handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
@@ -87,7 +100,7 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			receiveAndAckPacketsUntilAckDecimation := func() {
 				for i := 1; i <= minReceivedBeforeAckDecimation; i++ {
-					err := handler.ReceivedPacket(protocol.PacketNumber(i), time.Time{}, true)
+					err := handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
@@ -95,14 +108,14 @@ var _ = Describe("receivedPacketHandler", func() {
 			}
 
 			It("always queues an ACK for the first packet", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, false)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
 			})
 
 			It("works with packet number 0", func() {
-				err := handler.ReceivedPacket(0, time.Time{}, false)
+				err := handler.ReceivedPacket(0, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
@@ -112,11 +125,11 @@ var _ = Describe("receivedPacketHandler", func() {
 				receiveAndAck10Packets()
 				p := protocol.PacketNumber(11)
 				for i := 0; i <= 20; i++ {
-					err := handler.ReceivedPacket(p, time.Time{}, true)
+					err := handler.ReceivedPacket(p, protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(handler.ackQueued).To(BeFalse())
 					p++
-					err = handler.ReceivedPacket(p, time.Time{}, true)
+					err = handler.ReceivedPacket(p, protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(handler.ackQueued).To(BeTrue())
 					p++
@@ -129,13 +142,13 @@ var _ = Describe("receivedPacketHandler", func() {
 				receiveAndAck10Packets()
 				p := protocol.PacketNumber(10000)
 				for i := 0; i < 9; i++ {
-					err := handler.ReceivedPacket(p, time.Now(), true)
+					err := handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true)
 					Expect(err).ToNot(HaveOccurred())
 					Expect(handler.ackQueued).To(BeFalse())
 					p++
 				}
 				Expect(handler.GetAlarmTimeout()).NotTo(BeZero())
-				err := handler.ReceivedPacket(p, time.Now(), true)
+				err := handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
@@ -143,12 +156,12 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("only sets the timer when receiving a retransmittable packets", func() {
 				receiveAndAck10Packets()
-				err := handler.ReceivedPacket(11, time.Now(), false)
+				err := handler.ReceivedPacket(11, protocol.ECNNon, time.Now(), false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 				Expect(handler.GetAlarmTimeout()).To(BeZero())
 				rcvTime := time.Now().Add(10 * time.Millisecond)
-				err = handler.ReceivedPacket(12, rcvTime, true)
+				err = handler.ReceivedPacket(12, protocol.ECNNon, rcvTime, true)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 				Expect(handler.GetAlarmTimeout()).To(Equal(rcvTime.Add(ackSendDelay)))
@@ -156,15 +169,15 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("queues an ACK if it was reported missing before", func() {
 				receiveAndAck10Packets()
-				err := handler.ReceivedPacket(11, time.Time{}, true)
+				err := handler.ReceivedPacket(11, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(13, time.Time{}, true)
+				err = handler.ReceivedPacket(13, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame() // ACK: 1-11 and 13, missing: 12
 				Expect(ack).ToNot(BeNil())
 				Expect(ack.HasMissingRanges()).To(BeTrue())
 				Expect(handler.ackQueued).To(BeFalse())
-				err = handler.ReceivedPacket(12, time.Time{}, false)
+				err = handler.ReceivedPacket(12, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeTrue())
 			})
@@ -172,15 +185,15 @@ var _ = Describe("receivedPacketHandler", func() {
 			It("doesn't queue an ACK if it was reported missing before, but is below the threshold", func() {
 				receiveAndAck10Packets()
 				// 11 is missing
-				err := handler.ReceivedPacket(12, time.Time{}, true)
+				err := handler.ReceivedPacket(12, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(13, time.Time{}, true)
+				err = handler.ReceivedPacket(13, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame() // ACK: 1-10, 12-13
 				Expect(ack).ToNot(BeNil())
 				// now receive 11
 				handler.IgnoreBelow(12)
-				err = handler.ReceivedPacket(11, time.Time{}, false)
+				err = handler.ReceivedPacket(11, protocol.ECNNon, time.Time{}, false)
 				Expect(err).ToNot(HaveOccurred())
 				ack = handler.GetAckFrame()
 				Expect(ack).To(BeNil())
@@ -189,11 +202,11 @@ var _ = Describe("receivedPacketHandler", func() {
 			It("doesn't queue an ACK if the packet closes a gap that was not yet reported", func() {
 				receiveAndAckPacketsUntilAckDecimation()
 				p := protocol.PacketNumber(minReceivedBeforeAckDecimation + 1)
-				err := handler.ReceivedPacket(p+1, time.Now(), true) // p is missing now
+				err := handler.ReceivedPacket(p+1, protocol.ECNNon, time.Now(), true) // p is missing now
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 				Expect(handler.GetAlarmTimeout()).ToNot(BeZero())
-				err = handler.ReceivedPacket(p, time.Now(), true) // p is not missing any more
+				err = handler.ReceivedPacket(p, protocol.ECNNon, time.Now(), true) // p is not missing any more
 				Expect(err).ToNot(HaveOccurred())
 				Expect(handler.ackQueued).To(BeFalse())
 			})
@@ -205,10 +218,10 @@ var _ = Describe("receivedPacketHandler", func() {
 				receiveAndAckPacketsUntilAckDecimation()
 				p := protocol.PacketNumber(minReceivedBeforeAckDecimation + 1)
 				for i := p; i < p+6; i++ {
-					err := handler.ReceivedPacket(i, now, true)
+					err := handler.ReceivedPacket(i, protocol.ECNNon, now, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
-				err := handler.ReceivedPacket(p+10, now, true) // we now know that packets p+7, p+8 and p+9
+				err := handler.ReceivedPacket(p+10, protocol.ECNNon, now, true) // we now know that packets p+7, p+8 and p+9
 				Expect(err).ToNot(HaveOccurred())
 				Expect(rttStats.MinRTT()).To(Equal(rtt))
 				Expect(handler.ackAlarm.Sub(now)).To(Equal(rtt / 8))
@@ -224,9 +237,9 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates a simple ACK frame", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(2, time.Time{}, true)
+				err = handler.ReceivedPacket(2, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -236,7 +249,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK for packet number 0", func() {
-				err := handler.ReceivedPacket(0, time.Time{}, true)
+				err := handler.ReceivedPacket(0, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -246,9 +259,9 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("sets the delay time", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(2, time.Now().Add(-1337*time.Millisecond), true)
+				err = handler.ReceivedPacket(2, protocol.ECNNon, time.Now().Add(-1337*time.Millisecond), true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -256,12 +269,12 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("saves the last sent ACK", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
 				Expect(handler.lastAck).To(Equal(ack))
-				err = handler.ReceivedPacket(2, time.Time{}, true)
+				err = handler.ReceivedPacket(2, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = true
 				ack = handler.GetAckFrame()
@@ -270,9 +283,9 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK frame with missing packets", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(4, time.Time{}, true)
+				err = handler.ReceivedPacket(4, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -285,11 +298,11 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK for packet number 0 and other packets", func() {
-				err := handler.ReceivedPacket(0, time.Time{}, true)
+				err := handler.ReceivedPacket(0, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(1, time.Time{}, true)
+				err = handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(3, time.Time{}, true)
+				err = handler.ReceivedPacket(3, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -303,15 +316,15 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("accepts packets below the lower limit", func() {
 				handler.IgnoreBelow(6)
-				err := handler.ReceivedPacket(2, time.Time{}, true)
+				err := handler.ReceivedPacket(2, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 			})
 
 			It("doesn't add delayed packets to the packetHistory", func() {
 				handler.IgnoreBelow(7)
-				err := handler.ReceivedPacket(4, time.Time{}, true)
+				err := handler.ReceivedPacket(4, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
-				err = handler.ReceivedPacket(10, time.Time{}, true)
+				err = handler.ReceivedPacket(10, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -321,7 +334,7 @@ var _ = Describe("receivedPacketHandler", func() {
 
 			It("deletes packets from the packetHistory when a lower limit is set", func() {
 				for i := 1; i <= 12; i++ {
-					err := handler.ReceivedPacket(protocol.PacketNumber(i), time.Time{}, true)
+					err := handler.ReceivedPacket(protocol.PacketNumber(i), protocol.ECNNon, time.Time{}, true)
 					Expect(err).ToNot(HaveOccurred())
 				}
 				handler.IgnoreBelow(7)
@@ -336,7 +349,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			// TODO: remove this test when dropping support for STOP_WAITINGs
 			It("handles a lower limit of 0", func() {
 				handler.IgnoreBelow(0)
-				err := handler.ReceivedPacket(1337, time.Time{}, true)
+				err := handler.ReceivedPacket(1337, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				ack := handler.GetAckFrame()
 				Expect(ack).ToNot(BeNil())
@@ -344,7 +357,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("resets all counters needed for the ACK queueing decision when sending an ACK", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackAlarm = time.Now().Add(-time.Minute)
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
@@ -355,7 +368,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("doesn't generate an ACK when none is queued and the timer is not set", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = false
 				handler.ackAlarm = time.Time{}
@@ -363,7 +376,7 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("doesn't generate an ACK when none is queued and the timer has not yet expired", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = false
 				handler.ackAlarm = time.Now().Add(time.Minute)
@@ -371,12 +384,45 @@ var _ = Describe("receivedPacketHandler", func() {
 			})
 
 			It("generates an ACK when the timer has expired", func() {
-				err := handler.ReceivedPacket(1, time.Time{}, true)
+				err := handler.ReceivedPacket(1, protocol.ECNNon, time.Time{}, true)
 				Expect(err).ToNot(HaveOccurred())
 				handler.ackQueued = false
 				handler.ackAlarm = time.Now().Add(-time.Minute)
 				Expect(handler.GetAckFrame()).ToNot(BeNil())
 			})
 		})
+
+		Context("ECN", func() {
+			It("reports the ECN counts", func() {
+				Expect(handler.ReceivedPacket(1, protocol.ECT0, time.Now(), true)).To(Succeed())
+				Expect(handler.ReceivedPacket(2, protocol.ECT0, time.Now(), true)).To(Succeed())
+				Expect(handler.ReceivedPacket(3, protocol.ECNNon, time.Now(), true)).To(Succeed())
+				Expect(handler.ReceivedPacket(4, protocol.ECT1, time.Now(), true)).To(Succeed())
+				Expect(handler.ReceivedPacket(5, protocol.ECNCE, time.Now(), true)).To(Succeed())
+				ack := handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.ECT0).To(BeEquivalentTo(2))
+				Expect(ack.ECT1).To(BeEquivalentTo(1))
+				Expect(ack.ECNCE).To(BeEquivalentTo(1))
+			})
+
+			It("doesn't report ECN counts for gQUIC", func() {
+				handler = NewReceivedPacketHandler(rttStats, utils.DefaultLogger, protocol.Version39).(*receivedPacketHandler)
+				Expect(handler.ReceivedPacket(1, protocol.ECT0, time.Now(), true)).To(Succeed())
+				ack := handler.GetAckFrame()
+				Expect(ack).ToNot(BeNil())
+				Expect(ack.HasECNCounts()).To(BeFalse())
+			})
+
+			It("queues an ACK when a packet is marked CE", func() {
+				Expect(handler.ReceivedPacket(1, protocol.ECT0, time.Now(), true)).To(Succeed())
+				Expect(handler.GetAckFrame()).ToNot(BeNil())
+				Expect(handler.ReceivedPacket(2, protocol.ECT0, time.Now(), true)).To(Succeed())
+				Expect(handler.ackQueued).To(BeFalse())
+				Expect(handler.ReceivedPacket(3, protocol.ECNCE, time.Now(), true)).To(Succeed())
+				Expect(handler.ackQueued).To(BeTrue())
+				Expect(handler.GetAlarmTimeout()).To(BeZero())
+			})
+		})
 	})
 })
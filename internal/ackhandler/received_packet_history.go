@@ -95,6 +95,20 @@ func (h *receivedPacketHistory) DeleteBelow(p protocol.PacketNumber) {
 	}
 }
 
+// IsDuplicate determines if a packet with PacketNumber p was already received.
+// Packets below the deletion limit are not tracked anymore, and are not reported as duplicates.
+func (h *receivedPacketHistory) IsDuplicate(p protocol.PacketNumber) bool {
+	for el := h.ranges.Back(); el != nil; el = el.Prev() {
+		if p > el.Value.End {
+			return false
+		}
+		if p >= el.Value.Start {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAckRanges gets a slice of all AckRanges that can be used in an AckFrame
 func (h *receivedPacketHistory) GetAckRanges() []wire.AckRange {
 	if h.ranges.Len() == 0 {
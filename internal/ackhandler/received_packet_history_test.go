@@ -122,6 +122,24 @@ var _ = Describe("receivedPacketHistory", func() {
 		})
 	})
 
+	Context("duplicate detection", func() {
+		It("doesn't report duplicates when the history is empty", func() {
+			Expect(hist.IsDuplicate(5)).To(BeFalse())
+		})
+
+		It("detects duplicates", func() {
+			hist.ReceivedPacket(4)
+			hist.ReceivedPacket(5)
+			hist.ReceivedPacket(10)
+			Expect(hist.IsDuplicate(3)).To(BeFalse())
+			Expect(hist.IsDuplicate(4)).To(BeTrue())
+			Expect(hist.IsDuplicate(5)).To(BeTrue())
+			Expect(hist.IsDuplicate(6)).To(BeFalse())
+			Expect(hist.IsDuplicate(10)).To(BeTrue())
+			Expect(hist.IsDuplicate(11)).To(BeFalse())
+		})
+	})
+
 	Context("deleting", func() {
 		It("does nothing when the history is empty", func() {
 			hist.DeleteBelow(5)
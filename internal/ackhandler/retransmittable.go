@@ -13,6 +13,21 @@ func stripNonRetransmittableFrames(fs []wire.Frame) []wire.Frame {
 	return res
 }
 
+// Returns a new slice with all DATAGRAM, PATH_CHALLENGE and PATH_RESPONSE frames deleted.
+// These frames elicit ACKs, but they are never retransmitted.
+// A lost PATH_CHALLENGE is replaced by a new one, sent on the path that is being validated.
+func stripUnreliableFrames(fs []wire.Frame) []wire.Frame {
+	res := make([]wire.Frame, 0, len(fs))
+	for _, f := range fs {
+		switch f.(type) {
+		case *wire.DatagramFrame, *wire.PathChallengeFrame, *wire.PathResponseFrame:
+		default:
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
 // IsFrameRetransmittable returns true if the frame should be retransmitted.
 func IsFrameRetransmittable(f wire.Frame) bool {
 	switch f.(type) {
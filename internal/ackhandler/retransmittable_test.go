@@ -20,6 +20,7 @@ var _ = Describe("retransmittable frames", func() {
 		&wire.StreamFrame{}:          true,
 		&wire.MaxDataFrame{}:         true,
 		&wire.MaxStreamDataFrame{}:   true,
+		&wire.DatagramFrame{}:        true,
 	} {
 		f := fl
 		e := el
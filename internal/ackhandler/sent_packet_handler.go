@@ -53,6 +53,9 @@ type sentPacketHandler struct {
 
 	congestion congestion.SendAlgorithm
 	rttStats   *congestion.RTTStats
+	ecnTracker *ecnTracker
+
+	mtuProbeHandler MTUProbeHandler // nil if path MTU discovery is disabled
 
 	handshakeComplete bool
 	// The number of times the handshake packets have been retransmitted without receiving an ack.
@@ -73,24 +76,46 @@ type sentPacketHandler struct {
 	// The alarm timeout
 	alarm time.Time
 
+	packetsSent          uint64
+	packetsLost          uint64
+	packetsRetransmitted uint64
+
+	tracer          Tracer
+	congestionState CongestionState
+
 	logger utils.Logger
 }
 
-// NewSentPacketHandler creates a new sentPacketHandler
-func NewSentPacketHandler(rttStats *congestion.RTTStats, logger utils.Logger) SentPacketHandler {
-	congestion := congestion.NewCubicSender(
-		congestion.DefaultClock{},
-		rttStats,
-		false, /* don't use reno since chromium doesn't (why?) */
-		protocol.InitialCongestionWindow,
-		protocol.DefaultMaxCongestionWindow,
-	)
+// NewSentPacketHandler creates a new sentPacketHandler.
+// If cong is nil, Cubic is used for congestion control.
+// If enableECN is set, packets are marked ECT(0), as long as the ECN validation succeeds.
+// The mtuProbeHandler may be nil, if no MTU probes are sent.
+func NewSentPacketHandler(
+	rttStats *congestion.RTTStats,
+	cong congestion.SendAlgorithm,
+	enableECN bool,
+	mtuProbeHandler MTUProbeHandler,
+	tracer Tracer,
+	logger utils.Logger,
+) SentPacketHandler {
+	if cong == nil {
+		cong = congestion.NewCubicSender(
+			congestion.DefaultClock{},
+			rttStats,
+			false, /* don't use reno since chromium doesn't (why?) */
+			protocol.InitialCongestionWindow,
+			protocol.DefaultMaxCongestionWindow,
+		)
+	}
 
 	return &sentPacketHandler{
 		packetHistory:      newSentPacketHistory(),
 		stopWaitingManager: stopWaitingManager{},
 		rttStats:           rttStats,
-		congestion:         congestion,
+		congestion:         cong,
+		ecnTracker:         newECNTracker(enableECN, logger),
+		mtuProbeHandler:    mtuProbeHandler,
+		tracer:             tracer,
 		logger:             logger,
 	}
 }
@@ -104,15 +129,16 @@ func (h *sentPacketHandler) lowestUnacked() protocol.PacketNumber {
 
 func (h *sentPacketHandler) SetHandshakeComplete() {
 	h.logger.Debugf("Handshake complete. Discarding all outstanding handshake packets.")
+	// 0-RTT packets are kept until Finish0RTT is called.
 	var queue []*Packet
 	for _, packet := range h.retransmissionQueue {
-		if packet.EncryptionLevel == protocol.EncryptionForwardSecure {
+		if packet.EncryptionLevel == protocol.EncryptionForwardSecure || packet.PacketType == protocol.PacketType0RTT {
 			queue = append(queue, packet)
 		}
 	}
 	var handshakePackets []*Packet
 	h.packetHistory.Iterate(func(p *Packet) (bool, error) {
-		if p.EncryptionLevel != protocol.EncryptionForwardSecure {
+		if p.EncryptionLevel != protocol.EncryptionForwardSecure && p.PacketType != protocol.PacketType0RTT {
 			handshakePackets = append(handshakePackets, p)
 		}
 		return true, nil
@@ -124,14 +150,70 @@ func (h *sentPacketHandler) SetHandshakeComplete() {
 	h.handshakeComplete = true
 }
 
+func (h *sentPacketHandler) Finish0RTT(accepted bool) error {
+	var zeroRTTPackets []*Packet
+	h.packetHistory.Iterate(func(p *Packet) (bool, error) {
+		if p.PacketType == protocol.PacketType0RTT {
+			zeroRTTPackets = append(zeroRTTPackets, p)
+		}
+		return true, nil
+	})
+	for _, p := range h.retransmissionQueue {
+		if p.PacketType == protocol.PacketType0RTT {
+			p.PacketType = 0
+			p.EncryptionLevel = protocol.EncryptionForwardSecure
+		}
+	}
+	if accepted {
+		h.logger.Debugf("0-RTT accepted. Treating %d outstanding 0-RTT packets as forward-secure packets.", len(zeroRTTPackets))
+		for _, p := range zeroRTTPackets {
+			p.PacketType = 0
+			p.EncryptionLevel = protocol.EncryptionForwardSecure
+		}
+		return nil
+	}
+	h.logger.Debugf("0-RTT rejected. Retransmitting %d outstanding 0-RTT packets.", len(zeroRTTPackets))
+	for _, p := range zeroRTTPackets {
+		// the peer dropped this packet, so it's not in flight any more
+		if p.includedInBytesInFlight {
+			h.bytesInFlight -= p.Length
+		}
+		if p.canBeRetransmitted {
+			if err := h.queuePacketForRetransmission(p); err != nil {
+				return err
+			}
+			p.PacketType = 0
+			p.EncryptionLevel = protocol.EncryptionForwardSecure
+		}
+		if err := h.packetHistory.Remove(p.PacketNumber); err != nil {
+			return err
+		}
+	}
+	h.updateLossDetectionAlarm()
+	return nil
+}
+
+func (h *sentPacketHandler) OnConnectionMigration() {
+	h.logger.Debugf("Connection migrated. Resetting the congestion controller and the RTT estimate.")
+	h.congestion.OnConnectionMigration()
+	h.rttStats.OnConnectionMigration()
+	// ECN might not work on the new path
+	h.ecnTracker.Reset()
+}
+
 func (h *sentPacketHandler) SentPacket(packet *Packet) {
 	if isRetransmittable := h.sentPacketImpl(packet); isRetransmittable {
 		h.packetHistory.SentPacket(packet)
+		if packet.IsMTUProbe {
+			// A lost MTU probe is replaced by a smaller probe, if at all.
+			h.packetHistory.MarkCannotBeRetransmitted(packet.PacketNumber)
+		}
 		h.updateLossDetectionAlarm()
 	}
 }
 
 func (h *sentPacketHandler) SentPacketsAsRetransmission(packets []*Packet, retransmissionOf protocol.PacketNumber) {
+	h.packetsRetransmitted += uint64(len(packets))
 	var p []*Packet
 	for _, packet := range packets {
 		if isRetransmittable := h.sentPacketImpl(packet); isRetransmittable {
@@ -151,6 +233,7 @@ func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* isRetransmitt
 	}
 
 	h.lastSentPacketNumber = packet.PacketNumber
+	h.packetsSent++
 
 	if len(packet.Frames) > 0 {
 		if ackFrame, ok := packet.Frames[0].(*wire.AckFrame); ok {
@@ -173,6 +256,7 @@ func (h *sentPacketHandler) sentPacketImpl(packet *Packet) bool /* isRetransmitt
 			h.numRTOs--
 		}
 		h.allowTLP = false
+		h.ecnTracker.SentPacket(packet)
 	}
 	h.congestion.OnPacketSent(packet.SendTime, h.bytesInFlight, packet.PacketNumber, packet.Length, isRetransmittable)
 
@@ -199,6 +283,7 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 	}
 
 	if rttUpdated := h.maybeUpdateRTT(largestAcked, ackFrame.DelayTime, rcvTime); rttUpdated {
+		h.congestion.OnRTTUpdated()
 		h.congestion.MaybeExitSlowStart()
 	}
 
@@ -208,7 +293,14 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 	}
 
 	priorInFlight := h.bytesInFlight
+	processedPackets := make([]*Packet, 0, len(ackedPackets))
 	for _, p := range ackedPackets {
+		// 0-RTT packets might be acknowledged in a Handshake packet.
+		// Since these ACKs are not authenticated, they are ignored until we know if 0-RTT was accepted.
+		if p.PacketType == protocol.PacketType0RTT && encLevel < p.EncryptionLevel {
+			continue
+		}
+		processedPackets = append(processedPackets, p)
 		if encLevel < p.EncryptionLevel {
 			return fmt.Errorf("Received ACK with encryption level %s that acks a packet %d (encryption level %s)", encLevel, p.PacketNumber, p.EncryptionLevel)
 		}
@@ -224,12 +316,24 @@ func (h *sentPacketHandler) ReceivedAck(ackFrame *wire.AckFrame, withPacketNumbe
 		if p.includedInBytesInFlight {
 			h.congestion.OnPacketAcked(p.PacketNumber, p.Length, priorInFlight, rcvTime)
 		}
+		if h.mtuProbeHandler != nil {
+			if p.IsMTUProbe {
+				h.mtuProbeHandler.MTUProbeAcked(p.Length)
+			} else {
+				h.mtuProbeHandler.PacketAcked(p.Length)
+			}
+		}
+	}
+	if congested := h.ecnTracker.HandleNewlyAcked(processedPackets, ackFrame.ECT0, ackFrame.ECT1, ackFrame.ECNCE); congested {
+		h.logger.Debugf("\tpeer received packets marked CE (total: %d)", ackFrame.ECNCE)
+		h.congestion.OnECNCongestionEvent(largestAcked, priorInFlight)
 	}
 
 	if err := h.detectLostPackets(rcvTime, priorInFlight); err != nil {
 		return err
 	}
 	h.updateLossDetectionAlarm()
+	h.maybeUpdateCongestionState()
 
 	h.garbageCollectSkippedPackets()
 	h.stopWaitingManager.ReceivedAck(ackFrame)
@@ -291,6 +395,16 @@ func (h *sentPacketHandler) maybeUpdateRTT(largestAcked protocol.PacketNumber, a
 		if h.logger.Debug() {
 			h.logger.Debugf("\tupdated RTT: %s (σ: %s)", h.rttStats.SmoothedRTT(), h.rttStats.MeanDeviation())
 		}
+		if h.tracer != nil {
+			h.tracer.UpdatedMetrics(Metrics{
+				LatestRTT:        h.rttStats.LatestRTT(),
+				SmoothedRTT:      h.rttStats.SmoothedRTT(),
+				MinRTT:           h.rttStats.MinRTT(),
+				MeanDeviation:    h.rttStats.MeanDeviation(),
+				CongestionWindow: h.congestion.GetCongestionWindow(),
+				BytesInFlight:    h.bytesInFlight,
+			})
+		}
 		return true
 	}
 	return false
@@ -353,6 +467,27 @@ func (h *sentPacketHandler) detectLostPackets(now time.Time, priorInFlight proto
 	}
 
 	for _, p := range lostPackets {
+		if h.tracer != nil {
+			h.tracer.LostPacket(p.EncryptionLevel, p.PacketNumber, p.Length)
+		}
+		if p.IsMTUProbe {
+			// The probe was most likely dropped because it was too large for the path.
+			// This says nothing about the congestion on the path.
+			h.logger.Debugf("	MTU probe %#x (%d bytes) lost", p.PacketNumber, p.Length)
+			if p.includedInBytesInFlight {
+				h.bytesInFlight -= p.Length
+			}
+			if h.mtuProbeHandler != nil {
+				h.mtuProbeHandler.MTUProbeLost(p.Length)
+			}
+			h.packetHistory.Remove(p.PacketNumber)
+			continue
+		}
+		h.packetsLost++
+		h.ecnTracker.LostPacket(p)
+		if h.mtuProbeHandler != nil {
+			h.mtuProbeHandler.PacketLost(p.Length)
+		}
 		// the bytes in flight need to be reduced no matter if this packet will be retransmitted
 		if p.includedInBytesInFlight {
 			h.bytesInFlight -= p.Length
@@ -377,24 +512,28 @@ func (h *sentPacketHandler) OnAlarm() error {
 		if h.logger.Debug() {
 			h.logger.Debugf("Loss detection alarm fired in handshake mode")
 		}
+		h.traceLossTimerExpired(TimerTypeHandshake)
 		h.handshakeCount++
 		err = h.queueHandshakePacketsForRetransmission()
 	} else if !h.lossTime.IsZero() {
 		if h.logger.Debug() {
 			h.logger.Debugf("Loss detection alarm fired in loss timer mode")
 		}
+		h.traceLossTimerExpired(TimerTypeLossTime)
 		// Early retransmit or time loss detection
 		err = h.detectLostPackets(now, h.bytesInFlight)
 	} else if h.tlpCount < maxTLPs {
 		if h.logger.Debug() {
 			h.logger.Debugf("Loss detection alarm fired in TLP mode")
 		}
+		h.traceLossTimerExpired(TimerTypeTLP)
 		h.allowTLP = true
 		h.tlpCount++
 	} else {
 		if h.logger.Debug() {
 			h.logger.Debugf("Loss detection alarm fired in RTO mode")
 		}
+		h.traceLossTimerExpired(TimerTypeRTO)
 		// RTO
 		h.rtoCount++
 		h.numRTOs += 2
@@ -404,13 +543,55 @@ func (h *sentPacketHandler) OnAlarm() error {
 		return err
 	}
 	h.updateLossDetectionAlarm()
+	h.maybeUpdateCongestionState()
 	return nil
 }
 
+func (h *sentPacketHandler) traceLossTimerExpired(t TimerType) {
+	if h.tracer != nil {
+		h.tracer.LossTimerExpired(t)
+	}
+}
+
+// maybeUpdateCongestionState notifies the tracer if the congestion controller changed its state
+func (h *sentPacketHandler) maybeUpdateCongestionState() {
+	if h.tracer == nil {
+		return
+	}
+	state := CongestionStateCongestionAvoidance
+	if h.congestion.InRecovery() {
+		state = CongestionStateRecovery
+	} else if h.congestion.InSlowStart() {
+		state = CongestionStateSlowStart
+	}
+	if state != h.congestionState {
+		h.congestionState = state
+		h.tracer.UpdatedCongestionState(state)
+	}
+}
+
 func (h *sentPacketHandler) GetAlarmTimeout() time.Time {
 	return h.alarm
 }
 
+func (h *sentPacketHandler) BytesInFlight() protocol.ByteCount {
+	return h.bytesInFlight
+}
+
+func (h *sentPacketHandler) GetStats() *SentPacketStats {
+	stats := &SentPacketStats{
+		PacketsSent:          h.packetsSent,
+		PacketsLost:          h.packetsLost,
+		PacketsRetransmitted: h.packetsRetransmitted,
+		BytesInFlight:        h.bytesInFlight,
+		CongestionWindow:     h.congestion.GetCongestionWindow(),
+	}
+	if c, ok := h.congestion.(interface{ BandwidthEstimate() congestion.Bandwidth }); ok {
+		stats.BandwidthEstimate = c.BandwidthEstimate()
+	}
+	return stats
+}
+
 func (h *sentPacketHandler) onPacketAcked(p *Packet, rcvTime time.Time) error {
 	// This happens if a packet and its retransmissions is acked in the same ACK.
 	// As soon as we process the first one, this will remove all the retransmissions,
@@ -540,6 +721,10 @@ func (h *sentPacketHandler) SendMode() SendMode {
 	return SendAny
 }
 
+func (h *sentPacketHandler) ECNMode() protocol.ECN {
+	return h.ecnTracker.Mode()
+}
+
 func (h *sentPacketHandler) TimeUntilSend() time.Time {
 	return h.nextPacketSendTime
 }
@@ -597,6 +782,11 @@ func (h *sentPacketHandler) queuePacketForRetransmission(p *Packet) error {
 	if err := h.packetHistory.MarkCannotBeRetransmitted(p.PacketNumber); err != nil {
 		return err
 	}
+	p.Frames = stripUnreliableFrames(p.Frames)
+	if len(p.Frames) == 0 {
+		h.logger.Debugf("Not retransmitting packet %#x, since it only contained frames that are never retransmitted", p.PacketNumber)
+		return nil
+	}
 	h.retransmissionQueue = append(h.retransmissionQueue, p)
 	h.stopWaitingManager.QueuedRetransmissionForPacketNumber(p.PacketNumber)
 	return nil
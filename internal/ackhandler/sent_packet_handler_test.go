@@ -41,6 +41,50 @@ func handshakePacket(p *Packet) *Packet {
 	return p
 }
 
+type lostPacket struct {
+	encLevel protocol.EncryptionLevel
+	pn       protocol.PacketNumber
+	size     protocol.ByteCount
+}
+
+type recordingTracer struct {
+	lostPackets      []lostPacket
+	metrics          []Metrics
+	congestionStates []CongestionState
+	timers           []TimerType
+}
+
+var _ Tracer = &recordingTracer{}
+
+func (t *recordingTracer) LostPacket(encLevel protocol.EncryptionLevel, pn protocol.PacketNumber, size protocol.ByteCount) {
+	t.lostPackets = append(t.lostPackets, lostPacket{encLevel: encLevel, pn: pn, size: size})
+}
+func (t *recordingTracer) UpdatedMetrics(m Metrics) { t.metrics = append(t.metrics, m) }
+func (t *recordingTracer) UpdatedCongestionState(s CongestionState) {
+	t.congestionStates = append(t.congestionStates, s)
+}
+func (t *recordingTracer) LossTimerExpired(tt TimerType) { t.timers = append(t.timers, tt) }
+
+type recordingMTUProbeHandler struct {
+	acked, lost               []protocol.ByteCount
+	packetsAcked, packetsLost []protocol.ByteCount
+}
+
+var _ MTUProbeHandler = &recordingMTUProbeHandler{}
+
+func (h *recordingMTUProbeHandler) MTUProbeAcked(size protocol.ByteCount) {
+	h.acked = append(h.acked, size)
+}
+func (h *recordingMTUProbeHandler) MTUProbeLost(size protocol.ByteCount) {
+	h.lost = append(h.lost, size)
+}
+func (h *recordingMTUProbeHandler) PacketAcked(size protocol.ByteCount) {
+	h.packetsAcked = append(h.packetsAcked, size)
+}
+func (h *recordingMTUProbeHandler) PacketLost(size protocol.ByteCount) {
+	h.packetsLost = append(h.packetsLost, size)
+}
+
 var _ = Describe("SentPacketHandler", func() {
 	var (
 		handler     *sentPacketHandler
@@ -49,7 +93,7 @@ var _ = Describe("SentPacketHandler", func() {
 
 	BeforeEach(func() {
 		rttStats := &congestion.RTTStats{}
-		handler = NewSentPacketHandler(rttStats, utils.DefaultLogger).(*sentPacketHandler)
+		handler = NewSentPacketHandler(rttStats, nil, false, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
 		handler.SetHandshakeComplete()
 		streamFrame = wire.StreamFrame{
 			StreamID: 5,
@@ -523,6 +567,44 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
 		})
 
+		Context("DATAGRAM frames", func() {
+			datagramPacket := func(p *Packet, frames ...wire.Frame) *Packet {
+				p = retransmittablePacket(p)
+				p.Frames = append([]wire.Frame{&wire.DatagramFrame{Data: []byte("foobar")}}, frames...)
+				return p
+			}
+
+			It("counts packets containing DATAGRAM frames towards the bytes in flight", func() {
+				handler.SentPacket(datagramPacket(&Packet{PacketNumber: 1, Length: 42}))
+				Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(42)))
+				expectInPacketHistory([]protocol.PacketNumber{1})
+			})
+
+			It("doesn't retransmit packets that only contain DATAGRAM frames", func() {
+				handler.SentPacket(datagramPacket(&Packet{PacketNumber: 1}))
+				Expect(handler.queuePacketForRetransmission(getPacket(1))).To(Succeed())
+				Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			})
+
+			It("removes DATAGRAM frames from retransmissions", func() {
+				handler.SentPacket(datagramPacket(&Packet{PacketNumber: 1}, &streamFrame))
+				Expect(handler.queuePacketForRetransmission(getPacket(1))).To(Succeed())
+				p := handler.DequeuePacketForRetransmission()
+				Expect(p).ToNot(BeNil())
+				Expect(p.Frames).To(Equal([]wire.Frame{&streamFrame}))
+			})
+
+			It("removes PATH_CHALLENGE and PATH_RESPONSE frames from retransmissions", func() {
+				p := retransmittablePacket(&Packet{PacketNumber: 1})
+				p.Frames = []wire.Frame{&wire.PathChallengeFrame{}, &streamFrame, &wire.PathResponseFrame{}}
+				handler.SentPacket(p)
+				Expect(handler.queuePacketForRetransmission(getPacket(1))).To(Succeed())
+				p = handler.DequeuePacketForRetransmission()
+				Expect(p).ToNot(BeNil())
+				Expect(p.Frames).To(Equal([]wire.Frame{&streamFrame}))
+			})
+		})
+
 		Context("STOP_WAITINGs", func() {
 			It("gets a STOP_WAITING frame", func() {
 				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1}))
@@ -550,6 +632,16 @@ var _ = Describe("SentPacketHandler", func() {
 			handler.congestion = cong
 		})
 
+		It("uses the congestion controller it was created with", func() {
+			h := NewSentPacketHandler(&congestion.RTTStats{}, cong, false, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
+			Expect(h.congestion).To(Equal(cong))
+		})
+
+		It("uses Cubic by default", func() {
+			h := NewSentPacketHandler(&congestion.RTTStats{}, nil, false, nil, nil, utils.DefaultLogger).(*sentPacketHandler)
+			Expect(h.congestion).To(BeAssignableToTypeOf(congestion.NewCubicSender(congestion.DefaultClock{}, nil, false, 0, 0)))
+		})
+
 		It("should call OnSent", func() {
 			cong.EXPECT().OnPacketSent(
 				gomock.Any(),
@@ -567,11 +659,20 @@ var _ = Describe("SentPacketHandler", func() {
 			handler.SentPacket(p)
 		})
 
-		It("should call MaybeExitSlowStart and OnPacketAcked", func() {
+		It("resets the congestion controller and the RTT estimate when the connection is migrated", func() {
+			handler.rttStats.UpdateRTT(time.Second, 0, time.Now())
+			Expect(handler.rttStats.SmoothedRTT()).To(Equal(time.Second))
+			cong.EXPECT().OnConnectionMigration()
+			handler.OnConnectionMigration()
+			Expect(handler.rttStats.SmoothedRTT()).To(BeZero())
+		})
+
+		It("should call OnRTTUpdated, MaybeExitSlowStart and OnPacketAcked", func() {
 			rcvTime := time.Now().Add(-5 * time.Second)
 			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(3)
 			cong.EXPECT().TimeUntilSend(gomock.Any()).Times(3)
 			gomock.InOrder(
+				cong.EXPECT().OnRTTUpdated(),
 				cong.EXPECT().MaybeExitSlowStart(), // must be called before packets are acked
 				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(1), protocol.ByteCount(1), protocol.ByteCount(3), rcvTime),
 				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(2), protocol.ByteCount(1), protocol.ByteCount(3), rcvTime),
@@ -614,6 +715,7 @@ var _ = Describe("SentPacketHandler", func() {
 			// send one probe packet and receive an ACK for it
 			rcvTime := time.Now()
 			gomock.InOrder(
+				cong.EXPECT().OnRTTUpdated(),
 				cong.EXPECT().MaybeExitSlowStart(),
 				cong.EXPECT().OnRetransmissionTimeout(true),
 				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(5), protocol.ByteCount(1), protocol.ByteCount(5), rcvTime),
@@ -644,6 +746,7 @@ var _ = Describe("SentPacketHandler", func() {
 			// receive an ACK for a packet send *before* the probe packet
 			// don't EXPECT any call to OnRetransmissionTimeout
 			gomock.InOrder(
+				cong.EXPECT().OnRTTUpdated(),
 				cong.EXPECT().MaybeExitSlowStart(),
 				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(2), protocol.ByteCount(1), protocol.ByteCount(3), gomock.Any()),
 				cong.EXPECT().OnPacketLost(protocol.PacketNumber(1), protocol.ByteCount(1), protocol.ByteCount(3)),
@@ -660,6 +763,7 @@ var _ = Describe("SentPacketHandler", func() {
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2}))
 			// lose packet 1
 			gomock.InOrder(
+				cong.EXPECT().OnRTTUpdated(),
 				cong.EXPECT().MaybeExitSlowStart(),
 				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(2), protocol.ByteCount(1), protocol.ByteCount(2), gomock.Any()),
 				cong.EXPECT().OnPacketLost(protocol.PacketNumber(1), protocol.ByteCount(1), protocol.ByteCount(2)),
@@ -682,6 +786,7 @@ var _ = Describe("SentPacketHandler", func() {
 			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 4, SendTime: time.Now()}))
 			// receive the first ACK
 			gomock.InOrder(
+				cong.EXPECT().OnRTTUpdated(),
 				cong.EXPECT().MaybeExitSlowStart(),
 				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(2), protocol.ByteCount(1), protocol.ByteCount(4), gomock.Any()),
 				cong.EXPECT().OnPacketLost(protocol.PacketNumber(1), protocol.ByteCount(1), protocol.ByteCount(4)),
@@ -691,6 +796,7 @@ var _ = Describe("SentPacketHandler", func() {
 			Expect(err).ToNot(HaveOccurred())
 			// receive the second ACK
 			gomock.InOrder(
+				cong.EXPECT().OnRTTUpdated(),
 				cong.EXPECT().MaybeExitSlowStart(),
 				cong.EXPECT().OnPacketAcked(protocol.PacketNumber(4), protocol.ByteCount(1), protocol.ByteCount(2), gomock.Any()),
 				cong.EXPECT().OnPacketLost(protocol.PacketNumber(3), protocol.ByteCount(1), protocol.ByteCount(2)),
@@ -782,6 +888,143 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("ECN", func() {
+		var cong *mocks.MockSendAlgorithm
+
+		BeforeEach(func() {
+			cong = mocks.NewMockSendAlgorithm(mockCtrl)
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			cong.EXPECT().TimeUntilSend(gomock.Any()).AnyTimes()
+			cong.EXPECT().OnRTTUpdated().AnyTimes()
+			cong.EXPECT().MaybeExitSlowStart().AnyTimes()
+			cong.EXPECT().OnPacketAcked(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			cong.EXPECT().GetCongestionWindow().AnyTimes()
+			handler.congestion = cong
+			handler.ecnTracker = newECNTracker(true, utils.DefaultLogger)
+		})
+
+		sendPacket := func(pn protocol.PacketNumber) {
+			p := retransmittablePacket(&Packet{PacketNumber: pn})
+			p.ECN = handler.ECNMode()
+			handler.SentPacket(p)
+		}
+
+		It("doesn't use ECN if it's disabled", func() {
+			h := NewSentPacketHandler(&congestion.RTTStats{}, nil, false, nil, nil, utils.DefaultLogger)
+			Expect(h.ECNMode()).To(Equal(protocol.ECNNon))
+		})
+
+		It("marks packets with ECT(0), and reports CE marks to the congestion controller", func() {
+			Expect(handler.ECNMode()).To(Equal(protocol.ECT0))
+			for i := protocol.PacketNumber(1); i <= 5; i++ {
+				sendPacket(i)
+			}
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}, ECT0: 2}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ECNMode()).To(Equal(protocol.ECT0))
+			cong.EXPECT().OnECNCongestionEvent(protocol.PacketNumber(4), protocol.ByteCount(3))
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 4}}, ECT0: 3, ECNCE: 1}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+		})
+
+		It("disables ECN if the peer doesn't report the ECN marks", func() {
+			sendPacket(1)
+			sendPacket(2)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ECNMode()).To(Equal(protocol.ECNNon))
+			// CE marks are ignored after ECN was disabled
+			sendPacket(3)
+			ack = &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 3}}, ECNCE: 1}
+			Expect(handler.ReceivedAck(ack, 2, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+		})
+
+		It("restarts the ECN validation when the connection is migrated", func() {
+			sendPacket(1)
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(handler.ECNMode()).To(Equal(protocol.ECNNon))
+			cong.EXPECT().OnConnectionMigration()
+			handler.OnConnectionMigration()
+			Expect(handler.ECNMode()).To(Equal(protocol.ECT0))
+		})
+	})
+
+	Context("MTU probes", func() {
+		var (
+			cong         *mocks.MockSendAlgorithm
+			probeHandler *recordingMTUProbeHandler
+		)
+
+		BeforeEach(func() {
+			cong = mocks.NewMockSendAlgorithm(mockCtrl)
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			cong.EXPECT().TimeUntilSend(gomock.Any()).AnyTimes()
+			cong.EXPECT().OnRTTUpdated().AnyTimes()
+			cong.EXPECT().MaybeExitSlowStart().AnyTimes()
+			cong.EXPECT().OnPacketAcked(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			cong.EXPECT().GetCongestionWindow().AnyTimes()
+			handler.congestion = cong
+			probeHandler = &recordingMTUProbeHandler{}
+			handler.mtuProbeHandler = probeHandler
+		})
+
+		mtuProbe := func(pn protocol.PacketNumber, size protocol.ByteCount, sendTime time.Time) *Packet {
+			p := retransmittablePacket(&Packet{PacketNumber: pn, Length: size, SendTime: sendTime})
+			p.IsMTUProbe = true
+			return p
+		}
+
+		It("reports acknowledged MTU probes", func() {
+			handler.SentPacket(mtuProbe(1, 1400, time.Now()))
+			Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(1400)))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			Expect(probeHandler.acked).To(Equal([]protocol.ByteCount{1400}))
+			Expect(probeHandler.lost).To(BeEmpty())
+			Expect(probeHandler.packetsAcked).To(BeEmpty())
+			Expect(handler.bytesInFlight).To(BeZero())
+		})
+
+		It("reports acknowledged and lost packets that are not MTU probes", func() {
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, Length: 1300, SendTime: now.Add(-10 * time.Second)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, Length: 1200, SendTime: now.Add(-time.Second)}))
+			cong.EXPECT().OnPacketLost(protocol.PacketNumber(1), protocol.ByteCount(1300), gomock.Any())
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			Expect(probeHandler.packetsAcked).To(Equal([]protocol.ByteCount{1200}))
+			Expect(probeHandler.packetsLost).To(Equal([]protocol.ByteCount{1300}))
+			Expect(probeHandler.acked).To(BeEmpty())
+			Expect(probeHandler.lost).To(BeEmpty())
+		})
+
+		It("reports lost MTU probes, without treating the loss as a congestion signal", func() {
+			now := time.Now()
+			handler.SentPacket(mtuProbe(1, 1400, now.Add(-10*time.Second)))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: now.Add(-time.Second)}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			// no call to OnPacketLost is expected
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			Expect(probeHandler.lost).To(Equal([]protocol.ByteCount{1400}))
+			Expect(handler.bytesInFlight).To(BeZero())
+			Expect(handler.packetHistory.Len()).To(BeZero())
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			Expect(handler.GetStats().PacketsLost).To(BeZero())
+		})
+
+		It("doesn't retransmit MTU probes when an RTO fires", func() {
+			handler.SentPacket(mtuProbe(1, 1400, time.Now()))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2}))
+			handler.tlpCount = maxTLPs
+			Expect(handler.OnAlarm()).To(Succeed())
+			p := handler.DequeuePacketForRetransmission()
+			Expect(p).ToNot(BeNil())
+			Expect(p.PacketNumber).To(Equal(protocol.PacketNumber(2)))
+			Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+		})
+	})
+
 	Context("TLPs", func() {
 		It("uses the RTT from RTT stats", func() {
 			rtt := 2 * time.Second
@@ -1007,6 +1250,106 @@ var _ = Describe("SentPacketHandler", func() {
 		})
 	})
 
+	Context("statistics", func() {
+		It("counts sent, lost and retransmitted packets", func() {
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, SendTime: now.Add(-time.Hour)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, SendTime: now.Add(-time.Second)}))
+			handler.SentPacket(nonRetransmittablePacket(&Packet{PacketNumber: 3, SendTime: now.Add(-time.Second)}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			err := handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)
+			Expect(err).NotTo(HaveOccurred())
+			p := handler.DequeuePacketForRetransmission()
+			Expect(p).ToNot(BeNil())
+			handler.SentPacketsAsRetransmission([]*Packet{retransmittablePacket(&Packet{PacketNumber: 4})}, p.PacketNumber)
+			stats := handler.GetStats()
+			Expect(stats.PacketsSent).To(BeEquivalentTo(4))
+			Expect(stats.PacketsLost).To(BeEquivalentTo(1))
+			Expect(stats.PacketsRetransmitted).To(BeEquivalentTo(1))
+		})
+
+		It("reports the state of the congestion controller", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, Length: 42}))
+			handler.rttStats.UpdateRTT(time.Second, 0, time.Now())
+			stats := handler.GetStats()
+			Expect(stats.BytesInFlight).To(Equal(protocol.ByteCount(42)))
+			Expect(handler.BytesInFlight()).To(Equal(protocol.ByteCount(42)))
+			Expect(stats.CongestionWindow).To(Equal(handler.congestion.GetCongestionWindow()))
+			Expect(stats.BandwidthEstimate).ToNot(BeZero())
+		})
+	})
+
+	Context("tracing", func() {
+		var tracer *recordingTracer
+
+		BeforeEach(func() {
+			tracer = &recordingTracer{}
+			handler.tracer = tracer
+		})
+
+		It("traces lost packets and RTT updates", func() {
+			now := time.Now()
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1, Length: 100, SendTime: now.Add(-time.Hour)}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2, Length: 200, SendTime: now.Add(-time.Second)}))
+			ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 2, Largest: 2}}}
+			Expect(handler.ReceivedAck(ack, 1, protocol.EncryptionForwardSecure, now)).To(Succeed())
+			Expect(tracer.lostPackets).To(Equal([]lostPacket{{encLevel: protocol.EncryptionForwardSecure, pn: 1, size: 100}}))
+			Expect(tracer.metrics).To(HaveLen(1))
+			m := tracer.metrics[0]
+			Expect(m.LatestRTT).To(Equal(time.Second))
+			Expect(m.SmoothedRTT).To(Equal(time.Second))
+			Expect(m.MinRTT).To(Equal(time.Second))
+			Expect(m.CongestionWindow).To(Equal(protocol.InitialCongestionWindow))
+			Expect(m.BytesInFlight).To(Equal(protocol.ByteCount(300)))
+		})
+
+		It("traces changes of the congestion state", func() {
+			cong := mocks.NewMockSendAlgorithm(mockCtrl)
+			cong.EXPECT().OnPacketSent(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			cong.EXPECT().TimeUntilSend(gomock.Any()).AnyTimes()
+			cong.EXPECT().OnRTTUpdated().AnyTimes()
+			cong.EXPECT().MaybeExitSlowStart().AnyTimes()
+			cong.EXPECT().OnPacketAcked(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			cong.EXPECT().GetCongestionWindow().AnyTimes()
+			handler.congestion = cong
+			gomock.InOrder(
+				cong.EXPECT().InRecovery(),
+				cong.EXPECT().InSlowStart().Return(true),
+				cong.EXPECT().InRecovery(),
+				cong.EXPECT().InSlowStart().Return(true),
+				cong.EXPECT().InRecovery(),
+				cong.EXPECT().InSlowStart(),
+				cong.EXPECT().InRecovery().Return(true),
+			)
+			for i := protocol.PacketNumber(1); i <= 4; i++ {
+				handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: i}))
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: i}}}
+				Expect(handler.ReceivedAck(ack, i, protocol.EncryptionForwardSecure, time.Now())).To(Succeed())
+			}
+			Expect(tracer.congestionStates).To(Equal([]CongestionState{
+				CongestionStateSlowStart,
+				CongestionStateCongestionAvoidance,
+				CongestionStateRecovery,
+			}))
+		})
+
+		It("traces the expiry of the loss detection timer", func() {
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 1}))
+			handler.SentPacket(retransmittablePacket(&Packet{PacketNumber: 2}))
+			Expect(handler.OnAlarm()).To(Succeed())
+			Expect(handler.OnAlarm()).To(Succeed())
+			Expect(handler.OnAlarm()).To(Succeed())
+			Expect(tracer.timers).To(Equal([]TimerType{TimerTypeTLP, TimerTypeTLP, TimerTypeRTO}))
+		})
+
+		It("traces the expiry of the handshake timer", func() {
+			handler.handshakeComplete = false
+			handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1}))
+			Expect(handler.OnAlarm()).To(Succeed())
+			Expect(tracer.timers).To(Equal([]TimerType{TimerTypeHandshake}))
+		})
+	})
+
 	Context("handshake packets", func() {
 		BeforeEach(func() {
 			handler.handshakeComplete = false
@@ -1071,5 +1414,58 @@ var _ = Describe("SentPacketHandler", func() {
 			packet := handler.DequeuePacketForRetransmission()
 			Expect(packet).To(BeNil())
 		})
+
+		Context("0-RTT packets", func() {
+			zeroRTTPacket := func(pn protocol.PacketNumber) *Packet {
+				p := retransmittablePacket(&Packet{PacketNumber: pn})
+				p.PacketType = protocol.PacketType0RTT
+				p.EncryptionLevel = protocol.EncryptionSecure
+				return p
+			}
+
+			It("ignores ACKs for 0-RTT packets received in Handshake packets", func() {
+				handler.SentPacket(zeroRTTPacket(1))
+				ack := &wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}
+				err := handler.ReceivedAck(ack, 1, protocol.EncryptionUnencrypted, time.Now())
+				Expect(err).ToNot(HaveOccurred())
+				expectInPacketHistory([]protocol.PacketNumber{1})
+			})
+
+			It("treats 0-RTT packets as forward-secure packets, if 0-RTT was accepted", func() {
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1}))
+				handler.SentPacket(zeroRTTPacket(2))
+				handler.SentPacket(zeroRTTPacket(3))
+				handler.queuePacketForRetransmission(getPacket(3))
+				handler.SetHandshakeComplete()
+				Expect(handler.Finish0RTT(true)).To(Succeed())
+				expectInPacketHistory([]protocol.PacketNumber{2, 3})
+				Expect(getPacket(2).EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+				packet := handler.DequeuePacketForRetransmission()
+				Expect(packet).ToNot(BeNil())
+				Expect(packet.PacketNumber).To(Equal(protocol.PacketNumber(3)))
+				Expect(packet.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+				Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			})
+
+			It("retransmits 0-RTT packets as forward-secure packets, if 0-RTT was rejected", func() {
+				handler.SentPacket(handshakePacket(&Packet{PacketNumber: 1}))
+				handler.SentPacket(zeroRTTPacket(2))
+				handler.SentPacket(zeroRTTPacket(3))
+				Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(3)))
+				handler.SetHandshakeComplete()
+				expectInPacketHistory([]protocol.PacketNumber{2, 3})
+				Expect(handler.Finish0RTT(false)).To(Succeed())
+				Expect(handler.packetHistory.Len()).To(BeZero())
+				Expect(handler.bytesInFlight).To(Equal(protocol.ByteCount(1)))
+				for _, pn := range []protocol.PacketNumber{2, 3} {
+					packet := handler.DequeuePacketForRetransmission()
+					Expect(packet).ToNot(BeNil())
+					Expect(packet.PacketNumber).To(Equal(pn))
+					Expect(packet.PacketType).To(BeZero())
+					Expect(packet.EncryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+				}
+				Expect(handler.DequeuePacketForRetransmission()).To(BeNil())
+			})
+		})
 	})
 })
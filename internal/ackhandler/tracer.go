@@ -0,0 +1,84 @@
+package ackhandler
+
+import (
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+)
+
+// A Tracer is notified about loss detection and congestion control events.
+type Tracer interface {
+	// LostPacket is called when a packet is declared lost.
+	LostPacket(encLevel protocol.EncryptionLevel, pn protocol.PacketNumber, size protocol.ByteCount)
+	// UpdatedMetrics is called every time a new RTT sample is taken.
+	UpdatedMetrics(Metrics)
+	// UpdatedCongestionState is called when the congestion controller changes its state.
+	UpdatedCongestionState(CongestionState)
+	// LossTimerExpired is called when the loss detection alarm fires.
+	LossTimerExpired(TimerType)
+}
+
+// Metrics are the RTT estimates and the state of the congestion controller.
+type Metrics struct {
+	LatestRTT     time.Duration
+	SmoothedRTT   time.Duration
+	MinRTT        time.Duration
+	MeanDeviation time.Duration
+
+	CongestionWindow protocol.ByteCount
+	BytesInFlight    protocol.ByteCount
+}
+
+// The CongestionState is the state of the congestion controller.
+type CongestionState uint8
+
+const (
+	// CongestionStateSlowStart is the slow start phase
+	CongestionStateSlowStart CongestionState = 1 + iota
+	// CongestionStateCongestionAvoidance is the congestion avoidance phase
+	CongestionStateCongestionAvoidance
+	// CongestionStateRecovery is the recovery phase, entered after a packet loss
+	CongestionStateRecovery
+)
+
+func (s CongestionState) String() string {
+	switch s {
+	case CongestionStateSlowStart:
+		return "slow start"
+	case CongestionStateCongestionAvoidance:
+		return "congestion avoidance"
+	case CongestionStateRecovery:
+		return "recovery"
+	default:
+		return "unknown"
+	}
+}
+
+// The TimerType is the mode the loss detection alarm fired in.
+type TimerType uint8
+
+const (
+	// TimerTypeHandshake is the handshake retransmission timer
+	TimerTypeHandshake TimerType = 1 + iota
+	// TimerTypeLossTime is the early retransmit and time based loss detection timer
+	TimerTypeLossTime
+	// TimerTypeTLP is the tail loss probe timer
+	TimerTypeTLP
+	// TimerTypeRTO is the retransmission timeout
+	TimerTypeRTO
+)
+
+func (t TimerType) String() string {
+	switch t {
+	case TimerTypeHandshake:
+		return "handshake"
+	case TimerTypeLossTime:
+		return "loss time"
+	case TimerTypeTLP:
+		return "TLP"
+	case TimerTypeRTO:
+		return "RTO"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,23 @@
+package ackhandler
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracer", func() {
+	It("has a string representation for the congestion state", func() {
+		Expect(CongestionStateSlowStart.String()).To(Equal("slow start"))
+		Expect(CongestionStateCongestionAvoidance.String()).To(Equal("congestion avoidance"))
+		Expect(CongestionStateRecovery.String()).To(Equal("recovery"))
+		Expect(CongestionState(0).String()).To(Equal("unknown"))
+	})
+
+	It("has a string representation for the timer type", func() {
+		Expect(TimerTypeHandshake.String()).To(Equal("handshake"))
+		Expect(TimerTypeLossTime.String()).To(Equal("loss time"))
+		Expect(TimerTypeTLP.String()).To(Equal("TLP"))
+		Expect(TimerTypeRTO.String()).To(Equal("RTO"))
+		Expect(TimerType(0).String()).To(Equal("unknown"))
+	})
+})
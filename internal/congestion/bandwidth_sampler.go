@@ -0,0 +1,171 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+)
+
+// A bandwidthSample is a sample of the delivery rate, taken when a packet is acknowledged.
+type bandwidthSample struct {
+	// bandwidth is the delivery rate. It is 0 if no sample could be taken.
+	bandwidth Bandwidth
+	// rtt is the RTT of the acknowledged packet.
+	rtt time.Duration
+	// isAppLimited is set if the packet was sent while the sender was application limited.
+	// In that case, the bandwidth sample is likely lower than the available bandwidth.
+	isAppLimited bool
+}
+
+// sendTimeState is the state of the connection at the time a packet was sent.
+type sendTimeState struct {
+	sentTime time.Time
+	size     protocol.ByteCount
+
+	totalBytesSent                  protocol.ByteCount
+	totalBytesSentAtLastAckedPacket protocol.ByteCount
+	lastAckedPacketSentTime         time.Time
+	lastAckedPacketAckTime          time.Time
+	totalBytesAcked                 protocol.ByteCount
+	isAppLimited                    bool
+}
+
+// The bandwidthSampler estimates the delivery rate of the connection.
+// When a packet is acknowledged, the amount of data acknowledged since the packet was sent
+// is divided by the time that has passed between the two acknowledgements.
+// To account for ACK compression, the send rate over the same interval is an upper bound for the sample.
+// This corresponds to the delivery rate estimation described in
+// https://tools.ietf.org/html/draft-cheng-iccrg-delivery-rate-estimation.
+type bandwidthSampler struct {
+	totalBytesSent  protocol.ByteCount
+	totalBytesAcked protocol.ByteCount
+
+	// the value of totalBytesSent when the last acknowledged packet was sent
+	totalBytesSentAtLastAckedPacket protocol.ByteCount
+	lastAckedPacketSentTime         time.Time
+	lastAckedPacketAckTime          time.Time
+
+	lastSentPacket protocol.PacketNumber
+
+	// isAppLimited is set if the sender is application limited,
+	// until the first packet sent after the app-limited phase is acknowledged.
+	isAppLimited         bool
+	endOfAppLimitedPhase protocol.PacketNumber
+
+	packets map[protocol.PacketNumber]*sendTimeState
+}
+
+func newBandwidthSampler() *bandwidthSampler {
+	return &bandwidthSampler{packets: make(map[protocol.PacketNumber]*sendTimeState)}
+}
+
+// OnPacketSent must be called for every retransmittable packet sent.
+// priorInFlight are the bytes in flight before the packet was sent.
+func (s *bandwidthSampler) OnPacketSent(sentTime time.Time, pn protocol.PacketNumber, bytes, priorInFlight protocol.ByteCount) {
+	s.lastSentPacket = pn
+	s.totalBytesSent += bytes
+
+	// If there are no packets in flight, the time at which the new transmission opens
+	// can be treated as the time when the last packet was acknowledged.
+	// This is necessary to get a sample for the first packet after a quiescence period.
+	if priorInFlight == 0 {
+		s.lastAckedPacketAckTime = sentTime
+		s.totalBytesSentAtLastAckedPacket = s.totalBytesSent
+		s.lastAckedPacketSentTime = sentTime
+	}
+
+	s.packets[pn] = &sendTimeState{
+		sentTime:                        sentTime,
+		size:                            bytes,
+		totalBytesSent:                  s.totalBytesSent,
+		totalBytesSentAtLastAckedPacket: s.totalBytesSentAtLastAckedPacket,
+		lastAckedPacketSentTime:         s.lastAckedPacketSentTime,
+		lastAckedPacketAckTime:          s.lastAckedPacketAckTime,
+		totalBytesAcked:                 s.totalBytesAcked,
+		isAppLimited:                    s.isAppLimited,
+	}
+}
+
+// OnPacketAcked takes a bandwidth sample when a packet is acknowledged.
+func (s *bandwidthSampler) OnPacketAcked(ackTime time.Time, pn protocol.PacketNumber) bandwidthSample {
+	state, ok := s.packets[pn]
+	if !ok {
+		return bandwidthSample{}
+	}
+	delete(s.packets, pn)
+
+	s.totalBytesAcked += state.size
+	s.totalBytesSentAtLastAckedPacket = state.totalBytesSent
+	s.lastAckedPacketSentTime = state.sentTime
+	s.lastAckedPacketAckTime = ackTime
+
+	// Exit the app-limited phase once a packet that was sent while the connection
+	// was not app-limited is acknowledged.
+	if s.isAppLimited && pn > s.endOfAppLimitedPhase {
+		s.isAppLimited = false
+	}
+
+	// There might have been no packets acknowledged at the moment when the current packet was sent.
+	// In that case, there is no bandwidth data available.
+	if state.lastAckedPacketSentTime.IsZero() {
+		return bandwidthSample{}
+	}
+
+	// Infinite rate indicates that the sampler is supposed to discard the current send rate sample
+	// and use only the ack rate.
+	sendRate := Bandwidth(1<<64 - 1)
+	if state.sentTime.After(state.lastAckedPacketSentTime) {
+		sendRate = BandwidthFromDelta(
+			state.totalBytesSent-state.totalBytesSentAtLastAckedPacket,
+			state.sentTime.Sub(state.lastAckedPacketSentTime),
+		)
+	}
+	ackInterval := ackTime.Sub(state.lastAckedPacketAckTime)
+	if ackInterval <= 0 {
+		// Two packets acknowledged at the same time don't allow to take a sample.
+		return bandwidthSample{}
+	}
+	ackRate := BandwidthFromDelta(s.totalBytesAcked-state.totalBytesAcked, ackInterval)
+
+	sample := bandwidthSample{
+		bandwidth:    ackRate,
+		rtt:          ackTime.Sub(state.sentTime),
+		isAppLimited: state.isAppLimited,
+	}
+	if sendRate < ackRate {
+		sample.bandwidth = sendRate
+	}
+	return sample
+}
+
+// OnPacketLost must be called when a packet is declared lost.
+func (s *bandwidthSampler) OnPacketLost(pn protocol.PacketNumber) {
+	delete(s.packets, pn)
+}
+
+// OnAppLimited is called when the sender is application limited.
+// All samples taken until the next packet sent is acknowledged are marked as app-limited.
+func (s *bandwidthSampler) OnAppLimited() {
+	s.isAppLimited = true
+	s.endOfAppLimitedPhase = s.lastSentPacket
+}
+
+// RemoveObsoletePackets removes the state of all packets smaller than leastUnacked.
+// Not all packets are reported as acknowledged or lost, e.g. the handshake packets.
+func (s *bandwidthSampler) RemoveObsoletePackets(leastUnacked protocol.PacketNumber) {
+	for pn := range s.packets {
+		if pn < leastUnacked {
+			delete(s.packets, pn)
+		}
+	}
+}
+
+// TotalBytesAcked returns the number of bytes acknowledged since the sampler was created.
+func (s *bandwidthSampler) TotalBytesAcked() protocol.ByteCount {
+	return s.totalBytesAcked
+}
+
+// IsAppLimited says if the sampler is currently in an app-limited phase.
+func (s *bandwidthSampler) IsAppLimited() bool {
+	return s.isAppLimited
+}
@@ -0,0 +1,115 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bandwidth Sampler", func() {
+	const packetSize = protocol.DefaultTCPMSS
+
+	var (
+		sampler       *bandwidthSampler
+		now           time.Time
+		bytesInFlight protocol.ByteCount
+	)
+
+	BeforeEach(func() {
+		sampler = newBandwidthSampler()
+		now = time.Now()
+		bytesInFlight = 0
+	})
+
+	sendPacket := func(pn protocol.PacketNumber) {
+		sampler.OnPacketSent(now, pn, packetSize, bytesInFlight)
+		bytesInFlight += packetSize
+	}
+
+	ackPacket := func(pn protocol.PacketNumber) bandwidthSample {
+		bytesInFlight -= packetSize
+		return sampler.OnPacketAcked(now, pn)
+	}
+
+	It("takes a sample when packets are sent and acknowledged at a constant rate", func() {
+		// send packets every 10ms
+		timeBetweenPackets := 10 * time.Millisecond
+		expectedBandwidth := BandwidthFromDelta(packetSize, timeBetweenPackets)
+		sendPacket(1)
+		for pn := protocol.PacketNumber(2); pn <= 20; pn++ {
+			now = now.Add(timeBetweenPackets)
+			sample := ackPacket(pn - 1)
+			Expect(sample.bandwidth).To(Equal(expectedBandwidth))
+			Expect(sample.rtt).To(Equal(timeBetweenPackets))
+			sendPacket(pn)
+		}
+	})
+
+	It("limits the sample by the send rate, if packets are acknowledged in a burst", func() {
+		start := now
+		// send 20 packets, 10ms apart
+		for pn := protocol.PacketNumber(1); pn <= 20; pn++ {
+			now = start.Add(time.Duration(pn-1) * 10 * time.Millisecond)
+			if pn == 11 {
+				ackPacket(1)
+			}
+			sendPacket(pn)
+		}
+		// acknowledge all the other packets within 2ms
+		now = start.Add(200 * time.Millisecond)
+		var sample bandwidthSample
+		for pn := protocol.PacketNumber(2); pn <= 20; pn++ {
+			now = now.Add(100 * time.Microsecond)
+			sample = ackPacket(pn)
+		}
+		Expect(sample.bandwidth).To(Equal(BandwidthFromDelta(19*packetSize, 190*time.Millisecond)))
+	})
+
+	It("takes a sample for the first packet sent after a quiescence period", func() {
+		sendPacket(1)
+		now = now.Add(10 * time.Millisecond)
+		Expect(ackPacket(1).bandwidth).To(Equal(BandwidthFromDelta(packetSize, 10*time.Millisecond)))
+	})
+
+	It("doesn't take a sample if a packet is acknowledged immediately", func() {
+		sendPacket(1)
+		Expect(ackPacket(1).bandwidth).To(BeZero())
+	})
+
+	It("ignores unknown and lost packets", func() {
+		sendPacket(1)
+		sampler.OnPacketLost(1)
+		Expect(ackPacket(1)).To(Equal(bandwidthSample{}))
+		Expect(sampler.TotalBytesAcked()).To(BeZero())
+	})
+
+	It("marks samples as app-limited", func() {
+		sendPacket(1)
+		sendPacket(2)
+		sampler.OnAppLimited()
+		Expect(sampler.IsAppLimited()).To(BeTrue())
+		sendPacket(3)
+		sendPacket(4)
+		now = now.Add(10 * time.Millisecond)
+		Expect(ackPacket(1).isAppLimited).To(BeFalse())
+		now = now.Add(10 * time.Millisecond)
+		Expect(ackPacket(2).isAppLimited).To(BeFalse())
+		// packet 2 was the last packet sent before the app-limited phase
+		Expect(sampler.IsAppLimited()).To(BeTrue())
+		now = now.Add(10 * time.Millisecond)
+		Expect(ackPacket(3).isAppLimited).To(BeTrue())
+		Expect(sampler.IsAppLimited()).To(BeFalse())
+	})
+
+	It("removes obsolete packets", func() {
+		for pn := protocol.PacketNumber(1); pn <= 10; pn++ {
+			sendPacket(pn)
+		}
+		sampler.RemoveObsoletePackets(6)
+		Expect(sampler.packets).To(HaveLen(5))
+		Expect(sampler.packets).To(HaveKey(protocol.PacketNumber(6)))
+	})
+})
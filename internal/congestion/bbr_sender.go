@@ -0,0 +1,521 @@
+package congestion
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+)
+
+// This is an implementation of BBR (version 1), see
+// https://tools.ietf.org/html/draft-cardwell-iccrg-bbr-congestion-control.
+// It follows the implementation in Chromium.
+
+const (
+	// The gain used for the pacing rate and the congestion window during startup.
+	// This is 2/ln(2), the smallest gain that allows to double the sending rate every round trip.
+	bbrHighGain = 2.885
+	// The gain used in drain, to drain the queue created during startup within one round trip.
+	bbrDrainGain = 1 / bbrHighGain
+	// The gain used for the congestion window in probe bandwidth.
+	bbrCongestionWindowGain = 2
+	// The length of the window of the max bandwidth filter, in round trips.
+	bbrBandwidthWindowLength = uint64(len(bbrPacingGainCycle) + 2)
+	// Startup is exited if the bandwidth doesn't grow by at least 25%
+	// for bbrRoundTripsWithoutGrowthBeforeExitingStartup round trips.
+	bbrStartupGrowthTarget                                            = 1.25
+	bbrRoundTripsWithoutGrowthBeforeExitingStartup                    = 3
+	bbrMinRTTExpiry                                                   = 10 * time.Second
+	bbrProbeRTTTime                                                   = 200 * time.Millisecond
+	bbrMinCongestionWindow                         protocol.ByteCount = 4 * protocol.DefaultTCPMSS
+)
+
+// The pacing gains used in probe bandwidth.
+// In the first phase, the bandwidth is probed. In the second phase, the queue that might have built up is drained.
+var bbrPacingGainCycle = [...]float64{1.25, 0.75, 1, 1, 1, 1, 1, 1}
+
+type bbrMode uint8
+
+const (
+	// bbrModeStartup exponentially grows the sending rate, until the bandwidth stops growing
+	bbrModeStartup bbrMode = iota
+	// bbrModeDrain drains the queue built up during startup
+	bbrModeDrain
+	// bbrModeProbeBandwidth cycles through the pacing gains to probe for more bandwidth
+	bbrModeProbeBandwidth
+	// bbrModeProbeRTT reduces the amount of data in flight, to measure the minimum RTT
+	bbrModeProbeRTT
+)
+
+type bbrRecoveryState uint8
+
+const (
+	bbrNotInRecovery bbrRecoveryState = iota
+	// bbrConservation allows one packet to be sent for every packet acknowledged
+	bbrConservation
+	// bbrGrowth allows two packets to be sent for every packet acknowledged
+	bbrGrowth
+)
+
+type bbrSender struct {
+	rttStats RTTStatsProvider
+	sampler  *bandwidthSampler
+
+	mode bbrMode
+
+	roundTripCount      uint64
+	currentRoundTripEnd protocol.PacketNumber
+	lastSentPacket      protocol.PacketNumber
+	lastSentPacketSize  protocol.ByteCount
+
+	maxBandwidth *windowedMaxFilter
+
+	minRTT          time.Duration
+	minRTTTimestamp time.Time
+
+	congestionWindow        protocol.ByteCount
+	initialCongestionWindow protocol.ByteCount
+	maxCongestionWindow     protocol.ByteCount
+
+	pacingRate           Bandwidth
+	pacingGain           float64
+	congestionWindowGain float64
+
+	cycleCurrentOffset int
+	lastCycleStart     time.Time
+
+	isAtFullBandwidth          bool
+	roundsWithoutBandwidthGain int
+	bandwidthAtLastRound       Bandwidth
+	lastSampleIsAppLimited     bool
+
+	// exitingQuiescence is set when the first packet is sent after the connection was idle.
+	// It prevents entering probe RTT, since the connection was idle anyway.
+	exitingQuiescence   bool
+	exitProbeRTTAt      time.Time
+	probeRTTRoundPassed bool
+
+	recoveryState  bbrRecoveryState
+	endRecoveryAt  protocol.PacketNumber
+	recoveryWindow protocol.ByteCount
+
+	// The bytes in flight. They are updated with every packet sent and acknowledged.
+	bytesInFlight protocol.ByteCount
+	lastAckTime   time.Time
+}
+
+var _ SendAlgorithm = &bbrSender{}
+
+// NewBBRSender makes a new BBR sender
+func NewBBRSender(rttStats RTTStatsProvider, initialCongestionWindow, maxCongestionWindow protocol.ByteCount) SendAlgorithm {
+	b := &bbrSender{
+		rttStats:                rttStats,
+		initialCongestionWindow: initialCongestionWindow,
+		maxCongestionWindow:     maxCongestionWindow,
+	}
+	b.reset()
+	return b
+}
+
+func (b *bbrSender) reset() {
+	b.sampler = newBandwidthSampler()
+	b.maxBandwidth = newWindowedMaxFilter(bbrBandwidthWindowLength)
+	b.roundTripCount = 0
+	b.currentRoundTripEnd = 0
+	b.lastSentPacket = 0
+	b.minRTT = 0
+	b.minRTTTimestamp = time.Time{}
+	b.congestionWindow = b.initialCongestionWindow
+	b.pacingRate = 0
+	b.isAtFullBandwidth = false
+	b.roundsWithoutBandwidthGain = 0
+	b.bandwidthAtLastRound = 0
+	b.lastSampleIsAppLimited = false
+	b.exitingQuiescence = false
+	b.exitProbeRTTAt = time.Time{}
+	b.recoveryState = bbrNotInRecovery
+	b.endRecoveryAt = 0
+	b.recoveryWindow = b.maxCongestionWindow
+	b.enterStartupMode()
+}
+
+// TimeUntilSend returns the pacing delay for the packet sent last.
+func (b *bbrSender) TimeUntilSend(bytesInFlight protocol.ByteCount) time.Duration {
+	size := b.lastSentPacketSize
+	if size == 0 {
+		size = protocol.DefaultTCPMSS
+	}
+	return time.Duration(float64(size) * float64(BytesPerSecond) / float64(b.PacingRate()) * float64(time.Second))
+}
+
+// PacingRate returns the current pacing rate.
+func (b *bbrSender) PacingRate() Bandwidth {
+	if b.pacingRate == 0 {
+		return Bandwidth(bbrHighGain * float64(BandwidthFromDelta(b.initialCongestionWindow, b.getMinRTT())))
+	}
+	return b.pacingRate
+}
+
+func (b *bbrSender) OnPacketSent(
+	sentTime time.Time,
+	bytesInFlight protocol.ByteCount,
+	packetNumber protocol.PacketNumber,
+	bytes protocol.ByteCount,
+	isRetransmittable bool,
+) {
+	b.lastSentPacket = packetNumber
+	if !isRetransmittable {
+		return
+	}
+	// The sent packet handler reports the bytes in flight after the packet was sent.
+	priorInFlight := bytesInFlight - bytes
+	if priorInFlight == 0 && b.sampler.IsAppLimited() {
+		b.exitingQuiescence = true
+	}
+	b.bytesInFlight = bytesInFlight
+	b.lastSentPacketSize = bytes
+	b.sampler.OnPacketSent(sentTime, packetNumber, bytes, priorInFlight)
+}
+
+func (b *bbrSender) GetCongestionWindow() protocol.ByteCount {
+	if b.mode == bbrModeProbeRTT {
+		return bbrMinCongestionWindow
+	}
+	if b.InRecovery() {
+		return utils.MinByteCount(b.congestionWindow, b.recoveryWindow)
+	}
+	return b.congestionWindow
+}
+
+// OnRTTUpdated is a no-op, BBR takes the RTT samples when packets are acknowledged.
+func (b *bbrSender) OnRTTUpdated() {}
+
+// MaybeExitSlowStart is a no-op, BBR decides on its own when to leave startup.
+func (b *bbrSender) MaybeExitSlowStart() {}
+
+func (b *bbrSender) OnPacketAcked(
+	ackedPacketNumber protocol.PacketNumber,
+	ackedBytes protocol.ByteCount,
+	priorInFlight protocol.ByteCount,
+	eventTime time.Time,
+) {
+	// All packets acknowledged by the same ACK frame are reported with the same priorInFlight.
+	if eventTime != b.lastAckTime {
+		b.lastAckTime = eventTime
+		b.bytesInFlight = priorInFlight
+	}
+	b.reduceBytesInFlight(ackedBytes)
+
+	isRoundStart := b.updateRoundTripCounter(ackedPacketNumber)
+	b.updateRecoveryState(ackedPacketNumber, false, isRoundStart)
+
+	sample := b.sampler.OnPacketAcked(eventTime, ackedPacketNumber)
+	if len(b.sampler.packets) > protocol.MaxTrackedSentPackets {
+		b.sampler.RemoveObsoletePackets(ackedPacketNumber)
+	}
+	b.lastSampleIsAppLimited = sample.isAppLimited
+	if sample.bandwidth > 0 && (!sample.isAppLimited || sample.bandwidth > b.maxBandwidth.GetBest()) {
+		b.maxBandwidth.Update(sample.bandwidth, b.roundTripCount)
+	}
+	minRTTExpired := b.updateMinRTT(eventTime, b.rttStats.LatestRTT())
+
+	if b.mode == bbrModeProbeBandwidth {
+		b.updateGainCyclePhase(eventTime, priorInFlight, false)
+	}
+	if isRoundStart && !b.isAtFullBandwidth {
+		b.checkIfFullBandwidthReached()
+	}
+	b.maybeExitStartupOrDrain(eventTime)
+	b.maybeEnterOrExitProbeRTT(eventTime, isRoundStart, minRTTExpired)
+
+	b.calculatePacingRate()
+	b.calculateCongestionWindow(ackedBytes)
+	b.calculateRecoveryWindow(ackedBytes, 0)
+}
+
+// OnPacketLost is called when a packet is lost.
+// BBR doesn't reduce its sending rate because of losses, but limits the bytes in flight during recovery.
+func (b *bbrSender) OnPacketLost(
+	packetNumber protocol.PacketNumber,
+	lostBytes protocol.ByteCount,
+	priorInFlight protocol.ByteCount,
+) {
+	b.reduceBytesInFlight(lostBytes)
+	b.sampler.OnPacketLost(packetNumber)
+	b.updateRecoveryState(packetNumber, true, false)
+	if b.mode == bbrModeProbeBandwidth {
+		b.updateGainCyclePhase(b.lastAckTime, priorInFlight, true)
+	}
+	b.calculateRecoveryWindow(0, lostBytes)
+}
+
+func (b *bbrSender) reduceBytesInFlight(bytes protocol.ByteCount) {
+	if bytes > b.bytesInFlight {
+		b.bytesInFlight = 0
+		return
+	}
+	b.bytesInFlight -= bytes
+}
+
+// OnECNCongestionEvent is a no-op. Like loss, ECN marks are not used as a signal for congestion by BBR.
+func (b *bbrSender) OnECNCongestionEvent(protocol.PacketNumber, protocol.ByteCount) {}
+
+// OnRetransmissionTimeout is a no-op. The bandwidth estimate is not affected by an RTO.
+func (b *bbrSender) OnRetransmissionTimeout(packetsRetransmitted bool) {}
+
+// OnConnectionMigration resets the bandwidth and RTT estimates.
+func (b *bbrSender) OnConnectionMigration() {
+	b.reset()
+}
+
+// InSlowStart returns true if BBR is in startup.
+func (b *bbrSender) InSlowStart() bool {
+	return b.mode == bbrModeStartup
+}
+
+func (b *bbrSender) InRecovery() bool {
+	return b.recoveryState != bbrNotInRecovery
+}
+
+// BandwidthEstimate returns the current bandwidth estimate
+func (b *bbrSender) BandwidthEstimate() Bandwidth {
+	return b.maxBandwidth.GetBest()
+}
+
+func (b *bbrSender) getMinRTT() time.Duration {
+	if b.minRTT == 0 {
+		return defaultInitialRTT
+	}
+	return b.minRTT
+}
+
+// getTargetCongestionWindow returns the bandwidth-delay product, multiplied by the gain.
+func (b *bbrSender) getTargetCongestionWindow(gain float64) protocol.ByteCount {
+	bdp := float64(b.maxBandwidth.GetBest()) / float64(BytesPerSecond) * b.getMinRTT().Seconds()
+	congestionWindow := protocol.ByteCount(gain * bdp)
+	// If the BDP is unknown, use the initial congestion window.
+	if congestionWindow == 0 {
+		congestionWindow = protocol.ByteCount(gain * float64(b.initialCongestionWindow))
+	}
+	return utils.MaxByteCount(congestionWindow, bbrMinCongestionWindow)
+}
+
+func (b *bbrSender) enterStartupMode() {
+	b.mode = bbrModeStartup
+	b.pacingGain = bbrHighGain
+	b.congestionWindowGain = bbrHighGain
+}
+
+func (b *bbrSender) enterProbeBandwidthMode(now time.Time) {
+	b.mode = bbrModeProbeBandwidth
+	b.congestionWindowGain = bbrCongestionWindowGain
+	// Pick a random offset for the gain cycle, such that different flows don't synchronize.
+	// The drain phase (offset 1) is skipped, since it would follow the probing phase.
+	b.cycleCurrentOffset = rand.Intn(len(bbrPacingGainCycle) - 1)
+	if b.cycleCurrentOffset >= 1 {
+		b.cycleCurrentOffset++
+	}
+	b.lastCycleStart = now
+	b.pacingGain = bbrPacingGainCycle[b.cycleCurrentOffset]
+}
+
+// updateRoundTripCounter updates the round trip counter.
+// A new round starts when a packet sent after the end of the last round is acknowledged.
+func (b *bbrSender) updateRoundTripCounter(lastAcked protocol.PacketNumber) bool {
+	if lastAcked > b.currentRoundTripEnd {
+		b.roundTripCount++
+		b.currentRoundTripEnd = b.lastSentPacket
+		return true
+	}
+	return false
+}
+
+// updateMinRTT updates the min RTT. It returns true if the min RTT expired.
+func (b *bbrSender) updateMinRTT(now time.Time, sample time.Duration) bool {
+	if sample <= 0 {
+		return false
+	}
+	minRTTExpired := b.minRTT != 0 && now.After(b.minRTTTimestamp.Add(bbrMinRTTExpiry))
+	if minRTTExpired || sample < b.minRTT || b.minRTT == 0 {
+		b.minRTT = sample
+		b.minRTTTimestamp = now
+	}
+	return minRTTExpired
+}
+
+func (b *bbrSender) updateGainCyclePhase(now time.Time, priorInFlight protocol.ByteCount, hasLosses bool) {
+	// In most cases, the cycle is advanced after an RTT passes.
+	shouldAdvanceGainCycling := now.Sub(b.lastCycleStart) > b.getMinRTT()
+	// If the pacing gain is above 1, the connection is trying to probe the bandwidth by increasing the bytes in flight.
+	// Treat it as a probing phase, until there are losses or the target congestion window is reached.
+	if b.pacingGain > 1 && !hasLosses && priorInFlight < b.getTargetCongestionWindow(b.pacingGain) {
+		shouldAdvanceGainCycling = false
+	}
+	// If the pacing gain is below 1, the connection is trying to drain the extra queue created during probing.
+	// Exit the drain phase as soon as the bytes in flight reach the BDP.
+	if b.pacingGain < 1 && priorInFlight <= b.getTargetCongestionWindow(1) {
+		shouldAdvanceGainCycling = true
+	}
+	if shouldAdvanceGainCycling {
+		b.cycleCurrentOffset = (b.cycleCurrentOffset + 1) % len(bbrPacingGainCycle)
+		b.lastCycleStart = now
+		b.pacingGain = bbrPacingGainCycle[b.cycleCurrentOffset]
+	}
+}
+
+func (b *bbrSender) checkIfFullBandwidthReached() {
+	if b.lastSampleIsAppLimited {
+		return
+	}
+	target := Bandwidth(bbrStartupGrowthTarget * float64(b.bandwidthAtLastRound))
+	if bw := b.maxBandwidth.GetBest(); bw >= target {
+		b.bandwidthAtLastRound = bw
+		b.roundsWithoutBandwidthGain = 0
+		return
+	}
+	b.roundsWithoutBandwidthGain++
+	if b.roundsWithoutBandwidthGain >= bbrRoundTripsWithoutGrowthBeforeExitingStartup {
+		b.isAtFullBandwidth = true
+	}
+}
+
+func (b *bbrSender) maybeExitStartupOrDrain(now time.Time) {
+	if b.mode == bbrModeStartup && b.isAtFullBandwidth {
+		b.mode = bbrModeDrain
+		b.pacingGain = bbrDrainGain
+		b.congestionWindowGain = bbrHighGain
+	}
+	if b.mode == bbrModeDrain && b.bytesInFlight <= b.getTargetCongestionWindow(1) {
+		b.enterProbeBandwidthMode(now)
+	}
+}
+
+func (b *bbrSender) maybeEnterOrExitProbeRTT(now time.Time, isRoundStart, minRTTExpired bool) {
+	if minRTTExpired && !b.exitingQuiescence && b.mode != bbrModeProbeRTT {
+		b.mode = bbrModeProbeRTT
+		b.pacingGain = 1
+		// Do not decide on the time to exit probe RTT until the bytes in flight are reduced.
+		b.exitProbeRTTAt = time.Time{}
+	}
+
+	if b.mode == bbrModeProbeRTT {
+		// The bandwidth samples taken in probe RTT don't reflect the available bandwidth.
+		b.sampler.OnAppLimited()
+
+		if b.exitProbeRTTAt.IsZero() {
+			// If the window has reached the appropriate size, schedule exiting probe RTT.
+			// The CWND during probe RTT is bbrMinCongestionWindow,
+			// but we allow an extra packet since QUIC checks the CWND before sending a packet.
+			if b.bytesInFlight < bbrMinCongestionWindow+protocol.MaxPacketSizeIPv4 {
+				b.exitProbeRTTAt = now.Add(bbrProbeRTTTime)
+				b.probeRTTRoundPassed = false
+			}
+		} else {
+			if isRoundStart {
+				b.probeRTTRoundPassed = true
+			}
+			if !now.Before(b.exitProbeRTTAt) && b.probeRTTRoundPassed {
+				b.minRTTTimestamp = now
+				if !b.isAtFullBandwidth {
+					b.enterStartupMode()
+				} else {
+					b.enterProbeBandwidthMode(now)
+				}
+			}
+		}
+	}
+	b.exitingQuiescence = false
+}
+
+func (b *bbrSender) updateRecoveryState(lastPacket protocol.PacketNumber, hasLosses, isRoundStart bool) {
+	// Exit recovery when there are no losses for a round.
+	if hasLosses {
+		b.endRecoveryAt = b.lastSentPacket
+	}
+
+	switch b.recoveryState {
+	case bbrNotInRecovery:
+		// Enter conservation on the first loss.
+		if hasLosses {
+			b.recoveryState = bbrConservation
+			// This will cause the recovery window to be set to the correct value in calculateRecoveryWindow.
+			b.recoveryWindow = 0
+			// Since the conservation phase is meant to last for a whole round,
+			// extend the current round as if it were started right now.
+			b.currentRoundTripEnd = b.lastSentPacket
+		}
+	case bbrConservation:
+		if isRoundStart {
+			b.recoveryState = bbrGrowth
+		}
+		fallthrough
+	case bbrGrowth:
+		// Exit recovery if appropriate.
+		if !hasLosses && lastPacket > b.endRecoveryAt {
+			b.recoveryState = bbrNotInRecovery
+		}
+	}
+}
+
+func (b *bbrSender) calculatePacingRate() {
+	bw := b.maxBandwidth.GetBest()
+	if bw == 0 {
+		return
+	}
+	targetRate := Bandwidth(b.pacingGain * float64(bw))
+	if b.isAtFullBandwidth {
+		b.pacingRate = targetRate
+		return
+	}
+	// Pace at the rate of initial_window / RTT as soon as RTT measurements are available.
+	if b.pacingRate == 0 && b.rttStats.MinRTT() != 0 {
+		b.pacingRate = BandwidthFromDelta(b.initialCongestionWindow, b.rttStats.MinRTT())
+		return
+	}
+	// Do not decrease the pacing rate during startup.
+	if targetRate > b.pacingRate {
+		b.pacingRate = targetRate
+	}
+}
+
+func (b *bbrSender) calculateCongestionWindow(bytesAcked protocol.ByteCount) {
+	if b.mode == bbrModeProbeRTT {
+		return
+	}
+	targetWindow := b.getTargetCongestionWindow(b.congestionWindowGain)
+	if b.isAtFullBandwidth {
+		// If the connection is at full bandwidth, slowly approach the target window.
+		b.congestionWindow = utils.MinByteCount(targetWindow, b.congestionWindow+bytesAcked)
+	} else if b.congestionWindow < targetWindow || b.sampler.TotalBytesAcked() < b.initialCongestionWindow {
+		// If the connection is not yet out of startup phase, do not decrease the window.
+		b.congestionWindow += bytesAcked
+	}
+	b.congestionWindow = utils.MaxByteCount(b.congestionWindow, bbrMinCongestionWindow)
+	b.congestionWindow = utils.MinByteCount(b.congestionWindow, b.maxCongestionWindow)
+}
+
+func (b *bbrSender) calculateRecoveryWindow(bytesAcked, bytesLost protocol.ByteCount) {
+	if b.recoveryState == bbrNotInRecovery {
+		return
+	}
+	// Set up the initial recovery window.
+	if b.recoveryWindow == 0 {
+		b.recoveryWindow = utils.MaxByteCount(b.bytesInFlight+bytesAcked, bbrMinCongestionWindow)
+		return
+	}
+	// Remove losses from the recovery window, while accounting for a potential integer underflow.
+	if b.recoveryWindow >= bytesLost {
+		b.recoveryWindow -= bytesLost
+	} else {
+		b.recoveryWindow = protocol.DefaultTCPMSS
+	}
+	// In conservation mode, just subtracting losses is sufficient.
+	// In growth, release additional bytesAcked to achieve a slow-start-like behavior.
+	if b.recoveryState == bbrGrowth {
+		b.recoveryWindow += bytesAcked
+	}
+	// Sanity checks. Ensure that we always allow to send at least bytesAcked in response.
+	b.recoveryWindow = utils.MaxByteCount(b.recoveryWindow, b.bytesInFlight+bytesAcked)
+	b.recoveryWindow = utils.MaxByteCount(b.recoveryWindow, bbrMinCongestionWindow)
+}
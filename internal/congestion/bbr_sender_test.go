@@ -0,0 +1,179 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A simulatedLink is a bottleneck link with a fixed bandwidth and RTT.
+// Every packet is acknowledged separately.
+type simulatedLink struct {
+	bandwidth Bandwidth
+	rtt       time.Duration
+	// drop decides if a packet is dropped
+	drop func(protocol.PacketNumber) bool
+
+	now              time.Time
+	lastDeparture    time.Time
+	nextSendTime     time.Time
+	bytesInFlight    protocol.ByteCount
+	lastPacketNumber protocol.PacketNumber
+	inFlight         []simulatedPacket
+	maxBytesInFlight protocol.ByteCount
+	deliveredBytes   protocol.ByteCount
+	observedModes    map[bbrMode]bool
+	observedRecovery bool
+}
+
+type simulatedPacket struct {
+	pn       protocol.PacketNumber
+	sentTime time.Time
+	ackTime  time.Time
+	dropped  bool
+}
+
+const simulatedPacketSize = protocol.ByteCount(1200)
+
+func (l *simulatedLink) run(sender *bbrSender, rttStats *RTTStats, duration time.Duration) {
+	end := l.now.Add(duration)
+	for l.now.Before(end) {
+		// send as many packets as the congestion controller and the pacer allow
+		for l.bytesInFlight+simulatedPacketSize <= sender.GetCongestionWindow() && !l.nextSendTime.After(l.now) {
+			l.lastPacketNumber++
+			l.bytesInFlight += simulatedPacketSize
+			l.maxBytesInFlight = utils.MaxByteCount(l.maxBytesInFlight, l.bytesInFlight)
+			sender.OnPacketSent(l.now, l.bytesInFlight, l.lastPacketNumber, simulatedPacketSize, true)
+			l.nextSendTime = utils.MaxTime(l.nextSendTime, l.now).Add(sender.TimeUntilSend(l.bytesInFlight))
+			departure := utils.MaxTime(l.now, l.lastDeparture).Add(time.Duration(float64(simulatedPacketSize) * float64(BytesPerSecond) / float64(l.bandwidth) * float64(time.Second)))
+			l.lastDeparture = departure
+			l.inFlight = append(l.inFlight, simulatedPacket{
+				pn:       l.lastPacketNumber,
+				sentTime: l.now,
+				ackTime:  departure.Add(l.rtt),
+				dropped:  l.drop != nil && l.drop(l.lastPacketNumber),
+			})
+		}
+		// advance the time to the next event
+		next := end
+		if len(l.inFlight) > 0 && l.inFlight[0].ackTime.Before(next) {
+			next = l.inFlight[0].ackTime
+		}
+		if l.bytesInFlight+simulatedPacketSize <= sender.GetCongestionWindow() && l.nextSendTime.Before(next) {
+			next = l.nextSendTime
+		}
+		if next.After(l.now) {
+			l.now = next
+		}
+		// Acknowledge packets. Dropped packets are declared lost at the time they would have been acknowledged.
+		for len(l.inFlight) > 0 && !l.inFlight[0].ackTime.After(l.now) {
+			p := l.inFlight[0]
+			l.inFlight = l.inFlight[1:]
+			priorInFlight := l.bytesInFlight
+			l.bytesInFlight -= simulatedPacketSize
+			if p.dropped {
+				sender.OnPacketLost(p.pn, simulatedPacketSize, priorInFlight)
+				continue
+			}
+			rttStats.UpdateRTT(l.now.Sub(p.sentTime), 0, l.now)
+			sender.OnPacketAcked(p.pn, simulatedPacketSize, priorInFlight, l.now)
+			l.deliveredBytes += simulatedPacketSize
+		}
+		l.observedModes[sender.mode] = true
+		if sender.InRecovery() {
+			l.observedRecovery = true
+		}
+	}
+}
+
+var _ = Describe("BBR Sender", func() {
+	const (
+		bandwidth = 10 * 1000 * 1000 * BitsPerSecond
+		rtt       = 50 * time.Millisecond
+	)
+
+	var (
+		sender   *bbrSender
+		rttStats *RTTStats
+		link     *simulatedLink
+	)
+
+	BeforeEach(func() {
+		rttStats = NewRTTStats()
+		sender = NewBBRSender(rttStats, 10*protocol.DefaultTCPMSS, protocol.DefaultMaxCongestionWindow).(*bbrSender)
+		link = &simulatedLink{
+			bandwidth:     bandwidth,
+			rtt:           rtt,
+			now:           time.Now(),
+			observedModes: make(map[bbrMode]bool),
+		}
+	})
+
+	It("starts in startup", func() {
+		Expect(sender.InSlowStart()).To(BeTrue())
+		Expect(sender.InRecovery()).To(BeFalse())
+		Expect(sender.GetCongestionWindow()).To(Equal(10 * protocol.DefaultTCPMSS))
+		Expect(sender.BandwidthEstimate()).To(BeZero())
+	})
+
+	It("paces at a high rate before the bandwidth is known", func() {
+		Expect(sender.PacingRate()).To(Equal(Bandwidth(bbrHighGain * float64(BandwidthFromDelta(10*protocol.DefaultTCPMSS, defaultInitialRTT)))))
+		Expect(sender.TimeUntilSend(0)).To(BeNumerically(">", 0))
+	})
+
+	It("estimates the bandwidth and the min RTT", func() {
+		link.run(sender, rttStats, 5*time.Second)
+		Expect(sender.BandwidthEstimate()).To(BeNumerically("~", bandwidth, bandwidth/10))
+		Expect(sender.minRTT).To(BeNumerically("~", rtt, 2*time.Millisecond))
+		Expect(link.observedModes).To(HaveKey(bbrModeStartup))
+		Expect(link.observedModes).To(HaveKey(bbrModeDrain))
+		Expect(sender.mode).To(Equal(bbrModeProbeBandwidth))
+		Expect(sender.InSlowStart()).To(BeFalse())
+		// the link is fully utilized
+		Expect(link.deliveredBytes).To(BeNumerically(">", protocol.ByteCount(0.9*5*float64(bandwidth/BytesPerSecond))-sender.initialCongestionWindow*10))
+	})
+
+	It("doesn't build up a large queue", func() {
+		link.run(sender, rttStats, 3*time.Second)
+		bdp := protocol.ByteCount(float64(bandwidth/BytesPerSecond) * rtt.Seconds())
+		link.maxBytesInFlight = 0
+		link.run(sender, rttStats, 3*time.Second)
+		// In probe bandwidth, the pacing gain is at most 1.25, and the congestion window is 2 BDP.
+		Expect(link.maxBytesInFlight).To(BeNumerically("<=", 2*bdp+simulatedPacketSize))
+		Expect(rttStats.SmoothedRTT()).To(BeNumerically("<", 2*rtt))
+	})
+
+	It("enters probe RTT when the min RTT expires", func() {
+		link.run(sender, rttStats, bbrMinRTTExpiry+2*time.Second)
+		Expect(link.observedModes).To(HaveKey(bbrModeProbeRTT))
+		Expect(sender.mode).To(Equal(bbrModeProbeBandwidth))
+	})
+
+	It("doesn't collapse if packets are lost randomly", func() {
+		link.drop = func(pn protocol.PacketNumber) bool { return pn%50 == 0 }
+		link.run(sender, rttStats, 5*time.Second)
+		Expect(link.observedRecovery).To(BeTrue())
+		Expect(sender.BandwidthEstimate()).To(BeNumerically("~", bandwidth, bandwidth/5))
+		Expect(link.deliveredBytes).To(BeNumerically(">", protocol.ByteCount(0.8*5*float64(bandwidth/BytesPerSecond))))
+	})
+
+	It("limits the congestion window during recovery", func() {
+		link.run(sender, rttStats, time.Second)
+		sender.OnPacketLost(link.lastPacketNumber, simulatedPacketSize, link.bytesInFlight)
+		Expect(sender.InRecovery()).To(BeTrue())
+		Expect(sender.GetCongestionWindow()).To(BeNumerically("<=", link.bytesInFlight))
+	})
+
+	It("resets the state on connection migration", func() {
+		link.run(sender, rttStats, 2*time.Second)
+		Expect(sender.InSlowStart()).To(BeFalse())
+		sender.OnConnectionMigration()
+		Expect(sender.InSlowStart()).To(BeTrue())
+		Expect(sender.BandwidthEstimate()).To(BeZero())
+		Expect(sender.GetCongestionWindow()).To(Equal(10 * protocol.DefaultTCPMSS))
+	})
+})
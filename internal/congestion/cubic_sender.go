@@ -16,7 +16,7 @@ const (
 type cubicSender struct {
 	hybridSlowStart HybridSlowStart
 	prr             PrrSender
-	rttStats        *RTTStats
+	rttStats        RTTStatsProvider
 	stats           connectionStats
 	cubic           *Cubic
 
@@ -66,7 +66,7 @@ var _ SendAlgorithm = &cubicSender{}
 var _ SendAlgorithmWithDebugInfo = &cubicSender{}
 
 // NewCubicSender makes a new cubic sender
-func NewCubicSender(clock Clock, rttStats *RTTStats, reno bool, initialCongestionWindow, initialMaxCongestionWindow protocol.ByteCount) SendAlgorithmWithDebugInfo {
+func NewCubicSender(clock Clock, rttStats RTTStatsProvider, reno bool, initialCongestionWindow, initialMaxCongestionWindow protocol.ByteCount) SendAlgorithmWithDebugInfo {
 	return &cubicSender{
 		rttStats:                   rttStats,
 		initialCongestionWindow:    initialCongestionWindow,
@@ -138,6 +138,8 @@ func (c *cubicSender) SlowstartThreshold() protocol.ByteCount {
 	return c.slowstartThreshold
 }
 
+func (c *cubicSender) OnRTTUpdated() {}
+
 func (c *cubicSender) MaybeExitSlowStart() {
 	if c.InSlowStart() && c.hybridSlowStart.ShouldExitSlowStart(c.rttStats.LatestRTT(), c.rttStats.MinRTT(), c.GetCongestionWindow()/protocol.DefaultTCPMSS) {
 		c.ExitSlowstart()
@@ -209,6 +211,15 @@ func (c *cubicSender) OnPacketLost(
 	c.numAckedPackets = 0
 }
 
+// OnECNCongestionEvent reacts to a CE mark like to a packet loss (see RFC 3168, section 6.1.2).
+// The congestion window is reduced at most once per RTT.
+func (c *cubicSender) OnECNCongestionEvent(largestAcked protocol.PacketNumber, priorInFlight protocol.ByteCount) {
+	if largestAcked <= c.largestSentAtLastCutback {
+		return
+	}
+	c.OnPacketLost(largestAcked, 0, priorInFlight)
+}
+
 func (c *cubicSender) RenoBeta() float32 {
 	// kNConnectionBeta is the backoff factor after loss for our N-connection
 	// emulation, which emulates the effective backoff of an ensemble of N
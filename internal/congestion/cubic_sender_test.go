@@ -458,6 +458,19 @@ var _ = Describe("Cubic Sender", func() {
 		Expect(postLossWindow).To(BeNumerically(">", sender.GetCongestionWindow()))
 	})
 
+	It("reduces the congestion window on ECN-CE marks, once per window", func() {
+		SendAvailableSendWindow()
+		AckNPackets(2)
+		initialWindow := sender.GetCongestionWindow()
+		sender.OnECNCongestionEvent(ackedPacketNumber, bytesInFlight)
+		postCEWindow := sender.GetCongestionWindow()
+		Expect(postCEWindow).To(BeNumerically("<", initialWindow))
+		Expect(sender.InRecovery()).To(BeTrue())
+		// another CE mark for a packet sent before the reduction
+		sender.OnECNCongestionEvent(packetNumber-1, bytesInFlight)
+		Expect(sender.GetCongestionWindow()).To(Equal(postCEWindow))
+	})
+
 	It("2 connection congestion avoidance at end of recovery", func() {
 		sender.SetNumEmulatedConnections(2)
 		// Ack 10 packets in 5 acks to raise the CWND to 20.
@@ -6,20 +6,25 @@ import (
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 )
 
-// A SendAlgorithm performs congestion control and calculates the congestion window
+// A SendAlgorithm performs congestion control and calculates the congestion window.
+// It only contains the methods used by the sent packet handler.
 type SendAlgorithm interface {
 	TimeUntilSend(bytesInFlight protocol.ByteCount) time.Duration
 	OnPacketSent(sentTime time.Time, bytesInFlight protocol.ByteCount, packetNumber protocol.PacketNumber, bytes protocol.ByteCount, isRetransmittable bool)
 	GetCongestionWindow() protocol.ByteCount
+	// OnRTTUpdated is called when a new RTT sample was taken.
+	// It is called before MaybeExitSlowStart, and before the packets acknowledged by the same ACK frame are passed to OnPacketAcked.
+	OnRTTUpdated()
 	MaybeExitSlowStart()
 	OnPacketAcked(number protocol.PacketNumber, ackedBytes protocol.ByteCount, priorInFlight protocol.ByteCount, eventTime time.Time)
 	OnPacketLost(number protocol.PacketNumber, lostBytes protocol.ByteCount, priorInFlight protocol.ByteCount)
-	SetNumEmulatedConnections(n int)
+	// OnECNCongestionEvent is called when the peer reports that it received packets marked with ECN-CE.
+	// largestAcked is the largest packet number acknowledged by the ACK frame reporting the CE marks.
+	OnECNCongestionEvent(largestAcked protocol.PacketNumber, priorInFlight protocol.ByteCount)
 	OnRetransmissionTimeout(packetsRetransmitted bool)
 	OnConnectionMigration()
-
-	// Experiments
-	SetSlowStartLargeReduction(enabled bool)
+	InSlowStart() bool
+	InRecovery() bool
 }
 
 // SendAlgorithmWithDebugInfo adds some debug functions to SendAlgorithm
@@ -29,8 +34,20 @@ type SendAlgorithmWithDebugInfo interface {
 
 	// Stuff only used in testing
 
+	SetNumEmulatedConnections(n int)
 	HybridSlowStart() *HybridSlowStart
 	SlowstartThreshold() protocol.ByteCount
 	RenoBeta() float32
-	InRecovery() bool
+
+	// Experiments
+	SetSlowStartLargeReduction(enabled bool)
+}
+
+// RTTStatsProvider gives read-only access to the RTT statistics of a connection.
+// It is implemented by the RTTStats.
+type RTTStatsProvider interface {
+	MinRTT() time.Duration
+	LatestRTT() time.Duration
+	SmoothedRTT() time.Duration
+	MeanDeviation() time.Duration
 }
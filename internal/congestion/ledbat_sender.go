@@ -0,0 +1,255 @@
+package congestion
+
+import (
+	"math"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+)
+
+// This is a LEDBAT (Low Extra Delay Background Transport) sender, see RFC 6817.
+// LEDBAT is a scavenger congestion controller: it uses the available bandwidth,
+// but yields to other flows as soon as they cause a queue to build up.
+// Since QUIC doesn't measure the one-way delay, the queuing delay is estimated
+// as the difference between the current RTT and the base delay.
+// The base delay is the minimum RTT of the last 10 minutes, as described in RFC 6817.
+// Older samples expire, so that a route change to a longer path isn't mistaken for a queue.
+// The gain and the multiplicative decrease follow LEDBAT++, see
+// https://tools.ietf.org/html/draft-irtf-iccrg-ledbat-plus-plus.
+
+const (
+	// The maximum queuing delay LEDBAT introduces.
+	// RFC 6817 allows up to 100ms. We use 60ms, following LEDBAT++.
+	ledbatTargetDelay = 60 * time.Millisecond
+	// The number of RTT samples used to filter the current delay.
+	ledbatCurrentDelayFilter = 4
+	// The number of minutes the base delay history covers.
+	ledbatBaseHistory = 10
+	// The congestion window can grow by at most ledbatAllowedIncrease packets above the bytes in flight.
+	ledbatAllowedIncrease = 1
+	// Slow start is left when the queuing delay exceeds 3/4 of the target.
+	ledbatSlowStartExitDelay = ledbatTargetDelay * 3 / 4
+	// The minimum congestion window, in packets.
+	ledbatMinCongestionWindow protocol.ByteCount = 2 * protocol.DefaultTCPMSS
+)
+
+type ledbatSender struct {
+	clock    Clock
+	rttStats RTTStatsProvider
+
+	congestionWindow        protocol.ByteCount
+	initialCongestionWindow protocol.ByteCount
+	maxCongestionWindow     protocol.ByteCount
+	slowStart               bool
+
+	// the last RTT samples, used to filter out noise
+	delaySamples    [ledbatCurrentDelayFilter]time.Duration
+	numDelaySamples int
+	// the minimum RTT of every minute, for the last ledbatBaseHistory minutes
+	// The last entry is the minimum of the current minute, which started at lastRollover.
+	baseDelays   []time.Duration
+	lastRollover time.Time
+
+	largestSentPacketNumber  protocol.PacketNumber
+	largestAckedPacketNumber protocol.PacketNumber
+	// the largest packet number outstanding when the window was reduced after a loss
+	largestSentAtLastCutback protocol.PacketNumber
+}
+
+var _ SendAlgorithm = &ledbatSender{}
+
+// NewLEDBATSender makes a new LEDBAT sender
+func NewLEDBATSender(clock Clock, rttStats RTTStatsProvider, initialCongestionWindow, maxCongestionWindow protocol.ByteCount) SendAlgorithm {
+	return &ledbatSender{
+		clock:                   clock,
+		rttStats:                rttStats,
+		congestionWindow:        initialCongestionWindow,
+		initialCongestionWindow: initialCongestionWindow,
+		maxCongestionWindow:     maxCongestionWindow,
+		slowStart:               true,
+	}
+}
+
+// TimeUntilSend returns when the next packet should be sent.
+// Packets are paced at 1.25 times the congestion window per RTT.
+func (l *ledbatSender) TimeUntilSend(bytesInFlight protocol.ByteCount) time.Duration {
+	return l.rttStats.SmoothedRTT() * time.Duration(protocol.DefaultTCPMSS) / time.Duration(l.congestionWindow) * 4 / 5
+}
+
+func (l *ledbatSender) OnPacketSent(
+	sentTime time.Time,
+	bytesInFlight protocol.ByteCount,
+	packetNumber protocol.PacketNumber,
+	bytes protocol.ByteCount,
+	isRetransmittable bool,
+) {
+	if !isRetransmittable {
+		return
+	}
+	l.largestSentPacketNumber = packetNumber
+}
+
+func (l *ledbatSender) GetCongestionWindow() protocol.ByteCount {
+	return l.congestionWindow
+}
+
+// OnRTTUpdated adds the new RTT sample to the delay samples, and to the base delay history.
+func (l *ledbatSender) OnRTTUpdated() {
+	rtt := l.rttStats.LatestRTT()
+	if rtt == 0 {
+		return
+	}
+	l.addDelaySample(rtt)
+	l.updateBaseDelay(rtt, l.clock.Now())
+}
+
+// MaybeExitSlowStart leaves slow start as soon as a queue starts building up.
+func (l *ledbatSender) MaybeExitSlowStart() {
+	if l.slowStart && l.queuingDelay() > ledbatSlowStartExitDelay {
+		l.slowStart = false
+	}
+}
+
+func (l *ledbatSender) addDelaySample(rtt time.Duration) {
+	l.delaySamples[l.numDelaySamples%ledbatCurrentDelayFilter] = rtt
+	l.numDelaySamples++
+}
+
+// updateBaseDelay updates the minimum of the current minute.
+// Once a minute has passed, a new minute is started, and the oldest minute is dropped.
+func (l *ledbatSender) updateBaseDelay(rtt time.Duration, now time.Time) {
+	if len(l.baseDelays) > 0 && now.Sub(l.lastRollover) < time.Minute {
+		last := len(l.baseDelays) - 1
+		l.baseDelays[last] = utils.MinDuration(l.baseDelays[last], rtt)
+		return
+	}
+	l.lastRollover = now
+	if len(l.baseDelays) == ledbatBaseHistory {
+		copy(l.baseDelays, l.baseDelays[1:])
+		l.baseDelays = l.baseDelays[:ledbatBaseHistory-1]
+	}
+	l.baseDelays = append(l.baseDelays, rtt)
+}
+
+// baseDelay returns the minimum RTT of the base delay history.
+func (l *ledbatSender) baseDelay() time.Duration {
+	if len(l.baseDelays) == 0 {
+		return 0
+	}
+	baseDelay := l.baseDelays[0]
+	for _, d := range l.baseDelays[1:] {
+		baseDelay = utils.MinDuration(baseDelay, d)
+	}
+	return baseDelay
+}
+
+// queuingDelay estimates the queuing delay.
+// The current delay is the minimum of the last RTT samples.
+func (l *ledbatSender) queuingDelay() time.Duration {
+	n := utils.Min(l.numDelaySamples, ledbatCurrentDelayFilter)
+	if n == 0 {
+		return 0
+	}
+	currentDelay := l.delaySamples[0]
+	for i := 1; i < n; i++ {
+		currentDelay = utils.MinDuration(currentDelay, l.delaySamples[i])
+	}
+	return utils.MaxDuration(currentDelay-l.baseDelay(), 0)
+}
+
+// gain returns the gain used when increasing the congestion window.
+// It is 1/min(16, ceil(2*target/baseRTT)), as proposed in LEDBAT++.
+func (l *ledbatSender) gain() float64 {
+	baseRTT := l.baseDelay()
+	if baseRTT == 0 {
+		return 1
+	}
+	return 1 / math.Min(16, math.Ceil(2*float64(ledbatTargetDelay)/float64(baseRTT)))
+}
+
+func (l *ledbatSender) OnPacketAcked(
+	ackedPacketNumber protocol.PacketNumber,
+	ackedBytes protocol.ByteCount,
+	priorInFlight protocol.ByteCount,
+	eventTime time.Time,
+) {
+	l.largestAckedPacketNumber = utils.MaxPacketNumber(ackedPacketNumber, l.largestAckedPacketNumber)
+	if l.InRecovery() {
+		return
+	}
+	if l.slowStart {
+		l.congestionWindow += ackedBytes
+	} else if queuingDelay := l.queuingDelay(); queuingDelay < ledbatTargetDelay {
+		// Grow the window proportionally to the distance from the target delay.
+		// The gain is reduced on paths with a short RTT, so that LEDBAT doesn't grow faster than Reno.
+		offTarget := float64(ledbatTargetDelay-queuingDelay) / float64(ledbatTargetDelay)
+		l.congestionWindow += protocol.ByteCount(l.gain() * offTarget * float64(ackedBytes) * float64(protocol.DefaultTCPMSS) / float64(l.congestionWindow))
+	} else {
+		// Shrink the window multiplicatively, by at most half of the window per RTT.
+		// Unlike the linear decrease in RFC 6817, this quickly drains the queue when a competing flow starts.
+		reduction := math.Min(float64(queuingDelay)/float64(ledbatTargetDelay)-1, 0.5)
+		l.congestionWindow -= utils.MinByteCount(protocol.ByteCount(reduction*float64(ackedBytes)), l.congestionWindow)
+	}
+	// Don't grow the window if the sender is not using it.
+	l.congestionWindow = utils.MinByteCount(l.congestionWindow, priorInFlight+ledbatAllowedIncrease*protocol.DefaultTCPMSS)
+	l.congestionWindow = utils.MinByteCount(l.congestionWindow, l.maxCongestionWindow)
+	l.congestionWindow = utils.MaxByteCount(l.congestionWindow, ledbatMinCongestionWindow)
+}
+
+// OnPacketLost halves the congestion window, at most once per RTT.
+func (l *ledbatSender) OnPacketLost(
+	packetNumber protocol.PacketNumber,
+	lostBytes protocol.ByteCount,
+	priorInFlight protocol.ByteCount,
+) {
+	if packetNumber <= l.largestSentAtLastCutback {
+		return
+	}
+	l.slowStart = false
+	l.congestionWindow = utils.MaxByteCount(l.congestionWindow/2, ledbatMinCongestionWindow)
+	l.largestSentAtLastCutback = l.largestSentPacketNumber
+}
+
+// OnECNCongestionEvent treats a CE mark like a packet loss.
+func (l *ledbatSender) OnECNCongestionEvent(largestAcked protocol.PacketNumber, priorInFlight protocol.ByteCount) {
+	l.OnPacketLost(largestAcked, 0, priorInFlight)
+}
+
+// OnRetransmissionTimeout resets the congestion window to the minimum.
+func (l *ledbatSender) OnRetransmissionTimeout(packetsRetransmitted bool) {
+	l.largestSentAtLastCutback = 0
+	if !packetsRetransmitted {
+		return
+	}
+	l.slowStart = false
+	l.congestionWindow = ledbatMinCongestionWindow
+}
+
+// OnConnectionMigration resets the congestion window.
+func (l *ledbatSender) OnConnectionMigration() {
+	l.congestionWindow = l.initialCongestionWindow
+	l.slowStart = true
+	l.numDelaySamples = 0
+	l.baseDelays = l.baseDelays[:0]
+	l.largestSentPacketNumber = 0
+	l.largestAckedPacketNumber = 0
+	l.largestSentAtLastCutback = 0
+}
+
+func (l *ledbatSender) InSlowStart() bool {
+	return l.slowStart
+}
+
+func (l *ledbatSender) InRecovery() bool {
+	return l.largestAckedPacketNumber <= l.largestSentAtLastCutback && l.largestAckedPacketNumber != 0
+}
+
+// BandwidthEstimate returns the current bandwidth estimate
+func (l *ledbatSender) BandwidthEstimate() Bandwidth {
+	srtt := l.rttStats.SmoothedRTT()
+	if srtt == 0 {
+		return 0
+	}
+	return BandwidthFromDelta(l.congestionWindow, srtt)
+}
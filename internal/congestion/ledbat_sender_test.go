@@ -0,0 +1,214 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// A delayedLink is a bottleneck link with a fixed bandwidth and RTT.
+// The extraDelay is added to the RTT, to simulate the queuing delay caused by other flows.
+// No packets are lost, and every packet is acknowledged separately.
+type delayedLink struct {
+	bandwidth  Bandwidth
+	rtt        time.Duration
+	extraDelay time.Duration
+	// clock is advanced with the simulated time
+	clock *mockClock
+
+	now              time.Time
+	lastDeparture    time.Time
+	bytesInFlight    protocol.ByteCount
+	lastPacketNumber protocol.PacketNumber
+	inFlight         []simulatedPacket
+	deliveredBytes   protocol.ByteCount
+}
+
+func (l *delayedLink) run(sender SendAlgorithm, rttStats *RTTStats, duration time.Duration) {
+	end := l.now.Add(duration)
+	for l.now.Before(end) {
+		for l.bytesInFlight+simulatedPacketSize <= sender.GetCongestionWindow() {
+			l.lastPacketNumber++
+			l.bytesInFlight += simulatedPacketSize
+			sender.OnPacketSent(l.now, l.bytesInFlight, l.lastPacketNumber, simulatedPacketSize, true)
+			departure := utils.MaxTime(l.now, l.lastDeparture).Add(time.Duration(float64(simulatedPacketSize) * float64(BytesPerSecond) / float64(l.bandwidth) * float64(time.Second)))
+			l.lastDeparture = departure
+			l.inFlight = append(l.inFlight, simulatedPacket{
+				pn:       l.lastPacketNumber,
+				sentTime: l.now,
+				ackTime:  departure.Add(l.rtt + l.extraDelay),
+			})
+		}
+		next := end
+		if len(l.inFlight) > 0 && l.inFlight[0].ackTime.Before(next) {
+			next = l.inFlight[0].ackTime
+		}
+		l.now = next
+		*l.clock = mockClock(l.now)
+		for len(l.inFlight) > 0 && !l.inFlight[0].ackTime.After(l.now) {
+			p := l.inFlight[0]
+			l.inFlight = l.inFlight[1:]
+			priorInFlight := l.bytesInFlight
+			l.bytesInFlight -= simulatedPacketSize
+			rttStats.UpdateRTT(l.now.Sub(p.sentTime), 0, l.now)
+			sender.OnRTTUpdated()
+			sender.MaybeExitSlowStart()
+			sender.OnPacketAcked(p.pn, simulatedPacketSize, priorInFlight, l.now)
+			l.deliveredBytes += simulatedPacketSize
+		}
+	}
+}
+
+var _ = Describe("LEDBAT Sender", func() {
+	const (
+		bandwidth     = 10 * 1000 * 1000 * BitsPerSecond
+		rtt           = 50 * time.Millisecond
+		initialWindow = 10 * protocol.DefaultTCPMSS
+	)
+
+	var (
+		sender   *ledbatSender
+		rttStats *RTTStats
+		clock    mockClock
+		link     *delayedLink
+	)
+
+	BeforeEach(func() {
+		rttStats = NewRTTStats()
+		clock = mockClock{}
+		sender = NewLEDBATSender(&clock, rttStats, initialWindow, protocol.DefaultMaxCongestionWindow).(*ledbatSender)
+		link = &delayedLink{
+			bandwidth: bandwidth,
+			rtt:       rtt,
+			clock:     &clock,
+			now:       time.Time(clock),
+		}
+	})
+
+	It("starts in slow start", func() {
+		Expect(sender.InSlowStart()).To(BeTrue())
+		Expect(sender.InRecovery()).To(BeFalse())
+		Expect(sender.GetCongestionWindow()).To(Equal(initialWindow))
+	})
+
+	It("takes a delay sample every time the RTT is updated", func() {
+		now := time.Now()
+		rttStats.UpdateRTT(rtt, 0, now)
+		sender.OnRTTUpdated()
+		rttStats.UpdateRTT(rtt+ledbatTargetDelay, 0, now)
+		sender.OnRTTUpdated()
+		Expect(sender.numDelaySamples).To(Equal(2))
+		// MaybeExitSlowStart doesn't take a sample
+		sender.MaybeExitSlowStart()
+		Expect(sender.numDelaySamples).To(Equal(2))
+		Expect(sender.queuingDelay()).To(BeZero())
+	})
+
+	Context("base delay", func() {
+		addSample := func(rtt time.Duration) {
+			rttStats.UpdateRTT(rtt, 0, clock.Now())
+			sender.OnRTTUpdated()
+		}
+
+		It("uses the minimum RTT of the last minutes", func() {
+			addSample(rtt)
+			clock.Advance(time.Minute)
+			addSample(2 * rtt)
+			Expect(sender.baseDelays).To(Equal([]time.Duration{rtt, 2 * rtt}))
+			Expect(sender.baseDelay()).To(Equal(rtt))
+			// the current minute keeps its minimum
+			clock.Advance(time.Second)
+			addSample(rtt * 3 / 2)
+			Expect(sender.baseDelays).To(Equal([]time.Duration{rtt, rtt * 3 / 2}))
+		})
+
+		It("expires RTT samples after 10 minutes", func() {
+			addSample(rtt)
+			for i := 0; i < ledbatBaseHistory-1; i++ {
+				clock.Advance(time.Minute)
+				addSample(3 * rtt)
+			}
+			Expect(sender.baseDelays).To(HaveLen(ledbatBaseHistory))
+			Expect(sender.baseDelay()).To(Equal(rtt))
+			clock.Advance(time.Minute)
+			addSample(3 * rtt)
+			Expect(sender.baseDelays).To(HaveLen(ledbatBaseHistory))
+			Expect(sender.baseDelay()).To(Equal(3 * rtt))
+			// the queuing delay is measured relative to the new base delay, even though the RTT stats still have the old minimum
+			Expect(rttStats.MinRTT()).To(Equal(rtt))
+			Expect(sender.queuingDelay()).To(BeZero())
+		})
+
+		It("clears the history on connection migration", func() {
+			addSample(rtt)
+			sender.OnConnectionMigration()
+			Expect(sender.baseDelay()).To(BeZero())
+		})
+	})
+
+	It("leaves slow start when a queue builds up", func() {
+		link.run(sender, rttStats, 2*time.Second)
+		Expect(sender.InSlowStart()).To(BeFalse())
+	})
+
+	It("keeps the queuing delay below the target", func() {
+		link.run(sender, rttStats, 10*time.Second)
+		delivered := link.deliveredBytes
+		link.run(sender, rttStats, 2*time.Second)
+		// the link is fully utilized
+		Expect(link.deliveredBytes - delivered).To(BeNumerically(">", protocol.ByteCount(0.9*2*float64(bandwidth/BytesPerSecond))))
+		Expect(sender.queuingDelay()).To(BeNumerically("<=", ledbatTargetDelay))
+		Expect(rttStats.SmoothedRTT()).To(BeNumerically("<", rtt+ledbatTargetDelay))
+	})
+
+	It("yields when another flow causes the queuing delay to rise above the target", func() {
+		link.run(sender, rttStats, 10*time.Second)
+		Expect(sender.GetCongestionWindow()).To(BeNumerically(">", 20*protocol.DefaultTCPMSS))
+		link.extraDelay = 2 * ledbatTargetDelay
+		link.run(sender, rttStats, 2*time.Second)
+		Expect(sender.GetCongestionWindow()).To(Equal(ledbatMinCongestionWindow))
+		// once the other flow stops, the window grows again
+		link.extraDelay = 0
+		link.run(sender, rttStats, 2*time.Second)
+		Expect(sender.GetCongestionWindow()).To(BeNumerically(">", ledbatMinCongestionWindow))
+	})
+
+	It("adapts to a route change to a longer path, once the old base delay expired", func() {
+		link.run(sender, rttStats, 10*time.Second)
+		link.rtt = rtt + 2*ledbatTargetDelay
+		link.run(sender, rttStats, 2*time.Second)
+		Expect(sender.GetCongestionWindow()).To(Equal(ledbatMinCongestionWindow))
+		link.run(sender, rttStats, ledbatBaseHistory*time.Minute)
+		Expect(sender.baseDelay()).To(BeNumerically(">=", link.rtt))
+		Expect(sender.GetCongestionWindow()).To(BeNumerically(">", 20*protocol.DefaultTCPMSS))
+	})
+
+	It("halves the congestion window when a packet is lost, once per RTT", func() {
+		for pn := protocol.PacketNumber(1); pn <= 10; pn++ {
+			sender.OnPacketSent(time.Now(), protocol.ByteCount(pn)*protocol.DefaultTCPMSS, pn, protocol.DefaultTCPMSS, true)
+		}
+		sender.OnPacketLost(1, protocol.DefaultTCPMSS, initialWindow)
+		Expect(sender.GetCongestionWindow()).To(Equal(initialWindow / 2))
+		Expect(sender.InSlowStart()).To(BeFalse())
+		sender.OnPacketLost(2, protocol.DefaultTCPMSS, initialWindow)
+		Expect(sender.GetCongestionWindow()).To(Equal(initialWindow / 2))
+		sender.OnPacketAcked(3, protocol.DefaultTCPMSS, initialWindow, time.Now())
+		Expect(sender.InRecovery()).To(BeTrue())
+	})
+
+	It("doesn't grow the congestion window if it is not used", func() {
+		sender.OnPacketSent(time.Now(), protocol.DefaultTCPMSS, 1, protocol.DefaultTCPMSS, true)
+		sender.OnPacketAcked(1, protocol.DefaultTCPMSS, protocol.DefaultTCPMSS, time.Now())
+		Expect(sender.GetCongestionWindow()).To(Equal(2 * protocol.DefaultTCPMSS))
+	})
+
+	It("resets the congestion window on an RTO", func() {
+		sender.OnRetransmissionTimeout(true)
+		Expect(sender.GetCongestionWindow()).To(Equal(ledbatMinCongestionWindow))
+		Expect(sender.InSlowStart()).To(BeFalse())
+	})
+})
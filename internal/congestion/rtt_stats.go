@@ -23,6 +23,8 @@ type RTTStats struct {
 	meanDeviation time.Duration
 }
 
+var _ RTTStatsProvider = &RTTStats{}
+
 // NewRTTStats makes a properly initialized RTTStats object
 func NewRTTStats() *RTTStats {
 	return &RTTStats{}
@@ -0,0 +1,77 @@
+package congestion
+
+// A windowedMaxFilter tracks the maximum bandwidth sample over a window.
+// The time is measured in round trips.
+// It implements the windowed min/max estimator by Kathleen Nichols,
+// which keeps the best, second best and third best sample, see
+// https://groups.google.com/forum/#!topic/bbr-dev/3RTgkzi5ZD8
+type windowedMaxFilter struct {
+	windowLength uint64
+	estimates    [3]windowedSample
+}
+
+type windowedSample struct {
+	sample Bandwidth
+	time   uint64
+}
+
+func newWindowedMaxFilter(windowLength uint64) *windowedMaxFilter {
+	return &windowedMaxFilter{windowLength: windowLength}
+}
+
+// Update updates the best estimates with a new sample.
+func (f *windowedMaxFilter) Update(sample Bandwidth, now uint64) {
+	// Reset all estimates if they have not yet been initialized,
+	// if the new sample is a new best, or if the newest recorded estimate is too old.
+	if f.estimates[0].sample == 0 || sample >= f.estimates[0].sample || now-f.estimates[2].time > f.windowLength {
+		f.Reset(sample, now)
+		return
+	}
+
+	if sample >= f.estimates[1].sample {
+		f.estimates[1] = windowedSample{sample: sample, time: now}
+		f.estimates[2] = f.estimates[1]
+	} else if sample >= f.estimates[2].sample {
+		f.estimates[2] = windowedSample{sample: sample, time: now}
+	}
+
+	// Expire and update estimates as necessary.
+	if now-f.estimates[0].time > f.windowLength {
+		// The best estimate hasn't been updated for an entire window,
+		// so promote the second and third best estimates.
+		f.estimates[0] = f.estimates[1]
+		f.estimates[1] = f.estimates[2]
+		f.estimates[2] = windowedSample{sample: sample, time: now}
+		// Need to iterate one more time. Check if the new best estimate is outside the window as well,
+		// since it may also have been recorded a long time ago.
+		if now-f.estimates[0].time > f.windowLength {
+			f.estimates[0] = f.estimates[1]
+			f.estimates[1] = f.estimates[2]
+		}
+		return
+	}
+	if f.estimates[1].sample == f.estimates[0].sample && now-f.estimates[1].time > f.windowLength/4 {
+		// A quarter of the window has passed without a better sample,
+		// so the second best estimate is taken from the second quarter of the window.
+		f.estimates[1] = windowedSample{sample: sample, time: now}
+		f.estimates[2] = f.estimates[1]
+		return
+	}
+	if f.estimates[2].sample == f.estimates[1].sample && now-f.estimates[2].time > f.windowLength/2 {
+		// We've passed half of the window without a better estimate,
+		// so the third best estimate is taken from the second half of the window.
+		f.estimates[2] = windowedSample{sample: sample, time: now}
+	}
+}
+
+// Reset resets all estimates to a new sample.
+func (f *windowedMaxFilter) Reset(sample Bandwidth, now uint64) {
+	f.estimates[0] = windowedSample{sample: sample, time: now}
+	f.estimates[1] = f.estimates[0]
+	f.estimates[2] = f.estimates[0]
+}
+
+// GetBest returns the maximum sample in the window.
+func (f *windowedMaxFilter) GetBest() Bandwidth {
+	return f.estimates[0].sample
+}
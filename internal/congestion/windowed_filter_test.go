@@ -0,0 +1,60 @@
+package congestion
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Windowed Max Filter", func() {
+	var f *windowedMaxFilter
+
+	BeforeEach(func() {
+		f = newWindowedMaxFilter(10)
+	})
+
+	It("is zero before the first sample", func() {
+		Expect(f.GetBest()).To(BeZero())
+	})
+
+	It("uses the first sample", func() {
+		f.Update(100, 1)
+		Expect(f.GetBest()).To(Equal(Bandwidth(100)))
+	})
+
+	It("uses a new maximum immediately", func() {
+		f.Update(100, 1)
+		f.Update(200, 2)
+		Expect(f.GetBest()).To(Equal(Bandwidth(200)))
+		f.Update(150, 3)
+		Expect(f.GetBest()).To(Equal(Bandwidth(200)))
+	})
+
+	It("keeps the maximum for the window length", func() {
+		f.Update(200, 0)
+		for i := uint64(1); i <= 10; i++ {
+			f.Update(100, i)
+			Expect(f.GetBest()).To(Equal(Bandwidth(200)))
+		}
+		f.Update(100, 11)
+		Expect(f.GetBest()).To(Equal(Bandwidth(100)))
+	})
+
+	It("falls back to the second best sample when the maximum expires", func() {
+		f.Update(300, 0)
+		// a quarter of the window has passed, so this is the new second best sample
+		f.Update(200, 3)
+		// half of the window has passed since the second best sample, so this is the new third best sample
+		f.Update(100, 9)
+		Expect(f.GetBest()).To(Equal(Bandwidth(300)))
+		f.Update(50, 11)
+		Expect(f.GetBest()).To(Equal(Bandwidth(200)))
+		f.Update(50, 14)
+		Expect(f.GetBest()).To(Equal(Bandwidth(100)))
+	})
+
+	It("resets the estimates if all samples are outside the window", func() {
+		f.Update(300, 0)
+		f.Update(50, 100)
+		Expect(f.GetBest()).To(Equal(Bandwidth(50)))
+	})
+})
@@ -4,13 +4,14 @@ import (
 	"crypto"
 	"encoding/binary"
 
-	"github.com/bifurcation/mint"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 )
 
 const (
-	clientExporterLabel = "EXPORTER-QUIC client 1rtt"
-	serverExporterLabel = "EXPORTER-QUIC server 1rtt"
+	clientExporterLabel  = "EXPORTER-QUIC client 1rtt"
+	serverExporterLabel  = "EXPORTER-QUIC server 1rtt"
+	zeroRTTExporterLabel = "EXPORTER-QUIC 0rtt"
 )
 
 // A TLSExporter gets the negotiated ciphersuite and computes exporter
@@ -48,6 +49,16 @@ func DeriveAESKeys(tls TLSExporter, pers protocol.Perspective) (AEAD, error) {
 	return NewAEADAESGCM(otherKey, myKey, otherIV, myIV)
 }
 
+// Derive0RTTKeys derives the keys used for 0-RTT packets from the early exporter.
+// 0-RTT packets are only sent by the client, so the same key and IV are used for sealing and opening.
+func Derive0RTTKeys(tls TLSExporter) (AEAD, error) {
+	key, iv, err := computeKeyAndIV(tls, zeroRTTExporterLabel)
+	if err != nil {
+		return nil, err
+	}
+	return NewAEADAESGCM(key, key, iv, iv)
+}
+
 func computeKeyAndIV(tls TLSExporter, label string) (key, iv []byte, err error) {
 	cs := tls.GetCipherSuite()
 	secret, err := tls.ComputeExporter(label, nil, cs.Hash.Size())
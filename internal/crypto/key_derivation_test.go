@@ -4,7 +4,7 @@ import (
 	"crypto"
 	"errors"
 
-	"github.com/bifurcation/mint"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -51,4 +51,33 @@ var _ = Describe("Key Derivation", func() {
 		_, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256, computerError: testErr}, protocol.PerspectiveClient)
 		Expect(err).To(MatchError(testErr))
 	})
+
+	Context("0-RTT keys", func() {
+		It("derives keys", func() {
+			clientAEAD, err := Derive0RTTKeys(&mockTLSExporter{hash: crypto.SHA256})
+			Expect(err).ToNot(HaveOccurred())
+			serverAEAD, err := Derive0RTTKeys(&mockTLSExporter{hash: crypto.SHA256})
+			Expect(err).ToNot(HaveOccurred())
+			ciphertext := clientAEAD.Seal(nil, []byte("foobar"), 0, []byte("aad"))
+			data, err := serverAEAD.Open(nil, ciphertext, 0, []byte("aad"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foobar")))
+		})
+
+		It("uses different keys than for 1-RTT", func() {
+			zeroRTTAEAD, err := Derive0RTTKeys(&mockTLSExporter{hash: crypto.SHA256})
+			Expect(err).ToNot(HaveOccurred())
+			serverAEAD, err := DeriveAESKeys(&mockTLSExporter{hash: crypto.SHA256}, protocol.PerspectiveServer)
+			Expect(err).ToNot(HaveOccurred())
+			ciphertext := zeroRTTAEAD.Seal(nil, []byte("foobar"), 0, []byte("aad"))
+			_, err = serverAEAD.Open(nil, ciphertext, 0, []byte("aad"))
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("fails when computing the exporter fails", func() {
+			testErr := errors.New("test error")
+			_, err := Derive0RTTKeys(&mockTLSExporter{hash: crypto.SHA256, computerError: testErr})
+			Expect(err).To(MatchError(testErr))
+		})
+	})
 })
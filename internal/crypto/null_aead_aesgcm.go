@@ -3,7 +3,7 @@ package crypto
 import (
 	"crypto"
 
-	"github.com/bifurcation/mint"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 )
 
@@ -0,0 +1,25 @@
+package handshake
+
+// A CachedServerConfig contains the values a gQUIC client needs to send a full CHLO to a server.
+// All values are received from the server in a REJ message.
+type CachedServerConfig struct {
+	// ServerConfig is the serialized server config (SCFG)
+	ServerConfig []byte
+	// SourceAddressToken is the source address token (STK)
+	SourceAddressToken []byte
+	// CertChain is the certificate chain, compressed as sent by the server (CERT)
+	CertChain []byte
+	// Proof is the server's signature of the server config (PROF)
+	Proof []byte
+	// ProofCHLO is the CHLO that was signed together with the server config
+	ProofCHLO []byte
+}
+
+// A ClientConfigCache stores the server configs received by a gQUIC client.
+// The server config is validated again when it is loaded from the cache.
+type ClientConfigCache interface {
+	// Get returns the server config cached for a server, if any.
+	Get(hostname string) (*CachedServerConfig, bool)
+	// Put stores a server config. If config is nil, the cached server config is deleted.
+	Put(hostname string, config *CachedServerConfig)
+}
@@ -6,7 +6,7 @@ import (
 	"net"
 	"time"
 
-	"github.com/bifurcation/mint"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 )
 
 const (
@@ -29,6 +29,9 @@ type cryptoSetupClient struct {
 	cryptoStream io.ReadWriter
 
 	serverConfig *serverConfigClient
+	configCache  ClientConfigCache
+	// usedCachedConfig is set if the server config was loaded from the configCache
+	usedCachedConfig bool
 
 	stk              []byte
 	sno              []byte
@@ -36,6 +39,8 @@ type cryptoSetupClient struct {
 	proof            []byte
 	chloForSignature []byte
 	lastSentCHLO     []byte
+	certData         []byte
+	tlsConfig        *tls.Config
 	certManager      crypto.CertManager
 
 	divNonceChan         chan struct{}
@@ -73,6 +78,7 @@ func NewCryptoSetupClient(
 	connID protocol.ConnectionID,
 	version protocol.VersionNumber,
 	tlsConfig *tls.Config,
+	configCache ClientConfigCache,
 	params *TransportParameters,
 	paramsChan chan<- TransportParameters,
 	handshakeEvent chan<- struct{},
@@ -90,7 +96,9 @@ func NewCryptoSetupClient(
 		hostname:           hostname,
 		connID:             connID,
 		version:            version,
+		tlsConfig:          tlsConfig,
 		certManager:        crypto.NewCertManager(tlsConfig),
+		configCache:        configCache,
 		params:             params,
 		keyDerivation:      crypto.DeriveQuicCryptoAESKeys,
 		nullAEAD:           nullAEAD,
@@ -108,6 +116,13 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 	messageChan := make(chan HandshakeMessage)
 	errorChan := make(chan error, 1)
 
+	if h.configCache != nil {
+		if err := h.loadCachedServerConfig(); err != nil {
+			h.logger.Debugf("Not using cached server config for %s: %s", h.hostname, err)
+			h.discardCachedServerConfig()
+		}
+	}
+
 	go func() {
 		for {
 			message, err := ParseHandshakeMessage(h.cryptoStream)
@@ -154,6 +169,7 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 			if err != nil {
 				return err
 			}
+			h.storeServerConfig()
 			// blocks until the session has received the parameters
 			h.paramsChan <- *params
 			h.handshakeEvent <- struct{}{}
@@ -164,9 +180,81 @@ func (h *cryptoSetupClient) HandleCryptoStream() error {
 	}
 }
 
+// loadCachedServerConfig loads the server config from the cache, and validates it.
+// Once it's loaded, the first CHLO is a full CHLO.
+func (h *cryptoSetupClient) loadCachedServerConfig() error {
+	cached, ok := h.configCache.Get(h.hostname)
+	if !ok || cached == nil {
+		return nil
+	}
+	scfg, err := parseServerConfig(cached.ServerConfig)
+	if err != nil {
+		return err
+	}
+	if scfg.IsExpired() {
+		return qerr.CryptoServerConfigExpired
+	}
+	if err := h.certManager.SetData(cached.CertChain); err != nil {
+		return err
+	}
+	if err := h.certManager.Verify(h.hostname); err != nil {
+		return err
+	}
+	if !h.certManager.VerifyServerProof(cached.Proof, cached.ProofCHLO, scfg.Get()) {
+		return qerr.ProofInvalid
+	}
+	h.serverConfig = scfg
+	h.stk = cached.SourceAddressToken
+	h.certData = cached.CertChain
+	h.proof = cached.Proof
+	h.chloForSignature = cached.ProofCHLO
+	if err := h.generateClientNonce(); err != nil {
+		return err
+	}
+	h.serverVerified = true
+	h.usedCachedConfig = true
+	h.logger.Debugf("Using cached server config for %s", h.hostname)
+	return nil
+}
+
+// storeServerConfig stores the server config in the cache, after the handshake completed.
+func (h *cryptoSetupClient) storeServerConfig() {
+	if h.configCache == nil || !h.serverVerified {
+		return
+	}
+	h.configCache.Put(h.hostname, &CachedServerConfig{
+		ServerConfig:       h.serverConfig.Get(),
+		SourceAddressToken: h.stk,
+		CertChain:          h.certData,
+		Proof:              h.proof,
+		ProofCHLO:          h.chloForSignature,
+	})
+}
+
+// discardCachedServerConfig deletes the cached server config.
+// It resets all values loaded from the cache, such that the handshake proceeds as if there was no cached server config.
+func (h *cryptoSetupClient) discardCachedServerConfig() {
+	h.configCache.Put(h.hostname, nil)
+	h.usedCachedConfig = false
+	h.serverConfig = nil
+	h.stk = nil
+	h.nonc = nil
+	h.proof = nil
+	h.chloForSignature = nil
+	h.certData = nil
+	h.certManager = crypto.NewCertManager(h.tlsConfig)
+	h.serverVerified = false
+}
+
 func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 	var err error
 
+	// the server rejected the CHLO sent with the cached server config
+	if h.usedCachedConfig {
+		h.logger.Debugf("Server rejected the cached server config for %s", h.hostname)
+		h.discardCachedServerConfig()
+	}
+
 	if stk, ok := cryptoData[TagSTK]; ok {
 		h.stk = stk
 	}
@@ -205,6 +293,7 @@ func (h *cryptoSetupClient) handleREJMessage(cryptoData map[Tag][]byte) error {
 		if err != nil {
 			return qerr.Error(qerr.InvalidCryptoMessageParameter, "Certificate data invalid")
 		}
+		h.certData = crt
 
 		err = h.certManager.Verify(h.hostname)
 		if err != nil {
@@ -237,6 +326,10 @@ func (h *cryptoSetupClient) handleSHLOMessage(cryptoData map[Tag][]byte) (*Trans
 	if sno, ok := cryptoData[TagSNO]; ok {
 		h.sno = sno
 	}
+	// the server might send a new source address token, to be used for future connections
+	if stk, ok := cryptoData[TagSTK]; ok {
+		h.stk = stk
+	}
 
 	serverPubs, ok := cryptoData[TagPUBS]
 	if !ok {
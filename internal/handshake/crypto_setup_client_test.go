@@ -82,6 +82,23 @@ func (m *mockCertManager) GetChain() []*x509.Certificate {
 	return m.chain
 }
 
+type mockClientConfigCache map[string]*CachedServerConfig
+
+var _ ClientConfigCache = mockClientConfigCache{}
+
+func (c mockClientConfigCache) Get(hostname string) (*CachedServerConfig, bool) {
+	config, ok := c[hostname]
+	return config, ok
+}
+
+func (c mockClientConfigCache) Put(hostname string, config *CachedServerConfig) {
+	if config == nil {
+		delete(c, hostname)
+		return
+	}
+	c[hostname] = config
+}
+
 var _ = Describe("Client Crypto Setup", func() {
 	var (
 		cs                      *cryptoSetupClient
@@ -125,6 +142,7 @@ var _ = Describe("Client Crypto Setup", func() {
 			protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 			version,
 			nil,
+			nil,
 			&TransportParameters{IdleTimeout: protocol.DefaultIdleTimeout},
 			paramsChan,
 			handshakeEvent,
@@ -486,6 +504,167 @@ var _ = Describe("Client Crypto Setup", func() {
 		})
 	})
 
+	Context("caching server configs", func() {
+		var (
+			configCache mockClientConfigCache
+			cached      *CachedServerConfig
+		)
+
+		getServerConfig := func(scfg map[Tag][]byte) []byte {
+			b := &bytes.Buffer{}
+			HandshakeMessage{Tag: TagSCFG, Data: scfg}.Write(b)
+			return b.Bytes()
+		}
+
+		BeforeEach(func() {
+			configCache = make(mockClientConfigCache)
+			cs.configCache = configCache
+			cached = &CachedServerConfig{
+				ServerConfig:       getServerConfig(getDefaultServerConfigClient()),
+				SourceAddressToken: []byte("stk"),
+				CertChain:          []byte("cert"),
+				Proof:              []byte("proof"),
+				ProofCHLO:          []byte("chlo"),
+			}
+			certManager.leafCert = []byte("leafcert")
+			certManager.verifyServerProofResult = true
+		})
+
+		It("loads a cached server config", func() {
+			configCache["hostname"] = cached
+			Expect(cs.loadCachedServerConfig()).To(Succeed())
+			Expect(cs.usedCachedConfig).To(BeTrue())
+			Expect(cs.serverVerified).To(BeTrue())
+			Expect(cs.serverConfig).ToNot(BeNil())
+			Expect(cs.serverConfig.Get()).To(Equal(cached.ServerConfig))
+			Expect(cs.stk).To(Equal([]byte("stk")))
+			Expect(cs.nonc).To(HaveLen(32))
+			Expect(certManager.setDataCalledWith).To(Equal([]byte("cert")))
+			Expect(certManager.verifyCalled).To(BeTrue())
+			Expect(certManager.verifyServerProofCalled).To(BeTrue())
+		})
+
+		It("sends a full CHLO when using a cached server config", func() {
+			configCache["hostname"] = cached
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := cs.HandleCryptoStream()
+				Expect(err).To(MatchError(qerr.Error(qerr.HandshakeFailed, errMockStreamClosing.Error())))
+				close(done)
+			}()
+			Eventually(func() int { return stream.dataWritten.Len() }).ShouldNot(BeZero())
+			chlo, err := ParseHandshakeMessage(bytes.NewReader(stream.dataWritten.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chlo.Data).To(HaveKey(TagPUBS))
+			Expect(chlo.Data).To(HaveKeyWithValue(TagSCID, getDefaultServerConfigClient()[TagSCID]))
+			Expect(chlo.Data).To(HaveKeyWithValue(TagSTK, []byte("stk")))
+			// make the go routine return
+			stream.close()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("deletes an invalid server config, and sends an inchoate CHLO", func() {
+			certManager.verifyServerProofResult = false
+			configCache["hostname"] = cached
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := cs.HandleCryptoStream()
+				Expect(err).To(MatchError(qerr.Error(qerr.HandshakeFailed, errMockStreamClosing.Error())))
+				close(done)
+			}()
+			Eventually(func() int { return stream.dataWritten.Len() }).ShouldNot(BeZero())
+			Expect(configCache).To(BeEmpty())
+			chlo, err := ParseHandshakeMessage(bytes.NewReader(stream.dataWritten.Bytes()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(chlo.Data).ToNot(HaveKey(TagPUBS))
+			Expect(chlo.Data).ToNot(HaveKey(TagSCID))
+			Expect(chlo.Data).ToNot(HaveKey(TagSTK))
+			// make the go routine return
+			stream.close()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("rejects expired server configs", func() {
+			scfg := getDefaultServerConfigClient()
+			scfg[TagEXPY] = []byte{0x80, 0x54, 0x72, 0x4F, 0, 0, 0, 0} // 2012-03-28
+			cached.ServerConfig = getServerConfig(scfg)
+			configCache["hostname"] = cached
+			Expect(cs.loadCachedServerConfig()).To(MatchError(qerr.CryptoServerConfigExpired))
+			Expect(cs.serverConfig).To(BeNil())
+		})
+
+		It("rejects server configs with an invalid certificate chain", func() {
+			certManager.verifyError = errors.New("invalid")
+			configCache["hostname"] = cached
+			Expect(cs.loadCachedServerConfig()).To(MatchError("invalid"))
+			Expect(cs.serverConfig).To(BeNil())
+		})
+
+		It("rejects server configs with an invalid proof", func() {
+			certManager.verifyServerProofResult = false
+			configCache["hostname"] = cached
+			Expect(cs.loadCachedServerConfig()).To(MatchError(qerr.ProofInvalid))
+			Expect(cs.serverConfig).To(BeNil())
+		})
+
+		It("falls back to a regular handshake when the server rejects the cached server config", func() {
+			configCache["hostname"] = cached
+			Expect(cs.loadCachedServerConfig()).To(Succeed())
+			err := cs.handleREJMessage(map[Tag][]byte{TagSTK: []byte("new stk")})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configCache).To(BeEmpty())
+			Expect(cs.usedCachedConfig).To(BeFalse())
+			Expect(cs.serverVerified).To(BeFalse())
+			Expect(cs.serverConfig).To(BeNil())
+			Expect(cs.nonc).To(BeEmpty())
+			Expect(cs.proof).To(BeEmpty())
+			Expect(cs.stk).To(Equal([]byte("new stk")))
+			// the certificate chain loaded from the cache was discarded
+			Expect(cs.certManager).ToNot(Equal(certManager))
+			Expect(cs.certManager.GetLeafCert()).To(BeNil())
+		})
+
+		It("stores the server config after receiving the SHLO", func() {
+			var err error
+			cs.serverConfig, err = parseServerConfig(cached.ServerConfig)
+			Expect(err).ToNot(HaveOccurred())
+			cs.stk = []byte("stk")
+			cs.certData = []byte("cert")
+			cs.proof = []byte("proof")
+			cs.chloForSignature = []byte("chlo")
+			cs.serverVerified = true
+			cs.receivedSecurePacket = true
+			shloMap[TagSTK] = []byte("new stk")
+			HandshakeMessage{Tag: TagSHLO, Data: shloMap}.Write(&stream.dataToRead)
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				err := cs.HandleCryptoStream()
+				Expect(err).To(MatchError(qerr.Error(qerr.HandshakeFailed, errMockStreamClosing.Error())))
+				close(done)
+			}()
+			Eventually(handshakeEvent).Should(BeClosed())
+			Expect(configCache).To(HaveKey("hostname"))
+			Expect(configCache["hostname"]).To(Equal(&CachedServerConfig{
+				ServerConfig:       cached.ServerConfig,
+				SourceAddressToken: []byte("new stk"),
+				CertChain:          []byte("cert"),
+				Proof:              []byte("proof"),
+				ProofCHLO:          []byte("chlo"),
+			}))
+			// make the go routine return
+			stream.close()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("saves the certificate chain, when receiving it in a REJ", func() {
+			Expect(cs.handleREJMessage(map[Tag][]byte{TagCERT: []byte("cert")})).To(Succeed())
+			Expect(cs.certData).To(Equal([]byte("cert")))
+		})
+	})
+
 	Context("CHLO generation", func() {
 		It("is longer than the miminum client hello size", func() {
 			err := cs.sendCHLO()
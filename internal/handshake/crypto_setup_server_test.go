@@ -8,7 +8,7 @@ import (
 	"net"
 	"time"
 
-	"github.com/bifurcation/mint"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 
 	"github.com/wangjiezhe/quic-go/internal/crypto"
 	"github.com/wangjiezhe/quic-go/internal/mocks/crypto"
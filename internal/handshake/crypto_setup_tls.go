@@ -6,8 +6,8 @@ import (
 	"io"
 	"sync"
 
-	"github.com/bifurcation/mint"
 	"github.com/wangjiezhe/quic-go/internal/crypto"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 )
 
@@ -22,9 +22,12 @@ type cryptoSetupTLS struct {
 
 	perspective protocol.Perspective
 
-	keyDerivation KeyDerivationFunction
-	nullAEAD      crypto.AEAD
-	aead          crypto.AEAD
+	keyDerivation        KeyDerivationFunction
+	zeroRTTKeyDerivation func(crypto.TLSExporter) (crypto.AEAD, error)
+	nullAEAD             crypto.AEAD
+	zeroRTTAEAD          crypto.AEAD
+	aead                 crypto.AEAD
+	connState            ConnectionState
 
 	tls            MintTLS
 	cryptoStream   *CryptoStreamConn
@@ -33,22 +36,33 @@ type cryptoSetupTLS struct {
 
 var _ CryptoSetupTLS = &cryptoSetupTLS{}
 
-// NewCryptoSetupTLSServer creates a new TLS CryptoSetup instance for a server
+// NewCryptoSetupTLSServer creates a new TLS CryptoSetup instance for a server.
+// If mint accepted early data, the 0-RTT keys are derived right away,
+// so that 0-RTT packets can be decrypted as soon as the session is running.
 func NewCryptoSetupTLSServer(
 	tls MintTLS,
 	cryptoStream *CryptoStreamConn,
 	nullAEAD crypto.AEAD,
 	handshakeEvent chan<- struct{},
 	version protocol.VersionNumber,
-) CryptoSetupTLS {
-	return &cryptoSetupTLS{
-		tls:            tls,
-		cryptoStream:   cryptoStream,
-		nullAEAD:       nullAEAD,
-		perspective:    protocol.PerspectiveServer,
-		keyDerivation:  crypto.DeriveAESKeys,
-		handshakeEvent: handshakeEvent,
+) (CryptoSetupTLS, error) {
+	h := &cryptoSetupTLS{
+		tls:                  tls,
+		cryptoStream:         cryptoStream,
+		nullAEAD:             nullAEAD,
+		perspective:          protocol.PerspectiveServer,
+		keyDerivation:        crypto.DeriveAESKeys,
+		zeroRTTKeyDerivation: crypto.Derive0RTTKeys,
+		handshakeEvent:       handshakeEvent,
 	}
+	if exporter := tls.EarlyExporter(); exporter != nil {
+		aead, err := h.zeroRTTKeyDerivation(exporter)
+		if err != nil {
+			return nil, err
+		}
+		h.zeroRTTAEAD = aead
+	}
+	return h, nil
 }
 
 // NewCryptoSetupTLSClient creates a new TLS CryptoSetup instance for a client
@@ -66,11 +80,12 @@ func NewCryptoSetupTLSClient(
 	}
 
 	return &cryptoSetupTLS{
-		perspective:    protocol.PerspectiveClient,
-		tls:            tls,
-		nullAEAD:       nullAEAD,
-		keyDerivation:  crypto.DeriveAESKeys,
-		handshakeEvent: handshakeEvent,
+		perspective:          protocol.PerspectiveClient,
+		tls:                  tls,
+		nullAEAD:             nullAEAD,
+		keyDerivation:        crypto.DeriveAESKeys,
+		zeroRTTKeyDerivation: crypto.Derive0RTTKeys,
+		handshakeEvent:       handshakeEvent,
 	}, nil
 }
 
@@ -91,6 +106,12 @@ handshakeLoop:
 		switch h.tls.State() {
 		case mint.StateClientStart: // this happens if a stateless retry is performed
 			return ErrCloseSessionForRetry
+		case mint.StateClientWaitSH:
+			// The ClientHello was just sent.
+			// If mint offered early data, the 0-RTT keys can now be derived.
+			if err := h.maybeDerive0RTTKeys(); err != nil {
+				return err
+			}
 		case mint.StateClientConnected, mint.StateServerConnected:
 			break handshakeLoop
 		}
@@ -100,12 +121,49 @@ handshakeLoop:
 	if err != nil {
 		return err
 	}
+	mintConnState := h.tls.ConnectionState()
 	h.mutex.Lock()
 	h.aead = aead
+	h.connState = ConnectionState{
+		// TODO: set the ServerName, once mint exports it
+		HandshakeComplete: true,
+		PeerCertificates:  mintConnState.PeerCertificates,
+		DidResume:         mintConnState.UsingPSK,
+		Used0RTT:          mintConnState.UsingEarlyData,
+	}
 	h.mutex.Unlock()
 
 	h.handshakeEvent <- struct{}{}
 	close(h.handshakeEvent)
+
+	if h.perspective == protocol.PerspectiveClient {
+		// The server sends session tickets after completing the handshake.
+		// Errors are ignored: the connection is usable, even if the session ticket is not.
+		_ = h.tls.HandlePostHandshakeMessages()
+	}
+	return nil
+}
+
+func (h *cryptoSetupTLS) maybeDerive0RTTKeys() error {
+	h.mutex.RLock()
+	derived := h.zeroRTTAEAD != nil
+	h.mutex.RUnlock()
+	if derived {
+		return nil
+	}
+	exporter := h.tls.EarlyExporter()
+	if exporter == nil {
+		return nil
+	}
+	aead, err := h.zeroRTTKeyDerivation(exporter)
+	if err != nil {
+		return err
+	}
+	h.mutex.Lock()
+	h.zeroRTTAEAD = aead
+	h.mutex.Unlock()
+	// inform the session that 0-RTT packets can now be sent
+	h.handshakeEvent <- struct{}{}
 	return nil
 }
 
@@ -113,6 +171,16 @@ func (h *cryptoSetupTLS) OpenHandshake(dst, src []byte, packetNumber protocol.Pa
 	return h.nullAEAD.Open(dst, src, packetNumber, associatedData)
 }
 
+func (h *cryptoSetupTLS) Open0RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if h.zeroRTTAEAD == nil {
+		return nil, errors.New("no 0-RTT opener")
+	}
+	return h.zeroRTTAEAD.Open(dst, src, packetNumber, associatedData)
+}
+
 func (h *cryptoSetupTLS) Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error) {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
@@ -130,6 +198,10 @@ func (h *cryptoSetupTLS) GetSealer() (protocol.EncryptionLevel, Sealer) {
 	if h.aead != nil {
 		return protocol.EncryptionForwardSecure, h.aead
 	}
+	// 0-RTT packets are sent using the EncryptionSecure encryption level.
+	if h.zeroRTTAEAD != nil && h.perspective == protocol.PerspectiveClient {
+		return protocol.EncryptionSecure, h.zeroRTTAEAD
+	}
 	return protocol.EncryptionUnencrypted, h.nullAEAD
 }
 
@@ -141,6 +213,11 @@ func (h *cryptoSetupTLS) GetSealerWithEncryptionLevel(encLevel protocol.Encrypti
 	switch encLevel {
 	case protocol.EncryptionUnencrypted:
 		return h.nullAEAD, nil
+	case protocol.EncryptionSecure:
+		if h.zeroRTTAEAD == nil || h.perspective != protocol.PerspectiveClient {
+			return nil, errNoSealer
+		}
+		return h.zeroRTTAEAD, nil
 	case protocol.EncryptionForwardSecure:
 		if h.aead == nil {
 			return nil, errNoSealer
@@ -155,13 +232,10 @@ func (h *cryptoSetupTLS) GetSealerForCryptoStream() (protocol.EncryptionLevel, S
 	return protocol.EncryptionUnencrypted, h.nullAEAD
 }
 
+// ConnectionState returns the state of the connection.
+// Before the handshake completes, it returns an empty ConnectionState.
 func (h *cryptoSetupTLS) ConnectionState() ConnectionState {
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
-	mintConnState := h.tls.ConnectionState()
-	return ConnectionState{
-		// TODO: set the ServerName, once mint exports it
-		HandshakeComplete: h.aead != nil,
-		PeerCertificates:  mintConnState.PeerCertificates,
-	}
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.connState
 }
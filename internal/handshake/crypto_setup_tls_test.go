@@ -1,11 +1,12 @@
 package handshake
 
 import (
+	gocrypto "crypto"
 	"errors"
 	"fmt"
 
-	"github.com/bifurcation/mint"
 	"github.com/wangjiezhe/quic-go/internal/crypto"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/wangjiezhe/quic-go/internal/mocks/crypto"
 	"github.com/wangjiezhe/quic-go/internal/mocks/handshake"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
@@ -18,6 +19,27 @@ func mockKeyDerivation(crypto.TLSExporter, protocol.Perspective) (crypto.AEAD, e
 	return mockcrypto.NewMockAEAD(mockCtrl), nil
 }
 
+func mock0RTTKeyDerivation(crypto.TLSExporter) (crypto.AEAD, error) {
+	return mockcrypto.NewMockAEAD(mockCtrl), nil
+}
+
+type mockTLSExporter struct {
+	err error
+}
+
+var _ crypto.TLSExporter = &mockTLSExporter{}
+
+func (e *mockTLSExporter) GetCipherSuite() mint.CipherSuiteParams {
+	return mint.CipherSuiteParams{Hash: gocrypto.SHA256, KeyLen: 16, IvLen: 12}
+}
+
+func (e *mockTLSExporter) ComputeExporter(label string, context []byte, keyLength int) ([]byte, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return make([]byte, keyLength), nil
+}
+
 var _ = Describe("TLS Crypto Setup", func() {
 	var (
 		cs             *cryptoSetupTLS
@@ -26,13 +48,17 @@ var _ = Describe("TLS Crypto Setup", func() {
 
 	BeforeEach(func() {
 		handshakeEvent = make(chan struct{}, 2)
-		cs = NewCryptoSetupTLSServer(
-			nil,
+		tls := mockhandshake.NewMockMintTLS(mockCtrl)
+		tls.EXPECT().EarlyExporter()
+		csInt, err := NewCryptoSetupTLSServer(
+			tls,
 			NewCryptoStreamConn(nil),
 			nil, // AEAD
 			handshakeEvent,
 			protocol.VersionTLS,
-		).(*cryptoSetupTLS)
+		)
+		Expect(err).ToNot(HaveOccurred())
+		cs = csInt.(*cryptoSetupTLS)
 		cs.nullAEAD = mockcrypto.NewMockAEAD(mockCtrl)
 	})
 
@@ -48,6 +74,7 @@ var _ = Describe("TLS Crypto Setup", func() {
 		cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
 		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
 		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState()
 		cs.keyDerivation = mockKeyDerivation
 		err := cs.HandleCryptoStream()
 		Expect(err).ToNot(HaveOccurred())
@@ -60,6 +87,7 @@ var _ = Describe("TLS Crypto Setup", func() {
 		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert).Times(10)
 		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerNegotiated).Times(9)
 		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState()
 		cs.keyDerivation = mockKeyDerivation
 		err := cs.HandleCryptoStream()
 		Expect(err).ToNot(HaveOccurred())
@@ -69,7 +97,6 @@ var _ = Describe("TLS Crypto Setup", func() {
 	Context("reporting the handshake state", func() {
 		It("reports before the handshake compeletes", func() {
 			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
-			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{})
 			state := cs.ConnectionState()
 			Expect(state.HandshakeComplete).To(BeFalse())
 			Expect(state.PeerCertificates).To(BeNil())
@@ -86,6 +113,23 @@ var _ = Describe("TLS Crypto Setup", func() {
 			state := cs.ConnectionState()
 			Expect(state.HandshakeComplete).To(BeTrue())
 			Expect(state.PeerCertificates).To(BeNil())
+			Expect(state.DidResume).To(BeFalse())
+			Expect(state.Used0RTT).To(BeFalse())
+		})
+
+		It("reports if the session was resumed and 0-RTT was used", func() {
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{
+				UsingPSK:       true,
+				UsingEarlyData: true,
+			})
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+			cs.keyDerivation = mockKeyDerivation
+			Expect(cs.HandleCryptoStream()).To(Succeed())
+			state := cs.ConnectionState()
+			Expect(state.DidResume).To(BeTrue())
+			Expect(state.Used0RTT).To(BeTrue())
 		})
 	})
 
@@ -94,6 +138,7 @@ var _ = Describe("TLS Crypto Setup", func() {
 			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
 			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
 			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateServerConnected)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState()
 			cs.keyDerivation = mockKeyDerivation
 			err := cs.HandleCryptoStream()
 			Expect(err).ToNot(HaveOccurred())
@@ -174,7 +219,7 @@ var _ = Describe("TLS Crypto Setup", func() {
 				Expect(sealer).To(BeNil())
 			})
 
-			It("never returns a secure AEAD (they don't exist with TLS)", func() {
+			It("never returns a 0-RTT sealer for the server", func() {
 				doHandshake()
 				sealer, err := cs.GetSealerWithEncryptionLevel(protocol.EncryptionSecure)
 				Expect(err).To(MatchError("CryptoSetup: no sealer with encryption level encrypted (not forward-secure)"))
@@ -190,6 +235,39 @@ var _ = Describe("TLS Crypto Setup", func() {
 	})
 })
 
+var _ = Describe("TLS Crypto Setup, for a server accepting 0-RTT", func() {
+	It("derives the 0-RTT keys when it is created", func() {
+		tls := mockhandshake.NewMockMintTLS(mockCtrl)
+		tls.EXPECT().EarlyExporter().Return(&mockTLSExporter{})
+		csInt, err := NewCryptoSetupTLSServer(tls, NewCryptoStreamConn(nil), nil, make(chan struct{}, 2), protocol.VersionTLS)
+		Expect(err).ToNot(HaveOccurred())
+		cs := csInt.(*cryptoSetupTLS)
+		Expect(cs.zeroRTTAEAD).ToNot(BeNil())
+		// the server never sends 0-RTT packets
+		enc, _ := cs.GetSealer()
+		Expect(enc).To(Equal(protocol.EncryptionUnencrypted))
+		_, err = cs.Open0RTT(nil, []byte("foobar"), 10, []byte("ad"))
+		Expect(err).To(HaveOccurred()) // the AEAD was created from a fake exporter
+	})
+
+	It("errors if deriving the 0-RTT keys fails", func() {
+		testErr := errors.New("exporter failed")
+		tls := mockhandshake.NewMockMintTLS(mockCtrl)
+		tls.EXPECT().EarlyExporter().Return(&mockTLSExporter{err: testErr})
+		_, err := NewCryptoSetupTLSServer(tls, NewCryptoStreamConn(nil), nil, make(chan struct{}, 2), protocol.VersionTLS)
+		Expect(err).To(MatchError(testErr))
+	})
+
+	It("doesn't open 0-RTT packets if 0-RTT was not accepted", func() {
+		tls := mockhandshake.NewMockMintTLS(mockCtrl)
+		tls.EXPECT().EarlyExporter()
+		cs, err := NewCryptoSetupTLSServer(tls, NewCryptoStreamConn(nil), nil, make(chan struct{}, 2), protocol.VersionTLS)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = cs.Open0RTT(nil, []byte("foobar"), 10, []byte("ad"))
+		Expect(err).To(MatchError("no 0-RTT opener"))
+	})
+})
+
 var _ = Describe("TLS Crypto Setup, for the client", func() {
 	var (
 		cs             *cryptoSetupTLS
@@ -218,4 +296,77 @@ var _ = Describe("TLS Crypto Setup, for the client", func() {
 		Expect(err).To(MatchError(ErrCloseSessionForRetry))
 	})
 
+	It("handles post-handshake messages after completing the handshake", func() {
+		handshakeEvent := make(chan struct{}, 2)
+		cs.handshakeEvent = handshakeEvent
+		cs.keyDerivation = mockKeyDerivation
+		cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateClientConnected)
+		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState()
+		cs.tls.(*mockhandshake.MockMintTLS).EXPECT().HandlePostHandshakeMessages().Return(errors.New("crypto stream closed"))
+		Expect(cs.HandleCryptoStream()).To(Succeed())
+		Expect(handshakeEvent).To(Receive())
+		Expect(handshakeEvent).To(BeClosed())
+	})
+
+	Context("0-RTT", func() {
+		var handshakeEvent chan struct{}
+
+		BeforeEach(func() {
+			handshakeEvent = make(chan struct{}, 2)
+			cs.handshakeEvent = handshakeEvent
+			cs.keyDerivation = mockKeyDerivation
+			cs.zeroRTTKeyDerivation = mock0RTTKeyDerivation
+			cs.tls = mockhandshake.NewMockMintTLS(mockCtrl)
+		})
+
+		It("derives the 0-RTT keys after sending the ClientHello", func() {
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateClientWaitSH)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().EarlyExporter().Return(&mockTLSExporter{})
+			// make the handshake fail, so that HandleCryptoStream returns
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertHandshakeFailure)
+			Expect(cs.HandleCryptoStream()).ToNot(Succeed())
+			Expect(handshakeEvent).To(Receive())
+			Expect(handshakeEvent).ToNot(BeClosed())
+			enc, sealer := cs.GetSealer()
+			Expect(enc).To(Equal(protocol.EncryptionSecure))
+			Expect(sealer).To(Equal(cs.zeroRTTAEAD))
+			sealer, err := cs.GetSealerWithEncryptionLevel(protocol.EncryptionSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sealer).To(Equal(cs.zeroRTTAEAD))
+		})
+
+		It("doesn't derive 0-RTT keys if no early data was offered", func() {
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateClientWaitSH)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().EarlyExporter()
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertHandshakeFailure)
+			Expect(cs.HandleCryptoStream()).ToNot(Succeed())
+			Expect(handshakeEvent).ToNot(Receive())
+			enc, _ := cs.GetSealer()
+			Expect(enc).To(Equal(protocol.EncryptionUnencrypted))
+			_, err := cs.GetSealerWithEncryptionLevel(protocol.EncryptionSecure)
+			Expect(err).To(MatchError("CryptoSetup: no sealer with encryption level encrypted (not forward-secure)"))
+		})
+
+		It("uses the forward-secure sealer once the handshake completes", func() {
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().Handshake().Return(mint.AlertNoAlert).Times(2)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateClientWaitSH)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().EarlyExporter().Return(&mockTLSExporter{})
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().State().Return(mint.StateClientConnected)
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().ConnectionState().Return(mint.ConnectionState{UsingPSK: true})
+			cs.tls.(*mockhandshake.MockMintTLS).EXPECT().HandlePostHandshakeMessages()
+			Expect(cs.HandleCryptoStream()).To(Succeed())
+			Expect(handshakeEvent).To(Receive())
+			Expect(handshakeEvent).To(Receive())
+			Expect(handshakeEvent).To(BeClosed())
+			enc, _ := cs.GetSealer()
+			Expect(enc).To(Equal(protocol.EncryptionForwardSecure))
+			Expect(cs.ConnectionState().DidResume).To(BeTrue())
+			Expect(cs.ConnectionState().Used0RTT).To(BeFalse())
+		})
+	})
+
 })
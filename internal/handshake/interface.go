@@ -4,8 +4,8 @@ import (
 	"crypto/x509"
 	"io"
 
-	"github.com/bifurcation/mint"
 	"github.com/wangjiezhe/quic-go/internal/crypto"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 )
 
@@ -33,6 +33,12 @@ type MintTLS interface {
 	ConnectionState() mint.ConnectionState
 
 	SetCryptoStream(io.ReadWriter)
+	// EarlyExporter returns an exporter for the early exporter master secret.
+	// It returns nil if the client didn't offer early data, or if the server didn't accept it.
+	EarlyExporter() crypto.TLSExporter
+	// HandlePostHandshakeMessages processes messages sent after the handshake completed, e.g. session tickets.
+	// It blocks until the crypto stream is closed.
+	HandlePostHandshakeMessages() error
 }
 
 type baseCryptoSetup interface {
@@ -56,6 +62,7 @@ type CryptoSetupTLS interface {
 	baseCryptoSetup
 
 	OpenHandshake(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
+	Open0RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
 	Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
 }
 
@@ -65,4 +72,6 @@ type ConnectionState struct {
 	HandshakeComplete bool                // handshake is complete
 	ServerName        string              // server name requested by client, if any (server side only)
 	PeerCertificates  []*x509.Certificate // certificate chain presented by remote peer
+	DidResume         bool                // session was resumed using a session ticket (IETF QUIC only)
+	Used0RTT          bool                // 0-RTT data was accepted by the server (IETF QUIC only)
 }
@@ -1,7 +1,7 @@
 package handshake
 
 import (
-	"github.com/bifurcation/mint"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 )
 
 type transportParameterID uint16
@@ -16,6 +16,7 @@ const (
 	maxPacketSizeParameterID         transportParameterID = 0x5
 	statelessResetTokenParameterID   transportParameterID = 0x6
 	initialMaxUniStreamsParameterID  transportParameterID = 0x8
+	maxDatagramFrameSizeParameterID  transportParameterID = 0x20
 )
 
 type transportParameter struct {
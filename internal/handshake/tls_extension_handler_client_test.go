@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"fmt"
 
-	"github.com/bifurcation/mint"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/bifurcation/mint/syntax"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 	"github.com/wangjiezhe/quic-go/internal/utils"
@@ -117,8 +117,9 @@ var _ = Describe("Transport Parameters", func() {
 				MaxBidiStreams:              1337,
 				MaxUniStreams:               7331,
 				IdleTimeout:                 42 * time.Second,
+				MaxDatagramFrameSize:        1200,
 			}
-			Expect(p.String()).To(Equal("&handshake.TransportParameters{StreamFlowControlWindow: 0x1234, ConnectionFlowControlWindow: 0x4321, MaxBidiStreams: 1337, MaxUniStreams: 7331, IdleTimeout: 42s}"))
+			Expect(p.String()).To(Equal("&handshake.TransportParameters{StreamFlowControlWindow: 0x1234, ConnectionFlowControlWindow: 0x4321, MaxBidiStreams: 1337, MaxUniStreams: 7331, IdleTimeout: 42s, MaxDatagramFrameSize: 1200}"))
 		})
 
 		Context("parsing", func() {
@@ -144,6 +145,35 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(params.IdleTimeout).To(Equal(0x1337 * time.Second))
 				Expect(params.OmitConnectionID).To(BeFalse())
 				Expect(params.MaxPacketSize).To(Equal(protocol.ByteCount(0x7331)))
+				Expect(params.MaxDatagramFrameSize).To(BeZero())
+				Expect(params.StatelessResetToken).To(BeNil())
+			})
+
+			It("reads the max_datagram_frame_size", func() {
+				parameters[maxDatagramFrameSizeParameterID] = []byte{0x4, 0xb0} // 1200
+				params, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.MaxDatagramFrameSize).To(Equal(protocol.ByteCount(1200)))
+			})
+
+			It("rejects the parameters if max_datagram_frame_size has the wrong length", func() {
+				parameters[maxDatagramFrameSizeParameterID] = []byte{0x11} // should be 2 bytes
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for max_datagram_frame_size: 1 (expected 2)"))
+			})
+
+			It("reads the stateless_reset_token", func() {
+				parameters[statelessResetTokenParameterID] = []byte("foobarfoobar1234")
+				params, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(params.StatelessResetToken).ToNot(BeNil())
+				Expect(params.StatelessResetToken[:]).To(Equal([]byte("foobarfoobar1234")))
+			})
+
+			It("rejects the parameters if the stateless_reset_token has the wrong length", func() {
+				parameters[statelessResetTokenParameterID] = []byte("foobar") // should be 16 bytes
+				_, err := readTransportParameters(paramsMapToList(parameters))
+				Expect(err).To(MatchError("wrong length for stateless_reset_token: 6 (expected 16)"))
 			})
 
 			It("rejects the parameters if the initial_max_stream_data is missing", func() {
@@ -253,6 +283,21 @@ var _ = Describe("Transport Parameters", func() {
 				Expect(values).To(HaveKeyWithValue(idleTimeoutParameterID, []byte{0xca, 0xfe}))
 				Expect(values).To(HaveKeyWithValue(maxPacketSizeParameterID, []byte{0x5, 0xac})) // 1452 = 0x5ac
 			})
+
+			It("sends the max_datagram_frame_size, if DATAGRAM frames are supported", func() {
+				params.MaxDatagramFrameSize = 1200
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveLen(7))
+				Expect(values).To(HaveKeyWithValue(maxDatagramFrameSizeParameterID, []byte{0x4, 0xb0})) // 1200 = 0x4b0
+			})
+
+			It("sends the stateless_reset_token, if set", func() {
+				token := [16]byte{'f', 'o', 'o', 'b', 'a', 'r', 'f', 'o', 'o', 'b', 'a', 'r', '1', '2', '3', '4'}
+				params.StatelessResetToken = &token
+				values := paramsListToMap(params.getTransportParameters())
+				Expect(values).To(HaveLen(7))
+				Expect(values).To(HaveKeyWithValue(statelessResetTokenParameterID, []byte("foobarfoobar1234")))
+			})
 		})
 	})
 })
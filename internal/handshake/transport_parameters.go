@@ -28,6 +28,14 @@ type TransportParameters struct {
 
 	OmitConnectionID bool // only used for gQUIC
 	IdleTimeout      time.Duration
+
+	// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame that is accepted.
+	// If it is 0, DATAGRAM frames are not supported.
+	MaxDatagramFrameSize protocol.ByteCount // only used for IETF QUIC
+
+	// StatelessResetToken is the token for the connection ID the server chose during the handshake.
+	// It is only sent by the server.
+	StatelessResetToken *[16]byte // only used for IETF QUIC
 }
 
 // readHelloMap reads the transport parameters from the tags sent in a gQUIC handshake message
@@ -141,6 +149,18 @@ func readTransportParameters(paramsList []transportParameter) (*TransportParamet
 				return nil, fmt.Errorf("invalid value for max_packet_size: %d (minimum 1200)", maxPacketSize)
 			}
 			params.MaxPacketSize = maxPacketSize
+		case maxDatagramFrameSizeParameterID:
+			if len(p.Value) != 2 {
+				return nil, fmt.Errorf("wrong length for max_datagram_frame_size: %d (expected 2)", len(p.Value))
+			}
+			params.MaxDatagramFrameSize = protocol.ByteCount(binary.BigEndian.Uint16(p.Value))
+		case statelessResetTokenParameterID:
+			if len(p.Value) != 16 {
+				return nil, fmt.Errorf("wrong length for stateless_reset_token: %d (expected 16)", len(p.Value))
+			}
+			var token [16]byte
+			copy(token[:], p.Value)
+			params.StatelessResetToken = &token
 		}
 	}
 
@@ -173,11 +193,20 @@ func (p *TransportParameters) getTransportParameters() []transportParameter {
 		{idleTimeoutParameterID, idleTimeout},
 		{maxPacketSizeParameterID, maxPacketSize},
 	}
+	// only send the max_datagram_frame_size if DATAGRAM frames are supported
+	if p.MaxDatagramFrameSize > 0 {
+		maxDatagramFrameSize := make([]byte, 2)
+		binary.BigEndian.PutUint16(maxDatagramFrameSize, uint16(p.MaxDatagramFrameSize))
+		params = append(params, transportParameter{maxDatagramFrameSizeParameterID, maxDatagramFrameSize})
+	}
+	if p.StatelessResetToken != nil {
+		params = append(params, transportParameter{statelessResetTokenParameterID, p.StatelessResetToken[:]})
+	}
 	return params
 }
 
 // String returns a string representation, intended for logging.
 // It should only used for IETF QUIC.
 func (p *TransportParameters) String() string {
-	return fmt.Sprintf("&handshake.TransportParameters{StreamFlowControlWindow: %#x, ConnectionFlowControlWindow: %#x, MaxBidiStreams: %d, MaxUniStreams: %d, IdleTimeout: %s}", p.StreamFlowControlWindow, p.ConnectionFlowControlWindow, p.MaxBidiStreams, p.MaxUniStreams, p.IdleTimeout)
+	return fmt.Sprintf("&handshake.TransportParameters{StreamFlowControlWindow: %#x, ConnectionFlowControlWindow: %#x, MaxBidiStreams: %d, MaxUniStreams: %d, IdleTimeout: %s, MaxDatagramFrameSize: %d}", p.StreamFlowControlWindow, p.ConnectionFlowControlWindow, p.MaxBidiStreams, p.MaxUniStreams, p.IdleTimeout, p.MaxDatagramFrameSize)
 }
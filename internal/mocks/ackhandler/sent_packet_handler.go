@@ -37,6 +37,18 @@ func (m *MockSentPacketHandler) EXPECT() *MockSentPacketHandlerMockRecorder {
 	return m.recorder
 }
 
+// BytesInFlight mocks base method
+func (m *MockSentPacketHandler) BytesInFlight() protocol.ByteCount {
+	ret := m.ctrl.Call(m, "BytesInFlight")
+	ret0, _ := ret[0].(protocol.ByteCount)
+	return ret0
+}
+
+// BytesInFlight indicates an expected call of BytesInFlight
+func (mr *MockSentPacketHandlerMockRecorder) BytesInFlight() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BytesInFlight", reflect.TypeOf((*MockSentPacketHandler)(nil).BytesInFlight))
+}
+
 // DequeuePacketForRetransmission mocks base method
 func (m *MockSentPacketHandler) DequeuePacketForRetransmission() *ackhandler.Packet {
 	ret := m.ctrl.Call(m, "DequeuePacketForRetransmission")
@@ -49,6 +61,30 @@ func (mr *MockSentPacketHandlerMockRecorder) DequeuePacketForRetransmission() *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DequeuePacketForRetransmission", reflect.TypeOf((*MockSentPacketHandler)(nil).DequeuePacketForRetransmission))
 }
 
+// ECNMode mocks base method
+func (m *MockSentPacketHandler) ECNMode() protocol.ECN {
+	ret := m.ctrl.Call(m, "ECNMode")
+	ret0, _ := ret[0].(protocol.ECN)
+	return ret0
+}
+
+// ECNMode indicates an expected call of ECNMode
+func (mr *MockSentPacketHandlerMockRecorder) ECNMode() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ECNMode", reflect.TypeOf((*MockSentPacketHandler)(nil).ECNMode))
+}
+
+// Finish0RTT mocks base method
+func (m *MockSentPacketHandler) Finish0RTT(arg0 bool) error {
+	ret := m.ctrl.Call(m, "Finish0RTT", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Finish0RTT indicates an expected call of Finish0RTT
+func (mr *MockSentPacketHandlerMockRecorder) Finish0RTT(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Finish0RTT", reflect.TypeOf((*MockSentPacketHandler)(nil).Finish0RTT), arg0)
+}
+
 // GetAlarmTimeout mocks base method
 func (m *MockSentPacketHandler) GetAlarmTimeout() time.Time {
 	ret := m.ctrl.Call(m, "GetAlarmTimeout")
@@ -85,6 +121,18 @@ func (mr *MockSentPacketHandlerMockRecorder) GetPacketNumberLen(arg0 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPacketNumberLen", reflect.TypeOf((*MockSentPacketHandler)(nil).GetPacketNumberLen), arg0)
 }
 
+// GetStats mocks base method
+func (m *MockSentPacketHandler) GetStats() *ackhandler.SentPacketStats {
+	ret := m.ctrl.Call(m, "GetStats")
+	ret0, _ := ret[0].(*ackhandler.SentPacketStats)
+	return ret0
+}
+
+// GetStats indicates an expected call of GetStats
+func (mr *MockSentPacketHandlerMockRecorder) GetStats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStats", reflect.TypeOf((*MockSentPacketHandler)(nil).GetStats))
+}
+
 // GetStopWaitingFrame mocks base method
 func (m *MockSentPacketHandler) GetStopWaitingFrame(arg0 bool) *wire.StopWaitingFrame {
 	ret := m.ctrl.Call(m, "GetStopWaitingFrame", arg0)
@@ -109,6 +157,16 @@ func (mr *MockSentPacketHandlerMockRecorder) OnAlarm() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnAlarm", reflect.TypeOf((*MockSentPacketHandler)(nil).OnAlarm))
 }
 
+// OnConnectionMigration mocks base method
+func (m *MockSentPacketHandler) OnConnectionMigration() {
+	m.ctrl.Call(m, "OnConnectionMigration")
+}
+
+// OnConnectionMigration indicates an expected call of OnConnectionMigration
+func (mr *MockSentPacketHandlerMockRecorder) OnConnectionMigration() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnConnectionMigration", reflect.TypeOf((*MockSentPacketHandler)(nil).OnConnectionMigration))
+}
+
 // ReceivedAck mocks base method
 func (m *MockSentPacketHandler) ReceivedAck(arg0 *wire.AckFrame, arg1 protocol.PacketNumber, arg2 protocol.EncryptionLevel, arg3 time.Time) error {
 	ret := m.ctrl.Call(m, "ReceivedAck", arg0, arg1, arg2, arg3)
@@ -47,6 +47,30 @@ func (mr *MockSendAlgorithmMockRecorder) GetCongestionWindow() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCongestionWindow", reflect.TypeOf((*MockSendAlgorithm)(nil).GetCongestionWindow))
 }
 
+// InRecovery mocks base method
+func (m *MockSendAlgorithm) InRecovery() bool {
+	ret := m.ctrl.Call(m, "InRecovery")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// InRecovery indicates an expected call of InRecovery
+func (mr *MockSendAlgorithmMockRecorder) InRecovery() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InRecovery", reflect.TypeOf((*MockSendAlgorithm)(nil).InRecovery))
+}
+
+// InSlowStart mocks base method
+func (m *MockSendAlgorithm) InSlowStart() bool {
+	ret := m.ctrl.Call(m, "InSlowStart")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// InSlowStart indicates an expected call of InSlowStart
+func (mr *MockSendAlgorithmMockRecorder) InSlowStart() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InSlowStart", reflect.TypeOf((*MockSendAlgorithm)(nil).InSlowStart))
+}
+
 // MaybeExitSlowStart mocks base method
 func (m *MockSendAlgorithm) MaybeExitSlowStart() {
 	m.ctrl.Call(m, "MaybeExitSlowStart")
@@ -67,6 +91,16 @@ func (mr *MockSendAlgorithmMockRecorder) OnConnectionMigration() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnConnectionMigration", reflect.TypeOf((*MockSendAlgorithm)(nil).OnConnectionMigration))
 }
 
+// OnECNCongestionEvent mocks base method
+func (m *MockSendAlgorithm) OnECNCongestionEvent(arg0 protocol.PacketNumber, arg1 protocol.ByteCount) {
+	m.ctrl.Call(m, "OnECNCongestionEvent", arg0, arg1)
+}
+
+// OnECNCongestionEvent indicates an expected call of OnECNCongestionEvent
+func (mr *MockSendAlgorithmMockRecorder) OnECNCongestionEvent(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnECNCongestionEvent", reflect.TypeOf((*MockSendAlgorithm)(nil).OnECNCongestionEvent), arg0, arg1)
+}
+
 // OnPacketAcked mocks base method
 func (m *MockSendAlgorithm) OnPacketAcked(arg0 protocol.PacketNumber, arg1, arg2 protocol.ByteCount, arg3 time.Time) {
 	m.ctrl.Call(m, "OnPacketAcked", arg0, arg1, arg2, arg3)
@@ -97,6 +131,16 @@ func (mr *MockSendAlgorithmMockRecorder) OnPacketSent(arg0, arg1, arg2, arg3, ar
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnPacketSent", reflect.TypeOf((*MockSendAlgorithm)(nil).OnPacketSent), arg0, arg1, arg2, arg3, arg4)
 }
 
+// OnRTTUpdated mocks base method
+func (m *MockSendAlgorithm) OnRTTUpdated() {
+	m.ctrl.Call(m, "OnRTTUpdated")
+}
+
+// OnRTTUpdated indicates an expected call of OnRTTUpdated
+func (mr *MockSendAlgorithmMockRecorder) OnRTTUpdated() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnRTTUpdated", reflect.TypeOf((*MockSendAlgorithm)(nil).OnRTTUpdated))
+}
+
 // OnRetransmissionTimeout mocks base method
 func (m *MockSendAlgorithm) OnRetransmissionTimeout(arg0 bool) {
 	m.ctrl.Call(m, "OnRetransmissionTimeout", arg0)
@@ -107,26 +151,6 @@ func (mr *MockSendAlgorithmMockRecorder) OnRetransmissionTimeout(arg0 interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnRetransmissionTimeout", reflect.TypeOf((*MockSendAlgorithm)(nil).OnRetransmissionTimeout), arg0)
 }
 
-// SetNumEmulatedConnections mocks base method
-func (m *MockSendAlgorithm) SetNumEmulatedConnections(arg0 int) {
-	m.ctrl.Call(m, "SetNumEmulatedConnections", arg0)
-}
-
-// SetNumEmulatedConnections indicates an expected call of SetNumEmulatedConnections
-func (mr *MockSendAlgorithmMockRecorder) SetNumEmulatedConnections(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNumEmulatedConnections", reflect.TypeOf((*MockSendAlgorithm)(nil).SetNumEmulatedConnections), arg0)
-}
-
-// SetSlowStartLargeReduction mocks base method
-func (m *MockSendAlgorithm) SetSlowStartLargeReduction(arg0 bool) {
-	m.ctrl.Call(m, "SetSlowStartLargeReduction", arg0)
-}
-
-// SetSlowStartLargeReduction indicates an expected call of SetSlowStartLargeReduction
-func (mr *MockSendAlgorithmMockRecorder) SetSlowStartLargeReduction(arg0 interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSlowStartLargeReduction", reflect.TypeOf((*MockSendAlgorithm)(nil).SetSlowStartLargeReduction), arg0)
-}
-
 // TimeUntilSend mocks base method
 func (m *MockSendAlgorithm) TimeUntilSend(arg0 protocol.ByteCount) time.Duration {
 	ret := m.ctrl.Call(m, "TimeUntilSend", arg0)
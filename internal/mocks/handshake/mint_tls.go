@@ -8,8 +8,9 @@ import (
 	io "io"
 	reflect "reflect"
 
-	mint "github.com/bifurcation/mint"
 	gomock "github.com/golang/mock/gomock"
+	crypto "github.com/wangjiezhe/quic-go/internal/crypto"
+	mint "github.com/wangjiezhe/quic-go/internal/mint"
 )
 
 // MockMintTLS is a mock of MintTLS interface
@@ -60,6 +61,18 @@ func (mr *MockMintTLSMockRecorder) ConnectionState() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionState", reflect.TypeOf((*MockMintTLS)(nil).ConnectionState))
 }
 
+// EarlyExporter mocks base method
+func (m *MockMintTLS) EarlyExporter() crypto.TLSExporter {
+	ret := m.ctrl.Call(m, "EarlyExporter")
+	ret0, _ := ret[0].(crypto.TLSExporter)
+	return ret0
+}
+
+// EarlyExporter indicates an expected call of EarlyExporter
+func (mr *MockMintTLSMockRecorder) EarlyExporter() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EarlyExporter", reflect.TypeOf((*MockMintTLS)(nil).EarlyExporter))
+}
+
 // GetCipherSuite mocks base method
 func (m *MockMintTLS) GetCipherSuite() mint.CipherSuiteParams {
 	ret := m.ctrl.Call(m, "GetCipherSuite")
@@ -72,6 +85,18 @@ func (mr *MockMintTLSMockRecorder) GetCipherSuite() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCipherSuite", reflect.TypeOf((*MockMintTLS)(nil).GetCipherSuite))
 }
 
+// HandlePostHandshakeMessages mocks base method
+func (m *MockMintTLS) HandlePostHandshakeMessages() error {
+	ret := m.ctrl.Call(m, "HandlePostHandshakeMessages")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// HandlePostHandshakeMessages indicates an expected call of HandlePostHandshakeMessages
+func (mr *MockMintTLSMockRecorder) HandlePostHandshakeMessages() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandlePostHandshakeMessages", reflect.TypeOf((*MockMintTLS)(nil).HandlePostHandshakeMessages))
+}
+
 // Handshake mocks base method
 func (m *MockMintTLS) Handshake() mint.Alert {
 	ret := m.ctrl.Call(m, "Handshake")
@@ -7,9 +7,9 @@ package mocks
 import (
 	reflect "reflect"
 
-	mint "github.com/bifurcation/mint"
 	gomock "github.com/golang/mock/gomock"
 	handshake "github.com/wangjiezhe/quic-go/internal/handshake"
+	mint "github.com/wangjiezhe/quic-go/internal/mint"
 )
 
 // MockTLSExtensionHandler is a mock of TLSExtensionHandler interface
@@ -10,9 +10,9 @@ import (
 // A ConnectionID in QUIC
 type ConnectionID []byte
 
-// GenerateConnectionID generates a connection ID using cryptographic random
-func GenerateConnectionID() (ConnectionID, error) {
-	b := make([]byte, ConnectionIDLen)
+// GenerateConnectionID generates a connection ID of length len using cryptographic random
+func GenerateConnectionID(len int) (ConnectionID, error) {
+	b := make([]byte, len)
 	if _, err := rand.Read(b); err != nil {
 		return nil, err
 	}
@@ -10,14 +10,29 @@ import (
 
 var _ = Describe("Connection ID generation", func() {
 	It("generates random connection IDs", func() {
-		c1, err := GenerateConnectionID()
+		c1, err := GenerateConnectionID(8)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(c1).ToNot(BeZero())
-		c2, err := GenerateConnectionID()
+		c2, err := GenerateConnectionID(8)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(c1).ToNot(Equal(c2))
 	})
 
+	It("generates connection IDs with the requested length", func() {
+		c, err := GenerateConnectionID(5)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Len()).To(Equal(5))
+		c, err = GenerateConnectionID(18)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Len()).To(Equal(18))
+	})
+
+	It("generates zero-length connection IDs", func() {
+		c, err := GenerateConnectionID(0)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Len()).To(BeZero())
+	})
+
 	It("says if connection IDs are equal", func() {
 		c1 := ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 		c2 := ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
@@ -52,6 +52,36 @@ func (t PacketType) String() string {
 	}
 }
 
+// ECN is the value of the ECN field in the IP header
+type ECN uint8
+
+// The ECN codepoints, see RFC 3168
+const (
+	// ECNNon is used for packets that are not ECN-capable (Not-ECT)
+	ECNNon ECN = iota // 00
+	// ECT1 is the ECT(1) codepoint
+	ECT1 // 01
+	// ECT0 is the ECT(0) codepoint
+	ECT0 // 10
+	// ECNCE is set by routers to signal congestion (Congestion Experienced)
+	ECNCE // 11
+)
+
+func (e ECN) String() string {
+	switch e {
+	case ECNNon:
+		return "Not-ECT"
+	case ECT1:
+		return "ECT(1)"
+	case ECT0:
+		return "ECT(0)"
+	case ECNCE:
+		return "CE"
+	default:
+		return fmt.Sprintf("invalid ECN value: %d", e)
+	}
+}
+
 // A ByteCount in QUIC
 type ByteCount uint64
 
@@ -146,8 +146,68 @@ const MaxAckFrameSize ByteCount = 1000
 // Example: For a packet pacing delay of 20 microseconds, we would send 5 packets at once, wait for 100 microseconds, and so forth.
 const MinPacingDelay time.Duration = 100 * time.Microsecond
 
-// ConnectionIDLen is the length of the source Connection ID used on IETF QUIC packets.
+// DefaultConnectionIDLength is the length of the source Connection ID used on IETF QUIC packets, if not configured.
 // The Short Header contains the connection ID, but not the length,
 // so we need to know this value in advance (or encode it into the connection ID).
-// TODO: make this configurable
-const ConnectionIDLen = 8
+const DefaultConnectionIDLength = 8
+
+// MinConnectionIDLenInitial is the minimum length of the destination connection ID chosen by the client for the Initial packet.
+const MinConnectionIDLenInitial = 8
+
+// ConnectionIDLenGQUIC is the length of the connection ID used in gQUIC.
+const ConnectionIDLenGQUIC = 8
+
+// MaxDatagramFrameSize is the maximum size of a DATAGRAM frame that we accept, and that we send.
+// It is chosen such that a DATAGRAM frame always fits into a packet of MinInitialPacketSize,
+// leaving enough space for the packet header and the AEAD overhead.
+const MaxDatagramFrameSize ByteCount = 1100
+
+// DatagramRcvQueueLen is the length of the receive queue for DATAGRAM frames.
+// If the application doesn't read the DATAGRAM frames fast enough, new frames are dropped.
+const DatagramRcvQueueLen = 128
+
+// MaxPathChallenges is the maximum number of PATH_CHALLENGE frames sent when validating a new path.
+// If no PATH_RESPONSE is received for any of them, the path validation fails.
+const MaxPathChallenges = 3
+
+// AmplificationFactor limits the amount of data sent to a new address of the peer, until that address is validated.
+// We send at most AmplificationFactor times the number of bytes received from the new address.
+const AmplificationFactor = 3
+
+// NumIssuedConnectionIDs is the number of additional connection IDs issued to the peer after the handshake completes.
+// The peer can switch to one of them when migrating the connection.
+const NumIssuedConnectionIDs = 3
+
+// MaxPeerConnectionIDs is the maximum number of unused connection IDs issued by the peer that we store.
+// Any additional connection IDs are dropped.
+const MaxPeerConnectionIDs = 8
+
+// StatelessResetTokenLen is the length of a stateless reset token.
+const StatelessResetTokenLen = 16
+
+// MinStatelessResetSize is the size of a stateless reset packet.
+// A stateless reset is only sent in response to packets larger than this,
+// so that two endpoints that lost state can't trigger an endless exchange of stateless resets.
+// It is large enough to be parsed as a Short Header packet for any connection ID length.
+const MinStatelessResetSize = 1 /* type byte */ + 18 /* maximum connection ID length */ + 4 /* packet number */ + StatelessResetTokenLen
+
+// SessionTicketLifetime is the lifetime of the session tickets issued by the server (for IETF QUIC).
+// Tickets are valid for at most 7 days (see TLS 1.3, section 4.6.1), we choose a shorter value.
+const SessionTicketLifetime = 24 * time.Hour
+
+// MaxSessionTickets is the maximum number of session tickets that a server stores.
+// When this limit is reached, new tickets are not stored any more, and clients using them fall back to a full handshake.
+const MaxSessionTickets = 10000
+
+// DefaultMax0RTTData is the default maximum number of bytes of application data that a client may send in 0-RTT packets when resuming a session.
+const DefaultMax0RTTData ByteCount = 64 * 1024
+
+// Max0RTTQueues is the maximum number of connections for which 0-RTT packets are buffered.
+// 0-RTT packets can arrive before the server created the session.
+const Max0RTTQueues = 32
+
+// Max0RTTQueueLen is the maximum number of 0-RTT packets buffered for a single connection.
+const Max0RTTQueueLen = 10
+
+// ZeroRTTQueueingDuration is the duration that 0-RTT packets are buffered for, if no session is created for them.
+const ZeroRTTQueueingDuration = 100 * time.Millisecond
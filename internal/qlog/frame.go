@@ -0,0 +1,127 @@
+package qlog
+
+import (
+	"encoding/hex"
+
+	"github.com/wangjiezhe/quic-go/internal/wire"
+)
+
+// frameToJSON converts a frame to its qlog representation.
+// It logs the same fields that wire.LogFrame logs.
+func frameToJSON(frame wire.Frame) map[string]interface{} {
+	switch f := frame.(type) {
+	case *wire.StreamFrame:
+		return map[string]interface{}{
+			"frame_type": "stream",
+			"stream_id":  f.StreamID,
+			"offset":     f.Offset,
+			"length":     f.DataLen(),
+			"fin":        f.FinBit,
+		}
+	case *wire.AckFrame:
+		// the highest ACK range is the first one in the frame
+		ranges := make([][2]interface{}, len(f.AckRanges))
+		for i, r := range f.AckRanges {
+			ranges[len(f.AckRanges)-1-i] = [2]interface{}{r.Smallest, r.Largest}
+		}
+		return map[string]interface{}{
+			"frame_type":   "ack",
+			"ack_delay":    milliseconds(f.DelayTime),
+			"acked_ranges": ranges,
+		}
+	case *wire.StopWaitingFrame:
+		return map[string]interface{}{
+			"frame_type":    "stop_waiting",
+			"least_unacked": f.LeastUnacked,
+		}
+	case *wire.PingFrame:
+		return map[string]interface{}{"frame_type": "ping"}
+	case *wire.RstStreamFrame:
+		return map[string]interface{}{
+			"frame_type": "reset_stream",
+			"stream_id":  f.StreamID,
+			"error_code": f.ErrorCode,
+			"final_size": f.ByteOffset,
+		}
+	case *wire.StopSendingFrame:
+		return map[string]interface{}{
+			"frame_type": "stop_sending",
+			"stream_id":  f.StreamID,
+			"error_code": f.ErrorCode,
+		}
+	case *wire.ConnectionCloseFrame:
+		return map[string]interface{}{
+			"frame_type":  "connection_close",
+			"error_space": "transport",
+			"error_code":  f.ErrorCode,
+			"reason":      f.ReasonPhrase,
+		}
+	case *wire.GoawayFrame:
+		return map[string]interface{}{
+			"frame_type":       "goaway",
+			"error_code":       f.ErrorCode,
+			"last_good_stream": f.LastGoodStream,
+			"reason":           f.ReasonPhrase,
+		}
+	case *wire.MaxDataFrame:
+		return map[string]interface{}{
+			"frame_type": "max_data",
+			"maximum":    f.ByteOffset,
+		}
+	case *wire.MaxStreamDataFrame:
+		return map[string]interface{}{
+			"frame_type": "max_stream_data",
+			"stream_id":  f.StreamID,
+			"maximum":    f.ByteOffset,
+		}
+	case *wire.MaxStreamIDFrame:
+		return map[string]interface{}{
+			"frame_type": "max_stream_id",
+			"stream_id":  f.StreamID,
+		}
+	case *wire.BlockedFrame:
+		return map[string]interface{}{
+			"frame_type": "data_blocked",
+			"limit":      f.Offset,
+		}
+	case *wire.StreamBlockedFrame:
+		return map[string]interface{}{
+			"frame_type": "stream_data_blocked",
+			"stream_id":  f.StreamID,
+			"limit":      f.Offset,
+		}
+	case *wire.StreamIDBlockedFrame:
+		return map[string]interface{}{
+			"frame_type": "stream_id_blocked",
+			"stream_id":  f.StreamID,
+		}
+	case *wire.PathChallengeFrame:
+		return map[string]interface{}{
+			"frame_type": "path_challenge",
+			"data":       hex.EncodeToString(f.Data[:]),
+		}
+	case *wire.PathResponseFrame:
+		return map[string]interface{}{
+			"frame_type": "path_response",
+			"data":       hex.EncodeToString(f.Data[:]),
+		}
+	case *wire.NewConnectionIDFrame:
+		return map[string]interface{}{
+			"frame_type":      "new_connection_id",
+			"sequence_number": f.SequenceNumber,
+			"connection_id":   hex.EncodeToString(f.ConnectionID),
+		}
+	case *wire.RetireConnectionIDFrame:
+		return map[string]interface{}{
+			"frame_type":      "retire_connection_id",
+			"sequence_number": f.SequenceNumber,
+		}
+	case *wire.DatagramFrame:
+		return map[string]interface{}{
+			"frame_type": "datagram",
+			"length":     len(f.Data),
+		}
+	default:
+		return map[string]interface{}{"frame_type": "unknown"}
+	}
+}
@@ -0,0 +1,66 @@
+package qlog
+
+import (
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+	"github.com/wangjiezhe/quic-go/qerr"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Frames", func() {
+	It("converts RST_STREAM frames", func() {
+		Expect(frameToJSON(&wire.RstStreamFrame{StreamID: 3, ErrorCode: 42, ByteOffset: 1337})).To(Equal(map[string]interface{}{
+			"frame_type": "reset_stream",
+			"stream_id":  protocol.StreamID(3),
+			"error_code": protocol.ApplicationErrorCode(42),
+			"final_size": protocol.ByteCount(1337),
+		}))
+	})
+
+	It("converts CONNECTION_CLOSE frames", func() {
+		Expect(frameToJSON(&wire.ConnectionCloseFrame{ErrorCode: qerr.NetworkIdleTimeout, ReasonPhrase: "foobar"})).To(Equal(map[string]interface{}{
+			"frame_type":  "connection_close",
+			"error_space": "transport",
+			"error_code":  qerr.NetworkIdleTimeout,
+			"reason":      "foobar",
+		}))
+	})
+
+	It("converts flow control frames", func() {
+		Expect(frameToJSON(&wire.MaxDataFrame{ByteOffset: 100})).To(HaveKeyWithValue("frame_type", "max_data"))
+		Expect(frameToJSON(&wire.MaxStreamDataFrame{StreamID: 5, ByteOffset: 100})).To(HaveKeyWithValue("frame_type", "max_stream_data"))
+		Expect(frameToJSON(&wire.BlockedFrame{Offset: 100})).To(HaveKeyWithValue("frame_type", "data_blocked"))
+		Expect(frameToJSON(&wire.StreamBlockedFrame{StreamID: 5, Offset: 100})).To(HaveKeyWithValue("frame_type", "stream_data_blocked"))
+	})
+
+	It("converts PATH_CHALLENGE frames", func() {
+		Expect(frameToJSON(&wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}})).To(Equal(map[string]interface{}{
+			"frame_type": "path_challenge",
+			"data":       "0102030405060708",
+		}))
+	})
+	It("converts NEW_CONNECTION_ID frames", func() {
+		Expect(frameToJSON(&wire.NewConnectionIDFrame{
+			SequenceNumber: 42,
+			ConnectionID:   protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef},
+		})).To(Equal(map[string]interface{}{
+			"frame_type":      "new_connection_id",
+			"sequence_number": uint64(42),
+			"connection_id":   "deadbeef",
+		}))
+	})
+	It("converts RETIRE_CONNECTION_ID frames", func() {
+		Expect(frameToJSON(&wire.RetireConnectionIDFrame{SequenceNumber: 42})).To(Equal(map[string]interface{}{
+			"frame_type":      "retire_connection_id",
+			"sequence_number": uint64(42),
+		}))
+	})
+	It("converts DATAGRAM frames", func() {
+		Expect(frameToJSON(&wire.DatagramFrame{Data: []byte("foobar")})).To(Equal(map[string]interface{}{
+			"frame_type": "datagram",
+			"length":     6,
+		}))
+	})
+})
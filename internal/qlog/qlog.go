@@ -0,0 +1,242 @@
+package qlog
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/ackhandler"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+)
+
+const qlogVersion = "draft-02-wip"
+
+// A PacketHeader contains the header fields of a packet that are logged.
+type PacketHeader struct {
+	// The Type is only set for packets with an IETF QUIC long header.
+	Type             protocol.PacketType
+	DestConnectionID protocol.ConnectionID
+	SrcConnectionID  protocol.ConnectionID
+	PacketNumber     protocol.PacketNumber
+	EncryptionLevel  protocol.EncryptionLevel
+	Size             protocol.ByteCount
+	// Duplicate is set for received packets that might have been received before.
+	Duplicate bool
+}
+
+// A Tracer writes the events of a single connection in the qlog format.
+// It is not safe for concurrent use.
+type Tracer struct {
+	w      io.WriteCloser
+	buf    *bufio.Writer
+	start  time.Time
+	first  bool
+	err    error
+	closed bool
+}
+
+// NewTracer creates a new Tracer that writes to w.
+// The trace is only complete after Close was called.
+func NewTracer(w io.WriteCloser, p protocol.Perspective, connID protocol.ConnectionID) *Tracer {
+	t := &Tracer{
+		w:     w,
+		buf:   bufio.NewWriter(w),
+		start: time.Now(),
+		first: true,
+	}
+	vantagePoint := "server"
+	if p == protocol.PerspectiveClient {
+		vantagePoint = "client"
+	}
+	header, err := json.Marshal(map[string]interface{}{
+		"vantage_point": map[string]interface{}{
+			"name": "quic-go",
+			"type": vantagePoint,
+		},
+		"title": "quic-go",
+		"common_fields": map[string]interface{}{
+			"ODCID":          hex.EncodeToString(connID),
+			"group_id":       hex.EncodeToString(connID),
+			"reference_time": t.start.UnixNano() / int64(time.Millisecond),
+		},
+		"event_fields": []string{"relative_time", "category", "event", "data"},
+	})
+	if err != nil {
+		t.err = err
+		return t
+	}
+	// The trace is written as a stream of events.
+	// Remove the closing brace of the trace, so that the events can be appended.
+	t.write(fmt.Sprintf(`{"qlog_version":%q,"title":"quic-go qlog","traces":[%s,"events":[`, qlogVersion, header[:len(header)-1]))
+	return t
+}
+
+// SentPacket logs a sent packet
+func (t *Tracer) SentPacket(hdr *PacketHeader, frames []wire.Frame) {
+	t.recordEvent("transport", "packet_sent", packetEvent(hdr, frames))
+}
+
+// ReceivedPacket logs a received packet
+func (t *Tracer) ReceivedPacket(hdr *PacketHeader, frames []wire.Frame) {
+	t.recordEvent("transport", "packet_received", packetEvent(hdr, frames))
+}
+
+// DroppedPacket logs a dropped packet
+func (t *Tracer) DroppedPacket(trigger string, size protocol.ByteCount) {
+	t.recordEvent("transport", "packet_dropped", map[string]interface{}{
+		"trigger":     trigger,
+		"packet_size": size,
+	})
+}
+
+// LostPacket logs a packet that was declared lost
+func (t *Tracer) LostPacket(encLevel protocol.EncryptionLevel, pn protocol.PacketNumber) {
+	t.recordEvent("recovery", "packet_lost", map[string]interface{}{
+		"packet_type":   packetType(0, encLevel),
+		"packet_number": pn,
+	})
+}
+
+// UpdatedMetrics logs the RTT estimates and the state of the congestion controller
+func (t *Tracer) UpdatedMetrics(m ackhandler.Metrics) {
+	t.recordEvent("recovery", "metrics_updated", map[string]interface{}{
+		"latest_rtt":        milliseconds(m.LatestRTT),
+		"smoothed_rtt":      milliseconds(m.SmoothedRTT),
+		"min_rtt":           milliseconds(m.MinRTT),
+		"rtt_variance":      milliseconds(m.MeanDeviation),
+		"congestion_window": m.CongestionWindow,
+		"bytes_in_flight":   m.BytesInFlight,
+	})
+}
+
+// UpdatedCongestionState logs a change of the congestion state
+func (t *Tracer) UpdatedCongestionState(s ackhandler.CongestionState) {
+	var state string
+	switch s {
+	case ackhandler.CongestionStateSlowStart:
+		state = "slow_start"
+	case ackhandler.CongestionStateCongestionAvoidance:
+		state = "congestion_avoidance"
+	case ackhandler.CongestionStateRecovery:
+		state = "recovery"
+	default:
+		state = "unknown"
+	}
+	t.recordEvent("recovery", "congestion_state_updated", map[string]interface{}{"new": state})
+}
+
+// LossTimerExpired logs the expiry of the loss detection alarm
+func (t *Tracer) LossTimerExpired(timerType ackhandler.TimerType) {
+	var tt string
+	switch timerType {
+	case ackhandler.TimerTypeHandshake:
+		tt = "handshake"
+	case ackhandler.TimerTypeLossTime:
+		tt = "loss_time"
+	case ackhandler.TimerTypeTLP:
+		tt = "tlp"
+	case ackhandler.TimerTypeRTO:
+		tt = "rto"
+	default:
+		tt = "unknown"
+	}
+	t.recordEvent("recovery", "loss_timer_updated", map[string]interface{}{
+		"event_type": "expired",
+		"timer_type": tt,
+	})
+}
+
+// Close completes the trace and closes the underlying writer.
+// It returns the first error that occurred while writing the trace.
+func (t *Tracer) Close() error {
+	if t.closed {
+		return t.err
+	}
+	t.closed = true
+	t.write("]}]}\n")
+	if t.err == nil {
+		t.err = t.buf.Flush()
+	}
+	if err := t.w.Close(); err != nil && t.err == nil {
+		t.err = err
+	}
+	return t.err
+}
+
+func (t *Tracer) recordEvent(category, name string, data interface{}) {
+	if t.closed || t.err != nil {
+		return
+	}
+	ev, err := json.Marshal([]interface{}{milliseconds(time.Since(t.start)), category, name, data})
+	if err != nil {
+		t.err = err
+		return
+	}
+	if !t.first {
+		t.write(",")
+	}
+	t.first = false
+	t.write("\n")
+	t.write(string(ev))
+}
+
+func (t *Tracer) write(s string) {
+	if t.err != nil {
+		return
+	}
+	_, t.err = t.buf.WriteString(s)
+}
+
+func packetEvent(hdr *PacketHeader, frames []wire.Frame) map[string]interface{} {
+	fs := make([]map[string]interface{}, len(frames))
+	for i, f := range frames {
+		fs[i] = frameToJSON(f)
+	}
+	ev := map[string]interface{}{
+		"packet_type": packetType(hdr.Type, hdr.EncryptionLevel),
+		"header": map[string]interface{}{
+			"packet_number": hdr.PacketNumber,
+			"packet_size":   hdr.Size,
+			"dcid":          hex.EncodeToString(hdr.DestConnectionID),
+			"scid":          hex.EncodeToString(hdr.SrcConnectionID),
+		},
+		"frames": fs,
+	}
+	if hdr.Duplicate {
+		ev["is_duplicate"] = true
+	}
+	return ev
+}
+
+// packetType returns the qlog packet type.
+// For packets without a long header, the type is derived from the encryption level.
+func packetType(t protocol.PacketType, encLevel protocol.EncryptionLevel) string {
+	switch t {
+	case protocol.PacketTypeInitial:
+		return "initial"
+	case protocol.PacketTypeRetry:
+		return "retry"
+	case protocol.PacketTypeHandshake:
+		return "handshake"
+	case protocol.PacketType0RTT:
+		return "0RTT"
+	}
+	switch encLevel {
+	case protocol.EncryptionUnencrypted:
+		return "initial"
+	case protocol.EncryptionSecure:
+		return "0RTT"
+	case protocol.EncryptionForwardSecure:
+		return "1RTT"
+	default:
+		return "unknown"
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
+}
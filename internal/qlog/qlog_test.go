@@ -0,0 +1,217 @@
+package qlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/ackhandler"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type nopWriteCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *nopWriteCloser) Close() error {
+	w.closed = true
+	return nil
+}
+
+type failingWriteCloser struct{}
+
+func (failingWriteCloser) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+func (failingWriteCloser) Close() error              { return nil }
+
+var _ = Describe("Tracer", func() {
+	var (
+		tracer *Tracer
+		buf    *nopWriteCloser
+	)
+
+	BeforeEach(func() {
+		buf = &nopWriteCloser{}
+		tracer = NewTracer(buf, protocol.PerspectiveServer, protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+	})
+
+	type trace struct {
+		VantagePoint struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"vantage_point"`
+		CommonFields map[string]interface{} `json:"common_fields"`
+		EventFields  []string               `json:"event_fields"`
+		Events       [][]interface{}        `json:"events"`
+	}
+
+	parse := func() *trace {
+		ExpectWithOffset(1, tracer.Close()).To(Succeed())
+		ExpectWithOffset(1, buf.closed).To(BeTrue())
+		var qlog struct {
+			Version string  `json:"qlog_version"`
+			Traces  []trace `json:"traces"`
+		}
+		ExpectWithOffset(1, json.Unmarshal(buf.Bytes(), &qlog)).To(Succeed())
+		ExpectWithOffset(1, qlog.Version).To(Equal(qlogVersion))
+		ExpectWithOffset(1, qlog.Traces).To(HaveLen(1))
+		return &qlog.Traces[0]
+	}
+
+	It("writes the trace header", func() {
+		t := parse()
+		Expect(t.VantagePoint.Name).To(Equal("quic-go"))
+		Expect(t.VantagePoint.Type).To(Equal("server"))
+		Expect(t.CommonFields).To(HaveKeyWithValue("ODCID", "deadbeef"))
+		Expect(t.CommonFields).To(HaveKey("reference_time"))
+		Expect(t.EventFields).To(Equal([]string{"relative_time", "category", "event", "data"}))
+		Expect(t.Events).To(BeEmpty())
+	})
+
+	It("sets the vantage point for clients", func() {
+		tracer = NewTracer(buf, protocol.PerspectiveClient, protocol.ConnectionID{1, 2, 3, 4})
+		Expect(parse().VantagePoint.Type).To(Equal("client"))
+	})
+
+	It("logs sent packets", func() {
+		tracer.SentPacket(&PacketHeader{
+			Type:             protocol.PacketTypeHandshake,
+			DestConnectionID: protocol.ConnectionID{1, 2, 3, 4},
+			SrcConnectionID:  protocol.ConnectionID{5, 6, 7, 8},
+			PacketNumber:     1337,
+			EncryptionLevel:  protocol.EncryptionUnencrypted,
+			Size:             1200,
+		}, []wire.Frame{
+			&wire.StreamFrame{StreamID: 42, Offset: 100, Data: []byte("foobar"), FinBit: true},
+			&wire.PingFrame{},
+		})
+		t := parse()
+		Expect(t.Events).To(HaveLen(1))
+		ev := t.Events[0]
+		Expect(ev[1]).To(Equal("transport"))
+		Expect(ev[2]).To(Equal("packet_sent"))
+		data := ev[3].(map[string]interface{})
+		Expect(data).To(HaveKeyWithValue("packet_type", "handshake"))
+		hdr := data["header"].(map[string]interface{})
+		Expect(hdr).To(HaveKeyWithValue("packet_number", 1337.0))
+		Expect(hdr).To(HaveKeyWithValue("packet_size", 1200.0))
+		Expect(hdr).To(HaveKeyWithValue("dcid", "01020304"))
+		Expect(hdr).To(HaveKeyWithValue("scid", "05060708"))
+		frames := data["frames"].([]interface{})
+		Expect(frames).To(HaveLen(2))
+		Expect(frames[0]).To(And(
+			HaveKeyWithValue("frame_type", "stream"),
+			HaveKeyWithValue("stream_id", 42.0),
+			HaveKeyWithValue("offset", 100.0),
+			HaveKeyWithValue("length", 6.0),
+			HaveKeyWithValue("fin", true),
+		))
+		Expect(frames[1]).To(HaveKeyWithValue("frame_type", "ping"))
+	})
+
+	It("logs received packets, deriving the packet type from the encryption level", func() {
+		tracer.ReceivedPacket(&PacketHeader{
+			PacketNumber:    42,
+			EncryptionLevel: protocol.EncryptionForwardSecure,
+		}, []wire.Frame{&wire.AckFrame{
+			AckRanges: []wire.AckRange{{Smallest: 10, Largest: 15}, {Smallest: 1, Largest: 5}},
+			DelayTime: 2 * time.Millisecond,
+		}})
+		t := parse()
+		Expect(t.Events).To(HaveLen(1))
+		Expect(t.Events[0][2]).To(Equal("packet_received"))
+		data := t.Events[0][3].(map[string]interface{})
+		Expect(data).To(HaveKeyWithValue("packet_type", "1RTT"))
+		frame := data["frames"].([]interface{})[0].(map[string]interface{})
+		Expect(frame).To(HaveKeyWithValue("frame_type", "ack"))
+		Expect(frame).To(HaveKeyWithValue("ack_delay", 2.0))
+		Expect(frame["acked_ranges"]).To(Equal([]interface{}{
+			[]interface{}{1.0, 5.0},
+			[]interface{}{10.0, 15.0},
+		}))
+	})
+
+	It("marks potentially duplicate packets", func() {
+		tracer.ReceivedPacket(&PacketHeader{
+			PacketNumber:    42,
+			EncryptionLevel: protocol.EncryptionForwardSecure,
+			Duplicate:       true,
+		}, nil)
+		t := parse()
+		Expect(t.Events).To(HaveLen(1))
+		Expect(t.Events[0][2]).To(Equal("packet_received"))
+		Expect(t.Events[0][3]).To(HaveKeyWithValue("is_duplicate", true))
+	})
+
+	It("logs dropped packets", func() {
+		tracer.DroppedPacket("duplicate", 123)
+		t := parse()
+		Expect(t.Events).To(HaveLen(1))
+		Expect(t.Events[0][2]).To(Equal("packet_dropped"))
+		Expect(t.Events[0][3]).To(And(
+			HaveKeyWithValue("trigger", "duplicate"),
+			HaveKeyWithValue("packet_size", 123.0),
+		))
+	})
+
+	It("logs recovery events", func() {
+		tracer.LostPacket(protocol.EncryptionSecure, 42)
+		tracer.UpdatedMetrics(ackhandler.Metrics{
+			LatestRTT:        15 * time.Millisecond,
+			SmoothedRTT:      20 * time.Millisecond,
+			MinRTT:           10 * time.Millisecond,
+			MeanDeviation:    5 * time.Millisecond,
+			CongestionWindow: 12345,
+			BytesInFlight:    1000,
+		})
+		tracer.UpdatedCongestionState(ackhandler.CongestionStateRecovery)
+		tracer.LossTimerExpired(ackhandler.TimerTypeRTO)
+		t := parse()
+		Expect(t.Events).To(HaveLen(4))
+		for _, ev := range t.Events {
+			Expect(ev[1]).To(Equal("recovery"))
+		}
+		Expect(t.Events[0][2]).To(Equal("packet_lost"))
+		Expect(t.Events[0][3]).To(And(
+			HaveKeyWithValue("packet_type", "0RTT"),
+			HaveKeyWithValue("packet_number", 42.0),
+		))
+		Expect(t.Events[1][2]).To(Equal("metrics_updated"))
+		Expect(t.Events[1][3]).To(And(
+			HaveKeyWithValue("latest_rtt", 15.0),
+			HaveKeyWithValue("smoothed_rtt", 20.0),
+			HaveKeyWithValue("min_rtt", 10.0),
+			HaveKeyWithValue("rtt_variance", 5.0),
+			HaveKeyWithValue("congestion_window", 12345.0),
+			HaveKeyWithValue("bytes_in_flight", 1000.0),
+		))
+		Expect(t.Events[2][2]).To(Equal("congestion_state_updated"))
+		Expect(t.Events[2][3]).To(HaveKeyWithValue("new", "recovery"))
+		Expect(t.Events[3][2]).To(Equal("loss_timer_updated"))
+		Expect(t.Events[3][3]).To(And(
+			HaveKeyWithValue("event_type", "expired"),
+			HaveKeyWithValue("timer_type", "rto"),
+		))
+	})
+
+	It("doesn't log events after it was closed", func() {
+		Expect(tracer.Close()).To(Succeed())
+		l := buf.Len()
+		tracer.DroppedPacket("duplicate", 123)
+		Expect(tracer.Close()).To(Succeed())
+		Expect(buf.Len()).To(Equal(l))
+	})
+
+	It("returns write errors", func() {
+		tracer = NewTracer(failingWriteCloser{}, protocol.PerspectiveClient, protocol.ConnectionID{1, 2, 3, 4})
+		for i := 0; i < 1000; i++ {
+			tracer.DroppedPacket("duplicate", 123)
+		}
+		Expect(tracer.Close()).To(MatchError("write failed"))
+	})
+})
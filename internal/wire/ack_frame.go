@@ -17,6 +17,10 @@ const ackDelayExponent = 3
 type AckFrame struct {
 	AckRanges []AckRange // has to be ordered. The highest ACK range goes first, the lowest ACK range goes last
 	DelayTime time.Duration
+
+	// The ECN counts are only used for IETF QUIC.
+	// If any of them is non-zero, the frame is sent as an ACK_ECN frame.
+	ECT0, ECT1, ECNCE uint64
 }
 
 // parseAckFrame reads an ACK frame
@@ -25,7 +29,8 @@ func parseAckFrame(r *bytes.Reader, version protocol.VersionNumber) (*AckFrame,
 		return parseAckFrameLegacy(r, version)
 	}
 
-	if _, err := r.ReadByte(); err != nil {
+	typeByte, err := r.ReadByte()
+	if err != nil {
 		return nil, err
 	}
 
@@ -41,6 +46,17 @@ func parseAckFrame(r *bytes.Reader, version protocol.VersionNumber) (*AckFrame,
 		return nil, err
 	}
 	frame.DelayTime = time.Duration(delay*1<<ackDelayExponent) * time.Microsecond
+	if typeByte == 0x1a {
+		if frame.ECT0, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+		if frame.ECT1, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+		if frame.ECNCE, err = utils.ReadVarInt(r); err != nil {
+			return nil, err
+		}
+	}
 	numBlocks, err := utils.ReadVarInt(r)
 	if err != nil {
 		return nil, err
@@ -95,9 +111,18 @@ func (f *AckFrame) Write(b *bytes.Buffer, version protocol.VersionNumber) error
 		return f.writeLegacy(b, version)
 	}
 
-	b.WriteByte(0x0d)
+	if f.HasECNCounts() {
+		b.WriteByte(0x1a)
+	} else {
+		b.WriteByte(0x0d)
+	}
 	utils.WriteVarInt(b, uint64(f.LargestAcked()))
 	utils.WriteVarInt(b, encodeAckDelay(f.DelayTime))
+	if f.HasECNCounts() {
+		utils.WriteVarInt(b, f.ECT0)
+		utils.WriteVarInt(b, f.ECT1)
+		utils.WriteVarInt(b, f.ECNCE)
+	}
 
 	numRanges := f.numEncodableAckRanges()
 	utils.WriteVarInt(b, uint64(numRanges-1))
@@ -124,7 +149,7 @@ func (f *AckFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
 	largestAcked := f.AckRanges[0].Largest
 	numRanges := f.numEncodableAckRanges()
 
-	length := 1 + utils.VarIntLen(uint64(largestAcked)) + utils.VarIntLen(encodeAckDelay(f.DelayTime))
+	length := 1 + utils.VarIntLen(uint64(largestAcked)) + utils.VarIntLen(encodeAckDelay(f.DelayTime)) + f.ecnCountsLen()
 
 	length += utils.VarIntLen(uint64(numRanges - 1))
 	lowestInFirstRange := f.AckRanges[0].Smallest
@@ -141,7 +166,7 @@ func (f *AckFrame) Length(version protocol.VersionNumber) protocol.ByteCount {
 // gets the number of ACK ranges that can be encoded
 // such that the resulting frame is smaller than the maximum ACK frame size
 func (f *AckFrame) numEncodableAckRanges() int {
-	length := 1 + utils.VarIntLen(uint64(f.LargestAcked())) + utils.VarIntLen(encodeAckDelay(f.DelayTime))
+	length := 1 + utils.VarIntLen(uint64(f.LargestAcked())) + utils.VarIntLen(encodeAckDelay(f.DelayTime)) + f.ecnCountsLen()
 	length += 2 // assume that the number of ranges will consume 2 bytes
 	for i := 1; i < len(f.AckRanges); i++ {
 		gap, len := f.encodeAckRange(i)
@@ -164,6 +189,18 @@ func (f *AckFrame) encodeAckRange(i int) (uint64 /* gap */, uint64 /* length */)
 		uint64(f.AckRanges[i].Largest - f.AckRanges[i].Smallest)
 }
 
+// HasECNCounts says if the frame contains ECN counts, i.e. if it is an ACK_ECN frame
+func (f *AckFrame) HasECNCounts() bool {
+	return f.ECT0 > 0 || f.ECT1 > 0 || f.ECNCE > 0
+}
+
+func (f *AckFrame) ecnCountsLen() protocol.ByteCount {
+	if !f.HasECNCounts() {
+		return 0
+	}
+	return utils.VarIntLen(f.ECT0) + utils.VarIntLen(f.ECT1) + utils.VarIntLen(f.ECNCE)
+}
+
 // HasMissingRanges returns if this frame reports any missing packets
 func (f *AckFrame) HasMissingRanges() bool {
 	return len(f.AckRanges) > 1
@@ -113,6 +113,27 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 			Expect(b.Len()).To(BeZero())
 		})
 
+		It("parses an ACK_ECN frame", func() {
+			data := []byte{0x1a}
+			data = append(data, encodeVarInt(100)...) // largest acked
+			data = append(data, encodeVarInt(0)...)   // delay
+			data = append(data, encodeVarInt(42)...)  // ECT(0) count
+			data = append(data, encodeVarInt(0)...)   // ECT(1) count
+			data = append(data, encodeVarInt(3)...)   // ECN-CE count
+			data = append(data, encodeVarInt(0)...)   // num blocks
+			data = append(data, encodeVarInt(10)...)  // first ack block
+			b := bytes.NewReader(data)
+			frame, err := parseAckFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.LargestAcked()).To(Equal(protocol.PacketNumber(100)))
+			Expect(frame.LowestAcked()).To(Equal(protocol.PacketNumber(90)))
+			Expect(frame.HasECNCounts()).To(BeTrue())
+			Expect(frame.ECT0).To(BeEquivalentTo(42))
+			Expect(frame.ECT1).To(BeZero())
+			Expect(frame.ECNCE).To(BeEquivalentTo(3))
+			Expect(b.Len()).To(BeZero())
+		})
+
 		It("errors on EOF", func() {
 			data := []byte{0xd}
 			data = append(data, encodeVarInt(1000)...) // largest acked
@@ -146,6 +167,25 @@ var _ = Describe("ACK Frame (for IETF QUIC)", func() {
 			Expect(buf.Bytes()).To(Equal(expected))
 		})
 
+		It("writes an ACK_ECN frame", func() {
+			buf := &bytes.Buffer{}
+			f := &AckFrame{
+				AckRanges: []AckRange{{Smallest: 100, Largest: 1337}},
+				ECT0:      1000,
+				ECT1:      0,
+				ECNCE:     12,
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(f.Length(versionIETFFrames)).To(BeEquivalentTo(buf.Len()))
+			Expect(buf.Bytes()[0]).To(BeEquivalentTo(0x1a))
+			b := bytes.NewReader(buf.Bytes())
+			frame, err := parseAckFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+			Expect(b.Len()).To(BeZero())
+		})
+
 		It("writes a frame that acks a single packet", func() {
 			buf := &bytes.Buffer{}
 			f := &AckFrame{
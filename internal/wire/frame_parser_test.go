@@ -289,6 +289,19 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame.(*AckFrame).LargestAcked()).To(Equal(protocol.PacketNumber(0x13)))
 		})
 
+		It("unpacks ACK_ECN frames", func() {
+			f := &AckFrame{
+				AckRanges: []AckRange{{Smallest: 1, Largest: 0x13}},
+				ECT0:      10,
+				ECNCE:     2,
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("unpacks PATH_CHALLENGE frames", func() {
 			f := &PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
 			err := f.Write(buf, versionIETFFrames)
@@ -311,6 +324,36 @@ var _ = Describe("Frame parsing", func() {
 			Expect(frame.(*PathResponseFrame).Data).To(Equal([8]byte{1, 2, 3, 4, 5, 6, 7, 8}))
 		})
 
+		It("unpacks NEW_CONNECTION_ID frames", func() {
+			f := &NewConnectionIDFrame{
+				SequenceNumber: 0x1337,
+				ConnectionID:   protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+			}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks RETIRE_CONNECTION_ID frames", func() {
+			f := &RetireConnectionIDFrame{SequenceNumber: 0x1337}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
+		It("unpacks DATAGRAM frames", func() {
+			f := &DatagramFrame{DataLenPresent: true, Data: []byte("foobar")}
+			err := f.Write(buf, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := ParseNextFrame(bytes.NewReader(buf.Bytes()), nil, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(f))
+		})
+
 		It("errors on invalid type", func() {
 			_, err := ParseNextFrame(bytes.NewReader([]byte{0x42}), nil, versionIETFFrames)
 			Expect(err).To(MatchError("InvalidFrameData: unknown type byte 0x42"))
@@ -326,11 +369,14 @@ var _ = Describe("Frame parsing", func() {
 				0x08: qerr.InvalidBlockedData,
 				0x09: qerr.InvalidBlockedData,
 				0x0a: qerr.InvalidFrameData,
+				0x0b: qerr.InvalidFrameData,
 				0x0c: qerr.InvalidFrameData,
 				0x0d: qerr.InvalidAckData,
+				0x1a: qerr.InvalidAckData,
 				0x0e: qerr.InvalidFrameData,
 				0x0f: qerr.InvalidFrameData,
 				0x10: qerr.InvalidStreamData,
+				0x31: qerr.InvalidFrameData,
 			} {
 				_, err := ParseNextFrame(bytes.NewReader([]byte{b}), nil, versionIETFFrames)
 				Expect(err).To(HaveOccurred())
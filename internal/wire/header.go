@@ -2,6 +2,7 @@ package wire
 
 import (
 	"bytes"
+	"io"
 
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 	"github.com/wangjiezhe/quic-go/internal/utils"
@@ -36,10 +37,13 @@ type Header struct {
 	IsLongHeader bool
 	KeyPhase     int
 	PayloadLen   protocol.ByteCount
+	// Token is the address validation token. It is only present in Initial and Retry packets.
+	Token []byte
 }
 
 // ParseHeaderSentByServer parses the header for a packet that was sent by the server.
-func ParseHeaderSentByServer(b *bytes.Reader) (*Header, error) {
+// The connIDLen is the length of the connection ID chosen by the client. It is needed to parse the IETF Short Header.
+func ParseHeaderSentByServer(b *bytes.Reader, connIDLen int) (*Header, error) {
 	typeByte, err := b.ReadByte()
 	if err != nil {
 		return nil, err
@@ -53,11 +57,12 @@ func ParseHeaderSentByServer(b *bytes.Reader) (*Header, error) {
 		// gQUIC never uses 6 byte packet numbers, so the third and fourth bit will never be 11
 		isPublicHeader = typeByte&0x30 != 0x30
 	}
-	return parsePacketHeader(b, protocol.PerspectiveServer, isPublicHeader)
+	return parsePacketHeader(b, protocol.PerspectiveServer, isPublicHeader, connIDLen)
 }
 
 // ParseHeaderSentByClient parses the header for a packet that was sent by the client.
-func ParseHeaderSentByClient(b *bytes.Reader) (*Header, error) {
+// The connIDLen is the length of the connection ID chosen by the server. It is needed to parse the IETF Short Header.
+func ParseHeaderSentByClient(b *bytes.Reader, connIDLen int) (*Header, error) {
 	typeByte, err := b.ReadByte()
 	if err != nil {
 		return nil, err
@@ -71,10 +76,35 @@ func ParseHeaderSentByClient(b *bytes.Reader) (*Header, error) {
 	// * 0x80 is always unset and
 	// * and 0x8 is always set (this is the Connection ID flag, which the client always sets)
 	isPublicHeader := typeByte&0x88 == 0x8
-	return parsePacketHeader(b, protocol.PerspectiveClient, isPublicHeader)
+	return parsePacketHeader(b, protocol.PerspectiveClient, isPublicHeader, connIDLen)
 }
 
-func parsePacketHeader(b *bytes.Reader, sentBy protocol.Perspective, isPublicHeader bool) (*Header, error) {
+// ParseDestConnectionID parses the destination connection ID of a packet, without parsing the rest of the header.
+// It works for packets sent by the client and by the server.
+// In the IETF Short Header and the gQUIC Public Header, the connection ID directly follows the first byte.
+// The connIDLen is the length of the connection ID in that case.
+func ParseDestConnectionID(data []byte, connIDLen int) (protocol.ConnectionID, error) {
+	if len(data) == 0 {
+		return nil, io.EOF
+	}
+	if data[0]&0x80 == 0 {
+		if len(data) < 1+connIDLen {
+			return nil, io.EOF
+		}
+		return protocol.ConnectionID(data[1 : 1+connIDLen]), nil
+	}
+	// IETF Long Header or Version Negotiation: type byte, version and the connection ID lengths
+	if len(data) < 6 {
+		return nil, io.EOF
+	}
+	dcil, _ := decodeConnIDLen(data[5])
+	if len(data) < 6+dcil {
+		return nil, io.EOF
+	}
+	return protocol.ConnectionID(data[6 : 6+dcil]), nil
+}
+
+func parsePacketHeader(b *bytes.Reader, sentBy protocol.Perspective, isPublicHeader bool, connIDLen int) (*Header, error) {
 	// This is a gQUIC Public Header.
 	if isPublicHeader {
 		hdr, err := parsePublicHeader(b, sentBy)
@@ -84,7 +114,7 @@ func parsePacketHeader(b *bytes.Reader, sentBy protocol.Perspective, isPublicHea
 		hdr.IsPublicHeader = true // save that this is a Public Header, so we can log it correctly later
 		return hdr, nil
 	}
-	return parseHeader(b)
+	return parseHeader(b, connIDLen)
 }
 
 // Write writes the Header.
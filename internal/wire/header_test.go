@@ -31,7 +31,7 @@ var _ = Describe("Header", func() {
 				PacketNumberLen:  protocol.PacketNumberLen2,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.KeyPhase).To(BeEquivalentTo(1))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
@@ -49,7 +49,7 @@ var _ = Describe("Header", func() {
 				Version:          0x1234,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.Type).To(Equal(protocol.PacketType0RTT))
 			Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
@@ -68,7 +68,7 @@ var _ = Describe("Header", func() {
 				PacketNumber:     0x42,
 			}).writeHeader(buf)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.IsPublicHeader).To(BeFalse())
 		})
@@ -85,7 +85,7 @@ var _ = Describe("Header", func() {
 				PacketNumberLen:  protocol.PacketNumberLen4,
 			}).writePublicHeader(buf, protocol.PerspectiveClient, versionPublicHeader)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.DestConnectionID).To(Equal(connID))
 			Expect(hdr.SrcConnectionID).To(Equal(connID))
@@ -105,7 +105,7 @@ var _ = Describe("Header", func() {
 				DiversificationNonce: bytes.Repeat([]byte{'f'}, 32),
 			}).writePublicHeader(buf, protocol.PerspectiveServer, versionPublicHeader)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()))
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.DestConnectionID).To(Equal(connID))
 			Expect(hdr.SrcConnectionID).To(Equal(connID))
@@ -125,14 +125,14 @@ var _ = Describe("Header", func() {
 				PacketNumberLen:  protocol.PacketNumberLen2,
 			}).writePublicHeader(buf, protocol.PerspectiveClient, versionPublicHeader)
 			Expect(err).ToNot(HaveOccurred())
-			_, err = ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()[0:12]))
+			_, err = ParseHeaderSentByClient(bytes.NewReader(buf.Bytes()[0:12]), 8)
 			Expect(err).To(MatchError(io.EOF))
 		})
 
 		It("errors when given no data", func() {
-			_, err := ParseHeaderSentByServer(bytes.NewReader([]byte{}))
+			_, err := ParseHeaderSentByServer(bytes.NewReader([]byte{}), 8)
 			Expect(err).To(MatchError(io.EOF))
-			_, err = ParseHeaderSentByClient(bytes.NewReader([]byte{}))
+			_, err = ParseHeaderSentByClient(bytes.NewReader([]byte{}), 8)
 			Expect(err).To(MatchError(io.EOF))
 		})
 
@@ -140,7 +140,7 @@ var _ = Describe("Header", func() {
 			connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0xde, 0xca, 0xfb, 0xad}
 			versions := []protocol.VersionNumber{0x13, 0x37}
 			data := ComposeGQUICVersionNegotiation(connID, versions)
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data))
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.IsPublicHeader).To(BeTrue())
 			Expect(hdr.DestConnectionID).To(Equal(connID))
@@ -157,7 +157,7 @@ var _ = Describe("Header", func() {
 			versions := []protocol.VersionNumber{0x13, 0x37}
 			data, err := ComposeVersionNegotiation(destConnID, srcConnID, versions)
 			Expect(err).ToNot(HaveOccurred())
-			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data))
+			hdr, err := ParseHeaderSentByServer(bytes.NewReader(data), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.IsPublicHeader).To(BeFalse())
 			Expect(hdr.IsVersionNegotiation).To(BeTrue())
@@ -171,6 +171,82 @@ var _ = Describe("Header", func() {
 		})
 	})
 
+	Context("parsing the destination connection ID", func() {
+		It("parses the connection ID of a Long Header packet", func() {
+			buf := &bytes.Buffer{}
+			err := (&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeHandshake,
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5},
+				SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				PacketNumber:     0x42,
+				Version:          versionIETFHeader,
+			}).writeHeader(buf)
+			Expect(err).ToNot(HaveOccurred())
+			connID, err := ParseDestConnectionID(buf.Bytes(), 8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5}))
+		})
+
+		It("parses the connection ID of a Version Negotiation Packet", func() {
+			data, err := ComposeVersionNegotiation(protocol.ConnectionID{1, 3, 3, 7}, protocol.ConnectionID{1, 2, 3, 4}, []protocol.VersionNumber{0x13})
+			Expect(err).ToNot(HaveOccurred())
+			connID, err := ParseDestConnectionID(data, 8)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connID).To(Equal(protocol.ConnectionID{1, 3, 3, 7}))
+		})
+
+		It("parses the connection ID of a Short Header packet", func() {
+			buf := &bytes.Buffer{}
+			err := (&Header{
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5},
+				PacketNumber:     0x42,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+			}).writeHeader(buf)
+			Expect(err).ToNot(HaveOccurred())
+			connID, err := ParseDestConnectionID(buf.Bytes(), 5)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(connID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5}))
+		})
+
+		It("parses the connection ID of a gQUIC Public Header, sent by the client and by the server", func() {
+			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+			for _, pers := range []protocol.Perspective{protocol.PerspectiveClient, protocol.PerspectiveServer} {
+				buf := &bytes.Buffer{}
+				err := (&Header{
+					DestConnectionID: connID,
+					SrcConnectionID:  connID,
+					PacketNumber:     0x1337,
+					PacketNumberLen:  protocol.PacketNumberLen4,
+				}).writePublicHeader(buf, pers, versionPublicHeader)
+				Expect(err).ToNot(HaveOccurred())
+				c, err := ParseDestConnectionID(buf.Bytes(), 8)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(c).To(Equal(connID))
+			}
+		})
+
+		It("errors on packets that are too short", func() {
+			buf := &bytes.Buffer{}
+			err := (&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeHandshake,
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5},
+				SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				PacketNumber:     0x42,
+				Version:          versionIETFHeader,
+			}).writeHeader(buf)
+			Expect(err).ToNot(HaveOccurred())
+			data := buf.Bytes()
+			for i := 0; i < 11; i++ {
+				_, err := ParseDestConnectionID(data[:i], 8)
+				Expect(err).To(Equal(io.EOF))
+			}
+			_, err = ParseDestConnectionID([]byte{0x30, 1, 2, 3}, 4)
+			Expect(err).To(Equal(io.EOF))
+		})
+	})
+
 	Context("writing", func() {
 		It("writes a gQUIC Public Header", func() {
 			buf := &bytes.Buffer{}
@@ -199,7 +275,7 @@ var _ = Describe("Header", func() {
 			}
 			err := hdr.Write(buf, protocol.PerspectiveServer, versionIETFHeader)
 			Expect(err).ToNot(HaveOccurred())
-			_, err = ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()))
+			_, err = ParseHeaderSentByServer(bytes.NewReader(buf.Bytes()), 8)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.IsPublicHeader).To(BeFalse())
 		})
@@ -12,7 +12,8 @@ import (
 )
 
 // parseHeader parses the header.
-func parseHeader(b *bytes.Reader) (*Header, error) {
+// The Short Header doesn't contain the length of the connection ID, so it has to be passed in.
+func parseHeader(b *bytes.Reader, shortHeaderConnIDLen int) (*Header, error) {
 	typeByte, err := b.ReadByte()
 	if err != nil {
 		return nil, err
@@ -20,7 +21,7 @@ func parseHeader(b *bytes.Reader) (*Header, error) {
 	if typeByte&0x80 > 0 {
 		return parseLongHeader(b, typeByte)
 	}
-	return parseShortHeader(b, typeByte)
+	return parseShortHeader(b, typeByte, shortHeaderConnIDLen)
 }
 
 // parse long header and version negotiation packets
@@ -67,6 +68,20 @@ func parseLongHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
 		return h, nil
 	}
 
+	h.Type = protocol.PacketType(typeByte & 0x7f)
+	if h.hasToken() {
+		tokenLen, err := utils.ReadVarInt(b)
+		if err != nil {
+			return nil, err
+		}
+		if tokenLen > uint64(b.Len()) {
+			return nil, io.EOF
+		}
+		h.Token = make([]byte, tokenLen)
+		if _, err := io.ReadFull(b, h.Token); err != nil {
+			return nil, err
+		}
+	}
 	pl, err := utils.ReadVarInt(b)
 	if err != nil {
 		return nil, err
@@ -78,7 +93,6 @@ func parseLongHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
 	}
 	h.PacketNumber = protocol.PacketNumber(pn)
 	h.PacketNumberLen = protocol.PacketNumberLen4
-	h.Type = protocol.PacketType(typeByte & 0x7f)
 
 	if h.Type != protocol.PacketTypeInitial && h.Type != protocol.PacketTypeRetry && h.Type != protocol.PacketType0RTT && h.Type != protocol.PacketTypeHandshake {
 		return nil, qerr.Error(qerr.InvalidPacketHeader, fmt.Sprintf("Received packet with invalid packet type: %d", h.Type))
@@ -86,8 +100,8 @@ func parseLongHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
 	return h, nil
 }
 
-func parseShortHeader(b *bytes.Reader, typeByte byte) (*Header, error) {
-	connID := make(protocol.ConnectionID, 8)
+func parseShortHeader(b *bytes.Reader, typeByte byte, connIDLen int) (*Header, error) {
+	connID := make(protocol.ConnectionID, connIDLen)
 	if _, err := io.ReadFull(b, connID); err != nil {
 		if err == io.ErrUnexpectedEOF {
 			err = io.EOF
@@ -131,9 +145,6 @@ func (h *Header) writeHeader(b *bytes.Buffer) error {
 
 // TODO: add support for the key phase
 func (h *Header) writeLongHeader(b *bytes.Buffer) error {
-	if h.SrcConnectionID.Len() != protocol.ConnectionIDLen {
-		return fmt.Errorf("Header: source connection ID must be %d bytes, is %d", protocol.ConnectionIDLen, h.SrcConnectionID.Len())
-	}
 	b.WriteByte(byte(0x80 | h.Type))
 	utils.BigEndian.WriteUint32(b, uint32(h.Version))
 	connIDLen, err := encodeConnIDLen(h.DestConnectionID, h.SrcConnectionID)
@@ -143,6 +154,10 @@ func (h *Header) writeLongHeader(b *bytes.Buffer) error {
 	b.WriteByte(connIDLen)
 	b.Write(h.DestConnectionID.Bytes())
 	b.Write(h.SrcConnectionID.Bytes())
+	if h.hasToken() {
+		utils.WriteVarInt(b, uint64(len(h.Token)))
+		b.Write(h.Token)
+	}
 	utils.WriteVarInt(b, uint64(h.PayloadLen))
 	utils.BigEndian.WriteUint32(b, uint32(h.PacketNumber))
 	return nil
@@ -176,7 +191,11 @@ func (h *Header) writeShortHeader(b *bytes.Buffer) error {
 
 func (h *Header) getHeaderLength() (protocol.ByteCount, error) {
 	if h.IsLongHeader {
-		return 1 /* type byte */ + 4 /* version */ + 1 /* conn id len byte */ + protocol.ByteCount(h.DestConnectionID.Len()+h.SrcConnectionID.Len()) + utils.VarIntLen(uint64(h.PayloadLen)) + 4 /* packet number */, nil
+		length := 1 /* type byte */ + 4 /* version */ + 1 /* conn id len byte */ + protocol.ByteCount(h.DestConnectionID.Len()+h.SrcConnectionID.Len()) + utils.VarIntLen(uint64(h.PayloadLen)) + 4 /* packet number */
+		if h.hasToken() {
+			length += utils.VarIntLen(uint64(len(h.Token))) + protocol.ByteCount(len(h.Token))
+		}
+		return length, nil
 	}
 
 	length := protocol.ByteCount(1 /* type byte */ + h.DestConnectionID.Len())
@@ -192,13 +211,23 @@ func (h *Header) logHeader(logger utils.Logger) {
 		if h.Version == 0 {
 			logger.Debugf("\tVersionNegotiationPacket{DestConnectionID: %s, SrcConnectionID: %s, SupportedVersions: %s}", h.DestConnectionID, h.SrcConnectionID, h.SupportedVersions)
 		} else {
-			logger.Debugf("\tLong Header{Type: %s, DestConnectionID: %s, SrcConnectionID: %s, PacketNumber: %#x, PayloadLen: %d, Version: %s}", h.Type, h.DestConnectionID, h.SrcConnectionID, h.PacketNumber, h.PayloadLen, h.Version)
+			var token string
+			if h.hasToken() {
+				token = fmt.Sprintf("Token: %#x, ", h.Token)
+			}
+			logger.Debugf("\tLong Header{Type: %s, DestConnectionID: %s, SrcConnectionID: %s, %sPacketNumber: %#x, PayloadLen: %d, Version: %s}", h.Type, h.DestConnectionID, h.SrcConnectionID, token, h.PacketNumber, h.PayloadLen, h.Version)
 		}
 	} else {
 		logger.Debugf("\tShort Header{DestConnectionID: %s, PacketNumber: %#x, PacketNumberLen: %d, KeyPhase: %d}", h.DestConnectionID, h.PacketNumber, h.PacketNumberLen, h.KeyPhase)
 	}
 }
 
+// hasToken says if the header contains the token field.
+// Only Initial and Retry packets carry a token.
+func (h *Header) hasToken() bool {
+	return h.Type == protocol.PacketTypeInitial || h.Type == protocol.PacketTypeRetry
+}
+
 func encodeConnIDLen(dest, src protocol.ConnectionID) (byte, error) {
 	dcil, err := encodeSingleConnIDLen(dest)
 	if err != nil {
@@ -15,7 +15,7 @@ import (
 )
 
 var _ = Describe("IETF QUIC Header", func() {
-	srcConnID := protocol.ConnectionID(bytes.Repeat([]byte{'f'}, protocol.ConnectionIDLen))
+	srcConnID := protocol.ConnectionID(bytes.Repeat([]byte{'f'}, protocol.DefaultConnectionIDLength))
 
 	Context("parsing", func() {
 		Context("Version Negotiation Packets", func() {
@@ -25,7 +25,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data, err := ComposeVersionNegotiation(connID, connID, versions)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsVersionNegotiation).To(BeTrue())
 				Expect(h.Version).To(BeZero())
@@ -42,7 +42,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data, err := ComposeVersionNegotiation(connID, connID, versions)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(data[:len(data)-2])
-				_, err = parseHeader(b)
+				_, err = parseHeader(b, 8)
 				Expect(err).To(MatchError(qerr.InvalidVersionNegotiationPacket))
 			})
 
@@ -52,7 +52,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				data, err := ComposeVersionNegotiation(connID, connID, versions)
 				Expect(err).ToNot(HaveOccurred())
 				// remove 8 bytes (two versions), since ComposeVersionNegotiation also added a reserved version number
-				_, err = parseHeader(bytes.NewReader(data[:len(data)-8]))
+				_, err = parseHeader(bytes.NewReader(data[:len(data)-8]), 8)
 				Expect(err).To(MatchError("InvalidVersionNegotiationPacket: empty version list"))
 			})
 		})
@@ -66,6 +66,10 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // destination connection ID
 					0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37, // source connection ID
 				}
+				if t == protocol.PacketTypeInitial || t == protocol.PacketTypeRetry {
+					data = append(data, encodeVarInt(6)...) // token length
+					data = append(data, []byte("foobar")...)
+				}
 				data = append(data, encodeVarInt(0x1337)...)           // payload length
 				data = append(data, []byte{0xde, 0xca, 0xfb, 0xad}...) // packet number
 				return data
@@ -73,13 +77,14 @@ var _ = Describe("IETF QUIC Header", func() {
 
 			It("parses a long header", func() {
 				b := bytes.NewReader(generatePacket(protocol.PacketTypeInitial))
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.Type).To(Equal(protocol.PacketTypeInitial))
 				Expect(h.IsLongHeader).To(BeTrue())
 				Expect(h.OmitConnectionID).To(BeFalse())
 				Expect(h.DestConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}))
 				Expect(h.SrcConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37}))
+				Expect(h.Token).To(Equal([]byte("foobar")))
 				Expect(h.PayloadLen).To(Equal(protocol.ByteCount(0x1337)))
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0xdecafbad)))
 				Expect(h.PacketNumberLen).To(Equal(protocol.PacketNumberLen4))
@@ -88,17 +93,50 @@ var _ = Describe("IETF QUIC Header", func() {
 				Expect(b.Len()).To(BeZero())
 			})
 
+			It("parses the token of a Retry packet", func() {
+				b := bytes.NewReader(generatePacket(protocol.PacketTypeRetry))
+				h, err := parseHeader(b, 8)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.Type).To(Equal(protocol.PacketTypeRetry))
+				Expect(h.Token).To(Equal([]byte("foobar")))
+				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0xdecafbad)))
+				Expect(b.Len()).To(BeZero())
+			})
+
+			It("parses a Handshake packet, which doesn't have a token", func() {
+				b := bytes.NewReader(generatePacket(protocol.PacketTypeHandshake))
+				h, err := parseHeader(b, 8)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.Type).To(Equal(protocol.PacketTypeHandshake))
+				Expect(h.Token).To(BeEmpty())
+				Expect(h.PayloadLen).To(Equal(protocol.ByteCount(0x1337)))
+				Expect(b.Len()).To(BeZero())
+			})
+
+			It("errors if the token length is larger than the packet", func() {
+				data := []byte{
+					0x80 ^ uint8(protocol.PacketTypeInitial),
+					0x1, 0x2, 0x3, 0x4, // version number
+					0x0, // connection ID lengths
+				}
+				data = append(data, encodeVarInt(100)...) // token length
+				data = append(data, []byte("foobar")...)
+				_, err := parseHeader(bytes.NewReader(data), 8)
+				Expect(err).To(Equal(io.EOF))
+			})
+
 			It("parses a long header without a destination connection ID", func() {
 				data := []byte{
 					0x80 ^ uint8(protocol.PacketTypeInitial),
 					0x1, 0x2, 0x3, 0x4, // version number
 					0x01,                   // connection ID lengths
 					0xde, 0xad, 0xbe, 0xef, // source connection ID
+					0x0, // token length
 				}
 				data = append(data, encodeVarInt(0x42)...) // payload length
 				data = append(data, []byte{0xde, 0xca, 0xfb, 0xad}...)
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.SrcConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}))
 				Expect(h.DestConnectionID).To(BeEmpty())
@@ -110,11 +148,12 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x1, 0x2, 0x3, 0x4, // version number
 					0x70,                          // connection ID lengths
 					1, 2, 3, 4, 5, 6, 7, 8, 9, 10, // source connection ID
+					0x0, // token length
 				}
 				data = append(data, encodeVarInt(0x42)...) // payload length
 				data = append(data, []byte{0xde, 0xca, 0xfb, 0xad}...)
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.SrcConnectionID).To(BeEmpty())
 				Expect(h.DestConnectionID).To(Equal(protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}))
@@ -130,7 +169,7 @@ var _ = Describe("IETF QUIC Header", func() {
 				}).Write(buf, protocol.PerspectiveClient, protocol.VersionTLS)
 				Expect(err).ToNot(HaveOccurred())
 				b := bytes.NewReader(buf.Bytes())
-				_, err = parseHeader(b)
+				_, err = parseHeader(b, 8)
 				Expect(err).To(MatchError("InvalidPacketHeader: Received packet with invalid packet type: 42"))
 			})
 
@@ -144,7 +183,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
 				for i := 0; i < len(data); i++ {
-					_, err := parseHeader(bytes.NewReader(data[:i]))
+					_, err := parseHeader(bytes.NewReader(data[:i]), 8)
 					Expect(err).To(Equal(io.EOF))
 				}
 			})
@@ -158,7 +197,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x42, // packet number
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.KeyPhase).To(Equal(0))
@@ -170,6 +209,33 @@ var _ = Describe("IETF QUIC Header", func() {
 				Expect(b.Len()).To(BeZero())
 			})
 
+			It("reads a short header with a connection ID of a different length", func() {
+				data := []byte{
+					0x30,                         // 1 byte packet number
+					0xde, 0xad, 0xbe, 0xef, 0xca, // connection ID
+					0x42, // packet number
+				}
+				b := bytes.NewReader(data)
+				h, err := parseHeader(b, 5)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.DestConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca}))
+				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
+				Expect(b.Len()).To(BeZero())
+			})
+
+			It("reads a short header with a zero-length connection ID", func() {
+				data := []byte{
+					0x30, // 1 byte packet number
+					0x42, // packet number
+				}
+				b := bytes.NewReader(data)
+				h, err := parseHeader(b, 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(h.DestConnectionID).To(BeEmpty())
+				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x42)))
+				Expect(b.Len()).To(BeZero())
+			})
+
 			It("reads the Key Phase Bit", func() {
 				data := []byte{
 					0x30 ^ 0x40,
@@ -177,7 +243,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x11,
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.KeyPhase).To(Equal(1))
@@ -191,7 +257,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0x13, 0x37, // packet number
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
@@ -206,7 +272,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xad, 0xbe, 0xef, // packet number
 				}
 				b := bytes.NewReader(data)
-				h, err := parseHeader(b)
+				h, err := parseHeader(b, 8)
 				Expect(err).ToNot(HaveOccurred())
 				Expect(h.IsLongHeader).To(BeFalse())
 				Expect(h.PacketNumber).To(Equal(protocol.PacketNumber(0xdeadbeef)))
@@ -221,7 +287,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xad, 0xbe, 0xef, // packet number
 				}
 				b := bytes.NewReader(data)
-				_, err := parseHeader(b)
+				_, err := parseHeader(b, 8)
 				Expect(err).To(MatchError("invalid short header type"))
 			})
 
@@ -232,7 +298,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
 				b := bytes.NewReader(data)
-				_, err := parseHeader(b)
+				_, err := parseHeader(b, 8)
 				Expect(err).To(MatchError("invalid bits 3, 4 and 5"))
 			})
 
@@ -243,7 +309,7 @@ var _ = Describe("IETF QUIC Header", func() {
 					0xde, 0xca, 0xfb, 0xad, // packet number
 				}
 				for i := 0; i < len(data); i++ {
-					_, err := parseHeader(bytes.NewReader(data[:i]))
+					_, err := parseHeader(bytes.NewReader(data[:i]), 8)
 					Expect(err).To(Equal(io.EOF))
 				}
 			})
@@ -281,6 +347,56 @@ var _ = Describe("IETF QUIC Header", func() {
 				Expect(buf.Bytes()).To(Equal(expected))
 			})
 
+			It("writes the token of an Initial packet", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeInitial,
+					DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37},
+					SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x0, 0x0, 0x13, 0x37},
+					Token:            []byte("foobar"),
+					PayloadLen:       0xcafe,
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				hdr, err := parseHeader(bytes.NewReader(buf.Bytes()), 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.Token).To(Equal([]byte("foobar")))
+				Expect(hdr.PayloadLen).To(Equal(protocol.ByteCount(0xcafe)))
+				Expect(hdr.PacketNumber).To(Equal(protocol.PacketNumber(0xdecafbad)))
+			})
+
+			It("doesn't write a token for Handshake packets", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37},
+					SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x0, 0x0, 0x13, 0x37},
+					Token:            []byte("foobar"),
+					PayloadLen:       0xcafe,
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(buf.Bytes()).ToNot(ContainSubstring("foobar"))
+			})
+
+			It("writes a header with a zero-length source connection ID", func() {
+				err := (&Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe},
+					PayloadLen:       0xcafe,
+					PacketNumber:     0xdecafbad,
+					Version:          0x1020304,
+				}).writeHeader(buf)
+				Expect(err).ToNot(HaveOccurred())
+				hdr, err := parseHeader(bytes.NewReader(buf.Bytes()), 0)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.DestConnectionID).To(Equal(protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe}))
+				Expect(hdr.SrcConnectionID).To(BeEmpty())
+			})
+
 			It("refuses to write a header with a too short connection ID", func() {
 				err := (&Header{
 					IsLongHeader:     true,
@@ -432,6 +548,22 @@ var _ = Describe("IETF QUIC Header", func() {
 			Expect(buf.Len()).To(Equal(expectedLen))
 		})
 
+		It("has the right length for an Initial packet containing a token", func() {
+			h := &Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				PayloadLen:       1500,
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				Token:            []byte("foobar"),
+			}
+			expectedLen := 1 /* type byte */ + 4 /* version */ + 1 /* conn ID len */ + 8 /* dest conn id */ + 8 /* src conn id */ + 1 /* token len */ + 6 /* token */ + 2 /* long payload len */ + 4 /* packet number */
+			Expect(h.getHeaderLength()).To(BeEquivalentTo(expectedLen))
+			err := h.writeHeader(buf)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buf.Len()).To(Equal(expectedLen))
+		})
+
 		It("has the right length for a hort header containing a connection ID", func() {
 			h := &Header{
 				PacketNumberLen:  protocol.PacketNumberLen1,
@@ -526,6 +658,20 @@ var _ = Describe("IETF QUIC Header", func() {
 			Expect(buf.String()).To(ContainSubstring("Long Header{Type: Handshake, DestConnectionID: 0xdeadbeefcafe1337, SrcConnectionID: 0xdecafbad13371337, PacketNumber: 0x1337, PayloadLen: 54321, Version: 0xfeed}"))
 		})
 
+		It("logs the token of Initial packets", func() {
+			(&Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				PacketNumber:     0x1337,
+				PayloadLen:       54321,
+				DestConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef, 0xca, 0xfe, 0x13, 0x37},
+				SrcConnectionID:  protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x013, 0x37, 0x13, 0x37},
+				Token:            []byte{0xde, 0xad, 0xbe, 0xef},
+				Version:          0xfeed,
+			}).logHeader(logger)
+			Expect(buf.String()).To(ContainSubstring("Token: 0xdeadbeef, "))
+		})
+
 		It("logs Short Headers containing a connection ID", func() {
 			(&Header{
 				KeyPhase:         1,
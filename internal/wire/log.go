@@ -35,6 +35,13 @@ func LogFrame(logger utils.Logger, frame Frame, sent bool) {
 		} else {
 			logger.Debugf("\t%s &wire.AckFrame{LargestAcked: %#x, LowestAcked: %#x, DelayTime: %s}", dir, f.LargestAcked(), f.LowestAcked(), f.DelayTime.String())
 		}
+		if f.HasECNCounts() {
+			logger.Debugf("\t\tECN counts: ECT(0): %d, ECT(1): %d, CE: %d", f.ECT0, f.ECT1, f.ECNCE)
+		}
+	case *NewConnectionIDFrame:
+		logger.Debugf("\t%s &wire.NewConnectionIDFrame{SequenceNumber: %d, ConnectionID: %s}", dir, f.SequenceNumber, f.ConnectionID)
+	case *DatagramFrame:
+		logger.Debugf("\t%s &wire.DatagramFrame{Length: %d}", dir, len(f.Data))
 	default:
 		logger.Debugf("\t%s %#v", dir, frame)
 	}
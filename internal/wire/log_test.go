@@ -56,6 +56,16 @@ var _ = Describe("Frame logging", func() {
 		Expect(buf.Bytes()).To(ContainSubstring("\t<- &wire.StreamFrame{StreamID: 42, FinBit: false, Offset: 0x1337, Data length: 0x100, Offset + Data length: 0x1437}\n"))
 	})
 
+	It("logs NEW_CONNECTION_ID frames", func() {
+		LogFrame(logger, &NewConnectionIDFrame{SequenceNumber: 42, ConnectionID: protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}}, false)
+		Expect(buf.Bytes()).To(ContainSubstring("\t<- &wire.NewConnectionIDFrame{SequenceNumber: 42, ConnectionID: 0xdeadbeef}\n"))
+	})
+
+	It("logs DATAGRAM frames", func() {
+		LogFrame(logger, &DatagramFrame{Data: []byte("foobar")}, true)
+		Expect(buf.Bytes()).To(ContainSubstring("\t-> &wire.DatagramFrame{Length: 6}\n"))
+	})
+
 	It("logs ACK frames without missing packets", func() {
 		frame := &AckFrame{
 			AckRanges: []AckRange{{Smallest: 0x42, Largest: 0x1337}},
@@ -77,6 +87,16 @@ var _ = Describe("Frame logging", func() {
 		Expect(buf.String()).To(ContainSubstring("\t<- &wire.AckFrame{LargestAcked: 0x8, LowestAcked: 0x2, AckRanges: {{Largest: 0x8, Smallest: 0x5}, {Largest: 0x3, Smallest: 0x2}}, DelayTime: 12ms}\n"))
 	})
 
+	It("logs the ECN counts of ACK frames", func() {
+		frame := &AckFrame{
+			AckRanges: []AckRange{{Smallest: 0x42, Largest: 0x1337}},
+			ECT0:      10,
+			ECNCE:     3,
+		}
+		LogFrame(logger, frame, true)
+		Expect(buf.String()).To(ContainSubstring("\t\tECN counts: ECT(0): 10, ECT(1): 0, CE: 3\n"))
+	})
+
 	It("logs incoming StopWaiting frames", func() {
 		frame := &StopWaitingFrame{
 			LeastUnacked: 0x1337,
@@ -0,0 +1,46 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RETIRE_CONNECTION_ID frame", func() {
+	Context("when parsing", func() {
+		It("accepts a sample frame", func() {
+			data := []byte{0x19}
+			data = append(data, encodeVarInt(0xdeadbeef)...) // sequence number
+			b := bytes.NewReader(data)
+			frame, err := parseRetireConnectionIDFrame(b, versionIETFFrames)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame.SequenceNumber).To(Equal(uint64(0xdeadbeef)))
+			Expect(b.Len()).To(BeZero())
+		})
+
+		It("errors on EOFs", func() {
+			data := []byte{0x19}
+			data = append(data, encodeVarInt(0xdeadbeef)...)
+			_, err := parseRetireConnectionIDFrame(bytes.NewReader(data), versionIETFFrames)
+			Expect(err).NotTo(HaveOccurred())
+			for i := range data {
+				_, err := parseRetireConnectionIDFrame(bytes.NewReader(data[0:i]), versionIETFFrames)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+	})
+
+	Context("when writing", func() {
+		It("writes a sample frame", func() {
+			frame := &RetireConnectionIDFrame{SequenceNumber: 0x1337}
+			b := &bytes.Buffer{}
+			Expect(frame.Write(b, versionIETFFrames)).To(Succeed())
+			expected := []byte{0x19}
+			expected = append(expected, encodeVarInt(0x1337)...)
+			Expect(b.Bytes()).To(Equal(expected))
+			Expect(frame.Length(versionIETFFrames)).To(BeEquivalentTo(b.Len()))
+		})
+	})
+})
@@ -9,9 +9,9 @@ import (
 	"fmt"
 	"io"
 
-	"github.com/bifurcation/mint"
 	"github.com/wangjiezhe/quic-go/internal/crypto"
 	"github.com/wangjiezhe/quic-go/internal/handshake"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 	"github.com/wangjiezhe/quic-go/internal/utils"
 	"github.com/wangjiezhe/quic-go/internal/wire"
@@ -65,6 +65,37 @@ func (mc *mintController) SetCryptoStream(stream io.ReadWriter) {
 	mc.csc.SetStream(stream)
 }
 
+func (mc *mintController) EarlyExporter() crypto.TLSExporter {
+	cs, ok := mc.conn.EarlyExporterCipherSuite()
+	if !ok {
+		return nil
+	}
+	return &earlyExporter{conn: mc.conn, cipherSuite: cs}
+}
+
+func (mc *mintController) HandlePostHandshakeMessages() error {
+	// mint processes post-handshake messages when reading application data.
+	// Since application data is never sent on the crypto stream, Read only returns when an error occurs.
+	_, err := mc.conn.Read(make([]byte, 1))
+	return err
+}
+
+// The earlyExporter exports keying material from the early exporter master secret.
+type earlyExporter struct {
+	conn        *mint.Conn
+	cipherSuite mint.CipherSuiteParams
+}
+
+var _ crypto.TLSExporter = &earlyExporter{}
+
+func (e *earlyExporter) GetCipherSuite() mint.CipherSuiteParams {
+	return e.cipherSuite
+}
+
+func (e *earlyExporter) ComputeExporter(label string, context []byte, keyLength int) ([]byte, error) {
+	return e.conn.ComputeEarlyExporter(label, context, keyLength)
+}
+
 func tlsToMintConfig(tlsConf *tls.Config, pers protocol.Perspective) (*mint.Config, error) {
 	mconf := &mint.Config{
 		NonBlocking: true,
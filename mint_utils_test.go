@@ -21,7 +21,7 @@ var _ = Describe("Packing and unpacking Initial packets", func() {
 	ver := protocol.VersionTLS
 	hdr := &wire.Header{
 		IsLongHeader:     true,
-		Type:             protocol.PacketTypeRetry,
+		Type:             protocol.PacketTypeHandshake,
 		PacketNumber:     0x42,
 		DestConnectionID: connID,
 		SrcConnectionID:  connID,
@@ -8,6 +8,7 @@ import (
 	context "context"
 	net "net"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	handshake "github.com/wangjiezhe/quic-go/internal/handshake"
@@ -75,6 +76,18 @@ func (mr *MockPacketHandlerMockRecorder) Close(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockPacketHandler)(nil).Close), arg0)
 }
 
+// CloseGracefully mocks base method
+func (m *MockPacketHandler) CloseGracefully(arg0 time.Duration) error {
+	ret := m.ctrl.Call(m, "CloseGracefully", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CloseGracefully indicates an expected call of CloseGracefully
+func (mr *MockPacketHandlerMockRecorder) CloseGracefully(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseGracefully", reflect.TypeOf((*MockPacketHandler)(nil).CloseGracefully), arg0)
+}
+
 // ConnectionState mocks base method
 func (m *MockPacketHandler) ConnectionState() handshake.ConnectionState {
 	ret := m.ctrl.Call(m, "ConnectionState")
@@ -87,6 +100,18 @@ func (mr *MockPacketHandlerMockRecorder) ConnectionState() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionState", reflect.TypeOf((*MockPacketHandler)(nil).ConnectionState))
 }
 
+// ConnectionStats mocks base method
+func (m *MockPacketHandler) ConnectionStats() ConnectionStats {
+	ret := m.ctrl.Call(m, "ConnectionStats")
+	ret0, _ := ret[0].(ConnectionStats)
+	return ret0
+}
+
+// ConnectionStats indicates an expected call of ConnectionStats
+func (mr *MockPacketHandlerMockRecorder) ConnectionStats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConnectionStats", reflect.TypeOf((*MockPacketHandler)(nil).ConnectionStats))
+}
+
 // Context mocks base method
 func (m *MockPacketHandler) Context() context.Context {
 	ret := m.ctrl.Call(m, "Context")
@@ -111,6 +136,18 @@ func (mr *MockPacketHandlerMockRecorder) GetVersion() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVersion", reflect.TypeOf((*MockPacketHandler)(nil).GetVersion))
 }
 
+// HandshakeComplete mocks base method
+func (m *MockPacketHandler) HandshakeComplete() context.Context {
+	ret := m.ctrl.Call(m, "HandshakeComplete")
+	ret0, _ := ret[0].(context.Context)
+	return ret0
+}
+
+// HandshakeComplete indicates an expected call of HandshakeComplete
+func (mr *MockPacketHandlerMockRecorder) HandshakeComplete() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandshakeComplete", reflect.TypeOf((*MockPacketHandler)(nil).HandshakeComplete))
+}
+
 // LocalAddr mocks base method
 func (m *MockPacketHandler) LocalAddr() net.Addr {
 	ret := m.ctrl.Call(m, "LocalAddr")
@@ -123,6 +160,18 @@ func (mr *MockPacketHandlerMockRecorder) LocalAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LocalAddr", reflect.TypeOf((*MockPacketHandler)(nil).LocalAddr))
 }
 
+// MigrateTo mocks base method
+func (m *MockPacketHandler) MigrateTo(arg0 net.PacketConn) error {
+	ret := m.ctrl.Call(m, "MigrateTo", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MigrateTo indicates an expected call of MigrateTo
+func (mr *MockPacketHandlerMockRecorder) MigrateTo(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MigrateTo", reflect.TypeOf((*MockPacketHandler)(nil).MigrateTo), arg0)
+}
+
 // OpenStream mocks base method
 func (m *MockPacketHandler) OpenStream() (Stream, error) {
 	ret := m.ctrl.Call(m, "OpenStream")
@@ -175,6 +224,19 @@ func (mr *MockPacketHandlerMockRecorder) OpenUniStreamSync() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockPacketHandler)(nil).OpenUniStreamSync))
 }
 
+// ReceiveMessage mocks base method
+func (m *MockPacketHandler) ReceiveMessage() ([]byte, error) {
+	ret := m.ctrl.Call(m, "ReceiveMessage")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReceiveMessage indicates an expected call of ReceiveMessage
+func (mr *MockPacketHandlerMockRecorder) ReceiveMessage() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReceiveMessage", reflect.TypeOf((*MockPacketHandler)(nil).ReceiveMessage))
+}
+
 // RemoteAddr mocks base method
 func (m *MockPacketHandler) RemoteAddr() net.Addr {
 	ret := m.ctrl.Call(m, "RemoteAddr")
@@ -187,6 +249,28 @@ func (mr *MockPacketHandlerMockRecorder) RemoteAddr() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteAddr", reflect.TypeOf((*MockPacketHandler)(nil).RemoteAddr))
 }
 
+// SendMessage mocks base method
+func (m *MockPacketHandler) SendMessage(arg0 []byte) error {
+	ret := m.ctrl.Call(m, "SendMessage", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendMessage indicates an expected call of SendMessage
+func (mr *MockPacketHandlerMockRecorder) SendMessage(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendMessage", reflect.TypeOf((*MockPacketHandler)(nil).SendMessage), arg0)
+}
+
+// closePath mocks base method
+func (m *MockPacketHandler) closePath(arg0 connection, arg1 error) {
+	m.ctrl.Call(m, "closePath", arg0, arg1)
+}
+
+// closePath indicates an expected call of closePath
+func (mr *MockPacketHandlerMockRecorder) closePath(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "closePath", reflect.TypeOf((*MockPacketHandler)(nil).closePath), arg0, arg1)
+}
+
 // closeRemote mocks base method
 func (m *MockPacketHandler) closeRemote(arg0 error) {
 	m.ctrl.Call(m, "closeRemote", arg0)
@@ -34,6 +34,19 @@ func (m *MockQuicAEAD) EXPECT() *MockQuicAEADMockRecorder {
 	return m.recorder
 }
 
+// Open0RTT mocks base method
+func (m *MockQuicAEAD) Open0RTT(arg0, arg1 []byte, arg2 protocol.PacketNumber, arg3 []byte) ([]byte, error) {
+	ret := m.ctrl.Call(m, "Open0RTT", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Open0RTT indicates an expected call of Open0RTT
+func (mr *MockQuicAEADMockRecorder) Open0RTT(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Open0RTT", reflect.TypeOf((*MockQuicAEAD)(nil).Open0RTT), arg0, arg1, arg2, arg3)
+}
+
 // Open1RTT mocks base method
 func (m *MockQuicAEAD) Open1RTT(arg0, arg1 []byte, arg2 protocol.PacketNumber, arg3 []byte) ([]byte, error) {
 	ret := m.ctrl.Call(m, "Open1RTT", arg0, arg1, arg2, arg3)
@@ -73,6 +73,16 @@ func (mr *MockSendStreamIMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockSendStreamI)(nil).Context))
 }
 
+// SetPriority mocks base method
+func (m *MockSendStreamI) SetPriority(arg0 Priority) {
+	m.ctrl.Call(m, "SetPriority", arg0)
+}
+
+// SetPriority indicates an expected call of SetPriority
+func (mr *MockSendStreamIMockRecorder) SetPriority(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPriority", reflect.TypeOf((*MockSendStreamI)(nil).SetPriority), arg0)
+}
+
 // SetWriteDeadline mocks base method
 func (m *MockSendStreamI) SetWriteDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetWriteDeadline", arg0)
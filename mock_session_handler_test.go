@@ -6,6 +6,7 @@ package quic
 
 import (
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	protocol "github.com/wangjiezhe/quic-go/internal/protocol"
@@ -44,6 +45,18 @@ func (mr *MockSessionHandlerMockRecorder) Add(arg0, arg1 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockSessionHandler)(nil).Add), arg0, arg1)
 }
 
+// AddIfNotTaken mocks base method
+func (m *MockSessionHandler) AddIfNotTaken(arg0 protocol.ConnectionID, arg1 packetHandler) bool {
+	ret := m.ctrl.Call(m, "AddIfNotTaken", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// AddIfNotTaken indicates an expected call of AddIfNotTaken
+func (mr *MockSessionHandlerMockRecorder) AddIfNotTaken(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddIfNotTaken", reflect.TypeOf((*MockSessionHandler)(nil).AddIfNotTaken), arg0, arg1)
+}
+
 // Close mocks base method
 func (m *MockSessionHandler) Close() {
 	m.ctrl.Call(m, "Close")
@@ -54,6 +67,16 @@ func (mr *MockSessionHandlerMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockSessionHandler)(nil).Close))
 }
 
+// CloseGracefully mocks base method
+func (m *MockSessionHandler) CloseGracefully(arg0 time.Duration) {
+	m.ctrl.Call(m, "CloseGracefully", arg0)
+}
+
+// CloseGracefully indicates an expected call of CloseGracefully
+func (mr *MockSessionHandlerMockRecorder) CloseGracefully(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CloseGracefully", reflect.TypeOf((*MockSessionHandler)(nil).CloseGracefully), arg0)
+}
+
 // Get mocks base method
 func (m *MockSessionHandler) Get(arg0 protocol.ConnectionID) (packetHandler, bool) {
 	ret := m.ctrl.Call(m, "Get", arg0)
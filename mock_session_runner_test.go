@@ -34,6 +34,48 @@ func (m *MockSessionRunner) EXPECT() *MockSessionRunnerMockRecorder {
 	return m.recorder
 }
 
+// addConnectionID mocks base method
+func (m *MockSessionRunner) addConnectionID(arg0 protocol.ConnectionID, arg1 packetHandler) {
+	m.ctrl.Call(m, "addConnectionID", arg0, arg1)
+}
+
+// addConnectionID indicates an expected call of addConnectionID
+func (mr *MockSessionRunnerMockRecorder) addConnectionID(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addConnectionID", reflect.TypeOf((*MockSessionRunner)(nil).addConnectionID), arg0, arg1)
+}
+
+// addPath mocks base method
+func (m *MockSessionRunner) addPath(arg0 connection) {
+	m.ctrl.Call(m, "addPath", arg0)
+}
+
+// addPath indicates an expected call of addPath
+func (mr *MockSessionRunnerMockRecorder) addPath(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addPath", reflect.TypeOf((*MockSessionRunner)(nil).addPath), arg0)
+}
+
+// addResetToken mocks base method
+func (m *MockSessionRunner) addResetToken(arg0 [16]byte) {
+	m.ctrl.Call(m, "addResetToken", arg0)
+}
+
+// addResetToken indicates an expected call of addResetToken
+func (mr *MockSessionRunnerMockRecorder) addResetToken(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "addResetToken", reflect.TypeOf((*MockSessionRunner)(nil).addResetToken), arg0)
+}
+
+// getStatelessResetToken mocks base method
+func (m *MockSessionRunner) getStatelessResetToken(arg0 protocol.ConnectionID) [16]byte {
+	ret := m.ctrl.Call(m, "getStatelessResetToken", arg0)
+	ret0, _ := ret[0].([16]byte)
+	return ret0
+}
+
+// getStatelessResetToken indicates an expected call of getStatelessResetToken
+func (mr *MockSessionRunnerMockRecorder) getStatelessResetToken(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "getStatelessResetToken", reflect.TypeOf((*MockSessionRunner)(nil).getStatelessResetToken), arg0)
+}
+
 // onHandshakeComplete mocks base method
 func (m *MockSessionRunner) onHandshakeComplete(arg0 packetHandler) {
 	m.ctrl.Call(m, "onHandshakeComplete", arg0)
@@ -53,3 +95,13 @@ func (m *MockSessionRunner) removeConnectionID(arg0 protocol.ConnectionID) {
 func (mr *MockSessionRunnerMockRecorder) removeConnectionID(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "removeConnectionID", reflect.TypeOf((*MockSessionRunner)(nil).removeConnectionID), arg0)
 }
+
+// removePath mocks base method
+func (m *MockSessionRunner) removePath(arg0 connection) {
+	m.ctrl.Call(m, "removePath", arg0)
+}
+
+// removePath indicates an expected call of removePath
+func (mr *MockSessionRunnerMockRecorder) removePath(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "removePath", reflect.TypeOf((*MockSessionRunner)(nil).removePath), arg0)
+}
@@ -6,6 +6,7 @@ package quic
 
 import (
 	context "context"
+	net "net"
 	reflect "reflect"
 	time "time"
 
@@ -85,6 +86,18 @@ func (mr *MockStreamIMockRecorder) Context() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Context", reflect.TypeOf((*MockStreamI)(nil).Context))
 }
 
+// LocalAddr mocks base method
+func (m *MockStreamI) LocalAddr() net.Addr {
+	ret := m.ctrl.Call(m, "LocalAddr")
+	ret0, _ := ret[0].(net.Addr)
+	return ret0
+}
+
+// LocalAddr indicates an expected call of LocalAddr
+func (mr *MockStreamIMockRecorder) LocalAddr() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LocalAddr", reflect.TypeOf((*MockStreamI)(nil).LocalAddr))
+}
+
 // Read mocks base method
 func (m *MockStreamI) Read(arg0 []byte) (int, error) {
 	ret := m.ctrl.Call(m, "Read", arg0)
@@ -98,6 +111,18 @@ func (mr *MockStreamIMockRecorder) Read(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockStreamI)(nil).Read), arg0)
 }
 
+// RemoteAddr mocks base method
+func (m *MockStreamI) RemoteAddr() net.Addr {
+	ret := m.ctrl.Call(m, "RemoteAddr")
+	ret0, _ := ret[0].(net.Addr)
+	return ret0
+}
+
+// RemoteAddr indicates an expected call of RemoteAddr
+func (mr *MockStreamIMockRecorder) RemoteAddr() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoteAddr", reflect.TypeOf((*MockStreamI)(nil).RemoteAddr))
+}
+
 // SetDeadline mocks base method
 func (m *MockStreamI) SetDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetDeadline", arg0)
@@ -110,6 +135,16 @@ func (mr *MockStreamIMockRecorder) SetDeadline(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeadline", reflect.TypeOf((*MockStreamI)(nil).SetDeadline), arg0)
 }
 
+// SetPriority mocks base method
+func (m *MockStreamI) SetPriority(arg0 Priority) {
+	m.ctrl.Call(m, "SetPriority", arg0)
+}
+
+// SetPriority indicates an expected call of SetPriority
+func (mr *MockStreamIMockRecorder) SetPriority(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPriority", reflect.TypeOf((*MockStreamI)(nil).SetPriority), arg0)
+}
+
 // SetReadDeadline mocks base method
 func (m *MockStreamI) SetReadDeadline(arg0 time.Time) error {
 	ret := m.ctrl.Call(m, "SetReadDeadline", arg0)
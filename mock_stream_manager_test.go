@@ -122,6 +122,18 @@ func (mr *MockStreamManagerMockRecorder) HandleMaxStreamIDFrame(arg0 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HandleMaxStreamIDFrame", reflect.TypeOf((*MockStreamManager)(nil).HandleMaxStreamIDFrame), arg0)
 }
 
+// NumStreams mocks base method
+func (m *MockStreamManager) NumStreams() int {
+	ret := m.ctrl.Call(m, "NumStreams")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// NumStreams indicates an expected call of NumStreams
+func (mr *MockStreamManagerMockRecorder) NumStreams() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NumStreams", reflect.TypeOf((*MockStreamManager)(nil).NumStreams))
+}
+
 // OpenStream mocks base method
 func (m *MockStreamManager) OpenStream() (Stream, error) {
 	ret := m.ctrl.Call(m, "OpenStream")
@@ -174,6 +186,16 @@ func (mr *MockStreamManagerMockRecorder) OpenUniStreamSync() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenUniStreamSync", reflect.TypeOf((*MockStreamManager)(nil).OpenUniStreamSync))
 }
 
+// StopIssuingMaxStreamID mocks base method
+func (m *MockStreamManager) StopIssuingMaxStreamID() {
+	m.ctrl.Call(m, "StopIssuingMaxStreamID")
+}
+
+// StopIssuingMaxStreamID indicates an expected call of StopIssuingMaxStreamID
+func (mr *MockStreamManagerMockRecorder) StopIssuingMaxStreamID() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopIssuingMaxStreamID", reflect.TypeOf((*MockStreamManager)(nil).StopIssuingMaxStreamID))
+}
+
 // UpdateLimits mocks base method
 func (m *MockStreamManager) UpdateLimits(arg0 *handshake.TransportParameters) {
 	m.ctrl.Call(m, "UpdateLimits", arg0)
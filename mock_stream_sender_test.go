@@ -64,3 +64,13 @@ func (m *MockStreamSender) queueControlFrame(arg0 wire.Frame) {
 func (mr *MockStreamSenderMockRecorder) queueControlFrame(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "queueControlFrame", reflect.TypeOf((*MockStreamSender)(nil).queueControlFrame), arg0)
 }
+
+// setStreamPriority mocks base method
+func (m *MockStreamSender) setStreamPriority(arg0 protocol.StreamID, arg1 Priority) {
+	m.ctrl.Call(m, "setStreamPriority", arg0, arg1)
+}
+
+// setStreamPriority indicates an expected call of setStreamPriority
+func (mr *MockStreamSenderMockRecorder) setStreamPriority(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "setStreamPriority", reflect.TypeOf((*MockStreamSender)(nil).setStreamPriority), arg0, arg1)
+}
@@ -14,5 +14,7 @@ package quic
 //go:generate sh -c "./mockgen_private.sh quic mock_session_runner_test.go github.com/wangjiezhe/quic-go sessionRunner SessionRunner"
 //go:generate sh -c "./mockgen_private.sh quic mock_packet_handler_test.go github.com/wangjiezhe/quic-go packetHandler PacketHandler"
 //go:generate sh -c "./mockgen_private.sh quic mock_session_handler_test.go github.com/wangjiezhe/quic-go sessionHandler SessionHandler"
+//go:generate sh -c "mockgen -package quic -self_package quic -destination mock_tracer_test.go github.com/wangjiezhe/quic-go Tracer"
+//go:generate sh -c "mockgen -package quic -self_package quic -destination mock_connection_tracer_test.go github.com/wangjiezhe/quic-go ConnectionTracer"
 //go:generate sh -c "find . -type f -name 'mock_*_test.go' | xargs sed -i '' 's/quic_go.//g'"
 //go:generate sh -c "goimports -w mock*_test.go"
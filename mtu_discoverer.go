@@ -0,0 +1,192 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/ackhandler"
+	"github.com/wangjiezhe/quic-go/internal/congestion"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+)
+
+const (
+	// The number of RTTs to wait between sending two MTU probes.
+	mtuProbeDelay = 5
+	// The search is stopped when the difference between the current packet size
+	// and the smallest size that didn't work is smaller than this.
+	maxMTUDiff = 20
+	// The number of times a probe of the same size has to be lost,
+	// before that size is considered too large for the path.
+	maxMTUProbes = 3
+	// The number of packets larger than protocol.MinInitialPacketSize that have to be lost in a row,
+	// before we conclude that packets of the current size don't arrive any more (a black hole).
+	maxLargePacketsLost = 6
+)
+
+// The mtuDiscoverer implements Datagram Packetization Layer Path MTU Discovery (DPLPMTUD), see RFC 8899.
+// It sends PING frames padded to increasing sizes, and raises the packet size
+// when a probe is acknowledged. It performs a binary search between the current packet size
+// and the largest packet size that the peer accepts.
+// When packets of the current size stop arriving, it falls back to protocol.MinInitialPacketSize
+// and restarts the search (RFC 8899, Section 4.3).
+type mtuDiscoverer struct {
+	rttStats *congestion.RTTStats
+	logger   utils.Logger
+
+	// the largest packet size that we can receive, and that the peer accepts
+	limit protocol.ByteCount
+	// the packet size that is known to work
+	current protocol.ByteCount
+	// the smallest packet size that is known not to work, or the largest size that might work
+	max protocol.ByteCount
+	// called when the packet size changes
+	setPacketSize func(protocol.ByteCount)
+
+	probeInFlight bool
+	probeSize     protocol.ByteCount
+	numProbesLost int
+	lastProbeTime time.Time
+
+	// the number of packets larger than protocol.MinInitialPacketSize lost since the last one was acknowledged
+	numLargePacketsLost int
+}
+
+var _ ackhandler.MTUProbeHandler = &mtuDiscoverer{}
+
+func newMTUDiscoverer(
+	rttStats *congestion.RTTStats,
+	start protocol.ByteCount,
+	setPacketSize func(protocol.ByteCount),
+	logger utils.Logger,
+) *mtuDiscoverer {
+	return &mtuDiscoverer{
+		rttStats:      rttStats,
+		limit:         protocol.MaxReceivePacketSize,
+		current:       start,
+		max:           protocol.MaxReceivePacketSize,
+		setPacketSize: setPacketSize,
+		logger:        logger,
+	}
+}
+
+// SetMax limits the packet size to the maximum packet size that the peer accepts.
+func (d *mtuDiscoverer) SetMax(max protocol.ByteCount) {
+	d.limit = utils.MinByteCount(d.limit, max)
+	d.max = utils.MinByteCount(d.max, max)
+}
+
+func (d *mtuDiscoverer) done() bool {
+	return d.max <= d.current+maxMTUDiff
+}
+
+// ShouldSendProbe says if an MTU probe should be sent now.
+func (d *mtuDiscoverer) ShouldSendProbe(now time.Time) bool {
+	if d.probeInFlight || d.done() {
+		return false
+	}
+	return !now.Before(d.lastProbeTime.Add(mtuProbeDelay * d.rttStats.SmoothedOrInitialRTT()))
+}
+
+// NextProbeSize returns the size of the next MTU probe.
+// It must only be called if ShouldSendProbe returned true.
+func (d *mtuDiscoverer) NextProbeSize(now time.Time) protocol.ByteCount {
+	d.probeInFlight = true
+	d.lastProbeTime = now
+	d.probeSize = (d.current + d.max) / 2
+	return d.probeSize
+}
+
+func (d *mtuDiscoverer) MTUProbeAcked(size protocol.ByteCount) {
+	if !d.probeInFlight || size != d.probeSize {
+		return
+	}
+	d.probeInFlight = false
+	d.numProbesLost = 0
+	d.current = size
+	d.logger.Debugf("MTU probe of %d bytes acknowledged. Increasing the packet size.", size)
+	d.setPacketSize(size)
+}
+
+func (d *mtuDiscoverer) MTUProbeLost(size protocol.ByteCount) {
+	if !d.probeInFlight || size != d.probeSize {
+		return
+	}
+	d.probeInFlight = false
+	d.numProbesLost++
+	// The probe might have been lost for reasons other than its size.
+	// Only give up on this size if multiple probes were lost.
+	if d.numProbesLost < maxMTUProbes {
+		return
+	}
+	d.numProbesLost = 0
+	d.max = size
+	if d.done() {
+		d.logger.Debugf("Path MTU discovery completed. Using a packet size of %d bytes.", d.current)
+	}
+}
+
+// PacketAcked is called when a packet that is not an MTU probe is acknowledged.
+func (d *mtuDiscoverer) PacketAcked(size protocol.ByteCount) {
+	if size > protocol.MinInitialPacketSize {
+		d.numLargePacketsLost = 0
+	}
+}
+
+// PacketLost is called when a packet that is not an MTU probe is declared lost.
+// If too many packets in a row are lost, the path most likely doesn't support the current packet size any more.
+func (d *mtuDiscoverer) PacketLost(size protocol.ByteCount) {
+	// There's no smaller packet size to fall back to.
+	if size <= protocol.MinInitialPacketSize || d.current <= protocol.MinInitialPacketSize {
+		return
+	}
+	d.numLargePacketsLost++
+	if d.numLargePacketsLost < maxLargePacketsLost {
+		return
+	}
+	d.logger.Debugf("Lost %d packets larger than %d bytes in a row. Falling back to %d bytes.", d.numLargePacketsLost, protocol.MinInitialPacketSize, protocol.MinInitialPacketSize)
+	d.max = d.limit
+	d.fallBack()
+}
+
+// PacketTooLarge is called when a packet couldn't be sent, because it was larger than the MTU of the network interface.
+func (d *mtuDiscoverer) PacketTooLarge(size protocol.ByteCount) {
+	if d.probeInFlight && size == d.probeSize {
+		// We don't need to wait until the probe is declared lost.
+		d.probeInFlight = false
+		d.numProbesLost = 0
+		d.max = size
+		if d.done() {
+			d.logger.Debugf("Path MTU discovery completed. Using a packet size of %d bytes.", d.current)
+		}
+		return
+	}
+	if size <= protocol.MinInitialPacketSize || d.current <= protocol.MinInitialPacketSize {
+		return
+	}
+	d.logger.Debugf("Packet of %d bytes too large for the network interface. Falling back to %d bytes.", size, protocol.MinInitialPacketSize)
+	d.max = utils.MinByteCount(d.max, size)
+	d.fallBack()
+}
+
+// fallBack reduces the packet size to protocol.MinInitialPacketSize, and restarts the search.
+func (d *mtuDiscoverer) fallBack() {
+	d.current = protocol.MinInitialPacketSize
+	d.probeInFlight = false
+	d.numProbesLost = 0
+	d.numLargePacketsLost = 0
+	d.lastProbeTime = time.Time{}
+	d.setPacketSize(d.current)
+}
+
+// Reset restarts path MTU discovery, e.g. after the connection migrated to a new path.
+// The packet size is reset to the given size.
+// The limit imposed by the peer still applies.
+func (d *mtuDiscoverer) Reset(start protocol.ByteCount) {
+	d.current = utils.MinByteCount(start, d.limit)
+	d.max = d.limit
+	d.probeInFlight = false
+	d.numProbesLost = 0
+	d.numLargePacketsLost = 0
+	d.lastProbeTime = time.Time{}
+	d.setPacketSize(d.current)
+}
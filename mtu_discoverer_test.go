@@ -0,0 +1,163 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/congestion"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MTU Discoverer", func() {
+	const rtt = 100 * time.Millisecond
+	var (
+		d           *mtuDiscoverer
+		packetSizes []protocol.ByteCount
+		now         time.Time
+	)
+
+	BeforeEach(func() {
+		rttStats := &congestion.RTTStats{}
+		rttStats.UpdateRTT(rtt, 0, time.Now())
+		packetSizes = nil
+		d = newMTUDiscoverer(rttStats, 1000, func(s protocol.ByteCount) { packetSizes = append(packetSizes, s) }, utils.DefaultLogger)
+		d.SetMax(1400)
+		now = time.Now()
+	})
+
+	It("sends the first probe right away", func() {
+		Expect(d.ShouldSendProbe(now)).To(BeTrue())
+		Expect(d.NextProbeSize(now)).To(BeEquivalentTo(1200))
+	})
+
+	It("doesn't send a probe while another probe is in flight", func() {
+		d.NextProbeSize(now)
+		Expect(d.ShouldSendProbe(now.Add(time.Hour))).To(BeFalse())
+	})
+
+	It("waits a few RTTs before sending the next probe", func() {
+		size := d.NextProbeSize(now)
+		d.MTUProbeAcked(size)
+		Expect(d.ShouldSendProbe(now.Add(mtuProbeDelay*rtt - time.Nanosecond))).To(BeFalse())
+		Expect(d.ShouldSendProbe(now.Add(mtuProbeDelay * rtt))).To(BeTrue())
+	})
+
+	It("increases the packet size when a probe is acknowledged", func() {
+		size := d.NextProbeSize(now)
+		d.MTUProbeAcked(size)
+		Expect(packetSizes).To(Equal([]protocol.ByteCount{1200}))
+		Expect(d.NextProbeSize(now)).To(BeEquivalentTo(1300))
+	})
+
+	It("ignores acknowledgements for old probes", func() {
+		d.NextProbeSize(now)
+		d.MTUProbeAcked(1234)
+		Expect(packetSizes).To(BeEmpty())
+	})
+
+	It("only decreases the maximum after multiple probes of the same size were lost", func() {
+		for i := 0; i < maxMTUProbes-1; i++ {
+			size := d.NextProbeSize(now)
+			Expect(size).To(BeEquivalentTo(1200))
+			d.MTUProbeLost(size)
+		}
+		d.MTUProbeLost(d.NextProbeSize(now))
+		Expect(d.NextProbeSize(now)).To(BeEquivalentTo(1100))
+		Expect(packetSizes).To(BeEmpty())
+	})
+
+	It("stops probing when the search interval is small enough", func() {
+		for d.ShouldSendProbe(now) {
+			size := d.NextProbeSize(now)
+			if size > 1300 {
+				d.MTUProbeLost(size)
+			} else {
+				d.MTUProbeAcked(size)
+			}
+			now = now.Add(time.Hour)
+		}
+		Expect(packetSizes).ToNot(BeEmpty())
+		last := packetSizes[len(packetSizes)-1]
+		Expect(last).To(BeNumerically("<=", 1300))
+		Expect(last).To(BeNumerically(">", 1300-maxMTUDiff))
+	})
+
+	It("doesn't probe if the peer's limit is smaller than the current size", func() {
+		d.SetMax(1000)
+		Expect(d.ShouldSendProbe(now)).To(BeFalse())
+	})
+
+	It("never probes for sizes larger than the packet buffers", func() {
+		d = newMTUDiscoverer(&congestion.RTTStats{}, 1000, func(protocol.ByteCount) {}, utils.DefaultLogger)
+		d.SetMax(10000)
+		Expect(d.NextProbeSize(now)).To(BeNumerically("<=", protocol.MaxReceivePacketSize))
+	})
+
+	It("resets the packet size, but keeps the peer's limit", func() {
+		d.MTUProbeAcked(d.NextProbeSize(now))
+		Expect(packetSizes).To(Equal([]protocol.ByteCount{1200}))
+		d.Reset(1100)
+		Expect(packetSizes).To(Equal([]protocol.ByteCount{1200, 1100}))
+		Expect(d.ShouldSendProbe(now)).To(BeTrue())
+		Expect(d.NextProbeSize(now)).To(BeEquivalentTo(1250))
+	})
+
+	Context("black hole detection", func() {
+		BeforeEach(func() {
+			// raise the packet size to 1300 bytes
+			d.MTUProbeAcked(d.NextProbeSize(now))
+			now = now.Add(time.Hour)
+			d.MTUProbeAcked(d.NextProbeSize(now))
+			now = now.Add(time.Hour)
+			Expect(packetSizes).To(Equal([]protocol.ByteCount{1200, 1300}))
+			packetSizes = nil
+		})
+
+		It("falls back to the minimum packet size when too many large packets are lost", func() {
+			for i := 0; i < maxLargePacketsLost-1; i++ {
+				d.PacketLost(1300)
+			}
+			Expect(packetSizes).To(BeEmpty())
+			d.PacketLost(1300)
+			Expect(packetSizes).To(Equal([]protocol.ByteCount{protocol.MinInitialPacketSize}))
+			// the search is restarted
+			Expect(d.ShouldSendProbe(now)).To(BeTrue())
+			Expect(d.NextProbeSize(now)).To(BeEquivalentTo(1300))
+		})
+
+		It("doesn't fall back if a large packet is acknowledged in between", func() {
+			for i := 0; i < maxLargePacketsLost-1; i++ {
+				d.PacketLost(1300)
+			}
+			d.PacketAcked(1300)
+			d.PacketLost(1300)
+			Expect(packetSizes).To(BeEmpty())
+		})
+
+		It("ignores the loss of small packets", func() {
+			for i := 0; i < 2*maxLargePacketsLost; i++ {
+				d.PacketLost(protocol.MinInitialPacketSize)
+			}
+			Expect(packetSizes).To(BeEmpty())
+		})
+
+		It("falls back to the minimum packet size when a packet is too large for the network interface", func() {
+			d.PacketTooLarge(1300)
+			Expect(packetSizes).To(Equal([]protocol.ByteCount{protocol.MinInitialPacketSize}))
+			// the search is restarted, but doesn't probe for sizes larger than the packet that was too large
+			Expect(d.NextProbeSize(now)).To(BeEquivalentTo(1250))
+		})
+
+		It("gives up on a probe size right away when the probe is too large for the network interface", func() {
+			size := d.NextProbeSize(now)
+			Expect(size).To(BeEquivalentTo(1350))
+			d.PacketTooLarge(size)
+			Expect(packetSizes).To(BeEmpty())
+			Expect(d.ShouldSendProbe(now.Add(time.Hour))).To(BeTrue())
+			Expect(d.NextProbeSize(now.Add(time.Hour))).To(BeEquivalentTo(1325))
+		})
+	})
+})
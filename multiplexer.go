@@ -0,0 +1,518 @@
+package quic
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+)
+
+// The maximum number of packets queued for a server or a client using a shared socket.
+// If the queue is full, packets are dropped.
+const muxConnQueueLen = protocol.MaxSessionUnprocessedPackets
+
+var errMuxConnClosed = errors.New("use of closed network connection")
+
+// The connMultiplexer makes it possible to use a single socket for a server and any number of clients.
+// Packets are routed by their destination connection ID:
+// Packets for a connection ID used by a client are passed to that client, all other packets are passed to the server.
+// A server reads from its socket itself, and passes the packets for clients dialed from the same socket on to them.
+// Only if there's no server, or if the clients were using the socket before the server, a separate go routine reads from the socket.
+// Clients that use zero-length connection IDs, or that request the omission of the connection ID,
+// can only use a socket on their own.
+type connMultiplexer struct {
+	mutex    sync.Mutex
+	managers map[net.PacketConn]*connManager
+
+	logger utils.Logger
+}
+
+var multiplexer = newConnMultiplexer()
+
+func newConnMultiplexer() *connMultiplexer {
+	return &connMultiplexer{
+		managers: make(map[net.PacketConn]*connManager),
+		logger:   utils.DefaultLogger.WithPrefix("multiplexer"),
+	}
+}
+
+// AddServer registers a server for a socket.
+// Only a single server can use a socket.
+func (m *connMultiplexer) AddServer(c net.PacketConn) (*muxConn, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.getManager(c).addServer()
+}
+
+// AddClient registers a client for a socket.
+// The client only receives packets for the connection IDs added using muxConn.AddConnectionID,
+// and stateless resets for the tokens added using muxConn.AddResetToken.
+func (m *connMultiplexer) AddClient(c net.PacketConn) *muxConn {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.getManager(c).addClient()
+}
+
+// getManager returns the connManager for a socket.
+// It must be called with the mutex held.
+func (m *connMultiplexer) getManager(c net.PacketConn) *connManager {
+	manager, ok := m.managers[c]
+	if !ok {
+		manager = newConnManager(m, c, m.logger)
+		m.managers[c] = manager
+	}
+	return manager
+}
+
+func (m *connMultiplexer) removeManager(manager *connManager) {
+	m.mutex.Lock()
+	if m.managers[manager.pconn] == manager {
+		delete(m.managers, manager.pconn)
+	}
+	m.mutex.Unlock()
+}
+
+// The connManager reads packets from a single socket, and routes them to the server and the clients using the socket.
+type connManager struct {
+	multiplexer *connMultiplexer
+	pconn       net.PacketConn
+	conn        rawConn
+
+	mutex   sync.RWMutex
+	server  *muxConn
+	clients map[*muxConn]struct{}
+	connIDs map[string]*muxConn
+	// the number of client connection IDs of every length
+	connIDLens map[int]int
+	// the stateless reset tokens of the clients
+	resetTokens map[[16]byte]*muxConn
+	// set while the server reads from the socket itself
+	serverReading bool
+	// set when the listen go routine was started
+	listening bool
+	// set when the server was closed while clients were still using the socket
+	closeWhenUnused bool
+	// set when reading from the socket failed
+	err error
+
+	logger utils.Logger
+}
+
+func newConnManager(m *connMultiplexer, c net.PacketConn, logger utils.Logger) *connManager {
+	return &connManager{
+		multiplexer: m,
+		pconn:       c,
+		conn:        wrapConn(c),
+		clients:     make(map[*muxConn]struct{}),
+		connIDs:     make(map[string]*muxConn),
+		connIDLens:  make(map[int]int),
+		resetTokens: make(map[[16]byte]*muxConn),
+		logger:      logger,
+	}
+}
+
+func (m *connManager) addServer() (*muxConn, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.server != nil {
+		return nil, errors.New("a server is already listening on this connection")
+	}
+	m.server = newMuxConn(m)
+	if m.err != nil {
+		m.server.closeWithError(m.err)
+	} else if !m.listening {
+		// As long as no client is using the socket, this avoids queueing the packets for the server.
+		m.server.direct = true
+		m.serverReading = true
+	}
+	return m.server, nil
+}
+
+func (m *connManager) addClient() *muxConn {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	c := newMuxConn(m)
+	m.clients[c] = struct{}{}
+	if m.err != nil {
+		c.closeWithError(m.err)
+	} else if !m.serverReading {
+		m.startListening()
+	}
+	return c
+}
+
+// startListening starts the listen go routine, if it's not running yet.
+// It must be called with the mutex held.
+func (m *connManager) startListening() {
+	if m.listening {
+		return
+	}
+	m.listening = true
+	go m.listen()
+}
+
+// stopServerReading is called when the server stops reading from the socket.
+// If clients are still using the socket, the listen go routine takes over.
+func (m *connManager) stopServerReading() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.serverReading {
+		return
+	}
+	m.serverReading = false
+	if len(m.clients) > 0 && m.err == nil {
+		// reset the deadline that was set to wake up the server
+		m.pconn.SetReadDeadline(time.Time{})
+		m.startListening()
+	}
+}
+
+func (m *connManager) addConnectionID(c *muxConn, connID protocol.ConnectionID) {
+	// Zero-length connection IDs can't be used to route packets.
+	if connID.Len() == 0 {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.clients[c]; !ok {
+		return
+	}
+	if _, ok := m.connIDs[string(connID)]; ok {
+		return
+	}
+	m.connIDs[string(connID)] = c
+	m.connIDLens[connID.Len()]++
+	c.connIDs = append(c.connIDs, connID)
+}
+
+func (m *connManager) addResetToken(c *muxConn, token [16]byte) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.clients[c]; !ok {
+		return
+	}
+	if _, ok := m.resetTokens[token]; ok {
+		return
+	}
+	m.resetTokens[token] = c
+	c.resetTokens = append(c.resetTokens, token)
+}
+
+// remove removes a server or a client.
+// The socket is closed when the server was closed, and no clients are using it any more.
+func (m *connManager) remove(c *muxConn) error {
+	m.mutex.Lock()
+	if c == m.server {
+		m.server = nil
+		m.closeWhenUnused = true
+		// If the server is blocked reading from the socket, wake it up, so that it hands over to the listen go routine.
+		if m.serverReading && len(m.clients) > 0 && m.err == nil {
+			m.pconn.SetReadDeadline(time.Now())
+		}
+	} else {
+		delete(m.clients, c)
+		for _, connID := range c.connIDs {
+			delete(m.connIDs, string(connID))
+			if m.connIDLens[connID.Len()]--; m.connIDLens[connID.Len()] == 0 {
+				delete(m.connIDLens, connID.Len())
+			}
+		}
+		c.connIDs = nil
+		for _, token := range c.resetTokens {
+			delete(m.resetTokens, token)
+		}
+		c.resetTokens = nil
+	}
+	closeSocket := m.closeWhenUnused && m.server == nil && len(m.clients) == 0 && m.err == nil
+	m.mutex.Unlock()
+
+	if closeSocket {
+		// Nobody might be reading from the socket any more, so the manager has to be removed here.
+		m.multiplexer.removeManager(m)
+		return m.conn.Close()
+	}
+	return nil
+}
+
+func (m *connManager) listen() {
+	packets := make([]rawPacket, readBatchSize)
+	for {
+		for i := range packets {
+			// The buffers of packets that were handled in the last iteration have to be replaced.
+			if packets[i].data == nil {
+				// The packet size should not exceed protocol.MaxReceivePacketSize bytes
+				// If it does, we only read a truncated packet, which will then end up undecryptable
+				packets[i].data = (*getPacketBuffer())[:protocol.MaxReceivePacketSize]
+			}
+		}
+		n, err := m.conn.ReadPackets(packets)
+		if err != nil {
+			m.closeWithError(err)
+			return
+		}
+		for i := 0; i < n; i++ {
+			m.handlePacket(packets[i])
+			packets[i] = rawPacket{}
+		}
+	}
+}
+
+func (m *connManager) handlePacket(p rawPacket) {
+	m.deliver(m.route(p.data), p)
+}
+
+// deliver queues a packet for a server or a client.
+// If c is nil, the packet is dropped.
+func (m *connManager) deliver(c *muxConn, p rawPacket) {
+	if c == nil {
+		m.logger.Debugf("Dropping packet from %s. No server or client for this connection ID.", p.addr)
+		putPacketBuffer(&p.data)
+		return
+	}
+	select {
+	case c.packets <- p:
+	default:
+		m.logger.Debugf("Dropping packet from %s. Receive queue full.", p.addr)
+		putPacketBuffer(&p.data)
+	}
+}
+
+// route determines if a packet is passed to one of the clients or to the server.
+func (m *connManager) route(data []byte) *muxConn {
+	if len(data) == 0 {
+		return nil
+	}
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if len(m.connIDs) > 0 {
+		if data[0]&0x80 > 0 { // IETF Long Header
+			if connID, err := wire.ParseDestConnectionID(data, 0); err == nil {
+				if c, ok := m.connIDs[string(connID)]; ok {
+					return c
+				}
+			}
+		} else {
+			// IETF Short Header or gQUIC Public Header
+			// The length of the connection ID is not encoded in the header.
+			for l := range m.connIDLens {
+				if connID, err := wire.ParseDestConnectionID(data, l); err == nil {
+					if c, ok := m.connIDs[string(connID)]; ok {
+						return c
+					}
+				}
+			}
+			// A server that lost the state for a connection doesn't know the client's connection ID.
+			// A stateless reset ends with the stateless reset token instead.
+			if len(data) >= protocol.StatelessResetTokenLen {
+				var token [16]byte
+				copy(token[:], data[len(data)-protocol.StatelessResetTokenLen:])
+				if c, ok := m.resetTokens[token]; ok {
+					return c
+				}
+			}
+		}
+	}
+	if m.server != nil {
+		return m.server
+	}
+	// A client that is using the socket on its own receives all packets.
+	if len(m.clients) == 1 {
+		for c := range m.clients {
+			return c
+		}
+	}
+	return nil
+}
+
+func (m *connManager) closeWithError(err error) {
+	m.multiplexer.removeManager(m)
+
+	m.mutex.Lock()
+	m.err = err
+	m.serverReading = false
+	conns := make([]*muxConn, 0, len(m.clients)+1)
+	if m.server != nil {
+		conns = append(conns, m.server)
+	}
+	for c := range m.clients {
+		conns = append(conns, c)
+	}
+	m.mutex.Unlock()
+
+	for _, c := range conns {
+		c.closeWithError(err)
+	}
+}
+
+// A muxConn is used by a single server or client to access a shared socket.
+// Packets are written directly to the socket, but only the packets routed to this server or client are read.
+type muxConn struct {
+	rawConn
+
+	manager *connManager
+	// the connection IDs and stateless reset tokens of a client, protected by the manager's mutex
+	connIDs     []protocol.ConnectionID
+	resetTokens [][16]byte
+	// set for a server that reads from the socket itself
+	direct bool
+
+	packets   chan rawPacket
+	closeOnce sync.Once
+	closed    chan struct{}
+	// set when reading from the socket failed
+	err error
+}
+
+var _ rawConn = &muxConn{}
+
+func newMuxConn(m *connManager) *muxConn {
+	return &muxConn{
+		rawConn: m.conn,
+		manager: m,
+		packets: make(chan rawPacket, muxConnQueueLen),
+		closed:  make(chan struct{}),
+	}
+}
+
+// AddConnectionID makes the manager route packets for a connection ID to this client.
+func (c *muxConn) AddConnectionID(connID protocol.ConnectionID) {
+	c.manager.addConnectionID(c, connID)
+}
+
+// AddResetToken makes the manager route stateless resets with this token to this client.
+func (c *muxConn) AddResetToken(token [16]byte) {
+	c.manager.addResetToken(c, token)
+}
+
+func (c *muxConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, _, err := c.ReadPacket(b)
+	return n, addr, err
+}
+
+func (c *muxConn) ReadPacket(b []byte) (int, net.Addr, protocol.ECN, error) {
+	if c.direct {
+		ps := make([]rawPacket, 1)
+		if _, err := c.readDirect(ps); err != nil {
+			return 0, nil, protocol.ECNNon, err
+		}
+		n := copy(b, ps[0].data)
+		putPacketBuffer(&ps[0].data)
+		return n, ps[0].addr, ps[0].ecn, nil
+	}
+	select {
+	case p := <-c.packets:
+		n := copy(b, p.data)
+		putPacketBuffer(&p.data)
+		return n, p.addr, p.ecn, nil
+	case <-c.closed:
+		return 0, nil, protocol.ECNNon, c.readError()
+	}
+}
+
+// ReadPackets returns the packets that were routed to this server or client.
+// Instead of copying the packets, the buffers of ps are returned to the buffer pool,
+// and replaced by the buffers the packets were read into.
+func (c *muxConn) ReadPackets(ps []rawPacket) (int, error) {
+	if c.direct {
+		return c.readDirect(ps)
+	}
+	select {
+	case p := <-c.packets:
+		setRawPacket(&ps[0], p)
+	case <-c.closed:
+		return 0, c.readError()
+	}
+	n := 1
+	for ; n < len(ps); n++ {
+		select {
+		case p := <-c.packets:
+			setRawPacket(&ps[n], p)
+		default:
+			return n, nil
+		}
+	}
+	return n, nil
+}
+
+// readDirect reads packets from the socket.
+// Packets for clients using the same socket are passed on to them,
+// and only the packets for the server are returned, at the beginning of ps.
+// Empty buffers in ps are replaced by buffers from the buffer pool.
+func (c *muxConn) readDirect(ps []rawPacket) (int, error) {
+	m := c.manager
+	for {
+		select {
+		case <-c.closed:
+			m.stopServerReading()
+			return 0, c.readError()
+		default:
+		}
+		for i := range ps {
+			if ps[i].data == nil {
+				ps[i].data = (*getPacketBuffer())[:protocol.MaxReceivePacketSize]
+			}
+		}
+		n, err := m.conn.ReadPackets(ps)
+		if err != nil {
+			select {
+			case <-c.closed:
+				// the error was caused by closing the socket, or by the deadline set in remove
+				m.stopServerReading()
+				return 0, c.readError()
+			default:
+			}
+			m.closeWithError(err)
+			return 0, err
+		}
+		var num int
+		for i := 0; i < n; i++ {
+			if dst := m.route(ps[i].data); dst != c {
+				m.deliver(dst, ps[i])
+				ps[i] = rawPacket{}
+				continue
+			}
+			ps[i], ps[num] = ps[num], ps[i]
+			num++
+		}
+		if num > 0 {
+			return num, nil
+		}
+	}
+}
+
+func setRawPacket(dst *rawPacket, p rawPacket) {
+	if buf := dst.data; cap(buf) == int(protocol.MaxReceivePacketSize) {
+		putPacketBuffer(&buf)
+	}
+	*dst = p
+}
+
+func (c *muxConn) readError() error {
+	if c.err != nil {
+		return c.err
+	}
+	return &net.OpError{Op: "read", Net: c.LocalAddr().Network(), Source: c.LocalAddr(), Err: errMuxConnClosed}
+}
+
+// Close stops receiving packets.
+// The socket is only closed if the server was closed, and no clients are using it any more.
+func (c *muxConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.manager.remove(c)
+	})
+	return err
+}
+
+func (c *muxConn) closeWithError(e error) {
+	c.closeOnce.Do(func() {
+		c.err = e
+		close(c.closed)
+	})
+}
@@ -0,0 +1,406 @@
+package quic
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/testdata"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Multiplexer", func() {
+	var (
+		m     *connMultiplexer
+		pconn *mockPacketConn
+	)
+
+	getShortHeaderPacket := func(connID protocol.ConnectionID) []byte {
+		b := &bytes.Buffer{}
+		err := (&wire.Header{
+			DestConnectionID: connID,
+			PacketNumber:     0x1337,
+			PacketNumberLen:  protocol.PacketNumberLen2,
+		}).Write(b, protocol.PerspectiveServer, protocol.VersionTLS)
+		Expect(err).ToNot(HaveOccurred())
+		b.Write(bytes.Repeat([]byte{0}, 100))
+		return b.Bytes()
+	}
+
+	getLongHeaderPacket := func(connID protocol.ConnectionID) []byte {
+		b := &bytes.Buffer{}
+		err := (&wire.Header{
+			IsLongHeader:     true,
+			Type:             protocol.PacketTypeHandshake,
+			DestConnectionID: connID,
+			SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4},
+			PacketNumber:     0x1337,
+			PayloadLen:       100,
+			Version:          protocol.VersionTLS,
+		}).Write(b, protocol.PerspectiveServer, protocol.VersionTLS)
+		Expect(err).ToNot(HaveOccurred())
+		b.Write(bytes.Repeat([]byte{0}, 100))
+		return b.Bytes()
+	}
+
+	// serve reads from a server until reading fails, like the server's serve go routine does
+	serve := func(server *muxConn) <-chan rawPacket {
+		c := make(chan rawPacket, 100)
+		go func() {
+			defer GinkgoRecover()
+			ps := make([]rawPacket, 4)
+			for {
+				n, err := server.ReadPackets(ps)
+				if err != nil {
+					close(c)
+					return
+				}
+				for i := 0; i < n; i++ {
+					c <- ps[i]
+					ps[i] = rawPacket{}
+				}
+			}
+		}()
+		return c
+	}
+
+	BeforeEach(func() {
+		m = newConnMultiplexer()
+		pconn = newMockPacketConn()
+		pconn.addr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+		pconn.dataReadFrom = &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 4321}
+	})
+
+	AfterEach(func() {
+		pconn.Close()
+		Eventually(func() int {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			return len(m.managers)
+		}).Should(BeZero())
+	})
+
+	It("uses a single manager per socket", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		serve(server)
+		client := m.AddClient(pconn)
+		Expect(client.manager).To(Equal(server.manager))
+		pconn2 := newMockPacketConn()
+		defer pconn2.Close()
+		Expect(m.AddClient(pconn2).manager).ToNot(Equal(server.manager))
+	})
+
+	It("errors when adding a second server", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		serve(server)
+		_, err = m.AddServer(pconn)
+		Expect(err).To(MatchError("a server is already listening on this connection"))
+	})
+
+	It("routes packets by the connection ID", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		client1 := m.AddClient(pconn)
+		client1.AddConnectionID(protocol.ConnectionID{1, 1, 1, 1})
+		client2 := m.AddClient(pconn)
+		client2.AddConnectionID(protocol.ConnectionID{2, 2, 2, 2, 2, 2, 2, 2})
+		client2.AddConnectionID(protocol.ConnectionID{3, 3, 3, 3, 3})
+		serverPackets := serve(server)
+
+		packet1 := getShortHeaderPacket(protocol.ConnectionID{1, 1, 1, 1})
+		packet2 := getShortHeaderPacket(protocol.ConnectionID{2, 2, 2, 2, 2, 2, 2, 2})
+		packet3 := getLongHeaderPacket(protocol.ConnectionID{3, 3, 3, 3, 3})
+		packet4 := getShortHeaderPacket(protocol.ConnectionID{4, 4, 4, 4, 4, 4, 4, 4})
+		pconn.dataToRead <- packet1
+		pconn.dataToRead <- packet2
+		pconn.dataToRead <- packet3
+		pconn.dataToRead <- packet4
+		var p rawPacket
+		Eventually(client1.packets).Should(Receive(&p))
+		Expect(p.data).To(Equal(packet1))
+		Expect(p.addr).To(Equal(pconn.dataReadFrom))
+		Eventually(client2.packets).Should(Receive(&p))
+		Expect(p.data).To(Equal(packet2))
+		Eventually(client2.packets).Should(Receive(&p))
+		Expect(p.data).To(Equal(packet3))
+		Eventually(serverPackets).Should(Receive(&p))
+		Expect(p.data).To(Equal(packet4))
+	})
+
+	It("routes gQUIC packets by the connection ID", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		client := m.AddClient(pconn)
+		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+		client.AddConnectionID(connID)
+		b := &bytes.Buffer{}
+		err = (&wire.Header{
+			DestConnectionID: connID,
+			SrcConnectionID:  connID,
+			PacketNumber:     0x1337,
+			PacketNumberLen:  protocol.PacketNumberLen2,
+		}).Write(b, protocol.PerspectiveServer, protocol.Version39)
+		Expect(err).ToNot(HaveOccurred())
+		serverPackets := serve(server)
+		pconn.dataToRead <- b.Bytes()
+		Eventually(client.packets).Should(Receive())
+		Consistently(serverPackets).ShouldNot(Receive())
+	})
+
+	It("passes stateless resets to the client", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		client := m.AddClient(pconn)
+		client.AddConnectionID(protocol.ConnectionID{1, 1, 1, 1})
+		client.AddResetToken([16]byte{0xde, 0xca, 0xfb, 0xad})
+		packet, err := composeStatelessReset([16]byte{0xde, 0xca, 0xfb, 0xad})
+		Expect(err).ToNot(HaveOccurred())
+		serverPackets := serve(server)
+		pconn.dataToRead <- packet
+		Eventually(client.packets).Should(Receive())
+		Consistently(serverPackets).ShouldNot(Receive())
+	})
+
+	It("passes stateless resets with unknown tokens to the server", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		client := m.AddClient(pconn)
+		client.AddConnectionID(protocol.ConnectionID{1, 1, 1, 1})
+		client.AddResetToken([16]byte{0xde, 0xca, 0xfb, 0xad})
+		packet, err := composeStatelessReset([16]byte{0xc0, 0xff, 0xee})
+		Expect(err).ToNot(HaveOccurred())
+		serverPackets := serve(server)
+		pconn.dataToRead <- packet
+		Eventually(serverPackets).Should(Receive())
+		Consistently(client.packets).ShouldNot(Receive())
+	})
+
+	It("passes all packets to a client that uses the socket on its own", func() {
+		client := m.AddClient(pconn)
+		client.AddConnectionID(protocol.ConnectionID{1, 1, 1, 1})
+		pconn.dataToRead <- getShortHeaderPacket(protocol.ConnectionID{4, 4, 4, 4})
+		Eventually(client.packets).Should(Receive())
+	})
+
+	It("drops packets for unknown connection IDs, if there's no server", func() {
+		client1 := m.AddClient(pconn)
+		client1.AddConnectionID(protocol.ConnectionID{1, 1, 1, 1})
+		client2 := m.AddClient(pconn)
+		client2.AddConnectionID(protocol.ConnectionID{2, 2, 2, 2})
+		pconn.dataToRead <- getShortHeaderPacket(protocol.ConnectionID{4, 4, 4, 4})
+		Consistently(client1.packets).ShouldNot(Receive())
+		Consistently(client2.packets).ShouldNot(Receive())
+	})
+
+	It("doesn't route packets to clients that were closed", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		client := m.AddClient(pconn)
+		client.AddConnectionID(protocol.ConnectionID{1, 1, 1, 1})
+		client.AddResetToken([16]byte{0xde, 0xca, 0xfb, 0xad})
+		Expect(client.Close()).To(Succeed())
+		Expect(client.manager.connIDs).To(BeEmpty())
+		Expect(client.manager.connIDLens).To(BeEmpty())
+		Expect(client.manager.resetTokens).To(BeEmpty())
+		pconn.dataToRead <- getShortHeaderPacket(protocol.ConnectionID{1, 1, 1, 1})
+		Eventually(serve(server)).Should(Receive())
+		Expect(pconn.closed).To(BeFalse())
+	})
+
+	It("lets the server read from the socket, as long as no client was using the socket before", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.direct).To(BeTrue())
+		client := m.AddClient(pconn)
+		client.AddConnectionID(protocol.ConnectionID{1, 1, 1, 1})
+		Expect(server.manager.listening).To(BeFalse())
+		serverPackets := serve(server)
+		pconn.dataToRead <- getShortHeaderPacket(protocol.ConnectionID{1, 1, 1, 1})
+		pconn.dataToRead <- getShortHeaderPacket(protocol.ConnectionID{4, 4, 4, 4})
+		Eventually(client.packets).Should(Receive())
+		Eventually(serverPackets).Should(Receive())
+		Expect(server.manager.listening).To(BeFalse())
+	})
+
+	It("hands over reading from the socket when the server is closed", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		client := m.AddClient(pconn)
+		client.AddConnectionID(protocol.ConnectionID{1, 1, 1, 1})
+		serverPackets := serve(server)
+		Expect(server.Close()).To(Succeed())
+		Eventually(serverPackets).Should(BeClosed())
+		Expect(pconn.closed).To(BeFalse())
+		pconn.dataToRead <- getShortHeaderPacket(protocol.ConnectionID{1, 1, 1, 1})
+		Eventually(client.packets).Should(Receive())
+		server.manager.mutex.RLock()
+		Expect(server.manager.listening).To(BeTrue())
+		server.manager.mutex.RUnlock()
+	})
+
+	It("queues the packets for a server that was added after a client", func() {
+		m.AddClient(pconn)
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.direct).To(BeFalse())
+		pconn.dataToRead <- getShortHeaderPacket(protocol.ConnectionID{4, 4, 4, 4})
+		Eventually(server.packets).Should(Receive())
+	})
+
+	It("reads multiple packets at once", func() {
+		m.AddClient(pconn) // make the server read from the queue
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 3; i++ {
+			pconn.dataToRead <- getShortHeaderPacket(protocol.ConnectionID{byte(i), 1, 1, 1, 1, 1, 1, 1})
+		}
+		Eventually(func() int { return len(server.packets) }).Should(Equal(3))
+		ps := make([]rawPacket, 5)
+		for i := range ps {
+			ps[i].data = (*getPacketBuffer())[:protocol.MaxReceivePacketSize]
+		}
+		n, err := server.ReadPackets(ps)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(3))
+		for i := 0; i < n; i++ {
+			Expect(ps[i].data).To(Equal(getShortHeaderPacket(protocol.ConnectionID{byte(i), 1, 1, 1, 1, 1, 1, 1})))
+			Expect(ps[i].addr).To(Equal(pconn.dataReadFrom))
+		}
+	})
+
+	It("reads a single packet", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		packet := getShortHeaderPacket(protocol.ConnectionID{1, 1, 1, 1, 1, 1, 1, 1})
+		pconn.dataToRead <- packet
+		b := make([]byte, 1000)
+		n, addr, err := server.ReadFrom(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(b[:n]).To(Equal(packet))
+		Expect(addr).To(Equal(pconn.dataReadFrom))
+		Expect(server.Close()).To(Succeed())
+	})
+
+	It("returns an error when reading from a closed conn", func() {
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		m.AddClient(pconn) // prevent the socket from being closed
+		Expect(server.Close()).To(Succeed())
+		_, err = server.ReadPackets(make([]rawPacket, 1))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(HaveSuffix("use of closed network connection"))
+	})
+
+	It("passes errors to all servers and clients", func() {
+		testErr := errors.New("read error")
+		pconn.readErr = testErr
+		server, err := m.AddServer(pconn)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = server.ReadPackets(make([]rawPacket, 1))
+		Expect(err).To(MatchError(testErr))
+		// the manager was removed, so a new one is created
+		client := m.AddClient(pconn)
+		Expect(client.manager).ToNot(Equal(server.manager))
+		_, err = client.ReadPackets(make([]rawPacket, 1))
+		Expect(err).To(MatchError(testErr))
+		pconn.readErr = nil
+	})
+
+	Context("closing the socket", func() {
+		It("closes the socket when the server is closed", func() {
+			server, err := m.AddServer(pconn)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.Close()).To(Succeed())
+			Expect(pconn.closed).To(BeTrue())
+		})
+
+		It("doesn't close the socket when a client is closed", func() {
+			client := m.AddClient(pconn)
+			Expect(client.Close()).To(Succeed())
+			Expect(pconn.closed).To(BeFalse())
+		})
+
+		It("closes the socket when the last client is closed, after the server was closed", func() {
+			server, err := m.AddServer(pconn)
+			Expect(err).ToNot(HaveOccurred())
+			client1 := m.AddClient(pconn)
+			client2 := m.AddClient(pconn)
+			Expect(server.Close()).To(Succeed())
+			Expect(pconn.closed).To(BeFalse())
+			Expect(client1.Close()).To(Succeed())
+			Expect(pconn.closed).To(BeFalse())
+			Expect(client2.Close()).To(Succeed())
+			Expect(pconn.closed).To(BeTrue())
+		})
+	})
+
+	It("accepts and dials connections using the same sockets", func() {
+		config := &Config{Versions: []protocol.VersionNumber{protocol.Version39}}
+		conn1, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		conn2, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).ToNot(HaveOccurred())
+		ln1, err := Listen(conn1, testdata.GetTLSConfig(), config)
+		Expect(err).ToNot(HaveOccurred())
+		ln2, err := Listen(conn2, testdata.GetTLSConfig(), config)
+		Expect(err).ToNot(HaveOccurred())
+
+		accept := func(ln Listener) <-chan Session {
+			c := make(chan Session, 1)
+			go func() {
+				defer GinkgoRecover()
+				sess, err := ln.Accept()
+				Expect(err).ToNot(HaveOccurred())
+				c <- sess
+			}()
+			return c
+		}
+		accepted1 := accept(ln1)
+		accepted2 := accept(ln2)
+
+		tlsConf := &tls.Config{InsecureSkipVerify: true}
+		sess1, err := Dial(conn1, conn2.LocalAddr(), "localhost:1337", tlsConf, config)
+		Expect(err).ToNot(HaveOccurred())
+		sess2, err := Dial(conn2, conn1.LocalAddr(), "localhost:1337", tlsConf, config)
+		Expect(err).ToNot(HaveOccurred())
+		var serverSess1, serverSess2 Session
+		Eventually(accepted1).Should(Receive(&serverSess1))
+		Expect(serverSess1.RemoteAddr()).To(Equal(conn2.LocalAddr()))
+		Eventually(accepted2).Should(Receive(&serverSess2))
+		Expect(serverSess2.RemoteAddr()).To(Equal(conn1.LocalAddr()))
+
+		// The session dialed from the first socket keeps working after the first listener is closed.
+		// Closing the listener closes the session accepted by it.
+		Expect(ln1.Close()).To(Succeed())
+		Eventually(sess2.Context().Done()).Should(BeClosed())
+		str, err := sess1.OpenStreamSync()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = str.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.Close()).To(Succeed())
+		serverStr, err := serverSess2.AcceptStream()
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(serverStr)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+		_, err = conn1.WriteTo([]byte("foobar"), conn2.LocalAddr())
+		Expect(err).ToNot(HaveOccurred())
+		// the socket is closed once the dialed session is closed
+		Expect(sess1.Close(nil)).To(Succeed())
+		Eventually(func() error {
+			_, err := conn1.WriteTo([]byte("foobar"), conn2.LocalAddr())
+			return err
+		}).Should(HaveOccurred())
+		Expect(ln2.Close()).To(Succeed())
+		_, err = conn2.WriteTo([]byte("foobar"), conn1.LocalAddr())
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -20,6 +20,8 @@ type packedPacket struct {
 	raw             []byte
 	frames          []wire.Frame
 	encryptionLevel protocol.EncryptionLevel
+	ecn             protocol.ECN
+	isMTUProbe      bool
 }
 
 func (p *packedPacket) ToAckHandlerPacket() *ackhandler.Packet {
@@ -29,6 +31,8 @@ func (p *packedPacket) ToAckHandlerPacket() *ackhandler.Packet {
 		Frames:          p.frames,
 		Length:          protocol.ByteCount(len(p.raw)),
 		EncryptionLevel: p.encryptionLevel,
+		ECN:             p.ecn,
+		IsMTUProbe:      p.isMTUProbe,
 		SendTime:        time.Now(),
 	}
 }
@@ -57,6 +61,7 @@ type packetPacker struct {
 	packetNumberGenerator *packetNumberGenerator
 	getPacketNumberLen    func(protocol.PacketNumber) protocol.PacketNumberLen
 	streams               streamFrameSource
+	datagramQueue         *datagramQueue // nil if DATAGRAM frames are not supported
 
 	controlFrameMutex sync.Mutex
 	controlFrames     []wire.Frame
@@ -64,6 +69,7 @@ type packetPacker struct {
 	stopWaiting               *wire.StopWaitingFrame
 	ackFrame                  *wire.AckFrame
 	omitConnectionID          bool
+	token                     []byte // the token sent in Initial packets (for IETF QUIC clients)
 	maxPacketSize             protocol.ByteCount
 	hasSentPacket             bool // has the packetPacker already sent a packet
 	numNonRetransmittableAcks int
@@ -78,22 +84,10 @@ func newPacketPacker(
 	divNonce []byte,
 	cryptoSetup sealingManager,
 	streamFramer streamFrameSource,
+	datagramQueue *datagramQueue,
 	perspective protocol.Perspective,
 	version protocol.VersionNumber,
 ) *packetPacker {
-	maxPacketSize := protocol.ByteCount(protocol.MinInitialPacketSize)
-	// If this is not a UDP address, we don't know anything about the MTU.
-	// Use the minimum size of an Initial packet as the max packet size.
-	if udpAddr, ok := remoteAddr.(*net.UDPAddr); ok {
-		// If ip is not an IPv4 address, To4 returns nil.
-		// Note that there might be some corner cases, where this is not correct.
-		// See https://stackoverflow.com/questions/22751035/golang-distinguish-ipv4-ipv6.
-		if udpAddr.IP.To4() == nil {
-			maxPacketSize = protocol.MaxPacketSizeIPv6
-		} else {
-			maxPacketSize = protocol.MaxPacketSizeIPv4
-		}
-	}
 	return &packetPacker{
 		cryptoSetup:           cryptoSetup,
 		divNonce:              divNonce,
@@ -102,12 +96,30 @@ func newPacketPacker(
 		perspective:           perspective,
 		version:               version,
 		streams:               streamFramer,
+		datagramQueue:         datagramQueue,
 		getPacketNumberLen:    getPacketNumberLen,
 		packetNumberGenerator: newPacketNumberGenerator(initialPacketNumber, protocol.SkipPacketAveragePeriodLength),
-		maxPacketSize:         maxPacketSize,
+		maxPacketSize:         getMaxPacketSize(remoteAddr),
 	}
 }
 
+// getMaxPacketSize returns the packet size that is used before path MTU discovery finds a larger size.
+func getMaxPacketSize(addr net.Addr) protocol.ByteCount {
+	// If this is not a UDP address, we don't know anything about the MTU.
+	// Use the minimum size of an Initial packet as the max packet size.
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return protocol.MinInitialPacketSize
+	}
+	// If ip is not an IPv4 address, To4 returns nil.
+	// Note that there might be some corner cases, where this is not correct.
+	// See https://stackoverflow.com/questions/22751035/golang-distinguish-ipv4-ipv6.
+	if udpAddr.IP.To4() == nil {
+		return protocol.MaxPacketSizeIPv6
+	}
+	return protocol.MaxPacketSizeIPv4
+}
+
 // PackConnectionClose packs a packet that ONLY contains a ConnectionCloseFrame
 func (p *packetPacker) PackConnectionClose(ccf *wire.ConnectionCloseFrame) (*packedPacket, error) {
 	frames := []wire.Frame{ccf}
@@ -122,6 +134,48 @@ func (p *packetPacker) PackConnectionClose(ccf *wire.ConnectionCloseFrame) (*pac
 	}, err
 }
 
+// PackProbingPacket packs a packet that only contains a PATH_CHALLENGE or a PATH_RESPONSE frame.
+// It is sent on a path other than the one currently used by the connection.
+// It uses the given destination connection ID, such that an observer can't link the two paths.
+func (p *packetPacker) PackProbingPacket(f wire.Frame, destConnID protocol.ConnectionID) (*packedPacket, error) {
+	encLevel, sealer := p.cryptoSetup.GetSealer()
+	if encLevel != protocol.EncryptionForwardSecure {
+		return nil, errors.New("packet packer BUG: probing packets can only be sent with forward-secure encryption")
+	}
+	header := p.getHeader(encLevel)
+	header.DestConnectionID = destConnID
+	frames := []wire.Frame{f}
+	raw, err := p.writeAndSealPacket(header, frames, sealer)
+	return &packedPacket{
+		header:          header,
+		raw:             raw,
+		frames:          frames,
+		encryptionLevel: encLevel,
+	}, err
+}
+
+// PackMTUProbePacket packs a packet that contains a PING frame, padded to the given size.
+// The size may be larger than the maximum packet size.
+func (p *packetPacker) PackMTUProbePacket(ping *wire.PingFrame, size protocol.ByteCount) (*packedPacket, error) {
+	encLevel, sealer := p.cryptoSetup.GetSealer()
+	if encLevel != protocol.EncryptionForwardSecure {
+		return nil, errors.New("packet packer BUG: MTU probes can only be sent with forward-secure encryption")
+	}
+	if size > protocol.MaxReceivePacketSize {
+		return nil, fmt.Errorf("packet packer BUG: MTU probe too large (%d bytes)", size)
+	}
+	header := p.getHeader(encLevel)
+	frames := []wire.Frame{ping}
+	raw, err := p.writeAndSealPacketWithPadding(header, frames, size, sealer)
+	return &packedPacket{
+		header:          header,
+		raw:             raw,
+		frames:          frames,
+		encryptionLevel: encLevel,
+		isMTUProbe:      true,
+	}, err
+}
+
 func (p *packetPacker) PackAckPacket() (*packedPacket, error) {
 	if p.ackFrame == nil {
 		return nil, errors.New("packet packer BUG: no ack frame queued")
@@ -411,6 +465,18 @@ func (p *packetPacker) composeNextPacket(
 		return payloadFrames, nil
 	}
 
+	// DATAGRAM frames are sent before STREAM frames.
+	// If the next DATAGRAM frame doesn't fit into this packet, it is sent in the next packet.
+	if p.datagramQueue != nil {
+		if f := p.datagramQueue.Peek(); f != nil {
+			if length := f.Length(p.version); payloadLength+length <= maxFrameSize {
+				payloadFrames = append(payloadFrames, f)
+				payloadLength += length
+				p.datagramQueue.Pop()
+			}
+		}
+	}
+
 	// temporarily increase the maxFrameSize by the (minimum) length of the DataLen field
 	// this leads to a properly sized packet in all cases, since we do all the packet length calculations with StreamFrames that have the DataLen set
 	// however, for the last STREAM frame in the packet, we can omit the DataLen, thus yielding a packet of exactly the correct size
@@ -463,8 +529,12 @@ func (p *packetPacker) getHeader(encLevel protocol.EncryptionLevel) *wire.Header
 		// Set the payload len to maximum size.
 		// Since it is encoded as a varint, this guarantees us that the header will end up at most as big as GetLength() returns.
 		header.PayloadLen = p.maxPacketSize
-		if !p.hasSentPacket && p.perspective == protocol.PerspectiveClient {
+		if encLevel == protocol.EncryptionSecure {
+			// only a client sends packets with 0-RTT keys
+			header.Type = protocol.PacketType0RTT
+		} else if !p.hasSentPacket && p.perspective == protocol.PerspectiveClient {
 			header.Type = protocol.PacketTypeInitial
+			header.Token = p.token
 		} else {
 			header.Type = protocol.PacketTypeHandshake
 		}
@@ -493,6 +563,17 @@ func (p *packetPacker) writeAndSealPacket(
 	header *wire.Header,
 	payloadFrames []wire.Frame,
 	sealer handshake.Sealer,
+) ([]byte, error) {
+	return p.writeAndSealPacketWithPadding(header, payloadFrames, 0, sealer)
+}
+
+// writeAndSealPacketWithPadding writes a packet, and pads it to the given size.
+// If the size is 0, the packet is not padded.
+func (p *packetPacker) writeAndSealPacketWithPadding(
+	header *wire.Header,
+	payloadFrames []wire.Frame,
+	size protocol.ByteCount,
+	sealer handshake.Sealer,
 ) ([]byte, error) {
 	raw := *getPacketBuffer()
 	buffer := bytes.NewBuffer(raw[:0])
@@ -536,9 +617,16 @@ func (p *packetPacker) writeAndSealPacket(
 			buffer.Write(bytes.Repeat([]byte{0}, paddingLen))
 		}
 	}
+	maxPacketSize := p.maxPacketSize
+	if size > 0 {
+		if paddingLen := int(size) - sealer.Overhead() - buffer.Len(); paddingLen > 0 {
+			buffer.Write(bytes.Repeat([]byte{0}, paddingLen))
+		}
+		maxPacketSize = utils.MaxByteCount(maxPacketSize, size)
+	}
 
-	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > p.maxPacketSize {
-		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, p.maxPacketSize)
+	if size := protocol.ByteCount(buffer.Len() + sealer.Overhead()); size > maxPacketSize {
+		return nil, fmt.Errorf("PacketPacker BUG: packet too large (%d bytes, allowed %d bytes)", size, maxPacketSize)
 	}
 
 	raw = raw[0:buffer.Len()]
@@ -564,10 +652,23 @@ func (p *packetPacker) SetOmitConnectionID() {
 	p.omitConnectionID = true
 }
 
+// SetToken sets the token that is sent in the Initial packet.
+// It is used to send the token received in a Retry packet.
+func (p *packetPacker) SetToken(token []byte) {
+	p.token = token
+}
+
 func (p *packetPacker) ChangeDestConnectionID(connID protocol.ConnectionID) {
 	p.destConnID = connID
 }
 
+// SetMaxPacketSize limits the packet size, e.g. to the maximum packet size that the peer accepts.
 func (p *packetPacker) SetMaxPacketSize(size protocol.ByteCount) {
 	p.maxPacketSize = utils.MinByteCount(p.maxPacketSize, size)
 }
+
+// SetPacketSize sets the packet size, after path MTU discovery found the path to support that size.
+// It is also used to go back to a smaller size, when the connection migrates to a new path.
+func (p *packetPacker) SetPacketSize(size protocol.ByteCount) {
+	p.maxPacketSize = size
+}
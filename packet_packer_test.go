@@ -8,6 +8,7 @@ import (
 	"github.com/wangjiezhe/quic-go/internal/ackhandler"
 	"github.com/wangjiezhe/quic-go/internal/handshake"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
 	"github.com/wangjiezhe/quic-go/internal/wire"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -28,6 +29,7 @@ type mockCryptoSetup struct {
 	encLevelSeal       protocol.EncryptionLevel
 	encLevelSealCrypto protocol.EncryptionLevel
 	divNonce           []byte
+	connState          ConnectionState
 }
 
 var _ handshake.CryptoSetup = &mockCryptoSetup{}
@@ -51,7 +53,7 @@ func (m *mockCryptoSetup) SetDiversificationNonce(divNonce []byte) error {
 	m.divNonce = divNonce
 	return nil
 }
-func (m *mockCryptoSetup) ConnectionState() ConnectionState { panic("not implemented") }
+func (m *mockCryptoSetup) ConnectionState() ConnectionState { return m.connState }
 
 var _ = Describe("Packet packer", func() {
 	const maxPacketSize protocol.ByteCount = 1357
@@ -79,6 +81,7 @@ var _ = Describe("Packet packer", func() {
 			divNonce,
 			&mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure},
 			mockStreamFramer,
+			nil,
 			protocol.PerspectiveServer,
 			version,
 		)
@@ -93,20 +96,20 @@ var _ = Describe("Packet packer", func() {
 		connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 		It("uses the minimum initial size, if it can't determine if the remote address is IPv4 or IPv6", func() {
 			remoteAddr := &net.TCPAddr{}
-			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
+			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, nil, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
 			Expect(packer.maxPacketSize).To(BeEquivalentTo(protocol.MinInitialPacketSize))
 		})
 
 		It("uses the maximum IPv4 packet size, if the remote address is IPv4", func() {
 			remoteAddr := &net.UDPAddr{IP: net.IPv4(11, 12, 13, 14), Port: 1337}
-			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
+			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, nil, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
 			Expect(packer.maxPacketSize).To(BeEquivalentTo(protocol.MaxPacketSizeIPv4))
 		})
 
 		It("uses the maximum IPv6 packet size, if the remote address is IPv6", func() {
 			ip := net.ParseIP("2001:0db8:85a3:0000:0000:8a2e:0370:7334")
 			remoteAddr := &net.UDPAddr{IP: ip, Port: 1337}
-			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
+			packer = newPacketPacker(connID, connID, 1, nil, remoteAddr, nil, nil, nil, nil, protocol.PerspectiveServer, protocol.VersionWhatever)
 			Expect(packer.maxPacketSize).To(BeEquivalentTo(protocol.MaxPacketSizeIPv6))
 		})
 	})
@@ -220,6 +223,29 @@ var _ = Describe("Packet packer", func() {
 				Expect(h.Version).To(Equal(versionIETFHeader))
 			})
 
+			It("sets the token for Initial packets", func() {
+				packer.perspective = protocol.PerspectiveClient
+				packer.hasSentPacket = false
+				packer.SetToken([]byte("foobar"))
+				h := packer.getHeader(protocol.EncryptionUnencrypted)
+				Expect(h.Type).To(Equal(protocol.PacketTypeInitial))
+				Expect(h.Token).To(Equal([]byte("foobar")))
+				packer.hasSentPacket = true
+				h = packer.getHeader(protocol.EncryptionUnencrypted)
+				Expect(h.Type).To(Equal(protocol.PacketTypeHandshake))
+				Expect(h.Token).To(BeEmpty())
+			})
+
+			It("uses 0-RTT packets for packets sent with 0-RTT keys", func() {
+				packer.perspective = protocol.PerspectiveClient
+				packer.hasSentPacket = true
+				packer.SetToken([]byte("foobar"))
+				h := packer.getHeader(protocol.EncryptionSecure)
+				Expect(h.IsLongHeader).To(BeTrue())
+				Expect(h.Type).To(Equal(protocol.PacketType0RTT))
+				Expect(h.Token).To(BeEmpty())
+			})
+
 			It("sets source and destination connection ID", func() {
 				srcConnID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
 				destConnID := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
@@ -280,7 +306,7 @@ var _ = Describe("Packet packer", func() {
 		Expect(err).ToNot(HaveOccurred())
 		// parse the packet
 		r := bytes.NewReader(p.raw)
-		hdr, err := wire.ParseHeaderSentByServer(r)
+		hdr, err := wire.ParseHeaderSentByServer(r, protocol.DefaultConnectionIDLength)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 	})
@@ -308,6 +334,55 @@ var _ = Describe("Packet packer", func() {
 		Expect(p.frames).To(Equal([]wire.Frame{ccf}))
 	})
 
+	It("packs a probing packet", func() {
+		packer.version = versionIETFFrames
+		packer.QueueControlFrame(&wire.MaxDataFrame{})
+		f := &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+		p, err := packer.PackProbingPacket(f, protocol.ConnectionID{4, 3, 2, 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.frames).To(Equal([]wire.Frame{f}))
+		Expect(p.header.DestConnectionID).To(Equal(protocol.ConnectionID{4, 3, 2, 1}))
+		Expect(p.encryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+		Expect(packer.controlFrames).To(HaveLen(1))
+	})
+
+	It("doesn't pack a probing packet before the handshake completes", func() {
+		packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+		_, err := packer.PackProbingPacket(&wire.PathResponseFrame{}, protocol.ConnectionID{4, 3, 2, 1})
+		Expect(err).To(MatchError("packet packer BUG: probing packets can only be sent with forward-secure encryption"))
+	})
+
+	It("packs an MTU probe packet", func() {
+		packer.version = versionIETFFrames
+		packer.QueueControlFrame(&wire.MaxDataFrame{})
+		ping := &wire.PingFrame{}
+		p, err := packer.PackMTUProbePacket(ping, maxPacketSize+50)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.frames).To(Equal([]wire.Frame{ping}))
+		Expect(p.raw).To(HaveLen(int(maxPacketSize + 50)))
+		Expect(p.isMTUProbe).To(BeTrue())
+		Expect(p.ToAckHandlerPacket().IsMTUProbe).To(BeTrue())
+		Expect(p.encryptionLevel).To(Equal(protocol.EncryptionForwardSecure))
+		Expect(packer.controlFrames).To(HaveLen(1))
+		// the probe doesn't change the size of regular packets
+		Expect(packer.maxPacketSize).To(Equal(maxPacketSize))
+	})
+
+	It("doesn't pack an MTU probe packet before the handshake completes", func() {
+		packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionSecure
+		_, err := packer.PackMTUProbePacket(&wire.PingFrame{}, maxPacketSize+50)
+		Expect(err).To(MatchError("packet packer BUG: MTU probes can only be sent with forward-secure encryption"))
+	})
+
+	It("sets the packet size", func() {
+		packer.SetMaxPacketSize(maxPacketSize + 50)
+		Expect(packer.maxPacketSize).To(Equal(maxPacketSize))
+		packer.SetPacketSize(maxPacketSize + 50)
+		Expect(packer.maxPacketSize).To(Equal(maxPacketSize + 50))
+		packer.SetMaxPacketSize(maxPacketSize)
+		Expect(packer.maxPacketSize).To(Equal(maxPacketSize))
+	})
+
 	It("packs only control frames", func() {
 		mockStreamFramer.EXPECT().HasCryptoStreamData()
 		mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
@@ -629,7 +704,7 @@ var _ = Describe("Packet packer", func() {
 			Expect(p.header.IsLongHeader).To(BeTrue())
 			// parse the packet
 			r := bytes.NewReader(p.raw)
-			hdr, err := wire.ParseHeaderSentByServer(r)
+			hdr, err := wire.ParseHeaderSentByServer(r, protocol.DefaultConnectionIDLength)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 		})
@@ -674,6 +749,76 @@ var _ = Describe("Packet packer", func() {
 		})
 	})
 
+	Context("DATAGRAM frame handling", func() {
+		var datagramQueue *datagramQueue
+
+		BeforeEach(func() {
+			packer.version = versionIETFFrames
+			datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+			packer.datagramQueue = datagramQueue
+		})
+
+		queueDatagram := func(f *wire.DatagramFrame) <-chan struct{} {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				Expect(datagramQueue.AddAndWait(f)).To(Succeed())
+			}()
+			// wait until the frame was queued
+			Eventually(datagramQueue.sendQueue).Should(HaveLen(1))
+			return done
+		}
+
+		It("packs DATAGRAM frames together with STREAM frames", func() {
+			f := &wire.DatagramFrame{DataLenPresent: true, Data: []byte("foobar")}
+			done := queueDatagram(f)
+			sf := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).DoAndReturn(func(maxSize protocol.ByteCount) []*wire.StreamFrame {
+				Expect(maxSize).To(Equal(maxFrameSize + 1 - f.Length(packer.version)))
+				return []*wire.StreamFrame{sf}
+			})
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{f, sf}))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("sends a DATAGRAM frame in the next packet, if it doesn't fit", func() {
+			f := &wire.DatagramFrame{DataLenPresent: true, Data: bytes.Repeat([]byte{'f'}, 1000)}
+			done := queueDatagram(f)
+			// make sure that the DATAGRAM frame doesn't fit
+			var controlFrames []wire.Frame
+			var length protocol.ByteCount
+			for length < maxFrameSize-f.Length(packer.version) {
+				cf := &wire.RstStreamFrame{StreamID: protocol.StreamID(len(controlFrames)), ByteOffset: 0x1337}
+				packer.QueueControlFrame(cf)
+				controlFrames = append(controlFrames, cf)
+				length += cf.Length(packer.version)
+			}
+			mockStreamFramer.EXPECT().HasCryptoStreamData().Times(2)
+			mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any()).Times(2)
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(HaveLen(len(controlFrames)))
+			Consistently(done).ShouldNot(BeClosed())
+			p, err = packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.frames).To(Equal([]wire.Frame{f}))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't pack DATAGRAM frames into packets that can't carry application data", func() {
+			queueDatagram(&wire.DatagramFrame{Data: []byte("foobar")})
+			mockStreamFramer.EXPECT().HasCryptoStreamData()
+			packer.cryptoSetup.(*mockCryptoSetup).encLevelSeal = protocol.EncryptionUnencrypted
+			p, err := packer.PackPacket()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeNil())
+		})
+	})
+
 	It("packs a single ACK", func() {
 		mockStreamFramer.EXPECT().HasCryptoStreamData()
 		mockStreamFramer.EXPECT().PopStreamFrames(gomock.Any())
@@ -810,7 +955,7 @@ var _ = Describe("Packet packer", func() {
 			Expect(err).ToNot(HaveOccurred())
 			// parse the header and check the values
 			r := bytes.NewReader(packet.raw)
-			hdr, err := wire.ParseHeaderSentByClient(r)
+			hdr, err := wire.ParseHeaderSentByClient(r, protocol.DefaultConnectionIDLength)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(hdr.PayloadLen).To(BeEquivalentTo(r.Len()))
 		})
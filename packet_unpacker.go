@@ -19,6 +19,7 @@ type gQUICAEAD interface {
 
 type quicAEAD interface {
 	OpenHandshake(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
+	Open0RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
 	Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error)
 }
 
@@ -103,7 +104,10 @@ func (u *packetUnpacker) Unpack(headerBinary []byte, hdr *wire.Header, data []by
 	var decrypted []byte
 	var encryptionLevel protocol.EncryptionLevel
 	var err error
-	if hdr.IsLongHeader {
+	if hdr.IsLongHeader && hdr.Type == protocol.PacketType0RTT {
+		decrypted, err = u.aead.Open0RTT(buf, data, hdr.PacketNumber, headerBinary)
+		encryptionLevel = protocol.EncryptionSecure
+	} else if hdr.IsLongHeader {
 		decrypted, err = u.aead.OpenHandshake(buf, data, hdr.PacketNumber, headerBinary)
 		encryptionLevel = protocol.EncryptionUnencrypted
 	} else {
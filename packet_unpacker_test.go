@@ -86,6 +86,15 @@ var _ = Describe("Packet Unpacker (for IETF QUIC)", func() {
 		Expect(packet.encryptionLevel).To(Equal(protocol.EncryptionUnencrypted))
 	})
 
+	It("opens 0-RTT packets", func() {
+		hdr.IsLongHeader = true
+		hdr.Type = protocol.PacketType0RTT
+		aead.EXPECT().Open0RTT(gomock.Any(), gomock.Any(), hdr.PacketNumber, hdr.Raw).Return([]byte{0}, nil)
+		packet, err := unpacker.Unpack(hdr.Raw, hdr, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(packet.encryptionLevel).To(Equal(protocol.EncryptionSecure))
+	})
+
 	It("unpacks the frames", func() {
 		buf := &bytes.Buffer{}
 		(&wire.PingFrame{}).Write(buf, versionIETFFrames)
@@ -0,0 +1,190 @@
+package quic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/handshake"
+	"github.com/wangjiezhe/quic-go/internal/mint"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+)
+
+// The clientPSKCache makes the ClientSessionCache usable by mint.
+// The state for a server is loaded from the ClientSessionCache once, when the connection is established.
+// Session tickets should only be used once, so it is removed from the ClientSessionCache.
+// When the server issues a new session ticket, the new state is stored in the ClientSessionCache,
+// as soon as the transport parameters of the server are known.
+type clientPSKCache struct {
+	mutex sync.Mutex
+
+	cache      ClientSessionCache
+	sessionKey string
+	version    protocol.VersionNumber
+	early      bool // should 0-RTT be used
+
+	// state is the state loaded from the ClientSessionCache, nil if there was none
+	state *ClientSessionState
+
+	// the values used to compose a new ClientSessionState
+	psk        *mint.PreSharedKey
+	peerParams *handshake.TransportParameters
+	token      []byte
+}
+
+var _ mint.PreSharedKeyCache = &clientPSKCache{}
+
+func newClientPSKCache(cache ClientSessionCache, sessionKey string, version protocol.VersionNumber, early bool) *clientPSKCache {
+	c := &clientPSKCache{
+		cache:      cache,
+		sessionKey: sessionKey,
+		version:    version,
+		early:      early,
+	}
+	if state, ok := cache.Get(sessionKey); ok && state != nil {
+		cache.Put(sessionKey, nil)
+		if state.version == version && time.Now().Before(state.psk.ExpiresAt) {
+			c.state = state
+			c.token = state.token
+		}
+	}
+	return c
+}
+
+// Get returns the PSK loaded from the ClientSessionCache.
+// mint uses the server name as the key, which is always the session key.
+func (c *clientPSKCache) Get(string) (mint.PreSharedKey, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.state == nil {
+		return mint.PreSharedKey{}, false
+	}
+	return c.state.psk, true
+}
+
+// Put is called by mint when the server issues a new session ticket.
+func (c *clientPSKCache) Put(_ string, psk mint.PreSharedKey) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.psk = &psk
+	c.maybeStore()
+}
+
+func (c *clientPSKCache) Size() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.state == nil {
+		return 0
+	}
+	return 1
+}
+
+// SetPeerParams sets the transport parameters sent by the server.
+func (c *clientPSKCache) SetPeerParams(params *handshake.TransportParameters) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	p := *params
+	// the stateless reset token is only valid for this connection
+	p.StatelessResetToken = nil
+	c.peerParams = &p
+	c.maybeStore()
+}
+
+// SetToken sets the token received in a Retry packet.
+func (c *clientPSKCache) SetToken(token []byte) {
+	c.mutex.Lock()
+	c.token = token
+	c.mutex.Unlock()
+}
+
+// Token returns the token that was stored with the session ticket.
+func (c *clientPSKCache) Token() []byte {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.token
+}
+
+// ZeroRTTParams returns the transport parameters that apply to 0-RTT data.
+// It returns nil if 0-RTT is not used.
+func (c *clientPSKCache) ZeroRTTParams() *handshake.TransportParameters {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.early || c.state == nil {
+		return nil
+	}
+	params := c.state.params
+	return &params
+}
+
+func (c *clientPSKCache) maybeStore() {
+	if c.psk == nil || c.peerParams == nil {
+		return
+	}
+	c.cache.Put(c.sessionKey, &ClientSessionState{
+		version: c.version,
+		psk:     *c.psk,
+		params:  *c.peerParams,
+		token:   c.token,
+	})
+}
+
+// The serverPSKCache stores the session tickets issued by a server.
+// Every session ticket can only be used once. This prevents replays of 0-RTT data across connections.
+type serverPSKCache struct {
+	mutex sync.Mutex
+
+	psks map[string]mint.PreSharedKey
+}
+
+var _ mint.PreSharedKeyCache = &serverPSKCache{}
+
+func newServerPSKCache() *serverPSKCache {
+	return &serverPSKCache{psks: make(map[string]mint.PreSharedKey)}
+}
+
+func (c *serverPSKCache) Get(identity string) (mint.PreSharedKey, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	psk, ok := c.psks[identity]
+	if !ok {
+		return mint.PreSharedKey{}, false
+	}
+	delete(c.psks, identity)
+	if time.Now().After(psk.ExpiresAt) {
+		return mint.PreSharedKey{}, false
+	}
+	return psk, true
+}
+
+func (c *serverPSKCache) Put(identity string, psk mint.PreSharedKey) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.psks) >= protocol.MaxSessionTickets {
+		c.deleteExpired()
+		if len(c.psks) >= protocol.MaxSessionTickets {
+			return
+		}
+	}
+	c.psks[identity] = psk
+}
+
+func (c *serverPSKCache) Size() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.psks)
+}
+
+func (c *serverPSKCache) deleteExpired() {
+	now := time.Now()
+	for identity, psk := range c.psks {
+		if now.After(psk.ExpiresAt) {
+			delete(c.psks, identity)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package quic
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/wangjiezhe/quic-go/internal/handshake"
+	"github.com/wangjiezhe/quic-go/internal/mint"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PSK Caches", func() {
+	Context("for the client", func() {
+		var cache ClientSessionCache
+
+		BeforeEach(func() {
+			cache = NewLRUClientSessionCache(10)
+		})
+
+		getPSK := func() mint.PreSharedKey {
+			return mint.PreSharedKey{
+				Identity:  []byte("identity"),
+				ExpiresAt: time.Now().Add(time.Hour),
+			}
+		}
+
+		It("doesn't return a PSK if there's no state", func() {
+			c := newClientPSKCache(cache, "foo", protocol.VersionTLS, true)
+			_, ok := c.Get("foo")
+			Expect(ok).To(BeFalse())
+			Expect(c.Size()).To(BeZero())
+			Expect(c.ZeroRTTParams()).To(BeNil())
+			Expect(c.Token()).To(BeNil())
+		})
+
+		It("loads the state, and removes it from the cache", func() {
+			psk := getPSK()
+			cache.Put("foo", &ClientSessionState{
+				version: protocol.VersionTLS,
+				psk:     psk,
+				params:  handshake.TransportParameters{IdleTimeout: 42 * time.Second},
+				token:   []byte("token"),
+			})
+			c := newClientPSKCache(cache, "foo", protocol.VersionTLS, true)
+			_, ok := cache.Get("foo")
+			Expect(ok).To(BeFalse())
+			p, ok := c.Get("foo")
+			Expect(ok).To(BeTrue())
+			Expect(p).To(Equal(psk))
+			Expect(c.Size()).To(Equal(1))
+			Expect(c.Token()).To(Equal([]byte("token")))
+			Expect(c.ZeroRTTParams()).ToNot(BeNil())
+			Expect(c.ZeroRTTParams().IdleTimeout).To(Equal(42 * time.Second))
+		})
+
+		It("doesn't return 0-RTT parameters if 0-RTT is not used", func() {
+			cache.Put("foo", &ClientSessionState{version: protocol.VersionTLS, psk: getPSK()})
+			c := newClientPSKCache(cache, "foo", protocol.VersionTLS, false)
+			_, ok := c.Get("foo")
+			Expect(ok).To(BeTrue())
+			Expect(c.ZeroRTTParams()).To(BeNil())
+		})
+
+		It("ignores states for a different version", func() {
+			cache.Put("foo", &ClientSessionState{version: protocol.VersionTLS + 1, psk: getPSK()})
+			c := newClientPSKCache(cache, "foo", protocol.VersionTLS, true)
+			_, ok := c.Get("foo")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("ignores expired states", func() {
+			psk := getPSK()
+			psk.ExpiresAt = time.Now().Add(-time.Second)
+			cache.Put("foo", &ClientSessionState{version: protocol.VersionTLS, psk: psk})
+			c := newClientPSKCache(cache, "foo", protocol.VersionTLS, true)
+			_, ok := c.Get("foo")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("stores a new state when it received both the session ticket and the transport parameters", func() {
+			c := newClientPSKCache(cache, "foo", protocol.VersionTLS, true)
+			c.SetToken([]byte("token"))
+			psk := getPSK()
+			c.Put("foo", psk)
+			_, ok := cache.Get("foo")
+			Expect(ok).To(BeFalse())
+			c.SetPeerParams(&handshake.TransportParameters{
+				IdleTimeout:         42 * time.Second,
+				StatelessResetToken: &[16]byte{1, 2, 3},
+			})
+			state, ok := cache.Get("foo")
+			Expect(ok).To(BeTrue())
+			Expect(state.version).To(Equal(protocol.VersionTLS))
+			Expect(state.psk).To(Equal(psk))
+			Expect(state.token).To(Equal([]byte("token")))
+			Expect(state.params.IdleTimeout).To(Equal(42 * time.Second))
+			Expect(state.params.StatelessResetToken).To(BeNil())
+		})
+	})
+
+	Context("for the server", func() {
+		var cache *serverPSKCache
+
+		BeforeEach(func() {
+			cache = newServerPSKCache()
+		})
+
+		It("only returns a PSK once", func() {
+			psk := mint.PreSharedKey{Identity: []byte("foo"), ExpiresAt: time.Now().Add(time.Hour)}
+			cache.Put("foo", psk)
+			Expect(cache.Size()).To(Equal(1))
+			p, ok := cache.Get("foo")
+			Expect(ok).To(BeTrue())
+			Expect(p).To(Equal(psk))
+			_, ok = cache.Get("foo")
+			Expect(ok).To(BeFalse())
+			Expect(cache.Size()).To(BeZero())
+		})
+
+		It("doesn't return expired PSKs", func() {
+			cache.Put("foo", mint.PreSharedKey{ExpiresAt: time.Now().Add(-time.Second)})
+			_, ok := cache.Get("foo")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("limits the number of PSKs", func() {
+			for i := 0; i < protocol.MaxSessionTickets; i++ {
+				cache.Put(strconv.Itoa(i), mint.PreSharedKey{ExpiresAt: time.Now().Add(time.Hour)})
+			}
+			Expect(cache.Size()).To(Equal(protocol.MaxSessionTickets))
+			cache.Put("foo", mint.PreSharedKey{ExpiresAt: time.Now().Add(time.Hour)})
+			Expect(cache.Size()).To(Equal(protocol.MaxSessionTickets))
+			_, ok := cache.Get("foo")
+			Expect(ok).To(BeFalse())
+		})
+
+		It("deletes expired PSKs when the cache is full", func() {
+			for i := 0; i < protocol.MaxSessionTickets; i++ {
+				cache.Put(strconv.Itoa(i), mint.PreSharedKey{ExpiresAt: time.Now().Add(-time.Second)})
+			}
+			cache.Put("foo", mint.PreSharedKey{ExpiresAt: time.Now().Add(time.Hour)})
+			Expect(cache.Size()).To(Equal(1))
+			_, ok := cache.Get("foo")
+			Expect(ok).To(BeTrue())
+		})
+	})
+})
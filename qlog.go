@@ -0,0 +1,148 @@
+package quic
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/wangjiezhe/quic-go/internal/qlog"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+)
+
+// qlogDirEnv is the environment variable that sets the qlog directory,
+// if Config.QlogDir is not set
+const qlogDirEnv = "QUIC_GO_QLOG_DIR"
+
+// getQlogDir returns the directory that qlog files are written to.
+// An empty string means that qlog is disabled.
+func getQlogDir(config *Config) string {
+	if config.QlogDir != "" {
+		return config.QlogDir
+	}
+	return os.Getenv(qlogDirEnv)
+}
+
+// qlogTracer writes one qlog file per connection
+type qlogTracer struct {
+	dir    string
+	logger utils.Logger
+}
+
+var _ Tracer = &qlogTracer{}
+
+func newQlogTracer(dir string, logger utils.Logger) Tracer {
+	return &qlogTracer{dir: dir, logger: logger}
+}
+
+func (t *qlogTracer) TracerForConnection(p Perspective, odcid ConnectionID) ConnectionTracer {
+	role := "server"
+	if p == PerspectiveClient {
+		role = "client"
+	}
+	f, filename, err := createQlogFile(t.dir, fmt.Sprintf("%x_%s", []byte(odcid), role))
+	if err != nil {
+		t.logger.Errorf("Couldn't create qlog file: %s", err)
+		return nil
+	}
+	return &qlogConnectionTracer{
+		tracer:   qlog.NewTracer(f, p, odcid),
+		filename: filename,
+		logger:   t.logger,
+	}
+}
+
+// createQlogFile creates a new qlog file in dir.
+// Existing files are never overwritten: if a file with the same name already exists
+// (e.g. when a client dials the same connection ID again), a counter is appended to the name.
+func createQlogFile(dir, name string) (*os.File, string, error) {
+	for i := 0; ; i++ {
+		filename := filepath.Join(dir, name+".qlog")
+		if i > 0 {
+			filename = filepath.Join(dir, fmt.Sprintf("%s_%d.qlog", name, i))
+		}
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) {
+			continue
+		}
+		return f, filename, err
+	}
+}
+
+// DroppedPacket is not logged, since qlog only records events of a single connection
+func (t *qlogTracer) DroppedPacket(net.Addr, PacketDropReason, ByteCount) {}
+
+// qlogConnectionTracer translates the tracing events to qlog events
+type qlogConnectionTracer struct {
+	tracer   *qlog.Tracer
+	filename string
+	logger   utils.Logger
+}
+
+var _ ConnectionTracer = &qlogConnectionTracer{}
+
+func (t *qlogConnectionTracer) SentPacket(p *PacketInfo) {
+	t.tracer.SentPacket(toQlogHeader(p), p.Frames)
+}
+
+func (t *qlogConnectionTracer) ReceivedPacket(p *PacketInfo) {
+	t.tracer.ReceivedPacket(toQlogHeader(p), p.Frames)
+}
+
+func (t *qlogConnectionTracer) DroppedPacket(reason PacketDropReason, size ByteCount) {
+	var trigger string
+	switch reason {
+	case PacketDropUndecryptable:
+		trigger = "decryption_failure"
+	case PacketDropDuplicate:
+		trigger = "duplicate"
+	case PacketDropUnknownConnectionID:
+		trigger = "unknown_connection_id"
+	default:
+		trigger = "unknown"
+	}
+	t.tracer.DroppedPacket(trigger, size)
+}
+
+func (t *qlogConnectionTracer) LostPacket(encLevel EncryptionLevel, pn PacketNumber, _ ByteCount) {
+	t.tracer.LostPacket(encLevel, pn)
+}
+
+func (t *qlogConnectionTracer) UpdatedMetrics(m Metrics) {
+	t.tracer.UpdatedMetrics(m)
+}
+
+func (t *qlogConnectionTracer) UpdatedCongestionState(s CongestionState) {
+	t.tracer.UpdatedCongestionState(s)
+}
+
+func (t *qlogConnectionTracer) LossTimerExpired(tt TimerType) {
+	t.tracer.LossTimerExpired(tt)
+}
+
+func (t *qlogConnectionTracer) Close() {
+	if err := t.tracer.Close(); err != nil {
+		t.logger.Errorf("Writing qlog file %s failed: %s", t.filename, err)
+	}
+}
+
+func toQlogHeader(p *PacketInfo) *qlog.PacketHeader {
+	return &qlog.PacketHeader{
+		Type:             p.Type,
+		DestConnectionID: p.DestConnectionID,
+		SrcConnectionID:  p.SrcConnectionID,
+		PacketNumber:     p.PacketNumber,
+		EncryptionLevel:  p.EncryptionLevel,
+		Size:             p.Size,
+		Duplicate:        p.PotentiallyDuplicate,
+	}
+}
+
+// addQlogTracer adds a qlogTracer for qlogDir to the tracer.
+// If qlogDir is empty, the tracer is returned unchanged.
+func addQlogTracer(tracer Tracer, qlogDir string) Tracer {
+	if qlogDir == "" {
+		return tracer
+	}
+	return newTracerMultiplexer(tracer, newQlogTracer(qlogDir, utils.DefaultLogger))
+}
@@ -0,0 +1,125 @@
+package quic
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/utils"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("qlog", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "quic-go-qlog")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("uses the directory from the config", func() {
+		os.Setenv(qlogDirEnv, "/foo/bar")
+		defer os.Unsetenv(qlogDirEnv)
+		Expect(getQlogDir(&Config{QlogDir: dir})).To(Equal(dir))
+	})
+
+	It("uses the directory from the environment variable", func() {
+		os.Setenv(qlogDirEnv, dir)
+		defer os.Unsetenv(qlogDirEnv)
+		Expect(getQlogDir(&Config{})).To(Equal(dir))
+	})
+
+	It("doesn't add a tracer if qlog is disabled", func() {
+		Expect(addQlogTracer(nil, "")).To(BeNil())
+		tracer := NewMockTracer(mockCtrl)
+		Expect(addQlogTracer(tracer, "")).To(Equal(tracer))
+	})
+
+	It("writes one qlog file per connection", func() {
+		tracer := newQlogTracer(dir, utils.DefaultLogger)
+		clientTracer := tracer.TracerForConnection(protocol.PerspectiveClient, protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef})
+		Expect(clientTracer).ToNot(BeNil())
+		serverTracer := tracer.TracerForConnection(protocol.PerspectiveServer, protocol.ConnectionID{1, 2, 3, 4})
+		Expect(serverTracer).ToNot(BeNil())
+		clientTracer.SentPacket(&PacketInfo{
+			PacketNumber:    42,
+			EncryptionLevel: protocol.EncryptionForwardSecure,
+			Size:            1234,
+			Frames:          []Frame{&wire.PingFrame{}},
+		})
+		clientTracer.DroppedPacket(PacketDropDuplicate, 100)
+		clientTracer.Close()
+		serverTracer.Close()
+
+		files, err := ioutil.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(2))
+		Expect(files[0].Name()).To(Equal("01020304_server.qlog"))
+		Expect(files[1].Name()).To(Equal("deadbeef_client.qlog"))
+		data, err := ioutil.ReadFile(filepath.Join(dir, "deadbeef_client.qlog"))
+		Expect(err).ToNot(HaveOccurred())
+		var qlog struct {
+			Traces []struct {
+				Events [][]interface{} `json:"events"`
+			} `json:"traces"`
+		}
+		Expect(json.Unmarshal(data, &qlog)).To(Succeed())
+		Expect(qlog.Traces).To(HaveLen(1))
+		events := qlog.Traces[0].Events
+		Expect(events).To(HaveLen(2))
+		Expect(events[0][2]).To(Equal("packet_sent"))
+		Expect(events[1][2]).To(Equal("packet_dropped"))
+		Expect(events[1][3]).To(HaveKeyWithValue("trigger", "duplicate"))
+	})
+
+	It("doesn't overwrite existing qlog files", func() {
+		tracer := newQlogTracer(dir, utils.DefaultLogger)
+		connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+		for i := 0; i < 3; i++ {
+			ct := tracer.TracerForConnection(protocol.PerspectiveClient, connID)
+			Expect(ct).ToNot(BeNil())
+			ct.Close()
+		}
+		files, err := ioutil.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(files).To(HaveLen(3))
+		Expect(files[0].Name()).To(Equal("deadbeef_client.qlog"))
+		Expect(files[1].Name()).To(Equal("deadbeef_client_1.qlog"))
+		Expect(files[2].Name()).To(Equal("deadbeef_client_2.qlog"))
+	})
+
+	It("uses the original destination connection ID in the qlog file", func() {
+		tracer := newQlogTracer(dir, utils.DefaultLogger)
+		ct := tracer.TracerForConnection(protocol.PerspectiveServer, protocol.ConnectionID{1, 2, 3, 4})
+		Expect(ct).ToNot(BeNil())
+		ct.Close()
+		data, err := ioutil.ReadFile(filepath.Join(dir, "01020304_server.qlog"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"ODCID":"01020304"`))
+	})
+
+	It("doesn't trace the connection if the file can't be created", func() {
+		tracer := newQlogTracer(filepath.Join(dir, "does-not-exist"), utils.DefaultLogger)
+		Expect(tracer.TracerForConnection(protocol.PerspectiveClient, protocol.ConnectionID{1, 2, 3, 4})).To(BeNil())
+	})
+
+	It("adds the qlog tracer to the config", func() {
+		tracer := NewMockTracer(mockCtrl)
+		c := populateServerConfig(&Config{Tracer: tracer, QlogDir: dir})
+		Expect(c.QlogDir).To(Equal(dir))
+		Expect(c.Tracer).To(BeAssignableToTypeOf(tracerMultiplexer{}))
+		c = populateClientConfig(&Config{QlogDir: dir})
+		Expect(c.QlogDir).To(Equal(dir))
+		Expect(c.Tracer).To(BeAssignableToTypeOf(&qlogTracer{}))
+	})
+})
@@ -292,6 +292,19 @@ func (s *sendStream) Context() context.Context {
 	return s.ctx
 }
 
+func (s *sendStream) SetPriority(p Priority) {
+	if p.Urgency > MaxUrgency {
+		p.Urgency = MaxUrgency
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// there's nothing left to send on this stream
+	if s.finSent || s.canceledWrite || s.closedForShutdown {
+		return
+	}
+	s.sender.setStreamPriority(s.streamID, p)
+}
+
 func (s *sendStream) SetWriteDeadline(t time.Time) error {
 	s.mutex.Lock()
 	oldDeadline := s.writeDeadline
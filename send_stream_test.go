@@ -480,6 +480,28 @@ var _ = Describe("Send Stream", func() {
 		})
 	})
 
+	Context("priorities", func() {
+		It("sets the priority", func() {
+			mockSender.EXPECT().setStreamPriority(streamID, Priority{Urgency: 1, Incremental: true})
+			str.SetPriority(Priority{Urgency: 1, Incremental: true})
+		})
+
+		It("limits the urgency", func() {
+			mockSender.EXPECT().setStreamPriority(streamID, Priority{Urgency: MaxUrgency})
+			str.SetPriority(Priority{Urgency: 100})
+		})
+
+		It("doesn't set the priority after the FIN was sent", func() {
+			mockSender.EXPECT().onHasStreamData(streamID)
+			mockSender.EXPECT().onStreamCompleted(streamID)
+			str.Close()
+			f, _ := str.popStreamFrame(1000)
+			Expect(f.FinBit).To(BeTrue())
+			// don't EXPECT any calls to setStreamPriority
+			str.SetPriority(Priority{Urgency: 1})
+		})
+	})
+
 	Context("handling MAX_STREAM_DATA frames", func() {
 		It("informs the flow controller", func() {
 			mockFC.EXPECT().UpdateSendWindow(protocol.ByteCount(0x1337))
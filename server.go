@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/wangjiezhe/quic-go/internal/crypto"
@@ -18,34 +19,63 @@ import (
 
 // packetHandler handles packets
 type packetHandler interface {
-	Session
+	EarlySession
 	getCryptoStream() cryptoStreamI
 	handlePacket(*receivedPacket)
 	GetVersion() protocol.VersionNumber
 	run() error
 	closeRemote(error)
+	// closePath is called when reading from a path added by Session.MigrateTo failed. It is only used by clients.
+	closePath(connection, error)
 }
 
 type sessionRunner interface {
 	onHandshakeComplete(packetHandler)
 	removeConnectionID(protocol.ConnectionID)
+	// addConnectionID registers an additional connection ID for a session.
+	addConnectionID(protocol.ConnectionID, packetHandler)
+	// addPath starts reading packets from a new path. It is only used by clients.
+	addPath(connection)
+	// removePath stops reading packets from a path added by addPath, without closing it. It is only used by clients.
+	removePath(connection)
+	// getStatelessResetToken returns the stateless reset token for a connection ID chosen by this endpoint.
+	getStatelessResetToken(protocol.ConnectionID) [16]byte
+	// addResetToken registers a stateless reset token received from the peer. It is only used by clients.
+	addResetToken([16]byte)
 }
 
 type runner struct {
 	onHandshakeCompleteImpl func(packetHandler)
 	removeConnectionIDImpl  func(protocol.ConnectionID)
+	addConnectionIDImpl     func(protocol.ConnectionID, packetHandler)
+	addPathImpl             func(connection)
+	removePathImpl          func(connection)
+
+	getStatelessResetTokenImpl func(protocol.ConnectionID) [16]byte
+	addResetTokenImpl          func([16]byte)
 }
 
 func (r *runner) onHandshakeComplete(p packetHandler)        { r.onHandshakeCompleteImpl(p) }
 func (r *runner) removeConnectionID(c protocol.ConnectionID) { r.removeConnectionIDImpl(c) }
+func (r *runner) addConnectionID(c protocol.ConnectionID, p packetHandler) {
+	r.addConnectionIDImpl(c, p)
+}
+func (r *runner) addPath(c connection)    { r.addPathImpl(c) }
+func (r *runner) removePath(c connection) { r.removePathImpl(c) }
+func (r *runner) getStatelessResetToken(c protocol.ConnectionID) [16]byte {
+	return r.getStatelessResetTokenImpl(c)
+}
+func (r *runner) addResetToken(t [16]byte) { r.addResetTokenImpl(t) }
 
 var _ sessionRunner = &runner{}
 
 type sessionHandler interface {
 	Add(protocol.ConnectionID, packetHandler)
+	AddIfNotTaken(protocol.ConnectionID, packetHandler) bool
 	Get(protocol.ConnectionID) (packetHandler, bool)
 	Remove(protocol.ConnectionID)
 	Close()
+	CloseGracefully(time.Duration)
 }
 
 // A Listener of QUIC
@@ -53,7 +83,9 @@ type server struct {
 	tlsConf *tls.Config
 	config  *Config
 
-	conn net.PacketConn
+	// The sockets the server reads from.
+	// Usually this is a single socket, unless the server was created by ListenAddrReusePort.
+	conns []rawConn
 
 	supportsTLS bool
 	serverTLS   *serverTLS
@@ -63,12 +95,25 @@ type server struct {
 
 	sessionHandler sessionHandler
 
+	// zeroRTTQueues buffers 0-RTT packets that arrive before the session is created (for IETF QUIC)
+	zeroRTTQueues map[string]*zeroRTTQueue
+	zeroRTTMutex  sync.Mutex
+
 	serverError error
 
 	sessionQueue chan Session
 	errorChan    chan struct{}
-
-	sessionRunner sessionRunner
+	errorOnce    sync.Once
+	// serving counts the go routines reading from the sockets, see serve
+	serving sync.WaitGroup
+	// closing is closed when CloseGracefully is called.
+	// No new sessions are accepted after that.
+	closing     chan struct{}
+	closingOnce sync.Once
+
+	sessionRunner     sessionRunner
+	statelessResetter *statelessResetter
+	connLimiter       *connLimiter
 	// set as a member, so they can be set in the tests
 	newSession func(connection, sessionRunner, protocol.VersionNumber, protocol.ConnectionID, *handshake.ServerConfig, *tls.Config, *Config, utils.Logger) (packetHandler, error)
 
@@ -77,6 +122,13 @@ type server struct {
 
 var _ Listener = &server{}
 
+var errServerClosing = errors.New("server is closing")
+
+type zeroRTTQueue struct {
+	packets []*receivedPacket
+	expiry  time.Time
+}
+
 // ListenAddr creates a QUIC server listening on a given address.
 // The tls.Config must not be nil, the quic.Config may be nil.
 func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, error) {
@@ -91,9 +143,45 @@ func ListenAddr(addr string, tlsConf *tls.Config, config *Config) (Listener, err
 	return Listen(conn, tlsConf, config)
 }
 
+// ListenAddrReusePort creates a QUIC server listening on a given address, using numSockets UDP sockets.
+// All sockets are bound to the same address using SO_REUSEPORT, and the kernel distributes incoming packets among them.
+// Every socket is read from in a separate go routine, and sessions send their packets on the socket
+// they last received a packet on.
+// This is only supported on Linux.
+// The tls.Config must not be nil, the quic.Config may be nil.
+func ListenAddrReusePort(addr string, numSockets int, tlsConf *tls.Config, config *Config) (Listener, error) {
+	if numSockets < 1 {
+		return nil, fmt.Errorf("invalid number of sockets: %d", numSockets)
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conns := make([]net.PacketConn, 0, numSockets)
+	for i := 0; i < numSockets; i++ {
+		conn, err := listenUDPReusePort(udpAddr)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+		// If the port was chosen by the kernel, bind all other sockets to the same port.
+		udpAddr = conn.LocalAddr().(*net.UDPAddr)
+	}
+	return listen(conns, tlsConf, config)
+}
+
 // Listen listens for QUIC connections on a given net.PacketConn.
+// The net.PacketConn can also be used to Dial connections, see Dial.
+// It is closed when the Listener is closed and all sessions dialed from it are closed.
 // The tls.Config must not be nil, the quic.Config may be nil.
 func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener, error) {
+	return listen([]net.PacketConn{conn}, tlsConf, config)
+}
+
+func listen(pconns []net.PacketConn, tlsConf *tls.Config, config *Config) (Listener, error) {
 	certChain := crypto.NewCertChain(tlsConf)
 	kex, err := crypto.NewCurve25519KEX()
 	if err != nil {
@@ -104,6 +192,12 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener,
 		return nil, err
 	}
 	config = populateServerConfig(config)
+	if l := config.ConnectionIDLength; l < 4 || l > 18 {
+		if l == 0 {
+			return nil, errors.New("zero-length connection IDs are only supported by clients")
+		}
+		return nil, fmt.Errorf("invalid connection ID length: %d bytes", l)
+	}
 
 	var supportsTLS bool
 	for _, v := range config.Versions {
@@ -117,43 +211,74 @@ func Listen(conn net.PacketConn, tlsConf *tls.Config, config *Config) (Listener,
 		}
 	}
 
+	// The sockets can be shared with clients that dial from the same socket.
+	// As long as they aren't, the server reads from the sockets directly.
+	conns := make([]rawConn, 0, len(pconns))
+	for _, c := range pconns {
+		mconn, err := multiplexer.AddServer(c)
+		if err != nil {
+			for _, mc := range conns {
+				mc.Close()
+			}
+			return nil, err
+		}
+		conns = append(conns, mconn)
+	}
 	s := &server{
-		conn:           conn,
+		conns:          conns,
 		tlsConf:        tlsConf,
 		config:         config,
 		certChain:      certChain,
 		scfg:           scfg,
 		newSession:     newSession,
 		sessionHandler: newSessionMap(),
+		zeroRTTQueues:  make(map[string]*zeroRTTQueue),
 		sessionQueue:   make(chan Session, 5),
 		errorChan:      make(chan struct{}),
+		closing:        make(chan struct{}),
 		supportsTLS:    supportsTLS,
 		logger:         utils.DefaultLogger.WithPrefix("server"),
 	}
-	s.setup()
+	if err := s.setup(); err != nil {
+		s.closeConns()
+		return nil, err
+	}
 	if supportsTLS {
 		if err := s.setupTLS(); err != nil {
+			s.closeConns()
 			return nil, err
 		}
 	}
-	go s.serve()
-	s.logger.Debugf("Listening for %s connections on %s", conn.LocalAddr().Network(), conn.LocalAddr().String())
+	s.serving.Add(len(s.conns))
+	for _, conn := range s.conns {
+		go func(conn rawConn) {
+			defer s.serving.Done()
+			s.serve(conn)
+		}(conn)
+	}
+	s.logger.Debugf("Listening for %s connections on %s", s.Addr().Network(), s.Addr().String())
 	return s, nil
 }
 
-func (s *server) setup() {
+func (s *server) setup() error {
+	resetter, err := newStatelessResetter(s.config.StatelessResetKey)
+	if err != nil {
+		return err
+	}
+	s.statelessResetter = resetter
+	s.connLimiter = newConnLimiter(s.config)
 	s.sessionRunner = &runner{
-		onHandshakeCompleteImpl: func(sess packetHandler) { s.sessionQueue <- sess },
-		removeConnectionIDImpl:  s.sessionHandler.Remove,
+		onHandshakeCompleteImpl:    func(sess packetHandler) { s.sessionQueue <- sess },
+		removeConnectionIDImpl:     s.sessionHandler.Remove,
+		addConnectionIDImpl:        s.sessionHandler.Add,
+		getStatelessResetTokenImpl: s.statelessResetter.GetStatelessResetToken,
+		addResetTokenImpl:          func([16]byte) {},
 	}
+	return nil
 }
 
 func (s *server) setupTLS() error {
-	cookieHandler, err := handshake.NewCookieHandler(s.config.AcceptCookie, s.logger)
-	if err != nil {
-		return err
-	}
-	serverTLS, sessionChan, err := newServerTLS(s.conn, s.config, s.sessionRunner, cookieHandler, s.tlsConf, s.logger)
+	serverTLS, sessionChan, err := newServerTLS(s.config, s.sessionRunner, s.connLimiter, s.tlsConf, s.logger)
 	if err != nil {
 		return err
 	}
@@ -169,6 +294,7 @@ func (s *server) setupTLS() error {
 				// The connection ID is a randomly chosen 8 byte value.
 				// It is safe to assume that it doesn't collide with other randomly chosen values.
 				s.sessionHandler.Add(tlsSession.connID, sess)
+				s.addOrigConnID(tlsSession.origConnID, sess)
 				go sess.run()
 			}
 		}
@@ -176,6 +302,72 @@ func (s *server) setupTLS() error {
 	return nil
 }
 
+// addOrigConnID registers the connection ID chosen by the client,
+// which is used for retransmissions of the Initial packet and for 0-RTT packets.
+// The 0-RTT packets that were buffered for this connection ID are passed to the session.
+func (s *server) addOrigConnID(connID protocol.ConnectionID, sess packetHandler) {
+	s.zeroRTTMutex.Lock()
+	// Another client might (maliciously) have used the same connection ID.
+	added := s.sessionHandler.AddIfNotTaken(connID, sess)
+	queue := s.zeroRTTQueues[string(connID)]
+	delete(s.zeroRTTQueues, string(connID))
+	s.zeroRTTMutex.Unlock()
+
+	if !added {
+		return
+	}
+	// The client switches to the connection ID chosen by the server as soon as it receives the first packet.
+	time.AfterFunc(s.config.HandshakeTimeout, func() { s.sessionHandler.Remove(connID) })
+	if queue != nil {
+		for _, p := range queue.packets {
+			sess.handlePacket(p)
+		}
+	}
+}
+
+// queue0RTTPacket buffers a 0-RTT packet, until the session is created.
+func (s *server) queue0RTTPacket(p *receivedPacket) {
+	s.zeroRTTMutex.Lock()
+	defer s.zeroRTTMutex.Unlock()
+
+	connID := p.header.DestConnectionID
+	// the session might have been created in the meantime
+	if sess, ok := s.sessionHandler.Get(connID); ok {
+		if sess != nil {
+			sess.handlePacket(p)
+		}
+		return
+	}
+	queue, ok := s.zeroRTTQueues[string(connID)]
+	if !ok {
+		for id, q := range s.zeroRTTQueues {
+			if p.rcvTime.After(q.expiry) {
+				delete(s.zeroRTTQueues, id)
+			}
+		}
+		if len(s.zeroRTTQueues) >= protocol.Max0RTTQueues {
+			s.logger.Debugf("Dropping 0-RTT packet for connection %s. Too many queued connections.", connID)
+			s.traceDropped0RTTPacket(p)
+			return
+		}
+		queue = &zeroRTTQueue{expiry: p.rcvTime.Add(protocol.ZeroRTTQueueingDuration)}
+		s.zeroRTTQueues[string(connID)] = queue
+	}
+	if len(queue.packets) >= protocol.Max0RTTQueueLen {
+		s.logger.Debugf("Dropping 0-RTT packet for connection %s. Queue full.", connID)
+		s.traceDropped0RTTPacket(p)
+		return
+	}
+	s.logger.Debugf("Queueing 0-RTT packet for connection %s.", connID)
+	queue.packets = append(queue.packets, p)
+}
+
+func (s *server) traceDropped0RTTPacket(p *receivedPacket) {
+	if s.config.Tracer != nil {
+		s.config.Tracer.DroppedPacket(p.remoteAddr, PacketDropUnknownConnectionID, protocol.ByteCount(len(p.header.Raw)+len(p.data)))
+	}
+}
+
 var defaultAcceptCookie = func(clientAddr net.Addr, cookie *Cookie) bool {
 	if cookie == nil {
 		return false
@@ -237,37 +429,77 @@ func populateServerConfig(config *Config) *Config {
 	} else if maxIncomingUniStreams < 0 {
 		maxIncomingUniStreams = 0
 	}
+	connIDGenerator := config.ConnectionIDGenerator
+	if connIDGenerator == nil {
+		connIDLen := config.ConnectionIDLength
+		if connIDLen == 0 {
+			connIDLen = protocol.DefaultConnectionIDLength
+		} else if connIDLen < 0 {
+			connIDLen = 0
+		}
+		connIDGenerator = &randomConnIDGenerator{length: connIDLen}
+	}
+	max0RTTData := config.Max0RTTData
+	if max0RTTData == 0 {
+		max0RTTData = protocol.DefaultMax0RTTData
+	}
+	qlogDir := getQlogDir(config)
 
 	return &Config{
 		Versions:                              versions,
 		HandshakeTimeout:                      handshakeTimeout,
 		IdleTimeout:                           idleTimeout,
 		AcceptCookie:                          vsa,
+		AcceptConnection:                      config.AcceptConnection,
+		MaxIncomingConnections:                config.MaxIncomingConnections,
+		MaxHandshakesPerIP:                    config.MaxHandshakesPerIP,
+		MaxConnectionRate:                     config.MaxConnectionRate,
 		KeepAlive:                             config.KeepAlive,
+		EnableDatagrams:                       config.EnableDatagrams,
+		DisablePathMTUDiscovery:               config.DisablePathMTUDiscovery,
+		ConnectionIDLength:                    connIDGenerator.ConnectionIDLen(),
+		ConnectionIDGenerator:                 connIDGenerator,
 		MaxReceiveStreamFlowControlWindow:     maxReceiveStreamFlowControlWindow,
 		MaxReceiveConnectionFlowControlWindow: maxReceiveConnectionFlowControlWindow,
 		MaxIncomingStreams:                    maxIncomingStreams,
 		MaxIncomingUniStreams:                 maxIncomingUniStreams,
+		StatelessResetKey:                     config.StatelessResetKey,
+		Tracer:                                addQlogTracer(config.Tracer, qlogDir),
+		QlogDir:                               qlogDir,
+		Allow0RTT:                             config.Allow0RTT,
+		Max0RTTData:                           max0RTTData,
+		CongestionControl:                     config.CongestionControl,
 	}
 }
 
-// serve listens on an existing PacketConn
-func (s *server) serve() {
+// serve reads packets from one of the server's sockets
+func (s *server) serve(pconn rawConn) {
+	packets := make([]rawPacket, readBatchSize)
 	for {
-		data := *getPacketBuffer()
-		data = data[:protocol.MaxReceivePacketSize]
-		// The packet size should not exceed protocol.MaxReceivePacketSize bytes
-		// If it does, we only read a truncated packet, which will then end up undecryptable
-		n, remoteAddr, err := s.conn.ReadFrom(data)
+		for i := range packets {
+			// The buffers of packets that were handled in the last iteration have to be replaced.
+			if packets[i].data == nil {
+				// The packet size should not exceed protocol.MaxReceivePacketSize bytes
+				// If it does, we only read a truncated packet, which will then end up undecryptable
+				packets[i].data = (*getPacketBuffer())[:protocol.MaxReceivePacketSize]
+			}
+		}
+		n, err := pconn.ReadPackets(packets)
 		if err != nil {
-			s.serverError = err
-			close(s.errorChan)
-			_ = s.Close()
+			s.errorOnce.Do(func() {
+				s.serverError = err
+				close(s.errorChan)
+			})
+			// The other serve go routines return once their sockets are closed.
+			_ = s.close()
 			return
 		}
-		data = data[:n]
-		if err := s.handlePacket(remoteAddr, data); err != nil {
-			s.logger.Errorf("error handling packet: %s", err.Error())
+		for i := 0; i < n; i++ {
+			p := &packets[i]
+			if err := s.handlePacket(pconn, p.addr, p.ecn, p.data); err != nil {
+				s.logger.Errorf("error handling packet: %s", err.Error())
+			}
+			*p = rawPacket{}
 		}
 	}
 }
@@ -279,28 +511,74 @@ func (s *server) Accept() (Session, error) {
 	case sess = <-s.sessionQueue:
 		return sess, nil
 	case <-s.errorChan:
-		return nil, s.serverError
+	case <-s.closing:
 	}
+	// return the sessions that completed the handshake before the server was closed
+	select {
+	case sess = <-s.sessionQueue:
+		return sess, nil
+	default:
+	}
+	if s.isClosing() {
+		return nil, errServerClosing
+	}
+	return nil, s.serverError
 }
 
 // Close the server
 func (s *server) Close() error {
+	err := s.close()
+	s.serving.Wait() // wait for all serve() go routines to return
+	return err
+}
+
+// close closes all sessions and sockets, without waiting for the serve() go routines to return.
+func (s *server) close() error {
 	s.sessionHandler.Close()
-	err := s.conn.Close()
-	<-s.errorChan // wait for serve() to return
+	return s.closeConns()
+}
+
+// CloseGracefully closes the server without interrupting active sessions.
+// It stops accepting new sessions, and waits until all sessions are closed gracefully, see Session.CloseGracefully.
+func (s *server) CloseGracefully(timeout time.Duration) error {
+	s.closingOnce.Do(func() { close(s.closing) })
+	s.sessionHandler.CloseGracefully(timeout)
+	return s.Close()
+}
+
+func (s *server) isClosing() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeConns closes all sockets.
+// Sockets that are still used by clients are only closed once these clients are done.
+func (s *server) closeConns() error {
+	var err error
+	for _, conn := range s.conns {
+		if cerr := conn.Close(); err == nil {
+			err = cerr
+		}
+	}
 	return err
 }
 
 // Addr returns the server's network address
 func (s *server) Addr() net.Addr {
-	return s.conn.LocalAddr()
+	return s.conns[0].LocalAddr()
 }
 
-func (s *server) handlePacket(remoteAddr net.Addr, packet []byte) error {
+// handlePacket handles a packet that was received on pconn.
+// All replies are sent on the same socket.
+func (s *server) handlePacket(pconn rawConn, remoteAddr net.Addr, ecn protocol.ECN, packet []byte) error {
 	rcvTime := time.Now()
 
 	r := bytes.NewReader(packet)
-	hdr, err := wire.ParseHeaderSentByClient(r)
+	hdr, err := wire.ParseHeaderSentByClient(r, s.config.ConnectionIDLength)
 	if err != nil {
 		return qerr.Error(qerr.InvalidPacketHeader, err.Error())
 	}
@@ -308,12 +586,12 @@ func (s *server) handlePacket(remoteAddr net.Addr, packet []byte) error {
 	packetData := packet[len(packet)-r.Len():]
 
 	if hdr.IsPublicHeader {
-		return s.handleGQUICPacket(hdr, packetData, remoteAddr, rcvTime)
+		return s.handleGQUICPacket(pconn, hdr, packetData, remoteAddr, ecn, rcvTime)
 	}
-	return s.handleIETFQUICPacket(hdr, packetData, remoteAddr, rcvTime)
+	return s.handleIETFQUICPacket(pconn, hdr, packetData, remoteAddr, ecn, rcvTime)
 }
 
-func (s *server) handleIETFQUICPacket(hdr *wire.Header, packetData []byte, remoteAddr net.Addr, rcvTime time.Time) error {
+func (s *server) handleIETFQUICPacket(pconn rawConn, hdr *wire.Header, packetData []byte, remoteAddr net.Addr, ecn protocol.ECN, rcvTime time.Time) error {
 	if hdr.IsLongHeader {
 		if !s.supportsTLS {
 			return errors.New("Received an IETF QUIC Long Header")
@@ -326,12 +604,18 @@ func (s *server) handleIETFQUICPacket(hdr *wire.Header, packetData []byte, remot
 
 		switch hdr.Type {
 		case protocol.PacketTypeInitial:
-			go s.serverTLS.HandleInitial(remoteAddr, hdr, packetData)
-			return nil
-		case protocol.PacketTypeHandshake:
+			if s.isClosing() {
+				s.logger.Debugf("Dropping Initial packet from %s. The server is closing.", remoteAddr)
+				return nil
+			}
+			// A retransmission of the Initial packet is passed to the session that was created for it.
+			if _, ok := s.sessionHandler.Get(hdr.DestConnectionID); !ok {
+				go s.serverTLS.HandleInitial(pconn, remoteAddr, hdr, packetData)
+				return nil
+			}
+		case protocol.PacketTypeHandshake, protocol.PacketType0RTT:
 			// nothing to do here. Packet will be passed to the session.
 		default:
-			// Note that this also drops 0-RTT packets.
 			return fmt.Errorf("Received unsupported packet type: %s", hdr.Type)
 		}
 	}
@@ -341,8 +625,26 @@ func (s *server) handleIETFQUICPacket(hdr *wire.Header, packetData []byte, remot
 		// Late packet for closed session
 		return nil
 	}
+	if !sessionKnown && hdr.IsLongHeader && hdr.Type == protocol.PacketType0RTT && s.config.Allow0RTT {
+		// The 0-RTT packet might have arrived before the session was created.
+		s.queue0RTTPacket(&receivedPacket{
+			remoteAddr: remoteAddr,
+			header:     hdr,
+			data:       packetData,
+			ecn:        ecn,
+			rcvTime:    rcvTime,
+			rcvConn:    pconn,
+		})
+		return nil
+	}
 	if !sessionKnown {
 		s.logger.Debugf("Received %s packet for unknown connection %s.", hdr.Type, hdr.DestConnectionID)
+		if s.config.Tracer != nil {
+			s.config.Tracer.DroppedPacket(remoteAddr, PacketDropUnknownConnectionID, protocol.ByteCount(len(hdr.Raw)+len(packetData)))
+		}
+		if !hdr.IsLongHeader {
+			return s.maybeSendStatelessReset(pconn, hdr, len(hdr.Raw)+len(packetData), remoteAddr)
+		}
 		return nil
 	}
 
@@ -350,12 +652,35 @@ func (s *server) handleIETFQUICPacket(hdr *wire.Header, packetData []byte, remot
 		remoteAddr: remoteAddr,
 		header:     hdr,
 		data:       packetData,
+		ecn:        ecn,
 		rcvTime:    rcvTime,
+		rcvConn:    pconn,
 	})
 	return nil
 }
 
-func (s *server) handleGQUICPacket(hdr *wire.Header, packetData []byte, remoteAddr net.Addr, rcvTime time.Time) error {
+// maybeSendStatelessReset sends a stateless reset in response to a Short Header packet for an unknown connection.
+// This should only happen after a server restart, when we still receive packets for connections that we lost the state for.
+// Stateless resets are only sent if a StatelessResetKey is configured, since otherwise the client can't verify the token.
+func (s *server) maybeSendStatelessReset(pconn rawConn, hdr *wire.Header, packetLen int, remoteAddr net.Addr) error {
+	if s.config.StatelessResetKey == nil {
+		return nil
+	}
+	// Make sure that the stateless reset is smaller than the packet that triggered it.
+	// Otherwise, two endpoints that lost state could trigger an endless exchange of stateless resets.
+	if packetLen <= protocol.MinStatelessResetSize {
+		return nil
+	}
+	data, err := composeStatelessReset(s.statelessResetter.GetStatelessResetToken(hdr.DestConnectionID))
+	if err != nil {
+		return err
+	}
+	s.logger.Debugf("Sending stateless reset for connection %s.", hdr.DestConnectionID)
+	_, err = pconn.WriteTo(data, remoteAddr)
+	return err
+}
+
+func (s *server) handleGQUICPacket(pconn rawConn, hdr *wire.Header, packetData []byte, remoteAddr net.Addr, ecn protocol.ECN, rcvTime time.Time) error {
 	// ignore all Public Reset packets
 	if hdr.ResetFlag {
 		s.logger.Infof("Received unexpected Public Reset for connection %s.", hdr.DestConnectionID)
@@ -371,7 +696,10 @@ func (s *server) handleGQUICPacket(hdr *wire.Header, packetData []byte, remoteAd
 	// If we don't have a session for this connection, and this packet cannot open a new connection, send a Public Reset
 	// This should only happen after a server restart, when we still receive packets for connections that we lost the state for.
 	if !sessionKnown && !hdr.VersionFlag {
-		_, err := s.conn.WriteTo(wire.WritePublicReset(hdr.DestConnectionID, 0, 0), remoteAddr)
+		if s.config.Tracer != nil {
+			s.config.Tracer.DroppedPacket(remoteAddr, PacketDropUnknownConnectionID, protocol.ByteCount(len(hdr.Raw)+len(packetData)))
+		}
+		_, err := pconn.WriteTo(wire.WritePublicReset(hdr.DestConnectionID, 0, 0), remoteAddr)
 		return err
 	}
 
@@ -390,7 +718,7 @@ func (s *server) handleGQUICPacket(hdr *wire.Header, packetData []byte, remoteAd
 			return errors.New("dropping small packet with unknown version")
 		}
 		s.logger.Infof("Client offered version %s, sending Version Negotiation Packet", hdr.Version)
-		_, err := s.conn.WriteTo(wire.ComposeGQUICVersionNegotiation(hdr.SrcConnectionID, s.config.Versions), remoteAddr)
+		_, err := pconn.WriteTo(wire.ComposeGQUICVersionNegotiation(hdr.SrcConnectionID, s.config.Versions), remoteAddr)
 		return err
 	}
 
@@ -405,12 +733,20 @@ func (s *server) handleGQUICPacket(hdr *wire.Header, packetData []byte, remoteAd
 		if !protocol.IsSupportedVersion(s.config.Versions, version) {
 			return errors.New("Server BUG: negotiated version not supported")
 		}
+		if s.isClosing() {
+			s.logger.Debugf("Dropping Client Hello from %s. The server is closing.", remoteAddr)
+			return nil
+		}
+		lc, err := s.connLimiter.Admit(remoteAddr, &ClientHelloInfo{Version: version, ConnectionID: hdr.DestConnectionID})
+		if err != nil {
+			s.logger.Infof("Refusing connection %s from %v: %s", hdr.DestConnectionID, remoteAddr, err)
+			return s.sendConnectionClose(pconn, remoteAddr, hdr, err)
+		}
 
 		s.logger.Infof("Serving new connection: %s, version %s from %v", hdr.DestConnectionID, version, remoteAddr)
-		var err error
 		session, err = s.newSession(
-			&conn{pconn: s.conn, currentAddr: remoteAddr},
-			s.sessionRunner,
+			&conn{pconn: pconn, currentAddr: remoteAddr},
+			s.connLimiter.NewSessionRunner(s.sessionRunner, lc, hdr.DestConnectionID),
 			version,
 			hdr.DestConnectionID,
 			s.scfg,
@@ -419,6 +755,7 @@ func (s *server) handleGQUICPacket(hdr *wire.Header, packetData []byte, remoteAd
 			s.logger,
 		)
 		if err != nil {
+			s.connLimiter.Remove(lc)
 			return err
 		}
 		s.sessionHandler.Add(hdr.DestConnectionID, session)
@@ -430,7 +767,35 @@ func (s *server) handleGQUICPacket(hdr *wire.Header, packetData []byte, remoteAd
 		remoteAddr: remoteAddr,
 		header:     hdr,
 		data:       packetData,
+		ecn:        ecn,
 		rcvTime:    rcvTime,
+		rcvConn:    pconn,
 	})
 	return nil
 }
+
+// sendConnectionClose closes a gQUIC connection that the server didn't create a session for.
+// The CONNECTION_CLOSE is sent in an unencrypted packet.
+func (s *server) sendConnectionClose(pconn rawConn, remoteAddr net.Addr, clientHdr *wire.Header, closeErr error) error {
+	aead, err := crypto.NewNullAEAD(protocol.PerspectiveServer, clientHdr.DestConnectionID, clientHdr.Version)
+	if err != nil {
+		return err
+	}
+	ccf := &wire.ConnectionCloseFrame{
+		ErrorCode:    qerr.HandshakeFailed,
+		ReasonPhrase: closeErr.Error(),
+	}
+	replyHdr := &wire.Header{
+		DestConnectionID: clientHdr.DestConnectionID,
+		SrcConnectionID:  clientHdr.DestConnectionID,
+		PacketNumber:     1,
+		PacketNumberLen:  protocol.PacketNumberLen1,
+		Version:          clientHdr.Version,
+	}
+	data, err := packUnencryptedPacket(aead, replyHdr, ccf, protocol.PerspectiveServer, s.logger)
+	if err != nil {
+		return err
+	}
+	_, err = pconn.WriteTo(data, remoteAddr)
+	return err
+}
@@ -6,9 +6,12 @@ import (
 	"errors"
 	"net"
 	"reflect"
+	"runtime"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/wangjiezhe/quic-go/internal/crypto"
 	"github.com/wangjiezhe/quic-go/internal/handshake"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 	"github.com/wangjiezhe/quic-go/internal/testdata"
@@ -27,6 +30,8 @@ type mockSession struct {
 	runner sessionRunner
 }
 
+func acceptAllConnections(net.Addr, *ClientHelloInfo) bool { return true }
+
 var _ = Describe("Server", func() {
 	var (
 		conn    *mockPacketConn
@@ -48,6 +53,16 @@ var _ = Describe("Server", func() {
 				RequestConnectionIDOmission: true,
 				MaxIncomingStreams:          1234,
 				MaxIncomingUniStreams:       4321,
+				ConnectionIDLength:          13,
+				StatelessResetKey:           []byte("foobar"),
+				Allow0RTT:                   true,
+				Max0RTTData:                 1000,
+				CongestionControl:           NewRenoCongestionControl,
+				DisablePathMTUDiscovery:     true,
+				AcceptConnection:            acceptAllConnections,
+				MaxIncomingConnections:      100,
+				MaxHandshakesPerIP:          10,
+				MaxConnectionRate:           50,
 			}
 			c := populateServerConfig(config)
 			Expect(c.HandshakeTimeout).To(Equal(1337 * time.Minute))
@@ -55,6 +70,23 @@ var _ = Describe("Server", func() {
 			Expect(c.RequestConnectionIDOmission).To(BeFalse())
 			Expect(c.MaxIncomingStreams).To(Equal(1234))
 			Expect(c.MaxIncomingUniStreams).To(Equal(4321))
+			Expect(c.ConnectionIDLength).To(Equal(13))
+			Expect(c.StatelessResetKey).To(Equal([]byte("foobar")))
+			Expect(c.Allow0RTT).To(BeTrue())
+			Expect(c.Max0RTTData).To(Equal(protocol.ByteCount(1000)))
+			Expect(reflect.ValueOf(c.CongestionControl)).To(Equal(reflect.ValueOf(NewRenoCongestionControl)))
+			Expect(c.DisablePathMTUDiscovery).To(BeTrue())
+			Expect(reflect.ValueOf(c.AcceptConnection)).To(Equal(reflect.ValueOf(acceptAllConnections)))
+			Expect(c.MaxIncomingConnections).To(Equal(100))
+			Expect(c.MaxHandshakesPerIP).To(Equal(10))
+			Expect(c.MaxConnectionRate).To(Equal(50))
+		})
+
+		It("uses the ConnectionIDGenerator", func() {
+			g := &fixedConnIDGenerator{length: 5}
+			c := populateServerConfig(&Config{ConnectionIDGenerator: g, ConnectionIDLength: 10})
+			Expect(c.ConnectionIDGenerator).To(Equal(g))
+			Expect(c.ConnectionIDLength).To(Equal(5))
 		})
 
 		It("disables bidirectional streams", func() {
@@ -109,13 +141,14 @@ var _ = Describe("Server", func() {
 			serv = &server{
 				sessionHandler: sessionHandler,
 				newSession:     newMockSession,
-				conn:           conn,
+				conns:          []rawConn{wrapConn(conn)},
 				config:         config,
 				sessionQueue:   make(chan Session, 5),
 				errorChan:      make(chan struct{}),
+				closing:        make(chan struct{}),
 				logger:         utils.DefaultLogger,
 			}
-			serv.setup()
+			Expect(serv.setup()).To(Succeed())
 			b := &bytes.Buffer{}
 			utils.BigEndian.WriteUint32(b, uint32(protocol.SupportedVersions[0]))
 			firstPacket = []byte{0x09, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6}
@@ -146,24 +179,86 @@ var _ = Describe("Server", func() {
 			sessionHandler.EXPECT().Add(connID, gomock.Any()).Do(func(_ protocol.ConnectionID, sess packetHandler) {
 				Expect(sess.(*mockSession).connID).To(Equal(connID))
 			})
-			err := serv.handlePacket(nil, firstPacket)
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, firstPacket)
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(run).Should(BeClosed())
+		})
+
+		It("closes connections that are refused", func() {
+			remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+			var info *ClientHelloInfo
+			serv.connLimiter = newConnLimiter(&Config{
+				AcceptConnection: func(addr net.Addr, i *ClientHelloInfo) bool {
+					Expect(addr).To(Equal(remoteAddr))
+					info = i
+					return false
+				},
+			})
+			sessionHandler.EXPECT().Get(connID)
+			err := serv.handlePacket(serv.conns[0], remoteAddr, protocol.ECNNon, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
+			Expect(info).To(Equal(&ClientHelloInfo{Version: protocol.SupportedVersions[0], ConnectionID: connID}))
+			// check that the server sent a CONNECTION_CLOSE
+			Expect(conn.dataWrittenTo).To(Equal(remoteAddr))
+			r := bytes.NewReader(conn.dataWritten.Bytes())
+			hdr, err := wire.ParseHeaderSentByServer(r, protocol.DefaultConnectionIDLength)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.DestConnectionID).To(Equal(connID))
+			hdr.Raw = conn.dataWritten.Bytes()[:conn.dataWritten.Len()-r.Len()]
+			aead, err := crypto.NewNullAEAD(protocol.PerspectiveClient, connID, protocol.SupportedVersions[0])
+			Expect(err).ToNot(HaveOccurred())
+			payload, err := aead.Open(nil, conn.dataWritten.Bytes()[len(hdr.Raw):], hdr.PacketNumber, hdr.Raw)
+			Expect(err).ToNot(HaveOccurred())
+			frame, err := wire.ParseNextFrame(bytes.NewReader(payload), hdr, protocol.SupportedVersions[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&wire.ConnectionCloseFrame{
+				ErrorCode:    qerr.HandshakeFailed,
+				ReasonPhrase: errConnectionRefused.Error(),
+			}))
+		})
+
+		It("counts sessions towards the connection limits until they are closed", func() {
+			serv.connLimiter = newConnLimiter(&Config{MaxIncomingConnections: 1})
+			s := NewMockPacketHandler(mockCtrl)
+			s.EXPECT().handlePacket(gomock.Any())
+			run := make(chan struct{})
+			s.EXPECT().run().Do(func() { close(run) })
+			sessions = append(sessions, s)
+			var sess *mockSession
+			sessionHandler.EXPECT().Get(connID)
+			sessionHandler.EXPECT().Add(connID, gomock.Any()).Do(func(_ protocol.ConnectionID, s packetHandler) {
+				sess = s.(*mockSession)
+			})
+			Expect(serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, firstPacket)).To(Succeed())
 			Eventually(run).Should(BeClosed())
+			Expect(serv.connLimiter.numConnections).To(Equal(1))
+			// the session is closed
+			sessionHandler.EXPECT().Remove(connID)
+			sess.runner.removeConnectionID(connID)
+			Expect(serv.connLimiter.numConnections).To(BeZero())
 		})
 
 		It("accepts new TLS sessions", func() {
 			connID := protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}
+			origConnID := protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1}
 			run := make(chan struct{})
 			sess := NewMockPacketHandler(mockCtrl)
 			sess.EXPECT().run().Do(func() { close(run) })
 			err := serv.setupTLS()
 			Expect(err).ToNot(HaveOccurred())
 			sessionHandler.EXPECT().Add(connID, sess)
+			// the client's connection ID is registered, so that retransmissions of the Initial are passed to the session
+			sessionHandler.EXPECT().AddIfNotTaken(origConnID, sess).Return(true)
+			// it is removed after the handshake timeout
+			removed := make(chan struct{})
+			sessionHandler.EXPECT().Remove(origConnID).Do(func(protocol.ConnectionID) { close(removed) })
 			serv.serverTLS.sessionChan <- tlsSession{
-				connID: connID,
-				sess:   sess,
+				connID:     connID,
+				origConnID: origConnID,
+				sess:       sess,
 			}
 			Eventually(run).Should(BeClosed())
+			Eventually(removed).Should(BeClosed())
 		})
 
 		It("accepts a session once the connection it is forward secure", func() {
@@ -185,7 +280,7 @@ var _ = Describe("Server", func() {
 				Consistently(done).ShouldNot(BeClosed())
 				sess.(*mockSession).runner.onHandshakeComplete(sess)
 			})
-			err := serv.handlePacket(nil, firstPacket)
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
 			Eventually(done).Should(BeClosed())
 			Eventually(run).Should(BeClosed())
@@ -207,7 +302,7 @@ var _ = Describe("Server", func() {
 			sessionHandler.EXPECT().Add(connID, gomock.Any()).Do(func(_ protocol.ConnectionID, sess packetHandler) {
 				run <- errors.New("handshake error")
 			})
-			err := serv.handlePacket(nil, firstPacket)
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
 			Consistently(done).ShouldNot(BeClosed())
 			// make the go routine return
@@ -222,14 +317,187 @@ var _ = Describe("Server", func() {
 			sess.EXPECT().handlePacket(gomock.Any())
 
 			sessionHandler.EXPECT().Get(connID).Return(sess, true)
-			err := serv.handlePacket(nil, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01})
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
+		It("passes the socket the packet was received on to the session", func() {
+			pconn := wrapConn(newMockPacketConn())
+			serv.conns = append(serv.conns, pconn)
+			sess := NewMockPacketHandler(mockCtrl)
+			sess.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+				Expect(p.rcvConn).To(BeIdenticalTo(pconn))
+			})
+			sessionHandler.EXPECT().Get(connID).Return(sess, true)
+			err := serv.handlePacket(pconn, nil, protocol.ECNNon, []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("uses the configured connection ID length to parse IETF QUIC Short Headers", func() {
+			serv.config = &Config{ConnectionIDLength: 5}
+			shortConnID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x42}
+			b := &bytes.Buffer{}
+			err := (&wire.Header{
+				DestConnectionID: shortConnID,
+				PacketNumber:     0x1337,
+				PacketNumberLen:  protocol.PacketNumberLen2,
+			}).Write(b, protocol.PerspectiveClient, protocol.VersionTLS)
+			Expect(err).ToNot(HaveOccurred())
+			sess := NewMockPacketHandler(mockCtrl)
+			sess.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+				Expect(p.header.PacketNumber).To(Equal(protocol.PacketNumber(0x1337)))
+			})
+			sessionHandler.EXPECT().Get(shortConnID).Return(sess, true)
+			Expect(serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, b.Bytes())).To(Succeed())
+		})
+
+		Context("stateless resets", func() {
+			getShortHeaderPacket := func(connID protocol.ConnectionID, payloadLen int) []byte {
+				b := &bytes.Buffer{}
+				err := (&wire.Header{
+					DestConnectionID: connID,
+					PacketNumber:     0x1337,
+					PacketNumberLen:  protocol.PacketNumberLen2,
+				}).Write(b, protocol.PerspectiveClient, protocol.VersionTLS)
+				Expect(err).ToNot(HaveOccurred())
+				b.Write(bytes.Repeat([]byte{0}, payloadLen))
+				return b.Bytes()
+			}
+
+			BeforeEach(func() {
+				serv.config = populateServerConfig(&Config{StatelessResetKey: []byte("foobar")})
+				Expect(serv.setup()).To(Succeed())
+			})
+
+			It("sends a stateless reset for Short Header packets for unknown connections", func() {
+				sessionHandler.EXPECT().Get(connID).Return(nil, false)
+				Expect(serv.handlePacket(serv.conns[0], udpAddr, protocol.ECNNon, getShortHeaderPacket(connID, 100))).To(Succeed())
+				Expect(conn.dataWrittenTo).To(Equal(udpAddr))
+				data := conn.dataWritten.Bytes()
+				Expect(data).To(HaveLen(protocol.MinStatelessResetSize))
+				// the stateless reset looks like a regular Short Header packet
+				hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(data), protocol.DefaultConnectionIDLength)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hdr.IsLongHeader).To(BeFalse())
+				Expect(hdr.IsPublicHeader).To(BeFalse())
+				// the token is derived from the StatelessResetKey
+				resetter, err := newStatelessResetter([]byte("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				token := resetter.GetStatelessResetToken(connID)
+				Expect(data[len(data)-16:]).To(Equal(token[:]))
+			})
+
+			It("sends the stateless reset on the socket the packet was received on", func() {
+				conn2 := newMockPacketConn()
+				serv.conns = append(serv.conns, wrapConn(conn2))
+				sessionHandler.EXPECT().Get(connID).Return(nil, false)
+				Expect(serv.handlePacket(serv.conns[1], udpAddr, protocol.ECNNon, getShortHeaderPacket(connID, 100))).To(Succeed())
+				Expect(conn.dataWritten.Len()).To(BeZero())
+				Expect(conn2.dataWrittenTo).To(Equal(udpAddr))
+				Expect(conn2.dataWritten.Len()).To(Equal(protocol.MinStatelessResetSize))
+			})
+
+			It("doesn't send a stateless reset in response to small packets", func() {
+				sessionHandler.EXPECT().Get(connID).Return(nil, false)
+				packet := getShortHeaderPacket(connID, 0)
+				packet = append(packet, make([]byte, protocol.MinStatelessResetSize-len(packet))...)
+				Expect(serv.handlePacket(serv.conns[0], udpAddr, protocol.ECNNon, packet)).To(Succeed())
+				Expect(conn.dataWritten.Len()).To(BeZero())
+			})
+
+			It("doesn't send a stateless reset if no StatelessResetKey is configured", func() {
+				serv.config = populateServerConfig(&Config{})
+				Expect(serv.setup()).To(Succeed())
+				sessionHandler.EXPECT().Get(connID).Return(nil, false)
+				Expect(serv.handlePacket(serv.conns[0], udpAddr, protocol.ECNNon, getShortHeaderPacket(connID, 100))).To(Succeed())
+				Expect(conn.dataWritten.Len()).To(BeZero())
+			})
+		})
+
+		Context("queueing 0-RTT packets", func() {
+			get0RTTPacket := func(connID protocol.ConnectionID, pn protocol.PacketNumber) *receivedPacket {
+				return &receivedPacket{
+					remoteAddr: udpAddr,
+					header: &wire.Header{
+						IsLongHeader:     true,
+						Type:             protocol.PacketType0RTT,
+						DestConnectionID: connID,
+						PacketNumber:     pn,
+					},
+					rcvTime: time.Now(),
+				}
+			}
+
+			BeforeEach(func() {
+				serv.zeroRTTQueues = make(map[string]*zeroRTTQueue)
+				serv.config = populateServerConfig(&Config{HandshakeTimeout: time.Hour})
+			})
+
+			It("passes queued packets to the session, once it is created", func() {
+				sessionHandler.EXPECT().Get(connID).Return(nil, false).Times(2)
+				serv.queue0RTTPacket(get0RTTPacket(connID, 1))
+				serv.queue0RTTPacket(get0RTTPacket(connID, 2))
+				sess := NewMockPacketHandler(mockCtrl)
+				sessionHandler.EXPECT().AddIfNotTaken(connID, sess).Return(true)
+				var pns []protocol.PacketNumber
+				sess.EXPECT().handlePacket(gomock.Any()).Do(func(p *receivedPacket) {
+					pns = append(pns, p.header.PacketNumber)
+				}).Times(2)
+				serv.addOrigConnID(connID, sess)
+				Expect(pns).To(Equal([]protocol.PacketNumber{1, 2}))
+				Expect(serv.zeroRTTQueues).To(BeEmpty())
+			})
+
+			It("passes packets to the session, if it was created in the meantime", func() {
+				sess := NewMockPacketHandler(mockCtrl)
+				sessionHandler.EXPECT().Get(connID).Return(sess, true)
+				sess.EXPECT().handlePacket(gomock.Any())
+				serv.queue0RTTPacket(get0RTTPacket(connID, 1))
+				Expect(serv.zeroRTTQueues).To(BeEmpty())
+			})
+
+			It("doesn't pass queued packets to the session, if the connection ID is already taken", func() {
+				sessionHandler.EXPECT().Get(connID).Return(nil, false)
+				serv.queue0RTTPacket(get0RTTPacket(connID, 1))
+				sess := NewMockPacketHandler(mockCtrl)
+				sessionHandler.EXPECT().AddIfNotTaken(connID, sess).Return(false)
+				// don't EXPECT any calls to handlePacket
+				serv.addOrigConnID(connID, sess)
+			})
+
+			It("limits the length of a queue", func() {
+				sessionHandler.EXPECT().Get(connID).Return(nil, false).AnyTimes()
+				for i := 0; i < protocol.Max0RTTQueueLen+5; i++ {
+					serv.queue0RTTPacket(get0RTTPacket(connID, protocol.PacketNumber(i)))
+				}
+				Expect(serv.zeroRTTQueues[string(connID)].packets).To(HaveLen(protocol.Max0RTTQueueLen))
+			})
+
+			It("limits the number of queues", func() {
+				sessionHandler.EXPECT().Get(gomock.Any()).Return(nil, false).AnyTimes()
+				for i := 0; i < protocol.Max0RTTQueues+5; i++ {
+					serv.queue0RTTPacket(get0RTTPacket(protocol.ConnectionID{0, 0, 0, 0, 0, 0, 0, byte(i)}, 1))
+				}
+				Expect(serv.zeroRTTQueues).To(HaveLen(protocol.Max0RTTQueues))
+			})
+
+			It("deletes expired queues", func() {
+				sessionHandler.EXPECT().Get(gomock.Any()).Return(nil, false).AnyTimes()
+				for i := 0; i < protocol.Max0RTTQueues; i++ {
+					p := get0RTTPacket(protocol.ConnectionID{0, 0, 0, 0, 0, 0, 0, byte(i)}, 1)
+					p.rcvTime = time.Now().Add(-protocol.ZeroRTTQueueingDuration - time.Millisecond)
+					serv.queue0RTTPacket(p)
+				}
+				serv.queue0RTTPacket(get0RTTPacket(connID, 1))
+				Expect(serv.zeroRTTQueues).To(HaveLen(1))
+				Expect(serv.zeroRTTQueues).To(HaveKey(string(connID)))
+			})
+		})
+
 		It("closes the sessionHandler and the connection when Close is called", func() {
 			go func() {
 				defer GinkgoRecover()
-				serv.serve()
+				serv.serve(serv.conns[0])
 			}()
 			// close the server
 			sessionHandler.EXPECT().Close().AnyTimes()
@@ -237,9 +505,79 @@ var _ = Describe("Server", func() {
 			Expect(conn.closed).To(BeTrue())
 		})
 
+		It("closes all sockets, and waits for all of them to be done, when Close is called", func() {
+			conn2 := newMockPacketConn()
+			serv.conns = append(serv.conns, wrapConn(conn2))
+			var returned int32
+			serv.serving.Add(len(serv.conns))
+			for _, c := range serv.conns {
+				go func(c rawConn) {
+					defer GinkgoRecover()
+					defer serv.serving.Done()
+					serv.serve(c)
+					atomic.AddInt32(&returned, 1)
+				}(c)
+			}
+			sessionHandler.EXPECT().Close().AnyTimes()
+			Expect(serv.Close()).To(Succeed())
+			Expect(conn.closed).To(BeTrue())
+			Expect(conn2.closed).To(BeTrue())
+			Expect(atomic.LoadInt32(&returned)).To(BeEquivalentTo(2))
+		})
+
+		It("closes the sessions gracefully when CloseGracefully is called", func() {
+			go func() {
+				defer GinkgoRecover()
+				serv.serve(serv.conns[0])
+			}()
+			acceptErr := make(chan error)
+			go func() {
+				_, err := serv.Accept()
+				acceptErr <- err
+			}()
+			Consistently(acceptErr).ShouldNot(Receive())
+			sessionHandler.EXPECT().CloseGracefully(time.Minute)
+			sessionHandler.EXPECT().Close().AnyTimes()
+			Expect(serv.CloseGracefully(time.Minute)).To(Succeed())
+			Expect(conn.closed).To(BeTrue())
+			Eventually(acceptErr).Should(Receive(Equal(errServerClosing)))
+		})
+
+		It("returns the sessions that were queued before closing gracefully", func() {
+			go func() {
+				defer GinkgoRecover()
+				serv.serve(serv.conns[0])
+			}()
+			sess := NewMockPacketHandler(mockCtrl)
+			serv.sessionQueue <- sess
+			sessionHandler.EXPECT().CloseGracefully(gomock.Any())
+			sessionHandler.EXPECT().Close().AnyTimes()
+			Expect(serv.CloseGracefully(time.Minute)).To(Succeed())
+			s, err := serv.Accept()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s).To(Equal(sess))
+			_, err = serv.Accept()
+			Expect(err).To(MatchError(errServerClosing))
+		})
+
+		It("doesn't create new sessions while closing gracefully", func() {
+			go func() {
+				defer GinkgoRecover()
+				serv.serve(serv.conns[0])
+			}()
+			sessionHandler.EXPECT().CloseGracefully(gomock.Any())
+			sessionHandler.EXPECT().Close().AnyTimes()
+			Expect(serv.CloseGracefully(time.Minute)).To(Succeed())
+			sessionHandler.EXPECT().Get(connID)
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, firstPacket)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = serv.Accept()
+			Expect(err).To(MatchError(errServerClosing))
+		})
+
 		It("ignores packets for closed sessions", func() {
 			sessionHandler.EXPECT().Get(connID).Return(nil, true)
-			err := serv.handlePacket(nil, firstPacket)
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, firstPacket)
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -273,7 +611,7 @@ var _ = Describe("Server", func() {
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
-				serv.serve()
+				serv.serve(serv.conns[0])
 				close(done)
 			}()
 			_, err := serv.Accept()
@@ -291,14 +629,14 @@ var _ = Describe("Server", func() {
 			data := []byte{0x09, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6}
 			utils.BigEndian.WriteUint32(b, uint32(protocol.SupportedVersions[0]+1))
 			data = append(append(data, b.Bytes()...), 0x01)
-			err := serv.handlePacket(nil, data)
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, data)
 			Expect(err).ToNot(HaveOccurred())
 			// if we didn't ignore the packet, the server would try to send a version negotiation packet, which would make the test panic because it doesn't have a udpConn
 			Expect(conn.dataWritten.Bytes()).To(BeEmpty())
 		})
 
 		It("errors on invalid public header", func() {
-			err := serv.handlePacket(nil, nil)
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, nil)
 			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.InvalidPacketHeader))
 		})
 
@@ -314,7 +652,7 @@ var _ = Describe("Server", func() {
 				Version:          versionIETFFrames,
 			}
 			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-			err := serv.handlePacket(nil, append(b.Bytes(), make([]byte, 456)...))
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, append(b.Bytes(), make([]byte, 456)...))
 			Expect(err).To(MatchError("packet payload (456 bytes) is smaller than the expected payload length (1000 bytes)"))
 		})
 
@@ -336,7 +674,28 @@ var _ = Describe("Server", func() {
 			}
 			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
 			sessionHandler.EXPECT().Get(connID).Return(sess, true)
-			err := serv.handlePacket(nil, append(b.Bytes(), make([]byte, 456)...))
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, append(b.Bytes(), make([]byte, 456)...))
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("passes retransmissions of Initial packets to the existing session", func() {
+			sess := NewMockPacketHandler(mockCtrl)
+			sess.EXPECT().handlePacket(gomock.Any()).Do(func(packet *receivedPacket) {
+				Expect(packet.header.Type).To(Equal(protocol.PacketTypeInitial))
+			})
+			serv.supportsTLS = true
+			b := &bytes.Buffer{}
+			hdr := &wire.Header{
+				IsLongHeader:     true,
+				Type:             protocol.PacketTypeInitial,
+				PayloadLen:       protocol.MinInitialPacketSize,
+				SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				DestConnectionID: connID,
+				Version:          versionIETFFrames,
+			}
+			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
+			sessionHandler.EXPECT().Get(connID).Return(sess, true).Times(2)
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, append(b.Bytes(), make([]byte, protocol.MinInitialPacketSize)...))
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -352,12 +711,12 @@ var _ = Describe("Server", func() {
 				Version:          versionIETFFrames,
 			}
 			Expect(hdr.Write(b, protocol.PerspectiveClient, versionIETFFrames)).To(Succeed())
-			err := serv.handlePacket(nil, append(b.Bytes(), make([]byte, 456)...))
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, append(b.Bytes(), make([]byte, 456)...))
 			Expect(err).To(MatchError("Received unsupported packet type: Retry"))
 		})
 
 		It("ignores Public Resets", func() {
-			err := serv.handlePacket(nil, wire.WritePublicReset(connID, 1, 1337))
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, wire.WritePublicReset(connID, 1, 1337))
 			Expect(err).ToNot(HaveOccurred())
 		})
 
@@ -373,9 +732,9 @@ var _ = Describe("Server", func() {
 			}
 			hdr.Write(b, protocol.PerspectiveClient, 13 /* not a valid QUIC version */)
 			b.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize)) // add a fake CHLO
-			serv.conn = conn
+			serv.conns = []rawConn{wrapConn(conn)}
 			sessionHandler.EXPECT().Get(connID)
-			err := serv.handlePacket(nil, b.Bytes())
+			err := serv.handlePacket(serv.conns[0], nil, protocol.ECNNon, b.Bytes())
 			Expect(conn.dataWritten.Bytes()).ToNot(BeEmpty())
 			Expect(err).ToNot(HaveOccurred())
 		})
@@ -391,9 +750,9 @@ var _ = Describe("Server", func() {
 			}
 			hdr.Write(b, protocol.PerspectiveClient, 13 /* not a valid QUIC version */)
 			b.Write(bytes.Repeat([]byte{0}, protocol.MinClientHelloSize-1)) // this packet is 1 byte too small
-			serv.conn = conn
+			serv.conns = []rawConn{wrapConn(conn)}
 			sessionHandler.EXPECT().Get(connID)
-			err := serv.handlePacket(udpAddr, b.Bytes())
+			err := serv.handlePacket(serv.conns[0], udpAddr, protocol.ECNNon, b.Bytes())
 			Expect(err).To(MatchError("dropping small packet with unknown version"))
 			Expect(conn.dataWritten.Len()).Should(BeZero())
 		})
@@ -427,6 +786,18 @@ var _ = Describe("Server", func() {
 		Expect(err).To(MatchError("0x1234 is not a valid QUIC version"))
 	})
 
+	It("errors when the Config contains an invalid connection ID length", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{ConnectionIDLength: 3})
+		Expect(err).To(MatchError("invalid connection ID length: 3 bytes"))
+		_, err = Listen(conn, &tls.Config{}, &Config{ConnectionIDLength: 19})
+		Expect(err).To(MatchError("invalid connection ID length: 19 bytes"))
+	})
+
+	It("doesn't use zero-length connection IDs", func() {
+		_, err := Listen(conn, &tls.Config{}, &Config{ConnectionIDLength: -1})
+		Expect(err).To(MatchError("zero-length connection IDs are only supported by clients"))
+	})
+
 	It("fills in default values if options are not set in the Config", func() {
 		ln, err := Listen(conn, &tls.Config{}, &Config{})
 		Expect(err).ToNot(HaveOccurred())
@@ -436,6 +807,12 @@ var _ = Describe("Server", func() {
 		Expect(server.config.IdleTimeout).To(Equal(protocol.DefaultIdleTimeout))
 		Expect(reflect.ValueOf(server.config.AcceptCookie)).To(Equal(reflect.ValueOf(defaultAcceptCookie)))
 		Expect(server.config.KeepAlive).To(BeFalse())
+		Expect(server.config.ConnectionIDLength).To(Equal(protocol.DefaultConnectionIDLength))
+		Expect(server.config.AcceptConnection).To(BeNil())
+		Expect(server.config.MaxIncomingConnections).To(BeZero())
+		Expect(server.config.MaxHandshakesPerIP).To(BeZero())
+		Expect(server.config.MaxConnectionRate).To(BeZero())
+		Expect(server.config.Max0RTTData).To(Equal(protocol.DefaultMax0RTTData))
 	})
 
 	It("listens on a given address", func() {
@@ -446,6 +823,26 @@ var _ = Describe("Server", func() {
 		Expect(serv.Addr().String()).To(Equal(addr))
 	})
 
+	It("listens on multiple sockets using SO_REUSEPORT", func() {
+		if runtime.GOOS != "linux" {
+			Skip("SO_REUSEPORT is only supported on Linux")
+		}
+		ln, err := ListenAddrReusePort("127.0.0.1:0", 4, nil, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		serv := ln.(*server)
+		Expect(serv.conns).To(HaveLen(4))
+		Expect(serv.Addr().(*net.UDPAddr).Port).ToNot(BeZero())
+		for _, c := range serv.conns {
+			Expect(c.LocalAddr()).To(Equal(serv.Addr()))
+		}
+	})
+
+	It("errors if the number of sockets is invalid", func() {
+		_, err := ListenAddrReusePort("127.0.0.1:0", 0, nil, config)
+		Expect(err).To(MatchError("invalid number of sockets: 0"))
+	})
+
 	It("errors if given an invalid address", func() {
 		addr := "127.0.0.1"
 		_, err := ListenAddr(addr, nil, config)
@@ -485,7 +882,7 @@ var _ = Describe("Server", func() {
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		packet, err := wire.ParseHeaderSentByServer(r)
+		packet, err := wire.ParseHeaderSentByServer(r, protocol.DefaultConnectionIDLength)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.VersionFlag).To(BeTrue())
 		Expect(packet.DestConnectionID).To(Equal(connID))
@@ -528,7 +925,7 @@ var _ = Describe("Server", func() {
 		Eventually(func() int { return conn.dataWritten.Len() }).ShouldNot(BeZero())
 		Expect(conn.dataWrittenTo).To(Equal(udpAddr))
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		packet, err := wire.ParseHeaderSentByServer(r)
+		packet, err := wire.ParseHeaderSentByServer(r, protocol.DefaultConnectionIDLength)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(packet.IsVersionNegotiation).To(BeTrue())
 		Expect(packet.DestConnectionID).To(Equal(connID))
@@ -583,6 +980,21 @@ var _ = Describe("Server", func() {
 		Consistently(func() int { return conn.dataWritten.Len() }).Should(BeZero())
 	})
 
+	It("traces packets for unknown connections", func() {
+		tracer := NewMockTracer(mockCtrl)
+		config.Tracer = tracer
+		traced := make(chan struct{})
+		tracer.EXPECT().DroppedPacket(udpAddr, PacketDropUnknownConnectionID, protocol.ByteCount(10)).Do(func(net.Addr, PacketDropReason, protocol.ByteCount) {
+			close(traced)
+		})
+		conn.dataReadFrom = udpAddr
+		conn.dataToRead <- []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}
+		ln, err := Listen(conn, nil, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer ln.Close()
+		Eventually(traced).Should(BeClosed())
+	})
+
 	It("sends a PublicReset for new connections that don't have the VersionFlag set", func() {
 		conn.dataReadFrom = udpAddr
 		conn.dataToRead <- []byte{0x08, 0x4c, 0xfa, 0x9f, 0x9b, 0x66, 0x86, 0x19, 0xf6, 0x01}
@@ -1,14 +1,17 @@
 package quic
 
 import (
+	"bytes"
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"time"
 
-	"github.com/bifurcation/mint"
 	"github.com/wangjiezhe/quic-go/internal/crypto"
 	"github.com/wangjiezhe/quic-go/internal/handshake"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
 	"github.com/wangjiezhe/quic-go/internal/utils"
 	"github.com/wangjiezhe/quic-go/internal/wire"
@@ -25,34 +28,41 @@ func (n *nullAEAD) OpenHandshake(dst, src []byte, packetNumber protocol.PacketNu
 	return n.aead.Open(dst, src, packetNumber, associatedData)
 }
 
+func (n *nullAEAD) Open0RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error) {
+	return nil, errors.New("no 0-RTT keys")
+}
+
 func (n *nullAEAD) Open1RTT(dst, src []byte, packetNumber protocol.PacketNumber, associatedData []byte) ([]byte, error) {
 	return nil, errors.New("no 1-RTT keys")
 }
 
 type tlsSession struct {
 	connID protocol.ConnectionID
-	sess   packetHandler
+	// origConnID is the connection ID chosen by the client.
+	// The client uses it for retransmissions of its Initial packet, and for 0-RTT packets.
+	origConnID protocol.ConnectionID
+	sess       packetHandler
 }
 
 type serverTLS struct {
-	conn              net.PacketConn
 	config            *Config
 	supportedVersions []protocol.VersionNumber
 	mintConf          *mint.Config
 	params            *handshake.TransportParameters
-	newMintConn       func(*handshake.CryptoStreamConn, protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error)
+	newMintConn       func(*handshake.CryptoStreamConn, *handshake.TransportParameters, protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error)
+	cookieGenerator   *handshake.CookieGenerator
 
 	sessionRunner sessionRunner
+	connLimiter   *connLimiter
 	sessionChan   chan<- tlsSession
 
 	logger utils.Logger
 }
 
 func newServerTLS(
-	conn net.PacketConn,
 	config *Config,
 	runner sessionRunner,
-	cookieHandler *handshake.CookieHandler,
+	connLimiter *connLimiter,
 	tlsConf *tls.Config,
 	logger utils.Logger,
 ) (*serverTLS, <-chan tlsSession, error) {
@@ -60,21 +70,29 @@ func newServerTLS(
 	if err != nil {
 		return nil, nil, err
 	}
-	mconf.RequireCookie = true
-	cs, err := mint.NewDefaultCookieProtector()
+	cookieGenerator, err := handshake.NewCookieGenerator()
 	if err != nil {
 		return nil, nil, err
 	}
-	mconf.CookieProtector = cs
-	mconf.CookieHandler = cookieHandler
+	mconf.SendSessionTickets = true
+	mconf.TicketLifetime = uint32(protocol.SessionTicketLifetime / time.Second)
+	// Every session ticket is only accepted once, so 0-RTT data can't be replayed in another connection.
+	mconf.PSKs = newServerPSKCache()
+	// 0-RTT data is sent in 0-RTT packets, not in the TLS records
+	mconf.ExternalEarlyData = true
+	if config.Allow0RTT {
+		mconf.AllowEarlyData = true
+		mconf.MaxEarlyDataSize = uint32(utils.MinByteCount(config.Max0RTTData, math.MaxUint32))
+	}
 
 	sessionChan := make(chan tlsSession)
 	s := &serverTLS{
-		conn:              conn,
 		config:            config,
 		supportedVersions: config.Versions,
 		mintConf:          mconf,
+		cookieGenerator:   cookieGenerator,
 		sessionRunner:     runner,
+		connLimiter:       connLimiter,
 		sessionChan:       sessionChan,
 		params: &handshake.TransportParameters{
 			StreamFlowControlWindow:     protocol.ReceiveStreamFlowControlWindow,
@@ -85,36 +103,78 @@ func newServerTLS(
 		},
 		logger: logger,
 	}
+	if config.EnableDatagrams {
+		s.params.MaxDatagramFrameSize = protocol.MaxDatagramFrameSize
+	}
 	s.newMintConn = s.newMintConnImpl
 	return s, sessionChan, nil
 }
 
-func (s *serverTLS) HandleInitial(remoteAddr net.Addr, hdr *wire.Header, data []byte) {
+// HandleInitial handles an Initial packet that was received on pconn.
+// All replies are sent on the same socket.
+func (s *serverTLS) HandleInitial(pconn rawConn, remoteAddr net.Addr, hdr *wire.Header, data []byte) {
 	// TODO: add a check that DestConnID == SrcConnID
 	s.logger.Debugf("Received a Packet. Handling it statelessly.")
-	sess, connID, err := s.handleInitialImpl(remoteAddr, hdr, data)
+	sess, err := s.handleInitialImpl(pconn, remoteAddr, hdr, data)
 	if err != nil {
 		s.logger.Errorf("Error occurred handling initial packet: %s", err)
 		return
 	}
-	if sess == nil { // a stateless reset was done
+	if sess == nil { // a Retry was sent, or the packet was dropped
 		return
 	}
-	s.sessionChan <- tlsSession{
-		connID: connID,
-		sess:   sess,
-	}
+	s.sessionChan <- *sess
 }
 
 // will be set to s.newMintConn by the constructor
-func (s *serverTLS) newMintConnImpl(bc *handshake.CryptoStreamConn, v protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
-	extHandler := handshake.NewExtensionHandlerServer(s.params, s.config.Versions, v, s.logger)
+func (s *serverTLS) newMintConnImpl(bc *handshake.CryptoStreamConn, params *handshake.TransportParameters, v protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
+	extHandler := handshake.NewExtensionHandlerServer(params, s.config.Versions, v, s.logger)
 	conf := s.mintConf.Clone()
 	conf.ExtensionHandler = extHandler
 	return newMintController(bc, conf, protocol.PerspectiveServer), extHandler.GetPeerParams(), nil
 }
 
-func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, clientHdr *wire.Header, aead crypto.AEAD, closeErr error) error {
+// sendRetry sends a Retry packet containing a token.
+// The client has to send this token in its next Initial packet, thereby proving ownership of its address.
+func (s *serverTLS) sendRetry(pconn rawConn, remoteAddr net.Addr, clientHdr *wire.Header) error {
+	token, err := s.cookieGenerator.NewToken(remoteAddr)
+	if err != nil {
+		return err
+	}
+	replyHdr := &wire.Header{
+		IsLongHeader:     true,
+		Type:             protocol.PacketTypeRetry,
+		DestConnectionID: clientHdr.SrcConnectionID,
+		SrcConnectionID:  clientHdr.DestConnectionID,
+		Token:            token,
+		PacketNumber:     clientHdr.PacketNumber, // echo the client's packet number
+		PacketNumberLen:  protocol.PacketNumberLen4,
+		Version:          clientHdr.Version,
+	}
+	buf := &bytes.Buffer{}
+	if err := replyHdr.Write(buf, protocol.PerspectiveServer, clientHdr.Version); err != nil {
+		return err
+	}
+	if s.logger.Debug() {
+		s.logger.Debugf("-> Sending Retry (%d bytes) to %s", buf.Len(), remoteAddr)
+		replyHdr.Log(s.logger)
+	}
+	_, err = pconn.WriteTo(buf.Bytes(), remoteAddr)
+	return err
+}
+
+// acceptToken decides if the token sent by the client is accepted, using the AcceptCookie callback.
+// A token that can't be decoded is treated as if the client didn't send a token.
+func (s *serverTLS) acceptToken(remoteAddr net.Addr, token []byte) bool {
+	cookie, err := s.cookieGenerator.DecodeToken(token)
+	if err != nil {
+		s.logger.Debugf("Couldn't decode token from %s: %s", remoteAddr, err)
+		cookie = nil
+	}
+	return s.config.AcceptCookie(remoteAddr, cookie)
+}
+
+func (s *serverTLS) sendConnectionClose(pconn rawConn, remoteAddr net.Addr, clientHdr *wire.Header, aead crypto.AEAD, closeErr error) error {
 	ccf := &wire.ConnectionCloseFrame{
 		ErrorCode:    qerr.HandshakeFailed,
 		ReasonPhrase: closeErr.Error(),
@@ -131,100 +191,91 @@ func (s *serverTLS) sendConnectionClose(remoteAddr net.Addr, clientHdr *wire.Hea
 	if err != nil {
 		return err
 	}
-	_, err = s.conn.WriteTo(data, remoteAddr)
+	_, err = pconn.WriteTo(data, remoteAddr)
 	return err
 }
 
-func (s *serverTLS) handleInitialImpl(remoteAddr net.Addr, hdr *wire.Header, data []byte) (packetHandler, protocol.ConnectionID, error) {
+func (s *serverTLS) handleInitialImpl(pconn rawConn, remoteAddr net.Addr, hdr *wire.Header, data []byte) (*tlsSession, error) {
 	if len(hdr.Raw)+len(data) < protocol.MinInitialPacketSize {
-		return nil, nil, errors.New("dropping too small Initial packet")
+		return nil, errors.New("dropping too small Initial packet")
 	}
 	// check version, if not matching send VNP
 	if !protocol.IsSupportedVersion(s.supportedVersions, hdr.Version) {
 		s.logger.Debugf("Client offered version %s, sending VersionNegotiationPacket", hdr.Version)
 		vnp, err := wire.ComposeVersionNegotiation(hdr.SrcConnectionID, hdr.DestConnectionID, s.supportedVersions)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		_, err = s.conn.WriteTo(vnp, remoteAddr)
-		return nil, nil, err
+		_, err = pconn.WriteTo(vnp, remoteAddr)
+		return nil, err
 	}
 
 	// unpack packet and check stream frame contents
 	aead, err := crypto.NewNullAEAD(protocol.PerspectiveServer, hdr.DestConnectionID, protocol.VersionTLS)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	frame, err := unpackInitialPacket(aead, hdr, data, s.logger, hdr.Version)
 	if err != nil {
 		s.logger.Debugf("Error unpacking initial packet: %s", err)
-		return nil, nil, nil
+		return nil, nil
+	}
+	if !s.acceptToken(remoteAddr, hdr.Token) {
+		return nil, s.sendRetry(pconn, remoteAddr, hdr)
 	}
-	sess, connID, err := s.handleUnpackedInitial(remoteAddr, hdr, frame, aead)
+	lc, err := s.connLimiter.Admit(remoteAddr, &ClientHelloInfo{Version: hdr.Version, ConnectionID: hdr.DestConnectionID})
 	if err != nil {
-		if ccerr := s.sendConnectionClose(remoteAddr, hdr, aead, err); ccerr != nil {
+		s.logger.Infof("Refusing connection from %v: %s", remoteAddr, err)
+		return nil, s.sendConnectionClose(pconn, remoteAddr, hdr, aead, err)
+	}
+	sess, err := s.handleUnpackedInitial(pconn, remoteAddr, hdr, frame, aead, lc)
+	if err != nil {
+		s.connLimiter.Remove(lc)
+		if ccerr := s.sendConnectionClose(pconn, remoteAddr, hdr, aead, err); ccerr != nil {
 			s.logger.Debugf("Error sending CONNECTION_CLOSE: %s", ccerr)
 		}
-		return nil, nil, err
+		return nil, err
 	}
-	return sess, connID, nil
+	return sess, nil
 }
 
-func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header, frame *wire.StreamFrame, aead crypto.AEAD) (packetHandler, protocol.ConnectionID, error) {
+func (s *serverTLS) handleUnpackedInitial(pconn rawConn, remoteAddr net.Addr, hdr *wire.Header, frame *wire.StreamFrame, aead crypto.AEAD, lc *limitedConn) (*tlsSession, error) {
 	version := hdr.Version
+	// The connection ID is needed to derive the stateless reset token that is sent in the transport parameters.
+	connID, err := generateConnID(s.config.ConnectionIDGenerator)
+	if err != nil {
+		return nil, err
+	}
+	ourParams := *s.params
+	token := s.sessionRunner.getStatelessResetToken(connID)
+	ourParams.StatelessResetToken = &token
 	bc := handshake.NewCryptoStreamConn(remoteAddr)
 	bc.AddDataForReading(frame.Data)
-	tls, paramsChan, err := s.newMintConn(bc, version)
+	tls, paramsChan, err := s.newMintConn(bc, &ourParams, version)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	alert := tls.Handshake()
-	if alert == mint.AlertStatelessRetry {
-		// the HelloRetryRequest was written to the bufferConn
-		// Take that data and write send a Retry packet
-		f := &wire.StreamFrame{
-			StreamID: version.CryptoStreamID(),
-			Data:     bc.GetDataForWriting(),
-		}
-		replyHdr := &wire.Header{
-			IsLongHeader:     true,
-			Type:             protocol.PacketTypeRetry,
-			DestConnectionID: hdr.SrcConnectionID,
-			SrcConnectionID:  hdr.DestConnectionID,
-			PayloadLen:       f.Length(version) + protocol.ByteCount(aead.Overhead()),
-			PacketNumber:     hdr.PacketNumber, // echo the client's packet number
-			Version:          version,
-		}
-		data, err := packUnencryptedPacket(aead, replyHdr, f, protocol.PerspectiveServer, s.logger)
-		if err != nil {
-			return nil, nil, err
-		}
-		_, err = s.conn.WriteTo(data, remoteAddr)
-		return nil, nil, err
-	}
 	if alert != mint.AlertNoAlert {
-		return nil, nil, alert
+		return nil, alert
 	}
 	if tls.State() != mint.StateServerNegotiated {
-		return nil, nil, fmt.Errorf("Expected mint state to be %s, got %s", mint.StateServerNegotiated, tls.State())
+		return nil, fmt.Errorf("Expected mint state to be %s, got %s", mint.StateServerNegotiated, tls.State())
 	}
 	if alert := tls.Handshake(); alert != mint.AlertNoAlert {
-		return nil, nil, alert
+		return nil, alert
 	}
 	if tls.State() != mint.StateServerWaitFlight2 {
-		return nil, nil, fmt.Errorf("Expected mint state to be %s, got %s", mint.StateServerWaitFlight2, tls.State())
+		return nil, fmt.Errorf("Expected mint state to be %s, got %s", mint.StateServerWaitFlight2, tls.State())
 	}
 	params := <-paramsChan
-	connID, err := protocol.GenerateConnectionID()
-	if err != nil {
-		return nil, nil, err
-	}
 	s.logger.Debugf("Changing source connection ID to %s.", connID)
 	sess, err := newTLSServerSession(
-		&conn{pconn: s.conn, currentAddr: remoteAddr},
-		s.sessionRunner,
+		&conn{pconn: pconn, currentAddr: remoteAddr},
+		s.connLimiter.NewSessionRunner(s.sessionRunner, lc, connID),
 		hdr.SrcConnectionID,
 		connID,
+		hdr.DestConnectionID,
 		protocol.PacketNumber(1), // TODO: use a random packet number here
 		s.config,
 		tls,
@@ -235,10 +286,14 @@ func (s *serverTLS) handleUnpackedInitial(remoteAddr net.Addr, hdr *wire.Header,
 		s.logger,
 	)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	cs := sess.getCryptoStream()
 	cs.setReadOffset(frame.DataLen())
 	bc.SetStream(cs)
-	return sess, connID, nil
+	return &tlsSession{
+		connID:     connID,
+		origConnID: hdr.DestConnectionID,
+		sess:       sess,
+	}, nil
 }
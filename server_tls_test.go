@@ -3,10 +3,13 @@ package quic
 import (
 	"bytes"
 	"io"
+	"math"
+	"net"
 
-	"github.com/bifurcation/mint"
+	"github.com/golang/mock/gomock"
 	"github.com/wangjiezhe/quic-go/internal/crypto"
 	"github.com/wangjiezhe/quic-go/internal/handshake"
+	"github.com/wangjiezhe/quic-go/internal/mint"
 	"github.com/wangjiezhe/quic-go/internal/mocks"
 	"github.com/wangjiezhe/quic-go/internal/mocks/handshake"
 	"github.com/wangjiezhe/quic-go/internal/protocol"
@@ -22,33 +25,41 @@ import (
 var _ = Describe("Stateless TLS handling", func() {
 	var (
 		conn        *mockPacketConn
+		config      *Config
 		server      *serverTLS
 		sessionChan <-chan tlsSession
 		mintTLS     *mockhandshake.MockMintTLS
 		extHandler  *mocks.MockTLSExtensionHandler
 		mintReply   io.Writer
+		mintParams  *handshake.TransportParameters
+		runner      *MockSessionRunner
 	)
 
 	BeforeEach(func() {
 		mintTLS = mockhandshake.NewMockMintTLS(mockCtrl)
 		extHandler = mocks.NewMockTLSExtensionHandler(mockCtrl)
+		runner = NewMockSessionRunner(mockCtrl)
 		conn = newMockPacketConn()
-		config := &Config{
-			Versions: []protocol.VersionNumber{protocol.VersionTLS},
-		}
+		config = populateServerConfig(&Config{
+			Versions:     []protocol.VersionNumber{protocol.VersionTLS},
+			AcceptCookie: func(net.Addr, *Cookie) bool { return true },
+		})
 		var err error
-		server, sessionChan, err = newServerTLS(conn, config, nil, nil, testdata.GetTLSConfig(), utils.DefaultLogger)
+		server, sessionChan, err = newServerTLS(config, runner, newConnLimiter(config), testdata.GetTLSConfig(), utils.DefaultLogger)
 		Expect(err).ToNot(HaveOccurred())
-		server.newMintConn = func(bc *handshake.CryptoStreamConn, v protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
+		server.newMintConn = func(bc *handshake.CryptoStreamConn, params *handshake.TransportParameters, v protocol.VersionNumber) (handshake.MintTLS, <-chan handshake.TransportParameters, error) {
 			mintReply = bc
+			mintParams = params
 			return mintTLS, extHandler.GetPeerParams(), nil
 		}
 	})
 
-	getPacket := func(f wire.Frame) (*wire.Header, []byte) {
+	getPacketWithToken := func(f wire.Frame, token []byte) (*wire.Header, []byte) {
 		hdrBuf := &bytes.Buffer{}
 		hdr := &wire.Header{
 			IsLongHeader:     true,
+			Type:             protocol.PacketTypeInitial,
+			Token:            token,
 			DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 			SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
 			PacketNumber:     1,
@@ -69,9 +80,13 @@ var _ = Describe("Stateless TLS handling", func() {
 		return hdr, data
 	}
 
+	getPacket := func(f wire.Frame) (*wire.Header, []byte) {
+		return getPacketWithToken(f, nil)
+	}
+
 	unpackPacket := func(data []byte) (*wire.Header, []byte) {
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		hdr, err := wire.ParseHeaderSentByServer(r)
+		hdr, err := wire.ParseHeaderSentByServer(r, protocol.DefaultConnectionIDLength)
 		Expect(err).ToNot(HaveOccurred())
 		hdr.Raw = data[:len(data)-r.Len()]
 		aead, err := crypto.NewNullAEAD(protocol.PerspectiveClient, hdr.SrcConnectionID, protocol.VersionTLS)
@@ -87,9 +102,9 @@ var _ = Describe("Stateless TLS handling", func() {
 			SrcConnectionID:  protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
 			Version:          0x1337,
 		}
-		server.HandleInitial(nil, hdr, bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize))
+		server.HandleInitial(wrapConn(conn), nil, hdr, bytes.Repeat([]byte{0}, protocol.MinInitialPacketSize))
 		Expect(conn.dataWritten.Len()).ToNot(BeZero())
-		hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()))
+		hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()), protocol.DefaultConnectionIDLength)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.IsVersionNegotiation).To(BeTrue())
 		Expect(sessionChan).ToNot(Receive())
@@ -98,42 +113,96 @@ var _ = Describe("Stateless TLS handling", func() {
 	It("drops too small packets", func() {
 		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
 		data = data[:len(data)-1] // the packet is now 1 byte too small
-		server.HandleInitial(nil, hdr, data)
+		server.HandleInitial(wrapConn(conn), nil, hdr, data)
 		Expect(conn.dataWritten.Len()).To(BeZero())
 	})
 
 	It("ignores packets with invalid contents", func() {
 		hdr, data := getPacket(&wire.StreamFrame{StreamID: 10, Offset: 11, Data: []byte("foobar")})
-		server.HandleInitial(nil, hdr, data)
+		server.HandleInitial(wrapConn(conn), nil, hdr, data)
 		Expect(conn.dataWritten.Len()).To(BeZero())
 		Expect(sessionChan).ToNot(Receive())
 	})
 
 	It("replies with a Retry packet, if a Cookie is required", func() {
-		extHandler.EXPECT().GetPeerParams()
-		mintTLS.EXPECT().Handshake().Return(mint.AlertStatelessRetry).Do(func() {
-			mintReply.Write([]byte("Retry with this Cookie"))
-		})
+		var cookies []*Cookie
+		config.AcceptCookie = func(_ net.Addr, cookie *Cookie) bool {
+			cookies = append(cookies, cookie)
+			return false
+		}
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
 		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
-		server.HandleInitial(nil, hdr, data)
+		server.HandleInitial(wrapConn(conn), remoteAddr, hdr, data)
+		Expect(cookies).To(Equal([]*Cookie{nil}))
 		Expect(conn.dataWritten.Len()).ToNot(BeZero())
 		r := bytes.NewReader(conn.dataWritten.Bytes())
-		replyHdr, err := wire.ParseHeaderSentByServer(r)
+		replyHdr, err := wire.ParseHeaderSentByServer(r, protocol.DefaultConnectionIDLength)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
 		Expect(replyHdr.SrcConnectionID).To(Equal(hdr.DestConnectionID))
 		Expect(replyHdr.DestConnectionID).To(Equal(hdr.SrcConnectionID))
-		Expect(replyHdr.PayloadLen).To(BeEquivalentTo(r.Len()))
+		Expect(replyHdr.PacketNumber).To(Equal(hdr.PacketNumber))
+		Expect(r.Len()).To(BeZero())
+		cookie, err := server.cookieGenerator.DecodeToken(replyHdr.Token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cookie.RemoteAddr).To(Equal("192.168.13.37"))
+		Expect(sessionChan).ToNot(Receive())
+	})
+
+	It("passes the decoded token to AcceptCookie", func() {
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+		token, err := server.cookieGenerator.NewToken(remoteAddr)
+		Expect(err).ToNot(HaveOccurred())
+		cookieChan := make(chan *Cookie, 1)
+		config.AcceptCookie = func(_ net.Addr, cookie *Cookie) bool {
+			cookieChan <- cookie
+			return true
+		}
+		runner.EXPECT().getStatelessResetToken(gomock.Any())
+		mintTLS.EXPECT().Handshake().Return(mint.AlertNoAlert).Times(2)
+		mintTLS.EXPECT().State().Return(mint.StateServerNegotiated)
+		mintTLS.EXPECT().State().Return(mint.StateServerWaitFlight2)
+		mintTLS.EXPECT().EarlyExporter()
+		paramsChan := make(chan handshake.TransportParameters, 1)
+		paramsChan <- handshake.TransportParameters{}
+		extHandler.EXPECT().GetPeerParams().Return(paramsChan)
+		hdr, data := getPacketWithToken(&wire.StreamFrame{Data: []byte("Client Hello")}, token)
+		go server.HandleInitial(wrapConn(conn), remoteAddr, hdr, data)
+		Eventually(sessionChan).Should(Receive())
+		var cookie *Cookie
+		Expect(cookieChan).To(Receive(&cookie))
+		Expect(cookie).ToNot(BeNil())
+		Expect(cookie.RemoteAddr).To(Equal("192.168.13.37"))
+		// no Retry was sent
+		Expect(conn.dataWritten.Len()).To(BeZero())
+	})
+
+	It("sends a Retry, if the token can't be decoded", func() {
+		var cookies []*Cookie
+		config.AcceptCookie = func(_ net.Addr, cookie *Cookie) bool {
+			cookies = append(cookies, cookie)
+			return cookie != nil
+		}
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1337}
+		hdr, data := getPacketWithToken(&wire.StreamFrame{Data: []byte("Client Hello")}, []byte("invalid token"))
+		server.HandleInitial(wrapConn(conn), remoteAddr, hdr, data)
+		Expect(cookies).To(Equal([]*Cookie{nil}))
+		replyHdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(conn.dataWritten.Bytes()), protocol.DefaultConnectionIDLength)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
+		Expect(replyHdr.Token).ToNot(BeEmpty())
 		Expect(sessionChan).ToNot(Receive())
 	})
 
 	It("replies with a Handshake packet and creates a session, if no Cookie is required", func() {
+		runner.EXPECT().getStatelessResetToken(gomock.Any())
 		mintTLS.EXPECT().Handshake().Return(mint.AlertNoAlert).Do(func() {
 			mintReply.Write([]byte("Server Hello"))
 		})
 		mintTLS.EXPECT().Handshake().Return(mint.AlertNoAlert)
 		mintTLS.EXPECT().State().Return(mint.StateServerNegotiated)
 		mintTLS.EXPECT().State().Return(mint.StateServerWaitFlight2)
+		mintTLS.EXPECT().EarlyExporter()
 		paramsChan := make(chan handshake.TransportParameters, 1)
 		paramsChan <- handshake.TransportParameters{}
 		extHandler.EXPECT().GetPeerParams().Return(paramsChan)
@@ -141,7 +210,7 @@ var _ = Describe("Stateless TLS handling", func() {
 		done := make(chan struct{})
 		go func() {
 			defer GinkgoRecover()
-			server.HandleInitial(nil, hdr, data)
+			server.HandleInitial(wrapConn(conn), nil, hdr, data)
 			// the Handshake packet is written by the session
 			Expect(conn.dataWritten.Len()).To(BeZero())
 			close(done)
@@ -151,14 +220,126 @@ var _ = Describe("Stateless TLS handling", func() {
 		// make sure we're using a server-generated connection ID
 		Expect(tlsSess.connID).ToNot(Equal(hdr.SrcConnectionID))
 		Expect(tlsSess.connID).ToNot(Equal(hdr.DestConnectionID))
+		// retransmissions of the Initial are passed to this session
+		Expect(tlsSess.origConnID).To(Equal(hdr.DestConnectionID))
 		Eventually(done).Should(BeClosed())
 	})
 
+	It("issues session tickets, and only allows 0-RTT if configured", func() {
+		Expect(server.mintConf.SendSessionTickets).To(BeTrue())
+		Expect(server.mintConf.PSKs).To(BeAssignableToTypeOf(&serverPSKCache{}))
+		Expect(server.mintConf.AllowEarlyData).To(BeFalse())
+		config.Allow0RTT = true
+		server, _, err := newServerTLS(config, runner, newConnLimiter(config), testdata.GetTLSConfig(), utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.mintConf.AllowEarlyData).To(BeTrue())
+		Expect(server.mintConf.MaxEarlyDataSize).To(BeEquivalentTo(protocol.DefaultMax0RTTData))
+	})
+
+	It("limits the amount of 0-RTT data announced in the session tickets", func() {
+		config.Allow0RTT = true
+		config.Max0RTTData = 1 << 40
+		server, _, err := newServerTLS(config, runner, newConnLimiter(config), testdata.GetTLSConfig(), utils.DefaultLogger)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(server.mintConf.MaxEarlyDataSize).To(Equal(uint32(math.MaxUint32)))
+	})
+
+	It("uses the ConnectionIDGenerator for the server's connection ID", func() {
+		connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x42}
+		config.ConnectionIDGenerator = &fixedConnIDGenerator{connID: connID, length: 5}
+		runner.EXPECT().getStatelessResetToken(connID)
+		mintTLS.EXPECT().Handshake().Return(mint.AlertNoAlert).Times(2)
+		mintTLS.EXPECT().State().Return(mint.StateServerNegotiated)
+		mintTLS.EXPECT().State().Return(mint.StateServerWaitFlight2)
+		mintTLS.EXPECT().EarlyExporter()
+		paramsChan := make(chan handshake.TransportParameters, 1)
+		paramsChan <- handshake.TransportParameters{}
+		extHandler.EXPECT().GetPeerParams().Return(paramsChan)
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		go server.HandleInitial(wrapConn(conn), nil, hdr, data)
+		var tlsSess tlsSession
+		Eventually(sessionChan).Should(Receive(&tlsSess))
+		Expect(tlsSess.connID).To(Equal(connID))
+	})
+
+	It("traces the session using the client's original destination connection ID", func() {
+		tracer := NewMockTracer(mockCtrl)
+		config.Tracer = tracer
+		runner.EXPECT().getStatelessResetToken(gomock.Any())
+		mintTLS.EXPECT().Handshake().Return(mint.AlertNoAlert).Times(2)
+		mintTLS.EXPECT().State().Return(mint.StateServerNegotiated)
+		mintTLS.EXPECT().State().Return(mint.StateServerWaitFlight2)
+		mintTLS.EXPECT().EarlyExporter()
+		paramsChan := make(chan handshake.TransportParameters, 1)
+		paramsChan <- handshake.TransportParameters{}
+		extHandler.EXPECT().GetPeerParams().Return(paramsChan)
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		tracer.EXPECT().TracerForConnection(protocol.PerspectiveServer, hdr.DestConnectionID)
+		go server.HandleInitial(wrapConn(conn), nil, hdr, data)
+		Eventually(sessionChan).Should(Receive())
+	})
+
+	It("sends the stateless reset token for the server's connection ID", func() {
+		connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0x42}
+		config.ConnectionIDGenerator = &fixedConnIDGenerator{connID: connID, length: 5}
+		token := [16]byte{0xde, 0xad, 0xbe, 0xef}
+		runner.EXPECT().getStatelessResetToken(connID).Return(token)
+		mintTLS.EXPECT().Handshake().Return(mint.AlertNoAlert).Times(2)
+		mintTLS.EXPECT().State().Return(mint.StateServerNegotiated)
+		mintTLS.EXPECT().State().Return(mint.StateServerWaitFlight2)
+		mintTLS.EXPECT().EarlyExporter()
+		paramsChan := make(chan handshake.TransportParameters, 1)
+		paramsChan <- handshake.TransportParameters{}
+		extHandler.EXPECT().GetPeerParams().Return(paramsChan)
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		go server.HandleInitial(wrapConn(conn), nil, hdr, data)
+		Eventually(sessionChan).Should(Receive())
+		Expect(mintParams.StatelessResetToken).To(Equal(&token))
+		// the token is only set for this connection
+		Expect(server.params.StatelessResetToken).To(BeNil())
+	})
+
+	It("sends a CONNECTION_CLOSE, if the connection is refused", func() {
+		remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+		var info *ClientHelloInfo
+		server.connLimiter = newConnLimiter(&Config{
+			AcceptConnection: func(addr net.Addr, i *ClientHelloInfo) bool {
+				Expect(addr).To(Equal(remoteAddr))
+				info = i
+				return false
+			},
+		})
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		server.HandleInitial(wrapConn(conn), remoteAddr, hdr, data)
+		Expect(info).To(Equal(&ClientHelloInfo{Version: protocol.VersionTLS, ConnectionID: hdr.DestConnectionID}))
+		Expect(sessionChan).ToNot(Receive())
+		Expect(conn.dataWrittenTo).To(Equal(remoteAddr))
+		replyHdr, data := unpackPacket(conn.dataWritten.Bytes())
+		Expect(replyHdr.Type).To(Equal(protocol.PacketTypeHandshake))
+		frame, err := wire.ParseNextFrame(bytes.NewReader(data), nil, protocol.VersionTLS)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(frame).To(BeAssignableToTypeOf(&wire.ConnectionCloseFrame{}))
+		ccf := frame.(*wire.ConnectionCloseFrame)
+		Expect(ccf.ErrorCode).To(Equal(qerr.HandshakeFailed))
+		Expect(ccf.ReasonPhrase).To(Equal(errConnectionRefused.Error()))
+	})
+
+	It("releases the connection slot, if mint returns an error", func() {
+		server.connLimiter = newConnLimiter(&Config{MaxIncomingConnections: 1})
+		runner.EXPECT().getStatelessResetToken(gomock.Any())
+		mintTLS.EXPECT().Handshake().Return(mint.AlertAccessDenied)
+		extHandler.EXPECT().GetPeerParams()
+		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
+		server.HandleInitial(wrapConn(conn), nil, hdr, data)
+		Expect(server.connLimiter.numConnections).To(BeZero())
+	})
+
 	It("sends a CONNECTION_CLOSE, if mint returns an error", func() {
+		runner.EXPECT().getStatelessResetToken(gomock.Any())
 		mintTLS.EXPECT().Handshake().Return(mint.AlertAccessDenied)
 		extHandler.EXPECT().GetPeerParams()
 		hdr, data := getPacket(&wire.StreamFrame{Data: []byte("Client Hello")})
-		server.HandleInitial(nil, hdr, data)
+		server.HandleInitial(wrapConn(conn), nil, hdr, data)
 		// the Handshake packet is written by the session
 		Expect(conn.dataWritten.Bytes()).ToNot(BeEmpty())
 		// unpack the packet to check that it actually contains a CONNECTION_CLOSE
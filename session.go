@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/wangjiezhe/quic-go/internal/ackhandler"
@@ -40,8 +41,12 @@ type streamManager interface {
 	AcceptStream() (Stream, error)
 	AcceptUniStream() (ReceiveStream, error)
 	DeleteStream(protocol.StreamID) error
+	// NumStreams returns the number of streams that have not completed yet.
+	NumStreams() int
 	UpdateLimits(*handshake.TransportParameters)
 	HandleMaxStreamIDFrame(*wire.MaxStreamIDFrame) error
+	// StopIssuingMaxStreamID stops raising the limits for streams opened by the peer.
+	StopIssuingMaxStreamID()
 	CloseWithError(error)
 }
 
@@ -58,7 +63,14 @@ type receivedPacket struct {
 	remoteAddr net.Addr
 	header     *wire.Header
 	data       []byte
+	ecn        protocol.ECN
 	rcvTime    time.Time
+	// the socket the packet was received on
+	// It is only set by the server, which might read from multiple sockets.
+	rcvConn rawConn
+	// the path the packet was received on
+	// It is only set by the client, which also reads from the new path during a connection migration.
+	rcvPath connection
 }
 
 var (
@@ -66,23 +78,88 @@ var (
 	newCryptoSetupClient = handshake.NewCryptoSetupClient
 )
 
+var errPeerGoingAway = qerr.Error(qerr.PeerGoingAway, "peer sent a GOAWAY frame")
+
+// streamPeerGoingAway is the gQUIC RST_STREAM error code (QUIC_STREAM_PEER_GOING_AWAY)
+// used to refuse streams that the peer opened after we sent a GOAWAY frame.
+const streamPeerGoingAway protocol.ApplicationErrorCode = 7
+
 type closeError struct {
 	err    error
 	remote bool
 }
 
+// A pathValidation is the validation of a new path.
+// A client validates a new path when MigrateTo is called.
+// A server validates a new address of the client, when the client migrated (e.g. due to a NAT rebinding).
+// The same PATH_CHALLENGE data is used for all PATH_CHALLENGE frames sent on the path.
+type pathValidation struct {
+	conn      connection
+	challenge [8]byte
+	// connID is the destination connection ID used on the new path, and connIDSeq its sequence number
+	connID    protocol.ConnectionID
+	connIDSeq uint64
+
+	numChallengesSent int
+	nextChallenge     time.Time
+
+	// The following fields are only used when validating a new address of the peer.
+	// previousAddr is the last validated address of the peer. We return to it if the validation fails.
+	previousAddr net.Addr
+	// previousConnID is the connection ID used on the previous address, if we switched to a new one.
+	// It is retired when the validation succeeds, and used again if it fails.
+	previousConnID    protocol.ConnectionID
+	previousConnIDSeq uint64
+	// Until the new address is validated, we send at most protocol.AmplificationFactor times the number of bytes received from it.
+	bytesReceived protocol.ByteCount
+	bytesSent     protocol.ByteCount
+
+	// done receives the result of the path validation.
+	// It is nil when validating a new address of the peer.
+	done chan error
+}
+
+// fail reports that a path validation started by MigrateTo failed.
+// The new path is not closed, since the net.PacketConn was passed in by the application.
+func (pv *pathValidation) fail(err error) {
+	if pv.done == nil {
+		return
+	}
+	pv.done <- err
+}
+
+// A pathError is an error reading from a path added by MigrateTo.
+type pathError struct {
+	conn connection
+	err  error
+}
+
 // A Session is a QUIC session
 type session struct {
 	sessionRunner sessionRunner
 
 	destConnID protocol.ConnectionID
-	srcConnID  protocol.ConnectionID
+	// destConnIDSeq is the sequence number of destConnID. It is 0 for the connection ID used during the handshake.
+	destConnIDSeq uint64
+	srcConnID     protocol.ConnectionID
+	// origDestConnID is the connection ID that the client chose for its first packet
+	origDestConnID protocol.ConnectionID
+	// issuedConnIDs are the connection IDs issued to the peer in NEW_CONNECTION_ID frames
+	issuedConnIDs []protocol.ConnectionID
+	// peerConnIDs are the connection IDs issued by the peer
+	peerConnIDs *connIDManager
+	// probeConnID is the connection ID used to answer probing packets received from probeAddr
+	probeAddr   net.Addr
+	probeConnID *wire.NewConnectionIDFrame
 
 	perspective protocol.Perspective
 	version     protocol.VersionNumber
 	config      *Config
 
-	conn connection
+	// conn is replaced by the run loop when the connection is migrated.
+	// It is protected by the connMutex when accessed from other goroutines.
+	conn      connection
+	connMutex sync.RWMutex
 
 	streamsMap   streamManager
 	cryptoStream cryptoStreamI
@@ -94,20 +171,50 @@ type session struct {
 	streamFramer          *streamFramer
 	windowUpdateQueue     *windowUpdateQueue
 	connFlowController    flowcontrol.ConnectionFlowController
+	// datagramQueue is nil if DATAGRAM frames are not supported
+	datagramQueue *datagramQueue
+	// mtuDiscoverer is nil if path MTU discovery is disabled
+	mtuDiscoverer *mtuDiscoverer
 
 	unpacker unpacker
 	packer   *packetPacker
+	// During a send burst, packets are queued, and written in a single batch, see sendPackets.
+	batchPackets bool
+	packetBatch  []*packedPacket
 
 	cryptoStreamHandler cryptoStreamHandler
 
 	receivedPackets  chan *receivedPacket
 	sendingScheduled chan struct{}
+	// statsRequests is used to request a snapshot of the connection statistics from the run loop.
+	statsRequests chan chan<- ConnectionStats
+	// pathValidationRequests is used to start the validation of a new path from the run loop.
+	pathValidationRequests chan *pathValidation
+	// pathErrors receives the errors reading from paths added by MigrateTo
+	pathErrors chan pathError
+	// pathValidation is the path validation that is currently in progress, if any
+	pathValidation    *pathValidation
+	sentPathChallenge bool
+	// goAwayRequests is used to start a graceful shutdown from the run loop.
+	goAwayRequests chan time.Time
+	// goAwayDeadline is set when the session is shutting down gracefully.
+	// The session is closed when all streams have completed, or when the deadline is reached.
+	goAwayDeadline time.Time
+	// largestPeerStreamID is the largest ID of a stream opened by the peer.
+	// It is sent in the GOAWAY frame (gQUIC only).
+	largestPeerStreamID protocol.StreamID
+	// peerGoingAway is set when a GOAWAY frame is received.
+	// No new streams can be opened after that.
+	peerGoingAway utils.AtomicBool
 	// closeChan is used to notify the run loop that it should terminate.
 	closeChan chan closeError
 	closeOnce sync.Once
 
 	ctx       context.Context
 	ctxCancel context.CancelFunc
+	// handshakeCtx is cancelled when the handshake completes
+	handshakeCtx       context.Context
+	handshakeCtxCancel context.CancelFunc
 
 	// when we receive too many undecryptable packets during the handshake, we send a Public reset
 	// but only after a time of protocol.PublicResetTimeout has passed
@@ -120,6 +227,13 @@ type session struct {
 	// It receives when it makes sense to try decrypting undecryptable packets.
 	handshakeEvent    <-chan struct{}
 	handshakeComplete bool
+	// sent0RTT is set if the client offered 0-RTT when resuming a session
+	sent0RTT bool
+	// the number of bytes of application data received by the server in 0-RTT packets
+	received0RTTBytes protocol.ByteCount
+	// pskCache is used by clients to store new session tickets.
+	// It is nil if no ClientSessionCache is configured.
+	pskCache *clientPSKCache
 
 	receivedFirstPacket              bool // since packet numbers start at 0, we can't use largestRcvdPacketNumber != 0 for this
 	receivedFirstForwardSecurePacket bool
@@ -134,18 +248,31 @@ type session struct {
 	pacingDeadline time.Time
 
 	peerParams *handshake.TransportParameters
+	// maxDatagramFrameSize is the maximum size of DATAGRAM frames that the peer accepts.
+	// It is set when the transport parameters are processed, and read by SendMessage, so it's accessed atomically.
+	maxDatagramFrameSize uint64
 
 	timer *utils.Timer
 	// keepAlivePingSent stores whether a Ping frame was sent to the peer or not
 	// it is reset as soon as we receive a packet from the peer
 	keepAlivePingSent bool
 
+	packetsReceived               uint64
+	connFlowControlBlockedCount   uint64
+	streamFlowControlBlockedCount uint64
+
+	// tracer is nil if this connection is not traced
+	tracer ConnectionTracer
+
 	logger utils.Logger
 }
 
 var _ Session = &session{}
 var _ streamSender = &session{}
 
+// make sure that the ConnectionTracer can be passed to the sentPacketHandler
+var _ ackhandler.Tracer = ConnectionTracer(nil)
+
 // newSession makes a new session
 func newSession(
 	conn connection,
@@ -164,6 +291,7 @@ func newSession(
 		sessionRunner:  sessionRunner,
 		srcConnID:      connectionID,
 		destConnID:     connectionID,
+		origDestConnID: connectionID,
 		perspective:    protocol.PerspectiveServer,
 		version:        v,
 		config:         config,
@@ -212,6 +340,7 @@ func newSession(
 		divNonce,
 		cs,
 		s.streamFramer,
+		s.datagramQueue,
 		s.perspective,
 		s.version,
 	)
@@ -238,6 +367,7 @@ var newClientSession = func(
 		sessionRunner:  sessionRunner,
 		srcConnID:      connectionID,
 		destConnID:     connectionID,
+		origDestConnID: connectionID,
 		perspective:    protocol.PerspectiveClient,
 		version:        v,
 		config:         config,
@@ -259,6 +389,7 @@ var newClientSession = func(
 		connectionID,
 		s.version,
 		tlsConf,
+		s.config.ClientConfigCache,
 		transportParams,
 		paramsChan,
 		handshakeEvent,
@@ -282,6 +413,7 @@ var newClientSession = func(
 		nil, // no diversification nonce
 		cs,
 		s.streamFramer,
+		s.datagramQueue,
 		s.perspective,
 		s.version,
 	)
@@ -293,6 +425,7 @@ func newTLSServerSession(
 	runner sessionRunner,
 	destConnID protocol.ConnectionID,
 	srcConnID protocol.ConnectionID,
+	origDestConnID protocol.ConnectionID,
 	initialPacketNumber protocol.PacketNumber,
 	config *Config,
 	tls handshake.MintTLS,
@@ -309,22 +442,29 @@ func newTLSServerSession(
 		config:         config,
 		srcConnID:      srcConnID,
 		destConnID:     destConnID,
+		origDestConnID: origDestConnID,
 		perspective:    protocol.PerspectiveServer,
 		version:        v,
 		handshakeEvent: handshakeEvent,
 		logger:         logger,
 	}
 	s.preSetup()
-	cs := handshake.NewCryptoSetupTLSServer(
+	cs, err := handshake.NewCryptoSetupTLSServer(
 		tls,
 		cryptoStreamConn,
 		nullAEAD,
 		handshakeEvent,
 		v,
 	)
+	if err != nil {
+		return nil, err
+	}
 	s.cryptoStreamHandler = cs
 	s.streamsMap = newStreamsMap(s, s.newFlowController, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
 	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	if s.config.EnableDatagrams {
+		s.datagramQueue = newDatagramQueue(s.scheduleSending, s.logger)
+	}
 	s.packer = newPacketPacker(
 		s.destConnID,
 		s.srcConnID,
@@ -334,6 +474,7 @@ func newTLSServerSession(
 		nil, // no diversification nonce
 		cs,
 		s.streamFramer,
+		s.datagramQueue,
 		s.perspective,
 		s.version,
 	)
@@ -354,6 +495,8 @@ var newTLSClientSession = func(
 	v protocol.VersionNumber,
 	destConnID protocol.ConnectionID,
 	srcConnID protocol.ConnectionID,
+	token []byte,
+	pskCache *clientPSKCache,
 	config *Config,
 	tls handshake.MintTLS,
 	paramsChan <-chan handshake.TransportParameters,
@@ -367,10 +510,12 @@ var newTLSClientSession = func(
 		config:         config,
 		srcConnID:      srcConnID,
 		destConnID:     destConnID,
+		origDestConnID: destConnID,
 		perspective:    protocol.PerspectiveClient,
 		version:        v,
 		handshakeEvent: handshakeEvent,
 		paramsChan:     paramsChan,
+		pskCache:       pskCache,
 		logger:         logger,
 	}
 	s.preSetup()
@@ -390,6 +535,9 @@ var newTLSClientSession = func(
 	s.unpacker = newPacketUnpacker(cs, s.version)
 	s.streamsMap = newStreamsMap(s, s.newFlowController, s.config.MaxIncomingStreams, s.config.MaxIncomingUniStreams, s.perspective, s.version)
 	s.streamFramer = newStreamFramer(s.cryptoStream, s.streamsMap, s.version)
+	if s.config.EnableDatagrams {
+		s.datagramQueue = newDatagramQueue(s.scheduleSending, s.logger)
+	}
 	s.packer = newPacketPacker(
 		s.destConnID,
 		s.srcConnID,
@@ -399,15 +547,56 @@ var newTLSClientSession = func(
 		nil, // no diversification nonce
 		cs,
 		s.streamFramer,
+		s.datagramQueue,
 		s.perspective,
 		s.version,
 	)
-	return s, s.postSetup()
+	s.packer.SetToken(token)
+	if err := s.postSetup(); err != nil {
+		return nil, err
+	}
+	if pskCache != nil {
+		// When sending 0-RTT data, the transport parameters that the server sent in the last connection apply.
+		if params := pskCache.ZeroRTTParams(); params != nil {
+			s.sent0RTT = true
+			s.processTransportParameters(params)
+		}
+	}
+	return s, nil
 }
 
 func (s *session) preSetup() {
+	if s.config.Tracer != nil {
+		s.tracer = s.config.Tracer.TracerForConnection(s.perspective, s.origDestConnID)
+	}
 	s.rttStats = &congestion.RTTStats{}
-	s.sentPacketHandler = ackhandler.NewSentPacketHandler(s.rttStats, s.logger)
+	var cong congestion.SendAlgorithm
+	if s.config.CongestionControl != nil {
+		cong = newSendAlgorithm(s.config.CongestionControl, s.rttStats)
+	}
+	// ECN is only used with IETF QUIC, since gQUIC ACK frames can't carry the ECN counts.
+	enableECN := s.version.UsesIETFFrameFormat() && s.conn.SupportsECN()
+	// A CongestionController implemented by the application can't be informed about ECN-CE marks.
+	if _, ok := cong.(*congestionControllerAdapter); ok {
+		enableECN = false
+	}
+	// Path MTU discovery is only used with IETF QUIC, since gQUIC doesn't tell us the maximum packet size the peer accepts.
+	var mtuProbeHandler ackhandler.MTUProbeHandler
+	if s.version.UsesTLS() && !s.config.DisablePathMTUDiscovery {
+		s.mtuDiscoverer = newMTUDiscoverer(
+			s.rttStats,
+			getMaxPacketSize(s.conn.RemoteAddr()),
+			func(size protocol.ByteCount) { s.packer.SetPacketSize(size) },
+			s.logger,
+		)
+		mtuProbeHandler = s.mtuDiscoverer
+		// If the DF bit can't be set, MTU probes might be fragmented.
+		// Path MTU discovery then finds a size that is too large, but packets still arrive.
+		if err := s.conn.SetDF(); err != nil {
+			s.logger.Debugf("Setting the Don't Fragment bit failed: %s", err)
+		}
+	}
+	s.sentPacketHandler = ackhandler.NewSentPacketHandler(s.rttStats, cong, enableECN, mtuProbeHandler, s.tracer, s.logger)
 	s.connFlowController = flowcontrol.NewConnectionFlowController(
 		protocol.ReceiveConnectionFlowControlWindow,
 		protocol.ByteCount(s.config.MaxReceiveConnectionFlowControlWindow),
@@ -422,8 +611,14 @@ func (s *session) postSetup() error {
 	s.receivedPackets = make(chan *receivedPacket, protocol.MaxSessionUnprocessedPackets)
 	s.closeChan = make(chan closeError, 1)
 	s.sendingScheduled = make(chan struct{}, 1)
+	s.statsRequests = make(chan chan<- ConnectionStats)
+	s.pathValidationRequests = make(chan *pathValidation)
+	s.pathErrors = make(chan pathError)
+	s.goAwayRequests = make(chan time.Time)
+	s.peerConnIDs = newConnIDManager(s.sessionRunner.addResetToken, s.logger)
 	s.undecryptablePackets = make([]*receivedPacket, 0, protocol.MaxUndecryptablePackets)
 	s.ctx, s.ctxCancel = context.WithCancel(context.Background())
+	s.handshakeCtx, s.handshakeCtxCancel = context.WithCancel(context.Background())
 
 	s.timer = utils.NewTimer()
 	now := time.Now()
@@ -438,6 +633,7 @@ func (s *session) postSetup() error {
 // run the session main loop
 func (s *session) run() error {
 	defer s.ctxCancel()
+	defer s.handshakeCtxCancel()
 
 	go func() {
 		if err := s.cryptoStreamHandler.HandleCryptoStream(); err != nil {
@@ -487,9 +683,21 @@ runLoop:
 			putPacketBuffer(&p.header.Raw)
 		case p := <-s.paramsChan:
 			s.processTransportParameters(&p)
+			if s.pskCache != nil {
+				s.pskCache.SetPeerParams(&p)
+			}
 		case _, ok := <-s.handshakeEvent:
 			// when the handshake is completed, the channel will be closed
 			s.handleHandshakeEvent(!ok)
+		case c := <-s.statsRequests:
+			c <- s.getStats()
+			continue
+		case pv := <-s.pathValidationRequests:
+			s.startPathValidation(pv)
+		case e := <-s.pathErrors:
+			s.handlePathError(e)
+		case deadline := <-s.goAwayRequests:
+			s.goAway(deadline)
 		}
 
 		now := time.Now()
@@ -520,6 +728,11 @@ runLoop:
 		if err := s.sendPackets(); err != nil {
 			s.closeLocal(err)
 		}
+		if s.pathValidation != nil && !now.Before(s.pathValidation.nextChallenge) {
+			if err := s.sendPathChallenge(now); err != nil {
+				s.closeLocal(err)
+			}
+		}
 
 		if !s.receivedTooManyUndecrytablePacketsTime.IsZero() && s.receivedTooManyUndecrytablePacketsTime.Add(protocol.PublicResetTimeout).Before(now) && len(s.undecryptablePackets) != 0 {
 			s.closeLocal(qerr.Error(qerr.DecryptionFailure, "too many undecryptable packets received"))
@@ -530,6 +743,14 @@ runLoop:
 		if s.handshakeComplete && now.Sub(s.lastNetworkActivityTime) >= s.config.IdleTimeout {
 			s.closeLocal(qerr.Error(qerr.NetworkIdleTimeout, "No recent network activity."))
 		}
+		if !s.goAwayDeadline.IsZero() {
+			if !now.Before(s.goAwayDeadline) {
+				s.closeLocal(qerr.Error(qerr.PeerGoingAway, "Streams did not complete before the shutdown deadline."))
+			} else if s.streamsMap.NumStreams() == 0 && s.sentPacketHandler.BytesInFlight() == 0 {
+				// All streams have completed, and all data (including the GOAWAY frame) was acknowledged.
+				s.closeLocal(nil)
+			}
+		}
 	}
 
 	if err := s.handleCloseError(closeErr); err != nil {
@@ -537,6 +758,15 @@ runLoop:
 	}
 	s.logger.Infof("Connection %s closed.", s.srcConnID)
 	s.sessionRunner.removeConnectionID(s.srcConnID)
+	for _, connID := range s.issuedConnIDs {
+		// connection IDs retired by the peer were already removed
+		if connID != nil {
+			s.sessionRunner.removeConnectionID(connID)
+		}
+	}
+	if s.tracer != nil {
+		s.tracer.Close()
+	}
 	return closeErr.err
 }
 
@@ -544,10 +774,45 @@ func (s *session) Context() context.Context {
 	return s.ctx
 }
 
+func (s *session) HandshakeComplete() context.Context {
+	return s.handshakeCtx
+}
+
 func (s *session) ConnectionState() ConnectionState {
 	return s.cryptoStreamHandler.ConnectionState()
 }
 
+// ConnectionStats returns a snapshot of the connection statistics.
+// The statistics are collected by the run loop, as long as the session is running.
+func (s *session) ConnectionStats() ConnectionStats {
+	c := make(chan ConnectionStats, 1)
+	select {
+	case s.statsRequests <- c:
+		return <-c
+	case <-s.ctx.Done():
+		// The run loop has stopped, so it's safe to access the session's state.
+		return s.getStats()
+	}
+}
+
+func (s *session) getStats() ConnectionStats {
+	sentStats := s.sentPacketHandler.GetStats()
+	return ConnectionStats{
+		MinRTT:                       s.rttStats.MinRTT(),
+		SmoothedRTT:                  s.rttStats.SmoothedRTT(),
+		LatestRTT:                    s.rttStats.LatestRTT(),
+		CongestionWindow:             uint64(sentStats.CongestionWindow),
+		BandwidthEstimate:            uint64(sentStats.BandwidthEstimate),
+		BytesInFlight:                uint64(sentStats.BytesInFlight),
+		PacketsSent:                  sentStats.PacketsSent,
+		PacketsReceived:              s.packetsReceived,
+		PacketsLost:                  sentStats.PacketsLost,
+		PacketsRetransmitted:         sentStats.PacketsRetransmitted,
+		ConnectionFlowControlBlocked: s.connFlowControlBlockedCount,
+		StreamFlowControlBlocked:     s.streamFlowControlBlockedCount,
+	}
+}
+
 func (s *session) maybeResetTimer() {
 	var deadline time.Time
 	if s.config.KeepAlive && s.handshakeComplete && !s.keepAlivePingSent {
@@ -572,6 +837,12 @@ func (s *session) maybeResetTimer() {
 	if !s.pacingDeadline.IsZero() {
 		deadline = utils.MinTime(deadline, s.pacingDeadline)
 	}
+	if s.pathValidation != nil {
+		deadline = utils.MinTime(deadline, s.pathValidation.nextChallenge)
+	}
+	if !s.goAwayDeadline.IsZero() {
+		deadline = utils.MinTime(deadline, s.goAwayDeadline)
+	}
 
 	s.timer.Reset(deadline)
 }
@@ -583,7 +854,19 @@ func (s *session) handleHandshakeEvent(completed bool) {
 	}
 	s.handshakeComplete = true
 	s.handshakeEvent = nil // prevent this case from ever being selected again
+	if s.sent0RTT {
+		// If 0-RTT was rejected, the 0-RTT packets are retransmitted as forward-secure packets.
+		if err := s.sentPacketHandler.Finish0RTT(s.cryptoStreamHandler.ConnectionState().Used0RTT); err != nil {
+			s.closeLocal(err)
+		}
+	}
+	s.handshakeCtxCancel()
 	s.sessionRunner.onHandshakeComplete(s)
+	if s.version.UsesTLS() {
+		if err := s.issueConnectionIDs(); err != nil {
+			s.closeLocal(err)
+		}
+	}
 
 	// In gQUIC, the server completes the handshake first (after sending the SHLO).
 	// In TLS 1.3, the client completes the handshake first (after sending the CFIN).
@@ -637,6 +920,31 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 		return err
 	}
 
+	if s.perspective == protocol.PerspectiveServer && hdr.IsLongHeader && hdr.Type == protocol.PacketType0RTT {
+		// The client may only send as much 0-RTT data as announced in the session ticket.
+		// The packet is dropped without acknowledging it, so the client retransmits the data after the handshake completed.
+		n := streamDataLen(packet.frames, s.version)
+		if s.received0RTTBytes+n > s.config.Max0RTTData {
+			s.logger.Debugf("Dropping 0-RTT packet 0x%x. The client sent more than %d bytes of 0-RTT data.", hdr.PacketNumber, s.config.Max0RTTData)
+			return nil
+		}
+		s.received0RTTBytes += n
+	}
+
+	if s.tracer != nil {
+		s.tracer.ReceivedPacket(&PacketInfo{
+			Type:             packetType(hdr),
+			DestConnectionID: hdr.DestConnectionID,
+			SrcConnectionID:  hdr.SrcConnectionID,
+			PacketNumber:     hdr.PacketNumber,
+			EncryptionLevel:  packet.encryptionLevel,
+			Size:             protocol.ByteCount(len(hdr.Raw) + len(data)),
+			Frames:           packet.frames,
+			// Duplicate packets are processed like any other packet.
+			PotentiallyDuplicate: s.receivedPacketHandler.IsPotentiallyDuplicate(hdr.PacketNumber),
+		})
+	}
+
 	if s.perspective == protocol.PerspectiveClient && !s.receivedFirstPacket && !hdr.SrcConnectionID.Equal(s.destConnID) {
 		s.logger.Debugf("Received first packet. Switching destination connection ID to: %s", hdr.SrcConnectionID)
 		s.destConnID = hdr.SrcConnectionID
@@ -644,6 +952,7 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	}
 
 	s.receivedFirstPacket = true
+	s.packetsReceived++
 	s.lastNetworkActivityTime = p.rcvTime
 	s.keepAlivePingSent = false
 
@@ -659,19 +968,248 @@ func (s *session) handlePacketImpl(p *receivedPacket) error {
 	}
 
 	s.lastRcvdPacketNumber = hdr.PacketNumber
+	// Reordered packets don't indicate that the client migrated to a new address.
+	isLargestRcvd := hdr.PacketNumber > s.largestRcvdPacketNumber
 	// Only do this after decrypting, so we are sure the packet is not attacker-controlled
 	s.largestRcvdPacketNumber = utils.MaxPacketNumber(s.largestRcvdPacketNumber, hdr.PacketNumber)
 
-	// If this is a Retry packet, there's no need to send an ACK.
-	// The session will be closed and recreated as soon as the crypto setup processed the HRR.
-	if hdr.Type != protocol.PacketTypeRetry {
-		isRetransmittable := ackhandler.HasRetransmittableFrames(packet.frames)
-		if err := s.receivedPacketHandler.ReceivedPacket(hdr.PacketNumber, p.rcvTime, isRetransmittable); err != nil {
+	isRetransmittable := ackhandler.HasRetransmittableFrames(packet.frames)
+	if err := s.receivedPacketHandler.ReceivedPacket(hdr.PacketNumber, p.ecn, p.rcvTime, isRetransmittable); err != nil {
+		return err
+	}
+
+	// Send on the socket that the last packet was received on.
+	// Reordered packets don't change the socket, so we don't switch back and forth between sockets.
+	if p.rcvConn != nil && isLargestRcvd {
+		s.conn.SetPacketConn(p.rcvConn)
+	}
+
+	if s.perspective == protocol.PerspectiveServer && s.version.UsesTLS() && s.handshakeComplete && p.remoteAddr != nil {
+		if !addrsEqual(p.remoteAddr, s.conn.RemoteAddr()) {
+			// The client is probing a new path. Don't migrate to it.
+			if isProbingPacket(packet.frames) {
+				return s.handleProbingPacket(packet.frames, p.remoteAddr)
+			}
+			if isLargestRcvd {
+				s.handlePeerAddressChange(p.remoteAddr)
+			}
+		}
+		if pv := s.pathValidation; pv != nil && addrsEqual(p.remoteAddr, s.conn.RemoteAddr()) {
+			pv.bytesReceived += protocol.ByteCount(len(hdr.Raw) + len(data))
+		}
+	}
+
+	frames := packet.frames
+	if pv := s.pathValidation; pv != nil && !isOnPath(p, pv) {
+		frames = dropPathResponses(frames, s.logger)
+	}
+	return s.handleFrames(frames, packet.encryptionLevel)
+}
+
+// isOnPath says if a packet was received on the path that is being validated.
+func isOnPath(p *receivedPacket, pv *pathValidation) bool {
+	// When validating a new address of the peer, the current address already is the new address.
+	if pv.previousAddr != nil {
+		return addrsEqual(p.remoteAddr, pv.conn.RemoteAddr())
+	}
+	return p.rcvPath == pv.conn
+}
+
+// dropPathResponses removes PATH_RESPONSE frames received on a path other than the one being validated.
+// A PATH_RESPONSE only proves that the peer is reachable on the path it was received on.
+func dropPathResponses(fs []wire.Frame, logger utils.Logger) []wire.Frame {
+	frames := make([]wire.Frame, 0, len(fs))
+	for _, f := range fs {
+		if _, ok := f.(*wire.PathResponseFrame); ok {
+			logger.Debugf("Ignoring PATH_RESPONSE frame that wasn't received on the path being validated.")
+			continue
+		}
+		frames = append(frames, f)
+	}
+	return frames
+}
+
+// isProbingPacket says if a packet only contains PATH_CHALLENGE and PATH_RESPONSE frames.
+func isProbingPacket(fs []wire.Frame) bool {
+	if len(fs) == 0 {
+		return false
+	}
+	for _, f := range fs {
+		switch f.(type) {
+		case *wire.PathChallengeFrame, *wire.PathResponseFrame:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// handleProbingPacket handles a probing packet that was received from an address other than the peer's current address.
+// PATH_CHALLENGE frames are answered on the path they were received on, using a connection ID that wasn't used on any other path.
+// If the peer didn't issue an unused connection ID, they are not answered, since that would allow an observer to link the two paths.
+// PATH_RESPONSE frames are ignored, since we only validate the peer's current address.
+func (s *session) handleProbingPacket(fs []wire.Frame, remoteAddr net.Addr) error {
+	for _, ff := range fs {
+		wire.LogFrame(s.logger, ff, false)
+		switch frame := ff.(type) {
+		case *wire.PathChallengeFrame:
+			connID := s.destConnID
+			// Zero-length connection IDs can't be changed.
+			if connID.Len() > 0 {
+				f, ok := s.connIDForAddr(remoteAddr)
+				if !ok {
+					s.logger.Debugf("Not answering PATH_CHALLENGE frame received from %s. No unused connection ID available.", remoteAddr)
+					continue
+				}
+				connID = f.ConnectionID
+			}
+			packet, err := s.packer.PackProbingPacket(&wire.PathResponseFrame{Data: frame.Data}, connID)
+			if err != nil {
+				return err
+			}
+			s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+			s.logPacket(packet)
+			s.traceSentPacket(packet)
+			err = s.conn.WriteTo(packet.raw, remoteAddr)
+			putPacketBuffer(&packet.raw)
+			if err != nil {
+				return err
+			}
+		case *wire.PathResponseFrame:
+			s.logger.Debugf("Ignoring PATH_RESPONSE frame received from %s.", remoteAddr)
+		}
+	}
+	return nil
+}
+
+// connIDForAddr returns the connection ID used when sending to a new address of the peer.
+// Every address is sent to using a different connection ID, such that an observer can't link them.
+// The connection ID used for the last address the peer probed from is reused if the peer migrates to that address.
+func (s *session) connIDForAddr(addr net.Addr) (*wire.NewConnectionIDFrame, bool) {
+	if s.probeConnID != nil {
+		if addrsEqual(addr, s.probeAddr) {
+			return s.probeConnID, true
+		}
+		s.retireConnectionID(s.probeConnID.SequenceNumber)
+		s.probeAddr = nil
+		s.probeConnID = nil
+	}
+	f, ok := s.peerConnIDs.Get()
+	if !ok {
+		return nil, false
+	}
+	s.probeAddr = addr
+	s.probeConnID = f
+	return f, true
+}
+
+// retireConnectionID tells the peer that we won't use one of the connection IDs it issued any more.
+func (s *session) retireConnectionID(seq uint64) {
+	s.logger.Debugf("Retiring connection ID with sequence number %d.", seq)
+	s.queueControlFrame(&wire.RetireConnectionIDFrame{SequenceNumber: seq})
+}
+
+// issueConnectionIDs issues additional connection IDs to the peer.
+// The peer uses them when migrating the connection.
+func (s *session) issueConnectionIDs() error {
+	for i := 0; i < protocol.NumIssuedConnectionIDs; i++ {
+		if err := s.issueConnectionID(); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	return s.handleFrames(packet.frames, packet.encryptionLevel)
+func (s *session) issueConnectionID() error {
+	// Zero-length connection IDs can't be changed.
+	if s.srcConnID.Len() == 0 {
+		return nil
+	}
+	connID, err := generateConnID(s.config.ConnectionIDGenerator)
+	if err != nil {
+		return err
+	}
+	f := &wire.NewConnectionIDFrame{
+		// sequence number 0 is the connection ID used during the handshake
+		SequenceNumber:      uint64(len(s.issuedConnIDs) + 1),
+		ConnectionID:        connID,
+		StatelessResetToken: s.sessionRunner.getStatelessResetToken(connID),
+	}
+	s.sessionRunner.addConnectionID(connID, s)
+	s.issuedConnIDs = append(s.issuedConnIDs, connID)
+	s.queueControlFrame(f)
+	return nil
+}
+
+// handleRetireConnectionIDFrame removes a connection ID that the peer won't use any more, and issues a new one to replace it.
+// The connection ID used during the handshake (sequence number 0) is only removed when the session is closed.
+func (s *session) handleRetireConnectionIDFrame(frame *wire.RetireConnectionIDFrame) error {
+	if frame.SequenceNumber > uint64(len(s.issuedConnIDs)) {
+		return qerr.Error(qerr.InvalidFrameData, fmt.Sprintf("retired connection ID with sequence number %d, which was never issued", frame.SequenceNumber))
+	}
+	if frame.SequenceNumber == 0 {
+		return nil
+	}
+	connID := s.issuedConnIDs[frame.SequenceNumber-1]
+	// this is a retransmission of a RETIRE_CONNECTION_ID frame
+	if connID == nil {
+		return nil
+	}
+	s.issuedConnIDs[frame.SequenceNumber-1] = nil
+	s.sessionRunner.removeConnectionID(connID)
+	return s.issueConnectionID()
+}
+
+// handlePeerAddressChange is called when the server receives a non-probing packet from a new address of the client.
+// Packets are sent to the new address right away, but only a limited amount of data is sent until the address is validated.
+func (s *session) handlePeerAddressChange(addr net.Addr) {
+	previousAddr := s.conn.RemoteAddr()
+	if pv := s.pathValidation; pv != nil {
+		// The client changed its address again, before the previous address change was validated.
+		previousAddr = pv.previousAddr
+		if addrsEqual(addr, previousAddr) {
+			s.logger.Infof("Client returned to its previous address %s.", addr)
+			s.pathValidation = nil
+			s.restorePreviousConnID(pv)
+			s.conn.SetCurrentRemoteAddr(addr)
+			return
+		}
+	}
+	pv := &pathValidation{conn: s.conn, previousAddr: previousAddr}
+	if _, err := rand.Read(pv.challenge[:]); err != nil {
+		s.logger.Errorf("Not migrating to %s. Error generating the PATH_CHALLENGE data: %s", addr, err)
+		return
+	}
+	s.logger.Infof("Client address changed from %s to %s. Validating the new address.", previousAddr, addr)
+	// The connection ID used for the address that was being validated must not be used on the new address.
+	if old := s.pathValidation; old != nil {
+		s.restorePreviousConnID(old)
+	}
+	// switch to a new connection ID, such that an observer can't link the two addresses
+	if s.destConnID.Len() > 0 {
+		if f, ok := s.connIDForAddr(addr); ok {
+			s.logger.Debugf("Switching to connection ID %s.", f.ConnectionID)
+			pv.previousConnID, pv.previousConnIDSeq = s.destConnID, s.destConnIDSeq
+			s.destConnID, s.destConnIDSeq = f.ConnectionID, f.SequenceNumber
+			s.probeAddr = nil
+			s.probeConnID = nil
+		}
+	}
+	s.packer.ChangeDestConnectionID(s.destConnID)
+	pv.connID, pv.connIDSeq = s.destConnID, s.destConnIDSeq
+	s.conn.SetCurrentRemoteAddr(addr)
+	s.pathValidation = pv
+}
+
+// restorePreviousConnID is called when we return to the previous address of the peer.
+// The connection ID used for the new address is retired, and the one used for the previous address is used again.
+func (s *session) restorePreviousConnID(pv *pathValidation) {
+	if pv.previousConnID == nil {
+		return
+	}
+	s.retireConnectionID(s.destConnIDSeq)
+	s.destConnID, s.destConnIDSeq = pv.previousConnID, pv.previousConnIDSeq
+	s.packer.ChangeDestConnectionID(s.destConnID)
 }
 
 func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLevel) error {
@@ -686,7 +1224,7 @@ func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLeve
 		case *wire.ConnectionCloseFrame:
 			s.closeRemote(qerr.Error(frame.ErrorCode, frame.ReasonPhrase))
 		case *wire.GoawayFrame:
-			err = errors.New("unimplemented: handling GOAWAY frames")
+			s.handleGoawayFrame(frame)
 		case *wire.StopWaitingFrame: // ignore STOP_WAITINGs
 		case *wire.RstStreamFrame:
 			err = s.handleRstStreamFrame(frame)
@@ -705,8 +1243,13 @@ func (s *session) handleFrames(fs []wire.Frame, encLevel protocol.EncryptionLeve
 		case *wire.PathChallengeFrame:
 			s.handlePathChallengeFrame(frame)
 		case *wire.PathResponseFrame:
-			// since we don't send PATH_CHALLENGEs, we don't expect PATH_RESPONSEs
-			err = errors.New("unexpected PATH_RESPONSE frame")
+			err = s.handlePathResponseFrame(frame)
+		case *wire.DatagramFrame:
+			err = s.handleDatagramFrame(frame, encLevel)
+		case *wire.NewConnectionIDFrame:
+			err = s.peerConnIDs.Add(frame)
+		case *wire.RetireConnectionIDFrame:
+			err = s.handleRetireConnectionIDFrame(frame)
 		default:
 			return errors.New("Session BUG: unexpected frame type")
 		}
@@ -737,6 +1280,16 @@ func (s *session) handleStreamFrame(frame *wire.StreamFrame, encLevel protocol.E
 	} else if encLevel <= protocol.EncryptionUnencrypted {
 		return qerr.Error(qerr.UnencryptedStreamData, fmt.Sprintf("received unencrypted stream data on stream %d", frame.StreamID))
 	}
+	// In gQUIC, streams opened by the client have odd stream IDs.
+	var refuse bool
+	if !s.version.UsesIETFFrameFormat() && (frame.StreamID%2 == 1) == (s.perspective == protocol.PerspectiveServer) && frame.StreamID > s.largestPeerStreamID {
+		// The GOAWAY frame told the peer that streams above the largest stream ID won't be processed.
+		if s.goAwayDeadline.IsZero() {
+			s.largestPeerStreamID = frame.StreamID
+		} else {
+			refuse = true
+		}
+	}
 	str, err := s.streamsMap.GetOrOpenReceiveStream(frame.StreamID)
 	if err != nil {
 		return err
@@ -746,7 +1299,30 @@ func (s *session) handleStreamFrame(frame *wire.StreamFrame, encLevel protocol.E
 		// ignore this StreamFrame
 		return nil
 	}
-	return str.handleStreamFrame(frame)
+	if err := str.handleStreamFrame(frame); err != nil {
+		return err
+	}
+	if refuse {
+		return s.refuseStream(str)
+	}
+	return nil
+}
+
+// refuseStream resets a gQUIC stream that the peer opened after we sent a GOAWAY frame.
+// The stream is opened like any other stream, so that its data counts towards connection flow control,
+// and it is completed once the peer resets it as well.
+func (s *session) refuseStream(str receiveStreamI) error {
+	s.logger.Debugf("Refusing stream %d opened after sending a GOAWAY frame.", str.StreamID())
+	sendStr, err := s.streamsMap.GetOrOpenSendStream(str.StreamID())
+	if err != nil || sendStr == nil {
+		return err
+	}
+	if err := str.CancelRead(streamPeerGoingAway); err != nil {
+		return err
+	}
+	// This only fails if the application already closed the stream.
+	_ = sendStr.CancelWrite(streamPeerGoingAway)
+	return nil
 }
 
 func (s *session) handleMaxDataFrame(frame *wire.MaxDataFrame) {
@@ -770,6 +1346,11 @@ func (s *session) handleMaxStreamDataFrame(frame *wire.MaxStreamDataFrame) error
 	return nil
 }
 
+func (s *session) handleGoawayFrame(frame *wire.GoawayFrame) {
+	s.logger.Infof("Peer is going away (%s). Last good stream: %d.", frame.ErrorCode, frame.LastGoodStream)
+	s.peerGoingAway.Set(true)
+}
+
 func (s *session) handleMaxStreamIDFrame(frame *wire.MaxStreamIDFrame) error {
 	return s.streamsMap.HandleMaxStreamIDFrame(frame)
 }
@@ -809,6 +1390,64 @@ func (s *session) handlePathChallengeFrame(frame *wire.PathChallengeFrame) {
 	s.queueControlFrame(&wire.PathResponseFrame{Data: frame.Data})
 }
 
+func (s *session) handlePathResponseFrame(frame *wire.PathResponseFrame) error {
+	if !s.sentPathChallenge {
+		return errors.New("unexpected PATH_RESPONSE frame")
+	}
+	pv := s.pathValidation
+	if pv == nil || frame.Data != pv.challenge {
+		// This might be a late response for a path validation that already completed.
+		s.logger.Debugf("Ignoring PATH_RESPONSE frame that doesn't belong to the current path validation.")
+		return nil
+	}
+	s.pathValidation = nil
+	if pv.previousAddr != nil {
+		s.logger.Infof("Validated the new client address %s.", s.conn.RemoteAddr())
+		if pv.previousConnID != nil {
+			s.retireConnectionID(pv.previousConnIDSeq)
+		}
+		// If only the port changed, this was most likely a NAT rebinding.
+		// The path characteristics didn't change, so we keep the congestion state.
+		if !onlyPortChanged(pv.previousAddr, s.conn.RemoteAddr()) {
+			s.onConnectionMigration()
+		}
+		return nil
+	}
+	s.logger.Infof("Path validation succeeded. Migrating from %s to %s.", s.conn.LocalAddr(), pv.conn.LocalAddr())
+	s.connMutex.Lock()
+	s.conn = pv.conn
+	s.connMutex.Unlock()
+	s.retireConnectionID(s.destConnIDSeq)
+	s.destConnID, s.destConnIDSeq = pv.connID, pv.connIDSeq
+	s.packer.ChangeDestConnectionID(pv.connID)
+	s.onConnectionMigration()
+	pv.done <- nil
+	return nil
+}
+
+// onConnectionMigration resets the congestion controller, the RTT estimate and the packet size,
+// since they don't apply to the new path.
+func (s *session) onConnectionMigration() {
+	s.sentPacketHandler.OnConnectionMigration()
+	if s.mtuDiscoverer != nil {
+		s.mtuDiscoverer.Reset(getMaxPacketSize(s.conn.RemoteAddr()))
+	}
+}
+
+func (s *session) handleDatagramFrame(frame *wire.DatagramFrame, encLevel protocol.EncryptionLevel) error {
+	if s.datagramQueue == nil {
+		return qerr.Error(qerr.InvalidFrameData, "received a DATAGRAM frame, but DATAGRAM support is disabled")
+	}
+	if encLevel <= protocol.EncryptionUnencrypted {
+		return qerr.Error(qerr.InvalidFrameData, "received an unencrypted DATAGRAM frame")
+	}
+	if frame.Length(s.version) > protocol.MaxDatagramFrameSize {
+		return qerr.Error(qerr.InvalidFrameData, "DATAGRAM frame too large")
+	}
+	s.datagramQueue.HandleDatagramFrame(frame)
+	return nil
+}
+
 func (s *session) handleAckFrame(frame *wire.AckFrame, encLevel protocol.EncryptionLevel) error {
 	if err := s.sentPacketHandler.ReceivedAck(frame, s.lastRcvdPacketNumber, encLevel, s.lastNetworkActivityTime); err != nil {
 		return err
@@ -837,6 +1476,39 @@ func (s *session) Close(e error) error {
 	return nil
 }
 
+// CloseGracefully closes the connection once all streams have completed.
+// For gQUIC, a GOAWAY frame tells the peer not to open any new streams, and streams opened after that are refused.
+// IETF QUIC has no GOAWAY frame. Instead, no more MAX_STREAM_ID frames are sent,
+// so the peer can only open streams up to the current limit.
+// If the streams didn't complete when the timeout elapses, the connection is closed anyway.
+// It waits until the run loop has stopped before returning.
+func (s *session) CloseGracefully(timeout time.Duration) error {
+	select {
+	case s.goAwayRequests <- time.Now().Add(timeout):
+	case <-s.ctx.Done():
+	}
+	<-s.ctx.Done()
+	return nil
+}
+
+// goAway starts a graceful shutdown. It is called from the run loop.
+func (s *session) goAway(deadline time.Time) {
+	if !s.goAwayDeadline.IsZero() {
+		s.goAwayDeadline = utils.MinTime(s.goAwayDeadline, deadline)
+		return
+	}
+	s.logger.Infof("Closing connection %s gracefully.", s.srcConnID)
+	s.goAwayDeadline = deadline
+	s.streamsMap.StopIssuingMaxStreamID()
+	if !s.version.UsesIETFFrameFormat() {
+		s.packer.QueueControlFrame(&wire.GoawayFrame{
+			ErrorCode:      qerr.PeerGoingAway,
+			LastGoodStream: s.largestPeerStreamID,
+			ReasonPhrase:   "shutting down",
+		})
+	}
+}
+
 func (s *session) handleCloseError(closeErr closeError) error {
 	if closeErr.err == nil {
 		closeErr.err = qerr.PeerGoingAway
@@ -856,6 +1528,13 @@ func (s *session) handleCloseError(closeErr closeError) error {
 
 	s.cryptoStream.closeForShutdown(quicErr)
 	s.streamsMap.CloseWithError(quicErr)
+	if s.datagramQueue != nil {
+		s.datagramQueue.CloseWithError(quicErr)
+	}
+	if pv := s.pathValidation; pv != nil {
+		pv.fail(quicErr)
+	}
+	s.pathValidation = nil
 
 	if closeErr.err == errCloseSessionForNewVersion || closeErr.err == handshake.ErrCloseSessionForRetry {
 		return nil
@@ -876,25 +1555,47 @@ func (s *session) handleCloseError(closeErr closeError) error {
 
 func (s *session) processTransportParameters(params *handshake.TransportParameters) {
 	s.peerParams = params
+	atomic.StoreUint64(&s.maxDatagramFrameSize, uint64(utils.MinByteCount(params.MaxDatagramFrameSize, protocol.MaxDatagramFrameSize)))
 	s.streamsMap.UpdateLimits(params)
 	if params.OmitConnectionID {
 		s.packer.SetOmitConnectionID()
 	}
 	if params.MaxPacketSize != 0 {
 		s.packer.SetMaxPacketSize(params.MaxPacketSize)
+		if s.mtuDiscoverer != nil {
+			s.mtuDiscoverer.SetMax(params.MaxPacketSize)
+		}
+	}
+	if params.StatelessResetToken != nil {
+		s.sessionRunner.addResetToken(*params.StatelessResetToken)
 	}
 	s.connFlowController.UpdateSendWindow(params.ConnectionFlowControlWindow)
 	// the crypto stream is the only open stream at this moment
 	// so we don't need to update stream flow control windows
 }
 
+// sendPackets sends as many packets as allowed by congestion control and pacing.
+// All packets are handed to the connection in a single batch.
 func (s *session) sendPackets() error {
+	s.batchPackets = true
+	err := s.sendPacketBurst()
+	s.batchPackets = false
+	if flushErr := s.flushPacketBatch(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func (s *session) sendPacketBurst() error {
 	s.pacingDeadline = time.Time{}
 
 	sendMode := s.sentPacketHandler.SendMode()
 	if sendMode == ackhandler.SendNone { // shortcut: return immediately if there's nothing to send
 		return nil
 	}
+	if s.isAmplificationLimited() {
+		return nil
+	}
 
 	numPackets := s.sentPacketHandler.ShouldSendNumPackets()
 	var numPacketsSent int
@@ -950,18 +1651,24 @@ sendLoop:
 				// e.g. when an Initial is queued, but we already received a packet from the server.
 			}
 		case ackhandler.SendAny:
-			sentPacket, err := s.sendPacket()
+			sentPacket, err := s.maybeSendMTUProbe()
 			if err != nil {
 				return err
 			}
 			if !sentPacket {
-				break sendLoop
+				sentPacket, err = s.sendPacket()
+				if err != nil {
+					return err
+				}
+				if !sentPacket {
+					break sendLoop
+				}
 			}
 			numPacketsSent++
 		default:
 			return fmt.Errorf("BUG: invalid send mode %d", sendMode)
 		}
-		if numPacketsSent >= numPackets {
+		if numPacketsSent >= numPackets || s.isAmplificationLimited() {
 			break
 		}
 		sendMode = s.sentPacketHandler.SendMode()
@@ -974,6 +1681,24 @@ sendLoop:
 	return nil
 }
 
+// maybeSendMTUProbe sends an MTU probe, if path MTU discovery is enabled and it's time to send the next probe.
+func (s *session) maybeSendMTUProbe() (bool, error) {
+	now := time.Now()
+	if !s.handshakeComplete || s.mtuDiscoverer == nil || !s.mtuDiscoverer.ShouldSendProbe(now) {
+		return false, nil
+	}
+	packet, err := s.packer.PackMTUProbePacket(&wire.PingFrame{}, s.mtuDiscoverer.NextProbeSize(now))
+	if err != nil {
+		return false, err
+	}
+	// probes are never marked, such that their loss doesn't affect the ECN validation
+	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	if err := s.sendPackedPacket(packet); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (s *session) maybeSendAckOnlyPacket() error {
 	ack := s.receivedPacketHandler.GetAckFrame()
 	if ack == nil {
@@ -990,6 +1715,7 @@ func (s *session) maybeSendAckOnlyPacket() error {
 	if err != nil {
 		return err
 	}
+	packet.ecn = s.sentPacketHandler.ECNMode()
 	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
 	return s.sendPackedPacket(packet)
 }
@@ -1028,7 +1754,9 @@ func (s *session) maybeSendRetransmission() (bool, error) {
 		return false, err
 	}
 	ackhandlerPackets := make([]*ackhandler.Packet, len(packets))
+	ecn := s.sentPacketHandler.ECNMode()
 	for i, packet := range packets {
+		packet.ecn = ecn
 		ackhandlerPackets[i] = packet.ToAckHandlerPacket()
 	}
 	s.sentPacketHandler.SentPacketsAsRetransmission(ackhandlerPackets, retransmitPacket.PacketNumber)
@@ -1043,6 +1771,7 @@ func (s *session) maybeSendRetransmission() (bool, error) {
 func (s *session) sendPacket() (bool, error) {
 	if isBlocked, offset := s.connFlowController.IsNewlyBlocked(); isBlocked {
 		s.packer.QueueControlFrame(&wire.BlockedFrame{Offset: offset})
+		s.connFlowControlBlockedCount++
 	}
 	s.windowUpdateQueue.QueueAll()
 
@@ -1059,6 +1788,7 @@ func (s *session) sendPacket() (bool, error) {
 	if err != nil || packet == nil {
 		return false, err
 	}
+	packet.ecn = s.sentPacketHandler.ECNMode()
 	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
 	if err := s.sendPackedPacket(packet); err != nil {
 		return false, err
@@ -1066,10 +1796,194 @@ func (s *session) sendPacket() (bool, error) {
 	return true, nil
 }
 
+// sendPackedPacket sends a packet.
+// During a send burst, the packet is queued, and only written when the batch is flushed.
 func (s *session) sendPackedPacket(packet *packedPacket) error {
+	if !s.batchPackets {
+		return s.writePackedPacket(packet)
+	}
+	s.onPackedPacketSent(packet)
+	s.packetBatch = append(s.packetBatch, packet)
+	return nil
+}
+
+func (s *session) writePackedPacket(packet *packedPacket) error {
 	defer putPacketBuffer(&packet.raw)
+	s.onPackedPacketSent(packet)
+	err := s.conn.Write(packet.raw, packet.ecn)
+	if isMsgSizeErr(err) {
+		s.onMsgSizeErr([]*packedPacket{packet})
+		return nil
+	}
+	return err
+}
+
+// onMsgSizeErr is called when a packet couldn't be sent, because it was larger than the MTU of the network interface.
+// This is not a fatal error: the packet will be declared lost, and the packet size is reduced.
+// When writing a batch, we don't know which packet was too large. If the batch contained an MTU probe,
+// it was the largest packet, and most likely the one that was too large.
+func (s *session) onMsgSizeErr(packets []*packedPacket) {
+	if s.mtuDiscoverer == nil {
+		// Sessions that don't perform path MTU discovery might share the socket with sessions that do,
+		// and therefore send their packets with the DF bit set.
+		// We don't know which packet size works, so we fall back to the smallest size that QUIC requires a path to support.
+		s.logger.Debugf("Packet too large for the network interface. Reducing the packet size to %d bytes.", protocol.MinInitialPacketSize)
+		s.packer.SetMaxPacketSize(protocol.MinInitialPacketSize)
+		return
+	}
+	var size protocol.ByteCount
+	for _, p := range packets {
+		if p.isMTUProbe {
+			s.mtuDiscoverer.PacketTooLarge(protocol.ByteCount(len(p.raw)))
+			return
+		}
+		size = utils.MaxByteCount(size, protocol.ByteCount(len(p.raw)))
+	}
+	s.mtuDiscoverer.PacketTooLarge(size)
+}
+
+func (s *session) onPackedPacketSent(packet *packedPacket) {
+	if s.pathValidation != nil {
+		s.pathValidation.bytesSent += protocol.ByteCount(len(packet.raw))
+	}
 	s.logPacket(packet)
-	return s.conn.Write(packet.raw)
+	s.traceSentPacket(packet)
+}
+
+// flushPacketBatch writes all packets queued during a send burst.
+func (s *session) flushPacketBatch() error {
+	if len(s.packetBatch) == 0 {
+		return nil
+	}
+	batch := make([]rawPacket, len(s.packetBatch))
+	for i, packet := range s.packetBatch {
+		batch[i] = rawPacket{data: packet.raw, ecn: packet.ecn}
+	}
+	err := s.conn.WriteBatch(batch)
+	// The other packets of the batch were still sent.
+	if isMsgSizeErr(err) {
+		s.onMsgSizeErr(s.packetBatch)
+		err = nil
+	}
+	for i, packet := range s.packetBatch {
+		putPacketBuffer(&packet.raw)
+		s.packetBatch[i] = nil
+	}
+	s.packetBatch = s.packetBatch[:0]
+	return err
+}
+
+// startPathValidation is called from the run loop when MigrateTo is called.
+func (s *session) startPathValidation(pv *pathValidation) {
+	if !s.handshakeComplete {
+		pv.fail(errors.New("can't migrate the connection before the handshake completes"))
+		return
+	}
+	if s.pathValidation != nil {
+		pv.fail(errors.New("a connection migration is already in progress"))
+		return
+	}
+	// use a new connection ID on the new path, such that an observer can't link the two paths
+	f, ok := s.peerConnIDs.Get()
+	if !ok {
+		pv.fail(errors.New("can't migrate the connection: no unused connection ID available"))
+		return
+	}
+	pv.connID, pv.connIDSeq = f.ConnectionID, f.SequenceNumber
+	if s.mtuDiscoverer != nil {
+		if err := pv.conn.SetDF(); err != nil {
+			s.logger.Debugf("Setting the Don't Fragment bit failed: %s", err)
+		}
+	}
+	s.logger.Infof("Validating new path from %s to %s.", pv.conn.LocalAddr(), pv.conn.RemoteAddr())
+	s.sessionRunner.addPath(pv.conn)
+	s.pathValidation = pv
+}
+
+// sendPathChallenge sends a PATH_CHALLENGE on the path that is being validated.
+// If too many PATH_CHALLENGEs have already been sent, the path validation fails.
+func (s *session) sendPathChallenge(now time.Time) error {
+	pv := s.pathValidation
+	if pv.numChallengesSent >= protocol.MaxPathChallenges {
+		s.logger.Infof("Path validation failed. Didn't receive a PATH_RESPONSE for %d PATH_CHALLENGEs.", pv.numChallengesSent)
+		s.failPathValidation(errors.New("path validation failed: no PATH_RESPONSE received"))
+		return nil
+	}
+	packet, err := s.packer.PackProbingPacket(&wire.PathChallengeFrame{Data: pv.challenge}, pv.connID)
+	if err != nil {
+		return err
+	}
+	defer putPacketBuffer(&packet.raw)
+	pv.numChallengesSent++
+	pv.nextChallenge = now.Add(3 * s.rttStats.SmoothedOrInitialRTT())
+	pv.bytesSent += protocol.ByteCount(len(packet.raw))
+	s.sentPathChallenge = true
+	s.sentPacketHandler.SentPacket(packet.ToAckHandlerPacket())
+	s.logPacket(packet)
+	s.traceSentPacket(packet)
+	// probe packets are never marked, since ECN hasn't been validated on the new path yet
+	if err := pv.conn.Write(packet.raw, protocol.ECNNon); err != nil {
+		// An error on the new path doesn't affect the connection.
+		s.logger.Infof("Path validation failed. Error sending a PATH_CHALLENGE: %s", err)
+		s.failPathValidation(err)
+	}
+	return nil
+}
+
+// failPathValidation aborts the current path validation.
+// When validating a new address of the peer, we return to the previous address.
+func (s *session) failPathValidation(err error) {
+	pv := s.pathValidation
+	s.pathValidation = nil
+	if pv.previousAddr != nil {
+		s.logger.Infof("Returning to the previous client address %s.", pv.previousAddr)
+		s.restorePreviousConnID(pv)
+		s.conn.SetCurrentRemoteAddr(pv.previousAddr)
+	} else {
+		// the connection ID was used on the new path, so it must not be used on any other path
+		s.retireConnectionID(pv.connIDSeq)
+		s.sessionRunner.removePath(pv.conn)
+	}
+	pv.fail(err)
+}
+
+// closePath is called when reading from a path added by MigrateTo failed.
+func (s *session) closePath(c connection, err error) {
+	select {
+	case s.pathErrors <- pathError{conn: c, err: err}:
+	case <-s.ctx.Done():
+	}
+}
+
+// handlePathError handles an error reading from a path added by MigrateTo.
+// If the path is still being validated, only the path validation fails, and we keep using the current path.
+// If we already migrated to the path, the session is closed.
+func (s *session) handlePathError(e pathError) {
+	if pv := s.pathValidation; pv != nil && pv.done != nil && pv.conn == e.conn {
+		s.logger.Infof("Path validation failed. Error reading from the new path: %s", e.err)
+		s.failPathValidation(e.err)
+		return
+	}
+	if e.conn == s.conn {
+		s.closeLocal(e.err)
+	}
+}
+
+// streamDataLen is the number of bytes of application data in STREAM frames.
+func streamDataLen(frames []wire.Frame, version protocol.VersionNumber) protocol.ByteCount {
+	var n protocol.ByteCount
+	for _, f := range frames {
+		if sf, ok := f.(*wire.StreamFrame); ok && sf.StreamID != version.CryptoStreamID() {
+			n += sf.DataLen()
+		}
+	}
+	return n
+}
+
+// isAmplificationLimited says if we're not allowed to send any more packets to a new address of the peer, until this address is validated.
+func (s *session) isAmplificationLimited() bool {
+	pv := s.pathValidation
+	return pv != nil && pv.previousAddr != nil && pv.bytesSent >= protocol.AmplificationFactor*pv.bytesReceived
 }
 
 func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
@@ -1081,7 +1995,37 @@ func (s *session) sendConnectionClose(quicErr *qerr.QuicError) error {
 		return err
 	}
 	s.logPacket(packet)
-	return s.conn.Write(packet.raw)
+	s.traceSentPacket(packet)
+	return s.conn.Write(packet.raw, protocol.ECNNon)
+}
+
+func (s *session) traceSentPacket(packet *packedPacket) {
+	if s.tracer == nil {
+		return
+	}
+	s.tracer.SentPacket(&PacketInfo{
+		Type:             packetType(packet.header),
+		DestConnectionID: packet.header.DestConnectionID,
+		SrcConnectionID:  packet.header.SrcConnectionID,
+		PacketNumber:     packet.header.PacketNumber,
+		EncryptionLevel:  packet.encryptionLevel,
+		Size:             protocol.ByteCount(len(packet.raw)),
+		Frames:           packet.frames,
+	})
+}
+
+func (s *session) traceDroppedPacket(p *receivedPacket, reason PacketDropReason) {
+	if s.tracer != nil {
+		s.tracer.DroppedPacket(reason, protocol.ByteCount(len(p.header.Raw)+len(p.data)))
+	}
+}
+
+// packetType returns the type of packets with a long header, and 0 for all other packets
+func packetType(hdr *wire.Header) protocol.PacketType {
+	if hdr.IsLongHeader {
+		return hdr.Type
+	}
+	return 0
 }
 
 func (s *session) logPacket(packet *packedPacket) {
@@ -1122,21 +2066,85 @@ func (s *session) AcceptUniStream() (ReceiveStream, error) {
 
 // OpenStream opens a stream
 func (s *session) OpenStream() (Stream, error) {
+	if s.peerGoingAway.Get() {
+		return nil, errPeerGoingAway
+	}
 	return s.streamsMap.OpenStream()
 }
 
 func (s *session) OpenStreamSync() (Stream, error) {
+	if s.peerGoingAway.Get() {
+		return nil, errPeerGoingAway
+	}
 	return s.streamsMap.OpenStreamSync()
 }
 
 func (s *session) OpenUniStream() (SendStream, error) {
+	if s.peerGoingAway.Get() {
+		return nil, errPeerGoingAway
+	}
 	return s.streamsMap.OpenUniStream()
 }
 
 func (s *session) OpenUniStreamSync() (SendStream, error) {
+	if s.peerGoingAway.Get() {
+		return nil, errPeerGoingAway
+	}
 	return s.streamsMap.OpenUniStreamSync()
 }
 
+// SendMessage sends a message as an (unreliable) DATAGRAM frame.
+// It blocks until the frame was packed into a packet.
+func (s *session) SendMessage(p []byte) error {
+	if s.datagramQueue == nil {
+		return errors.New("DATAGRAM support disabled")
+	}
+	// The peer's transport parameters are received before the handshake completes.
+	maxSize := protocol.ByteCount(atomic.LoadUint64(&s.maxDatagramFrameSize))
+	if maxSize == 0 {
+		return errors.New("peer doesn't support DATAGRAM frames")
+	}
+	f := &wire.DatagramFrame{DataLenPresent: true}
+	if f.Length(s.version)+protocol.ByteCount(len(p)) > maxSize {
+		return fmt.Errorf("message too large (maximum DATAGRAM frame size: %d bytes)", maxSize)
+	}
+	// make a copy, since the frame is sent asynchronously
+	f.Data = make([]byte, len(p))
+	copy(f.Data, p)
+	return s.datagramQueue.AddAndWait(f)
+}
+
+// MigrateTo migrates the connection to a new net.PacketConn.
+// It blocks until the new path was validated, or the path validation failed.
+// pconn is never closed, since it is owned by the caller.
+func (s *session) MigrateTo(pconn net.PacketConn) error {
+	if s.perspective != protocol.PerspectiveClient || !s.version.UsesTLS() {
+		return errors.New("connection migration is only supported by IETF QUIC clients")
+	}
+	pv := &pathValidation{
+		conn: &conn{pconn: wrapConn(pconn), currentAddr: s.RemoteAddr()},
+		done: make(chan error, 1),
+	}
+	if _, err := rand.Read(pv.challenge[:]); err != nil {
+		return err
+	}
+	select {
+	case s.pathValidationRequests <- pv:
+	case <-s.ctx.Done():
+		return errors.New("session closed")
+	}
+	return <-pv.done
+}
+
+// ReceiveMessage gets a message received in a DATAGRAM frame.
+// It blocks until a message is received, or the session is closed.
+func (s *session) ReceiveMessage() ([]byte, error) {
+	if s.datagramQueue == nil {
+		return nil, errors.New("DATAGRAM support disabled")
+	}
+	return s.datagramQueue.Receive()
+}
+
 func (s *session) newStream(id protocol.StreamID) streamI {
 	flowController := s.newFlowController(id)
 	str := newStream(id, s, flowController, s.version)
@@ -1182,7 +2190,7 @@ func (s *session) newCryptoStream() cryptoStreamI {
 
 func (s *session) sendPublicReset(rejectedPacketNumber protocol.PacketNumber) error {
 	s.logger.Infof("Sending public reset for connection %x, packet number %d", s.destConnID, rejectedPacketNumber)
-	return s.conn.Write(wire.WritePublicReset(s.destConnID, rejectedPacketNumber, 0))
+	return s.conn.Write(wire.WritePublicReset(s.destConnID, rejectedPacketNumber, 0), protocol.ECNNon)
 }
 
 // scheduleSending signals that we have data for sending
@@ -1196,6 +2204,14 @@ func (s *session) scheduleSending() {
 func (s *session) tryQueueingUndecryptablePacket(p *receivedPacket) {
 	if s.handshakeComplete {
 		s.logger.Debugf("Received undecryptable packet from %s after the handshake: %#v, %d bytes data", p.remoteAddr.String(), p.header, len(p.data))
+		s.traceDroppedPacket(p, PacketDropUndecryptable)
+		return
+	}
+	// The server derives the 0-RTT keys when creating the session.
+	// A 0-RTT packet that can't be decrypted will never be decryptable, e.g. because 0-RTT was rejected.
+	if s.perspective == protocol.PerspectiveServer && p.header.IsLongHeader && p.header.Type == protocol.PacketType0RTT {
+		s.logger.Debugf("Dropping undecryptable 0-RTT packet 0x%x", p.header.PacketNumber)
+		s.traceDroppedPacket(p, PacketDropUndecryptable)
 		return
 	}
 	if len(s.undecryptablePackets)+1 > protocol.MaxUndecryptablePackets {
@@ -1205,6 +2221,7 @@ func (s *session) tryQueueingUndecryptablePacket(p *receivedPacket) {
 			s.maybeResetTimer()
 		}
 		s.logger.Infof("Dropping undecrytable packet 0x%x (undecryptable packet queue full)", p.header.PacketNumber)
+		s.traceDroppedPacket(p, PacketDropUndecryptable)
 		return
 	}
 	s.logger.Infof("Queueing packet 0x%x for later decryption", p.header.PacketNumber)
@@ -1219,6 +2236,10 @@ func (s *session) tryDecryptingQueuedPackets() {
 }
 
 func (s *session) queueControlFrame(f wire.Frame) {
+	// STREAM_BLOCKED frames are queued by the send stream when it packs a STREAM frame, i.e. from the run loop.
+	if _, ok := f.(*wire.StreamBlockedFrame); ok {
+		s.streamFlowControlBlockedCount++
+	}
 	s.packer.QueueControlFrame(f)
 	s.scheduleSending()
 }
@@ -1238,17 +2259,27 @@ func (s *session) onHasStreamData(id protocol.StreamID) {
 	s.scheduleSending()
 }
 
+func (s *session) setStreamPriority(id protocol.StreamID, p Priority) {
+	s.streamFramer.SetStreamPriority(id, p)
+	s.scheduleSending()
+}
+
 func (s *session) onStreamCompleted(id protocol.StreamID) {
+	s.streamFramer.RemoveStream(id)
 	if err := s.streamsMap.DeleteStream(id); err != nil {
 		s.Close(err)
 	}
 }
 
 func (s *session) LocalAddr() net.Addr {
+	s.connMutex.RLock()
+	defer s.connMutex.RUnlock()
 	return s.conn.LocalAddr()
 }
 
 func (s *session) RemoteAddr() net.Addr {
+	s.connMutex.RLock()
+	defer s.connMutex.RUnlock()
 	return s.conn.RemoteAddr()
 }
 
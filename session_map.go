@@ -38,6 +38,19 @@ func (h *sessionMap) Add(id protocol.ConnectionID, sess packetHandler) {
 	h.mutex.Unlock()
 }
 
+// AddIfNotTaken adds a session, if the connection ID is not used by another session yet.
+// It returns if the session was added.
+func (h *sessionMap) AddIfNotTaken(id protocol.ConnectionID, sess packetHandler) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if _, ok := h.sessions[string(id)]; ok {
+		return false
+	}
+	h.sessions[string(id)] = sess
+	return true
+}
+
 func (h *sessionMap) Remove(id protocol.ConnectionID) {
 	h.mutex.Lock()
 	h.sessions[string(id)] = nil
@@ -57,18 +70,38 @@ func (h *sessionMap) Close() {
 		return
 	}
 	h.closed = true
+	h.mutex.Unlock()
+
+	h.forEachSession(func(sess packetHandler) {
+		// session.Close() blocks until the CONNECTION_CLOSE has been sent and the run-loop has stopped
+		_ = sess.Close(nil)
+	})
+}
+
+// CloseGracefully closes all sessions gracefully, and waits until they are closed.
+// Sessions are closed immediately when the timeout elapses.
+func (h *sessionMap) CloseGracefully(timeout time.Duration) {
+	h.forEachSession(func(sess packetHandler) {
+		_ = sess.CloseGracefully(timeout)
+	})
+}
 
+// forEachSession calls f for every session in parallel, and waits until all calls have returned.
+func (h *sessionMap) forEachSession(f func(packetHandler)) {
 	var wg sync.WaitGroup
+	h.mutex.RLock()
+	// a session is stored once for every connection ID it uses, but must only be handled once
+	sessions := make(map[packetHandler]struct{})
 	for _, session := range h.sessions {
-		if session != nil {
+		if _, ok := sessions[session]; session != nil && !ok {
+			sessions[session] = struct{}{}
 			wg.Add(1)
 			go func(sess packetHandler) {
-				// session.Close() blocks until the CONNECTION_CLOSE has been sent and the run-loop has stopped
-				_ = sess.Close(nil)
+				f(sess)
 				wg.Done()
 			}(session)
 		}
 	}
-	h.mutex.Unlock()
+	h.mutex.RUnlock()
 	wg.Wait()
 }
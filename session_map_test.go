@@ -24,6 +24,17 @@ var _ = Describe("Session Handler", func() {
 		Expect(session).To(Equal(sess))
 	})
 
+	It("only adds a session if the connection ID is not taken", func() {
+		connID := protocol.ConnectionID{1, 2, 3, 4, 5}
+		sess1 := &mockSession{}
+		sess2 := &mockSession{}
+		Expect(handler.AddIfNotTaken(connID, sess1)).To(BeTrue())
+		Expect(handler.AddIfNotTaken(connID, sess2)).To(BeFalse())
+		session, ok := handler.Get(connID)
+		Expect(ok).To(BeTrue())
+		Expect(session).To(BeIdenticalTo(sess1))
+	})
+
 	It("deletes", func() {
 		connID := protocol.ConnectionID{1, 2, 3, 4, 5}
 		handler.Add(connID, &mockSession{})
@@ -53,4 +64,23 @@ var _ = Describe("Session Handler", func() {
 		handler.Add(protocol.ConnectionID{2, 2, 2, 2}, sess2)
 		handler.Close()
 	})
+
+	It("closes sessions with multiple connection IDs only once", func() {
+		sess := NewMockPacketHandler(mockCtrl)
+		sess.EXPECT().Close(nil)
+		handler.Add(protocol.ConnectionID{1, 1, 1, 1}, sess)
+		handler.Add(protocol.ConnectionID{2, 2, 2, 2}, sess)
+		handler.Close()
+	})
+
+	It("closes sessions gracefully", func() {
+		sess1 := NewMockPacketHandler(mockCtrl)
+		sess1.EXPECT().CloseGracefully(time.Second)
+		sess2 := NewMockPacketHandler(mockCtrl)
+		sess2.EXPECT().CloseGracefully(time.Second)
+		handler.Add(protocol.ConnectionID{1, 1, 1, 1}, sess1)
+		handler.Add(protocol.ConnectionID{2, 2, 2, 2}, sess1)
+		handler.Add(protocol.ConnectionID{3, 3, 3, 3}, sess2)
+		handler.CloseGracefully(time.Second)
+	})
 })
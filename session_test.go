@@ -7,8 +7,11 @@ import (
 	"errors"
 	"io"
 	"net"
+	"os"
 	"runtime/pprof"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/golang/mock/gomock"
@@ -28,19 +31,35 @@ import (
 )
 
 type mockConnection struct {
-	remoteAddr net.Addr
-	localAddr  net.Addr
-	written    chan []byte
+	remoteAddr  net.Addr
+	localAddr   net.Addr
+	written     chan []byte
+	batchSizes  chan int     // the number of packets written in every call to WriteBatch
+	writtenTo   net.Addr     // the address of the last packet written using WriteTo
+	ecn         protocol.ECN // the ECN codepoint of the last packet written using Write
+	supportsECN bool
+	packetConn  rawConn // the socket set using SetPacketConn
+	df          bool    // set when SetDF is called
+	writeErr    error   // returned by Write and WriteBatch
+	closed      bool
 }
 
 func newMockConnection() *mockConnection {
 	return &mockConnection{
 		remoteAddr: &net.UDPAddr{},
 		written:    make(chan []byte, 100),
+		batchSizes: make(chan int, 100),
 	}
 }
 
-func (m *mockConnection) Write(p []byte) error {
+func (m *mockConnection) Write(p []byte, ecn protocol.ECN) error {
+	m.ecn = ecn
+	return m.write(p)
+}
+func (m *mockConnection) write(p []byte) error {
+	if m.writeErr != nil {
+		return m.writeErr
+	}
 	b := make([]byte, len(p))
 	copy(b, p)
 	select {
@@ -50,14 +69,36 @@ func (m *mockConnection) Write(p []byte) error {
 	}
 	return nil
 }
-func (m *mockConnection) Read([]byte) (int, net.Addr, error) { panic("not implemented") }
+func (m *mockConnection) WriteBatch(ps []rawPacket) error {
+	for _, p := range ps {
+		if err := m.Write(p.data, p.ecn); err != nil {
+			return err
+		}
+	}
+	m.batchSizes <- len(ps)
+	return nil
+}
+func (m *mockConnection) WriteTo(p []byte, addr net.Addr) error {
+	m.writtenTo = addr
+	return m.write(p)
+}
+func (m *mockConnection) Read([]byte) (int, net.Addr, protocol.ECN, error) {
+	panic("not implemented")
+}
+func (m *mockConnection) ReadBatch([]rawPacket) (int, error) {
+	panic("not implemented")
+}
+func (m *mockConnection) SupportsECN() bool { return m.supportsECN }
+func (m *mockConnection) SetDF() error      { m.df = true; return nil }
 
 func (m *mockConnection) SetCurrentRemoteAddr(addr net.Addr) {
 	m.remoteAddr = addr
 }
-func (m *mockConnection) LocalAddr() net.Addr  { return m.localAddr }
-func (m *mockConnection) RemoteAddr() net.Addr { return m.remoteAddr }
-func (*mockConnection) Close() error           { panic("not implemented") }
+func (m *mockConnection) SetPacketConn(c rawConn)         { m.packetConn = c }
+func (m *mockConnection) SetReadDeadline(time.Time) error { return nil }
+func (m *mockConnection) LocalAddr() net.Addr             { return m.localAddr }
+func (m *mockConnection) RemoteAddr() net.Addr            { return m.remoteAddr }
+func (m *mockConnection) Close() error                    { m.closed = true; return nil }
 
 func areSessionsRunning() bool {
 	var b bytes.Buffer
@@ -218,6 +259,16 @@ var _ = Describe("Session", func() {
 				Expect(err).To(MatchError(testErr))
 			})
 
+			It("remembers the largest stream opened by the peer", func() {
+				streamManager.EXPECT().GetOrOpenReceiveStream(gomock.Any()).Return(nil, nil).Times(3)
+				for _, id := range []protocol.StreamID{5, 8, 3} {
+					err := sess.handleStreamFrame(&wire.StreamFrame{StreamID: id}, protocol.EncryptionForwardSecure)
+					Expect(err).ToNot(HaveOccurred())
+				}
+				// stream 8 was opened by the server
+				Expect(sess.largestPeerStreamID).To(Equal(protocol.StreamID(5)))
+			})
+
 			It("ignores STREAM frames for closed streams", func() {
 				streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(5)).Return(nil, nil) // for closed streams, the streamManager returns nil
 				err := sess.handleStreamFrame(&wire.StreamFrame{
@@ -462,9 +513,18 @@ var _ = Describe("Session", func() {
 			Expect(err).NotTo(HaveOccurred())
 		})
 
-		It("errors on GOAWAY frames", func() {
-			err := sess.handleFrames([]wire.Frame{&wire.GoawayFrame{}}, protocol.EncryptionUnspecified)
-			Expect(err).To(MatchError("unimplemented: handling GOAWAY frames"))
+		It("handles GOAWAY frames", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.GoawayFrame{ErrorCode: qerr.PeerGoingAway, LastGoodStream: 5}}, protocol.EncryptionUnspecified)
+			Expect(err).NotTo(HaveOccurred())
+			// no new streams can be opened after receiving a GOAWAY frame
+			_, err = sess.OpenStream()
+			Expect(err).To(MatchError(errPeerGoingAway))
+			_, err = sess.OpenStreamSync()
+			Expect(err).To(MatchError(errPeerGoingAway))
+			_, err = sess.OpenUniStream()
+			Expect(err).To(MatchError(errPeerGoingAway))
+			_, err = sess.OpenUniStreamSync()
+			Expect(err).To(MatchError(errPeerGoingAway))
 		})
 
 		It("handles STOP_WAITING frames", func() {
@@ -500,6 +560,144 @@ var _ = Describe("Session", func() {
 		Expect(str).To(Equal(mstr))
 	})
 
+	Context("closing gracefully", func() {
+		var numStreams int32 // accessed atomically
+
+		BeforeEach(func() {
+			atomic.StoreInt32(&numStreams, 1)
+			streamManager.EXPECT().NumStreams().DoAndReturn(func() int {
+				return int(atomic.LoadInt32(&numStreams))
+			}).AnyTimes()
+		})
+
+		It("sends a GOAWAY frame, and closes once all streams have completed", func() {
+			unpacker := NewMockUnpacker(mockCtrl)
+			sess.unpacker = unpacker
+			sess.largestPeerStreamID = 7
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			sess.receivedFirstForwardSecurePacket = true
+			sess.sentPacketHandler.SetHandshakeComplete()
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+			}()
+			closed := make(chan struct{})
+			streamManager.EXPECT().StopIssuingMaxStreamID()
+			go func() {
+				defer GinkgoRecover()
+				Expect(sess.CloseGracefully(time.Hour)).To(Succeed())
+				close(closed)
+			}()
+			var data []byte
+			Eventually(mconn.written).Should(Receive(&data))
+			buf := &bytes.Buffer{}
+			err := (&wire.GoawayFrame{ErrorCode: qerr.PeerGoingAway, LastGoodStream: 7, ReasonPhrase: "shutting down"}).Write(buf, sess.version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(buf.String()))
+			Consistently(closed).ShouldNot(BeClosed())
+			// complete all streams, and acknowledge the packet containing the GOAWAY frame
+			atomic.StoreInt32(&numStreams, 0)
+			streamManager.EXPECT().CloseWithError(qerr.Error(qerr.PeerGoingAway, ""))
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+				encryptionLevel: protocol.EncryptionForwardSecure,
+				frames:          []wire.Frame{&wire.AckFrame{AckRanges: []wire.AckRange{{Smallest: 1, Largest: 1}}}},
+			}, nil)
+			sess.handlePacket(&receivedPacket{
+				header:  &wire.Header{PacketNumber: 1, PacketNumberLen: protocol.PacketNumberLen2, Raw: *getPacketBuffer()},
+				rcvTime: time.Now(),
+			})
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("refuses streams opened by the peer after sending a GOAWAY frame", func() {
+			sess.largestPeerStreamID = 7
+			streamManager.EXPECT().StopIssuingMaxStreamID()
+			sess.goAway(time.Now().Add(time.Hour))
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+			// streams below the last good stream are still processed
+			str := NewMockReceiveStreamI(mockCtrl)
+			streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(5)).Return(str, nil)
+			f := &wire.StreamFrame{StreamID: 5, Data: []byte("foobar")}
+			str.EXPECT().handleStreamFrame(f)
+			Expect(sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)).To(Succeed())
+			// new streams are opened, such that the data counts towards flow control, and reset
+			newStr := NewMockStreamI(mockCtrl)
+			newStr.EXPECT().StreamID().Return(protocol.StreamID(9)).AnyTimes()
+			streamManager.EXPECT().GetOrOpenReceiveStream(protocol.StreamID(9)).Return(newStr, nil)
+			streamManager.EXPECT().GetOrOpenSendStream(protocol.StreamID(9)).Return(newStr, nil)
+			f = &wire.StreamFrame{StreamID: 9, Data: []byte("foobar")}
+			gomock.InOrder(
+				newStr.EXPECT().handleStreamFrame(f),
+				newStr.EXPECT().CancelRead(streamPeerGoingAway),
+				newStr.EXPECT().CancelWrite(streamPeerGoingAway),
+			)
+			Expect(sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)).To(Succeed())
+			Expect(sess.largestPeerStreamID).To(Equal(protocol.StreamID(7)))
+		})
+
+		It("counts the data of refused streams towards connection flow control", func() {
+			sess.largestPeerStreamID = 7
+			streamManager.EXPECT().StopIssuingMaxStreamID()
+			sess.goAway(time.Now().Add(time.Hour))
+			sess.streamsMap = newStreamsMapLegacy(sess.newStream, 100, protocol.PerspectiveServer)
+			f := &wire.StreamFrame{StreamID: 9, Data: []byte("foobar")}
+			Expect(sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)).To(Succeed())
+			str, err := sess.streamsMap.GetOrOpenReceiveStream(9)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Read([]byte{0})
+			Expect(err).To(MatchError("Read on stream 9 canceled with error code 7"))
+			Expect(sess.packer.controlFrames).To(ContainElement(&wire.RstStreamFrame{StreamID: 9, ErrorCode: streamPeerGoingAway}))
+			// the peer has to respect the connection flow control window on refused streams
+			f = &wire.StreamFrame{StreamID: 11, Data: make([]byte, protocol.ReceiveConnectionFlowControlWindow/2)}
+			Expect(sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)).To(Succeed())
+			f = &wire.StreamFrame{StreamID: 13, Data: make([]byte, protocol.ReceiveConnectionFlowControlWindow/2)}
+			err = sess.handleStreamFrame(f, protocol.EncryptionForwardSecure)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.FlowControlReceivedTooMuchData))
+			Expect(err.Error()).To(ContainSubstring("for the connection"))
+		})
+
+		It("stops raising the stream limits, for IETF QUIC", func() {
+			sess.version = versionIETFFrames
+			streamManager.EXPECT().StopIssuingMaxStreamID()
+			sess.goAway(time.Now().Add(time.Hour))
+			// there's no GOAWAY frame in IETF QUIC
+			Expect(sess.packer.controlFrames).To(BeEmpty())
+		})
+
+		It("closes when the timeout elapses", func() {
+			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+			}()
+			streamManager.EXPECT().StopIssuingMaxStreamID()
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			Expect(sess.CloseGracefully(50 * time.Millisecond)).To(Succeed())
+			Expect(sess.Context().Done()).To(BeClosed())
+			var data []byte
+			Expect(mconn.written).To(Receive()) // the GOAWAY frame
+			Expect(mconn.written).To(Receive(&data))
+			buf := &bytes.Buffer{}
+			err := (&wire.ConnectionCloseFrame{ErrorCode: qerr.PeerGoingAway, ReasonPhrase: "Streams did not complete before the shutdown deadline."}).Write(buf, sess.version)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(data)).To(ContainSubstring(buf.String()))
+		})
+
+		It("returns immediately if the session is already closed", func() {
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+			}()
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			Expect(sess.Close(nil)).To(Succeed())
+			Expect(sess.CloseGracefully(time.Hour)).To(Succeed())
+		})
+	})
+
 	Context("closing", func() {
 		BeforeEach(func() {
 			Eventually(areSessionsRunning).Should(BeFalse())
@@ -609,23 +807,39 @@ var _ = Describe("Session", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
 			now := time.Now().Add(time.Hour)
 			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
-			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(5), now, false)
+			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(5), protocol.ECNNon, now, false)
 			sess.receivedPacketHandler = rph
 			hdr.PacketNumber = 5
 			err := sess.handlePacketImpl(&receivedPacket{header: hdr, rcvTime: now})
 			Expect(err).ToNot(HaveOccurred())
 		})
 
-		It("doesn't inform the ReceivedPacketHandler about Retry packets", func() {
-			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil)
-			now := time.Now().Add(time.Hour)
+		It("drops 0-RTT packets once the client sent more 0-RTT data than allowed, for the server", func() {
+			sess.perspective = protocol.PerspectiveServer
+			sess.config.Max0RTTData = 10
+			hdr.IsLongHeader = true
+			hdr.Type = protocol.PacketType0RTT
+			hdr.Raw = []byte("raw")
 			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
 			sess.receivedPacketHandler = rph
-			// don't EXPECT any call to ReceivedPacket
-			hdr.PacketNumber = 5
-			hdr.Type = protocol.PacketTypeRetry
-			err := sess.handlePacketImpl(&receivedPacket{header: hdr, rcvTime: now})
-			Expect(err).ToNot(HaveOccurred())
+			streamManager.EXPECT().GetOrOpenReceiveStream(gomock.Any()).Return(nil, nil).AnyTimes()
+			receive0RTT := func(pn protocol.PacketNumber, data []byte) {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+					encryptionLevel: protocol.EncryptionSecure,
+					frames:          []wire.Frame{&wire.StreamFrame{StreamID: 5, Data: data}},
+				}, nil)
+				hdr.PacketNumber = pn
+				// the header and the frame overhead don't count towards the limit
+				Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, data: make([]byte, 100)})).To(Succeed())
+			}
+			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(1), gomock.Any(), gomock.Any(), gomock.Any())
+			rph.EXPECT().ReceivedPacket(protocol.PacketNumber(2), gomock.Any(), gomock.Any(), gomock.Any())
+			receive0RTT(1, []byte("foo"))
+			receive0RTT(2, []byte("foobar"))
+			Expect(sess.received0RTTBytes).To(Equal(protocol.ByteCount(9)))
+			// don't EXPECT any call for the third packet
+			receive0RTT(3, []byte("foo"))
+			Expect(sess.received0RTTBytes).To(Equal(protocol.ByteCount(9)))
 		})
 
 		It("closes when handling a packet fails", func() {
@@ -659,6 +873,30 @@ var _ = Describe("Session", func() {
 			Expect(sess.largestRcvdPacketNumber).To(Equal(protocol.PacketNumber(5)))
 		})
 
+		It("sends on the socket that the last packet was received on", func() {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil).Times(2)
+			pconn1 := wrapConn(newMockPacketConn())
+			pconn2 := wrapConn(newMockPacketConn())
+			hdr.PacketNumber = 5
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, rcvConn: pconn1})).To(Succeed())
+			Expect(mconn.packetConn).To(BeIdenticalTo(pconn1))
+			hdr.PacketNumber = 6
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, rcvConn: pconn2})).To(Succeed())
+			Expect(mconn.packetConn).To(BeIdenticalTo(pconn2))
+		})
+
+		It("doesn't switch sockets for reordered packets", func() {
+			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil).Times(2)
+			pconn1 := wrapConn(newMockPacketConn())
+			pconn2 := wrapConn(newMockPacketConn())
+			hdr.PacketNumber = 6
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, rcvConn: pconn1})).To(Succeed())
+			Expect(mconn.packetConn).To(BeIdenticalTo(pconn1))
+			hdr.PacketNumber = 5
+			Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, rcvConn: pconn2})).To(Succeed())
+			Expect(mconn.packetConn).To(BeIdenticalTo(pconn1))
+		})
+
 		It("handles duplicate packets", func() {
 			unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil).Times(2)
 			hdr.PacketNumber = 5
@@ -682,6 +920,241 @@ var _ = Describe("Session", func() {
 				Expect(err).ToNot(HaveOccurred())
 				Expect(sess.conn.(*mockConnection).remoteAddr).To(Equal(origAddr))
 			})
+
+			Context("for IETF QUIC", func() {
+				var origAddr, newAddr *net.UDPAddr
+
+				BeforeEach(func() {
+					sess.version = protocol.VersionTLS
+					sess.packer.version = protocol.VersionTLS
+					cryptoSetup.encLevelSeal = protocol.EncryptionForwardSecure
+					sess.handshakeComplete = true
+					origAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1234}
+					newAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 4321}
+					mconn.remoteAddr = origAddr
+					sess.largestRcvdPacketNumber = 10
+				})
+
+				retiredConnIDs := func() []uint64 {
+					var seqs []uint64
+					for _, f := range sess.packer.controlFrames {
+						if rcid, ok := f.(*wire.RetireConnectionIDFrame); ok {
+							seqs = append(seqs, rcid.SequenceNumber)
+						}
+					}
+					return seqs
+				}
+
+				receivePacket := func(pn protocol.PacketNumber, addr net.Addr, frames ...wire.Frame) {
+					unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+						encryptionLevel: protocol.EncryptionForwardSecure,
+						frames:          frames,
+					}, nil)
+					err := sess.handlePacketImpl(&receivedPacket{
+						remoteAddr: addr,
+						header:     &wire.Header{PacketNumber: pn, PacketNumberLen: protocol.PacketNumberLen2, Raw: []byte("raw header")},
+						data:       []byte("foobar"),
+					})
+					Expect(err).ToNot(HaveOccurred())
+				}
+
+				It("switches to a new address and validates it", func() {
+					receivePacket(11, newAddr, &wire.PingFrame{})
+					Expect(mconn.remoteAddr).To(Equal(newAddr))
+					pv := sess.pathValidation
+					Expect(pv).ToNot(BeNil())
+					Expect(pv.previousAddr).To(Equal(origAddr))
+					Expect(pv.bytesReceived).To(Equal(protocol.ByteCount(len("raw header") + len("foobar"))))
+					Expect(sess.sendPathChallenge(time.Now())).To(Succeed())
+					Expect(mconn.written).To(Receive())
+					Expect(pv.bytesSent).ToNot(BeZero())
+					err := sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: pv.challenge}}, protocol.EncryptionForwardSecure)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(sess.pathValidation).To(BeNil())
+					Expect(mconn.remoteAddr).To(Equal(newAddr))
+				})
+
+				It("switches to a new connection ID, if the client issued one", func() {
+					connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0xde, 0xad, 0xbe, 0xef}
+					sessionRunner.EXPECT().addResetToken(gomock.Any())
+					receivePacket(11, origAddr, &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: connID})
+					Expect(sess.destConnID).ToNot(Equal(connID))
+					receivePacket(12, newAddr, &wire.PingFrame{})
+					Expect(sess.destConnID).To(Equal(connID))
+					Expect(sess.pathValidation.connID).To(Equal(connID))
+					Expect(sess.sendPathChallenge(time.Now())).To(Succeed())
+					var data []byte
+					Expect(mconn.written).To(Receive(&data))
+					hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(data), connID.Len())
+					Expect(err).ToNot(HaveOccurred())
+					Expect(hdr.DestConnectionID).To(Equal(connID))
+					// the previous connection ID is retired once the new address is validated
+					Expect(retiredConnIDs()).To(BeEmpty())
+					receivePacket(13, newAddr, &wire.PathResponseFrame{Data: sess.pathValidation.challenge})
+					Expect(sess.pathValidation).To(BeNil())
+					Expect(retiredConnIDs()).To(Equal([]uint64{0}))
+				})
+
+				It("uses the previous connection ID again if the validation fails", func() {
+					origConnID := sess.destConnID
+					connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0xde, 0xad, 0xbe, 0xef}
+					sessionRunner.EXPECT().addResetToken(gomock.Any())
+					receivePacket(11, origAddr, &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: connID})
+					receivePacket(12, newAddr, &wire.PingFrame{})
+					Expect(sess.destConnID).To(Equal(connID))
+					for i := 0; i <= protocol.MaxPathChallenges; i++ {
+						Expect(sess.sendPathChallenge(time.Now())).To(Succeed())
+					}
+					Expect(sess.pathValidation).To(BeNil())
+					Expect(mconn.remoteAddr).To(Equal(origAddr))
+					Expect(sess.destConnID).To(Equal(origConnID))
+					Expect(retiredConnIDs()).To(Equal([]uint64{1}))
+				})
+
+				It("doesn't use the connection ID of an address that wasn't validated for the next address", func() {
+					connID1 := protocol.ConnectionID{1, 1, 1, 1, 1, 1, 1, 1}
+					connID2 := protocol.ConnectionID{2, 2, 2, 2, 2, 2, 2, 2}
+					sessionRunner.EXPECT().addResetToken(gomock.Any()).Times(2)
+					receivePacket(11, origAddr, &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: connID1}, &wire.NewConnectionIDFrame{SequenceNumber: 2, ConnectionID: connID2})
+					receivePacket(12, newAddr, &wire.PingFrame{})
+					Expect(sess.destConnID).To(Equal(connID1))
+					receivePacket(13, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}, &wire.PingFrame{})
+					Expect(sess.destConnID).To(Equal(connID2))
+					Expect(sess.pathValidation.previousAddr).To(Equal(origAddr))
+					Expect(retiredConnIDs()).To(Equal([]uint64{1}))
+				})
+
+				It("keeps the connection ID if the client didn't issue a new one", func() {
+					connID := sess.destConnID
+					receivePacket(11, newAddr, &wire.PingFrame{})
+					Expect(sess.destConnID).To(Equal(connID))
+					Expect(sess.pathValidation.connID).To(Equal(connID))
+				})
+
+				It("keeps the congestion state if only the port changed", func() {
+					sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+					sess.sentPacketHandler = sph
+					receivePacket(11, newAddr, &wire.PingFrame{})
+					// don't EXPECT any call to OnConnectionMigration
+					sess.sentPathChallenge = true
+					err := sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: sess.pathValidation.challenge}}, protocol.EncryptionForwardSecure)
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("resets the congestion state if the IP address changed", func() {
+					sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+					sess.sentPacketHandler = sph
+					receivePacket(11, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}, &wire.PingFrame{})
+					sph.EXPECT().OnConnectionMigration()
+					sess.sentPathChallenge = true
+					err := sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: sess.pathValidation.challenge}}, protocol.EncryptionForwardSecure)
+					Expect(err).ToNot(HaveOccurred())
+				})
+
+				It("returns to the previous address if the validation fails", func() {
+					receivePacket(11, newAddr, &wire.PingFrame{})
+					Expect(mconn.remoteAddr).To(Equal(newAddr))
+					for i := 0; i <= protocol.MaxPathChallenges; i++ {
+						Expect(sess.sendPathChallenge(time.Now())).To(Succeed())
+					}
+					Expect(sess.pathValidation).To(BeNil())
+					Expect(mconn.remoteAddr).To(Equal(origAddr))
+				})
+
+				It("returns to the previous address if the client returns to it", func() {
+					origConnID := sess.destConnID
+					sessionRunner.EXPECT().addResetToken(gomock.Any())
+					receivePacket(10, origAddr, &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8}})
+					receivePacket(11, newAddr, &wire.PingFrame{})
+					Expect(mconn.remoteAddr).To(Equal(newAddr))
+					receivePacket(12, origAddr, &wire.PingFrame{})
+					Expect(sess.pathValidation).To(BeNil())
+					Expect(mconn.remoteAddr).To(Equal(origAddr))
+					Expect(sess.destConnID).To(Equal(origConnID))
+					Expect(retiredConnIDs()).To(Equal([]uint64{1}))
+				})
+
+				It("doesn't switch addresses for reordered packets", func() {
+					receivePacket(9, newAddr, &wire.PingFrame{})
+					Expect(sess.pathValidation).To(BeNil())
+					Expect(mconn.remoteAddr).To(Equal(origAddr))
+				})
+
+				It("doesn't switch addresses before the handshake completes", func() {
+					sess.handshakeComplete = false
+					receivePacket(11, newAddr, &wire.PingFrame{})
+					Expect(sess.pathValidation).To(BeNil())
+					Expect(mconn.remoteAddr).To(Equal(origAddr))
+				})
+
+				It("only validates the new address with PATH_RESPONSEs received from it", func() {
+					receivePacket(11, newAddr, &wire.PingFrame{})
+					pv := sess.pathValidation
+					Expect(sess.sendPathChallenge(time.Now())).To(Succeed())
+					Expect(mconn.written).To(Receive())
+					receivePacket(12, origAddr, &wire.PathResponseFrame{Data: pv.challenge})
+					Expect(sess.pathValidation).To(Equal(pv))
+					receivePacket(13, newAddr, &wire.PathResponseFrame{Data: pv.challenge})
+					Expect(sess.pathValidation).To(BeNil())
+					Expect(mconn.remoteAddr).To(Equal(newAddr))
+				})
+
+				Context("probing packets", func() {
+					connID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0xde, 0xad, 0xbe, 0xef}
+
+					BeforeEach(func() {
+						sessionRunner.EXPECT().addResetToken(gomock.Any())
+						receivePacket(10, origAddr, &wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: connID})
+					})
+
+					It("answers them on the path they were received on, using a new connection ID", func() {
+						origConnID := sess.destConnID
+						receivePacket(11, newAddr, &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}})
+						Expect(sess.pathValidation).To(BeNil())
+						Expect(mconn.remoteAddr).To(Equal(origAddr))
+						var data []byte
+						Expect(mconn.written).To(Receive(&data))
+						Expect(mconn.writtenTo).To(Equal(newAddr))
+						hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(data), connID.Len())
+						Expect(err).ToNot(HaveOccurred())
+						Expect(hdr.DestConnectionID).To(Equal(connID))
+						Expect(sess.destConnID).To(Equal(origConnID))
+						Expect(sess.packer.controlFrames).To(BeEmpty())
+					})
+
+					It("keeps using the connection ID when the client migrates to the probed address", func() {
+						receivePacket(11, newAddr, &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}})
+						Expect(mconn.written).To(Receive())
+						receivePacket(12, newAddr, &wire.PingFrame{})
+						Expect(sess.destConnID).To(Equal(connID))
+						Expect(sess.pathValidation.connID).To(Equal(connID))
+						Expect(retiredConnIDs()).To(BeEmpty())
+					})
+
+					It("retires the connection ID when the client probes a different address", func() {
+						receivePacket(11, newAddr, &wire.PathChallengeFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}})
+						Expect(mconn.written).To(Receive())
+						// no unused connection ID is left, so the second probe isn't answered
+						receivePacket(12, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}, &wire.PathChallengeFrame{Data: [8]byte{8, 7, 6, 5, 4, 3, 2, 1}})
+						Expect(mconn.written).ToNot(Receive())
+						Expect(retiredConnIDs()).To(Equal([]uint64{1}))
+					})
+				})
+
+				It("limits the amount of data sent to an address that is not yet validated", func() {
+					receivePacket(11, newAddr, &wire.PingFrame{})
+					pv := sess.pathValidation
+					pv.bytesSent = protocol.AmplificationFactor * pv.bytesReceived
+					sess.packer.hasSentPacket = true
+					sess.packer.QueueControlFrame(&wire.MaxDataFrame{ByteOffset: 1337})
+					Expect(sess.sendPackets()).To(Succeed())
+					Expect(mconn.written).ToNot(Receive())
+					// receiving another packet from the new address allows us to send more
+					receivePacket(12, newAddr, &wire.PingFrame{})
+					Expect(sess.sendPackets()).To(Succeed())
+					Expect(mconn.written).To(Receive())
+				})
+			})
 		})
 	})
 
@@ -692,7 +1165,7 @@ var _ = Describe("Session", func() {
 
 		It("sends ACK frames", func() {
 			packetNumber := protocol.PacketNumber(0x035e)
-			err := sess.receivedPacketHandler.ReceivedPacket(packetNumber, time.Now(), true)
+			err := sess.receivedPacketHandler.ReceivedPacket(packetNumber, protocol.ECNNon, time.Now(), true)
 			Expect(err).ToNot(HaveOccurred())
 			sent, err := sess.sendPacket()
 			Expect(err).NotTo(HaveOccurred())
@@ -707,6 +1180,7 @@ var _ = Describe("Session", func() {
 				ByteOffset: 20,
 			})
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
 				Expect(p.Frames).To(ContainElement(&wire.MaxStreamDataFrame{StreamID: 2, ByteOffset: 20}))
 			})
@@ -716,11 +1190,137 @@ var _ = Describe("Session", func() {
 			Expect(sent).To(BeTrue())
 		})
 
+		It("marks packets with the ECN codepoint requested by the sent packet handler", func() {
+			sess.windowUpdateQueue.callback(&wire.MaxDataFrame{ByteOffset: 1337})
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().ECNMode().Return(protocol.ECT0)
+			sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+				Expect(p.ECN).To(Equal(protocol.ECT0))
+			})
+			sess.sentPacketHandler = sph
+			sent, err := sess.sendPacket()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sent).To(BeTrue())
+			Expect(mconn.written).To(HaveLen(1))
+			Expect(mconn.ecn).To(Equal(protocol.ECT0))
+		})
+
+		Context("MTU probes", func() {
+			var packetSizes []protocol.ByteCount
+
+			BeforeEach(func() {
+				packetSizes = nil
+				sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
+				sess.mtuDiscoverer = newMTUDiscoverer(sess.rttStats, 1200, func(s protocol.ByteCount) { packetSizes = append(packetSizes, s) }, utils.DefaultLogger)
+				sess.mtuDiscoverer.SetMax(1400)
+			})
+
+			It("sends MTU probes", func() {
+				sess.handshakeComplete = true
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
+					Expect(p.IsMTUProbe).To(BeTrue())
+					Expect(p.Length).To(Equal(protocol.ByteCount(1300)))
+				})
+				sess.sentPacketHandler = sph
+				sent, err := sess.maybeSendMTUProbe()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Expect(mconn.written).To(Receive(HaveLen(1300)))
+				Expect(mconn.ecn).To(Equal(protocol.ECNNon))
+				// the next probe is only sent after the first one was acknowledged or lost
+				sent, err = sess.maybeSendMTUProbe()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sent).To(BeFalse())
+				sess.mtuDiscoverer.MTUProbeAcked(1300)
+				Expect(packetSizes).To(Equal([]protocol.ByteCount{1300}))
+			})
+
+			It("sends MTU probes in the same batch as the other packets", func() {
+				sess.handshakeComplete = true
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().SentPacket(gomock.Any())
+				sess.sentPacketHandler = sph
+				sess.batchPackets = true
+				sent, err := sess.maybeSendMTUProbe()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sent).To(BeTrue())
+				Expect(mconn.written).To(BeEmpty())
+				Expect(sess.flushPacketBatch()).To(Succeed())
+				Expect(mconn.written).To(Receive(HaveLen(1300)))
+				Expect(mconn.batchSizes).To(Receive(Equal(1)))
+			})
+
+			Context("packets that are too large for the network interface", func() {
+				msgSizeErr := &net.OpError{Op: "write", Net: "udp", Err: os.NewSyscallError("sendmsg", syscall.EMSGSIZE)}
+
+				BeforeEach(func() {
+					if !isMsgSizeErr(msgSizeErr) {
+						Skip("EMSGSIZE is only detected on Linux")
+					}
+					sess.handshakeComplete = true
+					sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+					sph.EXPECT().SentPacket(gomock.Any()).AnyTimes()
+					sess.sentPacketHandler = sph
+				})
+
+				It("stops probing a size right away when the probe is too large", func() {
+					sess.batchPackets = true
+					sent, err := sess.maybeSendMTUProbe()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(sent).To(BeTrue())
+					mconn.writeErr = msgSizeErr
+					Expect(sess.flushPacketBatch()).To(Succeed())
+					Expect(sess.mtuDiscoverer.max).To(Equal(protocol.ByteCount(1300)))
+					Expect(packetSizes).To(BeEmpty())
+				})
+
+				It("reduces the packet size when a packet is too large", func() {
+					sess.mtuDiscoverer.MTUProbeAcked(sess.mtuDiscoverer.NextProbeSize(time.Now()))
+					Expect(packetSizes).To(Equal([]protocol.ByteCount{1300}))
+					mconn.writeErr = msgSizeErr
+					buf := getPacketBuffer()
+					packet := &packedPacket{header: &wire.Header{PacketNumber: 42}, raw: (*buf)[:1300]}
+					Expect(sess.writePackedPacket(packet)).To(Succeed())
+					Expect(packetSizes).To(Equal([]protocol.ByteCount{1300, protocol.MinInitialPacketSize}))
+				})
+
+				It("reduces the packet size when a packet is too large, for sessions without path MTU discovery", func() {
+					sess.mtuDiscoverer = nil
+					sess.packer.maxPacketSize = protocol.MaxPacketSizeIPv4
+					mconn.writeErr = msgSizeErr
+					sess.batchPackets = true
+					buf := getPacketBuffer()
+					Expect(sess.sendPackedPacket(&packedPacket{header: &wire.Header{PacketNumber: 42}, raw: (*buf)[:protocol.MaxPacketSizeIPv4]})).To(Succeed())
+					Expect(sess.flushPacketBatch()).To(Succeed())
+					Expect(sess.packer.maxPacketSize).To(Equal(protocol.ByteCount(protocol.MinInitialPacketSize)))
+				})
+			})
+
+			It("doesn't send MTU probes before the handshake completes", func() {
+				sent, err := sess.maybeSendMTUProbe()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sent).To(BeFalse())
+				Expect(mconn.written).To(BeEmpty())
+			})
+
+			It("resets the packet size when the connection is migrated", func() {
+				sess.mtuDiscoverer.MTUProbeAcked(sess.mtuDiscoverer.NextProbeSize(time.Now()))
+				sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+				sph.EXPECT().OnConnectionMigration()
+				sess.sentPacketHandler = sph
+				mconn.remoteAddr = &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+				sess.onConnectionMigration()
+				Expect(packetSizes).To(Equal([]protocol.ByteCount{1300, protocol.MaxPacketSizeIPv4}))
+			})
+		})
+
 		It("adds a BLOCKED frame when it is connection-level flow control blocked", func() {
 			fc := mocks.NewMockConnectionFlowController(mockCtrl)
 			fc.EXPECT().IsNewlyBlocked().Return(true, protocol.ByteCount(1337))
 			sess.connFlowController = fc
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
 				Expect(p.Frames).To(Equal([]wire.Frame{
 					&wire.BlockedFrame{Offset: 1337},
@@ -730,6 +1330,14 @@ var _ = Describe("Session", func() {
 			sent, err := sess.sendPacket()
 			Expect(err).NotTo(HaveOccurred())
 			Expect(sent).To(BeTrue())
+			Expect(sess.connFlowControlBlockedCount).To(BeEquivalentTo(1))
+		})
+
+		It("counts STREAM_BLOCKED frames when they are queued", func() {
+			sess.queueControlFrame(&wire.StreamBlockedFrame{StreamID: 5, Offset: 1337})
+			Expect(sess.streamFlowControlBlockedCount).To(BeEquivalentTo(1))
+			sess.queueControlFrame(&wire.PingFrame{})
+			Expect(sess.streamFlowControlBlockedCount).To(BeEquivalentTo(1))
 		})
 
 		It("sends public reset", func() {
@@ -745,13 +1353,14 @@ var _ = Describe("Session", func() {
 			sess.unpacker = unpacker
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
 				PacketNumber: 10,
 				PacketType:   protocol.PacketTypeInitial,
 			})
 			sph.EXPECT().DequeuePacketForRetransmission()
 			rph := mockackhandler.NewMockReceivedPacketHandler(mockCtrl)
-			rph.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), gomock.Any())
+			rph.EXPECT().ReceivedPacket(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
 			sess.receivedPacketHandler = rph
 			sess.sentPacketHandler = sph
 			err := sess.handlePacketImpl(&receivedPacket{
@@ -769,6 +1378,7 @@ var _ = Describe("Session", func() {
 			sess.windowUpdateQueue.callback(&wire.MaxDataFrame{})
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
 				PacketNumber: 10,
 				PacketType:   protocol.PacketTypeHandshake,
@@ -799,6 +1409,7 @@ var _ = Describe("Session", func() {
 		It("sends a TLP probe packet", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().SendMode().Return(ackhandler.SendTLP)
 			sph.EXPECT().ShouldSendNumPackets().Return(1)
 			sph.EXPECT().SentPacket(gomock.Any()).Do(func(p *ackhandler.Packet) {
@@ -813,6 +1424,7 @@ var _ = Describe("Session", func() {
 		It("sends an RTO probe packets", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().TimeUntilSend()
 			sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
 				PacketNumber: 10,
@@ -835,6 +1447,7 @@ var _ = Describe("Session", func() {
 		It("sends RTO probe packets with new data, if no retransmission is available", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().TimeUntilSend()
 			sph.EXPECT().DequeuePacketForRetransmission().Return(&ackhandler.Packet{
 				PacketNumber: 10,
@@ -869,6 +1482,7 @@ var _ = Describe("Session", func() {
 
 		BeforeEach(func() {
 			sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
 			sph.EXPECT().DequeuePacketForRetransmission().AnyTimes()
@@ -970,6 +1584,7 @@ var _ = Describe("Session", func() {
 			}()
 			sess.scheduleSending()
 			Eventually(mconn.written).Should(HaveLen(3))
+			Expect(mconn.batchSizes).To(Receive(Equal(3)))
 			// make the go routine return
 			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
 			sess.Close(nil)
@@ -1011,6 +1626,7 @@ var _ = Describe("Session", func() {
 			swf := &wire.StopWaitingFrame{LeastUnacked: 10}
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
 			sph.EXPECT().SendMode().Return(ackhandler.SendAck)
 			sph.EXPECT().ShouldSendNumPackets().Return(1000)
@@ -1024,7 +1640,7 @@ var _ = Describe("Session", func() {
 			})
 			sess.sentPacketHandler = sph
 			sess.packer.packetNumberGenerator.next = 0x1338
-			sess.receivedPacketHandler.ReceivedPacket(1, time.Now(), true)
+			sess.receivedPacketHandler.ReceivedPacket(1, protocol.ECNNon, time.Now(), true)
 			done := make(chan struct{})
 			go func() {
 				defer GinkgoRecover()
@@ -1045,6 +1661,7 @@ var _ = Describe("Session", func() {
 			done := make(chan struct{})
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
 			sph.EXPECT().SendMode().Return(ackhandler.SendAck)
 			sph.EXPECT().ShouldSendNumPackets().Return(1000)
@@ -1056,7 +1673,7 @@ var _ = Describe("Session", func() {
 			})
 			sess.sentPacketHandler = sph
 			sess.packer.packetNumberGenerator.next = 0x1338
-			sess.receivedPacketHandler.ReceivedPacket(1, time.Now(), true)
+			sess.receivedPacketHandler.ReceivedPacket(1, protocol.ECNNon, time.Now(), true)
 			go func() {
 				defer GinkgoRecover()
 				sess.run()
@@ -1079,6 +1696,7 @@ var _ = Describe("Session", func() {
 			sess.packer.packetNumberGenerator.next = 0x1337 + 10
 			sess.packer.hasSentPacket = true // make sure this is not the first packet the packer sends
 			sph = mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().GetPacketNumberLen(gomock.Any()).Return(protocol.PacketNumberLen2).AnyTimes()
 			sess.sentPacketHandler = sph
 			sess.packer.cryptoSetup = &mockCryptoSetup{encLevelSeal: protocol.EncryptionForwardSecure}
@@ -1219,6 +1837,7 @@ var _ = Describe("Session", func() {
 			sess.packer.packetNumberGenerator.next = 10000
 			sess.packer.QueueControlFrame(&wire.BlockedFrame{})
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
 			sph.EXPECT().TimeUntilSend().AnyTimes()
 			sph.EXPECT().SendMode().Return(ackhandler.SendAny).AnyTimes()
@@ -1243,6 +1862,7 @@ var _ = Describe("Session", func() {
 
 		It("sets the timer to the ack timer", func() {
 			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().ECNMode().AnyTimes()
 			sph.EXPECT().TimeUntilSend().Return(time.Now())
 			sph.EXPECT().TimeUntilSend().Return(time.Now().Add(time.Hour))
 			sph.EXPECT().GetAlarmTimeout().AnyTimes()
@@ -1401,6 +2021,19 @@ var _ = Describe("Session", func() {
 			Eventually(sess.Context().Done()).Should(BeClosed())
 		})
 
+		It("drops undecryptable 0-RTT packets, for the server", func() {
+			sess.perspective = protocol.PerspectiveServer
+			sess.tryQueueingUndecryptablePacket(&receivedPacket{
+				header: &wire.Header{
+					IsLongHeader: true,
+					Type:         protocol.PacketType0RTT,
+					PacketNumber: 42,
+				},
+				remoteAddr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
+			})
+			Expect(sess.undecryptablePackets).To(BeEmpty())
+		})
+
 		It("unqueues undecryptable packets for later decryption", func() {
 			sess.undecryptablePackets = []*receivedPacket{{
 				header: &wire.Header{PacketNumber: protocol.PacketNumber(42)},
@@ -1441,6 +2074,140 @@ var _ = Describe("Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	It("cancels the handshake context when the handshake completes", func() {
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		Consistently(sess.HandshakeComplete().Done()).ShouldNot(BeClosed())
+		sessionRunner.EXPECT().onHandshakeComplete(gomock.Any())
+		close(handshakeChan)
+		Eventually(sess.HandshakeComplete().Done()).Should(BeClosed())
+		// make sure the go routine returns
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+	})
+
+	It("tells the sent packet handler if 0-RTT was accepted", func() {
+		sess.sent0RTT = true
+		cryptoSetup.connState = ConnectionState{Used0RTT: true}
+		sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+		sph.EXPECT().Finish0RTT(true)
+		sess.sentPacketHandler = sph
+		sessionRunner.EXPECT().onHandshakeComplete(sess)
+		sess.handleHandshakeEvent(true)
+	})
+
+	It("tells the sent packet handler if 0-RTT was rejected", func() {
+		sess.sent0RTT = true
+		sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+		sph.EXPECT().Finish0RTT(false)
+		sess.sentPacketHandler = sph
+		sessionRunner.EXPECT().onHandshakeComplete(sess)
+		sess.handleHandshakeEvent(true)
+	})
+
+	It("issues new connection IDs when the handshake completes, for IETF QUIC", func() {
+		sess.version = protocol.VersionTLS
+		var connIDs []protocol.ConnectionID
+		sessionRunner.EXPECT().onHandshakeComplete(sess)
+		sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess).Do(func(c protocol.ConnectionID, _ packetHandler) {
+			connIDs = append(connIDs, c)
+		}).Times(protocol.NumIssuedConnectionIDs)
+		token := [16]byte{0xde, 0xad, 0xbe, 0xef}
+		sessionRunner.EXPECT().getStatelessResetToken(gomock.Any()).Return(token).Times(protocol.NumIssuedConnectionIDs)
+		sess.handleHandshakeEvent(true)
+		Expect(connIDs).To(HaveLen(protocol.NumIssuedConnectionIDs))
+		Expect(connIDs).To(Equal(sess.issuedConnIDs))
+		var frames []*wire.NewConnectionIDFrame
+		for _, f := range sess.packer.controlFrames {
+			if ncid, ok := f.(*wire.NewConnectionIDFrame); ok {
+				frames = append(frames, ncid)
+			}
+		}
+		Expect(frames).To(HaveLen(protocol.NumIssuedConnectionIDs))
+		for i, f := range frames {
+			Expect(f.SequenceNumber).To(BeEquivalentTo(i + 1))
+			Expect(f.ConnectionID).To(Equal(connIDs[i]))
+			Expect(f.ConnectionID).ToNot(Equal(sess.srcConnID))
+			Expect(f.StatelessResetToken).To(Equal(token))
+		}
+	})
+
+	Context("receiving RETIRE_CONNECTION_ID frames", func() {
+		BeforeEach(func() {
+			sess.version = protocol.VersionTLS
+			sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess).Times(protocol.NumIssuedConnectionIDs)
+			sessionRunner.EXPECT().getStatelessResetToken(gomock.Any()).Times(protocol.NumIssuedConnectionIDs)
+			Expect(sess.issueConnectionIDs()).To(Succeed())
+			sess.packer.controlFrames = nil
+		})
+
+		It("removes the connection ID and issues a new one", func() {
+			connID := sess.issuedConnIDs[0]
+			sessionRunner.EXPECT().removeConnectionID(connID)
+			sessionRunner.EXPECT().addConnectionID(gomock.Any(), sess)
+			sessionRunner.EXPECT().getStatelessResetToken(gomock.Any())
+			err := sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 1}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+			f := sess.packer.controlFrames[0].(*wire.NewConnectionIDFrame)
+			Expect(f.SequenceNumber).To(BeEquivalentTo(protocol.NumIssuedConnectionIDs + 1))
+			// a retransmission doesn't remove it again
+			err = sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 1}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sess.packer.controlFrames).To(HaveLen(1))
+		})
+
+		It("doesn't remove the connection ID used during the handshake", func() {
+			// don't EXPECT any calls to removeConnectionID
+			err := sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: 0}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("errors when a connection ID is retired that was never issued", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.RetireConnectionIDFrame{SequenceNumber: protocol.NumIssuedConnectionIDs + 1}}, protocol.EncryptionForwardSecure)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*qerr.QuicError).ErrorCode).To(Equal(qerr.InvalidFrameData))
+			Expect(err.Error()).To(ContainSubstring("which was never issued"))
+		})
+	})
+
+	It("uses the ConnectionIDGenerator to issue new connection IDs", func() {
+		sess.version = protocol.VersionTLS
+		sess.config.ConnectionIDGenerator = &fixedConnIDGenerator{connID: protocol.ConnectionID{1, 2, 3, 4, 5}, length: 5}
+		sessionRunner.EXPECT().onHandshakeComplete(sess)
+		sessionRunner.EXPECT().addConnectionID(protocol.ConnectionID{1, 2, 3, 4, 5}, sess).Times(protocol.NumIssuedConnectionIDs)
+		sessionRunner.EXPECT().getStatelessResetToken(protocol.ConnectionID{1, 2, 3, 4, 5}).Times(protocol.NumIssuedConnectionIDs)
+		sess.handleHandshakeEvent(true)
+		Expect(sess.issuedConnIDs).To(HaveLen(protocol.NumIssuedConnectionIDs))
+	})
+
+	It("doesn't issue new connection IDs when using zero-length connection IDs", func() {
+		sess.version = protocol.VersionTLS
+		sess.srcConnID = protocol.ConnectionID{}
+		sessionRunner.EXPECT().onHandshakeComplete(sess)
+		// don't EXPECT any calls to addConnectionID
+		sess.handleHandshakeEvent(true)
+		Expect(sess.issuedConnIDs).To(BeEmpty())
+	})
+
+	It("removes all connection IDs when it is closed", func() {
+		sess.issuedConnIDs = []protocol.ConnectionID{{1, 1, 1, 1}, {2, 2, 2, 2}}
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		sessionRunner.EXPECT().removeConnectionID(sess.srcConnID)
+		sessionRunner.EXPECT().removeConnectionID(protocol.ConnectionID{1, 1, 1, 1})
+		sessionRunner.EXPECT().removeConnectionID(protocol.ConnectionID{2, 2, 2, 2})
+		Expect(sess.Close(nil)).To(Succeed())
+		Eventually(sess.Context().Done()).Should(BeClosed())
+	})
+
 	It("passes errors to the session runner", func() {
 		testErr := errors.New("handshake error")
 		done := make(chan struct{})
@@ -1470,12 +2237,35 @@ var _ = Describe("Session", func() {
 			ConnectionFlowControlWindow: 0x5000,
 			OmitConnectionID:            true,
 			MaxPacketSize:               0x42,
+			MaxDatagramFrameSize:        0x1337,
 		}
 		streamManager.EXPECT().UpdateLimits(&params)
 		paramsChan <- params
 		Eventually(func() *handshake.TransportParameters { return sess.peerParams }).Should(Equal(&params))
 		Eventually(func() bool { return sess.packer.omitConnectionID }).Should(BeTrue())
 		Eventually(func() protocol.ByteCount { return sess.packer.maxPacketSize }).Should(Equal(protocol.ByteCount(0x42)))
+		Eventually(func() uint64 { return atomic.LoadUint64(&sess.maxDatagramFrameSize) }).Should(BeEquivalentTo(utils.MinByteCount(0x1337, protocol.MaxDatagramFrameSize)))
+		// make the go routine return
+		streamManager.EXPECT().CloseWithError(gomock.Any())
+		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+		sess.Close(nil)
+		Eventually(sess.Context().Done()).Should(BeClosed())
+	})
+
+	It("passes the stateless reset token received from the peer to the session runner", func() {
+		paramsChan := make(chan handshake.TransportParameters)
+		sess.paramsChan = paramsChan
+		go func() {
+			defer GinkgoRecover()
+			sess.run()
+		}()
+		token := [16]byte{0xde, 0xad, 0xbe, 0xef}
+		params := handshake.TransportParameters{StatelessResetToken: &token}
+		streamManager.EXPECT().UpdateLimits(&params)
+		tokenAdded := make(chan struct{})
+		sessionRunner.EXPECT().addResetToken(token).Do(func([16]byte) { close(tokenAdded) })
+		paramsChan <- params
+		Eventually(tokenAdded).Should(BeClosed())
 		// make the go routine return
 		streamManager.EXPECT().CloseWithError(gomock.Any())
 		sessionRunner.EXPECT().removeConnectionID(gomock.Any())
@@ -1701,6 +2491,266 @@ var _ = Describe("Session", func() {
 		})
 	})
 
+	Context("DATAGRAM frames", func() {
+		It("errors when receiving a DATAGRAM frame, if DATAGRAM support is disabled", func() {
+			err := sess.handleFrames([]wire.Frame{&wire.DatagramFrame{Data: []byte("foobar")}}, protocol.EncryptionForwardSecure)
+			Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "received a DATAGRAM frame, but DATAGRAM support is disabled")))
+		})
+
+		Context("with DATAGRAM support", func() {
+			BeforeEach(func() {
+				sess.datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+			})
+
+			It("queues received DATAGRAM frames", func() {
+				err := sess.handleFrames([]wire.Frame{&wire.DatagramFrame{Data: []byte("foobar")}}, protocol.EncryptionForwardSecure)
+				Expect(err).ToNot(HaveOccurred())
+				data, err := sess.ReceiveMessage()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+			})
+
+			It("errors on unencrypted DATAGRAM frames", func() {
+				err := sess.handleFrames([]wire.Frame{&wire.DatagramFrame{Data: []byte("foobar")}}, protocol.EncryptionUnencrypted)
+				Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "received an unencrypted DATAGRAM frame")))
+			})
+
+			It("errors on DATAGRAM frames that are too large", func() {
+				f := &wire.DatagramFrame{Data: make([]byte, protocol.MaxDatagramFrameSize)}
+				err := sess.handleFrames([]wire.Frame{f}, protocol.EncryptionForwardSecure)
+				Expect(err).To(MatchError(qerr.Error(qerr.InvalidFrameData, "DATAGRAM frame too large")))
+			})
+
+			It("doesn't send messages if the peer doesn't support DATAGRAM frames", func() {
+				Expect(sess.SendMessage([]byte("foobar"))).To(MatchError("peer doesn't support DATAGRAM frames"))
+			})
+
+			It("doesn't send messages that are too large", func() {
+				sess.maxDatagramFrameSize = 100
+				Expect(sess.SendMessage(make([]byte, 100))).To(MatchError("message too large (maximum DATAGRAM frame size: 100 bytes)"))
+			})
+
+			It("sends messages", func() {
+				sess.maxDatagramFrameSize = 100
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					Expect(sess.SendMessage([]byte("foobar"))).To(Succeed())
+					close(done)
+				}()
+				Eventually(sess.datagramQueue.Peek).ShouldNot(BeNil())
+				Expect(sess.datagramQueue.Peek().Data).To(Equal([]byte("foobar")))
+				Consistently(done).ShouldNot(BeClosed())
+				sess.datagramQueue.Pop()
+				Eventually(done).Should(BeClosed())
+			})
+		})
+
+		It("doesn't send messages, if DATAGRAM support is disabled", func() {
+			Expect(sess.SendMessage([]byte("foobar"))).To(MatchError("DATAGRAM support disabled"))
+		})
+
+		It("doesn't receive messages, if DATAGRAM support is disabled", func() {
+			_, err := sess.ReceiveMessage()
+			Expect(err).To(MatchError("DATAGRAM support disabled"))
+		})
+	})
+
+	It("uses the congestion controller from the config", func() {
+		var rttStats RTTStats
+		cong := mocks.NewMockSendAlgorithm(mockCtrl)
+		conf := populateServerConfig(&Config{})
+		conf.CongestionControl = func(r RTTStats) CongestionController {
+			rttStats = r
+			return cong
+		}
+		s, err := newSession(
+			mconn,
+			sessionRunner,
+			protocol.Version39,
+			protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+			scfg,
+			nil,
+			conf,
+			utils.DefaultLogger,
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rttStats).To(Equal(s.(*session).rttStats))
+		cong.EXPECT().GetCongestionWindow().Return(protocol.ByteCount(1337))
+		Expect(s.(*session).getStats().CongestionWindow).To(BeEquivalentTo(1337))
+	})
+
+	Context("tracing", func() {
+		var tracer *MockConnectionTracer
+
+		BeforeEach(func() {
+			tracer = NewMockConnectionTracer(mockCtrl)
+			sess.tracer = tracer
+		})
+
+		It("creates a tracer for every session, and closes it when the session is closed", func() {
+			connID := protocol.ConnectionID{1, 3, 3, 7, 1, 3, 3, 7}
+			t := NewMockTracer(mockCtrl)
+			t.EXPECT().TracerForConnection(protocol.PerspectiveServer, connID).Return(tracer)
+			s, err := newSession(
+				mconn,
+				sessionRunner,
+				protocol.Version39,
+				connID,
+				scfg,
+				nil,
+				populateServerConfig(&Config{Tracer: t}),
+				utils.DefaultLogger,
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(s.(*session).tracer).To(Equal(tracer))
+			go func() {
+				defer GinkgoRecover()
+				s.run()
+			}()
+			// make the go routine return
+			sessionRunner.EXPECT().removeConnectionID(connID)
+			tracer.EXPECT().Close()
+			tracer.EXPECT().SentPacket(gomock.Any()).AnyTimes()
+			Expect(s.Close(nil)).To(Succeed())
+			Eventually(s.Context().Done()).Should(BeClosed())
+		})
+
+		It("traces sent packets", func() {
+			hdr := &wire.Header{
+				DestConnectionID: protocol.ConnectionID{1, 2, 3, 4, 5, 6, 7, 8},
+				SrcConnectionID:  protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+				PacketNumber:     0x42,
+			}
+			frames := []wire.Frame{&wire.PingFrame{}}
+			raw := *getPacketBuffer()
+			raw = append(raw[:0], []byte("foobar")...)
+			tracer.EXPECT().SentPacket(&PacketInfo{
+				DestConnectionID: hdr.DestConnectionID,
+				SrcConnectionID:  hdr.SrcConnectionID,
+				PacketNumber:     0x42,
+				EncryptionLevel:  protocol.EncryptionForwardSecure,
+				Size:             6,
+				Frames:           frames,
+			})
+			Expect(sess.sendPackedPacket(&packedPacket{
+				header:          hdr,
+				raw:             raw,
+				frames:          frames,
+				encryptionLevel: protocol.EncryptionForwardSecure,
+			})).To(Succeed())
+			Expect(mconn.written).To(Receive(Equal([]byte("foobar"))))
+		})
+
+		Context("receiving packets", func() {
+			var (
+				hdr      *wire.Header
+				unpacker *MockUnpacker
+			)
+
+			BeforeEach(func() {
+				unpacker = NewMockUnpacker(mockCtrl)
+				sess.unpacker = unpacker
+				hdr = &wire.Header{
+					IsLongHeader:     true,
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: protocol.ConnectionID{8, 7, 6, 5, 4, 3, 2, 1},
+					PacketNumber:     5,
+					PacketNumberLen:  protocol.PacketNumberLen4,
+					Raw:              []byte("raw header"),
+				}
+			})
+
+			It("traces received packets", func() {
+				frames := []wire.Frame{&wire.PingFrame{}}
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+					encryptionLevel: protocol.EncryptionSecure,
+					frames:          frames,
+				}, nil)
+				tracer.EXPECT().ReceivedPacket(&PacketInfo{
+					Type:             protocol.PacketTypeHandshake,
+					DestConnectionID: hdr.DestConnectionID,
+					PacketNumber:     5,
+					EncryptionLevel:  protocol.EncryptionSecure,
+					Size:             16,
+					Frames:           frames,
+				})
+				Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, data: []byte("foobar")})).To(Succeed())
+			})
+
+			It("traces duplicate packets", func() {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{}, nil).Times(2)
+				tracer.EXPECT().ReceivedPacket(gomock.Any()).Do(func(p *PacketInfo) {
+					Expect(p.PotentiallyDuplicate).To(BeFalse())
+				})
+				Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, data: []byte("foobar")})).To(Succeed())
+				tracer.EXPECT().ReceivedPacket(gomock.Any()).Do(func(p *PacketInfo) {
+					Expect(p.PacketNumber).To(BeEquivalentTo(5))
+					Expect(p.PotentiallyDuplicate).To(BeTrue())
+				})
+				Expect(sess.handlePacketImpl(&receivedPacket{header: hdr, data: []byte("foobar")})).To(Succeed())
+				// the duplicate packet is still processed
+				Expect(sess.packetsReceived).To(BeEquivalentTo(2))
+			})
+
+			It("traces undecryptable packets that are dropped", func() {
+				sess.handshakeComplete = true
+				tracer.EXPECT().DroppedPacket(PacketDropUndecryptable, protocol.ByteCount(16))
+				sess.tryQueueingUndecryptablePacket(&receivedPacket{
+					remoteAddr: &net.UDPAddr{},
+					header:     hdr,
+					data:       []byte("foobar"),
+				})
+			})
+		})
+	})
+
+	Context("connection statistics", func() {
+		It("reports statistics", func() {
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			sph.EXPECT().GetStats().Return(&ackhandler.SentPacketStats{
+				PacketsSent:          10,
+				PacketsLost:          2,
+				PacketsRetransmitted: 3,
+				BytesInFlight:        1000,
+				CongestionWindow:     2000,
+				BandwidthEstimate:    3000,
+			})
+			sess.sentPacketHandler = sph
+			sess.rttStats.UpdateRTT(50*time.Millisecond, 0, time.Now())
+			sess.packetsReceived = 7
+			sess.connFlowControlBlockedCount = 4
+			sess.streamFlowControlBlockedCount = 5
+			Expect(sess.getStats()).To(Equal(ConnectionStats{
+				MinRTT:                       50 * time.Millisecond,
+				SmoothedRTT:                  50 * time.Millisecond,
+				LatestRTT:                    50 * time.Millisecond,
+				CongestionWindow:             2000,
+				BandwidthEstimate:            3000,
+				BytesInFlight:                1000,
+				PacketsSent:                  10,
+				PacketsReceived:              7,
+				PacketsLost:                  2,
+				PacketsRetransmitted:         3,
+				ConnectionFlowControlBlocked: 4,
+				StreamFlowControlBlocked:     5,
+			}))
+		})
+
+		It("reports statistics while the session is running", func() {
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+			}()
+			Eventually(func() uint64 { return sess.ConnectionStats().PacketsSent }).Should(BeZero())
+			// make the go routine return
+			streamManager.EXPECT().CloseWithError(gomock.Any())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			sess.Close(nil)
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+	})
+
 	It("returns the local address", func() {
 		addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
 		mconn.localAddr = addr
@@ -1734,6 +2784,7 @@ var _ = Describe("Client Session", func() {
 			_ protocol.ConnectionID,
 			_ protocol.VersionNumber,
 			_ *tls.Config,
+			_ handshake.ClientConfigCache,
 			_ *handshake.TransportParameters,
 			_ chan<- handshake.TransportParameters,
 			handshakeChanP chan<- struct{},
@@ -1806,7 +2857,7 @@ var _ = Describe("Client Session", func() {
 		sess.queueControlFrame(&wire.PingFrame{})
 		var packet []byte
 		Eventually(mconn.written).Should(Receive(&packet))
-		hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(packet))
+		hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(packet), 8)
 		Expect(err).ToNot(HaveOccurred())
 		Expect(hdr.DestConnectionID).To(Equal(protocol.ConnectionID{1, 3, 3, 7, 1, 3, 3, 7}))
 		// make sure the go routine returns
@@ -1815,6 +2866,207 @@ var _ = Describe("Client Session", func() {
 		Eventually(sess.Context().Done()).Should(BeClosed())
 	})
 
+	Context("connection migration", func() {
+		var newConn *mockConnection
+		newConnID := protocol.ConnectionID{0xde, 0xca, 0xfb, 0xad, 0xde, 0xad, 0xbe, 0xef}
+
+		BeforeEach(func() {
+			sess.version = protocol.VersionTLS
+			sess.packer.version = protocol.VersionTLS
+			cryptoSetup.encLevelSeal = protocol.EncryptionForwardSecure
+			sess.handshakeComplete = true
+			newConn = newMockConnection()
+			sessionRunner.EXPECT().addResetToken(gomock.Any())
+			err := sess.handleFrames([]wire.Frame{&wire.NewConnectionIDFrame{SequenceNumber: 1, ConnectionID: newConnID}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		newPathValidation := func() *pathValidation {
+			return &pathValidation{
+				conn:      newConn,
+				challenge: [8]byte{1, 2, 3, 4, 5, 6, 7, 8},
+				done:      make(chan error, 1),
+			}
+		}
+
+		It("only migrates IETF QUIC sessions", func() {
+			sess.version = protocol.Version39
+			Expect(sess.MigrateTo(newMockPacketConn())).To(MatchError("connection migration is only supported by IETF QUIC clients"))
+		})
+
+		It("doesn't migrate before the handshake completes", func() {
+			sess.handshakeComplete = false
+			pv := newPathValidation()
+			sess.startPathValidation(pv)
+			Expect(pv.done).To(Receive(MatchError("can't migrate the connection before the handshake completes")))
+			Expect(sess.pathValidation).To(BeNil())
+			// the net.PacketConn is owned by the application
+			Expect(newConn.closed).To(BeFalse())
+		})
+
+		It("doesn't migrate if the server didn't issue an unused connection ID", func() {
+			sess.peerConnIDs = newConnIDManager(func([16]byte) {}, utils.DefaultLogger)
+			pv := newPathValidation()
+			sess.startPathValidation(pv)
+			Expect(pv.done).To(Receive(MatchError("can't migrate the connection: no unused connection ID available")))
+			Expect(sess.pathValidation).To(BeNil())
+		})
+
+		It("sets the DF bit on the new path, if path MTU discovery is enabled", func() {
+			sess.mtuDiscoverer = newMTUDiscoverer(sess.rttStats, 1200, func(protocol.ByteCount) {}, utils.DefaultLogger)
+			sessionRunner.EXPECT().addPath(newConn)
+			sess.startPathValidation(newPathValidation())
+			Expect(newConn.df).To(BeTrue())
+		})
+
+		It("doesn't set the DF bit on the new path, if path MTU discovery is disabled", func() {
+			sessionRunner.EXPECT().addPath(newConn)
+			sess.startPathValidation(newPathValidation())
+			Expect(newConn.df).To(BeFalse())
+		})
+
+		It("doesn't start a second path validation", func() {
+			sessionRunner.EXPECT().addPath(newConn)
+			sess.startPathValidation(newPathValidation())
+			otherConn := newMockConnection()
+			pv := &pathValidation{conn: otherConn, done: make(chan error, 1)}
+			sess.startPathValidation(pv)
+			Expect(pv.done).To(Receive(MatchError("a connection migration is already in progress")))
+			Expect(otherConn.closed).To(BeFalse())
+			Expect(sess.pathValidation.conn).To(Equal(newConn))
+		})
+
+		It("sends a PATH_CHALLENGE on the new path, and migrates when receiving the PATH_RESPONSE", func() {
+			sess.rttStats.UpdateRTT(time.Second, 0, time.Now())
+			pv := newPathValidation()
+			sessionRunner.EXPECT().addPath(newConn)
+			sess.startPathValidation(pv)
+			now := time.Now()
+			Expect(sess.sendPathChallenge(now)).To(Succeed())
+			var data []byte
+			Expect(newConn.written).To(Receive(&data))
+			hdr, err := wire.ParseHeaderSentByClient(bytes.NewReader(data), newConnID.Len())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.DestConnectionID).To(Equal(newConnID))
+			Expect(mconn.written).ToNot(Receive())
+			Expect(pv.nextChallenge).To(Equal(now.Add(3 * time.Second)))
+			err = sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pv.done).To(Receive(BeNil()))
+			Expect(sess.pathValidation).To(BeNil())
+			Expect(sess.RemoteAddr()).To(Equal(newConn.RemoteAddr()))
+			Expect(sess.conn).To(Equal(newConn))
+			Expect(sess.destConnID).To(Equal(newConnID))
+			Expect(sess.rttStats.SmoothedRTT()).To(BeZero())
+			// the connection ID used on the old path is retired
+			Expect(sess.packer.controlFrames).To(ContainElement(&wire.RetireConnectionIDFrame{SequenceNumber: 0}))
+		})
+
+		It("only accepts PATH_RESPONSEs received on the new path", func() {
+			unpacker := NewMockUnpacker(mockCtrl)
+			sess.unpacker = unpacker
+			pv := newPathValidation()
+			sessionRunner.EXPECT().addPath(newConn)
+			sess.startPathValidation(pv)
+			Expect(sess.sendPathChallenge(time.Now())).To(Succeed())
+			receivePathResponse := func(pn protocol.PacketNumber, path connection) {
+				unpacker.EXPECT().Unpack(gomock.Any(), gomock.Any(), gomock.Any()).Return(&unpackedPacket{
+					encryptionLevel: protocol.EncryptionForwardSecure,
+					frames:          []wire.Frame{&wire.PathResponseFrame{Data: pv.challenge}},
+				}, nil)
+				Expect(sess.handlePacketImpl(&receivedPacket{
+					header:  &wire.Header{PacketNumber: pn, PacketNumberLen: protocol.PacketNumberLen2},
+					rcvPath: path,
+				})).To(Succeed())
+			}
+			receivePathResponse(1, mconn)
+			Expect(pv.done).ToNot(Receive())
+			Expect(sess.conn).To(Equal(mconn))
+			receivePathResponse(2, newConn)
+			Expect(pv.done).To(Receive(BeNil()))
+			Expect(sess.conn).To(Equal(newConn))
+			Expect(newConn.closed).To(BeFalse())
+		})
+
+		It("ignores PATH_RESPONSEs that don't belong to the current path validation", func() {
+			pv := newPathValidation()
+			sessionRunner.EXPECT().addPath(newConn)
+			sess.startPathValidation(pv)
+			Expect(sess.sendPathChallenge(time.Now())).To(Succeed())
+			err := sess.handleFrames([]wire.Frame{&wire.PathResponseFrame{Data: [8]byte{8, 7, 6, 5, 4, 3, 2, 1}}}, protocol.EncryptionForwardSecure)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pv.done).ToNot(Receive())
+			Expect(sess.conn).To(Equal(mconn))
+		})
+
+		It("fails the path validation if no PATH_RESPONSE is received", func() {
+			pv := newPathValidation()
+			sessionRunner.EXPECT().addPath(newConn)
+			sess.startPathValidation(pv)
+			for i := 0; i < protocol.MaxPathChallenges; i++ {
+				Expect(sess.sendPathChallenge(time.Now())).To(Succeed())
+				Expect(newConn.written).To(Receive())
+				Expect(pv.done).ToNot(Receive())
+			}
+			sessionRunner.EXPECT().removePath(newConn)
+			Expect(sess.sendPathChallenge(time.Now())).To(Succeed())
+			Expect(newConn.written).ToNot(Receive())
+			Expect(pv.done).To(Receive(MatchError("path validation failed: no PATH_RESPONSE received")))
+			Expect(sess.pathValidation).To(BeNil())
+			Expect(sess.conn).To(Equal(mconn))
+			// the connection ID was used on the new path, so it is retired
+			Expect(sess.packer.controlFrames).To(ContainElement(&wire.RetireConnectionIDFrame{SequenceNumber: 1}))
+			// the new path is not closed, we just stop reading from it
+			Expect(newConn.closed).To(BeFalse())
+		})
+
+		It("fails the path validation if reading from the new path fails", func() {
+			pv := newPathValidation()
+			sessionRunner.EXPECT().addPath(newConn)
+			sess.startPathValidation(pv)
+			testErr := errors.New("read error")
+			sessionRunner.EXPECT().removePath(newConn)
+			sess.handlePathError(pathError{conn: newConn, err: testErr})
+			Expect(pv.done).To(Receive(MatchError(testErr)))
+			Expect(sess.pathValidation).To(BeNil())
+			Expect(sess.conn).To(Equal(mconn))
+			Expect(sess.closeChan).ToNot(Receive())
+			Expect(newConn.closed).To(BeFalse())
+		})
+
+		It("closes the session if reading from the path it migrated to fails", func() {
+			testErr := errors.New("read error")
+			sess.conn = newConn
+			sess.handlePathError(pathError{conn: newConn, err: testErr})
+			var closeErr closeError
+			Expect(sess.closeChan).To(Receive(&closeErr))
+			Expect(closeErr.err).To(MatchError(testErr))
+		})
+
+		It("ignores errors reading from old paths", func() {
+			sess.handlePathError(pathError{conn: newConn, err: errors.New("read error")})
+			Expect(sess.closeChan).ToNot(Receive())
+		})
+
+		It("returns when the session is closed during the path validation", func() {
+			sessionRunner.EXPECT().addPath(gomock.Any())
+			go func() {
+				defer GinkgoRecover()
+				sess.run()
+			}()
+			errChan := make(chan error)
+			go func() {
+				defer GinkgoRecover()
+				errChan <- sess.MigrateTo(newMockPacketConn())
+			}()
+			Consistently(errChan).ShouldNot(Receive())
+			sessionRunner.EXPECT().removeConnectionID(gomock.Any())
+			Expect(sess.Close(nil)).To(Succeed())
+			Eventually(errChan).Should(Receive(HaveOccurred()))
+			Eventually(sess.Context().Done()).Should(BeClosed())
+		})
+	})
+
 	Context("receiving packets", func() {
 		var hdr *wire.Header
 
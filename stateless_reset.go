@@ -0,0 +1,73 @@
+package quic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"hash"
+	"sync"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/qerr"
+)
+
+// errStatelessReset is the error a session is closed with when the peer sends a stateless reset.
+var errStatelessReset = qerr.Error(qerr.PublicReset, "received a stateless reset")
+
+// A statelessResetter derives the stateless reset token for a connection ID.
+// Since the token only depends on the key and the connection ID,
+// a server that lost its state can still generate a valid reset for a connection.
+type statelessResetter struct {
+	mutex sync.Mutex
+	h     hash.Hash
+}
+
+// newStatelessResetter creates a new statelessResetter.
+// If the key is nil, a random key is used, and tokens are only valid for the lifetime of the statelessResetter.
+func newStatelessResetter(key []byte) (*statelessResetter, error) {
+	if key == nil {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &statelessResetter{h: hmac.New(sha256.New, key)}, nil
+}
+
+func (r *statelessResetter) GetStatelessResetToken(connID protocol.ConnectionID) [16]byte {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var token [16]byte
+	r.h.Write(connID)
+	copy(token[:], r.h.Sum(nil))
+	r.h.Reset()
+	return token
+}
+
+// composeStatelessReset composes a stateless reset packet.
+// To an observer, it looks like a regular Short Header packet.
+func composeStatelessReset(token [16]byte) ([]byte, error) {
+	data := make([]byte, protocol.MinStatelessResetSize)
+	if _, err := rand.Read(data[:len(data)-protocol.StatelessResetTokenLen]); err != nil {
+		return nil, err
+	}
+	// set the bits of a Short Header with a 4 byte packet number, keeping the random key phase bit
+	data[0] = (data[0] & 0x40) | 0x32
+	copy(data[len(data)-protocol.StatelessResetTokenLen:], token[:])
+	return data, nil
+}
+
+// isStatelessReset says if a packet ends with one of the tokens
+func isStatelessReset(data []byte, tokens [][16]byte) bool {
+	if len(data) < protocol.StatelessResetTokenLen {
+		return false
+	}
+	tail := data[len(data)-protocol.StatelessResetTokenLen:]
+	for _, token := range tokens {
+		if hmac.Equal(tail, token[:]) {
+			return true
+		}
+	}
+	return false
+}
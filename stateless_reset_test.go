@@ -0,0 +1,71 @@
+package quic
+
+import (
+	"bytes"
+
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+	"github.com/wangjiezhe/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Stateless Resets", func() {
+	It("derives the same token for the same key and connection ID", func() {
+		r1, err := newStatelessResetter([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		r2, err := newStatelessResetter([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+		Expect(r1.GetStatelessResetToken(connID)).To(Equal(r2.GetStatelessResetToken(connID)))
+		Expect(r1.GetStatelessResetToken(connID)).To(Equal(r1.GetStatelessResetToken(connID)))
+	})
+
+	It("derives different tokens for different connection IDs", func() {
+		r, err := newStatelessResetter([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.GetStatelessResetToken(protocol.ConnectionID{1, 2, 3, 4})).ToNot(Equal(r.GetStatelessResetToken(protocol.ConnectionID{4, 3, 2, 1})))
+	})
+
+	It("derives different tokens for different keys", func() {
+		r1, err := newStatelessResetter([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+		r2, err := newStatelessResetter([]byte("bar"))
+		Expect(err).ToNot(HaveOccurred())
+		connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+		Expect(r1.GetStatelessResetToken(connID)).ToNot(Equal(r2.GetStatelessResetToken(connID)))
+	})
+
+	It("uses a random key if none is given", func() {
+		r1, err := newStatelessResetter(nil)
+		Expect(err).ToNot(HaveOccurred())
+		r2, err := newStatelessResetter(nil)
+		Expect(err).ToNot(HaveOccurred())
+		connID := protocol.ConnectionID{0xde, 0xad, 0xbe, 0xef}
+		Expect(r1.GetStatelessResetToken(connID)).ToNot(Equal(r2.GetStatelessResetToken(connID)))
+	})
+
+	It("composes a stateless reset that looks like a Short Header packet", func() {
+		token := [16]byte{0xde, 0xca, 0xfb, 0xad}
+		data, err := composeStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(HaveLen(protocol.MinStatelessResetSize))
+		Expect(data[len(data)-16:]).To(Equal(token[:]))
+		for _, l := range []int{0, 4, 8, 18} {
+			hdr, err := wire.ParseHeaderSentByServer(bytes.NewReader(data), l)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hdr.IsLongHeader).To(BeFalse())
+			Expect(hdr.IsPublicHeader).To(BeFalse())
+		}
+	})
+
+	It("detects stateless resets", func() {
+		token := [16]byte{0xde, 0xca, 0xfb, 0xad}
+		data, err := composeStatelessReset(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(isStatelessReset(data, [][16]byte{{1, 2, 3, 4}, token})).To(BeTrue())
+		Expect(isStatelessReset(data, [][16]byte{{1, 2, 3, 4}})).To(BeFalse())
+		Expect(isStatelessReset(data, nil)).To(BeFalse())
+		Expect(isStatelessReset(data[:15], [][16]byte{token})).To(BeFalse())
+	})
+})
@@ -12,12 +12,20 @@ type streamFramer struct {
 	cryptoStream cryptoStreamI
 	version      protocol.VersionNumber
 
-	streamQueueMutex    sync.Mutex
-	activeStreams       map[protocol.StreamID]struct{}
+	streamQueueMutex sync.Mutex
+	activeStreams    map[protocol.StreamID]struct{}
+	// streamQueue contains the active streams, sorted by priority
 	streamQueue         []protocol.StreamID
 	hasCryptoStreamData bool
+	// priorities contains the priorities of all streams that don't use the defaultPriority
+	priorities map[protocol.StreamID]Priority
+	// credits contains the number of STREAM frames that streams with a weight larger than 1
+	// can still send in the current round
+	credits map[protocol.StreamID]uint8
 }
 
+var defaultPriority = Priority{Urgency: 3, Incremental: true, Weight: 1}
+
 func newStreamFramer(
 	cryptoStream cryptoStreamI,
 	streamGetter streamGetter,
@@ -27,6 +35,8 @@ func newStreamFramer(
 		streamGetter:  streamGetter,
 		cryptoStream:  cryptoStream,
 		activeStreams: make(map[protocol.StreamID]struct{}),
+		priorities:    make(map[protocol.StreamID]Priority),
+		credits:       make(map[protocol.StreamID]uint8),
 		version:       v,
 	}
 }
@@ -40,12 +50,106 @@ func (f *streamFramer) AddActiveStream(id protocol.StreamID) {
 	}
 	f.streamQueueMutex.Lock()
 	if _, ok := f.activeStreams[id]; !ok {
-		f.streamQueue = append(f.streamQueue, id)
+		f.insertStream(id, false)
 		f.activeStreams[id] = struct{}{}
 	}
 	f.streamQueueMutex.Unlock()
 }
 
+func (f *streamFramer) SetStreamPriority(id protocol.StreamID, p Priority) {
+	if p.Weight == 0 {
+		p.Weight = 1
+	}
+	f.streamQueueMutex.Lock()
+	defer f.streamQueueMutex.Unlock()
+
+	if p == f.getPriority(id) {
+		return
+	}
+	if p == defaultPriority {
+		delete(f.priorities, id)
+	} else {
+		f.priorities[id] = p
+	}
+	delete(f.credits, id)
+	// move an active stream to the position for its new priority
+	if _, ok := f.activeStreams[id]; ok {
+		for i, qid := range f.streamQueue {
+			if qid == id {
+				f.streamQueue = append(f.streamQueue[:i], f.streamQueue[i+1:]...)
+				break
+			}
+		}
+		f.insertStream(id, false)
+	}
+}
+
+// RemoveStream is called when a stream is completed
+func (f *streamFramer) RemoveStream(id protocol.StreamID) {
+	f.streamQueueMutex.Lock()
+	delete(f.priorities, id)
+	delete(f.credits, id)
+	f.streamQueueMutex.Unlock()
+}
+
+func (f *streamFramer) getPriority(id protocol.StreamID) Priority {
+	if p, ok := f.priorities[id]; ok {
+		return p
+	}
+	return defaultPriority
+}
+
+// insertStream inserts a stream into the stream queue, keeping it sorted by priority.
+// Non-incremental streams are inserted in the order of their stream IDs, before the incremental streams of the same urgency.
+// Incremental streams are inserted after all other streams of the same urgency, so they are served round-robin.
+// If front is set, an incremental stream is inserted before the other incremental streams of the same urgency instead.
+func (f *streamFramer) insertStream(id protocol.StreamID, front bool) {
+	p := f.getPriority(id)
+	// In the common case, the stream is inserted at the end of the queue.
+	i := len(f.streamQueue)
+	for ; i > 0; i-- {
+		qid := f.streamQueue[i-1]
+		qp := f.getPriority(qid)
+		if qp.Urgency != p.Urgency {
+			if qp.Urgency < p.Urgency {
+				break
+			}
+			continue
+		}
+		if qp.Incremental != p.Incremental {
+			if !qp.Incremental {
+				break
+			}
+			continue
+		}
+		if (!p.Incremental && qid < id) || (p.Incremental && !front) {
+			break
+		}
+	}
+	f.streamQueue = append(f.streamQueue, 0)
+	copy(f.streamQueue[i+1:], f.streamQueue[i:])
+	f.streamQueue[i] = id
+}
+
+// requeueStream puts a stream that has more data back into the stream queue.
+// A stream with a weight larger than 1 stays in front of the other incremental streams of the same urgency,
+// until it sent as many STREAM frames as its weight.
+func (f *streamFramer) requeueStream(id protocol.StreamID) {
+	if p := f.getPriority(id); p.Incremental && p.Weight > 1 {
+		credits, ok := f.credits[id]
+		if !ok {
+			credits = p.Weight
+		}
+		if credits--; credits > 0 {
+			f.credits[id] = credits
+			f.insertStream(id, true)
+			return
+		}
+		delete(f.credits, id)
+	}
+	f.insertStream(id, false)
+}
+
 func (f *streamFramer) HasCryptoStreamData() bool {
 	f.streamQueueMutex.Lock()
 	hasCryptoStreamData := f.hasCryptoStreamData
@@ -64,6 +168,7 @@ func (f *streamFramer) PopCryptoStreamFrame(maxLen protocol.ByteCount) *wire.Str
 func (f *streamFramer) PopStreamFrames(maxTotalLen protocol.ByteCount) []*wire.StreamFrame {
 	var currentLen protocol.ByteCount
 	var frames []*wire.StreamFrame
+	var requeue []protocol.StreamID
 	f.streamQueueMutex.Lock()
 	// pop STREAM frames, until less than MinStreamFrameSize bytes are left in the packet
 	numActiveStreams := len(f.streamQueue)
@@ -82,10 +187,11 @@ func (f *streamFramer) PopStreamFrames(maxTotalLen protocol.ByteCount) []*wire.S
 			continue
 		}
 		frame, hasMoreData := str.popStreamFrame(maxTotalLen - currentLen)
-		if hasMoreData { // put the stream back in the queue (at the end)
-			f.streamQueue = append(f.streamQueue, id)
+		if hasMoreData { // put the stream back in the queue, once this packet is filled
+			requeue = append(requeue, id)
 		} else { // no more data to send. Stream is not active any more
 			delete(f.activeStreams, id)
+			delete(f.credits, id)
 		}
 		if frame == nil { // can happen if the receiveStream was canceled after it said it had data
 			continue
@@ -93,6 +199,10 @@ func (f *streamFramer) PopStreamFrames(maxTotalLen protocol.ByteCount) []*wire.S
 		frames = append(frames, frame)
 		currentLen += frame.Length(f.version)
 	}
+	// every stream is only asked for data once per packet
+	for _, id := range requeue {
+		f.requeueStream(id)
+	}
 	f.streamQueueMutex.Unlock()
 	return frames
 }
@@ -204,4 +204,151 @@ var _ = Describe("Stream Framer", func() {
 			Expect(fs).To(Equal([]*wire.StreamFrame{f}))
 		})
 	})
+
+	Context("priorities", func() {
+		const id3 = protocol.StreamID(12)
+
+		var stream3 *MockSendStreamI
+
+		BeforeEach(func() {
+			stream3 = NewMockSendStreamI(mockCtrl)
+		})
+
+		It("serves streams with a lower urgency first", func() {
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil)
+			f := &wire.StreamFrame{StreamID: id2, Data: []byte("foobar")}
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f, true)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			framer.SetStreamPriority(id2, Priority{Urgency: 1, Incremental: true})
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f}))
+		})
+
+		It("serves streams with a higher urgency once the streams with a lower urgency don't have any more data", func() {
+			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil)
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil).Times(2)
+			f1 := &wire.StreamFrame{StreamID: id1, Data: []byte("foobar")}
+			f21 := &wire.StreamFrame{StreamID: id2, Data: []byte("foo")}
+			f22 := &wire.StreamFrame{StreamID: id2, Data: []byte("bar")}
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f21, true)
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f22, false)
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f1, false)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			framer.SetStreamPriority(id1, Priority{Urgency: 5, Incremental: true})
+			framer.SetStreamPriority(id2, Priority{Urgency: 0, Incremental: true})
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f21}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f22}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f1}))
+		})
+
+		It("serves incremental streams of the same urgency round-robin", func() {
+			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil).Times(2)
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil).Times(2)
+			f11 := &wire.StreamFrame{StreamID: id1, Data: []byte("foo")}
+			f12 := &wire.StreamFrame{StreamID: id1, Data: []byte("bar")}
+			f21 := &wire.StreamFrame{StreamID: id2, Data: []byte("raboof")}
+			f22 := &wire.StreamFrame{StreamID: id2, Data: []byte("zaboof")}
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f11, true)
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f12, false)
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f21, true)
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f22, false)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			framer.SetStreamPriority(id1, Priority{Urgency: 2, Incremental: true})
+			framer.SetStreamPriority(id2, Priority{Urgency: 2, Incremental: true})
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f11}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f21}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f12}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f22}))
+		})
+
+		It("serves incremental streams of the same urgency according to their weights", func() {
+			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil).Times(3)
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil)
+			f11 := &wire.StreamFrame{StreamID: id1, Data: []byte("foo")}
+			f12 := &wire.StreamFrame{StreamID: id1, Data: []byte("bar")}
+			f13 := &wire.StreamFrame{StreamID: id1, Data: []byte("baz")}
+			f2 := &wire.StreamFrame{StreamID: id2, Data: []byte("raboof")}
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f11, true)
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f12, true)
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f13, false)
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f2, true)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			framer.SetStreamPriority(id1, Priority{Urgency: 2, Incremental: true, Weight: 2})
+			framer.SetStreamPriority(id2, Priority{Urgency: 2, Incremental: true})
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f11}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f12}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f2}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f13}))
+			Expect(framer.credits).To(BeEmpty())
+		})
+
+		It("moves an active stream when its priority changes", func() {
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			framer.AddActiveStream(id3)
+			Expect(framer.streamQueue).To(Equal([]protocol.StreamID{id1, id2, id3}))
+			framer.SetStreamPriority(id3, Priority{Urgency: 1, Incremental: true})
+			Expect(framer.streamQueue).To(Equal([]protocol.StreamID{id3, id1, id2}))
+			framer.SetStreamPriority(id1, Priority{Urgency: MaxUrgency, Incremental: true})
+			Expect(framer.streamQueue).To(Equal([]protocol.StreamID{id3, id2, id1}))
+			framer.SetStreamPriority(id1, defaultPriority)
+			Expect(framer.streamQueue).To(Equal([]protocol.StreamID{id3, id2, id1}))
+		})
+
+		It("serves non-incremental streams of the same urgency one after the other, in the order of their stream IDs", func() {
+			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil).Times(2)
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil)
+			f11 := &wire.StreamFrame{StreamID: id1, Data: []byte("foo")}
+			f12 := &wire.StreamFrame{StreamID: id1, Data: []byte("bar")}
+			f2 := &wire.StreamFrame{StreamID: id2, Data: []byte("raboof")}
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f11, true)
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f12, false)
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f2, false)
+			framer.AddActiveStream(id2)
+			framer.AddActiveStream(id1)
+			framer.SetStreamPriority(id1, Priority{Urgency: 2})
+			framer.SetStreamPriority(id2, Priority{Urgency: 2})
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f11}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f12}))
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f2}))
+		})
+
+		It("serves non-incremental streams before incremental streams of the same urgency", func() {
+			streamGetter.EXPECT().GetOrOpenSendStream(id3).Return(stream3, nil)
+			f := &wire.StreamFrame{StreamID: id3, Data: []byte("foobar")}
+			stream3.EXPECT().popStreamFrame(gomock.Any()).Return(f, true)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id3)
+			framer.SetStreamPriority(id3, Priority{Urgency: defaultPriority.Urgency})
+			Expect(framer.PopStreamFrames(protocol.MinStreamFrameSize)).To(Equal([]*wire.StreamFrame{f}))
+		})
+
+		It("fills the packet with data from streams with a higher urgency", func() {
+			streamGetter.EXPECT().GetOrOpenSendStream(id1).Return(stream1, nil)
+			streamGetter.EXPECT().GetOrOpenSendStream(id2).Return(stream2, nil)
+			f1 := &wire.StreamFrame{StreamID: id1, Data: []byte("foobar")}
+			f2 := &wire.StreamFrame{StreamID: id2, Data: []byte("raboof")}
+			stream2.EXPECT().popStreamFrame(gomock.Any()).Return(f2, false)
+			stream1.EXPECT().popStreamFrame(gomock.Any()).Return(f1, false)
+			framer.AddActiveStream(id1)
+			framer.AddActiveStream(id2)
+			framer.SetStreamPriority(id1, Priority{Urgency: MaxUrgency})
+			framer.SetStreamPriority(id2, Priority{Urgency: 0})
+			Expect(framer.PopStreamFrames(1000)).To(Equal([]*wire.StreamFrame{f2, f1}))
+		})
+
+		It("forgets about priorities", func() {
+			framer.SetStreamPriority(id1, Priority{Urgency: 1})
+			framer.SetStreamPriority(id2, Priority{Urgency: 1})
+			Expect(framer.priorities).To(HaveLen(2))
+			// a weight of 0 is the same as a weight of 1
+			framer.SetStreamPriority(id1, Priority{Urgency: defaultPriority.Urgency, Incremental: true})
+			Expect(framer.priorities).To(HaveLen(1))
+			framer.RemoveStream(id2)
+			Expect(framer.priorities).To(BeEmpty())
+		})
+	})
 })
@@ -2,6 +2,7 @@ package quic
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/wangjiezhe/quic-go/internal/flowcontrol"
 	"github.com/wangjiezhe/quic-go/internal/handshake"
@@ -28,6 +29,8 @@ type streamsMap struct {
 	outgoingUniStreams  *outgoingUniStreamsMap
 	incomingBidiStreams *incomingBidiStreamsMap
 	incomingUniStreams  *incomingUniStreamsMap
+
+	numStreams int32 // used atomically
 }
 
 var _ streamManager = &streamsMap{}
@@ -58,12 +61,15 @@ func newStreamsMap(
 		firstIncomingUniStream = 3
 	}
 	newBidiStream := func(id protocol.StreamID) streamI {
+		atomic.AddInt32(&m.numStreams, 1)
 		return newStream(id, m.sender, m.newFlowController(id), version)
 	}
 	newUniSendStream := func(id protocol.StreamID) sendStreamI {
+		atomic.AddInt32(&m.numStreams, 1)
 		return newSendStream(id, m.sender, m.newFlowController(id), version)
 	}
 	newUniReceiveStream := func(id protocol.StreamID) receiveStreamI {
+		atomic.AddInt32(&m.numStreams, 1)
 		return newReceiveStream(id, m.sender, m.newFlowController(id), version)
 	}
 	m.outgoingBidiStreams = newOutgoingBidiStreamsMap(
@@ -145,18 +151,27 @@ func (m *streamsMap) AcceptUniStream() (ReceiveStream, error) {
 }
 
 func (m *streamsMap) DeleteStream(id protocol.StreamID) error {
+	var err error
 	switch m.getStreamType(id) {
 	case streamTypeIncomingBidi:
-		return m.incomingBidiStreams.DeleteStream(id)
+		err = m.incomingBidiStreams.DeleteStream(id)
 	case streamTypeOutgoingBidi:
-		return m.outgoingBidiStreams.DeleteStream(id)
+		err = m.outgoingBidiStreams.DeleteStream(id)
 	case streamTypeIncomingUni:
-		return m.incomingUniStreams.DeleteStream(id)
+		err = m.incomingUniStreams.DeleteStream(id)
 	case streamTypeOutgoingUni:
-		return m.outgoingUniStreams.DeleteStream(id)
+		err = m.outgoingUniStreams.DeleteStream(id)
 	default:
 		panic("invalid stream type")
 	}
+	if err == nil {
+		atomic.AddInt32(&m.numStreams, -1)
+	}
+	return err
+}
+
+func (m *streamsMap) NumStreams() int {
+	return int(atomic.LoadInt32(&m.numStreams))
 }
 
 func (m *streamsMap) GetOrOpenReceiveStream(id protocol.StreamID) (receiveStreamI, error) {
@@ -216,6 +231,12 @@ func (m *streamsMap) UpdateLimits(p *handshake.TransportParameters) {
 	m.outgoingUniStreams.SetMaxStream(protocol.MaxUniStreamID(int(p.MaxUniStreams), peerPers))
 }
 
+// StopIssuingMaxStreamID stops raising the limits for streams opened by the peer.
+func (m *streamsMap) StopIssuingMaxStreamID() {
+	m.incomingBidiStreams.StopIssuingMaxStreamID()
+	m.incomingUniStreams.StopIssuingMaxStreamID()
+}
+
 func (m *streamsMap) CloseWithError(err error) {
 	m.outgoingBidiStreams.CloseWithError(err)
 	m.outgoingUniStreams.CloseWithError(err)
@@ -25,6 +25,8 @@ type incomingBidiStreamsMap struct {
 
 	newStream        func(protocol.StreamID) streamI
 	queueMaxStreamID func(*wire.MaxStreamIDFrame)
+	// set when the peer must not open any new streams beyond maxStream
+	stopIssuingMaxStreamID bool
 
 	closeErr error
 }
@@ -112,6 +114,9 @@ func (m *incomingBidiStreamsMap) DeleteStream(id protocol.StreamID) error {
 		return fmt.Errorf("Tried to delete unknown stream %d", id)
 	}
 	delete(m.streams, id)
+	if m.stopIssuingMaxStreamID {
+		return nil
+	}
 	// queue a MAX_STREAM_ID frame, giving the peer the option to open a new stream
 	if numNewStreams := m.maxNumStreams - len(m.streams); numNewStreams > 0 {
 		m.maxStream = m.highestStream + protocol.StreamID(numNewStreams*4)
@@ -120,6 +125,13 @@ func (m *incomingBidiStreamsMap) DeleteStream(id protocol.StreamID) error {
 	return nil
 }
 
+// StopIssuingMaxStreamID stops raising the stream limit when streams are deleted.
+func (m *incomingBidiStreamsMap) StopIssuingMaxStreamID() {
+	m.mutex.Lock()
+	m.stopIssuingMaxStreamID = true
+	m.mutex.Unlock()
+}
+
 func (m *incomingBidiStreamsMap) CloseWithError(err error) {
 	m.mutex.Lock()
 	m.closeErr = err
@@ -162,4 +162,16 @@ var _ = Describe("Streams Map (incoming)", func() {
 		mockSender.EXPECT().queueControlFrame(&wire.MaxStreamIDFrame{StreamID: initialMaxStream + 8})
 		Expect(m.DeleteStream(firstNewStream + 3*4)).To(Succeed())
 	})
+
+	It("doesn't send MAX_STREAM_ID frames after StopIssuingMaxStreamID was called", func() {
+		_, err := m.GetOrOpenStream(firstNewStream + 4*4)
+		Expect(err).ToNot(HaveOccurred())
+		m.StopIssuingMaxStreamID()
+		Expect(m.DeleteStream(firstNewStream + 4)).To(Succeed())
+		// the peer can still open streams up to the current limit
+		_, err = m.GetOrOpenStream(initialMaxStream)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = m.GetOrOpenStream(initialMaxStream + 4)
+		Expect(err).To(HaveOccurred())
+	})
 })
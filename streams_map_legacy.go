@@ -237,6 +237,12 @@ func (m *streamsMapLegacy) DeleteStream(id protocol.StreamID) error {
 	return nil
 }
 
+func (m *streamsMapLegacy) NumStreams() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.streams)
+}
+
 func (m *streamsMapLegacy) putStream(s streamI) error {
 	id := s.StreamID()
 	if _, ok := m.streams[id]; ok {
@@ -271,6 +277,10 @@ func (m *streamsMapLegacy) UpdateLimits(params *handshake.TransportParameters) {
 	m.openStreamOrErrCond.Broadcast()
 }
 
+// StopIssuingMaxStreamID is a no-op, since gQUIC has no MAX_STREAM_ID frames.
+// Instead, the session refuses streams opened after it sent a GOAWAY frame.
+func (m *streamsMapLegacy) StopIssuingMaxStreamID() {}
+
 // should never be called, since MAX_STREAM_ID frames can only be unpacked for IETF QUIC
 func (m *streamsMapLegacy) HandleMaxStreamIDFrame(f *wire.MaxStreamIDFrame) error {
 	return errors.New("gQUIC doesn't have MAX_STREAM_ID frames")
@@ -346,6 +346,16 @@ var _ = Describe("Streams Map (for IETF QUIC)", func() {
 					})
 					Expect(m.DeleteStream(ids.firstIncomingUniStream)).To(Succeed())
 				})
+
+				It("stops sending MAX_STREAM_ID frames", func() {
+					_, err := m.GetOrOpenReceiveStream(ids.firstIncomingBidiStream + 4*10)
+					Expect(err).ToNot(HaveOccurred())
+					_, err = m.GetOrOpenReceiveStream(ids.firstIncomingUniStream + 4*10)
+					Expect(err).ToNot(HaveOccurred())
+					m.StopIssuingMaxStreamID()
+					Expect(m.DeleteStream(ids.firstIncomingBidiStream)).To(Succeed())
+					Expect(m.DeleteStream(ids.firstIncomingUniStream)).To(Succeed())
+				})
 			})
 
 			It("closes", func() {
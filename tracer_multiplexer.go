@@ -0,0 +1,103 @@
+package quic
+
+import "net"
+
+// tracerMultiplexer passes all events to multiple Tracers
+type tracerMultiplexer []Tracer
+
+var _ Tracer = tracerMultiplexer{}
+
+// newTracerMultiplexer creates a Tracer that passes all events to the given Tracers.
+// Tracers that are nil are ignored. If no Tracer is left, it returns nil.
+func newTracerMultiplexer(tracers ...Tracer) Tracer {
+	var ts tracerMultiplexer
+	for _, t := range tracers {
+		if t != nil {
+			ts = append(ts, t)
+		}
+	}
+	switch len(ts) {
+	case 0:
+		return nil
+	case 1:
+		return ts[0]
+	default:
+		return ts
+	}
+}
+
+func (m tracerMultiplexer) TracerForConnection(p Perspective, odcid ConnectionID) ConnectionTracer {
+	var tracers connectionTracerMultiplexer
+	for _, t := range m {
+		if ct := t.TracerForConnection(p, odcid); ct != nil {
+			tracers = append(tracers, ct)
+		}
+	}
+	switch len(tracers) {
+	case 0:
+		return nil
+	case 1:
+		return tracers[0]
+	default:
+		return tracers
+	}
+}
+
+func (m tracerMultiplexer) DroppedPacket(remoteAddr net.Addr, reason PacketDropReason, size ByteCount) {
+	for _, t := range m {
+		t.DroppedPacket(remoteAddr, reason, size)
+	}
+}
+
+// connectionTracerMultiplexer passes all events to multiple ConnectionTracers
+type connectionTracerMultiplexer []ConnectionTracer
+
+var _ ConnectionTracer = connectionTracerMultiplexer{}
+
+func (m connectionTracerMultiplexer) SentPacket(p *PacketInfo) {
+	for _, t := range m {
+		t.SentPacket(p)
+	}
+}
+
+func (m connectionTracerMultiplexer) ReceivedPacket(p *PacketInfo) {
+	for _, t := range m {
+		t.ReceivedPacket(p)
+	}
+}
+
+func (m connectionTracerMultiplexer) DroppedPacket(reason PacketDropReason, size ByteCount) {
+	for _, t := range m {
+		t.DroppedPacket(reason, size)
+	}
+}
+
+func (m connectionTracerMultiplexer) LostPacket(encLevel EncryptionLevel, pn PacketNumber, size ByteCount) {
+	for _, t := range m {
+		t.LostPacket(encLevel, pn, size)
+	}
+}
+
+func (m connectionTracerMultiplexer) UpdatedMetrics(metrics Metrics) {
+	for _, t := range m {
+		t.UpdatedMetrics(metrics)
+	}
+}
+
+func (m connectionTracerMultiplexer) UpdatedCongestionState(s CongestionState) {
+	for _, t := range m {
+		t.UpdatedCongestionState(s)
+	}
+}
+
+func (m connectionTracerMultiplexer) LossTimerExpired(tt TimerType) {
+	for _, t := range m {
+		t.LossTimerExpired(tt)
+	}
+}
+
+func (m connectionTracerMultiplexer) Close() {
+	for _, t := range m {
+		t.Close()
+	}
+}
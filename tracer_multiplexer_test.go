@@ -0,0 +1,90 @@
+package quic
+
+import (
+	"net"
+
+	"github.com/golang/mock/gomock"
+	"github.com/wangjiezhe/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracer Multiplexer", func() {
+	It("returns nil if there are no tracers", func() {
+		Expect(newTracerMultiplexer()).To(BeNil())
+		Expect(newTracerMultiplexer(nil, nil)).To(BeNil())
+	})
+
+	It("returns a single tracer", func() {
+		tracer := NewMockTracer(mockCtrl)
+		Expect(newTracerMultiplexer(nil, tracer)).To(Equal(tracer))
+	})
+
+	Context("with multiple tracers", func() {
+		var (
+			tr1, tr2 *MockTracer
+			tracer   Tracer
+		)
+
+		BeforeEach(func() {
+			tr1 = NewMockTracer(mockCtrl)
+			tr2 = NewMockTracer(mockCtrl)
+			tracer = newTracerMultiplexer(tr1, tr2)
+		})
+
+		It("traces dropped packets", func() {
+			addr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}
+			tr1.EXPECT().DroppedPacket(addr, PacketDropUnknownConnectionID, protocol.ByteCount(1337))
+			tr2.EXPECT().DroppedPacket(addr, PacketDropUnknownConnectionID, protocol.ByteCount(1337))
+			tracer.DroppedPacket(addr, PacketDropUnknownConnectionID, 1337)
+		})
+
+		It("returns nil if no tracer traces the connection", func() {
+			connID := protocol.ConnectionID{1, 2, 3, 4}
+			tr1.EXPECT().TracerForConnection(protocol.PerspectiveClient, connID)
+			tr2.EXPECT().TracerForConnection(protocol.PerspectiveClient, connID)
+			Expect(tracer.TracerForConnection(protocol.PerspectiveClient, connID)).To(BeNil())
+		})
+
+		It("returns a single connection tracer", func() {
+			connID := protocol.ConnectionID{1, 2, 3, 4}
+			ct := NewMockConnectionTracer(mockCtrl)
+			tr1.EXPECT().TracerForConnection(protocol.PerspectiveServer, connID)
+			tr2.EXPECT().TracerForConnection(protocol.PerspectiveServer, connID).Return(ct)
+			Expect(tracer.TracerForConnection(protocol.PerspectiveServer, connID)).To(Equal(ct))
+		})
+
+		It("passes events to all connection tracers", func() {
+			connID := protocol.ConnectionID{1, 2, 3, 4}
+			ct1 := NewMockConnectionTracer(mockCtrl)
+			ct2 := NewMockConnectionTracer(mockCtrl)
+			tr1.EXPECT().TracerForConnection(protocol.PerspectiveServer, connID).Return(ct1)
+			tr2.EXPECT().TracerForConnection(protocol.PerspectiveServer, connID).Return(ct2)
+			ct := tracer.TracerForConnection(protocol.PerspectiveServer, connID)
+			Expect(ct).ToNot(BeNil())
+
+			p := &PacketInfo{PacketNumber: 42}
+			for _, c := range []*MockConnectionTracer{ct1, ct2} {
+				gomock.InOrder(
+					c.EXPECT().SentPacket(p),
+					c.EXPECT().ReceivedPacket(p),
+					c.EXPECT().DroppedPacket(PacketDropDuplicate, protocol.ByteCount(100)),
+					c.EXPECT().LostPacket(protocol.EncryptionForwardSecure, protocol.PacketNumber(10), protocol.ByteCount(1000)),
+					c.EXPECT().UpdatedMetrics(Metrics{CongestionWindow: 1000}),
+					c.EXPECT().UpdatedCongestionState(CongestionStateRecovery),
+					c.EXPECT().LossTimerExpired(TimerTypeTLP),
+					c.EXPECT().Close(),
+				)
+			}
+			ct.SentPacket(p)
+			ct.ReceivedPacket(p)
+			ct.DroppedPacket(PacketDropDuplicate, 100)
+			ct.LostPacket(protocol.EncryptionForwardSecure, 10, 1000)
+			ct.UpdatedMetrics(Metrics{CongestionWindow: 1000})
+			ct.UpdatedCongestionState(CongestionStateRecovery)
+			ct.LossTimerExpired(TimerTypeTLP)
+			ct.Close()
+		})
+	})
+})